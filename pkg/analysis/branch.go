@@ -0,0 +1,50 @@
+package analysis
+
+import (
+	"regexp"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 分支的状态，取该分支日志中最后出现的事件
+const (
+	BranchRegistered     = "registered"
+	BranchCommitted      = "committed"
+	BranchRolledBack     = "rolled_back"
+	BranchCommitFailed   = "commit_failed"
+	BranchRollbackFailed = "rollback_failed"
+)
+
+var (
+	branchCommittedPattern  = regexp.MustCompile(`(?i)branch ?commit\w*.*(?:success|done)|PhaseTwo_?Committed`)
+	branchRolledBackPattern = regexp.MustCompile(`(?i)branch ?roll ?back\w*.*(?:success|done)|PhaseTwo_?Rollbacked`)
+)
+
+// 日志所属的服务：优先取消息中的 Seata applicationId，否则为写入日志的应用
+func EntryService(entry model.LogData) string {
+	if m := parser.ApplicationIDPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+		return m[1]
+	}
+	return model.BareApplicationID(entry.ApplicationID)
+}
+
+// 识别分支二阶段的结果，失败优先于成功
+func BranchEventStatus(message string) string {
+	if ClassifyRollbackFailure(message) != "" {
+		return BranchRollbackFailed
+	}
+	switch ClassifyEvent(message) {
+	case EventCommitFailed:
+		return BranchCommitFailed
+	case EventRollbackFailed:
+		return BranchRollbackFailed
+	}
+	switch {
+	case branchCommittedPattern.MatchString(message):
+		return BranchCommitted
+	case branchRolledBackPattern.MatchString(message):
+		return BranchRolledBack
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// TC 集群（raft）相关的发现编码
+var (
+	findingPeerUnreachable = registerFinding(FindingSpec{
+		Code:        "SEATA-CLUSTER-001",
+		Severity:    SeverityError,
+		Title:       "TC peer unreachable",
+		Description: "A TC node repeatedly failed to connect to a raft peer; the cluster may be partitioned or the peer is down.",
+	})
+	findingElectionChurn = registerFinding(FindingSpec{
+		Code:        "SEATA-CLUSTER-002",
+		Severity:    SeverityWarning,
+		Title:       "Repeated raft leader elections",
+		Description: "A TC node kept starting pre-vote rounds, meaning it could not see a stable leader.",
+	})
+	findingSplitBrain = registerFinding(FindingSpec{
+		Code:        "SEATA-CLUSTER-003",
+		Severity:    SeverityCritical,
+		Title:       "Multiple raft leaders in one term",
+		Description: "More than one TC node became leader for the same term, so the cluster split and both halves accepted transactions.",
+	})
+)
+
+var (
+	peerConnectFailPattern = regexp.MustCompile(`(?:Fail to connect|channel init failed, address=)\s*([\w.\-]+:\d+)`)
+	preVotePattern         = regexp.MustCompile(`Node <[^/]*/([\w.\-]+:\d+)> term (\d+) start preVote`)
+)
+
+// 选举轮次达到该数量才输出发现
+const electionChurnThreshold = 3
+
+// TC 集群分析器：raft 对端不可达、反复选举和同一任期多个 leader
+type ClusterAnalyzer struct {
+	peers     map[string]*findingBuilder // 不可达的节点 → 发现
+	elections map[string]*findingBuilder // 发起选举的节点 → 发现
+	terms     map[string]map[string]struct{}
+	leaders   map[string]*findingBuilder // 应用和任期 → 发现
+	claimants map[string]map[string]bool // 应用和任期 → 成为 leader 的节点
+}
+
+func NewClusterAnalyzer() *ClusterAnalyzer {
+	return &ClusterAnalyzer{
+		peers:     make(map[string]*findingBuilder),
+		elections: make(map[string]*findingBuilder),
+		terms:     make(map[string]map[string]struct{}),
+		leaders:   make(map[string]*findingBuilder),
+		claimants: make(map[string]map[string]bool),
+	}
+}
+
+func (a *ClusterAnalyzer) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	if m := peerConnectFailPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+		b, ok := a.peers[m[1]]
+		if !ok {
+			b = newFindingBuilder(findingPeerUnreachable)
+			b.Entity("peer", m[1])
+			a.peers[m[1]] = b
+		}
+		b.Entity("application", entry.ApplicationID)
+		b.Add(entry, ref, at)
+		return
+	}
+
+	if m := parser.RaftLeaderPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+		key := entry.ApplicationID + "\x00" + m[2]
+		b, ok := a.leaders[key]
+		if !ok {
+			b = newFindingBuilder(findingSplitBrain)
+			b.Entity("application", entry.ApplicationID)
+			a.leaders[key] = b
+			a.claimants[key] = make(map[string]bool)
+		}
+		b.Entity("tc_node", m[1])
+		b.Add(entry, ref, at)
+		a.claimants[key][m[1]] = true
+		return
+	}
+
+	if m := preVotePattern.FindStringSubmatch(entry.LogMessage); m != nil {
+		b, ok := a.elections[m[1]]
+		if !ok {
+			b = newFindingBuilder(findingElectionChurn)
+			b.Entity("tc_node", m[1])
+			a.elections[m[1]] = b
+			a.terms[m[1]] = make(map[string]struct{})
+		}
+		b.Entity("application", entry.ApplicationID)
+		b.Add(entry, ref, at)
+		a.terms[m[1]][m[2]] = struct{}{}
+	}
+}
+
+func (a *ClusterAnalyzer) Findings() []Finding {
+	var findings []Finding
+	for _, peer := range sortedKeys(a.peers) {
+		b := a.peers[peer]
+		findings = append(findings, b.Build("%d failed connection attempts to %s", b.finding.Count, peer))
+	}
+	for _, node := range sortedKeys(a.elections) {
+		b := a.elections[node]
+		if b.finding.Count < electionChurnThreshold {
+			continue
+		}
+		findings = append(findings, b.Build("%s started %d pre-vote rounds across %d terms without a stable leader",
+			node, b.finding.Count, len(a.terms[node])))
+	}
+	for _, key := range sortedKeys(a.leaders) {
+		nodes := a.claimants[key]
+		if len(nodes) < 2 {
+			continue
+		}
+		app, term, _ := strings.Cut(key, "\x00")
+		findings = append(findings, a.leaders[key].Build("%s had %d leaders in term %s: %s",
+			app, len(nodes), term, strings.Join(sortedKeys(nodes), ", ")))
+	}
+	return findings
+}
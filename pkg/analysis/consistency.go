@@ -0,0 +1,420 @@
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 二阶段一致性相关的发现编码
+var (
+	findingConflictingOutcome = registerFinding(FindingSpec{
+		Code:        "SEATA-CONSISTENCY-001",
+		Severity:    SeverityCritical,
+		Title:       "Branch outcome contradicts the TC decision",
+		Description: "The RM committed a branch the TC rolled back, or rolled back a branch the TC committed; the data of the branch no longer matches the rest of the global transaction and must be reconciled.",
+	})
+	findingMissingPhaseTwo = registerFinding(FindingSpec{
+		Code:        "SEATA-CONSISTENCY-002",
+		Severity:    SeverityError,
+		Title:       "RM never applied the phase-two decision",
+		Description: "The TC recorded the commit or rollback of a branch, but the RM owning its resource never logged receiving or finishing it; the branch may still hold uncommitted data or locks.",
+	})
+	findingPhaseTwoFailedAfterDecision = registerFinding(FindingSpec{
+		Code:        "SEATA-CONSISTENCY-003",
+		Severity:    SeverityError,
+		Title:       "RM phase two failed after the TC finished the transaction",
+		Description: "The last phase-two result the RM logged for a branch is a failure, while the TC considers the global transaction finished; verify the data of the branch.",
+	})
+)
+
+// 不一致的类别
+const (
+	consistencyConflict      = "conflicting_outcome"
+	consistencyMissingCommit = "missing_rm_commit"
+	consistencyMissingRoll   = "missing_rm_rollback"
+	consistencyRMFailed      = "rm_phase_two_failed"
+)
+
+// 日志来自 TC 还是 RM
+const (
+	seataSideTC = "TC"
+	seataSideRM = "RM"
+)
+
+var (
+	tcLoggerPattern = regexp.MustCompile(`(?i)\bseata\.server\b|\bserver\.(?:coordinator|session|transaction)\b|DefaultCore|DefaultCoordinator`)
+	rmLoggerPattern = regexp.MustCompile(`(?i)\bseata\.rm\b|\brm\.datasource\b|AbstractRMHandler|DataSourceManager|AsyncWorker`)
+	// RM 收到二阶段请求：Branch committing: <xid> <branchId> <resourceId> <applicationData>
+	rmPhaseTwoReceivedPattern = regexp.MustCompile(`(?i)\bbranch (commit|rollback)t?ing\s*:\s*(\S+)\s+(\d+)\s+(\S+)`)
+	// RM 的二阶段结果：Branch commit result: PhaseTwo_Committed、Branch Rollbacked result: PhaseTwo_Rollbacked
+	rmPhaseTwoResultPattern = regexp.MustCompile(`(?i)\bbranch (?:commit|roll ?back(?:ed)?) result\s*:\s*(\w+)`)
+	// TC 记录的分支二阶段结果：Commit branch transaction successfully, xid = ... branchId = ...
+	tcBranchOutcomePattern  = regexp.MustCompile(`(?i)\b(commit|roll ?back) branch transaction successfully`)
+	tcBranchRegisterPattern = regexp.MustCompile(`(?i)\bregister branch successfully`)
+)
+
+// 判断日志来自 TC 还是 RM，无法判断时返回空串
+func seataSide(entry model.LogData) string {
+	msg := entry.LogMessage
+	switch {
+	case rmPhaseTwoReceivedPattern.MatchString(msg) || rmPhaseTwoResultPattern.MatchString(msg):
+		return seataSideRM
+	case tcLoggerPattern.MatchString(entry.Logger):
+		return seataSideTC
+	case rmLoggerPattern.MatchString(entry.Logger):
+		return seataSideRM
+	case tcBranchOutcomePattern.MatchString(msg) || tcBranchRegisterPattern.MatchString(msg) || ClassifyEvent(msg) != "":
+		return seataSideTC
+	}
+	return ""
+}
+
+// RM 的二阶段结果状态转换为分支状态
+func rmResultStatus(status string) string {
+	s := strings.ToLower(status)
+	switch {
+	case strings.Contains(s, "commitfailed"):
+		return BranchCommitFailed
+	case strings.Contains(s, "rollbackfailed"):
+		return BranchRollbackFailed
+	case strings.Contains(s, "committed"):
+		return BranchCommitted
+	case strings.Contains(s, "rollbacked"):
+		return BranchRolledBack
+	}
+	return ""
+}
+
+// 用作证据的一条日志，消息截断到证据摘录的长度
+type consistencyEvidence struct {
+	entry model.LogData
+	ref   model.Ref
+	at    time.Time
+}
+
+func newConsistencyEvidence(entry model.LogData, ref model.Ref, at time.Time) *consistencyEvidence {
+	entry.LogMessage = truncateUTF8(entry.LogMessage, maxExcerptBytes)
+	entry.Fields = nil
+	return &consistencyEvidence{entry: entry, ref: ref, at: at}
+}
+
+// 一个分支在 TC 和 RM 两侧的记录
+type consistencyBranch struct {
+	resourceID string
+	tcStatus   string // TC 记录的分支二阶段结果，没有时以全局事务的结果为准
+	tc         *consistencyEvidence
+	rmAction   string // RM 收到的二阶段请求：commit 或 rollback
+	rmStatus   string // RM 最后记录的二阶段结果
+	rm         *consistencyEvidence
+	apps       map[string]bool
+}
+
+// 一个全局事务的记录
+type consistencyTx struct {
+	outcome  string // TC 记录的全局结果：committed 或 rolled_back
+	decision *consistencyEvidence
+	rmSeen   bool // 范围内有该事务的 RM 日志
+	mode     string
+	branches map[string]*consistencyBranch
+}
+
+// 一条不一致记录
+type ConsistencyIssue struct {
+	XID            string     `json:"xid"`
+	BranchID       string     `json:"branch_id"`
+	ResourceID     string     `json:"resource_id,omitempty"`
+	Kind           string     `json:"kind"`
+	Mode           string     `json:"mode,omitempty"`
+	TCStatus       string     `json:"tc_status"`           // committed 或 rolled_back
+	RMStatus       string     `json:"rm_status,omitempty"` // RM 最后记录的结果，只收到请求时为 commit_received 或 rollback_received
+	DecidedAt      time.Time  `json:"decided_at"`
+	RMAt           *time.Time `json:"rm_at,omitempty"`
+	ApplicationIDs []string   `json:"application_ids"`
+}
+
+// 二阶段一致性核对的结果
+type ConsistencyReport struct {
+	ApplicationIDs  []string           `json:"application_ids"`
+	Checked         int                `json:"checked"`    // 有 TC 决定的分支数
+	Pending         int                `json:"pending"`    // 决定做出不久，RM 可能尚在处理的分支数
+	Unverified      int                `json:"unverified"` // RM 日志不在范围内、无法核对的分支数
+	Kinds           map[string]int     `json:"kinds"`
+	Inconsistencies []ConsistencyIssue `json:"inconsistencies"`
+	Truncated       bool               `json:"truncated"`
+}
+
+// 二阶段一致性分析器：按 XID 交叉核对 TC 记录的分支（或全局）二阶段结果与 RM 的分支日志
+type ConsistencyAnalyzer struct {
+	Modes   map[string]bool // 只核对这些事务模式，为空时不限
+	Grace   time.Duration   // 默认 1m
+	Horizon time.Time       // 核对截止时间，之前 Grace 内做出的决定视为 RM 尚在处理；零值为当前时间
+
+	txs         map[string]*consistencyTx
+	rmResources map[string]bool      // 范围内出现过 RM 日志的资源
+	receipts    map[string][2]string // 应用/线程 → 最近收到二阶段请求的 XID 和分支，RM 的结果日志通常不带 XID
+
+	issues     []ConsistencyIssue
+	pending    int
+	unverified int
+	checked    int
+}
+
+func NewConsistencyAnalyzer() *ConsistencyAnalyzer {
+	return &ConsistencyAnalyzer{
+		Grace:       time.Minute,
+		txs:         make(map[string]*consistencyTx),
+		rmResources: make(map[string]bool),
+		receipts:    make(map[string][2]string),
+	}
+}
+
+func (a *ConsistencyAnalyzer) tx(xid string) *consistencyTx {
+	tx, ok := a.txs[xid]
+	if !ok {
+		tx = &consistencyTx{branches: make(map[string]*consistencyBranch)}
+		a.txs[xid] = tx
+	}
+	return tx
+}
+
+func (tx *consistencyTx) branch(id string) *consistencyBranch {
+	b, ok := tx.branches[id]
+	if !ok {
+		b = &consistencyBranch{apps: make(map[string]bool)}
+		tx.branches[id] = b
+	}
+	return b
+}
+
+func (a *ConsistencyAnalyzer) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	side := seataSide(entry)
+	if side == "" {
+		return
+	}
+	msg := entry.LogMessage
+	fields := parser.SeataFields(msg)
+	xid, branchID, resourceID := EntryXID(entry), entry.BranchID, fields["resource_id"]
+	if branchID == "" {
+		branchID = fields["branch_id"]
+	}
+	receiptKey := entry.ApplicationID + "\x00" + entry.Thread
+
+	if side == seataSideRM {
+		action, status := "", ""
+		if m := rmPhaseTwoReceivedPattern.FindStringSubmatch(msg); m != nil {
+			action = strings.ToLower(m[1])
+			xid, branchID, resourceID = m[2], m[3], m[4]
+			a.receipts[receiptKey] = [2]string{xid, branchID}
+		} else if m := rmPhaseTwoResultPattern.FindStringSubmatch(msg); m != nil {
+			status = rmResultStatus(m[1])
+			if xid == "" || branchID == "" {
+				r := a.receipts[receiptKey]
+				xid, branchID = r[0], r[1]
+			}
+		} else if status = BranchEventStatus(msg); status == BranchRegistered {
+			status = ""
+		}
+		if resourceID != "" {
+			a.rmResources[resourceID] = true
+		}
+		if xid == "" {
+			return
+		}
+		tx := a.tx(xid)
+		tx.rmSeen = true
+		if tx.mode == "" {
+			tx.mode = parser.EntryMode(entry)
+		}
+		if branchID == "" || (action == "" && status == "") {
+			return
+		}
+		b := tx.branch(branchID)
+		b.apps[model.BareApplicationID(entry.ApplicationID)] = true
+		if b.resourceID == "" {
+			b.resourceID = resourceID
+		}
+		if action != "" && b.rmStatus == "" {
+			b.rmAction = action
+		}
+		if status != "" {
+			b.rmStatus = status
+		}
+		b.rm = newConsistencyEvidence(entry, ref, at)
+		return
+	}
+
+	if xid == "" {
+		return
+	}
+	tx := a.tx(xid)
+	if tx.mode == "" {
+		tx.mode = parser.EntryMode(entry)
+	}
+	switch ClassifyEvent(msg) {
+	case EventCommitted:
+		tx.outcome = BranchCommitted
+		tx.decision = newConsistencyEvidence(entry, ref, at)
+	case EventRolledBack, EventTimeout:
+		// 超时的事务由 TC 回滚，之后的回滚日志覆盖这里的证据
+		if tx.outcome != BranchRolledBack || ClassifyEvent(msg) == EventRolledBack {
+			tx.outcome = BranchRolledBack
+			tx.decision = newConsistencyEvidence(entry, ref, at)
+		}
+	}
+	if branchID == "" {
+		return
+	}
+	b := tx.branch(branchID)
+	b.apps[model.BareApplicationID(entry.ApplicationID)] = true
+	if b.resourceID == "" {
+		b.resourceID = resourceID
+	}
+	if m := tcBranchOutcomePattern.FindStringSubmatch(msg); m != nil {
+		b.tcStatus = BranchRolledBack
+		if strings.EqualFold(m[1], "commit") {
+			b.tcStatus = BranchCommitted
+		}
+		b.tc = newConsistencyEvidence(entry, ref, at)
+	}
+}
+
+// 核对全部分支，结果保存在分析器中
+func (a *ConsistencyAnalyzer) check() {
+	if a.issues != nil {
+		return
+	}
+	a.issues = []ConsistencyIssue{}
+	horizon := a.Horizon
+	if horizon.IsZero() {
+		horizon = time.Now()
+	}
+	for _, xid := range sortedKeys(a.txs) {
+		tx := a.txs[xid]
+		if len(a.Modes) > 0 && !a.Modes[tx.mode] {
+			continue
+		}
+		for _, id := range sortedKeys(tx.branches) {
+			b := tx.branches[id]
+			expected, decision := b.tcStatus, b.tc
+			if expected == "" {
+				expected, decision = tx.outcome, tx.decision
+			}
+			if expected == "" {
+				continue
+			}
+			a.checked++
+			if decision.at.After(horizon.Add(-a.Grace)) {
+				a.pending++
+				continue
+			}
+
+			kind := ""
+			rm := b.rmStatus
+			switch {
+			case expected == BranchCommitted && (rm == BranchRolledBack || (rm == "" && b.rmAction == "rollback")),
+				expected == BranchRolledBack && (rm == BranchCommitted || (rm == "" && b.rmAction == "commit")):
+				kind = consistencyConflict
+			case rm == BranchCommitFailed || rm == BranchRollbackFailed:
+				kind = consistencyRMFailed
+			case rm == "" && b.rmAction == "":
+				// RM 的日志不在范围内时无法判断，不记为不一致
+				if (b.resourceID != "" && !a.rmResources[b.resourceID]) || (b.resourceID == "" && !tx.rmSeen) {
+					a.unverified++
+					continue
+				}
+				kind = consistencyMissingCommit
+				if expected == BranchRolledBack {
+					kind = consistencyMissingRoll
+				}
+			default:
+				continue
+			}
+			if rm == "" && b.rmAction != "" {
+				rm = b.rmAction + "_received"
+			}
+			issue := ConsistencyIssue{XID: xid, BranchID: id, ResourceID: b.resourceID, Kind: kind, Mode: tx.mode,
+				TCStatus: expected, RMStatus: rm, DecidedAt: decision.at, ApplicationIDs: sortedKeys(b.apps)}
+			if b.rm != nil {
+				at := b.rm.at
+				issue.RMAt = &at
+			}
+			a.issues = append(a.issues, issue)
+		}
+	}
+	// 最近做出决定的在前
+	sort.SliceStable(a.issues, func(i, j int) bool { return a.issues[i].DecidedAt.After(a.issues[j].DecidedAt) })
+}
+
+// 各发现的消息格式，参数为分支数和资源
+var consistencyMessages = map[string]string{
+	findingConflictingOutcome.Code:          "%d branches on %s ended opposite to the TC decision",
+	findingMissingPhaseTwo.Code:             "%d branches on %s have no RM log of the phase-two decision",
+	findingPhaseTwoFailedAfterDecision.Code: "%d branches on %s failed phase two after the TC finished",
+}
+
+func (a *ConsistencyAnalyzer) Findings() []Finding {
+	a.check()
+	builders := make(map[string]*findingBuilder)
+	counts := make(map[string]int)
+	for _, issue := range a.issues {
+		spec := findingMissingPhaseTwo
+		switch issue.Kind {
+		case consistencyConflict:
+			spec = findingConflictingOutcome
+		case consistencyRMFailed:
+			spec = findingPhaseTwoFailedAfterDecision
+		}
+		key := spec.Code + "\x00" + issue.ResourceID
+		b, ok := builders[key]
+		if !ok {
+			b = newFindingBuilder(spec)
+			b.Entity("resource", issue.ResourceID)
+			builders[key] = b
+		}
+		counts[key]++
+		b.Entity("xid", issue.XID)
+		b.Entity("branch", issue.BranchID)
+		for _, app := range issue.ApplicationIDs {
+			b.Entity("application", app)
+		}
+		tx := a.txs[issue.XID]
+		branch := tx.branches[issue.BranchID]
+		decision := branch.tc
+		if decision == nil {
+			decision = tx.decision
+		}
+		b.Add(decision.entry, decision.ref, decision.at)
+		if branch.rm != nil {
+			b.Add(branch.rm.entry, branch.rm.ref, branch.rm.at)
+		}
+	}
+
+	var findings []Finding
+	for _, key := range sortedKeys(builders) {
+		b := builders[key]
+		_, id, _ := strings.Cut(key, "\x00")
+		var resource any = id
+		if id == "" {
+			resource = i18n.Textf("an unknown resource")
+		}
+		findings = append(findings, b.Build(consistencyMessages[b.spec.Code], counts[key], resource))
+	}
+	return findings
+}
+
+// 核对结果，不一致记录按决定时间从新到旧排列
+func (a *ConsistencyAnalyzer) Report(applicationIDs []string) ConsistencyReport {
+	a.check()
+	report := ConsistencyReport{ApplicationIDs: applicationIDs, Checked: a.checked, Pending: a.pending, Unverified: a.unverified,
+		Kinds: make(map[string]int), Inconsistencies: a.issues}
+	for _, issue := range a.issues {
+		report.Kinds[issue.Kind]++
+	}
+	return report
+}
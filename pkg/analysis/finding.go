@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+)
+
+// 发现的严重程度
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
+// 每个发现最多附带的证据条数
+const MaxEvidence = 5
+
+// 证据摘录的最大字节数
+const maxExcerptBytes = 300
+
+// 分析器：逐条接收日志，结束后输出发现
+type Analyzer interface {
+	Observe(entry model.LogData, ref model.Ref, at time.Time)
+	Findings() []Finding
+}
+
+// 分析器输出的发现，结构和编码保持稳定，供自动化工具直接消费
+type Finding struct {
+	Code      string        `json:"code"`     // 稳定的发现编码，见 Catalog
+	Severity  string        `json:"severity"` // info、warning、error、critical
+	Title     string        `json:"title"`
+	Message   string        `json:"message"`
+	Entities  []Entity      `json:"entities"` // 受影响的对象
+	Evidence  []EvidenceRef `json:"evidence"` // 支撑该发现的日志
+	Count     int           `json:"count"`    // 命中的日志条数
+	FirstSeen time.Time     `json:"first_seen"`
+	LastSeen  time.Time     `json:"last_seen"`
+
+	text i18n.Text // 说明的英文原文，返回前按请求的语言生成 message；为零值时 message 不翻译
+}
+
+// 受影响的对象，如应用、XID、资源、TC 节点
+type Entity struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// 证据：指向存储中的一条日志
+type EvidenceRef struct {
+	model.Ref
+	Timestamp string `json:"timestamp"`
+	Excerpt   string `json:"excerpt"`
+}
+
+// 一条日志作为证据，消息截断为摘录
+func NewEvidence(entry model.LogData, ref model.Ref) EvidenceRef {
+	return EvidenceRef{Ref: ref, Timestamp: entry.Timestamp, Excerpt: truncateUTF8(entry.LogMessage, maxExcerptBytes)}
+}
+
+// 发现编码的说明
+type FindingSpec struct {
+	Code        string `json:"code"`
+	Severity    string `json:"severity"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// 发现编码目录，编码一经发布不再修改含义
+var findingCatalog = map[string]FindingSpec{}
+
+// 登记发现编码
+func registerFinding(spec FindingSpec) FindingSpec {
+	findingCatalog[spec.Code] = spec
+	return spec
+}
+
+// 内置分析器的发现编码，按编码排序
+func Catalog() []FindingSpec {
+	codes := make([]FindingSpec, 0, len(findingCatalog))
+	for _, spec := range findingCatalog {
+		codes = append(codes, spec)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// 逐条累积命中日志生成发现
+type findingBuilder struct {
+	spec    FindingSpec
+	finding Finding
+	seen    map[string]struct{}
+}
+
+func newFindingBuilder(spec FindingSpec) *findingBuilder {
+	return &findingBuilder{
+		spec: spec,
+		finding: Finding{
+			Code:     spec.Code,
+			Severity: spec.Severity,
+			Title:    spec.Title,
+			Entities: []Entity{},
+			Evidence: []EvidenceRef{},
+		},
+		seen: make(map[string]struct{}),
+	}
+}
+
+// 记录一条命中的日志
+func (b *findingBuilder) Add(entry model.LogData, ref model.Ref, at time.Time) {
+	f := &b.finding
+	f.Count++
+	if f.FirstSeen.IsZero() || at.Before(f.FirstSeen) {
+		f.FirstSeen = at
+	}
+	if at.After(f.LastSeen) {
+		f.LastSeen = at
+	}
+	if len(f.Evidence) < MaxEvidence {
+		f.Evidence = append(f.Evidence, NewEvidence(entry, ref))
+	}
+}
+
+// 记录受影响的对象，重复的对象只记录一次
+func (b *findingBuilder) Entity(typ, id string) {
+	if id == "" {
+		return
+	}
+	key := typ + "\x00" + id
+	if _, ok := b.seen[key]; ok {
+		return
+	}
+	b.seen[key] = struct{}{}
+	b.finding.Entities = append(b.finding.Entities, Entity{Type: typ, ID: id})
+}
+
+// 生成发现，说明以英文格式串给出，见 Localized
+func (b *findingBuilder) Build(format string, args ...any) Finding {
+	f := b.finding
+	f.text = i18n.Textf(format, args...)
+	f.Message = f.text.In(i18n.English)
+	return f
+}
+
+// 按语言翻译标题和说明，编码、严重程度和实体保持不变
+func (f Finding) Localized(lang string) Finding {
+	f.Title = i18n.Tr(lang, f.Title)
+	if !f.text.IsZero() {
+		f.Message = f.text.In(lang)
+	}
+	return f
+}
+
+// 按严重程度和数量排序
+func SortFindings(findings []Finding) {
+	rank := map[string]int{SeverityCritical: 0, SeverityError: 1, SeverityWarning: 2, SeverityInfo: 3}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if rank[findings[i].Severity] != rank[findings[j].Severity] {
+			return rank[findings[i].Severity] < rank[findings[j].Severity]
+		}
+		return findings[i].Count > findings[j].Count
+	})
+}
+
+// 截取 s 的前至多 n 个字节，不在多字节字符中间截断
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// map 的键按字典序排列，保证输出稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 追加不重复的非空值
+func appendUnique(list []string, s string) []string {
+	if s == "" {
+		return list
+	}
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
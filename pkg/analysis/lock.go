@@ -0,0 +1,261 @@
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 全局锁冲突相关的发现编码
+var findingHotLockRow = registerFinding(FindingSpec{
+	Code:        "SEATA-LOCK-001",
+	Severity:    SeverityWarning,
+	Title:       "Hot global lock row",
+	Description: "Several global transactions repeatedly contended for the global lock on the same row; consider shortening the transactions or reducing concurrent updates of the row.",
+})
+
+var (
+	// RM 端的 LockConflictException / 锁等待超时，以及 TC 端获取全局锁失败的日志
+	LockConflictPattern = regexp.MustCompile(`(?i)get global lock fail|global lock acquire fail|lock wait timeout|LockConflictException|LockWaitTimeoutException|is holding by xid|lock conflict`)
+	LockTimeoutPattern  = regexp.MustCompile(`(?i)lock wait timeout|LockWaitTimeoutException`)
+	// TC 数据库/Redis 锁存储：Global lock on [table:pk] is holding by xid ... branchId ...
+	lockOnPattern     = regexp.MustCompile(`(?i)global lock on \[([^\]]+)\]`)
+	lockHolderPattern = regexp.MustCompile(`(?i)hold(?:ing|ed)? by xid\s*[=:]?\s*\[?([\w.\-]+:\d+:\d+)\]?`)
+)
+
+// 同一行冲突达到该次数才输出发现
+const hotLockRowThreshold = 5
+
+// 每条日志最多解析的锁行数，批量更新的 lockKeys 可能很长
+const maxLockRowsPerEntry = 100
+
+// 每行最多记录的竞争 XID 数量
+const maxLockRowXIDs = 20
+
+// 表的冲突统计
+type LockTableStats struct {
+	Table     string `json:"table"`
+	Conflicts int    `json:"conflicts"`
+	Rows      int    `json:"rows"` // 发生冲突的不同行数
+}
+
+// 行的冲突统计
+type LockRowStats struct {
+	Table     string    `json:"table"`
+	Row       string    `json:"row"` // 主键，复合主键以 _ 连接
+	Conflicts int       `json:"conflicts"`
+	XIDs      []string  `json:"xids"` // 竞争该行的全局事务，包括持有者
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// 全局事务的冲突统计
+type LockXIDStats struct {
+	XID           string `json:"xid"`
+	ApplicationID string `json:"application_id"`
+	Waits         int    `json:"waits"` // 作为等待方获取锁失败的次数
+	Holds         int    `json:"holds"` // 作为持有者阻塞其他事务的次数
+}
+
+// 锁冲突汇总
+type LockConflictSummary struct {
+	Conflicts int              `json:"conflicts"`
+	Timeouts  int              `json:"timeouts"` // 其中锁等待超时的次数
+	Tables    []LockTableStats `json:"tables"`
+	Rows      []LockRowStats   `json:"rows"`
+	XIDs      []LockXIDStats   `json:"xids"`
+}
+
+// 全局锁冲突分析器：识别获取全局锁失败和锁等待的日志，按表、行和 XID 汇总
+type LockConflictAnalyzer struct {
+	conflicts int
+	timeouts  int
+	tables    map[string]*LockTableStats
+	rows      map[string]*LockRowStats
+	xids      map[string]*LockXIDStats
+	hot       map[string]*findingBuilder // 行 → 发现
+}
+
+func NewLockConflictAnalyzer() *LockConflictAnalyzer {
+	return &LockConflictAnalyzer{
+		tables: make(map[string]*LockTableStats),
+		rows:   make(map[string]*LockRowStats),
+		xids:   make(map[string]*LockXIDStats),
+		hot:    make(map[string]*findingBuilder),
+	}
+}
+
+func (a *LockConflictAnalyzer) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	msg := entry.LogMessage
+	if !LockConflictPattern.MatchString(msg) {
+		return
+	}
+	a.conflicts++
+	if LockTimeoutPattern.MatchString(msg) {
+		a.timeouts++
+	}
+
+	// 持有者的 XID 从消息中去掉后，剩下的 XID 才是等待方
+	var holder string
+	if m := lockHolderPattern.FindStringSubmatchIndex(msg); m != nil {
+		holder = msg[m[2]:m[3]]
+		msg = msg[:m[0]] + msg[m[1]:]
+	}
+	waiter := entry.XID
+	if m := parser.XIDPattern.FindStringSubmatch(msg); m != nil {
+		waiter = m[1]
+	}
+	if waiter != "" && waiter != holder {
+		a.xid(waiter, entry.ApplicationID).Waits++
+	}
+	if holder != "" {
+		a.xid(holder, entry.ApplicationID).Holds++
+	}
+
+	keys := ""
+	if m := lockOnPattern.FindStringSubmatch(msg); m != nil {
+		keys = m[1]
+	} else if m := parser.LockKeysPattern.FindStringSubmatch(msg); m != nil {
+		keys = m[1]
+	} else {
+		keys = entry.Fields["lock_keys"]
+	}
+
+	seenTables := make(map[string]bool)
+	for _, row := range ParseLockKeys(keys) {
+		key := row[0] + ":" + row[1]
+		rs, ok := a.rows[key]
+		if !ok {
+			rs = &LockRowStats{Table: row[0], Row: row[1], XIDs: []string{}, FirstSeen: at, LastSeen: at}
+			a.rows[key] = rs
+			a.table(row[0]).Rows++
+		}
+		rs.Conflicts++
+		if at.Before(rs.FirstSeen) {
+			rs.FirstSeen = at
+		}
+		if at.After(rs.LastSeen) {
+			rs.LastSeen = at
+		}
+		for _, xid := range []string{waiter, holder} {
+			if len(rs.XIDs) < maxLockRowXIDs {
+				rs.XIDs = appendUnique(rs.XIDs, xid)
+			}
+		}
+		if !seenTables[row[0]] {
+			seenTables[row[0]] = true
+			a.table(row[0]).Conflicts++
+		}
+
+		b, ok := a.hot[key]
+		if !ok {
+			b = newFindingBuilder(findingHotLockRow)
+			b.Entity("table", row[0])
+			b.Entity("row", key)
+			a.hot[key] = b
+		}
+		b.Entity("application", entry.ApplicationID)
+		b.Entity("xid", waiter)
+		b.Entity("xid", holder)
+		b.Add(entry, ref, at)
+	}
+}
+
+func (a *LockConflictAnalyzer) table(name string) *LockTableStats {
+	t, ok := a.tables[name]
+	if !ok {
+		t = &LockTableStats{Table: name}
+		a.tables[name] = t
+	}
+	return t
+}
+
+func (a *LockConflictAnalyzer) xid(xid, applicationID string) *LockXIDStats {
+	x, ok := a.xids[xid]
+	if !ok {
+		x = &LockXIDStats{XID: xid, ApplicationID: model.BareApplicationID(applicationID)}
+		a.xids[xid] = x
+	}
+	return x
+}
+
+func (a *LockConflictAnalyzer) Findings() []Finding {
+	var findings []Finding
+	for _, key := range sortedKeys(a.hot) {
+		b := a.hot[key]
+		if b.finding.Count < hotLockRowThreshold {
+			continue
+		}
+		findings = append(findings, b.Build("global lock on %s conflicted %d times between %d transactions",
+			key, b.finding.Count, len(a.rows[key].XIDs)))
+	}
+	return findings
+}
+
+// 冲突最多的表、行和 XID，每类最多 limit 个
+func (a *LockConflictAnalyzer) Summary(limit int) LockConflictSummary {
+	s := LockConflictSummary{Conflicts: a.conflicts, Timeouts: a.timeouts, Tables: []LockTableStats{}, Rows: []LockRowStats{}, XIDs: []LockXIDStats{}}
+	for _, t := range a.tables {
+		s.Tables = append(s.Tables, *t)
+	}
+	sort.Slice(s.Tables, func(i, j int) bool {
+		if s.Tables[i].Conflicts != s.Tables[j].Conflicts {
+			return s.Tables[i].Conflicts > s.Tables[j].Conflicts
+		}
+		return s.Tables[i].Table < s.Tables[j].Table
+	})
+	for _, r := range a.rows {
+		s.Rows = append(s.Rows, *r)
+	}
+	sort.Slice(s.Rows, func(i, j int) bool {
+		if s.Rows[i].Conflicts != s.Rows[j].Conflicts {
+			return s.Rows[i].Conflicts > s.Rows[j].Conflicts
+		}
+		return s.Rows[i].Table+":"+s.Rows[i].Row < s.Rows[j].Table+":"+s.Rows[j].Row
+	})
+	for _, x := range a.xids {
+		s.XIDs = append(s.XIDs, *x)
+	}
+	sort.Slice(s.XIDs, func(i, j int) bool {
+		if ci, cj := s.XIDs[i].Waits+s.XIDs[i].Holds, s.XIDs[j].Waits+s.XIDs[j].Holds; ci != cj {
+			return ci > cj
+		}
+		return s.XIDs[i].XID < s.XIDs[j].XID
+	})
+
+	if len(s.Tables) > limit {
+		s.Tables = s.Tables[:limit]
+	}
+	if len(s.Rows) > limit {
+		s.Rows = s.Rows[:limit]
+	}
+	if len(s.XIDs) > limit {
+		s.XIDs = s.XIDs[:limit]
+	}
+	return s
+}
+
+// 解析 Seata 的 lockKeys：table:pk1,pk2;table2:pk3，返回 [表, 主键] 列表
+func ParseLockKeys(keys string) [][2]string {
+	var rows [][2]string
+	for _, part := range strings.Split(keys, ";") {
+		table, pks, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || table == "" {
+			continue
+		}
+		for _, pk := range strings.Split(pks, ",") {
+			if pk = strings.TrimSpace(pk); pk == "" {
+				continue
+			}
+			if len(rows) >= maxLockRowsPerEntry {
+				return rows
+			}
+			rows = append(rows, [2]string{table, pk})
+		}
+	}
+	return rows
+}
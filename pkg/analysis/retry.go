@@ -0,0 +1,219 @@
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 重试风暴的发现编码
+var findingRetryStorm = registerFinding(FindingSpec{
+	Code:        "SEATA-RETRY-001",
+	Severity:    SeverityError,
+	Title:       "Branch phase-two retry storm",
+	Description: "The TC keeps retrying the commit or rollback of the same branch; the branch cannot finish until its resource recovers or its data is repaired, and every retry adds log volume.",
+})
+
+// 重试的二阶段动作
+const (
+	RetryCommit   = "commit"
+	RetryRollback = "rollback"
+)
+
+// TC 的分支重试日志，如 Rollback branch transaction fail and will retry, xid = ... branchId = ...，
+// 或 Committing global transaction[...] failed, caused by branch transaction[...] commit failed, will retry later
+var (
+	commitRetryPattern   = regexp.MustCompile(`(?i)commit\w*\s+branch\w*.*\b(?:will retry|retry later|retrying)\b|branch transaction\s*\[?\d+\]?\s*commit failed|PhaseTwo_?CommitFailed_?Retryable`)
+	rollbackRetryPattern = regexp.MustCompile(`(?i)roll ?back\w*\s+branch\w*.*\b(?:will retry|retry later|retrying)\b|branch transaction\s*\[?\d+\]?\s*roll ?back failed|PhaseTwo_?RollbackFailed_?Retryable`)
+	bracketBranchPattern = regexp.MustCompile(`(?i)branch transaction\s*\[(\d+)\]`)
+)
+
+// 识别分支重试日志，返回重试的动作和分支 ID，不是重试日志时 phase 为空
+func ClassifyBranchRetry(entry model.LogData) (phase, branchID string) {
+	switch {
+	case rollbackRetryPattern.MatchString(entry.LogMessage):
+		phase = RetryRollback
+	case commitRetryPattern.MatchString(entry.LogMessage):
+		phase = RetryCommit
+	default:
+		return "", ""
+	}
+	branchID = entry.BranchID
+	if branchID == "" {
+		branchID = parser.SeataFields(entry.LogMessage)["branch_id"]
+	}
+	if branchID == "" {
+		if m := bracketBranchPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+			branchID = m[1]
+		}
+	}
+	return phase, branchID
+}
+
+// 一个分支的重试情况
+type RetryStormBranch struct {
+	XID           string    `json:"xid"`
+	BranchID      string    `json:"branch_id"`
+	ResourceID    string    `json:"resource_id,omitempty"`
+	ApplicationID string    `json:"application_id"`
+	Mode          string    `json:"mode,omitempty"`
+	Phase         string    `json:"phase"` // commit 或 rollback，两者都有时为最后一次重试的动作
+	Retries       int       `json:"retries"`
+	PerMinute     float64   `json:"per_minute"` // 首次到最后一次重试之间的平均频率
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// 资源上的重试风暴
+type RetryStormResource struct {
+	ResourceID string   `json:"resource_id"`
+	Retries    int      `json:"retries"`
+	Branches   int      `json:"branches"`
+	XIDs       []string `json:"xids"`
+}
+
+// 重试风暴分析器：按分支统计重试次数，达到阈值的分支视为重试风暴
+type RetryStormAnalyzer struct {
+	Threshold int             // 同一分支的重试次数达到该值时视为重试风暴
+	Modes     map[string]bool // 只统计这些事务模式，为空时不限
+
+	branches  map[string]*RetryStormBranch // XID/分支 → 重试情况
+	resources map[string]string            // 分支 → 此前日志（如分支注册）中的资源
+	xidModes  map[string]string
+	evidence  map[string]*findingBuilder
+}
+
+func NewRetryStormAnalyzer(threshold int) *RetryStormAnalyzer {
+	return &RetryStormAnalyzer{
+		Threshold: threshold,
+		branches:  make(map[string]*RetryStormBranch),
+		resources: make(map[string]string),
+		xidModes:  make(map[string]string),
+		evidence:  make(map[string]*findingBuilder),
+	}
+}
+
+func (a *RetryStormAnalyzer) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	xid := EntryXID(entry)
+	if xid == "" {
+		return
+	}
+	if mode := parser.EntryMode(entry); mode != "" && a.xidModes[xid] == "" {
+		a.xidModes[xid] = mode
+	}
+	fields := parser.SeataFields(entry.LogMessage)
+	phase, branchID := ClassifyBranchRetry(entry)
+	if phase == "" {
+		// 重试日志往往不带资源，按分支注册等日志补全
+		if id := fields["branch_id"]; id != "" && fields["resource_id"] != "" {
+			a.resources[id] = fields["resource_id"]
+		}
+		return
+	}
+	mode := a.xidModes[xid]
+	if len(a.Modes) > 0 && !a.Modes[mode] {
+		return
+	}
+	key := xid + "\x00" + branchID
+	b, ok := a.branches[key]
+	if !ok {
+		b = &RetryStormBranch{XID: xid, BranchID: branchID, ApplicationID: model.BareApplicationID(entry.ApplicationID), FirstSeen: at, LastSeen: at}
+		a.branches[key] = b
+	}
+	b.Retries++
+	b.Phase = phase
+	if b.ResourceID == "" {
+		b.ResourceID = fields["resource_id"]
+	}
+	if at.Before(b.FirstSeen) {
+		b.FirstSeen = at
+	}
+	if !at.Before(b.LastSeen) {
+		b.LastSeen, b.Phase = at, phase
+	}
+
+	fb, ok := a.evidence[key]
+	if !ok {
+		fb = newFindingBuilder(findingRetryStorm)
+		fb.Entity("xid", xid)
+		fb.Entity("branch", branchID)
+		a.evidence[key] = fb
+	}
+	fb.Entity("application", entry.ApplicationID)
+	fb.Add(entry, ref, at)
+}
+
+// 重试日志的总条数
+func (a *RetryStormAnalyzer) Retries() int {
+	retries := 0
+	for _, b := range a.branches {
+		retries += b.Retries
+	}
+	return retries
+}
+
+// 达到阈值的分支，重试最多的在前
+func (a *RetryStormAnalyzer) Storms() []RetryStormBranch {
+	var storms []RetryStormBranch
+	for _, b := range a.branches {
+		if b.Retries < a.Threshold {
+			continue
+		}
+		s := *b
+		if s.ResourceID == "" {
+			s.ResourceID = a.resources[s.BranchID]
+		}
+		s.Mode = a.xidModes[s.XID]
+		if minutes := s.LastSeen.Sub(s.FirstSeen).Minutes(); minutes > 0 {
+			s.PerMinute = float64(s.Retries) / minutes
+		}
+		storms = append(storms, s)
+	}
+	sort.Slice(storms, func(i, j int) bool {
+		if storms[i].Retries != storms[j].Retries {
+			return storms[i].Retries > storms[j].Retries
+		}
+		return storms[i].LastSeen.After(storms[j].LastSeen)
+	})
+	return storms
+}
+
+func (a *RetryStormAnalyzer) Findings() []Finding {
+	var findings []Finding
+	for _, s := range a.Storms() {
+		fb := a.evidence[s.XID+"\x00"+s.BranchID]
+		fb.Entity("resource", s.ResourceID)
+		findings = append(findings, fb.Build("Branch %s of %s retried %s %d times", s.BranchID, s.XID, i18n.Textf(s.Phase), s.Retries))
+	}
+	return findings
+}
+
+// 按资源汇总重试风暴
+func RetryStormResources(storms []RetryStormBranch) []RetryStormResource {
+	byResource := make(map[string]*RetryStormResource)
+	for _, s := range storms {
+		r, ok := byResource[s.ResourceID]
+		if !ok {
+			r = &RetryStormResource{ResourceID: s.ResourceID, XIDs: []string{}}
+			byResource[s.ResourceID] = r
+		}
+		r.Retries += s.Retries
+		r.Branches++
+		r.XIDs = appendUnique(r.XIDs, s.XID)
+	}
+	resources := make([]RetryStormResource, 0, len(byResource))
+	for _, r := range byResource {
+		resources = append(resources, *r)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Retries != resources[j].Retries {
+			return resources[i].Retries > resources[j].Retries
+		}
+		return resources[i].ResourceID < resources[j].ResourceID
+	})
+	return resources
+}
@@ -0,0 +1,259 @@
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 回滚失败的类别
+const (
+	RollbackDirtyData      = "dirty_data"
+	RollbackUndoLogMissing = "undo_log_missing"
+	RollbackUnretryable    = "unretryable"
+	RollbackRetrying       = "retrying"
+)
+
+// 按优先级排列，一条日志只归入第一个匹配的类别
+var rollbackFailurePatterns = []struct {
+	category string
+	pattern  *regexp.Regexp
+}{
+	{RollbackDirtyData, regexp.MustCompile(`(?i)has dirty records|dirty data|SQLUndoDirtyException`)},
+	{RollbackUnretryable, regexp.MustCompile(`(?i)RollbackFailed_?Unretryable|roll ?back\w*.*fail\w* and stop retry`)},
+	{RollbackUndoLogMissing, regexp.MustCompile(`(?i)undo_?\s?log (?:not found|is not exist|doesn't exist)|no undo_?\s?log|undo_?\s?log added with GlobalFinished`)},
+	{RollbackRetrying, regexp.MustCompile(`(?i)RollbackFailed_?Retryable|branch ?rollback failed|roll ?back branch\w* (?:transaction )?fail|failed to roll ?back branch`)},
+}
+
+// 分类回滚失败日志，不是回滚失败时返回空串
+func ClassifyRollbackFailure(message string) string {
+	for _, p := range rollbackFailurePatterns {
+		if p.pattern.MatchString(message) {
+			return p.category
+		}
+	}
+	return ""
+}
+
+// 需要人工修复数据的类别
+func RollbackNeedsRepair(category string) bool {
+	return category == RollbackDirtyData || category == RollbackUnretryable
+}
+
+// 分支回滚失败相关的发现编码
+var (
+	findingDirtyUndo = registerFinding(FindingSpec{
+		Code:        "SEATA-ROLLBACK-001",
+		Severity:    SeverityCritical,
+		Title:       "Dirty data blocks branch rollback",
+		Description: "The undo log no longer matches the current row image, so Seata refuses to roll the branch back; the affected rows must be repaired manually before the branch can be rolled back.",
+	})
+	findingUndoLogMissing = registerFinding(FindingSpec{
+		Code:        "SEATA-ROLLBACK-002",
+		Severity:    SeverityWarning,
+		Title:       "Undo log not found during rollback",
+		Description: "A branch was rolled back without an undo log, either because the local transaction never committed or because the undo log was removed; verify the data of the branch.",
+	})
+	findingRollbackFailed = registerFinding(FindingSpec{
+		Code:        "SEATA-ROLLBACK-003",
+		Severity:    SeverityError,
+		Title:       "Branch rollback failed",
+		Description: "The TC could not roll a branch back; retryable failures keep the global transaction in rollback retrying, unretryable ones need manual intervention.",
+	})
+)
+
+// 资源（数据源）上的回滚失败
+type RollbackResourceStats struct {
+	ResourceID string         `json:"resource_id"`
+	Failures   int            `json:"failures"`
+	Categories map[string]int `json:"categories"`
+	XIDs       []string       `json:"xids"`
+}
+
+// 全局事务的回滚失败
+type RollbackXIDStats struct {
+	XID           string    `json:"xid"`
+	ApplicationID string    `json:"application_id"`
+	ResourceIDs   []string  `json:"resource_ids"`
+	BranchIDs     []string  `json:"branch_ids"`
+	Categories    []string  `json:"categories"`
+	Mode          string    `json:"mode,omitempty"` // Seata 事务模式
+	NeedsRepair   bool      `json:"needs_repair"`   // 存在脏数据或不可重试的失败
+	Failures      int       `json:"failures"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// 每个资源最多记录的 XID 数量
+const maxRollbackResourceXIDs = 50
+
+// 分支回滚失败分析器：按资源和 XID 汇总脏数据、缺失 undo log 和回滚失败
+type RollbackFailureAnalyzer struct {
+	resources map[string]*RollbackResourceStats
+	xids      map[string]*RollbackXIDStats
+	builders  map[string]*findingBuilder // 类别/资源 → 发现
+	modes     map[string]int             // 事务模式 → 失败次数
+	xidModes  map[string]string          // 从此前的日志中识别出的 XID 事务模式
+
+	Modes map[string]bool // 只统计这些事务模式，为空时不限
+}
+
+func NewRollbackFailureAnalyzer() *RollbackFailureAnalyzer {
+	return &RollbackFailureAnalyzer{
+		resources: make(map[string]*RollbackResourceStats),
+		xids:      make(map[string]*RollbackXIDStats),
+		builders:  make(map[string]*findingBuilder),
+		modes:     make(map[string]int),
+		xidModes:  make(map[string]string),
+	}
+}
+
+func (a *RollbackFailureAnalyzer) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	// 回滚失败日志本身往往不带模式特征，按同一 XID 此前的日志（如分支注册）推断
+	xid := EntryXID(entry)
+	mode := parser.EntryMode(entry)
+	if xid != "" {
+		if mode == "" {
+			mode = a.xidModes[xid]
+		} else if _, ok := a.xidModes[xid]; !ok {
+			a.xidModes[xid] = mode
+		}
+	}
+
+	category := ClassifyRollbackFailure(entry.LogMessage)
+	if category == "" || (len(a.Modes) > 0 && !a.Modes[mode]) {
+		return
+	}
+	a.modes[parser.ModeKey(mode)]++
+	fields := parser.SeataFields(entry.LogMessage)
+	branchID := entry.BranchID
+	if branchID == "" {
+		branchID = fields["branch_id"]
+	}
+	resourceID := fields["resource_id"]
+	if resourceID == "" {
+		resourceID = entry.Fields["resource_id"]
+	}
+
+	rs, ok := a.resources[resourceID]
+	if !ok {
+		rs = &RollbackResourceStats{ResourceID: resourceID, Categories: make(map[string]int), XIDs: []string{}}
+		a.resources[resourceID] = rs
+	}
+	rs.Failures++
+	rs.Categories[category]++
+	if len(rs.XIDs) < maxRollbackResourceXIDs {
+		rs.XIDs = appendUnique(rs.XIDs, xid)
+	}
+
+	if xid != "" {
+		xs, ok := a.xids[xid]
+		if !ok {
+			xs = &RollbackXIDStats{XID: xid, ApplicationID: model.BareApplicationID(entry.ApplicationID),
+				ResourceIDs: []string{}, BranchIDs: []string{}, Categories: []string{}, FirstSeen: at, LastSeen: at}
+			a.xids[xid] = xs
+		}
+		xs.Failures++
+		xs.ResourceIDs = appendUnique(xs.ResourceIDs, resourceID)
+		xs.BranchIDs = appendUnique(xs.BranchIDs, branchID)
+		xs.Categories = appendUnique(xs.Categories, category)
+		if xs.Mode == "" {
+			xs.Mode = mode
+		}
+		xs.NeedsRepair = xs.NeedsRepair || RollbackNeedsRepair(category)
+		if at.Before(xs.FirstSeen) {
+			xs.FirstSeen = at
+		}
+		if at.After(xs.LastSeen) {
+			xs.LastSeen = at
+		}
+	}
+
+	spec := findingRollbackFailed
+	switch category {
+	case RollbackDirtyData:
+		spec = findingDirtyUndo
+	case RollbackUndoLogMissing:
+		spec = findingUndoLogMissing
+	}
+	key := spec.Code + "\x00" + resourceID
+	b, ok := a.builders[key]
+	if !ok {
+		b = newFindingBuilder(spec)
+		b.Entity("resource", resourceID)
+		a.builders[key] = b
+	}
+	b.Entity("application", entry.ApplicationID)
+	b.Entity("xid", xid)
+	b.Entity("branch", branchID)
+	b.Add(entry, ref, at)
+}
+
+func (a *RollbackFailureAnalyzer) Findings() []Finding {
+	var findings []Finding
+	for _, key := range sortedKeys(a.builders) {
+		b := a.builders[key]
+		_, id, _ := strings.Cut(key, "\x00")
+		var resource any = id
+		if id == "" {
+			resource = i18n.Textf("an unknown resource")
+		}
+		findings = append(findings, b.Build("%d rollback failures on %s", b.finding.Count, resource))
+	}
+	return findings
+}
+
+// 回滚失败的总次数
+func (a *RollbackFailureAnalyzer) Failures() int {
+	total := 0
+	for _, r := range a.resources {
+		total += r.Failures
+	}
+	return total
+}
+
+// 按事务模式统计的失败次数，未识别的模式记为 unknown
+func (a *RollbackFailureAnalyzer) ModeCounts() map[string]int {
+	return a.modes
+}
+
+// 回滚失败汇总，XID 中需要修复的排在前面
+func (a *RollbackFailureAnalyzer) Summary(limit int) ([]RollbackResourceStats, []RollbackXIDStats) {
+	resources := make([]RollbackResourceStats, 0, len(a.resources))
+	for _, r := range a.resources {
+		resources = append(resources, *r)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Failures != resources[j].Failures {
+			return resources[i].Failures > resources[j].Failures
+		}
+		return resources[i].ResourceID < resources[j].ResourceID
+	})
+
+	xids := make([]RollbackXIDStats, 0, len(a.xids))
+	for _, x := range a.xids {
+		xids = append(xids, *x)
+	}
+	sort.Slice(xids, func(i, j int) bool {
+		if xids[i].NeedsRepair != xids[j].NeedsRepair {
+			return xids[i].NeedsRepair
+		}
+		if !xids[i].LastSeen.Equal(xids[j].LastSeen) {
+			return xids[i].LastSeen.After(xids[j].LastSeen)
+		}
+		return xids[i].XID < xids[j].XID
+	})
+
+	if len(resources) > limit {
+		resources = resources[:limit]
+	}
+	if len(xids) > limit {
+		xids = xids[:limit]
+	}
+	return resources, xids
+}
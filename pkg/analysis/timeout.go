@@ -0,0 +1,203 @@
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 开始日志中的事务超时配置，如 timeout:60000
+var txTimeoutPattern = regexp.MustCompile(`(?i)\btimeout\s*[=:]\s*(\d+)`)
+
+// 超时前的一次活动
+type TimeoutActivity struct {
+	At            time.Time `json:"at"`
+	ApplicationID string    `json:"application_id"`
+	Service       string    `json:"service"`
+	BranchID      string    `json:"branch_id,omitempty"`
+	ResourceID    string    `json:"resource_id,omitempty"`
+	Message       string    `json:"message"`
+	Ref           model.Ref `json:"ref"`
+
+	event string
+}
+
+// 超时事务中的一个分支，耗时为超时前该分支第一条到最后一条日志的间隔
+type TimeoutBranch struct {
+	BranchID   string    `json:"branch_id"`
+	Service    string    `json:"service"`
+	ResourceID string    `json:"resource_id,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	DurationMs int64     `json:"duration_ms"`
+	Events     int       `json:"events"`
+}
+
+// 一个超时的全局事务及其根因线索
+type TransactionTimeout struct {
+	XID            string     `json:"xid"`
+	ApplicationIDs []string   `json:"application_ids"`
+	Mode           string     `json:"mode,omitempty"`
+	Begin          *time.Time `json:"begin,omitempty"`
+	TimeoutAt      time.Time  `json:"timeout_at"`
+	TimeoutMs      *int64     `json:"timeout_ms,omitempty"` // 开始日志中的超时配置
+	ElapsedMs      *int64     `json:"elapsed_ms,omitempty"` // 开始到超时的耗时
+	Branches       int        `json:"branches"`
+	// 超时前最后一次分支活动，没有分支日志时为最后一条相关日志；silence_ms 为其后到超时的间隔
+	LastActivity  *TimeoutActivity `json:"last_activity,omitempty"`
+	SilenceMs     int64            `json:"silence_ms"`
+	SlowestBranch *TimeoutBranch   `json:"slowest_branch,omitempty"`
+	// 疑似拖住事务的服务：最后活动的分支所属的服务，其次为最慢分支的服务
+	SuspectService string `json:"suspect_service,omitempty"`
+	Summary        string `json:"summary"` // 以上线索的一段文字说明，按 Accept-Language 选择语言
+}
+
+// 收集超时事务的相关日志，超时时间在全部日志读取完后才能确定
+type TimeoutAnalyzer struct {
+	txs        map[string]TransactionSummary // 第一遍识别出的超时事务
+	activities map[string][]TimeoutActivity
+	timeouts   map[string]int64     // XID → 开始日志中的超时配置
+	mask       func(*model.LogData) // 收集日志消息前的脱敏，为 nil 时不脱敏
+}
+
+func NewTimeoutAnalyzer(txs map[string]TransactionSummary, mask func(*model.LogData)) *TimeoutAnalyzer {
+	return &TimeoutAnalyzer{txs: txs, activities: make(map[string][]TimeoutActivity), timeouts: make(map[string]int64), mask: mask}
+}
+
+func (a *TimeoutAnalyzer) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	xid := EntryXID(entry)
+	if _, ok := a.txs[xid]; !ok {
+		return
+	}
+	event := ClassifyEvent(entry.LogMessage)
+	if event == EventBegin {
+		if m := txTimeoutPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+			if ms, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+				a.timeouts[xid] = ms
+			}
+		}
+	}
+	fields := parser.SeataFields(entry.LogMessage)
+	branchID := entry.BranchID
+	if branchID == "" {
+		branchID = fields["branch_id"]
+	}
+	resourceID := fields["resource_id"]
+	if resourceID == "" {
+		resourceID = entry.Fields["resource_id"]
+	}
+	if a.mask != nil {
+		a.mask(&entry)
+	}
+	a.activities[xid] = append(a.activities[xid], TimeoutActivity{
+		At: at, ApplicationID: model.BareApplicationID(entry.ApplicationID), Service: EntryService(entry),
+		BranchID: branchID, ResourceID: resourceID, Message: entry.LogMessage, Ref: ref, event: event,
+	})
+}
+
+func (a *TimeoutAnalyzer) Findings() []Finding { return nil }
+
+// 按超时时间划分相关日志，找出超时前最后的分支活动和最慢的分支
+func (a *TimeoutAnalyzer) Report(tx TransactionSummary) TransactionTimeout {
+	r := TransactionTimeout{XID: tx.XID, ApplicationIDs: tx.ApplicationIDs, Mode: tx.Mode, Begin: tx.Begin}
+	activities := a.activities[tx.XID]
+	sort.SliceStable(activities, func(i, j int) bool { return activities[i].At.Before(activities[j].At) })
+	for _, act := range activities {
+		if act.event == EventTimeout {
+			r.TimeoutAt = act.At
+			break
+		}
+	}
+	if ms, ok := a.timeouts[tx.XID]; ok {
+		r.TimeoutMs = &ms
+	}
+	if r.Begin != nil {
+		elapsed := r.TimeoutAt.Sub(*r.Begin).Milliseconds()
+		r.ElapsedMs = &elapsed
+	}
+
+	branches := make(map[string]*TimeoutBranch)
+	var last, lastBranch *TimeoutActivity
+	for i := range activities {
+		act := &activities[i]
+		if act.At.After(r.TimeoutAt) || act.event == EventTimeout {
+			continue
+		}
+		last = act
+		if act.BranchID == "" {
+			continue
+		}
+		lastBranch = act
+		b, ok := branches[act.BranchID]
+		if !ok {
+			b = &TimeoutBranch{BranchID: act.BranchID, Service: act.Service, FirstSeen: act.At}
+			branches[act.BranchID] = b
+		}
+		b.Events++
+		b.LastSeen = act.At
+		b.DurationMs = b.LastSeen.Sub(b.FirstSeen).Milliseconds()
+		if b.ResourceID == "" {
+			b.ResourceID = act.ResourceID
+		}
+		if parser.BranchRegisterPattern.MatchString(act.Message) {
+			b.Service = act.Service
+		}
+	}
+	r.Branches = len(branches)
+
+	if lastBranch != nil {
+		// 分支日志可能由不带 applicationId 的 RM 写入，服务以分支注册时的为准
+		act := *lastBranch
+		act.Service = branches[act.BranchID].Service
+		last = &act
+	}
+	if last != nil {
+		r.LastActivity = last
+		r.SilenceMs = r.TimeoutAt.Sub(last.At).Milliseconds()
+	}
+	for _, id := range sortedKeys(branches) {
+		b := branches[id]
+		if r.SlowestBranch == nil || b.DurationMs > r.SlowestBranch.DurationMs {
+			r.SlowestBranch = b
+		}
+	}
+	switch {
+	case lastBranch != nil:
+		r.SuspectService = last.Service
+	case r.SlowestBranch != nil:
+		r.SuspectService = r.SlowestBranch.Service
+	}
+	return r
+}
+
+// 超时报告的文字说明：耗时、超时前最后的活动及其后的静默、最慢的分支
+func TimeoutSummary(r TransactionTimeout, lang string) string {
+	var parts []i18n.Text
+	if r.ElapsedMs != nil {
+		parts = append(parts, i18n.Textf("Timed out after %s. ", time.Duration(*r.ElapsedMs)*time.Millisecond))
+	} else {
+		parts = append(parts, i18n.Textf("Timed out. "))
+	}
+	if act := r.LastActivity; act != nil {
+		silence := time.Duration(r.SilenceMs) * time.Millisecond
+		if act.BranchID != "" {
+			parts = append(parts, i18n.Textf("The last branch activity was in %s, %s before the timeout. ", act.Service, silence))
+		} else {
+			parts = append(parts, i18n.Textf("The last activity was in %s, %s before the timeout. ", act.Service, silence))
+		}
+	}
+	if b := r.SlowestBranch; b != nil {
+		parts = append(parts, i18n.Textf("The slowest branch %s in %s took %s. ", b.BranchID, b.Service, time.Duration(b.DurationMs)*time.Millisecond))
+	}
+	var sb strings.Builder
+	for _, p := range parts {
+		sb.WriteString(p.In(lang))
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,240 @@
+// Package analysis 按 Seata TC 和 RM 的日志推断全局事务的状态，并提供内置的分析器（回滚失败、重试风暴、
+// 锁冲突、超时根因、一致性、TC 集群等）及其输出的发现。本包只依赖日志内容，不读取存储，
+// 调用方按时间顺序或任意顺序逐条传入日志即可
+package analysis
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"time"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 推断出的全局事务状态
+const (
+	StatusCommitted  = "committed"
+	StatusRolledBack = "rolled_back"
+	StatusTimedOut   = "timed_out"
+	StatusFailed     = "failed"      // 二阶段提交或回滚失败
+	StatusHanging    = "hanging"     // 已开始，超过观察窗口仍没有终态日志
+	StatusInProgress = "in_progress" // 已开始，仍在观察窗口内
+	StatusUnknown    = "unknown"     // 只看到中间过程，没有开始和终态日志
+)
+
+// 全部事务状态
+var Statuses = []string{StatusCommitted, StatusRolledBack, StatusTimedOut, StatusFailed, StatusHanging, StatusInProgress, StatusUnknown}
+
+// TC 日志中的事务事件
+const (
+	EventBegin          = "begin"
+	EventCommitted      = "committed"
+	EventRolledBack     = "rolled_back"
+	EventTimeout        = "timeout"
+	EventCommitFailed   = "commit_failed"
+	EventRollbackFailed = "rollback_failed"
+)
+
+// 识别事务事件的消息模式，按顺序匹配，失败和超时优先于一般的提交、回滚
+var eventPatterns = []struct {
+	event   string
+	pattern *regexp.Regexp
+}{
+	{EventBegin, regexp.MustCompile(`(?i)begin new global transaction`)},
+	{EventTimeout, regexp.MustCompile(`(?i)is timeout and will be roll ?back|TimeoutRollback`)},
+	{EventCommitFailed, regexp.MustCompile(`(?i)commit(?:ting)? (?:global )?(?:transaction )?(?:\S+ )?failed|CommitFailed|failed to commit`)},
+	{EventRollbackFailed, regexp.MustCompile(`(?i)roll ?back(?:ing)? (?:global )?(?:transaction )?(?:\S+ )?failed|RollbackFailed|failed to roll ?back`)},
+	{EventCommitted, regexp.MustCompile(`(?i)committing global transaction is successfully done|commit global transaction successfully|committing is successfully done|status:\s*Committed\b|\bCommitted\b`)},
+	{EventRolledBack, regexp.MustCompile(`(?i)roll ?back global transaction successfully|successfully roll ?back|roll ?backing is successfully done|status:\s*Rollbacked\b|\bRollbacked\b`)},
+}
+
+// 终态事件的优先级：超时之后的回滚日志不改变超时状态，失败后重试成功则以成功为准
+var eventPriority = map[string]int{
+	EventCommitFailed:   1,
+	EventRollbackFailed: 1,
+	EventCommitted:      2,
+	EventRolledBack:     2,
+	EventTimeout:        3,
+}
+
+// 识别消息中的事务事件，无法识别时返回空串
+func ClassifyEvent(message string) string {
+	for _, p := range eventPatterns {
+		if p.pattern.MatchString(message) {
+			return p.event
+		}
+	}
+	return ""
+}
+
+// 一个全局事务的推断结果
+type TransactionSummary struct {
+	XID            string     `json:"xid"`
+	Status         string     `json:"status"`
+	ApplicationIDs []string   `json:"application_ids"`
+	Begin          *time.Time `json:"begin,omitempty"`
+	End            *time.Time `json:"end,omitempty"` // 终态日志的时间
+	FirstSeen      time.Time  `json:"first_seen"`
+	LastSeen       time.Time  `json:"last_seen"`
+	DurationMs     *int64     `json:"duration_ms,omitempty"` // 开始到终态的耗时
+	Events         int        `json:"events"`                // 相关日志条数
+	TerminalEvent  string     `json:"terminal_event,omitempty"`
+	Mode           string     `json:"mode,omitempty"` // 相关日志中最先识别出的 Seata 事务模式
+
+	apps map[string]bool
+}
+
+// 逐条观察日志，按 XID 汇总事务事件
+type TransactionTracker struct {
+	txs map[string]*TransactionSummary
+}
+
+func NewTransactionTracker() *TransactionTracker {
+	return &TransactionTracker{txs: make(map[string]*TransactionSummary)}
+}
+
+// 日志的 XID：优先使用结构化字段，否则从消息中提取
+func EntryXID(entry model.LogData) string {
+	if entry.XID != "" {
+		return entry.XID
+	}
+	return parser.SeataFields(entry.LogMessage)["xid"]
+}
+
+// 观察一条日志，at 为日志的时间；ref 不参与推断，使追踪器可以直接用作按存储位置遍历的回调
+func (t *TransactionTracker) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	xid := EntryXID(entry)
+	if xid == "" {
+		return
+	}
+	tx, ok := t.txs[xid]
+	if !ok {
+		tx = &TransactionSummary{XID: xid, FirstSeen: at, LastSeen: at, apps: make(map[string]bool)}
+		t.txs[xid] = tx
+	}
+	tx.Events++
+	tx.apps[entry.ApplicationID] = true
+	if at.Before(tx.FirstSeen) {
+		tx.FirstSeen = at
+	}
+	if at.After(tx.LastSeen) {
+		tx.LastSeen = at
+	}
+	if tx.Mode == "" {
+		tx.Mode = parser.EntryMode(entry)
+	}
+
+	event := ClassifyEvent(entry.LogMessage)
+	switch event {
+	case "":
+		return
+	case EventBegin:
+		if tx.Begin == nil || at.Before(*tx.Begin) {
+			tx.Begin = &at
+		}
+		return
+	}
+	if eventPriority[event] >= eventPriority[tx.TerminalEvent] {
+		tx.TerminalEvent = event
+	}
+	if tx.End == nil || at.After(*tx.End) {
+		tx.End = &at
+	}
+}
+
+// 事务追踪器只推断状态，不输出发现
+func (t *TransactionTracker) Findings() []Finding { return nil }
+
+// 计算全部事务的状态，按 XID 排序；reference 之前超过 hangAfter 仍无终态的视为挂起
+func (t *TransactionTracker) Summaries(reference time.Time, hangAfter time.Duration) []TransactionSummary {
+	result := make([]TransactionSummary, 0, len(t.txs))
+	for _, xid := range slices.Sorted(maps.Keys(t.txs)) {
+		tx := *t.txs[xid]
+		tx.ApplicationIDs = slices.Sorted(maps.Keys(tx.apps))
+		switch tx.TerminalEvent {
+		case EventCommitted:
+			tx.Status = StatusCommitted
+		case EventRolledBack:
+			tx.Status = StatusRolledBack
+		case EventTimeout:
+			tx.Status = StatusTimedOut
+		case EventCommitFailed, EventRollbackFailed:
+			tx.Status = StatusFailed
+		default:
+			switch {
+			case tx.Begin == nil:
+				tx.Status = StatusUnknown
+			case reference.Sub(*tx.Begin) > hangAfter:
+				tx.Status = StatusHanging
+			default:
+				tx.Status = StatusInProgress
+			}
+		}
+		if tx.Begin != nil && tx.End != nil {
+			d := tx.End.Sub(*tx.Begin).Milliseconds()
+			tx.DurationMs = &d
+		}
+		result = append(result, tx)
+	}
+	return result
+}
+
+// 事务状态发现：超过观察窗口仍未结束的事务
+var findingHangingTransaction = registerFinding(FindingSpec{
+	Code:        "SEATA-TX-001",
+	Severity:    SeverityWarning,
+	Title:       "Global transaction without terminal event",
+	Description: "A global transaction began but no commit, rollback or timeout was logged within the hang window; it may be stuck on the TC.",
+})
+
+// 一条命中的日志
+type observedEntry struct {
+	entry model.LogData
+	ref   model.Ref
+	at    time.Time
+}
+
+// 挂起事务分析器，复用事务状态推断
+type HangingTransactionAnalyzer struct {
+	*TransactionTracker
+	entries    map[string][]observedEntry // XID → 开始日志，用作证据
+	hangWindow time.Duration
+}
+
+func NewHangingTransactionAnalyzer(hangWindow time.Duration) *HangingTransactionAnalyzer {
+	return &HangingTransactionAnalyzer{
+		TransactionTracker: NewTransactionTracker(),
+		entries:            make(map[string][]observedEntry),
+		hangWindow:         hangWindow,
+	}
+}
+
+func (a *HangingTransactionAnalyzer) Observe(entry model.LogData, ref model.Ref, at time.Time) {
+	a.TransactionTracker.Observe(entry, ref, at)
+	if ClassifyEvent(entry.LogMessage) == EventBegin {
+		xid := EntryXID(entry)
+		a.entries[xid] = append(a.entries[xid], observedEntry{entry: entry, ref: ref, at: at})
+	}
+}
+
+func (a *HangingTransactionAnalyzer) Findings() []Finding {
+	var findings []Finding
+	for _, tx := range a.Summaries(time.Now(), a.hangWindow) {
+		if tx.Status != StatusHanging {
+			continue
+		}
+		b := newFindingBuilder(findingHangingTransaction)
+		b.Entity("xid", tx.XID)
+		for _, app := range tx.ApplicationIDs {
+			b.Entity("application", app)
+		}
+		for _, hit := range a.entries[tx.XID] {
+			b.Add(hit.entry, hit.ref, hit.at)
+		}
+		findings = append(findings, b.Build("Transaction %s began at %s and has no terminal event after %d log lines",
+			tx.XID, tx.Begin.Format(time.RFC3339), tx.Events))
+	}
+	return findings
+}
@@ -0,0 +1,698 @@
+// Package client 是日志分析服务的 Go 客户端，封装上传、查询和实时订阅接口，
+// 并对网络错误、5xx 和 429 响应自动退避重试。
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日志条目，与服务端的 JSON 结构一致
+type LogEntry struct {
+	ApplicationID string `json:"application_id"`
+	LogLevel      string `json:"log_level"`
+	Timestamp     string `json:"timestamp"`
+	LogMessage    string `json:"log_message"`
+
+	Logger   string            `json:"logger,omitempty"`
+	Thread   string            `json:"thread,omitempty"`
+	XID      string            `json:"xid,omitempty"`
+	BranchID string            `json:"branch_id,omitempty"`
+	TraceID  string            `json:"trace_id,omitempty"`
+	SpanID   string            `json:"span_id,omitempty"`
+	ID       int64             `json:"id,omitempty"`     // 服务端分配的日志 ID，上传时忽略
+	Seq      int64             `json:"seq,omitempty"`    // 服务端分配的写入序号，时间戳相同的日志按它排序
+	Fields   map[string]string `json:"fields,omitempty"` // 自定义结构化字段
+
+	// 采样写入时的保留比例，未采样时为 0；客户端自行采样时可以在上传时填写
+	SampleRate float64 `json:"sample_rate,omitempty"`
+
+	// 查询结果中过长的消息被截断时为 true，MessageBytes 为原始长度，全文通过 GetLog 获取
+	MessageTruncated bool `json:"message_truncated,omitempty"`
+	MessageBytes     int  `json:"message_bytes,omitempty"`
+}
+
+// 查询条件
+type QueryOptions struct {
+	ApplicationID  string
+	LogLevel       string
+	View           string
+	Sort           string // asc 或 desc，默认 desc
+	Limit          int
+	Fields         map[string]string // 按结构化字段过滤
+	SinceID        int64             // 只返回 ID 大于该值的日志，指定 SinceID 或 MaxID 时按 ID 排序
+	MaxID          int64
+	Select         []string // 只返回这些字段，如 timestamp、log_message，其余字段为零值
+	From           string   // 时间范围，RFC3339 或 2006-01-02 15:04:05
+	To             string
+	Keyword        string // log_message 须包含的关键字，不区分大小写
+	Regex          string // log_message 须匹配的正则，不能与 Keyword 同时使用
+	Since          string // 增量查询的游标：日志 ID（单个应用）或 时间戳[,写入序号]，通常取上一页的 NextSince
+	FullMessage    bool   // 不截断过长的消息
+	IncludeArchive bool   // 同时读取已归档到对象存储的旧分段
+}
+
+// 实时订阅条件
+type TailOptions struct {
+	ApplicationID string
+	LogLevel      string
+}
+
+// 服务端返回的错误
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("log service returned %d: %s", e.StatusCode, e.Message)
+}
+
+// 客户端
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	headers    http.Header
+	secret     []byte
+	prefix     string // 租户接口的路径前缀，见 WithTenant
+}
+
+// 客户端选项
+type Option func(*Client)
+
+// 使用自定义的 http.Client
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// 设置最大重试次数（不含首次请求）
+func WithRetries(n int) Option {
+	return func(c *Client) { c.maxRetries = n }
+}
+
+// 设置退避区间
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) { c.minBackoff, c.maxBackoff = min, max }
+}
+
+// 为每个请求附加请求头，如 X-Request-ID
+func WithHeader(key, value string) Option {
+	return func(c *Client) { c.headers.Set(key, value) }
+}
+
+// 访问租户的数据：请求发往 /tenants/{tenant}/ 下的租户接口，API Key 使用租户的 Key。
+// 租户接口只提供上传、查询、实时日志等，统计和全局事务等接口返回 404
+func WithTenant(tenant string) Option {
+	return func(c *Client) { c.prefix = "/tenants/" + url.PathEscape(tenant) }
+}
+
+// 用与服务端 upload_signing 中相同的共享密钥对上传请求签名
+func WithUploadSecret(secret string) Option {
+	return func(c *Client) { c.secret = []byte(secret) }
+}
+
+// 创建客户端，baseURL 形如 http://log-service:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+		headers:    make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// 上传单条日志，返回服务端分配的 ID，重复或被丢弃时为 0
+func (c *Client) UploadLog(ctx context.Context, entry LogEntry) (int64, error) {
+	var result struct {
+		ID int64 `json:"id"`
+	}
+	err := c.postUpload(ctx, "/upload", "", entry, &result)
+	return result.ID, err
+}
+
+// 上传一行未解析的原始日志，由服务端按应用登记的解析规则推断级别、时间戳和消息，返回分配的 ID
+func (c *Client) UploadRawLine(ctx context.Context, applicationID, line string) (int64, error) {
+	var result struct {
+		ID int64 `json:"id"`
+	}
+	err := c.postUpload(ctx, "/upload", "", map[string]string{"application_id": applicationID, "raw_line": line}, &result)
+	return result.ID, err
+}
+
+// 批量上传日志，按顺序返回分配的 ID，重复或被丢弃的为 0
+func (c *Client) UploadBatch(ctx context.Context, entries []LogEntry) ([]int64, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return c.UploadBatchWithKey(ctx, "", entries)
+}
+
+// 以指定的 Idempotency-Key 批量上传，同一批日志重新上传时沿用原来的键，服务端启用 dedup 时在去重窗口内不会重复写入；
+// key 为空时使用随机的键
+func (c *Client) UploadBatchWithKey(ctx context.Context, key string, entries []LogEntry) ([]int64, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	var result struct {
+		IDs []int64 `json:"ids"`
+	}
+	err := c.postUpload(ctx, "/upload/batch", key, entries, &result)
+	return result.IDs, err
+}
+
+// 批量上传中一条日志的结果
+const (
+	EntryAccepted  = "accepted"
+	EntryDuplicate = "duplicate"
+	EntryDropped   = "dropped"
+	EntryRejected  = "rejected"
+)
+
+// 一条日志的结果，Index 为日志在上传的一批中的位置
+type EntryResult struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"`
+	ID        int64  `json:"id,omitempty"`
+	Reason    string `json:"reason,omitempty"` // 被拒绝的原因，如 invalid_timestamp、tenant_quota_exceeded
+	Error     string `json:"error,omitempty"`
+	Field     string `json:"field,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"` // 原样重试可能成功，否则须修改日志后再上传
+}
+
+// 部分成功的批量上传的结果
+type BatchResult struct {
+	Accepted   int           `json:"accepted"` // 未被拒绝的条数，包括重复和被丢弃的日志
+	Duplicates int           `json:"duplicates"`
+	Dropped    int           `json:"dropped"`
+	Rejected   int           `json:"rejected"`
+	IDs        []int64       `json:"ids"` // 按上传的顺序，未写入的为 0
+	Results    []EntryResult `json:"results"`
+}
+
+// 被拒绝但可以原样重试的日志，按上传的顺序
+func (r *BatchResult) Retryable(entries []LogEntry) []LogEntry {
+	var retry []LogEntry
+	for _, res := range r.Results {
+		if res.Status == EntryRejected && res.Retryable && res.Index < len(entries) {
+			retry = append(retry, entries[res.Index])
+		}
+	}
+	return retry
+}
+
+// 部分成功的批量上传：服务端逐条校验和写入，一条日志被拒绝不影响其他日志，结果中给出每条日志的状态。
+// 有日志被拒绝时不返回错误，由调用方检查 Rejected 并重试 Retryable 的日志；整批失败（如写入队列已满）时返回错误。
+// key 与 UploadBatchWithKey 相同，重试被拒绝的日志时应使用新的键
+func (c *Client) UploadBatchPartial(ctx context.Context, key string, entries []LogEntry) (*BatchResult, error) {
+	result := &BatchResult{}
+	if len(entries) == 0 {
+		return result, nil
+	}
+	if err := c.postUpload(ctx, "/upload/batch?partial=true", key, entries, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 分片上传默认的分片大小
+const defaultChunkSize = 4 << 20
+
+// 分片上传一大批日志：编码为 NDJSON 后按 chunkSize 字节切分，各分片单独上传，
+// 网络出错时只重试失败的分片。chunkSize 不大于 0 时为 4 MiB，不能超过服务端的 8 MiB 上限
+func (c *Client) UploadChunked(ctx context.Context, entries []LogEntry, chunkSize int) ([]int64, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	var body []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		body = append(append(body, line...), '\n')
+	}
+	chunks := (len(body) + chunkSize - 1) / chunkSize
+
+	var session struct {
+		ID string `json:"session_id"`
+	}
+	if err := c.postJSON(ctx, "/upload/sessions", map[string]int{"chunks": chunks}, &session); err != nil {
+		return nil, err
+	}
+	path := "/upload/sessions/" + url.PathEscape(session.ID)
+	for i := 0; i < chunks; i++ {
+		part := body[i*chunkSize : min((i+1)*chunkSize, len(body))]
+		sum := sha256.Sum256(part)
+		header := http.Header{"X-Chunk-SHA256": {hex.EncodeToString(sum[:])}}
+		if err := c.do(ctx, http.MethodPut, path+"/chunks/"+strconv.Itoa(i), part, header, nil); err != nil {
+			return nil, err
+		}
+	}
+	var result struct {
+		IDs []int64 `json:"ids"`
+	}
+	err := c.do(ctx, http.MethodPost, path+"/complete", nil, nil, &result)
+	return result.IDs, err
+}
+
+// 上传请求带上 Idempotency-Key（为空时随机生成），重试时服务端不会重复写入
+func (c *Client) postUpload(ctx context.Context, path, key string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		if key, err = NewIdempotencyKey(); err != nil {
+			return err
+		}
+	}
+	header := http.Header{"Idempotency-Key": {key}}
+	if c.secret != nil {
+		// 签名为 hex(HMAC-SHA256(密钥, 时间戳 + "." + 请求体))，重试时沿用，服务端允许几分钟的偏差
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, c.secret)
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		header.Set("X-Signature-Timestamp", timestamp)
+		header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return c.do(ctx, http.MethodPost, path, body, header, out)
+}
+
+// 生成随机的 Idempotency-Key
+func NewIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := crand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// 一页查询结果
+type QueryResult struct {
+	Logs      []LogEntry   `json:"logs"`
+	NextSince string       `json:"next_since"` // 增量查询时下一页的游标
+	Archive   *ArchiveScan `json:"archive,omitempty"`
+}
+
+// 查询中归档分段的处理情况
+type ArchiveScan struct {
+	Include    bool  `json:"include"`
+	Skipped    int   `json:"skipped"` // 未指定 IncludeArchive 而跳过的分段，不为 0 时结果可能不完整
+	Pruned     int   `json:"pruned"`
+	Ranged     int   `json:"ranged"`
+	Fetched    int   `json:"fetched"`
+	RangeBytes int64 `json:"range_bytes"`
+}
+
+// 查询日志
+func (c *Client) Query(ctx context.Context, opts QueryOptions) ([]LogEntry, error) {
+	result, err := c.QueryPage(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Logs, nil
+}
+
+// 查询一页日志，同时返回增量查询的游标
+func (c *Client) QueryPage(ctx context.Context, opts QueryOptions) (*QueryResult, error) {
+	params := url.Values{}
+	setParam(params, "application_id", opts.ApplicationID)
+	setParam(params, "log_level", opts.LogLevel)
+	setParam(params, "view", opts.View)
+	setParam(params, "sort", opts.Sort)
+	if opts.Limit > 0 {
+		params.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	for k, v := range opts.Fields {
+		params.Set("field."+k, v)
+	}
+	if opts.SinceID > 0 {
+		params.Set("since_id", strconv.FormatInt(opts.SinceID, 10))
+	}
+	if opts.MaxID > 0 {
+		params.Set("max_id", strconv.FormatInt(opts.MaxID, 10))
+	}
+	if len(opts.Select) > 0 {
+		params.Set("fields", strings.Join(opts.Select, ","))
+	}
+	setParam(params, "from", opts.From)
+	setParam(params, "to", opts.To)
+	setParam(params, "q", opts.Keyword)
+	setParam(params, "regex", opts.Regex)
+	setParam(params, "since", opts.Since)
+	if opts.FullMessage {
+		params.Set("full_message", "true")
+	}
+	if opts.IncludeArchive {
+		params.Set("include_archive", "true")
+	}
+	// 只取日志，不需要按文件的概览
+	params.Set("summary", "false")
+
+	var result QueryResult
+	if err := c.getJSON(ctx, "/query?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// 按 ID 获取一条完整的日志
+func (c *Client) GetLog(ctx context.Context, applicationID string, id int64) (*LogEntry, error) {
+	params := url.Values{}
+	params.Set("application_id", applicationID)
+	var entry LogEntry
+	if err := c.getJSON(ctx, "/logs/"+strconv.FormatInt(id, 10)+"?"+params.Encode(), &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// 应用的日志统计
+type ApplicationStats struct {
+	ApplicationID   string         `json:"application_id"`
+	Backend         string         `json:"backend"`
+	Total           int            `json:"total"`
+	Levels          map[string]int `json:"levels"`
+	EstimatedTotal  int            `json:"estimated_total,omitempty"` // 按采样比例还原的原始条数
+	EstimatedLevels map[string]int `json:"estimated_levels,omitempty"`
+	Files           int            `json:"files"`
+	Bytes           int64          `json:"bytes"`
+	FirstSeen       *time.Time     `json:"first_seen,omitempty"`
+	LastSeen        *time.Time     `json:"last_seen,omitempty"`
+}
+
+// 查询应用的日志条数、级别分布和磁盘占用，不指定应用时为全部应用
+func (c *Client) Stats(ctx context.Context, applicationIDs ...string) ([]ApplicationStats, error) {
+	params := url.Values{}
+	setParam(params, "application_id", strings.Join(applicationIDs, ","))
+	var result struct {
+		Applications []ApplicationStats `json:"applications"`
+	}
+	if err := c.getJSON(ctx, "/stats?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	return result.Applications, nil
+}
+
+// 事务列表的查询条件
+type TransactionOptions struct {
+	ApplicationIDs []string
+	Statuses       []string // committed、rolled_back、hanging 等
+	Modes          []string // AT、TCC、SAGA、XA
+	From           string
+	To             string
+	HangAfter      time.Duration // 开始后超过该时长仍无终态的事务视为挂起，0 时使用服务端配置
+	Limit          int
+}
+
+// 由 TC 日志推断的全局事务
+type Transaction struct {
+	XID            string     `json:"xid"`
+	Status         string     `json:"status"`
+	ApplicationIDs []string   `json:"application_ids"`
+	Begin          *time.Time `json:"begin,omitempty"`
+	End            *time.Time `json:"end,omitempty"`
+	FirstSeen      time.Time  `json:"first_seen"`
+	LastSeen       time.Time  `json:"last_seen"`
+	DurationMs     *int64     `json:"duration_ms,omitempty"`
+	Events         int        `json:"events"`
+	TerminalEvent  string     `json:"terminal_event,omitempty"`
+	Mode           string     `json:"mode,omitempty"`
+}
+
+// 事务列表，Counts 按状态统计全部匹配的事务，Transactions 最多 Limit 个
+type TransactionList struct {
+	ApplicationIDs []string       `json:"application_ids"`
+	HangAfter      string         `json:"hang_after"`
+	Counts         map[string]int `json:"counts"`
+	Modes          map[string]int `json:"modes"`
+	Transactions   []Transaction  `json:"transactions"`
+	Truncated      bool           `json:"truncated"`
+	Suspicious     []Transaction  `json:"suspicious"`
+}
+
+// 查询全局事务，最近开始的在前
+func (c *Client) Transactions(ctx context.Context, opts TransactionOptions) (*TransactionList, error) {
+	params := url.Values{}
+	setParam(params, "application_id", strings.Join(opts.ApplicationIDs, ","))
+	setParam(params, "status", strings.Join(opts.Statuses, ","))
+	setParam(params, "mode", strings.Join(opts.Modes, ","))
+	setParam(params, "from", opts.From)
+	setParam(params, "to", opts.To)
+	if opts.HangAfter > 0 {
+		params.Set("hang_after", opts.HangAfter.String())
+	}
+	if opts.Limit > 0 {
+		params.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var result TransactionList
+	if err := c.getJSON(ctx, "/transactions?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// 订阅实时日志，fn 返回错误或 ctx 结束时停止。连接断开后会自动重连
+func (c *Client) Tail(ctx context.Context, opts TailOptions, fn func(LogEntry) error) error {
+	params := url.Values{}
+	setParam(params, "application_id", opts.ApplicationID)
+	setParam(params, "log_level", opts.LogLevel)
+
+	for attempt := 0; ; attempt++ {
+		received, err := c.tailOnce(ctx, "/tail?"+params.Encode(), fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var stop *tailStop
+		if errors.As(err, &stop) {
+			return stop.err
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && !retryableStatus(apiErr.StatusCode) {
+			return err
+		}
+		if received {
+			attempt = 0
+		}
+		if attempt >= c.maxRetries {
+			return err
+		}
+		if err := c.sleep(ctx, c.backoff(attempt, 0)); err != nil {
+			return err
+		}
+	}
+}
+
+// 回调返回的错误，不触发重连
+type tailStop struct{ err error }
+
+func (s *tailStop) Error() string { return s.err.Error() }
+
+func (c *Client) tailOnce(ctx context.Context, path string, fn func(LogEntry) error) (bool, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	// 订阅是长连接，不能使用客户端的整体超时
+	hc := *c.httpClient
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, readAPIError(resp)
+	}
+
+	received := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue // 心跳
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		received = true
+		if err := fn(entry); err != nil {
+			return received, &tailStop{err: err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return received, err
+	}
+	return received, io.ErrUnexpectedEOF
+}
+
+func setParam(params url.Values, key, value string) {
+	if value != "" {
+		params.Set(key, value)
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+c.prefix+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.headers {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) postJSON(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, path, body, nil, out)
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, nil, out)
+}
+
+// 发送请求，对可重试的错误按指数退避加随机抖动重试
+func (c *Client) do(ctx context.Context, method, path string, body []byte, header http.Header, out interface{}) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			var retryAfter time.Duration
+			var apiErr *retryAfterError
+			if errors.As(lastErr, &apiErr) {
+				retryAfter = apiErr.after
+			}
+			if err := c.sleep(ctx, c.backoff(attempt-1, retryAfter)); err != nil {
+				return err
+			}
+		}
+
+		req, err := c.newRequest(ctx, method, path, body, header)
+		if err != nil {
+			return err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil {
+				io.Copy(io.Discard, resp.Body)
+				return nil
+			}
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+
+		apiErr := readAPIError(resp)
+		resp.Body.Close()
+		if !retryableStatus(resp.StatusCode) {
+			return apiErr
+		}
+		lastErr = &retryAfterError{APIError: apiErr, after: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return lastErr
+}
+
+// 带有 Retry-After 提示的可重试错误
+type retryAfterError struct {
+	*APIError
+	after time.Duration
+}
+
+func (e *retryAfterError) Unwrap() error { return e.APIError }
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+func readAPIError(resp *http.Response) *APIError {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Error string `json:"error"`
+	}
+	msg := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		msg = body.Error
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: msg}
+}
+
+// 第 attempt 次重试前的等待时间，服务端给出 Retry-After 时以其为下限
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	d := c.minBackoff << uint(attempt)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if retryAfter > d {
+		d = retryAfter
+	}
+	return d
+}
+
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
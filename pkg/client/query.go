@@ -0,0 +1,282 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 日志级别
+type Level string
+
+const (
+	LevelTrace Level = "TRACE"
+	LevelDebug Level = "DEBUG"
+	LevelInfo  Level = "INFO"
+	LevelWarn  Level = "WARN"
+	LevelError Level = "ERROR"
+	LevelFatal Level = "FATAL"
+)
+
+// 分页时默认每页的条数，不能超过服务端的 query.max_limit（默认 10000）
+const defaultPageSize = 1000
+
+// 链式构造的查询条件，如
+//
+//	q := client.NewQuery().App("order-service").Level(client.LevelError).
+//		Between(from, to).Matches(`branch \d+ rollback`)
+//
+// 条件有误时在执行查询时返回错误
+type QueryBuilder struct {
+	opts     QueryOptions
+	apps     []string
+	pageSize int
+	err      error
+}
+
+func NewQuery() *QueryBuilder {
+	return &QueryBuilder{}
+}
+
+func (q *QueryBuilder) fail(err error) *QueryBuilder {
+	if q.err == nil {
+		q.err = err
+	}
+	return q
+}
+
+// 查询的应用，可以是多个应用或通配模式（如 order-*），多个应用的结果按时间合并
+func (q *QueryBuilder) App(applicationIDs ...string) *QueryBuilder {
+	q.apps = append(q.apps, applicationIDs...)
+	return q
+}
+
+// 日志级别，不在视图上查询时必须指定
+func (q *QueryBuilder) Level(level Level) *QueryBuilder {
+	q.opts.LogLevel = strings.ToUpper(string(level))
+	return q
+}
+
+// 在保存的视图上查询，视图决定了应用和级别
+func (q *QueryBuilder) View(name string) *QueryBuilder {
+	q.opts.View = name
+	return q
+}
+
+// 时间范围，零值表示不限
+func (q *QueryBuilder) Between(from, to time.Time) *QueryBuilder {
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return q.fail(errors.New("query: to is before from"))
+	}
+	q.opts.From, q.opts.To = formatTime(from), formatTime(to)
+	return q
+}
+
+// 只查询 from 之后的日志
+func (q *QueryBuilder) After(from time.Time) *QueryBuilder {
+	q.opts.From = formatTime(from)
+	return q
+}
+
+// log_message 须匹配的正则（RE2 语法，与服务端一致）
+func (q *QueryBuilder) Matches(pattern string) *QueryBuilder {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return q.fail(errors.New("query: invalid regex: " + err.Error()))
+	}
+	q.opts.Regex = pattern
+	return q
+}
+
+// log_message 须包含的关键字，不区分大小写
+func (q *QueryBuilder) Contains(keyword string) *QueryBuilder {
+	q.opts.Keyword = keyword
+	return q
+}
+
+// 按结构化字段过滤，可以多次调用
+func (q *QueryBuilder) Field(key, value string) *QueryBuilder {
+	if q.opts.Fields == nil {
+		q.opts.Fields = make(map[string]string)
+	}
+	q.opts.Fields[key] = value
+	return q
+}
+
+// 只返回这些字段
+func (q *QueryBuilder) Select(fields ...string) *QueryBuilder {
+	q.opts.Select = append(q.opts.Select, fields...)
+	return q
+}
+
+// 最早的在前
+func (q *QueryBuilder) Ascending() *QueryBuilder {
+	q.opts.Sort = "asc"
+	return q
+}
+
+// 最新的在前（默认）
+func (q *QueryBuilder) Descending() *QueryBuilder {
+	q.opts.Sort = "desc"
+	return q
+}
+
+// 最多返回的条数。Run 时为单次查询的条数，Iterate 和 Pages 时为全部页的总条数，0 表示不限
+func (q *QueryBuilder) Limit(n int) *QueryBuilder {
+	if n < 0 {
+		return q.fail(errors.New("query: limit must not be negative"))
+	}
+	q.opts.Limit = n
+	return q
+}
+
+// 分页时每页的条数，默认 1000
+func (q *QueryBuilder) PageSize(n int) *QueryBuilder {
+	if n <= 0 {
+		return q.fail(errors.New("query: page size must be positive"))
+	}
+	q.pageSize = n
+	return q
+}
+
+// 校验并生成查询条件
+func (q *QueryBuilder) Build() (QueryOptions, error) {
+	if q.err != nil {
+		return QueryOptions{}, q.err
+	}
+	opts := q.opts
+	opts.ApplicationID = strings.Join(q.apps, ",")
+	if opts.View == "" && (opts.ApplicationID == "" || opts.LogLevel == "") {
+		return QueryOptions{}, errors.New("query: App and Level are required unless querying a View")
+	}
+	if opts.Keyword != "" && opts.Regex != "" {
+		return QueryOptions{}, errors.New("query: Contains and Matches cannot be combined")
+	}
+	return opts, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// 执行一次查询
+func (c *Client) Run(ctx context.Context, q *QueryBuilder) ([]LogEntry, error) {
+	opts, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+	return c.Query(ctx, opts)
+}
+
+// 逐条遍历全部匹配的日志，自动翻页，fn 返回错误时停止并返回该错误
+func (c *Client) Iterate(ctx context.Context, q *QueryBuilder, fn func(LogEntry) error) error {
+	pager := c.Pages(q)
+	for {
+		page, err := pager.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if page == nil {
+			return nil
+		}
+		for _, entry := range page {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// 按页遍历查询结果。升序时按写入顺序以 since 游标翻页，可以跨应用，不包含最近一秒内写入的日志；
+// 降序时按日志 ID 以 max_id 翻页，只能查询单个应用
+type Pager struct {
+	client   *Client
+	opts     QueryOptions
+	err      error
+	pageSize int
+	limit    int // 剩余可返回的条数，0 表示不限
+	done     bool
+}
+
+func (c *Client) Pages(q *QueryBuilder) *Pager {
+	p := &Pager{client: c, pageSize: q.pageSize}
+	p.opts, p.err = q.Build()
+	if p.err != nil {
+		return p
+	}
+	if p.pageSize == 0 {
+		p.pageSize = defaultPageSize
+	}
+	p.limit = p.opts.Limit
+	if p.opts.Sort == "asc" {
+		// 写入序号从 1 开始，从最早写入的日志开始遍历
+		p.opts.Since = "1970-01-01T00:00:00Z,1"
+	} else {
+		if p.opts.View != "" || strings.ContainsAny(p.opts.ApplicationID, ",*?") {
+			p.err = errors.New("query: descending pagination requires a single App; use Ascending to page across applications")
+			return p
+		}
+		p.opts.Sort = "desc"
+		p.opts.MaxID = math.MaxInt64
+		// 按 ID 翻页，只返回部分字段时也要带上 id
+		if len(p.opts.Select) > 0 && !slices.Contains(p.opts.Select, "id") {
+			p.opts.Select = append(slices.Clone(p.opts.Select), "id")
+		}
+	}
+	return p
+}
+
+// 下一页结果，没有更多结果时返回 nil
+func (p *Pager) Next(ctx context.Context) ([]LogEntry, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.done {
+		return nil, nil
+	}
+	size := p.pageSize
+	if p.limit > 0 && p.limit < size {
+		size = p.limit
+	}
+	opts := p.opts
+	opts.Limit = size
+	result, err := p.client.QueryPage(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	logs := result.Logs
+	// 不足一页说明已经没有更多结果
+	if len(logs) < size {
+		p.done = true
+	}
+	if p.limit > 0 {
+		if p.limit -= len(logs); p.limit <= 0 {
+			p.done = true
+		}
+	}
+	if p.opts.Sort == "asc" {
+		if result.NextSince == "" {
+			p.done = true
+		}
+		p.opts.Since = result.NextSince
+	} else if len(logs) > 0 {
+		minID := logs[0].ID
+		for _, entry := range logs {
+			minID = min(minID, entry.ID)
+		}
+		if minID <= 1 {
+			p.done = true
+		}
+		p.opts.MaxID = minID - 1
+	}
+	if len(logs) == 0 {
+		return nil, nil
+	}
+	return logs, nil
+}
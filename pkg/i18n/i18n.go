@@ -0,0 +1,175 @@
+// Package i18n 是生成文本的本地化：分析发现、事务诊断、超时报告、告警通知和定期报告中的文字以英文编写，
+// 按英文原文查找译文，没有译文时保留英文。选择哪种语言由调用方决定
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 支持的语言
+const (
+	English = "en"
+	Chinese = "zh-CN"
+)
+
+// 规范化语言标签，如 zh、zh-cn、zh-Hans-CN 为 zh-CN，en-US 为 en；不支持的语言返回 false
+func Normalize(tag string) (string, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	switch {
+	case tag == "en" || strings.HasPrefix(tag, "en-"):
+		return English, true
+	case tag == "zh" || tag == "zh-cn" || tag == "zh-sg" || strings.HasPrefix(tag, "zh-hans"):
+		return Chinese, true
+	}
+	return "", false
+}
+
+// 按语言翻译一段英文原文，没有译文时原样返回
+func Tr(lang, s string) string {
+	if t, ok := translations[lang][s]; ok {
+		return t
+	}
+	return s
+}
+
+// 待翻译的文本：英文格式串及其参数，输出时才确定语言。参数本身为 Text 时同样翻译
+type Text struct {
+	format string
+	args   []any
+}
+
+func Textf(format string, args ...any) Text {
+	return Text{format: format, args: args}
+}
+
+// 是否为零值，即没有设置文本
+func (t Text) IsZero() bool {
+	return t.format == ""
+}
+
+// 按语言生成文本
+func (t Text) In(lang string) string {
+	if len(t.args) == 0 {
+		return Tr(lang, t.format)
+	}
+	args := make([]any, len(t.args))
+	for i, arg := range t.args {
+		if nested, ok := arg.(Text); ok {
+			arg = nested.In(lang)
+		}
+		args[i] = arg
+	}
+	return fmt.Sprintf(Tr(lang, t.format), args...)
+}
+
+// 各语言的译文，键为英文原文；参数顺序不同时使用 %[n]s 形式的显式下标
+var translations = map[string]map[string]string{
+	Chinese: {
+		// 事务状态和二阶段
+		"committed":   "已提交",
+		"rolled back": "已回滚",
+		"timed out":   "已超时",
+		"failed":      "失败",
+		"hanging":     "悬挂",
+		"in progress": "进行中",
+		"unknown":     "状态未知",
+		"commit":      "提交",
+		"rollback":    "回滚",
+
+		// 分析发现
+		"TC peer unreachable": "TC 节点无法连接对端",
+		"A TC node repeatedly failed to connect to a raft peer; the cluster may be partitioned or the peer is down.": "TC 节点反复连接 raft 对端失败，集群可能发生了网络分区或对端已宕机。",
+		"Repeated raft leader elections": "raft 反复选主",
+		"A TC node kept starting pre-vote rounds, meaning it could not see a stable leader.":                                 "TC 节点不断发起预投票，说明它看不到稳定的 leader。",
+		"Multiple raft leaders in one term":                                                                                  "同一任期出现多个 raft leader",
+		"More than one TC node became leader for the same term, so the cluster split and both halves accepted transactions.": "同一任期内有多个 TC 节点成为 leader，集群发生脑裂，两边都在接受事务。",
+		"Branch outcome contradicts the TC decision":                                                                         "分支结果与 TC 的决议相反",
+		"The RM committed a branch the TC rolled back, or rolled back a branch the TC committed; the data of the branch no longer matches the rest of the global transaction and must be reconciled.": "TC 已回滚的分支被 RM 提交，或 TC 已提交的分支被 RM 回滚；该分支的数据与全局事务的其余部分不一致，需要核对修复。",
+		"RM never applied the phase-two decision": "RM 没有执行二阶段决议",
+		"The TC recorded the commit or rollback of a branch, but the RM owning its resource never logged receiving or finishing it; the branch may still hold uncommitted data or locks.": "TC 记录了分支的提交或回滚，但持有该资源的 RM 没有收到或完成它的日志；该分支可能仍持有未提交的数据或锁。",
+		"RM phase two failed after the TC finished the transaction": "TC 结束事务后 RM 的二阶段失败",
+		"The last phase-two result the RM logged for a branch is a failure, while the TC considers the global transaction finished; verify the data of the branch.": "RM 为分支记录的最后一次二阶段结果是失败，而 TC 认为全局事务已结束；请核对该分支的数据。",
+		"Hot global lock row": "全局锁热点行",
+		"Several global transactions repeatedly contended for the global lock on the same row; consider shortening the transactions or reducing concurrent updates of the row.": "多个全局事务反复争用同一行的全局锁；可以考虑缩短事务或减少对该行的并发更新。",
+		"Branch phase-two retry storm": "分支二阶段重试风暴",
+		"The TC keeps retrying the commit or rollback of the same branch; the branch cannot finish until its resource recovers or its data is repaired, and every retry adds log volume.": "TC 不断重试同一分支的提交或回滚；在资源恢复或数据修复之前该分支无法完成，每次重试都会增加日志量。",
+		"Dirty data blocks branch rollback": "脏数据阻塞分支回滚",
+		"The undo log no longer matches the current row image, so Seata refuses to roll the branch back; the affected rows must be repaired manually before the branch can be rolled back.": "undo log 与当前的行镜像不一致，Seata 拒绝回滚该分支；需要先手工修复受影响的行才能回滚。",
+		"Undo log not found during rollback": "回滚时找不到 undo log",
+		"A branch was rolled back without an undo log, either because the local transaction never committed or because the undo log was removed; verify the data of the branch.": "分支回滚时没有 undo log，可能是本地事务从未提交，也可能是 undo log 已被删除；请核对该分支的数据。",
+		"Branch rollback failed": "分支回滚失败",
+		"The TC could not roll a branch back; retryable failures keep the global transaction in rollback retrying, unretryable ones need manual intervention.": "TC 无法回滚分支；可重试的失败使全局事务停留在回滚重试中，不可重试的失败需要人工介入。",
+		"Global transaction without terminal event": "全局事务没有终态",
+		"A global transaction began but no commit, rollback or timeout was logged within the hang window; it may be stuck on the TC.": "全局事务已开始，但在观察窗口内没有提交、回滚或超时的日志，可能卡在了 TC 上。",
+
+		"%d failed connection attempts to %s":                                     "连接 %[2]s 失败 %[1]d 次",
+		"%s started %d pre-vote rounds across %d terms without a stable leader":   "%s 在 %[3]d 个任期内发起了 %[2]d 轮预投票，始终没有稳定的 leader",
+		"%s had %d leaders in term %s: %s":                                        "%[1]s 在任期 %[3]s 内有 %[2]d 个 leader：%[4]s",
+		"%d branches on %s ended opposite to the TC decision":                     "%[2]s 上有 %[1]d 个分支的结果与 TC 的决议相反",
+		"%d branches on %s have no RM log of the phase-two decision":              "%[2]s 上有 %[1]d 个分支没有 RM 执行二阶段决议的日志",
+		"%d branches on %s failed phase two after the TC finished":                "%[2]s 上有 %[1]d 个分支在 TC 结束事务后二阶段失败",
+		"global lock on %s conflicted %d times between %d transactions":           "%[1]s 上的全局锁在 %[3]d 个事务之间冲突了 %[2]d 次",
+		"Branch %s of %s retried %s %d times":                                     "事务 %[2]s 的分支 %[1]s %[3]s重试了 %[4]d 次",
+		"an unknown resource":                                                     "未知资源",
+		"%d rollback failures on %s":                                              "%[2]s 上回滚失败 %[1]d 次",
+		"Transaction %s began at %s and has no terminal event after %d log lines": "事务 %s 于 %s 开始，%d 条日志之后仍没有终态",
+
+		// 事务诊断
+		"AT rollback found rows modified outside the global transaction":           "AT 回滚时发现行数据在全局事务之外被修改",
+		"Undo log of the branch was not found during rollback":                     "回滚时找不到分支的 undo log",
+		"A branch rollback failed and will not be retried":                         "分支回滚失败且不会再重试",
+		"A branch timed out waiting for a global lock held by another transaction": "分支等待其他事务持有的全局锁超时",
+		"A branch could not acquire a global lock held by another transaction":     "分支无法获取其他事务持有的全局锁",
+		"A branch could not register with the TC":                                  "分支无法向 TC 注册",
+		"The global transaction exceeded its timeout and the TC rolled it back":    "全局事务超过超时时间，已被 TC 回滚",
+		"A branch rollback failed and is being retried":                            "分支回滚失败，正在重试",
+		// 内置升级规则的说明，作为诊断原因的标题
+		"Phase-two commit or rollback gave up and needs manual handling":                       "二阶段提交或回滚已放弃，需要人工处理",
+		"AT rollback found rows modified outside the global transaction; data is inconsistent": "AT 回滚时发现行数据在全局事务之外被修改，数据不一致",
+		"A branch commit failed and will not be retried":                                       "分支提交失败且不会再重试",
+		"The TC stopped retrying a global rollback after max_rollback_retry_timeout":           "超过 max_rollback_retry_timeout 后 TC 停止重试全局回滚",
+		"The TC stopped retrying a global commit after max_commit_retry_timeout":               "超过 max_commit_retry_timeout 后 TC 停止重试全局提交",
+		"The client cannot reach any TC server":                                                "客户端无法连接任何 TC 服务端",
+		"Transaction %s; probable cause in %s: %s":                                             "事务%s，疑似原因在 %s：%s",
+		" (branch %s)": "（分支 %s）",
+		"Transaction %s after the first error in %s: %s":                             "事务%[1]s，%[2]s 中出现了第一个错误：%[3]s",
+		"Transaction %s with no error logged; the slowest branch %s in %s took %s":   "事务%s，没有错误日志；最慢的分支 %s（%s）耗时 %s",
+		"Transaction %s; the logs contain no error or branch activity to explain it": "事务%s，日志中没有可以解释原因的错误或分支活动",
+
+		// 超时报告
+		"Timed out after %s. ": "事务在 %s 后超时。",
+		"Timed out. ":          "事务超时。",
+		"The last branch activity was in %s, %s before the timeout. ": "超时前最后的分支活动在 %s，距超时 %s。",
+		"The last activity was in %s, %s before the timeout. ":        "超时前最后的活动在 %s，距超时 %s。",
+		"The slowest branch %s in %s took %s. ":                       "最慢的分支 %s（%s）耗时 %s。",
+
+		// 告警通知
+		"[seata-log-analysis] Alert %s fired":       "[seata-log-analysis] 告警 %s 已触发",
+		"[seata-log-analysis] Alert %s":             "[seata-log-analysis] 告警 %s",
+		"[seata-log-analysis] Alert %s on %s":       "[seata-log-analysis] %[2]s 告警 %[1]s",
+		"Application: %s":                           "应用：%s",
+		"Group: %s":                                 "分组：%s",
+		"Value: %d (threshold %d)":                  "当前值：%d（阈值 %d）",
+		"Log time: %s":                              "日志时间：%s",
+		"Message: %s":                               "说明：%s",
+		"Sample: [%s] %s":                           "示例日志：[%s] %s",
+		"Test notification from seata-log-analysis": "来自 seata-log-analysis 的测试通知",
+		"%d %s logs in the last hour, %.1f standard deviations above the baseline of %.1f per hour":                   "最近一小时有 %d 条 %s 日志，比每小时 %.1f 条的基线高出 %.1f 个标准差",
+		"Freshest of %d entries received in the last %s was %s old (threshold %s); the log shipper is falling behind": "最近 %[2]s 收到的 %[1]d 条日志中最新的一条也已是 %[3]s 前的（阈值 %[4]s），日志采集落后了",
+		"Branch %s of %s retried %s %d times within %s":                                                               "事务 %[2]s 的分支 %[1]s 在 %[5]s 内%[3]s重试了 %[4]d 次",
+		"Branch %s of %s retried %s %d times within %s on %s":                                                         "事务 %[2]s 的分支 %[1]s 在 %[5]s 内%[3]s重试了 %[4]d 次，资源 %[6]s",
+
+		// 定期报告
+		"Report %q (%s)":                         "报告 %q（%s）",
+		"daily":                                  "日报",
+		"weekly":                                 "周报",
+		"Period: %s - %s":                        "周期：%s - %s",
+		"Generated: %s":                          "生成时间：%s",
+		"Logs: %d, errors: %d":                   "日志：%d，错误：%d",
+		"Transactions:":                          "事务：",
+		"Rollback rate: %.1f%%":                  "回滚率：%.1f%%",
+		"Top errors:":                            "高频错误：",
+		"[seata-log-analysis] %s report %s (%s)": "[seata-log-analysis] %[2]s %[1]s（%[3]s）",
+	},
+}
@@ -0,0 +1,62 @@
+// Package model 是日志分析服务各层共用的领域模型：上传、存储、解析和分析都以 LogData 表示一条日志，
+// 以 Ref 表示日志在存储中的位置
+package model
+
+import "strings"
+
+// 日志数据结构
+type LogData struct {
+	ApplicationID string `json:"application_id" binding:"required"`
+	LogLevel      string `json:"log_level" binding:"required"`
+	Timestamp     string `json:"timestamp" binding:"required"`
+	LogMessage    string `json:"log_message" binding:"required"`
+
+	// 从原始日志中解析出的 Seata 上下文，上传时也可直接提供
+	Logger   string `json:"logger,omitempty"`
+	Thread   string `json:"thread,omitempty"`
+	XID      string `json:"xid,omitempty"`
+	BranchID string `json:"branch_id,omitempty"`
+
+	// 分布式追踪上下文，上传时未提供的从消息中提取
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+
+	// 服务端分配的日志 ID，每个应用内按写入顺序单调递增，上传时提供的值会被忽略
+	ID int64 `json:"id,omitempty"`
+	// 服务端分配的写入序号，跨应用单调递增，时间戳相同的日志按它保持写入顺序；上传时提供的值会被忽略
+	Seq int64 `json:"seq,omitempty"`
+
+	// 采样写入时的保留比例，这条日志代表 1/sample_rate 条原始日志；未经采样时为空。
+	// 上传时可以带上客户端采样的比例，服务端再次采样时与之相乘
+	SampleRate float64 `json:"sample_rate,omitempty"`
+
+	// 自定义结构化字段，如 service、pod，可在查询时按 field.<key>=<value> 过滤
+	Fields map[string]string `json:"fields,omitempty" binding:"max=64"`
+
+	// 上传方的地址，供 enrich 处理器附加来源字段，不写入存储
+	Source string `json:"-"`
+}
+
+// 日志条目在存储中的位置，用于视图等场景下直接定位原始行
+type Ref struct {
+	ApplicationID string `json:"application_id"`
+	File          string `json:"file"`   // 应用目录下的文件名
+	Offset        int64  `json:"offset"` // 行首的字节偏移
+}
+
+// 租户应用在存储中的 ID 形如 <租户>/<应用>
+const TenantSeparator = "/"
+
+// 拆分存储使用的应用 ID，非租户应用的租户为空
+func SplitApplicationID(applicationID string) (tenant, app string) {
+	if i := strings.Index(applicationID, TenantSeparator); i >= 0 {
+		return applicationID[:i], applicationID[i+1:]
+	}
+	return "", applicationID
+}
+
+// 去掉租户前缀后的应用 ID，用于写入日志记录和返回给调用方
+func BareApplicationID(applicationID string) string {
+	_, app := SplitApplicationID(applicationID)
+	return app
+}
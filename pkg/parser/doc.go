@@ -0,0 +1,4 @@
+// Package parser 将原始日志文本解析为 model.LogData：按 Seata TC 的 logback 布局、常见的「时间 级别 消息」格式解析，
+// 都无法识别时从行中推断级别和时间；并从消息中提取 XID、分支 ID 等 Seata 字段和识别事务模式。
+// 本包不依赖服务的配置，应用登记的解析规则由服务在调用 ParseLine 之前套用
+package parser
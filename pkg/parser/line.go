@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/model"
+)
+
+// 常见纯文本日志行：可选的日期时间前缀，随后是级别关键字
+var plainLinePattern = regexp.MustCompile(
+	`^\[?((?:\d{4}-\d{2}-\d{2}[ T])?\d{2}:\d{2}:\d{2}(?:[.,]\d{1,9})?(?:Z|[+-]\d{2}:?\d{2})?)\]?\s+\[?(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL)\]?[\s:\-]*(.*)$`)
+
+// 将一行原始文本解析为日志条目：按 Seata TC 布局解析，其次识别常见的「时间 级别 消息」格式，
+// 都无法识别时从行中推断级别和时间，默认为 INFO 和 now
+func ParseLine(applicationID, line string, now time.Time) model.LogData {
+	if entry, ok := ParseSeataLine(applicationID, line, now); ok {
+		return entry
+	}
+
+	entry := model.LogData{
+		ApplicationID: applicationID,
+		LogLevel:      "INFO",
+		Timestamp:     now.Format(time.RFC3339Nano),
+		LogMessage:    line,
+	}
+
+	if m := plainLinePattern.FindStringSubmatch(line); m != nil {
+		entry.Timestamp = m[1]
+		entry.LogLevel = strings.Replace(m[2], "WARNING", "WARN", 1)
+		entry.LogMessage = m[3]
+	} else {
+		inferLevelAndTime(&entry, line, now)
+	}
+	return entry
+}
+
+// 级别关键字只在行首这么多字节内查找，避免把消息正文中的 error 等单词当作级别
+const levelSearchBytes = 160
+
+var (
+	levelKeywordPattern     = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL)\b`)
+	leadingTimestampPattern = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:[.,]\d{1,9})?(?:Z|[+-]\d{2}:?\d{2})?)\]?`)
+	// 异常堆栈的第一行，如 java.lang.IllegalStateException: ...
+	exceptionLinePattern = regexp.MustCompile(`^(?:[\w$]+\.)+[\w$]*(?:Exception|Error)\b`)
+)
+
+// 不符合任何布局的行（如级别前还有线程名的 logback 布局）：取行首的日期时间和行首附近的级别关键字，
+// 没有关键字的异常堆栈首行视为 ERROR，消息保留整行
+func inferLevelAndTime(entry *model.LogData, line string, now time.Time) {
+	if m := leadingTimestampPattern.FindStringSubmatch(line); m != nil {
+		// 带 T 但没有时区的时间按本地时间解释
+		ts := m[1]
+		if _, ok := ParseTime(ts, now); !ok {
+			ts = strings.Replace(ts, "T", " ", 1)
+		}
+		if _, ok := ParseTime(ts, now); ok {
+			entry.Timestamp = ts
+		}
+	}
+	head := line
+	if len(head) > levelSearchBytes {
+		head = head[:levelSearchBytes]
+	}
+	if m := levelKeywordPattern.FindStringSubmatch(head); m != nil {
+		entry.LogLevel = strings.Replace(m[1], "WARNING", "WARN", 1)
+	} else if exceptionLinePattern.MatchString(line) {
+		entry.LogLevel = "ERROR"
+	}
+}
+
+// 判断一行是否是上一条日志的延续（如 Java 异常堆栈）
+func IsContinuation(line string) bool {
+	if line == "" {
+		return false
+	}
+	if line[0] == ' ' || line[0] == '\t' {
+		return true
+	}
+	return strings.HasPrefix(line, "Caused by:") || strings.HasPrefix(line, "at ") || strings.HasPrefix(line, "...")
+}
+
+// 解析多行原始文本，合并异常堆栈等延续行
+func ParseLines(applicationID, text string, now time.Time) []model.LogData {
+	return ParseLinesWith(applicationID, text, now, ParseLine)
+}
+
+// 同 ParseLines，每条日志的第一行由 parse 解析，如先套用应用登记的解析规则
+func ParseLinesWith(applicationID, text string, now time.Time, parse func(applicationID, line string, now time.Time) model.LogData) []model.LogData {
+	var entries []model.LogData
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if len(entries) > 0 && IsContinuation(line) {
+			entries[len(entries)-1].LogMessage += "\n" + line
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entries = append(entries, parse(applicationID, line, now))
+	}
+	return entries
+}
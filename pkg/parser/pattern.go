@@ -0,0 +1,253 @@
+package parser
+
+import (
+	"math"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 带字面量预筛的正则。Go 的正则只在表达式以普通字面量开头时才能跳过不可能匹配的位置，
+// 以 \b、(?i) 或分支开头的表达式在每个位置都要回溯尝试，写入时对每条日志执行多个这样的正则代价很高。
+// 编译时从语法树中找出匹配必然包含的一组字面量，文本中一个都没有时不运行正则，结果与直接匹配相同
+type Pattern struct {
+	*regexp.Regexp
+	literals []string    // 忽略大小写比较的小写 ASCII 字面量，按首字节排序，至少出现一个；nil 表示无法预筛
+	first    [257]uint16 // 首字节为 c 的字面量是 literals[first[c]:first[c+1]]
+}
+
+func CompilePattern(expr string) (*Pattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pattern{Regexp: re}
+	if tree, err := syntax.Parse(expr, syntax.Perl); err == nil {
+		p.literals = requiredLiterals(tree.Simplify())
+	}
+	if len(p.literals) > math.MaxUint16 {
+		p.literals = nil
+	}
+	sort.Strings(p.literals)
+	for c := 0; c < 256; c++ {
+		p.first[c+1] = p.first[c]
+		for int(p.first[c+1]) < len(p.literals) && int(p.literals[p.first[c+1]][0]) == c {
+			p.first[c+1]++
+		}
+	}
+	return p, nil
+}
+
+func MustCompilePattern(expr string) *Pattern {
+	p, err := CompilePattern(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// 文本是否可能匹配：逐字节按首字节找出可能在此开始的字面量再比较，只扫描一遍文本。
+// 文本含非 ASCII 字符时不预筛，忽略大小写的比较只对 ASCII 可靠
+func (p *Pattern) MayMatch(s string) bool {
+	if p.literals == nil {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			return true
+		}
+		c = toLowerASCII(c)
+		for _, lit := range p.literals[p.first[c]:p.first[c+1]] {
+			if hasPrefixFoldASCII(s[i:], lit) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Pattern) MatchString(s string) bool {
+	return p.MayMatch(s) && p.Regexp.MatchString(s)
+}
+
+func (p *Pattern) FindStringSubmatch(s string) []string {
+	if !p.MayMatch(s) {
+		return nil
+	}
+	return p.Regexp.FindStringSubmatch(s)
+}
+
+// 精确字面量集合的大小上限，超出后不再展开
+const maxExactLiterals = 16
+
+// 匹配必然包含其中之一的字面量，无法确定时返回 nil
+func requiredLiterals(re *syntax.Regexp) []string {
+	if lits := exactLiterals(re); lits != nil && shortest(lits) > 0 {
+		return lits
+	}
+	switch re.Op {
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// 每个部分都必须出现：相邻的精确部分连接成更长的字面量，取最短字面量最长的一组，预筛更有效
+		var best, run []string
+		consider := func(lits []string) {
+			if lits != nil && shortest(lits) > 0 && (best == nil || shortest(lits) > shortest(best)) {
+				best = lits
+			}
+		}
+		for _, sub := range re.Sub {
+			if exact := exactLiterals(sub); exact != nil {
+				if run == nil {
+					run = []string{""}
+				}
+				if joined := joinLiterals(run, exact); joined != nil {
+					run = joined
+					continue
+				}
+				consider(run)
+				run = exact
+				continue
+			}
+			consider(run)
+			run = nil
+			consider(requiredLiterals(sub))
+		}
+		consider(run)
+		return best
+	case syntax.OpAlternate:
+		var all []string
+		for _, sub := range re.Sub {
+			lits := requiredLiterals(sub)
+			if lits == nil {
+				return nil
+			}
+			all = append(all, lits...)
+		}
+		return all
+	}
+	return nil
+}
+
+// 表达式能匹配的全部文本（小写），不是少量确定的字面量时返回 nil。\b 等断言只匹配空串
+func exactLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		lit := string(re.Rune)
+		if !isASCII(lit) {
+			return nil
+		}
+		return []string{strings.ToLower(lit)}
+	case syntax.OpEmptyMatch, syntax.OpWordBoundary, syntax.OpNoWordBoundary,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return []string{""}
+	case syntax.OpCharClass:
+		// 如 [- ]，忽略大小写的字母只计一次
+		var lits []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if r >= utf8.RuneSelf || len(lits) >= maxExactLiterals {
+					return nil
+				}
+				lits = appendLiteral(lits, strings.ToLower(string(r)))
+			}
+		}
+		return lits
+	case syntax.OpCapture:
+		return exactLiterals(re.Sub[0])
+	case syntax.OpQuest:
+		if lits := exactLiterals(re.Sub[0]); lits != nil && len(lits) < maxExactLiterals {
+			return appendLiteral(lits, "")
+		}
+	case syntax.OpConcat:
+		lits := []string{""}
+		for _, sub := range re.Sub {
+			if lits = joinLiterals(lits, exactLiterals(sub)); lits == nil {
+				return nil
+			}
+		}
+		return lits
+	case syntax.OpAlternate:
+		var lits []string
+		for _, sub := range re.Sub {
+			exact := exactLiterals(sub)
+			if exact == nil {
+				return nil
+			}
+			for _, lit := range exact {
+				if lits = appendLiteral(lits, lit); len(lits) > maxExactLiterals {
+					return nil
+				}
+			}
+		}
+		return lits
+	}
+	return nil
+}
+
+// 两组字面量两两连接，任一组未知或结果过多时返回 nil
+func joinLiterals(a, b []string) []string {
+	if a == nil || b == nil || len(a)*len(b) > maxExactLiterals {
+		return nil
+	}
+	lits := make([]string, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			lits = appendLiteral(lits, x+y)
+		}
+	}
+	return lits
+}
+
+func appendLiteral(lits []string, lit string) []string {
+	for _, l := range lits {
+		if l == lit {
+			return lits
+		}
+	}
+	return append(lits, lit)
+}
+
+func shortest(lits []string) int {
+	n := len(lits[0])
+	for _, lit := range lits[1:] {
+		n = min(n, len(lit))
+	}
+	return n
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// s 是否忽略大小写地以 lower 开头，lower 为小写
+func hasPrefixFoldASCII(s, lower string) bool {
+	if len(s) < len(lower) {
+		return false
+	}
+	for i := 0; i < len(lower); i++ {
+		if toLowerASCII(s[i]) != lower[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
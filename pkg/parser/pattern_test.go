@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var prefilterTestExprs = []string{
+	`(?i)need\s+(?:to\s+)?manual(?:ly)?\s+handl`,
+	`(?i)has dirty records when undo|dirty (?:data|records?) (?:found|detected)`,
+	`(?i)no available service .*(?:found in cluster|seata)|can ?not (?:connect|register) to (?:the )?(?:seata[- ]server|TC)\b`,
+	`\b(?:PhaseTwo_)?RollbackFailed_Unretryable\b`,
+	`(?i)\bbranch_?type\s*(?:[=:.]|\bis\b)\s*\[?(AT|TCC|SAGA|XA)\b`,
+	`\bAT mode\b|(?i:undo_?\s?log)|SQLUndo\w*|(?i:global lock)|LockConflictException`,
+	`\bXA(?:Resource|Connection)\w*|\w+ProxyXA\b|\bXA (?:START|END)\b`,
+	`(?i:\bsaga\b|state ?machine)`,
+	`ab*c`, `a?b`, `x{2,}y`, `(?i)k`, `[Kk]elvin`, `^$`, `.*`, `(?:)`, `\d+`, `(?i)straße`,
+}
+
+var prefilterTestWords = []string{
+	"need", "to", "manually", "handling", "Manual", "dirty", "data", "found", "undo", "log", "undo_log", "UNDO LOG",
+	"no", "available", "service", "seata", "cannot", "connect", "can", "not", "TC", "the", "seata-server",
+	"PhaseTwo_RollbackFailed_Unretryable", "RollbackFailed_Unretryable", "branchType=TCC", "branch_type is AT",
+	"AT", "mode", "XAResourceImpl", "ConnectionProxyXA", "XA", "START", "saga", "StateMachine", "state", "machine",
+	"ac", "abbbc", "b", "xxy", "K", "Kelvin", "\u212aelvin", "STRASSE", "straße", "42", "global lock", "lock",
+}
+
+// 预筛不能改变匹配结果
+func TestPatternMatchesRegexp(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	messages := []string{""}
+	for i := 0; i < 2000; i++ {
+		words := make([]string, 1+r.Intn(6))
+		for j := range words {
+			words[j] = prefilterTestWords[r.Intn(len(prefilterTestWords))]
+		}
+		messages = append(messages, strings.Join(words, []string{" ", "  ", "\t", "-", ""}[r.Intn(5)]))
+	}
+	for _, expr := range prefilterTestExprs {
+		re, p := regexp.MustCompile(expr), MustCompilePattern(expr)
+		for _, m := range messages {
+			if got, want := p.MatchString(m), re.MatchString(m); got != want {
+				t.Fatalf("%s on %q: MatchString = %v, regexp = %v", expr, m, got, want)
+			}
+			if got, want := p.FindStringSubmatch(m), re.FindStringSubmatch(m); strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+				t.Fatalf("%s on %q: FindStringSubmatch = %q, regexp = %q", expr, m, got, want)
+			}
+		}
+	}
+}
+
+func TestPatternSkipsMessagesWithoutLiterals(t *testing.T) {
+	p := MustCompilePattern(`(?i)need\s+(?:to\s+)?manual(?:ly)?\s+handl`)
+	if p.MayMatch("Branch commit failed, will retry") {
+		t.Fatal("message without the literal is not skipped")
+	}
+	if !p.MayMatch("MANUAL handling") {
+		t.Fatal("case-insensitive literal is skipped")
+	}
+	if !MustCompilePattern(`\w+`).MayMatch("anything") {
+		t.Fatal("pattern without literals skips messages")
+	}
+}
+
+func BenchmarkClassifyMode(b *testing.B) {
+	message := "Branch commit failed: xid=192.168.1.10:8091:2612345678 branchId=2612345680 resourceId=jdbc:mysql://db:3306/orders, will retry"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ClassifyMode(message)
+	}
+}
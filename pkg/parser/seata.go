@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/model"
+)
+
+// 从 Seata 日志消息中提取的事务相关字段
+var (
+	XIDPattern        = MustCompilePattern(`(?i)\bxid\s*[=:]?\s*\[?([\w.\-]+:\d+:\d+)\]?`)
+	BareXIDPattern    = MustCompilePattern(`\b([\w\-]+(?:\.[\w\-]+)*:\d{2,5}:\d{5,})\b`)
+	branchIDPattern   = MustCompilePattern(`(?i)\bbranch_?id\s*[=:]\s*\[?(\d+)\]?`)
+	resourceIDPattern = MustCompilePattern(`(?i)\bresource_?id\s*[=:]\s*\[?([^\s,\]]+)\]?`)
+	LockKeysPattern   = MustCompilePattern(`(?i)\block_?keys?\s*[=:]\s*\[?([^\s\]]+)\]?`)
+)
+
+// 提取消息中的 Seata 字段（xid、branch_id、resource_id、lock_keys）
+func SeataFields(message string) map[string]string {
+	fields := make(map[string]string)
+
+	if m := XIDPattern.FindStringSubmatch(message); m != nil {
+		fields["xid"] = m[1]
+	} else if m := BareXIDPattern.FindStringSubmatch(message); m != nil {
+		fields["xid"] = m[1]
+	}
+	if m := branchIDPattern.FindStringSubmatch(message); m != nil {
+		fields["branch_id"] = m[1]
+	}
+	if m := resourceIDPattern.FindStringSubmatch(message); m != nil {
+		fields["resource_id"] = m[1]
+	}
+	if m := LockKeysPattern.FindStringSubmatch(message); m != nil {
+		fields["lock_keys"] = m[1]
+	}
+
+	return fields
+}
+
+// 分支注册日志
+var BranchRegisterPattern = MustCompilePattern(`(?i)register(?:ed)? branch|branch ?register`)
+
+// TC 日志中发起方或分支所属的 Seata 应用，如 applicationId: order-service
+var ApplicationIDPattern = MustCompilePattern(`(?i)\bapplication_?id\s*[=:]\s*\[?([\w.\-]+)`)
+
+// raft 日志中成为 leader 的 TC 节点和任期，如 Node <default/10.0.0.1:9091> become leader of group, term=3
+var RaftLeaderPattern = MustCompilePattern(`\bNode <[^/>]*/([\w.\-]+:\d+)> become leader of group, term=(\d+)`)
+
+// Seata 事务模式
+const (
+	ModeAT   = "AT"
+	ModeTCC  = "TCC"
+	ModeSAGA = "SAGA"
+	ModeXA   = "XA"
+)
+
+// 消息中明确给出的分支类型，如 branchType=TCC、BranchType.AT
+var branchTypePattern = MustCompilePattern(`(?i)\bbranch_?type\s*(?:[=:.]|\bis\b)\s*\[?(AT|TCC|SAGA|XA)\b`)
+
+// 没有分支类型时按各模式特有的类名和关键字识别，XA、TCC、SAGA 的特征更明确，先于 AT 匹配
+var modePatterns = []struct {
+	mode    string
+	pattern *Pattern
+}{
+	{ModeXA, MustCompilePattern(`\bXA(?:Resource|Connection|Exception|Xid|DataSource)\w*|\w+ProxyXA\b|\bXA (?:START|END|PREPARE|COMMIT|ROLLBACK|RECOVER)\b|\bXA mode\b`)},
+	{ModeTCC, MustCompilePattern(`\bTCC\w*|TwoPhaseBusinessAction|BusinessActionContext|(?i:tcc_?fence)`)},
+	{ModeSAGA, MustCompilePattern(`(?i:\bsaga\b|state ?machine)`)},
+	{ModeAT, MustCompilePattern(`\bAT mode\b|(?i:undo_?\s?log)|SQLUndo\w*|(?i:global lock)|LockConflictException|\b(?:ConnectionProxy|DataSourceProxy)\b|(?i:\block_?keys?\s*[=:])`)},
+}
+
+// 识别消息所属的事务模式，无法识别时返回空串
+func ClassifyMode(message string) string {
+	if m := branchTypePattern.FindStringSubmatch(message); m != nil {
+		return strings.ToUpper(m[1])
+	}
+	for _, p := range modePatterns {
+		if p.pattern.MatchString(message) {
+			return p.mode
+		}
+	}
+	return ""
+}
+
+// 标准化事务模式，不是 AT、TCC、SAGA、XA 之一时返回空串
+func NormalizeMode(mode string) string {
+	switch mode = strings.ToUpper(strings.TrimSpace(mode)); mode {
+	case ModeAT, ModeTCC, ModeSAGA, ModeXA:
+		return mode
+	}
+	return ""
+}
+
+// 统计中没有识别出事务模式的键
+const ModeUnknown = "unknown"
+
+// 按事务模式统计时使用的键，未识别的模式记为 unknown
+func ModeKey(mode string) string {
+	if mode == "" {
+		return ModeUnknown
+	}
+	return mode
+}
+
+// 写入时标记事务模式的自定义字段，可按 field.seata_mode=TCC 或 mode=TCC 过滤
+const ModeField = "seata_mode"
+
+// 日志的事务模式：优先使用写入时的标记，标记之前写入的日志从消息中识别
+func EntryMode(entry model.LogData) string {
+	if v, ok := entry.Fields[ModeField]; ok {
+		return v
+	}
+	return ClassifyMode(entry.LogMessage)
+}
+
+// 写入前标记事务模式：上传时提供的 seata_mode 统一为大写，未提供或无法识别时从消息中识别，
+// 识别不出则不标记
+func TagMode(entry *model.LogData) {
+	mode := NormalizeMode(entry.Fields[ModeField])
+	delete(entry.Fields, ModeField)
+	if mode == "" {
+		mode = ClassifyMode(entry.LogMessage)
+	}
+	if mode == "" {
+		return
+	}
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]string)
+	}
+	entry.Fields[ModeField] = mode
+}
+
+// Seata TC 默认的 logback 布局：
+//
+//	%d{HH:mm:ss.SSS} %5p --- [%25.25t] [%30.30logger{30}] [%20.20method] [%X{X-TX-XID}] [%X{X-TX-BRANCH-ID}]: %m
+//
+// 日期部分、方法名与 MDC 字段在不同版本中可能缺省
+var seataLinePattern = regexp.MustCompile(
+	`^(?:(\d{4}-\d{2}-\d{2})[ T])?(\d{2}:\d{2}:\d{2}[.,]\d{3})\s+(TRACE|DEBUG|INFO|WARN|ERROR|FATAL)\s+(?:\d+\s+)?---\s+` +
+		`\[([^\]]*)\]\s*\[([^\]]*)\]\s*(?:\[([^\]]*)\]\s*)?(?:\[([^\]]*)\]\s*)?(?:\[([^\]]*)\]\s*)?:\s?(.*)$`)
+
+// 按 Seata TC 布局解析一行日志。只有时分秒的时间戳以 day 补全日期
+func ParseSeataLine(applicationID, line string, day time.Time) (model.LogData, bool) {
+	m := seataLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return model.LogData{}, false
+	}
+
+	entry := model.LogData{
+		ApplicationID: applicationID,
+		LogLevel:      m[3],
+		Timestamp:     strings.Replace(m[2], ",", ".", 1),
+		Thread:        strings.TrimSpace(m[4]),
+		Logger:        strings.TrimSpace(m[5]),
+		XID:           strings.TrimSpace(m[7]),
+		BranchID:      strings.TrimSpace(m[8]),
+		LogMessage:    m[9],
+	}
+	switch {
+	case m[1] != "":
+		entry.Timestamp = m[1] + " " + entry.Timestamp
+	case !day.IsZero():
+		entry.Timestamp = day.Format("2006-01-02") + " " + entry.Timestamp
+	}
+
+	// MDC 中没有 XID 时尝试从消息中提取
+	if entry.XID == "" || entry.BranchID == "" {
+		fields := SeataFields(entry.LogMessage)
+		if entry.XID == "" {
+			entry.XID = fields["xid"]
+		}
+		if entry.BranchID == "" {
+			entry.BranchID = fields["branch_id"]
+		}
+	}
+	return entry, true
+}
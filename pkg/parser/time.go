@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strconv"
+	"time"
+)
+
+// 日志中常见的时间戳格式
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05,000",
+	"2006-01-02 15:04:05",
+}
+
+// 只包含时分秒的格式（Seata 默认的 logback 配置），日期取自日志文件
+var clockLayouts = []string{
+	"15:04:05.000",
+	"15:04:05",
+}
+
+// 解析日志时间戳，day 为日志所在文件的日期，用于补全只有时分秒的时间戳
+func ParseTime(ts string, day time.Time) (time.Time, bool) {
+	if t, ok := parseEpochTime(ts); ok {
+		return t, true
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, ts, time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	if day.IsZero() {
+		return time.Time{}, false
+	}
+	for _, layout := range clockLayouts {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(),
+				t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), day.Location()), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// 解析 Unix 时间戳：13 位为毫秒，10 位为秒
+func parseEpochTime(ts string) (time.Time, bool) {
+	if len(ts) != 13 && len(ts) != 10 {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	if len(ts) == 13 {
+		return time.UnixMilli(n), true
+	}
+	return time.Unix(n, 0), true
+}
@@ -0,0 +1,199 @@
+// Package plugin 是日志分析服务的扩展接口：第三方代码在 init 中调用 Register 登记插件，
+// 订阅写入、查询和告警事件，或提供在 /analysis/findings 中运行的分析器（如自定义的 Seata 失败模式检测），
+// 无需修改服务的处理函数。插件与服务编译在一起，在服务的 main 包中以空白导入引入插件所在的包即可：
+//
+//	import _ "example.com/seata-detectors"
+//
+// 事件在插件各自的队列中异步送达，处理慢的插件丢弃事件而不阻塞写入和查询；回调中的 panic 被捕获并计数。
+// 本包中的类型是稳定的，与服务内部的结构无关
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 插件，Name 在全部插件中唯一，用于配置、指标和分析器名称
+type Plugin interface {
+	Name() string
+}
+
+// 需要初始化的插件：服务启动时以配置中 plugins.config.<name> 的内容调用，返回错误时服务不启动
+type Initializer interface {
+	Init(config json.RawMessage, host Host) error
+}
+
+// 订阅写入事件：每条日志写入存储后调用
+type IngestHook interface {
+	OnIngest(ctx context.Context, ev IngestEvent)
+}
+
+// 订阅查询事件：每个查询接口的请求完成后调用
+type QueryHook interface {
+	OnQuery(ctx context.Context, ev QueryEvent)
+}
+
+// 订阅告警事件：告警规则、探针、异常检测等触发告警后调用
+type AlertHook interface {
+	OnAlert(ctx context.Context, ev AlertEvent)
+}
+
+// 提供分析器：/analysis/findings 每次运行时创建一个新的分析器，逐条传入范围内的日志
+type AnalyzerProvider interface {
+	NewAnalyzer() Analyzer
+}
+
+// 需要停止的插件：服务停机时调用，此后不再送达事件
+type Closer interface {
+	Close() error
+}
+
+// 分析器，Findings 在全部日志传入后调用一次
+type Analyzer interface {
+	Observe(entry Entry, at time.Time)
+	Findings() []Finding
+}
+
+// 服务提供给插件的能力
+type Host interface {
+	// 触发一条告警，推送到 plugins.webhook，并与其他告警一样出现在告警记录和事件流中；rule 会加上 plugin:<name>/ 前缀
+	Alert(a Alert)
+	// 写入服务日志，带有插件名前缀
+	Logf(format string, args ...any)
+}
+
+// 一条日志，与 /upload 的 JSON 结构一致
+type Entry struct {
+	Tenant        string            `json:"tenant,omitempty"`
+	ApplicationID string            `json:"application_id"`
+	ID            int64             `json:"id"`
+	Seq           int64             `json:"seq"`
+	LogLevel      string            `json:"log_level"`
+	Timestamp     string            `json:"timestamp"`
+	LogMessage    string            `json:"log_message"`
+	Logger        string            `json:"logger,omitempty"`
+	Thread        string            `json:"thread,omitempty"`
+	XID           string            `json:"xid,omitempty"`
+	BranchID      string            `json:"branch_id,omitempty"`
+	TraceID       string            `json:"trace_id,omitempty"`
+	SpanID        string            `json:"span_id,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`
+
+	// 日志在存储中的位置，分析器收到的日志带有该字段，放入 Finding.Evidence 时原样保留
+	Ref *Ref `json:"ref,omitempty"`
+}
+
+// 日志在存储中的位置
+type Ref struct {
+	ApplicationID string `json:"application_id"`
+	File          string `json:"file"`
+	Offset        int64  `json:"offset"`
+}
+
+// 写入事件
+type IngestEvent struct {
+	Entry      Entry     `json:"entry"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// 查询事件
+type QueryEvent struct {
+	Route          string              `json:"route"` // 路由模板，如 /query、/tenants/:tenant/query
+	Tenant         string              `json:"tenant,omitempty"`
+	User           string              `json:"user,omitempty"`
+	ApplicationIDs []string            `json:"application_ids,omitempty"` // 请求中的 application_id
+	Params         map[string][]string `json:"params,omitempty"`
+	Status         int                 `json:"status"`
+	Count          int                 `json:"count"` // 返回的日志条数，处理函数未登记时为 0
+	Duration       time.Duration       `json:"duration"`
+	At             time.Time           `json:"at"`
+}
+
+// 告警事件
+type AlertEvent struct {
+	Rule          string    `json:"rule"`
+	ApplicationID string    `json:"application_id"`
+	GroupKey      string    `json:"group_key,omitempty"`
+	Value         int       `json:"value"`
+	Threshold     int       `json:"threshold"`
+	Message       string    `json:"message,omitempty"`
+	FiredAt       time.Time `json:"fired_at"`
+	Sample        *Entry    `json:"sample,omitempty"`
+}
+
+// 插件触发的告警
+type Alert struct {
+	Rule          string
+	ApplicationID string
+	GroupKey      string
+	Value         int
+	Threshold     int
+	Message       string
+	Sample        *Entry
+}
+
+// 发现的严重程度
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityError    = "error"
+	SeverityCritical = "critical"
+)
+
+// 分析器输出的发现，Code 建议以插件名为前缀，如 ACME-SEATA-001
+type Finding struct {
+	Code      string
+	Severity  string
+	Title     string
+	Message   string
+	Entities  []Entity
+	Evidence  []Entry // 支撑该发现的日志，只保留带有 Ref 的前 5 条
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// 受影响的对象，如 application、xid、resource
+type Entity struct {
+	Type string
+	ID   string
+}
+
+var (
+	mu      sync.Mutex
+	plugins = make(map[string]Plugin)
+)
+
+// 登记插件，通常在插件包的 init 中调用；名称为空或重复时 panic
+func Register(p Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+	name := p.Name()
+	if name == "" {
+		panic("plugin: Register with empty name")
+	}
+	if _, dup := plugins[name]; dup {
+		panic(fmt.Sprintf("plugin: Register called twice for %q", name))
+	}
+	plugins[name] = p
+}
+
+// 已登记的插件，按名称排序
+func Registered() []Plugin {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]Plugin, len(names))
+	for i, name := range names {
+		list[i] = plugins[name]
+	}
+	return list
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"logAnalysis/pkg/client"
+	"logAnalysis/pkg/parser"
+)
+
+// 采集代理配置
+type AgentConfig struct {
+	Server         string       `json:"server"`          // 服务地址，如 http://log-service:8080
+	Inputs         []AgentInput `json:"inputs"`          // 采集的文件
+	CheckpointFile string       `json:"checkpoint_file"` // 读取进度的保存位置
+	PollInterval   Duration     `json:"poll_interval"`   // 检查文件变化的间隔
+	BatchSize      int          `json:"batch_size"`      // 每次上传的最大条数
+	APIKey         string       `json:"api_key"`         // 服务端启用访问控制或租户认证时使用的 API Key
+
+	TLS ClientTLSConfig `json:"tls"` // 通过 HTTPS 上传时的 CA 和客户端证书
+
+	Spool AgentSpoolConfig `json:"spool"` // 服务端不可达时缓冲日志的磁盘目录
+}
+
+// 一组采集文件
+type AgentInput struct {
+	Paths         []string `json:"paths"` // glob 模式，如 /opt/seata/logs/*.log
+	ApplicationID string   `json:"application_id"`
+
+	Fields map[string]string `json:"fields"` // 附加到每条日志的字段，如 pod、service
+}
+
+// 单个文件的读取进度
+type fileCheckpoint struct {
+	Offset int64  `json:"offset"`
+	Inode  uint64 `json:"inode"`
+}
+
+// 采集代理
+type agent struct {
+	config      AgentConfig
+	client      *client.Client
+	checkpoints map[string]fileCheckpoint
+	spool       *agentSpool
+	spooling    bool // 上一批因服务端不可达写入了缓冲
+}
+
+// agent 子命令入口
+func runAgent(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	configPath := fs.String("config", "agent.json", "path to the agent JSON config file")
+	fs.Parse(args)
+
+	config := AgentConfig{
+		CheckpointFile: "agent-checkpoints.json",
+		PollInterval:   Duration(time.Second),
+		BatchSize:      200,
+	}
+	if err := loadJSONFile(*configPath, &config); err != nil {
+		log.Fatalf("Unable to load agent config: %v", err)
+	}
+	if config.Server == "" || len(config.Inputs) == 0 {
+		log.Fatalf("Agent config requires server and at least one input")
+	}
+
+	httpClient, err := newTLSHTTPClient(config.TLS, 30*time.Second)
+	if err != nil {
+		log.Fatalf("Unable to load agent TLS config: %v", err)
+	}
+	options := []client.Option{client.WithRetries(5), client.WithHTTPClient(httpClient)}
+	if config.APIKey != "" {
+		options = append(options, client.WithHeader("X-API-Key", config.APIKey))
+	}
+	a := &agent{
+		config:      config,
+		client:      client.New(config.Server, options...),
+		checkpoints: make(map[string]fileCheckpoint),
+	}
+	if err := loadJSONFile(config.CheckpointFile, &a.checkpoints); err != nil {
+		log.Fatalf("Unable to load checkpoints: %v", err)
+	}
+	if a.spool, err = openAgentSpool(config.Spool); err != nil {
+		log.Fatalf("Unable to open spool: %v", err)
+	}
+	defer a.spool.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Agent shipping to %s", config.Server)
+	ticker := time.NewTicker(time.Duration(config.PollInterval))
+	defer ticker.Stop()
+	for {
+		a.pollOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Printf("Agent stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 先重放缓冲中的日志，再检查所有匹配的文件并发送新增内容
+func (a *agent) pollOnce(ctx context.Context) {
+	a.drainSpool(ctx)
+	for _, input := range a.config.Inputs {
+		for _, pattern := range input.Paths {
+			paths, err := filepath.Glob(pattern)
+			if err != nil {
+				log.Printf("Invalid glob %q: %v", pattern, err)
+				continue
+			}
+			for _, path := range paths {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := a.shipFile(ctx, path, input); err != nil {
+					log.Printf("Unable to ship %s: %v", path, err)
+				}
+			}
+		}
+	}
+}
+
+// 从上次的位置读取文件新增的完整行并上传，上传成功后保存进度
+func (a *agent) shipFile(ctx context.Context, path string, input AgentInput) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	inode := fileInode(info)
+	cp := a.checkpoints[path]
+	// 文件被轮转（inode 变化）或被截断时从头读取
+	if cp.Inode != inode || info.Size() < cp.Offset {
+		cp = fileCheckpoint{Inode: inode}
+	}
+	if info.Size() == cp.Offset {
+		return nil
+	}
+	if _, err := file.Seek(cp.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	offset := cp.Offset
+	var batch []client.LogEntry
+	var pending *client.LogEntry // 可能还有后续堆栈行的最后一条
+	pendingEnd := offset
+
+	flush := func(end int64) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := a.send(ctx, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		a.checkpoints[path] = fileCheckpoint{Offset: end, Inode: inode}
+		return saveJSONFile(a.config.CheckpointFile, a.checkpoints)
+	}
+
+	now := time.Now()
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// 末尾未写完的行留到下次读取
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+
+		if pending != nil && parser.IsContinuation(line) {
+			pending.LogMessage += "\n" + line
+			pendingEnd = offset
+			continue
+		}
+		if pending != nil {
+			batch = append(batch, *pending)
+			if len(batch) >= a.config.BatchSize {
+				if err := flush(pendingEnd); err != nil {
+					return err
+				}
+			}
+			pending = nil
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entry := parser.ParseLine(input.ApplicationID, line, now)
+		pending = &client.LogEntry{
+			ApplicationID: entry.ApplicationID,
+			LogLevel:      entry.LogLevel,
+			Timestamp:     entry.Timestamp,
+			LogMessage:    entry.LogMessage,
+			Logger:        entry.Logger,
+			Thread:        entry.Thread,
+			XID:           entry.XID,
+			BranchID:      entry.BranchID,
+			Fields:        input.Fields,
+		}
+		pendingEnd = offset
+	}
+
+	// 最后一条日志可能还有未写入的堆栈行，但下次轮询时已无法合并，直接发送
+	if pending != nil {
+		batch = append(batch, *pending)
+	}
+	return flush(pendingEnd)
+}
+
+// 上传一批日志：缓冲为空时直接上传，服务端不可达时写入缓冲；缓冲中有积压时排在其后，保证顺序。
+// 写入缓冲即视为发送成功，读取进度随之推进
+func (a *agent) send(ctx context.Context, entries []client.LogEntry) error {
+	key, err := client.NewIdempotencyKey()
+	if err != nil {
+		return err
+	}
+	b := spoolBatch{Key: key, Entries: entries}
+	if a.spool.Empty() {
+		err := a.upload(ctx, b)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if !a.spooling {
+			log.Printf("Server unreachable, spooling entries to %s: %v", a.spool.path, err)
+			a.spooling = true
+		}
+	}
+	if err := a.spool.Append(b); err != nil {
+		if errors.Is(err, errSpoolFull) {
+			return fmt.Errorf("%w (%d bytes pending), pausing reads until the server is reachable", err, a.spool.Pending())
+		}
+		return err
+	}
+	return nil
+}
+
+// 按 Idempotency-Key 上传一批日志，服务端拒绝的批次记录日志后丢弃，否则会一直阻塞后面的日志。
+// 服务端逐条校验，被拒绝的日志中可以重试的（如写入暂停、配额用尽）以新的键追加到缓冲，其余记录日志后丢弃
+func (a *agent) upload(ctx context.Context, b spoolBatch) error {
+	result, err := a.client.UploadBatchPartial(ctx, b.Key, b.Entries)
+	if err != nil && spoolRejected(err) {
+		log.Printf("Server rejected a batch of %d entries, dropping it: %v", len(b.Entries), err)
+		return nil
+	}
+	if err != nil || result.Rejected == 0 {
+		return err
+	}
+	retry := result.Retryable(b.Entries)
+	for _, r := range result.Results {
+		if r.Status == client.EntryRejected && !r.Retryable {
+			log.Printf("Server rejected entry %d of a batch (%s), dropping it: %s", r.Index, r.Reason, r.Error)
+		}
+	}
+	if len(retry) == 0 {
+		return nil
+	}
+	key, err := client.NewIdempotencyKey()
+	if err != nil {
+		return err
+	}
+	log.Printf("Server rejected %d entries of a batch temporarily, spooling them for retry", len(retry))
+	return a.spool.Append(spoolBatch{Key: key, Entries: retry})
+}
+
+// 重放缓冲中的日志，服务端仍不可达时留到下次轮询
+func (a *agent) drainSpool(ctx context.Context) {
+	if a.spool.Empty() {
+		return
+	}
+	sent, err := a.spool.Drain(ctx, func(b spoolBatch) error { return a.upload(ctx, b) })
+	if err != nil {
+		if sent > 0 {
+			log.Printf("Replayed %d spooled batches, %d bytes still pending: %v", sent, a.spool.Pending(), err)
+		}
+		return
+	}
+	if !a.spool.Empty() {
+		log.Printf("Replayed %d spooled batches, %d bytes queued for retry", sent, a.spool.Pending())
+		return
+	}
+	log.Printf("Replayed %d spooled batches, spool drained", sent)
+	a.spooling = false
+}
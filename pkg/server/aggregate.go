@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 补零时最多生成的分桶数
+const maxBuckets = 10000
+
+// 单个分桶的统计结果
+type aggregateBucket struct {
+	Start  time.Time      `json:"start"`
+	End    time.Time      `json:"end"`
+	Count  int            `json:"count"`
+	Groups map[string]int `json:"groups,omitempty"`
+}
+
+// 分组依据字段的取值
+func groupValue(entry LogData, groupBy string) string {
+	switch groupBy {
+	case "log_level":
+		return entry.LogLevel
+	case "application_id":
+		return entry.ApplicationID
+	case tcNodeField:
+		node, _ := logFieldValue(entry, tcNodeField)
+		return node
+	}
+	return ""
+}
+
+// 解析时区参数，默认使用服务器时区
+func parseLocation(c *gin.Context) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// 按时间分桶统计接口：分桶按 tz 指定的时区对齐到日历边界，fill=zero 时对空分桶补零
+func (s *Service) aggregateHandler(c *gin.Context) {
+	applicationID := c.Query("application_id")
+	view := c.Query("view")
+	if applicationID == "" && view == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id or view is required"})
+		return
+	}
+
+	loc, err := parseLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tz"})
+		return
+	}
+	b, err := newBucketer(c.DefaultQuery("interval", "1h"), loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	groupBy := c.Query("group_by")
+	if groupBy != "" && groupBy != "log_level" && groupBy != "application_id" && groupBy != tcNodeField {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be log_level, application_id or tc_node"})
+		return
+	}
+	fill := c.DefaultQuery("fill", "zero")
+	if fill != "zero" && fill != "none" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fill must be zero or none"})
+		return
+	}
+
+	var from, to time.Time
+	if v := c.Query("from"); v != "" {
+		if from, err = parseTimeParam(v, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = parseTimeParam(v, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if rejectTenantView(c, view) {
+		return
+	}
+	storeID := applicationID
+	if view == "" {
+		var ok bool
+		if storeID, ok = s.queriedApplicationID(c, applicationID); !ok {
+			return
+		}
+	}
+
+	buckets := make(map[time.Time]*aggregateBucket)
+	var first, last time.Time
+	matched := 0
+	q := logQuery{ApplicationID: storeID, LogLevel: c.Query("log_level"), View: view, Fields: parseFieldFilters(c), ctx: c.Request.Context()}
+	err = s.runLogQuery(q, func(entry LogData, ref logRef) bool {
+		at := entryTime(entry, ref)
+		if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+			return true
+		}
+		if first.IsZero() || at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+
+		start := b.Truncate(at)
+		bucket, ok := buckets[start]
+		if !ok {
+			bucket = &aggregateBucket{Start: start, End: b.Next(start)}
+			buckets[start] = bucket
+		}
+		bucket.Count++
+		matched++
+		if groupBy != "" {
+			if bucket.Groups == nil {
+				bucket.Groups = make(map[string]int)
+			}
+			bucket.Groups[groupValue(entry, groupBy)]++
+		}
+		return true
+	})
+	if errors.Is(err, errViewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+		return
+	}
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	result := make([]aggregateBucket, 0, len(buckets))
+	if fill == "zero" && (len(buckets) > 0 || (!from.IsZero() && !to.IsZero())) {
+		if from.IsZero() {
+			from = first
+		}
+		if to.IsZero() {
+			to = last
+		}
+		starts, err := b.Range(from, to, maxBuckets)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, start := range starts {
+			if bucket, ok := buckets[start]; ok {
+				result = append(result, *bucket)
+			} else {
+				result = append(result, aggregateBucket{Start: start, End: b.Next(start)})
+			}
+		}
+	} else {
+		for _, bucket := range buckets {
+			result = append(result, *bucket)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	}
+
+	auditCount(c, matched)
+	c.JSON(http.StatusOK, gin.H{
+		"application_id": applicationID,
+		"interval":       c.DefaultQuery("interval", "1h"),
+		"tz":             loc.String(),
+		"buckets":        result,
+	})
+}
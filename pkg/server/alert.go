@@ -0,0 +1,675 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/parser"
+)
+
+// 告警规则中的单个条件，field 可以是日志字段，也可以是从 Seata 消息中提取的字段
+type AlertCondition struct {
+	Field string `json:"field"` // application_id、log_level、log_message、xid、branch_id、resource_id、lock_keys
+	Op    string `json:"op"`    // eq、ne、contains、not_contains、regex、exists
+	Value string `json:"value"`
+
+	re *regexp.Regexp
+}
+
+// 告警规则：所有条件同时满足的日志在时间窗口内按 group_by 分组计数，
+// 设置 distinct 时统计窗口内不同取值的个数，超过 threshold 即触发
+type AlertRule struct {
+	Name          string           `json:"name" binding:"required"`
+	ApplicationID string           `json:"application_id"` // 为空表示所有应用，@系统 或 @系统:环境 表示分组中的应用
+	Conditions    []AlertCondition `json:"conditions"`
+	GroupBy       string           `json:"group_by"`
+	Distinct      string           `json:"distinct"`
+	Threshold     int              `json:"threshold"`
+	Window        string           `json:"window"`   // 如 2m
+	Cooldown      string           `json:"cooldown"` // 同一分组两次告警的最小间隔，默认等于 window
+	Webhook       string           `json:"webhook"`  // 推送 JSON 告警事件的地址，等同于一个 webhook 渠道
+	Channels      []NotifierConfig `json:"channels"` // 通知渠道：slack、dingtalk、wecom、email、webhook
+	Enabled       bool             `json:"enabled"`  // 只能通过启用/停用接口修改，保存规则时忽略
+
+	window    time.Duration
+	cooldown  time.Duration
+	notifiers []Notifier
+}
+
+// 告警事件
+type AlertEvent struct {
+	Rule          string    `json:"rule"`
+	ApplicationID string    `json:"application_id"`
+	GroupKey      string    `json:"group_key,omitempty"`
+	Value         int       `json:"value"`
+	Threshold     int       `json:"threshold"`
+	LogTime       time.Time `json:"log_time"`
+	FiredAt       time.Time `json:"fired_at"`
+	Message       string    `json:"message,omitempty"` // 默认语言的说明
+	Sample        LogData   `json:"sample"`
+
+	text i18n.Text // 说明的英文原文，推送到渠道时按渠道的语言生成
+}
+
+// 按语言生成说明，没有英文原文（如探针的错误信息）时使用 Message
+func (ev AlertEvent) localizedMessage(lang string) string {
+	if ev.text.IsZero() {
+		return ev.Message
+	}
+	return ev.text.In(lang)
+}
+
+// 校验规则并预编译正则、解析时间窗口，未配置 language 的渠道使用 defaultLang
+func (r *AlertRule) compile(defaultLang string) error {
+	if r.Name == "" {
+		return fmt.Errorf("rule name is required")
+	}
+	if len(r.Conditions) == 0 {
+		return fmt.Errorf("rule %s has no conditions", r.Name)
+	}
+	// 分组在匹配时才解析，先于分组登记的规则同样可以加载
+	if _, _, ok := parseGroupReference(r.ApplicationID); isGroupReference(r.ApplicationID) && !ok {
+		return fmt.Errorf("invalid group reference %q", r.ApplicationID)
+	}
+
+	for i := range r.Conditions {
+		cond := &r.Conditions[i]
+		switch cond.Op {
+		case "eq", "ne", "contains", "not_contains", "exists":
+		case "regex":
+			re, err := regexp.Compile(cond.Value)
+			if err != nil {
+				return fmt.Errorf("invalid regex in condition %d: %v", i, err)
+			}
+			cond.re = re
+		default:
+			return fmt.Errorf("unsupported operator %q in condition %d", cond.Op, i)
+		}
+	}
+
+	window := r.Window
+	if window == "" {
+		window = "1m"
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid window %q", r.Window)
+	}
+	r.window = d
+
+	r.cooldown = r.window
+	if r.Cooldown != "" {
+		d, err := time.ParseDuration(r.Cooldown)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid cooldown %q", r.Cooldown)
+		}
+		r.cooldown = d
+	}
+
+	notifiers, err := newNotifiers(r.Channels, defaultLang)
+	if err != nil {
+		return err
+	}
+	// 早先保存的规则只有 webhook，不做地址校验以免无法加载
+	if r.Webhook != "" {
+		notifiers = append([]Notifier{&webhookNotifier{url: r.Webhook}}, notifiers...)
+	}
+	r.notifiers = notifiers
+	return nil
+}
+
+// 返回给接口的规则，不含渠道密钥和 SMTP 密码
+func (r *AlertRule) redacted() AlertRule {
+	rule := *r
+	rule.Channels = make([]NotifierConfig, len(r.Channels))
+	for i, c := range r.Channels {
+		rule.Channels[i] = c.redacted()
+	}
+	return rule
+}
+
+// 判断单条日志是否满足全部条件，应用组按 groups 展开
+func (r *AlertRule) matches(groups *groupRegistry, fields map[string]string) bool {
+	if isGroupReference(r.ApplicationID) {
+		if !groups.Match(r.ApplicationID, fields["application_id"]) {
+			return false
+		}
+	} else if r.ApplicationID != "" && fields["application_id"] != r.ApplicationID {
+		return false
+	}
+
+	for _, cond := range r.Conditions {
+		value, ok := fields[cond.Field]
+		switch cond.Op {
+		case "eq":
+			if !strings.EqualFold(value, cond.Value) {
+				return false
+			}
+		case "ne":
+			if strings.EqualFold(value, cond.Value) {
+				return false
+			}
+		case "contains":
+			if !strings.Contains(value, cond.Value) {
+				return false
+			}
+		case "not_contains":
+			if strings.Contains(value, cond.Value) {
+				return false
+			}
+		case "regex":
+			if !cond.re.MatchString(value) {
+				return false
+			}
+		case "exists":
+			if !ok || value == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 日志的可匹配字段：基础字段加上从消息中提取的 Seata 字段
+func alertFields(entry LogData) map[string]string {
+	fields := parser.SeataFields(entry.LogMessage)
+	fields["application_id"] = entry.ApplicationID
+	fields["log_level"] = entry.LogLevel
+	fields["log_message"] = entry.LogMessage
+	fields["timestamp"] = entry.Timestamp
+	for k, v := range entry.Fields {
+		fields[fieldParamPrefix+k] = v
+	}
+	return fields
+}
+
+// 窗口内的一次命中
+type alertHit struct {
+	at       time.Time
+	distinct string
+}
+
+// 单条规则的滑动窗口状态
+type ruleState struct {
+	rule      *AlertRule
+	hits      map[string][]alertHit
+	lastFired map[string]time.Time
+	swept     time.Time // 上次清理过期分组的日志时间
+}
+
+func newRuleState(rule *AlertRule) *ruleState {
+	return &ruleState{
+		rule:      rule,
+		hits:      make(map[string][]alertHit),
+		lastFired: make(map[string]time.Time),
+	}
+}
+
+// 将一条日志计入规则状态，满足触发条件时返回告警事件
+func (s *ruleState) observe(groups *groupRegistry, entry LogData, fields map[string]string, at time.Time) *AlertEvent {
+	rule := s.rule
+	if !rule.matches(groups, fields) {
+		return nil
+	}
+
+	groupKey := ""
+	if rule.GroupBy != "" {
+		groupKey = fields[rule.GroupBy]
+		if groupKey == "" {
+			return nil
+		}
+	}
+	distinct := ""
+	if rule.Distinct != "" {
+		distinct = fields[rule.Distinct]
+		if distinct == "" {
+			return nil
+		}
+	}
+
+	// 丢弃窗口之外的命中
+	hits := append(s.hits[groupKey], alertHit{at: at, distinct: distinct})
+	cutoff := at.Add(-rule.window)
+	kept := hits[:0]
+	for _, h := range hits {
+		if h.at.After(cutoff) {
+			kept = append(kept, h)
+		}
+	}
+	s.hits[groupKey] = kept
+	// 分组键（如 XID）的取值不断变化，每过一个窗口清理一次不再有命中的分组
+	if at.Sub(s.swept) >= rule.window {
+		s.expire(at)
+		s.swept = at
+	}
+
+	value := len(kept)
+	if rule.Distinct != "" {
+		seen := make(map[string]struct{})
+		for _, h := range kept {
+			seen[h.distinct] = struct{}{}
+		}
+		value = len(seen)
+	}
+	if value <= rule.Threshold {
+		return nil
+	}
+
+	if last, ok := s.lastFired[groupKey]; ok && at.Sub(last) < rule.cooldown {
+		return nil
+	}
+	s.lastFired[groupKey] = at
+
+	return &AlertEvent{
+		Rule:          rule.Name,
+		ApplicationID: entry.ApplicationID,
+		GroupKey:      groupKey,
+		Value:         value,
+		Threshold:     rule.Threshold,
+		LogTime:       at,
+		Sample:        entry,
+	}
+}
+
+// 删除窗口内已没有命中的分组和冷却期已过的触发时间，之后再出现的命中与新分组相同
+func (s *ruleState) expire(at time.Time) {
+	cutoff := at.Add(-s.rule.window)
+	for key, hits := range s.hits {
+		kept := hits[:0]
+		for _, h := range hits {
+			if h.at.After(cutoff) {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.hits, key)
+		} else {
+			s.hits[key] = kept
+		}
+	}
+	for key, last := range s.lastFired {
+		if at.Sub(last) >= s.rule.cooldown {
+			delete(s.lastFired, key)
+		}
+	}
+}
+
+// 告警引擎，保存规则及其运行状态
+type AlertEngine struct {
+	svc    *Service
+	mu     sync.Mutex
+	path   string
+	rules  map[string]*ruleState
+	events []AlertEvent
+
+	deliveries sync.WaitGroup // 进行中的 webhook 推送
+}
+
+// 最多保留的告警事件数量
+const maxAlertEvents = 1000
+
+// 创建告警引擎并从数据目录加载已保存的规则
+func (s *Service) newAlertEngine(dataDir string) (*AlertEngine, error) {
+	e := &AlertEngine{
+		svc:   s,
+		path:  filepath.Join(dataDir, "alert_rules.json"),
+		rules: make(map[string]*ruleState),
+	}
+
+	var rules []*AlertRule
+	if err := loadJSONFile(e.path, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := rule.compile(s.defaultLanguage()); err != nil {
+			return nil, err
+		}
+		e.rules[rule.Name] = newRuleState(rule)
+	}
+	return e, nil
+}
+
+// 持久化规则，调用方需持有锁
+func (e *AlertEngine) saveLocked() error {
+	rules := make([]*AlertRule, 0, len(e.rules))
+	for _, s := range e.rules {
+		rules = append(rules, s.rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return saveJSONFile(e.path, rules)
+}
+
+// 添加或替换规则，状态会被重置。新规则不启用，需回测后通过 SetEnabled 启用；替换的规则保留原来的启用状态
+func (e *AlertEngine) PutRule(rule *AlertRule) error {
+	if err := rule.compile(e.svc.defaultLanguage()); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rule.Enabled = false
+	if old, ok := e.rules[rule.Name]; ok {
+		rule.Enabled = old.rule.Enabled
+	}
+	e.rules[rule.Name] = newRuleState(rule)
+	return e.saveLocked()
+}
+
+// 删除规则
+func (e *AlertEngine) DeleteRule(name string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.rules[name]; !ok {
+		return false, nil
+	}
+	delete(e.rules, name)
+	return true, e.saveLocked()
+}
+
+// 启用或停用规则
+func (e *AlertEngine) SetEnabled(name string, enabled bool) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.rules[name]
+	if !ok {
+		return false, nil
+	}
+	s.rule.Enabled = enabled
+	return true, e.saveLocked()
+}
+
+// 列出所有规则
+func (e *AlertEngine) Rules() []*AlertRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := make([]*AlertRule, 0, len(e.rules))
+	for _, s := range e.rules {
+		rules = append(rules, s.rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// 最近的告警事件，按触发时间倒序
+func (e *AlertEngine) Events() []AlertEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	events := make([]AlertEvent, len(e.events))
+	for i, ev := range e.events {
+		events[len(e.events)-1-i] = ev
+	}
+	return events
+}
+
+// 处理一条新写入的日志，对所有已启用的规则求值
+func (e *AlertEngine) Observe(entry LogData) {
+	fields := alertFields(entry)
+	at, ok := parser.ParseTime(entry.Timestamp, time.Now())
+	if !ok {
+		at = time.Now()
+	}
+
+	type firedAlert struct {
+		event     AlertEvent
+		notifiers []Notifier
+	}
+	var fired []firedAlert
+	e.mu.Lock()
+	for _, s := range e.rules {
+		if !s.rule.Enabled {
+			continue
+		}
+		if ev := s.observe(e.svc.groups, entry, fields, at); ev != nil {
+			ev.FiredAt = time.Now()
+			e.recordLocked(*ev)
+			fired = append(fired, firedAlert{event: *ev, notifiers: s.rule.notifiers})
+		}
+	}
+	e.mu.Unlock()
+
+	for _, f := range fired {
+		e.deliver(f.event, f.notifiers)
+	}
+}
+
+// 触发一个不来自规则求值的告警（如探针失败），webhook 为空时只记录
+func (e *AlertEngine) Fire(ev AlertEvent, webhook string) {
+	if ev.FiredAt.IsZero() {
+		ev.FiredAt = time.Now()
+	}
+	if ev.Message == "" {
+		ev.Message = ev.text.In(e.svc.defaultLanguage())
+	}
+	e.mu.Lock()
+	e.recordLocked(ev)
+	e.mu.Unlock()
+	var notifiers []Notifier
+	if webhook != "" {
+		notifiers = append(notifiers, &webhookNotifier{url: webhook})
+	}
+	e.deliver(ev, notifiers)
+}
+
+// 保存告警事件，调用方需持有锁
+func (e *AlertEngine) recordLocked(ev AlertEvent) {
+	e.events = append(e.events, ev)
+	if len(e.events) > maxAlertEvents {
+		e.events = e.events[len(e.events)-maxAlertEvents:]
+	}
+}
+
+// 记录日志并异步推送到各渠道
+func (e *AlertEngine) deliver(ev AlertEvent, notifiers []Notifier) {
+	log.Printf("alert fired: rule=%s app=%s group=%s value=%d", ev.Rule, ev.ApplicationID, ev.GroupKey, ev.Value)
+	e.svc.systemEvents.Publish(eventAlert, ev.ApplicationID, fmt.Sprintf("Alert %s fired: %d > %d", ev.Rule, ev.Value, ev.Threshold), ev)
+	e.svc.plugins.Alert(ev)
+	for _, n := range notifiers {
+		e.deliveries.Add(1)
+		go func() {
+			defer e.deliveries.Done()
+			if err := notify(n, ev); err != nil {
+				log.Printf("alert %s notification failed: rule=%s err=%v", n.Channel(), ev.Rule, err)
+			}
+		}()
+	}
+}
+
+// 等待进行中的推送完成，停机时调用
+func (e *AlertEngine) Close() error {
+	e.deliveries.Wait()
+	return nil
+}
+
+// 回测最多读取的日志条数，超出时须缩小时间范围
+const maxBacktestLines = 1_000_000
+
+var errBacktestTooLarge = errors.New("backtest range contains too many lines")
+
+// 用 [from, to] 内的历史日志回测规则，返回规则在这段数据上会触发的告警。
+// 日志须按时间排序后求值，读取超过 maxBacktestLines 条时返回 errBacktestTooLarge
+func (s *Service) backtestRule(ctx context.Context, rule *AlertRule, applicationIDs []string, from, to time.Time) ([]AlertEvent, int, error) {
+	type timedEntry struct {
+		entry LogData
+		at    time.Time
+	}
+
+	var entries []timedEntry
+	for _, appID := range applicationIDs {
+		err := s.forEachStoredLogBetween(ctx, appID, from, to, func(entry LogData, ref logRef) bool {
+			day := logFileDate(ref.File)
+			at, ok := parser.ParseTime(entry.Timestamp, day)
+			if !ok {
+				at = day
+			}
+			if at.Before(from) || at.After(to) {
+				return true
+			}
+			if len(entries) == maxBacktestLines {
+				return false
+			}
+			entries = append(entries, timedEntry{entry: entry, at: at})
+			return true
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(entries) == maxBacktestLines {
+			return nil, 0, errBacktestTooLarge
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return timeOrderBefore(entries[i].at, entries[i].entry, entries[j].at, entries[j].entry)
+	})
+
+	state := newRuleState(rule)
+	var events []AlertEvent
+	for _, te := range entries {
+		if ev := state.observe(s.groups, te.entry, alertFields(te.entry), te.at); ev != nil {
+			ev.FiredAt = te.at
+			events = append(events, *ev)
+		}
+	}
+	return events, len(entries), nil
+}
+
+// 列出告警规则接口
+func (s *Service) alertRulesListHandler(c *gin.Context) {
+	rules := s.alertEngine.Rules()
+	list := make([]AlertRule, 0, len(rules))
+	for _, r := range rules {
+		list = append(list, r.redacted())
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": list})
+}
+
+// 创建或更新告警规则接口，新规则不启用，需回测后通过启用接口启用
+func (s *Service) alertRulePutHandler(c *gin.Context) {
+	var rule AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if err := s.alertEngine.PutRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Alert rule saved", "rule": rule.redacted()})
+}
+
+// 删除告警规则接口
+func (s *Service) alertRuleDeleteHandler(c *gin.Context) {
+	ok, err := s.alertEngine.DeleteRule(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save alert rules"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Alert rule deleted"})
+}
+
+// 启用/停用告警规则接口
+func (s *Service) alertRuleEnableHandler(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, err := s.alertEngine.SetEnabled(c.Param("name"), enabled)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save alert rules"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "enabled": enabled})
+	}
+}
+
+// 回测请求
+type alertTestRequest struct {
+	Rule           AlertRule `json:"rule"`
+	ApplicationIDs []string  `json:"application_ids" binding:"required"`
+	From           string    `json:"from" binding:"required"`
+	To             string    `json:"to" binding:"required"`
+}
+
+// 告警规则回测接口
+func (s *Service) alertRuleTestHandler(c *gin.Context) {
+	var req alertTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if err := req.Rule.compile(s.defaultLanguage()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 与查询接口相同：校验应用 ID、在租户接口下加上租户前缀并检查权限
+	apps := make([]string, 0, len(req.ApplicationIDs))
+	for _, appID := range req.ApplicationIDs {
+		appID, ok := scopedApplicationID(c, appID)
+		if !ok {
+			return
+		}
+		apps = append(apps, appID)
+	}
+
+	from, ok := parser.ParseTime(req.From, time.Time{})
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time"})
+		return
+	}
+	to, ok := parser.ParseTime(req.To, time.Time{})
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time"})
+		return
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+
+	events, scanned, err := s.backtestRule(c.Request.Context(), &req.Rule, apps, from, to)
+	if errors.Is(err, errBacktestTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The time range contains more than %d lines; narrow from and to", maxBacktestLines)})
+		return
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read application logs"})
+		return
+	}
+	if events == nil {
+		events = []AlertEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule":          req.Rule.Name,
+		"scanned_lines": scanned,
+		"would_fire":    len(events),
+		"events":        events,
+	})
+}
+
+// 告警事件查询接口
+func (s *Service) alertEventsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"events": s.alertEngine.Events()})
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 同一资源在窗口内出现在 3 个以上不同 XID 的锁冲突中时触发
+func lockConflictRule() *AlertRule {
+	return &AlertRule{
+		Name:       "lock-conflict",
+		Conditions: []AlertCondition{{Field: "log_level", Op: "eq", Value: "error"}, {Field: "log_message", Op: "contains", Value: "LockConflict"}},
+		GroupBy:    "resource_id",
+		Distinct:   "xid",
+		Threshold:  3,
+		Window:     "2m",
+		Cooldown:   "10m",
+	}
+}
+
+func lockConflictEntry(xid int, resource string, at time.Time) LogData {
+	return testEntry("orders", "ERROR", fmt.Sprintf("LockConflict xid=10.0.0.1:8091:%d resourceId=%s", 100000+xid, resource), at)
+}
+
+func TestAlertRuleCompile(t *testing.T) {
+	rule := lockConflictRule()
+	if err := rule.compile("en"); err != nil {
+		t.Fatal(err)
+	}
+	if rule.window != 2*time.Minute || rule.cooldown != 10*time.Minute {
+		t.Fatalf("window %v, cooldown %v, want 2m and 10m", rule.window, rule.cooldown)
+	}
+	defaults := &AlertRule{Name: "errors", Conditions: []AlertCondition{{Field: "log_level", Op: "eq", Value: "ERROR"}}}
+	if err := defaults.compile("en"); err != nil {
+		t.Fatal(err)
+	}
+	if defaults.window != time.Minute || defaults.cooldown != time.Minute {
+		t.Fatalf("default window %v, cooldown %v, want 1m for both", defaults.window, defaults.cooldown)
+	}
+
+	for name, rule := range map[string]AlertRule{
+		"no conditions":  {Name: "r"},
+		"bad operator":   {Name: "r", Conditions: []AlertCondition{{Field: "xid", Op: "like"}}},
+		"bad regex":      {Name: "r", Conditions: []AlertCondition{{Field: "xid", Op: "regex", Value: "("}}},
+		"bad window":     {Name: "r", Conditions: []AlertCondition{{Field: "xid", Op: "exists"}}, Window: "0s"},
+		"bad cooldown":   {Name: "r", Conditions: []AlertCondition{{Field: "xid", Op: "exists"}}, Cooldown: "-1m"},
+		"bad group":      {Name: "r", Conditions: []AlertCondition{{Field: "xid", Op: "exists"}}, ApplicationID: "@"},
+		"missing a name": {Conditions: []AlertCondition{{Field: "xid", Op: "exists"}}},
+	} {
+		if err := rule.compile("en"); err == nil {
+			t.Errorf("%s: compile succeeded", name)
+		}
+	}
+}
+
+// 按资源分组统计不同 XID，超过阈值触发，冷却期内同一分组不再触发，其他分组不受影响
+func TestRuleStateObserveDistinctAndCooldown(t *testing.T) {
+	rule := lockConflictRule()
+	if err := rule.compile("en"); err != nil {
+		t.Fatal(err)
+	}
+	state := newRuleState(rule)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	observe := func(entry LogData, at time.Time) *AlertEvent {
+		return state.observe(nil, entry, alertFields(entry), at)
+	}
+
+	// 同一 XID 重复出现不增加取值个数
+	for i, xid := range []int{1, 2, 2, 3} {
+		if ev := observe(lockConflictEntry(xid, "orders", start.Add(time.Duration(i)*time.Second)), start.Add(time.Duration(i)*time.Second)); ev != nil {
+			t.Fatalf("fired after %d distinct XIDs: %+v", xid, ev)
+		}
+	}
+	if ev := observe(testEntry("orders", "INFO", "LockConflict xid=10.0.0.1:8091:100009 resourceId=orders", start), start.Add(5*time.Second)); ev != nil {
+		t.Fatalf("INFO entry fired: %+v", ev)
+	}
+	ev := observe(lockConflictEntry(4, "orders", start), start.Add(10*time.Second))
+	if ev == nil || ev.GroupKey != "orders" || ev.Value != 4 || ev.Threshold != 3 {
+		t.Fatalf("fourth distinct XID: %+v, want an event for orders with value 4", ev)
+	}
+	if ev := observe(lockConflictEntry(5, "orders", start), start.Add(20*time.Second)); ev != nil {
+		t.Fatalf("fired again within the cooldown: %+v", ev)
+	}
+	for i := 1; i <= 4; i++ {
+		ev = observe(lockConflictEntry(i, "stock", start), start.Add(30*time.Second))
+	}
+	if ev == nil || ev.GroupKey != "stock" {
+		t.Fatalf("other resource during the cooldown of orders: %+v, want an event for stock", ev)
+	}
+
+	// 冷却期过后窗口重新计数
+	later := start.Add(11 * time.Minute)
+	for i := 1; i <= 3; i++ {
+		if ev := observe(lockConflictEntry(i, "orders", later), later); ev != nil {
+			t.Fatalf("fired with %d XIDs in the new window: %+v", i, ev)
+		}
+	}
+	if ev := observe(lockConflictEntry(4, "orders", later), later); ev == nil {
+		t.Fatal("did not fire after the cooldown")
+	}
+}
+
+// 不再出现的分组在一个窗口后被清理，冷却期过后清理触发时间
+func TestRuleStateExpiresIdleGroups(t *testing.T) {
+	rule := lockConflictRule()
+	if err := rule.compile("en"); err != nil {
+		t.Fatal(err)
+	}
+	state := newRuleState(rule)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		entry := lockConflictEntry(i, fmt.Sprintf("table%d", i), start)
+		state.observe(nil, entry, alertFields(entry), start)
+	}
+	for i := 1; i <= 4; i++ {
+		entry := lockConflictEntry(i, "orders", start)
+		state.observe(nil, entry, alertFields(entry), start)
+	}
+	if len(state.hits) != 101 || len(state.lastFired) != 1 {
+		t.Fatalf("%d groups and %d fired, want 101 and 1", len(state.hits), len(state.lastFired))
+	}
+
+	at := start.Add(3 * time.Minute)
+	entry := lockConflictEntry(1, "stock", at)
+	state.observe(nil, entry, alertFields(entry), at)
+	if len(state.hits) != 1 || len(state.lastFired) != 1 {
+		t.Fatalf("after the window: %d groups and %d fired, want 1 and 1", len(state.hits), len(state.lastFired))
+	}
+	at = start.Add(11 * time.Minute)
+	state.observe(nil, entry, alertFields(entry), at)
+	if _, ok := state.lastFired["orders"]; ok {
+		t.Fatal("fire time kept after the cooldown")
+	}
+}
+
+// 新规则保存后不启用，启用后替换规则保留启用状态
+func TestAlertEnginePutRuleStartsDisabled(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	rule := lockConflictRule()
+	rule.Enabled = true
+	if err := s.alertEngine.PutRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Enabled {
+		t.Fatal("new rule saved enabled")
+	}
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		s.alertEngine.Observe(lockConflictEntry(i, "orders", now))
+	}
+	if events := s.alertEngine.Events(); len(events) != 0 {
+		t.Fatalf("disabled rule fired: %+v", events)
+	}
+
+	if ok, err := s.alertEngine.SetEnabled(rule.Name, true); !ok || err != nil {
+		t.Fatalf("SetEnabled: %v %v", ok, err)
+	}
+	replaced := lockConflictRule()
+	if err := s.alertEngine.PutRule(replaced); err != nil {
+		t.Fatal(err)
+	}
+	if !replaced.Enabled {
+		t.Fatal("replacing an enabled rule disabled it")
+	}
+	for i := 1; i <= 4; i++ {
+		s.alertEngine.Observe(lockConflictEntry(i, "orders", now))
+	}
+	if events := s.alertEngine.Events(); len(events) != 1 {
+		t.Fatalf("enabled rule fired %d times, want 1", len(events))
+	}
+}
+
+// 回测按时间顺序求值 [from, to] 内的日志，时间范围和应用 ID 须有效
+func TestAlertRuleBacktest(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	router := newTestRouter(t, s)
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Minute)
+	// 乱序写入，回测时排序后才在第 4 个 XID 触发
+	for _, i := range []int{4, 1, 3, 2} {
+		ingestTestEntry(t, s, lockConflictEntry(i, "orders", start.Add(time.Duration(i)*time.Second)))
+	}
+	ingestTestEntry(t, s, lockConflictEntry(9, "orders", start.Add(-time.Hour)))
+
+	test := func(req map[string]any) (int, map[string]any) {
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/alerts/rules/test", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var res map[string]any
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	from, to := start.Format(time.RFC3339), start.Add(time.Minute).Format(time.RFC3339)
+
+	code, res := test(map[string]any{"rule": lockConflictRule(), "application_ids": []string{"orders"}, "from": from, "to": to})
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, res)
+	}
+	if res["scanned_lines"] != float64(4) || res["would_fire"] != float64(1) {
+		t.Fatalf("scanned %v, would fire %v, want 4 and 1", res["scanned_lines"], res["would_fire"])
+	}
+	events := res["events"].([]any)
+	if got := events[0].(map[string]any)["log_time"]; got != start.Add(4*time.Second).Format(time.RFC3339) {
+		t.Fatalf("fired at %v, want the fourth XID", got)
+	}
+
+	for name, req := range map[string]map[string]any{
+		"no range":       {"rule": lockConflictRule(), "application_ids": []string{"orders"}},
+		"no to":          {"rule": lockConflictRule(), "application_ids": []string{"orders"}, "from": from},
+		"reversed range": {"rule": lockConflictRule(), "application_ids": []string{"orders"}, "from": to, "to": from},
+		"parent dir":     {"rule": lockConflictRule(), "application_ids": []string{".."}, "from": from, "to": to},
+		"nested path":    {"rule": lockConflictRule(), "application_ids": []string{"orders/../../etc"}, "from": from, "to": to},
+	} {
+		if code, res := test(req); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d %v, want 400", name, code, res)
+		}
+	}
+	if code, res := test(map[string]any{"rule": lockConflictRule(), "application_ids": []string{"payments"}, "from": from, "to": to}); code != http.StatusNotFound {
+		t.Errorf("unknown application: status %d %v, want 404", code, res)
+	}
+}
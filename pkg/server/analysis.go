@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/model"
+)
+
+// 内置分析器，名称 → 构造函数，阈值等参数取自配置
+func builtinAnalyzers(c Config) map[string]func() analysis.Analyzer {
+	return map[string]func() analysis.Analyzer{
+		"cluster":      func() analysis.Analyzer { return analysis.NewClusterAnalyzer() },
+		"consistency":  func() analysis.Analyzer { return analysis.NewConsistencyAnalyzer() },
+		"locks":        func() analysis.Analyzer { return analysis.NewLockConflictAnalyzer() },
+		"retry_storms": func() analysis.Analyzer { return analysis.NewRetryStormAnalyzer(c.RetryStorm.threshold()) },
+		"rollbacks":    func() analysis.Analyzer { return analysis.NewRollbackFailureAnalyzer() },
+		"transactions": func() analysis.Analyzer {
+			return analysis.NewHangingTransactionAnalyzer(time.Duration(c.TransactionHangWindow))
+		},
+	}
+}
+
+// 依次读取各应用在时间范围内的日志，交给分析器处理
+func (s *Service) runAnalyzers(ctx context.Context, applicationIDs []string, from, to time.Time, list []analysis.Analyzer) error {
+	for _, appID := range applicationIDs {
+		err := s.forEachStoredLogBetween(ctx, appID, from, to, func(entry LogData, ref logRef) bool {
+			at := entryTime(entry, ref)
+			if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+				return true
+			}
+			for _, a := range list {
+				a.Observe(entry, ref, at)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解析分析接口的公共参数：application_id（逗号分隔）、from、to
+func (s *Service) parseAnalysisScope(c *gin.Context) ([]string, time.Time, time.Time, bool) {
+	apps := splitList(c.Query("application_id"))
+	if len(apps) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id is required"})
+		return nil, time.Time{}, time.Time{}, false
+	}
+	for i, app := range apps {
+		scoped, ok := s.queriedApplicationID(c, app)
+		if !ok {
+			return nil, time.Time{}, time.Time{}, false
+		}
+		apps[i] = scoped
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return nil, from, to, false
+	}
+	return apps, from, to, true
+}
+
+// 解析以逗号分隔的 application_id 参数，为空时为全部应用，@系统 或 @系统:环境 展开为分组中的应用；
+// 只保留当前用户有权访问的应用，明确指定了无权访问的应用时返回 403
+func (s *Service) requestApplications(c *gin.Context) ([]string, bool) {
+	var apps []string
+	for _, app := range splitList(c.Query("application_id")) {
+		if isGroupReference(app) {
+			list, err := s.scopedApplications(c)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list applications"})
+				return nil, false
+			}
+			members, ok := s.groupApplications(c, app, permittedApplications(c, list))
+			if !ok {
+				return nil, false
+			}
+			for _, member := range members {
+				if !slices.Contains(apps, member) {
+					apps = append(apps, member)
+				}
+			}
+			continue
+		}
+		if !validApplicationID(app) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+			return nil, false
+		}
+		if !authorizeApplication(c, app) {
+			return nil, false
+		}
+		if s.lifecycle.Deleted(app) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found: " + app})
+			return nil, false
+		}
+		if !slices.Contains(apps, app) {
+			apps = append(apps, app)
+		}
+	}
+	if len(apps) == 0 && c.Query("application_id") == "" {
+		var err error
+		if apps, err = s.listApplications(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list applications"})
+			return nil, false
+		}
+		apps = permittedApplications(c, apps)
+	}
+	return apps, true
+}
+
+// 是否为应用 ID 的通配模式，如 order-*
+func isApplicationPattern(value string) bool {
+	return strings.ContainsAny(value, "*?[")
+}
+
+// 当前接口下的全部应用：租户接口下为该租户的应用，返回存储使用的 ID
+func (s *Service) scopedApplications(c *gin.Context) ([]string, error) {
+	if tenant := c.GetString("tenant"); tenant != "" {
+		return s.tenantApplications(tenant)
+	}
+	return s.listApplications()
+}
+
+// 解析逗号分隔的应用 ID、通配模式（如 order-*）和分组引用（如 @payments:prod），返回存储使用的 ID。
+// 通配模式只匹配当前用户有权访问的应用，明确列出的应用无权访问时返回 403
+func (s *Service) queryApplications(c *gin.Context, value string) ([]string, bool) {
+	var apps, candidates []string
+	loaded := false
+	seen := make(map[string]bool)
+	for _, item := range splitList(value) {
+		if isGroupReference(item) || isApplicationPattern(item) {
+			if !loaded {
+				list, err := s.scopedApplications(c)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list applications"})
+					return nil, false
+				}
+				candidates, loaded = permittedApplications(c, list), true
+			}
+		}
+		if isGroupReference(item) {
+			members, ok := s.groupApplications(c, item, candidates)
+			if !ok {
+				return nil, false
+			}
+			for _, app := range members {
+				if !seen[app] {
+					seen[app] = true
+					apps = append(apps, app)
+				}
+			}
+			continue
+		}
+		if !isApplicationPattern(item) {
+			app, ok := s.queriedApplicationID(c, item)
+			if !ok {
+				return nil, false
+			}
+			if !seen[app] {
+				seen[app] = true
+				apps = append(apps, app)
+			}
+			continue
+		}
+		if _, err := path.Match(item, ""); err != nil || strings.ContainsAny(item, `/\`) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id pattern"})
+			return nil, false
+		}
+		for _, app := range candidates {
+			if ok, _ := path.Match(item, model.BareApplicationID(app)); ok && !seen[app] {
+				seen[app] = true
+				apps = append(apps, app)
+			}
+		}
+	}
+	return apps, true
+}
+
+// 解析 from、to 参数，未带时区的时间按 tz 参数解释，参数非法时返回 400
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	loc, err := parseLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tz"})
+		return from, to, false
+	}
+	if v := c.Query("from"); v != "" {
+		if from, err = parseTimeParam(v, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return from, to, false
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = parseTimeParam(v, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+// 拆分逗号分隔的参数
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// map 的键按字典序排列，保证输出稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 发现查询接口：在指定应用和时间范围上运行分析器，analyzers 参数可选择部分分析器
+func (s *Service) findingsHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+
+	names := splitList(c.Query("analyzers"))
+	if len(names) == 0 {
+		names = s.analyzerNames()
+	}
+	var list []analysis.Analyzer
+	for _, name := range names {
+		newAnalyzer, ok := s.analyzers[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown analyzer: " + name})
+			return
+		}
+		list = append(list, newAnalyzer())
+	}
+
+	findings, err := s.collectFindings(c.Request.Context(), apps, from, to, list, s.requestLanguage(c))
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"application_ids": apps,
+		"analyzers":       names,
+		"findings":        findings,
+	})
+}
+
+// 已登记的分析器名称，按名称排序
+func (s *Service) analyzerNames() []string {
+	names := make([]string, 0, len(s.analyzers))
+	for name := range s.analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 运行分析器并汇总发现，以 lang 输出并排序
+func (s *Service) collectFindings(ctx context.Context, applicationIDs []string, from, to time.Time, list []analysis.Analyzer, lang string) ([]Finding, error) {
+	if err := s.runAnalyzers(ctx, applicationIDs, from, to, list); err != nil {
+		return nil, err
+	}
+	findings := []Finding{}
+	for _, a := range list {
+		for _, f := range a.Findings() {
+			findings = append(findings, f.Localized(lang))
+		}
+	}
+	analysis.SortFindings(findings)
+	return findings, nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+)
+
+// 二阶段一致性核对接口：按 XID 对比 TC 记录的二阶段结果与 RM 的分支日志，列出 RM 没有执行、
+// 执行结果相反或失败的分支。需要同时查询 TC 和 RM 的应用；RM 日志不在范围内的分支计入 unverified，
+// 在截止时间（to，默认为当前时间）之前 grace 内做出的决定计入 pending
+func (s *Service) consistencyHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	grace, err := time.ParseDuration(c.DefaultQuery("grace", "1m"))
+	if err != nil || grace < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grace"})
+		return
+	}
+	modes, ok := parseSeataModes(c)
+	if !ok {
+		return
+	}
+
+	a := analysis.NewConsistencyAnalyzer()
+	a.Modes, a.Grace, a.Horizon = modes, grace, to
+	if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{a}); err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	report := a.Report(apps)
+	auditCount(c, len(report.Inconsistencies))
+	if len(report.Inconsistencies) > limit {
+		report.Inconsistencies, report.Truncated = report.Inconsistencies[:limit], true
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+)
+
+// 锁冲突分析接口：汇总时间范围内竞争最多的表、行和全局事务
+func (s *Service) lockConflictsHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	a := analysis.NewLockConflictAnalyzer()
+	if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{a}); err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	summary := a.Summary(limit)
+	auditCount(c, summary.Conflicts)
+	c.JSON(http.StatusOK, gin.H{
+		"application_ids": apps,
+		"conflicts":       summary.Conflicts,
+		"timeouts":        summary.Timeouts,
+		"tables":          summary.Tables,
+		"rows":            summary.Rows,
+		"xids":            summary.XIDs,
+	})
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 分支二阶段重试风暴：TC 对同一分支反复重试提交或回滚（如资源不可用、回滚遇到脏数据），
+// 每次重试都写日志，持续下去会把磁盘写满。写入时按分支在时间窗口内计数，超过阈值时告警
+type RetryStormConfig struct {
+	Enabled   bool     `json:"enabled"`   // 写入时检测并告警，/analysis/retry-storms 不受此开关影响
+	Threshold int      `json:"threshold"` // 窗口内同一分支的重试次数达到该值时视为重试风暴，默认 10
+	Window    Duration `json:"window"`    // 计数的时间窗口，默认 10m；同一分支每个窗口最多告警一次
+	Webhook   string   `json:"webhook"`
+}
+
+const defaultRetryStormThreshold = 10
+
+// 告警事件中的规则名
+const retryStormRuleName = "retry_storm"
+
+// 写入时最多跟踪的分支数，超过时清理窗口外的分支
+const maxRetryStormBranches = 10000
+
+var retryStormAlerts = metrics.counter("retry_storm_alerts_total", "Branch retry storms detected on ingest, by phase.")
+
+func (c RetryStormConfig) threshold() int {
+	if c.Threshold > 0 {
+		return c.Threshold
+	}
+	return defaultRetryStormThreshold
+}
+
+// 重试风暴分析接口：列出重试次数达到 threshold 的分支及其资源，默认阈值为 retry_storm.threshold
+func (s *Service) retryStormsHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	a := analysis.NewRetryStormAnalyzer(s.cfg.RetryStorm.threshold())
+	if v := c.Query("threshold"); v != "" {
+		if a.Threshold, err = strconv.Atoi(v); err != nil || a.Threshold <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid threshold"})
+			return
+		}
+	}
+	if a.Modes, ok = parseSeataModes(c); !ok {
+		return
+	}
+	if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{a}); err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	storms := a.Storms()
+	resources := analysis.RetryStormResources(storms)
+	truncated := len(storms) > limit
+	if truncated {
+		storms = storms[:limit]
+	}
+	if len(resources) > limit {
+		resources = resources[:limit]
+	}
+	auditCount(c, len(storms))
+	c.JSON(http.StatusOK, gin.H{
+		"application_ids": apps,
+		"threshold":       a.Threshold,
+		"retries":         a.Retries(),
+		"storms":          storms,
+		"resources":       resources,
+		"truncated":       truncated,
+	})
+}
+
+// 写入时的重试风暴检测
+type retryStormDetector struct {
+	svc    *Service
+	config RetryStormConfig
+
+	mu       sync.Mutex
+	branches map[string]*retryWindow // 应用/XID/分支 → 窗口内的重试
+}
+
+type retryWindow struct {
+	times     []time.Time
+	lastFired time.Time
+}
+
+// 按配置创建检测器，未启用时返回 nil
+func (s *Service) newRetryStormDetector(c RetryStormConfig) *retryStormDetector {
+	if !c.Enabled {
+		return nil
+	}
+	c.Threshold = c.threshold()
+	if c.Window <= 0 {
+		c.Window = Duration(10 * time.Minute)
+	}
+	return &retryStormDetector{svc: s, config: c, branches: make(map[string]*retryWindow)}
+}
+
+// 处理一条新写入的日志
+func (d *retryStormDetector) Observe(entry LogData) {
+	if d == nil {
+		return
+	}
+	phase, branchID := analysis.ClassifyBranchRetry(entry)
+	xid := analysis.EntryXID(entry)
+	if phase == "" || xid == "" {
+		return
+	}
+	at, ok := parser.ParseTime(entry.Timestamp, time.Now())
+	if !ok {
+		at = time.Now()
+	}
+	window := time.Duration(d.config.Window)
+
+	d.mu.Lock()
+	if len(d.branches) >= maxRetryStormBranches {
+		for key, w := range d.branches {
+			if at.Sub(w.times[len(w.times)-1]) > window {
+				delete(d.branches, key)
+			}
+		}
+	}
+	key := entry.ApplicationID + "\x00" + xid + "\x00" + branchID
+	w, ok := d.branches[key]
+	if !ok {
+		w = &retryWindow{}
+		d.branches[key] = w
+	}
+	w.times = append(w.times, at)
+	start := 0
+	for start < len(w.times) && at.Sub(w.times[start]) > window {
+		start++
+	}
+	w.times = w.times[start:]
+	count := len(w.times)
+	fire := count >= d.config.Threshold && at.Sub(w.lastFired) >= window
+	if fire {
+		w.lastFired = at
+	}
+	d.mu.Unlock()
+
+	if !fire {
+		return
+	}
+	retryStormAlerts.Add(1, "phase", phase)
+	resource := parser.SeataFields(entry.LogMessage)["resource_id"]
+	message := i18n.Textf("Branch %s of %s retried %s %d times within %s", branchID, xid, i18n.Textf(phase), count, window)
+	if resource != "" {
+		message = i18n.Textf("Branch %s of %s retried %s %d times within %s on %s", branchID, xid, i18n.Textf(phase), count, window, resource)
+	}
+	d.svc.alertEngine.Fire(AlertEvent{
+		Rule:          retryStormRuleName,
+		ApplicationID: model.BareApplicationID(entry.ApplicationID),
+		GroupKey:      strings.Trim(xid+"/"+branchID, "/"),
+		Value:         count,
+		Threshold:     d.config.Threshold,
+		LogTime:       at,
+		text:          message,
+		Sample:        entry,
+	}, d.config.Webhook)
+}
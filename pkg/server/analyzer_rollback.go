@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+)
+
+// 回滚失败分析接口：按资源和 XID 列出回滚失败，needs_repair 标记需要 DBA 人工修复的事务，
+// modes 为按 Seata 事务模式统计的失败次数，可用 mode 只看指定的模式
+func (s *Service) rollbackFailuresHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	modes, ok := parseSeataModes(c)
+	if !ok {
+		return
+	}
+
+	a := analysis.NewRollbackFailureAnalyzer()
+	a.Modes = modes
+	if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{a}); err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	total := a.Failures()
+	resources, xids := a.Summary(limit)
+	auditCount(c, total)
+	c.JSON(http.StatusOK, gin.H{
+		"application_ids": apps,
+		"failures":        total,
+		"modes":           a.ModeCounts(),
+		"resources":       resources,
+		"xids":            xids,
+	})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+)
+
+// 事务超时根因接口：列出因超时回滚的全局事务，给出超时前最后的分支活动及其后的静默时长、最慢的分支，
+// 以及疑似拖住事务的服务；services 为按疑似服务统计的超时次数
+func (s *Service) transactionTimeoutsHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	modes, ok := parseSeataModes(c)
+	if !ok {
+		return
+	}
+
+	// 第一遍推断事务状态，第二遍只收集超时事务的日志
+	tracker := analysis.NewTransactionTracker()
+	if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{tracker}); err != nil {
+		readFailed(c, err)
+		return
+	}
+	timedOut := make(map[string]analysis.TransactionSummary)
+	for _, tx := range tracker.Summaries(time.Now(), time.Duration(s.cfg.TransactionHangWindow)) {
+		if tx.Status == analysis.StatusTimedOut && (len(modes) == 0 || modes[tx.Mode]) {
+			timedOut[tx.XID] = tx
+		}
+	}
+	a := analysis.NewTimeoutAnalyzer(timedOut, func(entry *LogData) { maskEntry(s.queryMaskRules, entry) })
+	if len(timedOut) > 0 {
+		if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{a}); err != nil {
+			readFailed(c, err)
+			return
+		}
+	}
+
+	lang := s.requestLanguage(c)
+	services := make(map[string]int)
+	reports := make([]analysis.TransactionTimeout, 0, len(timedOut))
+	for _, xid := range sortedKeys(timedOut) {
+		r := a.Report(timedOut[xid])
+		r.Summary = analysis.TimeoutSummary(r, lang)
+		services[r.SuspectService]++
+		reports = append(reports, r)
+	}
+	// 最近超时的在前
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].TimeoutAt.After(reports[j].TimeoutAt) })
+	truncated := len(reports) > limit
+	if truncated {
+		reports = reports[:limit]
+	}
+
+	auditCount(c, len(timedOut))
+	c.JSON(http.StatusOK, gin.H{
+		"application_ids": apps,
+		"timeouts":        len(timedOut),
+		"services":        services,
+		"transactions":    reports,
+		"truncated":       truncated,
+	})
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 事件注记：排障和复盘时记下的说明和事故单号，关联到一段时间或一个 XID，
+// 之后查询到这段时间或这个事务的日志时随结果一并返回
+type Annotation struct {
+	ID            string    `json:"id"`
+	ApplicationID string    `json:"application_id,omitempty"` // 为空时适用于全部应用
+	XID           string    `json:"xid,omitempty"`
+	From          time.Time `json:"from"` // 与 XID 至少指定一项；只有 from 时为一个时间点
+	To            time.Time `json:"to"`
+	Text          string    `json:"text" binding:"required"`
+	IncidentID    string    `json:"incident_id,omitempty"`
+	Author        string    `json:"author,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// 注记是否与一段时间重叠，from、to 为零值时不限制该端
+func (a *Annotation) overlaps(from, to time.Time) bool {
+	if a.From.IsZero() {
+		return false
+	}
+	return (to.IsZero() || !a.From.After(to)) && (from.IsZero() || !a.To.Before(from))
+}
+
+// 已保存的注记
+type annotationStore struct {
+	mu          sync.RWMutex
+	annotations map[string]*Annotation
+	path        string
+}
+
+func newAnnotationStore(dataDir string) (*annotationStore, error) {
+	s := &annotationStore{annotations: make(map[string]*Annotation), path: filepath.Join(dataDir, "annotations.json")}
+	if err := loadJSONFile(s.path, &s.annotations); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 保存注记，ID 相同时替换
+func (s *annotationStore) Put(a *Annotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.annotations[a.ID] = a
+	return saveJSONFile(s.path, s.annotations)
+}
+
+func (s *annotationStore) Get(id string) (Annotation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.annotations[id]
+	if !ok {
+		return Annotation{}, false
+	}
+	return *a, true
+}
+
+func (s *annotationStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.annotations[id]; !ok {
+		return false, nil
+	}
+	delete(s.annotations, id)
+	return true, saveJSONFile(s.path, s.annotations)
+}
+
+// 按开始时间（只关联 XID 的按创建时间）排序返回满足 fn 的注记
+func (s *annotationStore) Filter(fn func(a *Annotation) bool) []Annotation {
+	s.mu.RLock()
+	list := make([]Annotation, 0)
+	for _, a := range s.annotations {
+		if fn(a) {
+			list = append(list, *a)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].From, list[j].From
+		if ti.IsZero() {
+			ti = list[i].CreatedAt
+		}
+		if tj.IsZero() {
+			tj = list[j].CreatedAt
+		}
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// 查询结果附带的注记：属于这些应用（或全部应用）、时间与 from～to 重叠，或关联的 XID 出现在结果中
+func (s *annotationStore) ForResults(applicationIDs []string, from, to time.Time, hits []QueryHit) []Annotation {
+	if s == nil {
+		return []Annotation{}
+	}
+	apps := make(map[string]bool, len(applicationIDs))
+	for _, app := range applicationIDs {
+		apps[app] = true
+	}
+	return s.Filter(func(a *Annotation) bool {
+		if a.ApplicationID != "" && !apps[a.ApplicationID] {
+			return false
+		}
+		if a.XID != "" {
+			for i := range hits {
+				if entryHasXID(hits[i].Entry, a.XID) {
+					return true
+				}
+			}
+		}
+		return a.overlaps(from, to)
+	})
+}
+
+// 事务时间线附带的注记：属于涉及的应用（或全部应用），关联该 XID 或与事务的时间重叠
+func (s *annotationStore) ForTimeline(t TransactionTimeline) []Annotation {
+	if s == nil {
+		return []Annotation{}
+	}
+	apps := make(map[string]bool, len(t.ApplicationIDs))
+	for _, app := range t.ApplicationIDs {
+		apps[app] = true
+	}
+	return s.Filter(func(a *Annotation) bool {
+		if a.ApplicationID != "" && !apps[a.ApplicationID] {
+			return false
+		}
+		if a.XID != "" {
+			return a.XID == t.XID
+		}
+		return a.overlaps(t.FirstSeen, t.LastSeen)
+	})
+}
+
+// 日志查询附带的注记，查询未指定 from、to 时按结果中日志的时间范围选取
+func (s *Service) queryAnnotations(q logQuery, hits []QueryHit) []Annotation {
+	apps := q.ApplicationIDs
+	if len(apps) == 0 {
+		apps = []string{q.ApplicationID}
+	}
+	from, to := q.From, q.To
+	if from.IsZero() && to.IsZero() {
+		if len(hits) == 0 {
+			return []Annotation{}
+		}
+		from, to = hitsTimeRange(hits)
+	}
+	return s.annotations.ForResults(apps, from, to, hits)
+}
+
+// 查询结果中日志的时间范围
+func hitsTimeRange(hits []QueryHit) (time.Time, time.Time) {
+	var first, last time.Time
+	for i := range hits {
+		at := entryTime(hits[i].Entry, hits[i].Ref)
+		if first.IsZero() || at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	return first, last
+}
+
+func newAnnotationID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 当前用户能否查看注记：全部应用的注记所有人可见
+func annotationVisible(c *gin.Context, a *Annotation) bool {
+	user := currentUser(c)
+	return user == nil || a.ApplicationID == "" || user.Allowed(permRead, a.ApplicationID)
+}
+
+// 注记列表接口，可按 application_id、xid、incident_id 和时间范围筛选
+func (s *Service) annotationListHandler(c *gin.Context) {
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+	apps := make(map[string]bool)
+	for _, app := range splitList(c.Query("application_id")) {
+		apps[app] = true
+	}
+	xid, incident := c.Query("xid"), c.Query("incident_id")
+	list := s.annotations.Filter(func(a *Annotation) bool {
+		if !annotationVisible(c, a) {
+			return false
+		}
+		if len(apps) > 0 && a.ApplicationID != "" && !apps[a.ApplicationID] {
+			return false
+		}
+		if (xid != "" && a.XID != xid) || (incident != "" && a.IncidentID != incident) {
+			return false
+		}
+		return (from.IsZero() && to.IsZero()) || a.overlaps(from, to)
+	})
+	c.JSON(http.StatusOK, gin.H{"annotations": list})
+}
+
+// 创建注记接口。ID、作者和创建时间由接收请求的节点生成，随广播的请求体同步到其他节点
+func (s *Service) annotationCreateHandler(c *gin.Context) {
+	var a Annotation
+	if err := c.ShouldBindJSON(&a); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	a.XID = strings.TrimSpace(a.XID)
+	if a.XID == "" && a.From.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "xid or from is required"})
+		return
+	}
+	if a.To.IsZero() {
+		a.To = a.From
+	}
+	if a.To.Before(a.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	if a.ApplicationID != "" {
+		if !validApplicationID(a.ApplicationID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+			return
+		}
+		if !authorizeApplication(c, a.ApplicationID) {
+			return
+		}
+	} else if user := currentUser(c); user != nil && !user.AllowedEverywhere(permRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "application_id is required"})
+		return
+	}
+
+	if !c.GetBool("cluster.forwarded") || a.ID == "" {
+		id, err := newAnnotationID()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to generate annotation ID"})
+			return
+		}
+		a.ID = id
+		a.Author = userName(currentUser(c))
+		a.CreatedAt = time.Now().UTC()
+		clusterBroadcastBody(c, a)
+	}
+	if err := s.annotations.Put(&a); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save annotations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Annotation saved", "annotation": a})
+}
+
+// 删除注记接口，只有作者和管理员可以删除
+func (s *Service) annotationDeleteHandler(c *gin.Context) {
+	a, ok := s.annotations.Get(c.Param("id"))
+	if !ok || !annotationVisible(c, &a) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Annotation not found"})
+		return
+	}
+	if user := currentUser(c); user != nil && user.Name != a.Author && !user.AllowedEverywhere(permAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author or an admin can delete an annotation"})
+		return
+	}
+	if _, err := s.annotations.Delete(a.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save annotations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Annotation deleted"})
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+)
+
+// 错误量异常检测配置：按应用学习每小时错误量的基线，最近一小时的错误量显著高于基线时
+// 通过告警 webhook 推送，不需要为每个应用手工设置阈值
+type AnomalyConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Applications []string `json:"applications"`  // 检测的应用（租户应用为 租户/应用），为空时为全部非租户应用
+	Levels       []string `json:"levels"`        // 计为错误的级别，默认 ERROR
+	BaselineDays int      `json:"baseline_days"` // 学习基线使用的历史天数，默认 14
+	Sensitivity  float64  `json:"sensitivity"`   // 超出基线均值多少个标准差视为异常，默认 3
+	MinCount     int      `json:"min_count"`     // 最近一小时错误数低于该值时不告警，默认 10
+	Interval     Duration `json:"interval"`      // 检测间隔，默认 5m
+	Webhook      string   `json:"webhook"`
+}
+
+// 至少有这么多小时的历史才开始检测
+const anomalyMinHistoryHours = 24
+
+// 同一时段（一天中的同一小时）的样本达到这么多时只与同一时段比较，以排除日内的周期变化
+const anomalySeasonalSamples = 7
+
+// 告警事件中的规则名
+const anomalyRuleName = "anomaly:error_rate"
+
+// 单个应用最近一次检测的结果
+type anomalyStatus struct {
+	ApplicationID string    `json:"application_id"`
+	Count         int       `json:"count"`      // 最近一小时的错误数
+	Mean          float64   `json:"mean"`       // 基线每小时的平均错误数
+	StdDev        float64   `json:"stddev"`     // 基线的标准差，不小于泊松分布的标准差
+	Threshold     float64   `json:"threshold"`  // 本次触发告警所需的错误数
+	Score         float64   `json:"score"`      // 高于均值的标准差个数
+	Samples       int       `json:"samples"`    // 参与基线的小时数
+	Seasonal      bool      `json:"seasonal"`   // 基线是否只取一天中的同一小时
+	Learning      bool      `json:"learning"`   // 历史不足，暂不检测
+	Anomalous     bool      `json:"anomalous"`  // 本次检测判定为异常
+	LastFired     time.Time `json:"last_fired"` // 最近一次告警的时间
+	EvaluatedAt   time.Time `json:"evaluated_at"`
+}
+
+// 错误量异常检测器
+type anomalyDetector struct {
+	svc    *Service
+	config AnomalyConfig
+
+	mu     sync.Mutex
+	status map[string]*anomalyStatus
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+var anomalyAlerts = metrics.counter("anomaly_alerts_total", "Error-rate anomalies detected, by application.")
+
+// 按配置创建检测器，未启用时返回 nil
+func (s *Service) newAnomalyDetector(c AnomalyConfig) *anomalyDetector {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Levels) == 0 {
+		c.Levels = []string{"ERROR"}
+	}
+	for i, level := range c.Levels {
+		c.Levels[i] = strings.ToUpper(level)
+	}
+	if c.BaselineDays <= 0 {
+		c.BaselineDays = 14
+	}
+	if c.Sensitivity <= 0 {
+		c.Sensitivity = 3
+	}
+	if c.MinCount <= 0 {
+		c.MinCount = 10
+	}
+	if c.Interval <= 0 {
+		c.Interval = Duration(5 * time.Minute)
+	}
+	return &anomalyDetector{svc: s, config: c, status: make(map[string]*anomalyStatus), stop: make(chan struct{})}
+}
+
+// 启动定期检测
+func (d *anomalyDetector) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(time.Duration(d.config.Interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.runOnce(time.Now())
+			}
+		}
+	}()
+}
+
+// 停止检测
+func (d *anomalyDetector) Close() error {
+	close(d.stop)
+	d.wg.Wait()
+	return nil
+}
+
+// 检测的应用，集群中每个应用只由其归属节点检测，避免重复告警
+func (d *anomalyDetector) applications() ([]string, error) {
+	apps := d.config.Applications
+	if len(apps) == 0 {
+		var err error
+		if apps, err = d.svc.listApplications(); err != nil {
+			return nil, err
+		}
+	}
+	if d.svc.cluster == nil {
+		return apps, nil
+	}
+	owned := make([]string, 0, len(apps))
+	for _, app := range apps {
+		if d.svc.cluster.Owner(app) == d.svc.cluster.self {
+			owned = append(owned, app)
+		}
+	}
+	return owned, nil
+}
+
+// 对所有应用执行一次检测
+func (d *anomalyDetector) runOnce(now time.Time) {
+	apps, err := d.applications()
+	if err != nil {
+		log.Printf("anomaly detection: unable to list applications: %v", err)
+		return
+	}
+	for _, app := range apps {
+		hours, err := d.hourlyCounts(app, now)
+		if err != nil {
+			continue
+		}
+		d.evaluate(app, hours, now)
+	}
+}
+
+// 从计数索引中读取以 now 为终点的逐小时错误数，hours[0] 为最近一小时，
+// 只包含应用最早一条日志之后的完整小时
+func (d *anomalyDetector) hourlyCounts(applicationID string, now time.Time) ([]int, error) {
+	horizon := d.config.BaselineDays*24 + 1
+	nowMinute := now.Unix() / 60
+	counts := make([]int, horizon)
+	earliest := int64(math.MaxInt64)
+	err := d.svc.histogramCounts.View(applicationID, now, func(segments map[string]*segmentCounts) {
+		since := now.Add(-time.Duration(horizon) * time.Hour)
+		for name, seg := range segments {
+			if !segmentInRange(name, nil, since, time.Time{}) {
+				continue
+			}
+			for minute, byLevel := range seg.Minutes {
+				if minute < earliest {
+					earliest = minute
+				}
+				if minute > nowMinute {
+					continue
+				}
+				k := int((nowMinute - minute) / 60)
+				if k >= horizon {
+					continue
+				}
+				for _, level := range d.config.Levels {
+					counts[k] += byLevel[level]
+				}
+			}
+		}
+	})
+	if err != nil || earliest == math.MaxInt64 {
+		return nil, err
+	}
+	if covered := int((nowMinute-earliest)/60) + 1; covered < horizon {
+		counts = counts[:covered]
+	}
+	return counts, nil
+}
+
+// 根据逐小时错误数判断最近一小时是否异常，异常且不在冷却期内时推送告警
+func (d *anomalyDetector) evaluate(applicationID string, hours []int, now time.Time) {
+	st := anomalyStatus{ApplicationID: applicationID, Count: hours[0], EvaluatedAt: now}
+	baseline := hours[1:]
+	if len(baseline) < anomalyMinHistoryHours {
+		st.Learning = true
+	} else {
+		var seasonal []int
+		for k := 24; k < len(hours); k += 24 {
+			seasonal = append(seasonal, hours[k])
+		}
+		if len(seasonal) >= anomalySeasonalSamples {
+			baseline, st.Seasonal = seasonal, true
+		}
+		st.Samples = len(baseline)
+		st.Mean, st.StdDev = meanStdDev(baseline)
+		// 错误数较少时样本方差不可靠，以泊松分布的标准差为下限
+		st.StdDev = math.Max(st.StdDev, math.Max(math.Sqrt(st.Mean), 1))
+		st.Threshold = math.Max(st.Mean+d.config.Sensitivity*st.StdDev, float64(d.config.MinCount))
+		st.Score = (float64(st.Count) - st.Mean) / st.StdDev
+		st.Anomalous = float64(st.Count) >= st.Threshold
+	}
+
+	d.mu.Lock()
+	if prev, ok := d.status[applicationID]; ok {
+		st.LastFired = prev.LastFired
+	}
+	// 同一应用一小时内只告警一次
+	fire := st.Anomalous && now.Sub(st.LastFired) >= time.Hour
+	if fire {
+		st.LastFired = now
+	}
+	d.status[applicationID] = &st
+	d.mu.Unlock()
+
+	if !fire {
+		return
+	}
+	anomalyAlerts.Add(1, "application_id", applicationID)
+	d.svc.alertEngine.Fire(AlertEvent{
+		Rule:          anomalyRuleName,
+		ApplicationID: model.BareApplicationID(applicationID),
+		GroupKey:      strings.Join(d.config.Levels, ","),
+		Value:         st.Count,
+		Threshold:     int(math.Ceil(st.Threshold)),
+		LogTime:       now.Add(-time.Hour),
+		FiredAt:       now,
+		text: i18n.Textf("%d %s logs in the last hour, %.1f standard deviations above the baseline of %.1f per hour",
+			st.Count, strings.Join(d.config.Levels, "/"), st.Score, st.Mean),
+	}, d.config.Webhook)
+}
+
+func meanStdDev(values []int) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (float64(v) - mean) * (float64(v) - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
+
+// 各应用最近一次检测的结果
+func (d *anomalyDetector) Statuses() []anomalyStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]anomalyStatus, 0, len(d.status))
+	for _, st := range d.status {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 异常检测状态接口
+func (s *Service) anomalyStatusHandler(c *gin.Context) {
+	if s.anomalies == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false, "applications": []anomalyStatus{}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "applications": s.anomalies.Statuses()})
+}
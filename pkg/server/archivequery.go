@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// 查询归档分段：分层后只保留在对象存储中的旧分段，/query 默认不读取，避免一次宽泛的查询从对象存储取回大量数据。
+// include_archive=true 时透明地包含这些分段：先按上传时记录的时间范围跳过整段，
+// 未压缩的对象按块索引以范围请求只读取时间范围内的块，压缩的对象和旧版本上传的分段整段取回到本地缓存
+type archiveScan struct {
+	Include    bool  `json:"include"`
+	Skipped    int   `json:"skipped"`     // 未指定 include_archive=true 而跳过的分段
+	Pruned     int   `json:"pruned"`      // 按记录的时间范围跳过、没有读取的分段
+	Ranged     int   `json:"ranged"`      // 按块索引只读取了部分内容的分段
+	Fetched    int   `json:"fetched"`     // 整段读取的分段，已在本地缓存中时不访问对象存储
+	RangeBytes int64 `json:"range_bytes"` // 范围请求读取的字节数
+}
+
+// 是否读取归档分段，nil 时与其他读取一样透明地读取
+func (a *archiveScan) includes() bool {
+	return a == nil || a.Include
+}
+
+// 是否有需要随结果返回的情况
+func (a *archiveScan) used() bool {
+	return a != nil && (a.Include || a.Skipped > 0)
+}
+
+// 记录一个分段的处理，nil 时不记录
+func (a *archiveScan) skipped() {
+	if a != nil {
+		a.Skipped++
+	}
+}
+
+func (a *archiveScan) pruned() {
+	if a != nil {
+		a.Pruned++
+	}
+}
+
+func (a *archiveScan) ranged(bytes int64) {
+	if a != nil {
+		a.Ranged++
+		a.RangeBytes += bytes
+	}
+}
+
+func (a *archiveScan) fetched() {
+	if a != nil {
+		a.Fetched++
+	}
+}
+
+// 分段只剩对象存储中的副本时返回其占位文件内容
+func archivedSegment(path string) (*tieredSegment, bool) {
+	if !segmentOnlyTiered(path) {
+		return nil, false
+	}
+	for _, p := range append([]string{path}, compressedPaths(path)...) {
+		if stub, err := readTieredSegment(p + tieredSuffix); err == nil {
+			return &stub, true
+		}
+	}
+	return nil, true
+}
+
+// 分段可能包含 [from, to] 内的日志，没有记录时间范围时视为可能
+func (s *tieredSegment) inRange(from, to time.Time) bool {
+	if s.From == nil || s.To == nil {
+		return true
+	}
+	return (from.IsZero() || !s.To.Before(from)) && (to.IsZero() || !s.From.After(to))
+}
+
+// 需要读取的块：从 start 之后、可能包含 [from, to] 内日志的块。
+// 没有块索引或没有时间范围时返回 nil，整段读取
+func (s *tieredSegment) blocksBetween(from, to time.Time, start int64) []tieredBlock {
+	if len(s.Blocks) == 0 || (from.IsZero() && to.IsZero()) {
+		return nil
+	}
+	blocks := []tieredBlock{}
+	for _, b := range s.Blocks {
+		if b.Offset+b.Size <= start || b.First.IsZero() {
+			continue
+		}
+		if (!from.IsZero() && b.Last.Before(from)) || (!to.IsZero() && b.First.After(to)) {
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// 以范围请求读取选出的块，相邻的块合并为一次请求，从 start 偏移开始逐行回调，偏移与整段读取时相同。
+// 返回是否被 fn 中止和读取的字节数
+func (s *Service) scanTieredBlocks(ctx context.Context, path string, stub tieredSegment, blocks []tieredBlock, start int64, fn func(line string, offset, next int64) bool) (bool, int64, error) {
+	var read int64
+	for i := 0; i < len(blocks); {
+		offset, end := max(blocks[i].Offset, start), blocks[i].Offset+blocks[i].Size
+		for i++; i < len(blocks) && blocks[i].Offset == end; i++ {
+			end += blocks[i].Size
+		}
+		stop, err := s.scanTieredRange(ctx, path, stub, offset, end, fn)
+		read += end - offset
+		if err != nil || stop {
+			return stop, read, err
+		}
+	}
+	return false, read, nil
+}
+
+func (s *Service) scanTieredRange(ctx context.Context, path string, stub tieredSegment, offset, end int64, fn func(line string, offset, next int64) bool) (bool, error) {
+	rc, err := s.tiering.openRange(stub, offset, end-offset)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	reader := lineReaders.Get().(*bufio.Reader)
+	reader.Reset(rc)
+	defer func() {
+		reader.Reset(nil)
+		lineReaders.Put(reader)
+	}()
+	for n := 1; ; n++ {
+		if n%cancelCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+		}
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			lineOffset := offset
+			offset += int64(len(line))
+			if !fn(s.encryption.Open(path, strings.TrimRight(line, "\r\n")), lineOffset, offset) {
+				return true, nil
+			}
+		}
+		if err == io.EOF {
+			if offset < end {
+				return false, io.ErrUnexpectedEOF
+			}
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
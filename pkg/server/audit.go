@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 一条审计记录
+type AuditRecord struct {
+	Time       time.Time           `json:"time"`
+	Method     string              `json:"method"`
+	Route      string              `json:"route"` // 路由模板，如 /tenants/:tenant/query
+	Path       string              `json:"path"`
+	Params     map[string][]string `json:"params,omitempty"` // 查询参数和路径参数
+	Tenant     string              `json:"tenant,omitempty"`
+	User       string              `json:"user,omitempty"`        // 启用访问控制时识别出的用户
+	APIKey     string              `json:"api_key,omitempty"`     // API Key 的指纹，不记录原文
+	ClientCert string              `json:"client_cert,omitempty"` // 双向 TLS 客户端证书的主体名称
+	RemoteAddr string              `json:"remote_addr"`
+	UserAgent  string              `json:"user_agent,omitempty"`
+	Status     int                 `json:"status"`
+	Count      *int                `json:"count,omitempty"` // 写入或返回的日志条数
+	DurationMs int64               `json:"duration_ms"`
+}
+
+// 不记录审计的路由：文档、网页面板和监控抓取
+var auditSkipRoutes = map[string]bool{
+	"/":                  true,
+	"/ui/*filepath":      true,
+	"/docs":              true,
+	"/docs/openapi.json": true,
+	"/metrics":           true,
+}
+
+// 审计记录写入器：按天写入 data_dir/audit/2006-01-02.log，后台批量落盘，不阻塞请求
+type auditLog struct {
+	dir     string
+	records chan AuditRecord
+	done    chan struct{}
+
+	mu sync.Mutex // 保护文件写入，查询时读取已落盘的记录
+}
+
+var auditDropped = metrics.counter("audit_dropped_total", "Audit records dropped because the write queue was full.")
+
+func newAuditLog(dataDir string) (*auditLog, error) {
+	dir := filepath.Join(dataDir, "audit")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	a := &auditLog{dir: dir, records: make(chan AuditRecord, 4096), done: make(chan struct{})}
+	go a.run()
+	return a, nil
+}
+
+func (a *auditLog) run() {
+	defer close(a.done)
+	for rec := range a.records {
+		a.write(a.drain([]AuditRecord{rec}))
+	}
+}
+
+// 合并队列中已有的记录一起写入
+func (a *auditLog) drain(batch []AuditRecord) []AuditRecord {
+	for len(batch) < 256 {
+		select {
+		case more, ok := <-a.records:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, more)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (a *auditLog) write(batch []AuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var data []byte
+	for _, rec := range batch {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			continue
+		}
+		data = append(append(data, line...), '\n')
+	}
+	path := filepath.Join(a.dir, batch[0].Time.Format("2006-01-02")+".log")
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Unable to write audit log: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		log.Printf("Unable to write audit log: %v", err)
+	}
+}
+
+// 记录一条审计，队列满时丢弃并计数
+func (a *auditLog) Record(rec AuditRecord) {
+	select {
+	case a.records <- rec:
+	default:
+		auditDropped.Add(1)
+	}
+}
+
+// 停机时写完队列中的记录
+func (a *auditLog) Close() error {
+	close(a.records)
+	<-a.done
+	return nil
+}
+
+// 按条件读取审计记录，最新的在前
+func (a *auditLog) Search(from, to time.Time, match func(AuditRecord) bool, limit int) ([]AuditRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var result []AuditRecord
+	first := from.Format("2006-01-02")
+	for day := to; day.Format("2006-01-02") >= first; day = day.AddDate(0, 0, -1) {
+		records, err := readAuditDay(filepath.Join(a.dir, day.Format("2006-01-02")+".log"))
+		if err != nil {
+			return nil, err
+		}
+		for i := len(records) - 1; i >= 0; i-- {
+			rec := records[i]
+			if rec.Time.Before(from) || rec.Time.After(to) || !match(rec) {
+				continue
+			}
+			result = append(result, rec)
+			if len(result) >= limit {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+func readAuditDay(path string) ([]AuditRecord, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// 处理函数登记本次请求写入或返回的日志条数
+func auditCount(c *gin.Context, n int) {
+	c.Set("audit.count", n)
+}
+
+// API Key 的指纹
+func apiKeyFingerprint(header http.Header) string {
+	key := requestAPIKey(header)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// 审计中间件：记录每个接口请求的访问者、参数、结果和条数
+func (s *Service) auditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if s.audit == nil || route == "" || auditSkipRoutes[route] {
+			return
+		}
+		rec := AuditRecord{
+			Time:       start,
+			Method:     c.Request.Method,
+			Route:      route,
+			Path:       c.Request.URL.Path,
+			Tenant:     c.GetString("tenant"),
+			User:       userName(currentUser(c)),
+			APIKey:     apiKeyFingerprint(c.Request.Header),
+			ClientCert: clientCertSubject(c.Request),
+			RemoteAddr: c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			Status:     c.Writer.Status(),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		params := c.Request.URL.Query()
+		for _, p := range c.Params {
+			params.Set(":"+p.Key, p.Value)
+		}
+		if len(params) > 0 {
+			rec.Params = params
+		}
+		if n, ok := c.Get("audit.count"); ok {
+			count := n.(int)
+			rec.Count = &count
+		}
+		s.audit.Record(rec)
+	}
+}
+
+// 审计查询接口：按时间范围、路由、租户、来源地址和状态码过滤，默认返回最近一天
+func (s *Service) auditHandler(c *gin.Context) {
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	var status int
+	if v := c.Query("status"); v != "" {
+		if status, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+	}
+	route, tenant, remote, method := c.Query("route"), c.Query("tenant"), c.Query("remote_addr"), c.Query("method")
+	user := c.Query("user")
+
+	records, err := s.audit.Search(from, to, func(rec AuditRecord) bool {
+		return (route == "" || rec.Route == route) &&
+			(tenant == "" || rec.Tenant == tenant) &&
+			(user == "" || rec.User == user) &&
+			(remote == "" || rec.RemoteAddr == remote) &&
+			(method == "" || strings.EqualFold(rec.Method, method)) &&
+			(status == 0 || rec.Status == status)
+	}, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read audit log"})
+		return
+	}
+	if records == nil {
+		records = []AuditRecord{}
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "records": records})
+}
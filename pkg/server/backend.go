@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/storage"
+)
+
+// 存储后端配置
+type BackendConfig struct {
+	Type string `json:"type"` // file、clickhouse，或 custom：使用 WithStore 以同名注入的后端
+	Root string `json:"root"` // file 后端的根目录
+
+	// clickhouse 后端
+	URL           string           `json:"url,omitempty"`            // HTTP 接口地址，如 http://clickhouse:8123
+	Database      string           `json:"database,omitempty"`       // 默认 default
+	Table         string           `json:"table,omitempty"`          // 默认 logs，不存在时自动创建
+	User          string           `json:"user,omitempty"`           // 用户名，为空时使用服务端默认用户
+	Password      string           `json:"password,omitempty"`       // 为空时读取 CLICKHOUSE_PASSWORD 环境变量
+	BatchSize     int              `json:"batch_size,omitempty"`     // 每批插入的最多条数，默认 10000
+	FlushInterval Duration         `json:"flush_interval,omitempty"` // 未攒满一批时最长等待多久写入，默认 200ms
+	TLS           *ClientTLSConfig `json:"tls,omitempty"`
+
+	// 默认放置在该后端的应用，支持通配模式（如 order-*）；迁移接口指定的放置优先
+	Applications []string `json:"applications,omitempty"`
+}
+
+// 默认后端名称，对应 storage_root
+const defaultBackend = "local"
+
+// 应用所在的后端不以本地目录存放日志时返回该后端
+func (s *Service) queryStoreOf(applicationID string) (storage.QueryStore, bool) {
+	store, _, _ := s.backends.Store(s.backends.BackendOf(applicationID))
+	qs, ok := store.(storage.QueryStore)
+	return qs, ok
+}
+
+// 基于本地目录的存储后端，即最初的按应用、按日期分文件的存储方式
+type fileStore struct {
+	svc      *Service
+	backend  string
+	root     string
+	rotation RotationConfig
+
+	mu     sync.Mutex
+	active map[string]int // 应用目录/日期 → 当前写入的分段序号
+}
+
+func (s *Service) newFileStore(backend, root string, rotation RotationConfig) *fileStore {
+	return &fileStore{svc: s, backend: backend, root: root, rotation: rotation, active: make(map[string]int)}
+}
+
+func (s *fileStore) AppendEntry(applicationID, fileName string, entry LogData) error {
+	appFolder := filepath.Join(s.root, model.BareApplicationID(applicationID))
+	if err := os.MkdirAll(appFolder, os.ModePerm); err != nil {
+		return err
+	}
+	// 租户前缀只体现在存储位置上，日志记录中保存原始的应用 ID
+	entry.ApplicationID = model.BareApplicationID(entry.ApplicationID)
+	record, err := encodeLogRecord(entry)
+	if err != nil {
+		return err
+	}
+
+	// 开启按大小滚动时，同一天的日志写入当前分段；路由到存储类别的日志写入该类别的当前分段
+	class := s.svc.storageRouting.Class(applicationID, &entry)
+	path := filepath.Join(appFolder, fileName)
+	// 已压缩或分层的分段（如导入历史日志时）不能追加，同样写入新的分段
+	if day, _, ok := parseSegmentName(fileName); ok && (class != "" || s.rotation.MaxSegmentMB > 0 || segmentSealed(path)) {
+		if path, err = s.activeSegment(appFolder, day, class); err != nil {
+			return err
+		}
+	}
+	// 密文绑定最终写入的分段
+	if record, err = s.svc.encryption.Seal(applicationID, path, record); err != nil {
+		return err
+	}
+	if err := s.svc.diskQuotas.Reserve(applicationID, appFolder, int64(len(record))); err != nil {
+		return err
+	}
+	if class == "" {
+		if err := s.placeSegment(path); err != nil {
+			return err
+		}
+	}
+	offset, err := s.svc.appendToFile(path, record)
+	if err != nil {
+		return err
+	}
+	s.svc.histogramCounts.Record(appFolder, filepath.Base(path), offset, int64(len(record)), entry)
+	s.svc.queryCache.Invalidate(path)
+	return nil
+}
+
+func (s *fileStore) ScanFrom(applicationID string, cursor storage.Cursor, fn func(entry LogData, ref logRef) bool) (storage.Cursor, error) {
+	appFolder := filepath.Join(s.root, model.BareApplicationID(applicationID))
+	names, err := listSegments(appFolder)
+	if err != nil {
+		return cursor, err
+	}
+
+	next := make(storage.Cursor, len(names))
+	for name, offset := range cursor {
+		next[name] = offset
+	}
+	visit := parsedLineVisitor(fn)
+	for _, name := range names {
+		ref := logRef{ApplicationID: applicationID, File: name}
+		stop, err := s.svc.scanFileLines(context.Background(), filepath.Join(appFolder, name), next[name], func(line string, offset, end int64) bool {
+			ref.Offset = offset
+			if !visit(line, ref) {
+				return false
+			}
+			next[name] = end
+			return true
+		})
+		if err != nil {
+			return next, err
+		}
+		if stop {
+			return next, nil
+		}
+	}
+	return next, nil
+}
+
+func (s *fileStore) RemoveApplication(applicationID string) error {
+	appFolder := filepath.Join(s.root, model.BareApplicationID(applicationID))
+	s.mu.Lock()
+	for key := range s.active {
+		if filepath.Dir(key) == appFolder {
+			delete(s.active, key)
+		}
+	}
+	s.mu.Unlock()
+	// 已上传到对象存储的分段，以及存储类别和存储卷目录中的分段一并删除
+	if s.svc.tiering != nil {
+		s.svc.tiering.removeObjects(appFolder)
+	}
+	dirs := s.svc.storageRouting.applicationDirs(s.backend, model.BareApplicationID(applicationID))
+	dirs = append(dirs, s.svc.storageVolumes.applicationDirs(s.backend, s.root, model.BareApplicationID(applicationID))...)
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(appFolder)
+}
+
+// 后端注册表及应用到后端的映射
+type backendRegistry struct {
+	mu        sync.RWMutex
+	backends  map[string]BackendConfig
+	stores    map[string]storage.LogStore
+	placement map[string]string // 应用 ID → 后端名称
+	defaults  []backendPattern  // 按配置默认放置的应用
+	path      string
+
+	gatesMu sync.Mutex
+	gates   map[string]*sync.RWMutex
+	writes  sync.RWMutex // 写入持有读锁，快照记录文件列表时持有写锁以暂停全部写入
+}
+
+// 按应用 ID 模式默认放置的后端
+type backendPattern struct {
+	pattern string
+	backend string
+}
+
+// 根据配置创建后端，并加载应用的后端映射
+func (s *Service) newBackendRegistry(configs map[string]BackendConfig, storageRoot, dataDir string, rotation RotationConfig, tenants *tenantRegistry) (*backendRegistry, error) {
+	r := &backendRegistry{
+		backends:  map[string]BackendConfig{defaultBackend: {Type: "file", Root: storageRoot}},
+		stores:    make(map[string]storage.LogStore),
+		placement: make(map[string]string),
+		path:      filepath.Join(dataDir, "app_backends.json"),
+		gates:     make(map[string]*sync.RWMutex),
+	}
+	for name, c := range configs {
+		r.backends[name] = c
+	}
+	// 注入的后端没有配置时不默认放置任何应用，只能通过迁移接口放置
+	for name := range s.customStores {
+		if _, ok := r.backends[name]; !ok {
+			r.backends[name] = BackendConfig{Type: "custom"}
+		}
+	}
+	// 每个租户使用独立存储根目录的 file 后端
+	for _, tenant := range tenants.Names() {
+		r.backends[tenantBackend(tenant)] = BackendConfig{Type: "file", Root: tenants.configs[tenant].StorageRoot}
+	}
+
+	for _, name := range r.Names() {
+		c := r.backends[name]
+		if _, ok := s.customStores[name]; ok && c.Type != "custom" {
+			r.Close()
+			return nil, fmt.Errorf("backend %s: a store was provided with WithStore but the backend is configured as %q", name, c.Type)
+		}
+		switch c.Type {
+		case "file":
+			if c.Root == "" {
+				return nil, fmt.Errorf("backend %s: root is required", name)
+			}
+			r.stores[name] = s.newFileStore(name, c.Root, rotation)
+		case "clickhouse":
+			store, err := newClickHouseStore(name, c)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("backend %s: %v", name, err)
+			}
+			r.stores[name] = store
+		case "custom":
+			store, ok := s.customStores[name]
+			if !ok {
+				r.Close()
+				return nil, fmt.Errorf("backend %s: no store was provided with WithStore", name)
+			}
+			r.stores[name] = store
+		default:
+			r.Close()
+			return nil, fmt.Errorf("backend %s: unsupported type %q", name, c.Type)
+		}
+		for _, pattern := range c.Applications {
+			if _, err := path.Match(pattern, ""); err != nil {
+				r.Close()
+				return nil, fmt.Errorf("backend %s: invalid application pattern %q", name, pattern)
+			}
+			r.defaults = append(r.defaults, backendPattern{pattern: pattern, backend: name})
+		}
+	}
+
+	if err := loadJSONFile(r.path, &r.placement); err != nil {
+		return nil, err
+	}
+	for app, name := range r.placement {
+		if _, ok := r.stores[name]; !ok {
+			return nil, fmt.Errorf("application %s is placed on unknown backend %s", app, name)
+		}
+	}
+	return r, nil
+}
+
+// 应用当前所在的后端名称
+func (r *backendRegistry) BackendOf(applicationID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name, ok := r.placement[applicationID]; ok {
+		return name
+	}
+	for _, d := range r.defaults {
+		if ok, _ := path.Match(d.pattern, applicationID); ok {
+			return d.backend
+		}
+	}
+	if tenant, _ := model.SplitApplicationID(applicationID); tenant != "" {
+		return tenantBackend(tenant)
+	}
+	return defaultBackend
+}
+
+// 按名称获取后端
+func (r *backendRegistry) Store(name string) (storage.LogStore, BackendConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	store, ok := r.stores[name]
+	return store, r.backends[name], ok
+}
+
+// 应用当前的日志根目录（file 后端）
+func (r *backendRegistry) RootOf(applicationID string) string {
+	name := r.BackendOf(applicationID)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.backends[name].Root
+}
+
+// 切换应用所在的后端并持久化
+func (r *backendRegistry) Place(applicationID, backend string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if backend == defaultBackend {
+		delete(r.placement, applicationID)
+	} else {
+		r.placement[applicationID] = backend
+	}
+	return saveJSONFile(r.path, r.placement)
+}
+
+// 后端名称列表
+func (r *backendRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.backends))
+	for name := range r.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 停止后端的后台写入，写出缓冲中的日志
+func (r *backendRegistry) Close() error {
+	var errs []error
+	for name, store := range r.stores {
+		if closer, ok := store.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("backend %s: %v", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 应用的写入闸门：上传持有读锁，迁移切换时持有写锁以暂停该应用的写入
+func (r *backendRegistry) WriteGate(applicationID string) *sync.RWMutex {
+	r.gatesMu.Lock()
+	defer r.gatesMu.Unlock()
+	gate, ok := r.gates[applicationID]
+	if !ok {
+		gate = &sync.RWMutex{}
+		r.gates[applicationID] = gate
+	}
+	return gate
+}
+
+// 暂停全部应用的写入，返回恢复写入的函数
+func (r *backendRegistry) PauseWrites() func() {
+	r.writes.Lock()
+	return r.writes.Unlock
+}
+
+// 应用日志目录
+func (s *Service) applicationDir(applicationID string) string {
+	return filepath.Join(s.backends.RootOf(applicationID), model.BareApplicationID(applicationID))
+}
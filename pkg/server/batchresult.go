@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量上传中一条日志的结果
+const (
+	EntryAccepted  = "accepted"
+	EntryDuplicate = "duplicate"
+	EntryDropped   = "dropped"
+	EntryRejected  = "rejected"
+)
+
+// 一条日志的结果，Index 为日志在请求中的位置
+type EntryResult struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"`
+	ID        int64  `json:"id,omitempty"`
+	Reason    string `json:"reason,omitempty"` // 被拒绝的原因，如 invalid_timestamp、tenant_quota_exceeded
+	Error     string `json:"error,omitempty"`
+	Field     string `json:"field,omitempty"`     // 超长的字段
+	Retryable bool   `json:"retryable,omitempty"` // 原样重试可能成功，如队列满、配额用尽；否则须修改日志后再上传
+}
+
+// 写入错误的分类：状态码、原因和是否值得原样重试
+type ingestErrorClass struct {
+	err       error
+	reason    string
+	status    int
+	message   string
+	retryable bool
+}
+
+var ingestErrorClasses = []ingestErrorClass{
+	{errIngestQueueFull, "queue_full", http.StatusServiceUnavailable, "Ingest queue is full, retry later", true},
+	{errInvalidTimestamp, "invalid_timestamp", http.StatusBadRequest, "Invalid timestamp", false},
+	{errSchemaViolation, "schema_violation", http.StatusUnprocessableEntity, "Entry does not match the application schema", false},
+	{errTenantQuotaExceeded, "tenant_quota_exceeded", http.StatusTooManyRequests, "Tenant daily quota exceeded", true},
+	{errDiskQuotaExceeded, "disk_quota_exceeded", http.StatusInsufficientStorage, "Application disk quota exceeded", true},
+	{errApplicationReadOnly, "application_read_only", http.StatusConflict, "Application is archived or deleted and does not accept writes", false},
+	{errIngestPaused, "ingest_paused", http.StatusServiceUnavailable, "Ingestion is paused for the application", true},
+	{errClickHouseBacklog, "backend_backlog", http.StatusServiceUnavailable, "Storage backend write backlog is full", true},
+}
+
+// 未分类的写入错误
+var writeFailedClass = ingestErrorClass{reason: "write_failed", status: http.StatusInternalServerError, message: "Unable to write log to file", retryable: true}
+
+// 写入错误所属的分类
+func classifyIngestError(err error) ingestErrorClass {
+	for _, class := range ingestErrorClasses {
+		if errors.Is(err, class.err) {
+			return class
+		}
+	}
+	return writeFailedClass
+}
+
+// 被拒绝的一条日志的结果
+func rejectedEntry(i int, err error) EntryResult {
+	r := EntryResult{Index: i, Status: EntryRejected}
+	var tooLong *fieldTooLongError
+	var appErr *applicationIDError
+	switch {
+	case errors.As(err, &tooLong):
+		uploadLimitRejected.Add(1, "limit", tooLong.Field)
+		r.Reason, r.Error, r.Field = "field_too_long", tooLong.Error(), tooLong.Field
+	case errors.As(err, &appErr):
+		r.Reason, r.Error = appErr.reason, appErr.message
+	case errors.Is(err, errInvalidUpload):
+		r.Reason, r.Error = "invalid_entry", "Entry is missing required fields"
+	default:
+		class := classifyIngestError(err)
+		r.Reason, r.Error, r.Retryable = class.reason, class.message, class.retryable
+		if errors.Is(err, errInvalidTimestamp) {
+			r.Error += timestampMismatch(err)
+		} else if errors.Is(err, errSchemaViolation) {
+			r.Error += ": " + schemaViolation(err)
+		}
+	}
+	return r
+}
+
+// 部分成功的批量上传：逐条校验和写入，一条日志被拒绝不影响其他日志。全部写入（含重复和被丢弃的）时返回 200，
+// 否则返回 207，results 按请求中的顺序给出每条日志的结果，客户端只需重试 retryable 的日志。
+// 写入队列已满时整批返回 503
+func (s *Service) partialBatchUpload(c *gin.Context, items []json.RawMessage) {
+	now := time.Now()
+	results := make([]EntryResult, len(items))
+	batch := make([]LogData, 0, len(items))
+	positions := make([]int, 0, len(items))
+	for i, item := range items {
+		entry, err := s.decodeEntry(c, item, now)
+		if err != nil {
+			results[i] = rejectedEntry(i, err)
+			continue
+		}
+		batch = append(batch, entry)
+		positions = append(positions, i)
+	}
+
+	if len(batch) > 0 {
+		written, err := s.tryIngestEach(batch)
+		if err != nil {
+			s.ingestFailed(c, err, 0)
+			return
+		}
+		fillEntryResults(results, positions, written)
+	}
+
+	status, body, written := batchResultResponse(results)
+	auditCount(c, written)
+	c.JSON(status, body)
+}
+
+// 按写入结果填充 results，written[j] 是 results[positions[j]] 的写入结果
+func fillEntryResults(results []EntryResult, positions []int, written []ingestResult) {
+	for j, r := range written {
+		i := positions[j]
+		switch {
+		case errors.Is(r.Err, errDuplicateEntry):
+			results[i] = EntryResult{Index: i, Status: EntryDuplicate}
+		case errors.Is(r.Err, errDroppedEntry):
+			results[i] = EntryResult{Index: i, Status: EntryDropped}
+		case r.Err != nil:
+			results[i] = rejectedEntry(i, r.Err)
+		default:
+			results[i] = EntryResult{Index: i, Status: EntryAccepted, ID: r.ID}
+		}
+	}
+}
+
+// 汇总逐条结果：没有被拒绝的日志时为 200，否则为 207。accepted 与整批上传相同，包括重复和被丢弃的日志；
+// written 为实际写入的条数
+func batchResultResponse(results []EntryResult) (status int, body gin.H, written int) {
+	var duplicates, dropped, rejected int
+	ids := make([]int64, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+		switch r.Status {
+		case EntryDuplicate:
+			duplicates++
+		case EntryDropped:
+			dropped++
+		case EntryRejected:
+			rejected++
+		}
+	}
+	status, message := http.StatusOK, "Logs uploaded successfully"
+	if rejected > 0 {
+		status, message = http.StatusMultiStatus, "Some logs were rejected"
+	}
+	body = gin.H{"message": message, "accepted": len(results) - rejected, "duplicates": duplicates, "dropped": dropped, "rejected": rejected, "ids": ids, "results": results}
+	return status, body, len(results) - duplicates - dropped - rejected
+}
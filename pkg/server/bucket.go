@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 时间分桶：按固定时长或日历单位（天、周、月、年）对齐到指定时区的边界
+type bucketer struct {
+	every int           // 日历单位的个数
+	unit  byte          // s、m、h 为固定时长；d、w、M、y 为日历单位
+	fixed time.Duration // 固定时长分桶的长度
+	loc   *time.Location
+}
+
+// 解析分桶间隔，如 30s、5m、1h、1d、1w、1M、1y
+func newBucketer(interval string, loc *time.Location) (*bucketer, error) {
+	if len(interval) < 2 {
+		return nil, fmt.Errorf("invalid interval %q", interval)
+	}
+	n, err := strconv.Atoi(interval[:len(interval)-1])
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid interval %q", interval)
+	}
+
+	b := &bucketer{every: n, unit: interval[len(interval)-1], loc: loc}
+	switch b.unit {
+	case 's':
+		b.fixed = time.Duration(n) * time.Second
+	case 'm':
+		b.fixed = time.Duration(n) * time.Minute
+	case 'h':
+		b.fixed = time.Duration(n) * time.Hour
+	case 'd', 'w', 'M', 'y':
+	default:
+		return nil, fmt.Errorf("invalid interval unit in %q, use s, m, h, d, w, M or y", interval)
+	}
+	return b, nil
+}
+
+// 当地零点
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// t 所在分桶的起点
+func (b *bucketer) Truncate(t time.Time) time.Time {
+	t = t.In(b.loc)
+	switch b.unit {
+	case 'd':
+		day := startOfDay(t)
+		if b.every == 1 {
+			return day
+		}
+		// 多天分桶以当年 1 月 1 日为起点
+		first := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, b.loc)
+		days := int(day.Sub(first).Hours()+12) / 24
+		return first.AddDate(0, 0, days-days%b.every)
+	case 'w':
+		// ISO 周，从周一开始
+		day := startOfDay(t)
+		offset := (int(day.Weekday()) + 6) % 7
+		monday := day.AddDate(0, 0, -offset)
+		if b.every == 1 {
+			return monday
+		}
+		_, week := monday.ISOWeek()
+		return monday.AddDate(0, 0, -7*((week-1)%b.every))
+	case 'M':
+		month := (int(t.Month()) - 1) / b.every * b.every
+		return time.Date(t.Year(), time.Month(month+1), 1, 0, 0, 0, 0, b.loc)
+	case 'y':
+		return time.Date(t.Year()-t.Year()%b.every, 1, 1, 0, 0, 0, 0, b.loc)
+	}
+
+	// 固定时长：不超过一天的间隔以当地零点对齐，更长的间隔以 Unix 纪元对齐
+	if b.fixed <= 24*time.Hour {
+		day := startOfDay(t)
+		return day.Add(t.Sub(day) / b.fixed * b.fixed)
+	}
+	return t.Truncate(b.fixed)
+}
+
+// 下一个分桶的起点
+func (b *bucketer) Next(start time.Time) time.Time {
+	switch b.unit {
+	case 'd':
+		return start.AddDate(0, 0, b.every)
+	case 'w':
+		return start.AddDate(0, 0, 7*b.every)
+	case 'M':
+		return start.AddDate(0, b.every, 0)
+	case 'y':
+		return start.AddDate(b.every, 0, 0)
+	}
+	// 重新对齐，使不能整除一天的间隔在次日零点重新开始
+	return b.Truncate(start.Add(b.fixed))
+}
+
+// 生成 [from, to] 范围内的全部分桶起点，用于补零。数量超过 max 时返回错误
+func (b *bucketer) Range(from, to time.Time, max int) ([]time.Time, error) {
+	var buckets []time.Time
+	for t := b.Truncate(from); !t.After(to); t = b.Next(t) {
+		buckets = append(buckets, t)
+		if len(buckets) > max {
+			return nil, fmt.Errorf("too many buckets, use a larger interval or a shorter range")
+		}
+	}
+	return buckets, nil
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存中的一条匹配结果
+type cachedHit struct {
+	Entry LogData
+	Ref   logRef
+}
+
+type cacheItem struct {
+	key   string
+	path  string
+	stamp string
+	hits  []cachedHit
+	size  int64
+}
+
+// 分段查询结果的 LRU 缓存：键为（分段文件，过滤条件），值为该分段中满足条件的全部日志。
+// 追加写入分段时使该分段的全部缓存失效，已关闭的分段可以一直命中。
+// 共享存储上其他节点的写入不经过本节点，命中时还会比较分段文件的大小和修改时间
+type segmentCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List               // 最近使用的在前
+	items    map[string]*list.Element // 键 → 元素
+	paths    map[string]map[string]bool
+	gens     map[string]uint64 // 分段 → 写入代数，扫描期间有写入时结果不入缓存
+}
+
+var queryCacheLookups = metrics.counter("query_cache_lookups_total", "Segment lookups in the query result cache, by result.")
+
+// maxBytes 不大于 0 时不缓存
+func newSegmentCache(maxBytes int64) *segmentCache {
+	return &segmentCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+		paths:    make(map[string]map[string]bool),
+		gens:     make(map[string]uint64),
+	}
+}
+
+func (c *segmentCache) Get(key, stamp string) ([]cachedHit, bool) {
+	if c == nil || c.maxBytes <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok || el.Value.(*cacheItem).stamp != stamp {
+		queryCacheLookups.Add(1, "result", "miss")
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	queryCacheLookups.Add(1, "result", "hit")
+	return el.Value.(*cacheItem).hits, true
+}
+
+// 分段当前的写入代数
+func (c *segmentCache) Generation(path string) uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gens[path]
+}
+
+// 写入缓存，gen 与分段当前的写入代数不一致时说明扫描期间分段有追加，丢弃结果
+func (c *segmentCache) Put(key, path, stamp string, gen uint64, hits []cachedHit) {
+	if c == nil || c.maxBytes <= 0 {
+		return
+	}
+	var size int64 = 128
+	for _, h := range hits {
+		size += int64(len(h.Entry.LogMessage)+len(h.Entry.Timestamp)+len(h.Entry.Logger)+len(h.Entry.Thread)) + 160
+		for k, v := range h.Entry.Fields {
+			size += int64(len(k) + len(v))
+		}
+	}
+	if size > c.maxBytes/4 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[path] != gen {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.removeLocked(el)
+	}
+	item := &cacheItem{key: key, path: path, stamp: stamp, hits: hits, size: size}
+	c.items[key] = c.lru.PushFront(item)
+	if c.paths[path] == nil {
+		c.paths[path] = make(map[string]bool)
+	}
+	c.paths[path][key] = true
+	c.size += size
+	for c.size > c.maxBytes {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// 分段有追加写入，删除其缓存结果
+func (c *segmentCache) Invalidate(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gens[path]++
+	for key := range c.paths[path] {
+		c.removeLocked(c.items[key])
+	}
+}
+
+func (c *segmentCache) removeLocked(el *list.Element) {
+	item := c.lru.Remove(el).(*cacheItem)
+	delete(c.items, item.key)
+	delete(c.paths[item.path], item.key)
+	if len(c.paths[item.path]) == 0 {
+		delete(c.paths, item.path)
+	}
+	c.size -= item.size
+}
+
+// 分段文件当前的大小和修改时间，依次查找原文件、压缩文件和分层占位文件
+func segmentStamp(path string) string {
+	for _, p := range append(append([]string{path}, compressedPaths(path)...), path+tieredSuffix) {
+		if info, err := os.Stat(p); err == nil {
+			return fmt.Sprintf("%s:%d:%d", filepath.Ext(p), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return ""
+}
+
+// 过滤条件的缓存键：级别和字段条件，时间范围在命中后再过滤
+func queryFilterKey(q logQuery) string {
+	var b strings.Builder
+	b.WriteString(q.LogLevel)
+	for _, k := range sortedKeys(q.Fields) {
+		values := append([]string(nil), q.Fields[k]...)
+		sort.Strings(values)
+		b.WriteString("\x00" + k + "=" + strings.Join(values, "\x01"))
+	}
+	return b.String()
+}
+
+// 按分段遍历应用中满足级别和字段条件的日志，完整扫描过的分段结果写入缓存。
+// 只读取可能包含 since 到 q.To 之间日志的分段，增量查询从计数索引给出的位置开始读取，fn 返回 false 时停止
+func (s *Service) scanStoredCached(q logQuery, since time.Time, fn func(entry LogData, ref logRef) bool) error {
+	appFolder := s.applicationDir(q.ApplicationID)
+	names, err := listSegments(appFolder)
+	if err != nil {
+		return err
+	}
+	filterKey := queryFilterKey(q)
+	starts := s.deltaStartOffsets(q)
+	if q.explain != nil {
+		q.explain.application(q.ApplicationID, "files")
+		q.explain.Index.IncrementalIndex = q.explain.Index.IncrementalIndex || len(starts) > 0
+	}
+
+	for _, name := range names {
+		if !segmentInRange(name, s.histogramCounts.ClosedSegment(appFolder, name), since, q.To) {
+			q.explain.segment(explainSegment{File: name, Action: explainSkipped, Reason: "out_of_range"})
+			continue
+		}
+		start := starts[name]
+		if start < 0 {
+			q.explain.segment(explainSegment{File: name, Action: explainSkipped, Reason: "index"})
+			continue
+		}
+		path := filepath.Join(appFolder, name)
+		stub, archived := archivedSegment(path)
+		if archived && !q.Archive.includes() {
+			q.Archive.skipped()
+			q.explain.segment(explainSegment{File: name, Action: explainSkipped, Reason: "archived"})
+			continue
+		}
+		if stub != nil && !stub.inRange(since, q.To) {
+			q.Archive.pruned()
+			q.explain.segment(explainSegment{File: name, Action: explainSkipped, Reason: "out_of_range"})
+			continue
+		}
+		key := path + "\x00" + filterKey
+		stamp := segmentStamp(path)
+		if hits, ok := s.queryCache.Get(key, stamp); ok {
+			q.explain.segment(explainSegment{File: name, Action: explainCached, FilterHits: len(hits)})
+			for _, h := range hits {
+				if !fn(h.Entry, h.Ref) {
+					return nil
+				}
+			}
+			continue
+		}
+
+		gen := s.queryCache.Generation(path)
+		var hits []cachedHit
+		complete := true
+		scanned := explainSegment{File: name, Action: explainScanned, StartOffset: start}
+		began := time.Now()
+		var blocks []tieredBlock
+		// 未启用分层时整段读取
+		if stub != nil && s.tiering != nil {
+			blocks = stub.blocksBetween(since, q.To, start)
+		}
+		visit := func(line string, offset, next int64) bool {
+			scanned.LinesRead++
+			scanned.BytesRead = next - start
+			if !matchesLevel(line, q.LogLevel) {
+				return true
+			}
+			entry, err := parseLogLine(line)
+			if err != nil {
+				return true
+			}
+			if entry.ApplicationID == "" {
+				entry.ApplicationID = q.ApplicationID
+			}
+			if !entryMatchesLevel(entry, q.LogLevel) || !matchesFields(entry, q.Fields) {
+				return true
+			}
+			ref := logRef{ApplicationID: q.ApplicationID, File: name, Offset: offset}
+			hits = append(hits, cachedHit{Entry: entry, Ref: ref})
+			if !fn(entry, ref) {
+				complete = false
+				return false
+			}
+			return true
+		}
+		var err error
+		if blocks != nil {
+			var read int64
+			_, read, err = s.scanTieredBlocks(q.context(), path, *stub, blocks, start, visit)
+			scanned.BytesRead = read
+			q.Archive.ranged(read)
+		} else {
+			_, err = s.scanFileLines(q.context(), path, start, visit)
+			if archived {
+				q.Archive.fetched()
+			}
+		}
+		if q.explain != nil {
+			scanned.FilterHits, scanned.DurationMS = len(hits), durationMS(time.Since(began))
+			scanned.Storage = segmentStorage(path)
+			q.explain.segment(scanned)
+		}
+		if err != nil {
+			return err
+		}
+		if !complete {
+			return nil
+		}
+		// 只读取了一部分的分段不写入缓存
+		if start == 0 && blocks == nil {
+			s.queryCache.Put(key, path, stamp, gen, hits)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import "testing"
+
+func TestSegmentCacheStampAndGeneration(t *testing.T) {
+	c := newSegmentCache(1 << 20)
+	hits := []cachedHit{{Entry: LogData{LogMessage: "m"}}}
+
+	c.Put("k", "seg", "s1", c.Generation("seg"), hits)
+	if got, ok := c.Get("k", "s1"); !ok || len(got) != 1 {
+		t.Fatalf("Get after Put = %v, %v", got, ok)
+	}
+	// 分段文件被其他节点改变，大小或修改时间不同
+	if _, ok := c.Get("k", "s2"); ok {
+		t.Fatal("hit with a different stamp")
+	}
+
+	// 扫描期间分段有追加，结果不入缓存
+	gen := c.Generation("seg")
+	c.Invalidate("seg")
+	if _, ok := c.Get("k", "s1"); ok {
+		t.Fatal("hit after Invalidate")
+	}
+	c.Put("k", "seg", "s1", gen, hits)
+	if _, ok := c.Get("k", "s1"); ok {
+		t.Fatal("result scanned before an append was cached")
+	}
+	if c.size != 0 || len(c.paths) != 0 {
+		t.Fatalf("size = %d, paths = %v after invalidation, want empty", c.size, c.paths)
+	}
+}
+
+func TestSegmentCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newSegmentCache(4096)
+	hits := []cachedHit{{Entry: LogData{LogMessage: "message"}}}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q", "r", "s", "t"} {
+		c.Put(key, "seg-"+key, "s", 0, hits)
+		c.Get("a", "s") // 保持 a 最近使用
+	}
+	if c.size > c.maxBytes {
+		t.Fatalf("size %d exceeds limit %d", c.size, c.maxBytes)
+	}
+	if _, ok := c.Get("a", "s"); !ok {
+		t.Fatal("recently used entry evicted")
+	}
+	if _, ok := c.Get("b", "s"); ok {
+		t.Fatal("least recently used entry kept")
+	}
+}
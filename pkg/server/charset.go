@@ -0,0 +1,136 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// 上传内容的字符集。中文的 Seata 部署中常见 GBK 编码的日志，上传时可以通过 charset 参数或
+// Content-Type 的 charset 说明编码，服务端转为 UTF-8 后再解析和存储。名称按 WHATWG 编码标准识别，
+// 如 gbk、gb18030、big5、shift_jis、windows-1252
+var (
+	uploadsTranscoded = metrics.counter("upload_transcoded_total", "Upload bodies transcoded to UTF-8, by charset.")
+	utf8Repaired      = metrics.counter("utf8_repaired_total", "Log entries whose invalid UTF-8 sequences were replaced on ingest.")
+)
+
+// 请求说明的字符集，未说明或为 UTF-8 时返回 nil
+func requestCharset(r *http.Request) (encoding.Encoding, string, error) {
+	name := r.URL.Query().Get("charset")
+	if name == "" {
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+			name = params["charset"]
+		}
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "utf-8" || name == "utf8" {
+		return nil, "", nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, name, err
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+		return nil, "", nil
+	}
+	return enc, name, nil
+}
+
+// 按请求说明的字符集将请求体转为 UTF-8，无法识别的字符集返回 400。转码后请求改为说明 UTF-8，
+// 转发到其他节点或再次读取时不会重复转码
+func transcodeUploadBody(c *gin.Context, body []byte) ([]byte, bool) {
+	enc, name, err := requestCharset(c.Request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unsupported charset " + name})
+		return nil, false
+	}
+	if enc == nil {
+		return body, true
+	}
+	// 无法解码的字节替换为 U+FFFD
+	body, err = enc.NewDecoder().Bytes(body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unable to decode request body as " + name})
+		return nil, false
+	}
+	uploadsTranscoded.Add(1, "charset", name)
+
+	query := c.Request.URL.Query()
+	if query.Has("charset") {
+		query.Del("charset")
+		c.Request.URL.RawQuery = query.Encode()
+	}
+	if mediaType, params, err := mime.ParseMediaType(c.Request.Header.Get("Content-Type")); err == nil && params["charset"] != "" {
+		params["charset"] = "utf-8"
+		c.Request.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	}
+	return body, true
+}
+
+// 校验会话中指定的字符集，返回规范的名称，未指定或为 UTF-8 时为空
+func uploadCharsetName(name string) (string, error) {
+	if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+		return "", nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return "", err
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical != "utf-8" {
+		return name, nil
+	}
+	return "", nil
+}
+
+// 将一行转为 UTF-8，charset 为 uploadCharsetName 校验过的名称
+func decodeCharset(charset string, line []byte) []byte {
+	if charset == "" {
+		return line
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return line
+	}
+	if decoded, err := enc.NewDecoder().Bytes(line); err == nil {
+		return decoded
+	}
+	return line
+}
+
+// 将日志中无效的 UTF-8 序列替换为 U+FFFD，保证存储的文件和 JSON 响应不出现乱码。
+// JSON 上传在解码时已经替换，这里处理纯文本行、syslog、Kafka 等来源
+func repairUTF8(entry *LogData) {
+	repaired := false
+	for _, s := range []*string{&entry.ApplicationID, &entry.LogLevel, &entry.LogMessage, &entry.Logger, &entry.Thread, &entry.XID, &entry.BranchID} {
+		if !utf8.ValidString(*s) {
+			*s = strings.ToValidUTF8(*s, string(utf8.RuneError))
+			repaired = true
+		}
+	}
+	for k, v := range entry.Fields {
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			delete(entry.Fields, k)
+			entry.Fields[strings.ToValidUTF8(k, string(utf8.RuneError))] = strings.ToValidUTF8(v, string(utf8.RuneError))
+			repaired = true
+		}
+	}
+	if repaired {
+		utf8Repaired.Add(1)
+	}
+}
+
+// 截取 s 的前至多 n 个字节，不在多字节字符（中文、emoji）中间截断
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"logAnalysis/pkg/client"
+)
+
+// seata-log 子命令：在终端通过 HTTP 接口查询日志、订阅实时日志、查看统计和全局事务。
+// 服务地址和 API Key 可以通过 SEATA_LOG_SERVER、SEATA_LOG_API_KEY 环境变量设置，
+// 输出默认为对齐的表格，-o json 输出 JSON，便于接 jq 等工具。出错时返回非零退出码
+const cliUsage = `Usage: logAnalysis seata-log <command> [flags]
+
+Commands:
+  query         query logs of an application
+  tail          follow newly ingested logs
+  stats         entry counts, level distribution and disk usage per application
+  transactions  global transactions with status inferred from TC logs
+
+Run "logAnalysis seata-log <command> -h" for the flags of a command.
+`
+
+// 各命令共用的参数
+type cliOptions struct {
+	server  string
+	apiKey  string
+	tenant  string
+	output  string
+	timeout time.Duration
+	tls     ClientTLSConfig
+}
+
+// 注册共用参数
+func (o *cliOptions) register(fs *flag.FlagSet) {
+	server := os.Getenv("SEATA_LOG_SERVER")
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+	fs.StringVar(&o.server, "server", server, "log service address (env SEATA_LOG_SERVER)")
+	fs.StringVar(&o.apiKey, "api-key", os.Getenv("SEATA_LOG_API_KEY"), "API key sent as X-API-Key (env SEATA_LOG_API_KEY)")
+	fs.StringVar(&o.tenant, "tenant", os.Getenv("SEATA_LOG_TENANT"), "send requests to the /tenants/{tenant}/ API of this tenant; not supported by stats and transactions (env SEATA_LOG_TENANT)")
+	fs.StringVar(&o.output, "o", "table", "output format: table or json")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "request timeout")
+	fs.StringVar(&o.tls.CAFile, "ca-file", "", "CA used to verify the server certificate")
+	fs.StringVar(&o.tls.CertFile, "cert-file", "", "client certificate for mutual TLS")
+	fs.StringVar(&o.tls.KeyFile, "key-file", "", "client private key for mutual TLS")
+}
+
+// 校验参数并创建客户端，extra 追加在共用参数对应的选项之后
+func (o *cliOptions) client(extra ...client.Option) (*client.Client, error) {
+	if o.output != "table" && o.output != "json" {
+		return nil, fmt.Errorf("unknown output format %q (expected table or json)", o.output)
+	}
+	httpClient, err := newTLSHTTPClient(o.tls, o.timeout)
+	if err != nil {
+		return nil, err
+	}
+	options := []client.Option{client.WithHTTPClient(httpClient)}
+	if o.apiKey != "" {
+		options = append(options, client.WithHeader("X-API-Key", o.apiKey))
+	}
+	if o.tenant != "" {
+		options = append(options, client.WithTenant(o.tenant))
+	}
+	return client.New(o.server, append(options, extra...)...), nil
+}
+
+// 租户接口只提供上传、查询和实时日志，没有统计和全局事务
+var errTenantUnsupported = errors.New("-tenant is not supported: the tenant API has no stats or transactions endpoint")
+
+// 可重复的 key=value 参数
+type cliFields map[string]string
+
+func (f cliFields) String() string { return "" }
+
+func (f cliFields) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value")
+	}
+	f[key] = value
+	return nil
+}
+
+var cliCommands = map[string]func(args []string) error{
+	"query":        cliQuery,
+	"tail":         cliTail,
+	"stats":        cliStats,
+	"transactions": cliTransactions,
+}
+
+func runCLI(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, cliUsage)
+		if len(args) == 0 {
+			os.Exit(2)
+		}
+		return
+	}
+	command, ok := cliCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "seata-log: unknown command %q\n\n%s", args[0], cliUsage)
+		os.Exit(2)
+	}
+	if err := command(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "seata-log %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+}
+
+// 解析命令的参数，不接受多余的位置参数
+func parseCLIFlags(fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return nil
+}
+
+// -since 换算为开始时间，优先于 -from
+func cliFrom(from string, since time.Duration) string {
+	if since > 0 {
+		return time.Now().Add(-since).Format(time.RFC3339)
+	}
+	return from
+}
+
+// 查询日志，默认最新的在前，-reverse 时按时间正序
+func cliQuery(args []string) error {
+	var opts cliOptions
+	fs := flag.NewFlagSet("seata-log query", flag.ExitOnError)
+	opts.register(fs)
+	app := fs.String("app", "", "application, a comma-separated list or glob pattern such as order-*")
+	level := fs.String("level", "", "log level")
+	limit := fs.Int("limit", 100, "maximum number of entries")
+	from := fs.String("from", "", "start time (RFC3339 or 2006-01-02 15:04:05)")
+	to := fs.String("to", "", "end time")
+	since := fs.Duration("since", 0, "only entries of the last duration, e.g. 15m; overrides -from")
+	keyword := fs.String("q", "", "keyword that the message must contain")
+	view := fs.String("view", "", "query within a temporary view")
+	reverse := fs.Bool("reverse", false, "oldest first")
+	fields := cliFields{}
+	fs.Var(fields, "field", "structured field filter key=value, repeatable")
+	if err := parseCLIFlags(fs, args); err != nil {
+		return err
+	}
+	if *view == "" && (*app == "" || *level == "") {
+		return errors.New("-app and -level are required unless -view is set")
+	}
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	sortOrder := "desc"
+	if *reverse {
+		sortOrder = "asc"
+	}
+	entries, err := c.Query(context.Background(), client.QueryOptions{
+		ApplicationID: *app,
+		LogLevel:      *level,
+		View:          *view,
+		Sort:          sortOrder,
+		Limit:         *limit,
+		Fields:        fields,
+		From:          cliFrom(*from, *since),
+		To:            *to,
+		Keyword:       *keyword,
+	})
+	if err != nil {
+		return err
+	}
+	if opts.output == "json" {
+		return writeCLIJSON(os.Stdout, entries)
+	}
+	w := newCLITable(os.Stdout, "TIMESTAMP", "LEVEL", "APPLICATION", "XID", "MESSAGE")
+	for _, e := range entries {
+		w.row(e.Timestamp, e.LogLevel, e.ApplicationID, cliValue(e.XID), cliLine(e.LogMessage))
+	}
+	return w.Flush()
+}
+
+// 订阅实时日志直到 Ctrl-C；-o json 时每行一个 JSON 对象
+func cliTail(args []string) error {
+	var opts cliOptions
+	fs := flag.NewFlagSet("seata-log tail", flag.ExitOnError)
+	opts.register(fs)
+	app := fs.String("app", "", "application to follow")
+	level := fs.String("level", "", "only entries with this level")
+	if err := parseCLIFlags(fs, args); err != nil {
+		return err
+	}
+	if *app == "" {
+		return errors.New("-app is required")
+	}
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	enc := json.NewEncoder(os.Stdout)
+	err = c.Tail(ctx, client.TailOptions{ApplicationID: *app, LogLevel: *level}, func(e client.LogEntry) error {
+		if opts.output == "json" {
+			return enc.Encode(e)
+		}
+		_, err := fmt.Fprintf(os.Stdout, "%s %-5s %s %s\n", e.Timestamp, e.LogLevel, e.ApplicationID, cliLine(e.LogMessage))
+		return err
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// 各应用的日志统计
+func cliStats(args []string) error {
+	var opts cliOptions
+	fs := flag.NewFlagSet("seata-log stats", flag.ExitOnError)
+	opts.register(fs)
+	app := fs.String("app", "", "comma-separated applications, default all")
+	if err := parseCLIFlags(fs, args); err != nil {
+		return err
+	}
+	if opts.tenant != "" {
+		return errTenantUnsupported
+	}
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	stats, err := c.Stats(context.Background(), splitList(*app)...)
+	if err != nil {
+		return err
+	}
+	if opts.output == "json" {
+		return writeCLIJSON(os.Stdout, stats)
+	}
+	w := newCLITable(os.Stdout, "APPLICATION", "BACKEND", "TOTAL", "LEVELS", "FILES", "BYTES", "LAST SEEN")
+	for _, st := range stats {
+		levels := make([]string, 0, len(st.Levels))
+		for _, level := range sortedKeys(st.Levels) {
+			levels = append(levels, level+"="+strconv.Itoa(st.Levels[level]))
+		}
+		lastSeen := "-"
+		if st.LastSeen != nil {
+			lastSeen = st.LastSeen.Format(time.RFC3339)
+		}
+		w.row(st.ApplicationID, st.Backend, strconv.Itoa(st.Total), cliValue(strings.Join(levels, ",")), strconv.Itoa(st.Files), strconv.FormatInt(st.Bytes, 10), lastSeen)
+	}
+	return w.Flush()
+}
+
+// 全局事务列表，表格之后列出各状态的数量
+func cliTransactions(args []string) error {
+	var opts cliOptions
+	fs := flag.NewFlagSet("seata-log transactions", flag.ExitOnError)
+	opts.register(fs)
+	app := fs.String("app", "", "comma-separated applications to scan, default all")
+	status := fs.String("status", "", "comma-separated statuses: "+transactionStatuses)
+	mode := fs.String("mode", "", "comma-separated transaction modes (AT, TCC, SAGA, XA)")
+	from := fs.String("from", "", "start time (RFC3339 or 2006-01-02 15:04:05)")
+	to := fs.String("to", "", "end time")
+	since := fs.Duration("since", 0, "only transactions of the last duration, e.g. 1h; overrides -from")
+	hangAfter := fs.Duration("hang-after", 0, "begin without a terminal event older than this is hanging (default: server setting)")
+	limit := fs.Int("limit", 100, "maximum number of transactions")
+	if err := parseCLIFlags(fs, args); err != nil {
+		return err
+	}
+	if opts.tenant != "" {
+		return errTenantUnsupported
+	}
+	c, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	list, err := c.Transactions(context.Background(), client.TransactionOptions{
+		ApplicationIDs: splitList(*app),
+		Statuses:       splitList(*status),
+		Modes:          splitList(*mode),
+		From:           cliFrom(*from, *since),
+		To:             *to,
+		HangAfter:      *hangAfter,
+		Limit:          *limit,
+	})
+	if err != nil {
+		return err
+	}
+	if opts.output == "json" {
+		return writeCLIJSON(os.Stdout, list)
+	}
+	w := newCLITable(os.Stdout, "XID", "STATUS", "MODE", "BEGIN", "DURATION", "EVENTS", "APPLICATIONS")
+	for _, tx := range list.Transactions {
+		begin, duration := "-", "-"
+		if tx.Begin != nil {
+			begin = tx.Begin.Format(time.RFC3339)
+		}
+		if tx.DurationMs != nil {
+			duration = (time.Duration(*tx.DurationMs) * time.Millisecond).String()
+		}
+		w.row(tx.XID, tx.Status, cliValue(tx.Mode), begin, duration, strconv.Itoa(tx.Events), strings.Join(tx.ApplicationIDs, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	counts := make([]string, 0, len(list.Counts))
+	for _, s := range sortedKeys(list.Counts) {
+		counts = append(counts, fmt.Sprintf("%s=%d", s, list.Counts[s]))
+	}
+	fmt.Fprintf(os.Stdout, "\n%d shown", len(list.Transactions))
+	if list.Truncated {
+		fmt.Fprint(os.Stdout, " (truncated, raise -limit for more)")
+	}
+	if len(counts) > 0 {
+		fmt.Fprintf(os.Stdout, "; %s", strings.Join(counts, " "))
+	}
+	fmt.Fprintln(os.Stdout)
+	return nil
+}
+
+// 以制表符对齐列的表格
+type cliTable struct {
+	*tabwriter.Writer
+}
+
+func newCLITable(out io.Writer, columns ...string) cliTable {
+	w := cliTable{tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)}
+	w.row(columns...)
+	return w
+}
+
+func (w cliTable) row(values ...string) {
+	fmt.Fprintln(w, strings.Join(values, "\t"))
+}
+
+func writeCLIJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// 表格中的空值显示为 -
+func cliValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// 多行消息（如异常堆栈）在表格中只显示第一行，制表符替换为空格，避免打乱列对齐
+func cliLine(s string) string {
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = s[:i] + " …"
+	}
+	return strings.ReplaceAll(s, "\t", " ")
+}
@@ -0,0 +1,504 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/storage"
+)
+
+// ClickHouse 存储后端：日志攒批后通过 HTTP 接口写入 MergeTree 表，查询转换为 SQL 在 ClickHouse 中过滤，
+// 用于每天写入数千万行、按文件扫描已经跟不上的部署。表中每行保存完整的日志记录，
+// 另外拆出应用、日期、时间、级别和 ID 列用于过滤和排序。
+// 写入先进入内存缓冲，攒满 batch_size 条或等待 flush_interval 后批量插入，因此刚上传的日志
+// 最多延迟一个 flush_interval 才能查到；进程异常退出时缓冲中尚未写入的日志会丢失
+type clickhouseStore struct {
+	backend       string
+	endpoint      *url.URL
+	table         string // 已加引号的 数据库.表
+	user          string
+	password      string
+	batchSize     int
+	flushInterval time.Duration
+	http          *http.Client
+
+	mu      sync.Mutex
+	rows    bytes.Buffer // 等待写入的行，JSONEachRow 格式
+	pending int
+	lastSeq int64
+
+	flushMu sync.Mutex // 同一时间只有一个批次在写入
+	kick    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// 缓冲中最多积压的批次数，写入持续失败时超出后拒绝新的日志
+const clickhouseMaxPendingBatches = 10
+
+// 每次按行引用读取的最多行数
+const clickhouseLookupChunk = 1000
+
+var errClickHouseBacklog = errors.New("clickhouse write backlog is full")
+
+var clickhouseIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 写入 ClickHouse 的一行
+type clickhouseRow struct {
+	ApplicationID string `json:"application_id"`
+	File          string `json:"file"`
+	Day           string `json:"day"`
+	Segment       int    `json:"segment"`
+	Seq           int64  `json:"seq"`
+	ID            int64  `json:"id"`
+	Timestamp     string `json:"ts"`
+	Level         string `json:"level"`
+	Record        string `json:"record"`
+}
+
+// ClickHouse 中 DateTime64(9) 的文本格式
+const clickhouseTimeLayout = "2006-01-02 15:04:05.000000000"
+
+func newClickHouseStore(backend string, c BackendConfig) (*clickhouseStore, error) {
+	endpoint, err := url.Parse(c.URL)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url %q", c.URL)
+	}
+	database, table := c.Database, c.Table
+	if database == "" {
+		database = "default"
+	}
+	if table == "" {
+		table = "logs"
+	}
+	if !clickhouseIdentifier.MatchString(database) || !clickhouseIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid database or table name %s.%s", database, table)
+	}
+	s := &clickhouseStore{
+		backend:       backend,
+		endpoint:      endpoint,
+		table:         "`" + database + "`.`" + table + "`",
+		user:          c.User,
+		password:      c.Password,
+		batchSize:     c.BatchSize,
+		flushInterval: time.Duration(c.FlushInterval),
+		kick:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+	// 未在配置中写明密码时使用环境变量
+	if s.password == "" {
+		s.password = os.Getenv("CLICKHOUSE_PASSWORD")
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = 10000
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = 200 * time.Millisecond
+	}
+	var tlsConfig ClientTLSConfig
+	if c.TLS != nil {
+		tlsConfig = *c.TLS
+	}
+	if s.http, err = newTLSHTTPClient(tlsConfig, 5*time.Minute); err != nil {
+		return nil, err
+	}
+
+	// 按应用和写入顺序排序存放，与 file 后端遍历分段的顺序一致
+	err = s.exec(`CREATE TABLE IF NOT EXISTS `+s.table+` (
+		application_id LowCardinality(String),
+		file LowCardinality(String),
+		day Date,
+		segment UInt32,
+		seq Int64,
+		id Int64,
+		ts DateTime64(9, 'UTC'),
+		level LowCardinality(String),
+		record String
+	) ENGINE = MergeTree
+	PARTITION BY toYYYYMM(day)
+	ORDER BY (application_id, day, segment, seq)`, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create table: %v", err)
+	}
+
+	s.wg.Add(1)
+	go s.flushLoop()
+	return s, nil
+}
+
+func (s *clickhouseStore) AppendEntry(applicationID, fileName string, entry LogData) error {
+	day, segment, ok := parseSegmentName(fileName)
+	if !ok {
+		return fmt.Errorf("invalid log file name %q", fileName)
+	}
+	// 与 file 后端一样，日志记录中保存原始的应用 ID
+	entry.ApplicationID = model.BareApplicationID(entry.ApplicationID)
+	record, err := encodeLogRecord(entry)
+	if err != nil {
+		return err
+	}
+	row := clickhouseRow{
+		ApplicationID: applicationID,
+		File:          fileName,
+		Day:           day,
+		Segment:       segment,
+		ID:            entry.ID,
+		Timestamp:     entryTime(entry, logRef{File: fileName}).UTC().Format(clickhouseTimeLayout),
+		Level:         entry.LogLevel,
+		Record:        strings.TrimSuffix(record, "\n"),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending >= s.batchSize*clickhouseMaxPendingBatches {
+		return errClickHouseBacklog
+	}
+	// seq 记录写入顺序，在进程重启后仍保持递增
+	row.Seq = time.Now().UnixNano()
+	if row.Seq <= s.lastSeq {
+		row.Seq = s.lastSeq + 1
+	}
+	s.lastSeq = row.Seq
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	s.rows.Write(append(data, '\n'))
+	s.pending++
+	if s.pending >= s.batchSize {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// 定期写入缓冲中的日志，攒满一批时立即写入
+func (s *clickhouseStore) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.kick:
+		}
+		if err := s.Flush(); err != nil {
+			log.Printf("clickhouse backend %s: flush failed, will retry: %v", s.backend, err)
+		}
+	}
+}
+
+// 写入缓冲中的全部日志，失败时放回缓冲等待重试
+func (s *clickhouseStore) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	for {
+		s.mu.Lock()
+		if s.pending == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		// 每次最多写入 batch_size 条
+		var batch []byte
+		n := 0
+		for n < s.batchSize && s.rows.Len() > 0 {
+			line, _ := s.rows.ReadBytes('\n')
+			batch = append(batch, line...)
+			n++
+		}
+		s.pending -= n
+		s.mu.Unlock()
+
+		if err := s.exec("INSERT INTO "+s.table+" FORMAT JSONEachRow", nil, bytes.NewReader(batch)); err != nil {
+			s.mu.Lock()
+			rest := s.rows.Bytes()
+			var requeued bytes.Buffer
+			requeued.Write(batch)
+			requeued.Write(rest)
+			s.rows = requeued
+			s.pending += n
+			s.mu.Unlock()
+			return err
+		}
+	}
+}
+
+// 停止定期写入并写入剩余的日志
+func (s *clickhouseStore) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	if err := s.Flush(); err != nil {
+		s.mu.Lock()
+		n := s.pending
+		s.mu.Unlock()
+		return fmt.Errorf("%d buffered entries were not written: %v", n, err)
+	}
+	return nil
+}
+
+// 游标只有一项 seq，记录已遍历到的最大写入序号。按日期和分段顺序遍历，与 file 后端一致，
+// 以便迁移校验时两边计算出相同的摘要
+func (s *clickhouseStore) ScanFrom(applicationID string, cursor storage.Cursor, fn func(entry LogData, ref logRef) bool) (storage.Cursor, error) {
+	if err := s.Flush(); err != nil {
+		return cursor, err
+	}
+	last := cursor["seq"]
+	visit := parsedLineVisitor(fn)
+	stopped := false
+	err := s.selectRows("WHERE application_id = {app:String} AND seq > {seq:Int64} ORDER BY day, segment, seq",
+		url.Values{"param_app": {applicationID}, "param_seq": {strconv.FormatInt(cursor["seq"], 10)}},
+		func(seq int64, file, record string) bool {
+			if !visit(record, logRef{ApplicationID: applicationID, File: file, Offset: seq}) {
+				stopped = true
+				return false
+			}
+			if seq > last {
+				last = seq
+			}
+			return true
+		})
+	if err != nil || stopped {
+		// 未遍历完时不推进游标
+		return cursor, err
+	}
+	return storage.Cursor{"seq": last}, nil
+}
+
+func (s *clickhouseStore) RemoveApplication(applicationID string) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.exec("ALTER TABLE "+s.table+" DELETE WHERE application_id = {app:String}",
+		url.Values{"param_app": {applicationID}, "mutations_sync": {"2"}}, nil)
+}
+
+// 按查询条件中能在 SQL 中过滤的部分（级别、时间范围、ID 范围）遍历原始日志行，
+// 级别与 file 后端一样对整条记录做子串匹配。行引用的 Offset 为行的写入序号，查询取消或超时后停止读取
+func (s *clickhouseStore) ScanLines(q storage.Filter, fn func(line string, ref logRef) bool) error {
+	where, params := clickhouseConditions(q)
+	ctx := q.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var cancelled error
+	n := 0
+	err := s.selectRows(where+" ORDER BY day, segment, seq", params, func(seq int64, file, record string) bool {
+		if n++; n%cancelCheckLines == 0 {
+			if cancelled = ctx.Err(); cancelled != nil {
+				return false
+			}
+		}
+		return fn(record, logRef{ApplicationID: q.ApplicationID, File: file, Offset: seq})
+	})
+	if err == nil {
+		err = cancelled
+	}
+	return err
+}
+
+// 在 ClickHouse 中统计满足级别、时间范围和 ID 范围的条数
+func (s *clickhouseStore) Count(q storage.Filter) (int, error) {
+	where, params := clickhouseConditions(q)
+	var n int
+	err := s.query("SELECT count() AS n FROM "+s.table+" "+where, params, func(dec *json.Decoder) error {
+		var row struct {
+			N int `json:"n"`
+		}
+		if err := dec.Decode(&row); err != nil {
+			return err
+		}
+		n = row.N
+		return nil
+	})
+	return n, err
+}
+
+// 按行引用读取原始日志行，refs 须为同一应用，返回写入序号 → 日志行
+func (s *clickhouseStore) Lines(applicationID string, refs []logRef) (map[int64]string, error) {
+	lines := make(map[int64]string, len(refs))
+	for start := 0; start < len(refs); start += clickhouseLookupChunk {
+		end := start + clickhouseLookupChunk
+		if end > len(refs) {
+			end = len(refs)
+		}
+		seqs := make([]string, 0, end-start)
+		for _, ref := range refs[start:end] {
+			seqs = append(seqs, strconv.FormatInt(ref.Offset, 10))
+		}
+		err := s.selectRows("WHERE application_id = {app:String} AND seq IN {seqs:Array(Int64)}",
+			url.Values{"param_app": {applicationID}, "param_seqs": {"[" + strings.Join(seqs, ",") + "]"}},
+			func(seq int64, file, record string) bool {
+				lines[seq] = record
+				return true
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+// 后端中有日志的应用
+func (s *clickhouseStore) Applications() ([]string, error) {
+	var apps []string
+	err := s.query("SELECT DISTINCT application_id FROM "+s.table+" ORDER BY application_id", nil, func(dec *json.Decoder) error {
+		for {
+			var row struct {
+				ApplicationID string `json:"application_id"`
+			}
+			if err := dec.Decode(&row); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			apps = append(apps, row.ApplicationID)
+		}
+	})
+	return apps, err
+}
+
+// 应用已写入的最大日志 ID
+func (s *clickhouseStore) LastID(applicationID string) (int64, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.query("SELECT max(id) AS id FROM "+s.table+" WHERE application_id = {app:String}",
+		url.Values{"param_app": {applicationID}}, func(dec *json.Decoder) error {
+			var row struct {
+				ID int64 `json:"id"`
+			}
+			if err := dec.Decode(&row); err != nil {
+				return err
+			}
+			id = row.ID
+			return nil
+		})
+	return id, err
+}
+
+// 将查询条件转换为 WHERE 子句和查询参数。日期条件与 file 后端跳过旧分段的规则一致，用于按分区裁剪
+func clickhouseConditions(q storage.Filter) (string, url.Values) {
+	conds := []string{"application_id = {app:String}"}
+	params := url.Values{"param_app": {q.ApplicationID}}
+	if q.LogLevel != "" {
+		conds = append(conds, "level = {level:String}")
+		params.Set("param_level", q.LogLevel)
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, "day >= {from_day:Date}", "ts >= fromUnixTimestamp64Nano({from:Int64})")
+		params.Set("param_from_day", q.From.AddDate(0, 0, -2).Format("2006-01-02"))
+		params.Set("param_from", strconv.FormatInt(q.From.UnixNano(), 10))
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, "ts <= fromUnixTimestamp64Nano({to:Int64})")
+		params.Set("param_to", strconv.FormatInt(q.To.UnixNano(), 10))
+	}
+	if q.SinceID > 0 {
+		conds = append(conds, "id > {since_id:Int64}")
+		params.Set("param_since_id", strconv.FormatInt(q.SinceID, 10))
+	}
+	if q.MaxID > 0 {
+		conds = append(conds, "id <= {max_id:Int64}")
+		params.Set("param_max_id", strconv.FormatInt(q.MaxID, 10))
+	}
+	return "WHERE " + strings.Join(conds, " AND "), params
+}
+
+// 按条件读取行，fn 返回 false 时停止读取
+func (s *clickhouseStore) selectRows(clause string, params url.Values, fn func(seq int64, file, record string) bool) error {
+	return s.query("SELECT seq, file, record FROM "+s.table+" "+clause, params, func(dec *json.Decoder) error {
+		for {
+			var row struct {
+				Seq    int64  `json:"seq"`
+				File   string `json:"file"`
+				Record string `json:"record"`
+			}
+			if err := dec.Decode(&row); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if !fn(row.Seq, row.File, row.Record) {
+				return nil
+			}
+		}
+	})
+}
+
+// 执行查询，结果按 JSONEachRow 格式逐行交给 read 解码
+func (s *clickhouseStore) query(sql string, params url.Values, read func(dec *json.Decoder) error) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("output_format_json_quote_64bit_integers", "0")
+	resp, err := s.do(sql+" FORMAT JSONEachRow", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return read(json.NewDecoder(resp.Body))
+}
+
+// 执行不返回结果的语句，body 不为 nil 时作为 INSERT 的数据
+func (s *clickhouseStore) exec(sql string, params url.Values, body io.Reader) error {
+	resp, err := s.do(sql, params, body)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// 通过 HTTP 接口执行语句：没有数据时语句放在请求体中，否则放在 query 参数中
+func (s *clickhouseStore) do(sql string, params url.Values, body io.Reader) (*http.Response, error) {
+	values := url.Values{}
+	for k, v := range params {
+		values[k] = v
+	}
+	if body != nil {
+		values.Set("query", sql)
+	} else {
+		body = strings.NewReader(sql)
+	}
+	u := *s.endpoint
+	u.RawQuery = values.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if s.user != "" {
+		req.Header.Set("X-ClickHouse-User", s.user)
+		req.Header.Set("X-ClickHouse-Key", s.password)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("clickhouse: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
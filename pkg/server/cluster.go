@@ -0,0 +1,710 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 集群部署：多个实例位于负载均衡之后，每个应用按 ID 的哈希归属一个节点，该应用的写入只由所属节点执行。
+// partitioned 模式下各节点有独立的存储，读写请求都转发给所属节点；
+// shared 模式下各节点挂载同一存储（NFS 等），只转发写入，读取在收到请求的节点直接完成，
+// 所属节点不可用时写入交给下一个存活的节点。
+// 应用的归属只取决于 members，增加节点后部分应用的归属会变化，partitioned 模式下需先迁移这些应用的数据
+type ClusterConfig struct {
+	Node              string          `json:"node"`               // 本节点名称，须是 members 之一；为空时不启用集群
+	Mode              string          `json:"mode"`               // partitioned（默认）或 shared
+	Members           []ClusterMember `json:"members"`            // 全部节点，各节点的配置须一致
+	Token             string          `json:"token"`              // 节点之间转发请求时携带的共享密钥
+	HeartbeatInterval Duration        `json:"heartbeat_interval"` // 探测其他节点的间隔，默认 5s
+	TLS               ClientTLSConfig `json:"tls"`                // 访问其他节点时的证书配置
+}
+
+// 集群中的节点
+type ClusterMember struct {
+	Name string `json:"name"`
+	URL  string `json:"url"` // 节点的服务地址，如 http://10.0.0.1:8080
+}
+
+// 集群模式
+const (
+	clusterPartitioned = "partitioned"
+	clusterShared      = "shared"
+)
+
+// 节点之间转发的请求带有来源节点和共享密钥，接收方直接处理，不再转发
+const (
+	clusterForwardedHeader = "X-Cluster-Forwarded"
+	clusterTokenHeader     = "X-Cluster-Token"
+	clusterSourceHeader    = "X-Cluster-Source-IP" // 上传方的地址，接收方的 enrich 处理器以此作为来源
+)
+
+var (
+	clusterForwarded     = metrics.counter("cluster_forwarded_total", "Requests forwarded to the owning node, by node.")
+	clusterForwardErrors = metrics.counter("cluster_forward_errors_total", "Requests that could not be forwarded, by node.")
+	clusterMemberUp      = metrics.gauge("cluster_member_up", "Whether the last heartbeat to a cluster member succeeded.")
+)
+
+// 节点状态
+type memberStatus struct {
+	Name     string     `json:"name"`
+	URL      string     `json:"url"`
+	Self     bool       `json:"self"`
+	Live     bool       `json:"live"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+type clusterState struct {
+	svc      *Service
+	self     string
+	mode     string
+	token    string
+	members  []ClusterMember
+	proxies  map[string]*httputil.ReverseProxy
+	client   *http.Client
+	interval time.Duration
+
+	mu     sync.RWMutex
+	status map[string]*memberStatus
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// 校验集群配置并开始探测其他节点，未配置 node 时返回 nil
+func (s *Service) startCluster(c ClusterConfig) (*clusterState, error) {
+	if c.Node == "" {
+		return nil, nil
+	}
+	mode := c.Mode
+	if mode == "" {
+		mode = clusterPartitioned
+	}
+	if mode != clusterPartitioned && mode != clusterShared {
+		return nil, fmt.Errorf("mode must be %s or %s", clusterPartitioned, clusterShared)
+	}
+	if c.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	client, err := newTLSHTTPClient(c.TLS, 0)
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(c.HeartbeatInterval)
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	cluster := &clusterState{
+		svc:      s,
+		self:     c.Node,
+		mode:     mode,
+		token:    c.Token,
+		proxies:  make(map[string]*httputil.ReverseProxy),
+		client:   client,
+		interval: interval,
+		status:   make(map[string]*memberStatus),
+		stop:     make(chan struct{}),
+	}
+	for _, m := range c.Members {
+		if m.Name == "" || cluster.status[m.Name] != nil {
+			return nil, fmt.Errorf("member names must be unique and not empty")
+		}
+		u, err := url.Parse(m.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("member %s: invalid url %q", m.Name, m.URL)
+		}
+		cluster.members = append(cluster.members, m)
+		// 启动时假定节点存活，由心跳更正
+		cluster.status[m.Name] = &memberStatus{Name: m.Name, URL: m.URL, Self: m.Name == c.Node, Live: true}
+		if m.Name != c.Node {
+			cluster.proxies[m.Name] = cluster.newProxy(m.Name, u)
+		}
+	}
+	if cluster.status[c.Node] == nil {
+		return nil, fmt.Errorf("node %s is not in members", c.Node)
+	}
+
+	cluster.wg.Add(1)
+	go cluster.heartbeat()
+	return cluster, nil
+}
+
+// 转发到指定节点的反向代理，保持原始路径和查询参数，流式响应（如 /tail）立即刷新
+func (s *clusterState) newProxy(name string, target *url.URL) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = s.client.Transport
+	proxy.FlushInterval = -1
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = target.Host
+		req.Header.Set(clusterForwardedHeader, s.self)
+		req.Header.Set(clusterTokenHeader, s.token)
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		clusterForwardErrors.Add(1, "node", name)
+		log.Printf("forward %s %s to %s failed: %v", req.Method, req.URL.Path, name, err)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":"Owner node unavailable"}`))
+	}
+	return proxy
+}
+
+// 定期探测其他节点
+func (s *clusterState) heartbeat() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		for _, m := range s.members {
+			if m.Name != s.self {
+				s.probe(m)
+			}
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *clusterState) probe(m ClusterMember) {
+	err := func() error {
+		req, err := http.NewRequest(http.MethodGet, strings.TrimRight(m.URL, "/")+"/cluster/health", nil)
+		if err != nil {
+			return err
+		}
+		client := *s.client
+		client.Timeout = 2 * time.Second
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var health struct {
+			Node string `json:"node"`
+		}
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&health) != nil {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		if health.Node != m.Name {
+			return fmt.Errorf("url is served by node %q", health.Node)
+		}
+		return nil
+	}()
+
+	s.mu.Lock()
+	st := s.status[m.Name]
+	if err != nil {
+		if st.Live {
+			log.Printf("cluster member %s is down: %v", m.Name, err)
+		}
+		st.Live, st.Error = false, err.Error()
+		clusterMemberUp.Set(0, "node", m.Name)
+	} else {
+		if !st.Live {
+			log.Printf("cluster member %s is up", m.Name)
+		}
+		now := time.Now()
+		st.Live, st.Error, st.LastSeen = true, "", &now
+		clusterMemberUp.Set(1, "node", m.Name)
+	}
+	s.mu.Unlock()
+}
+
+// 停止探测
+func (s *clusterState) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	return nil
+}
+
+// 应用的归属节点：按最高随机权重（rendezvous）哈希在节点中选出，
+// shared 模式下跳过已知不可用的节点
+func (s *clusterState) Owner(applicationID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var owner string
+	var best uint64
+	for _, m := range s.members {
+		if s.mode == clusterShared && !s.status[m.Name].Live {
+			continue
+		}
+		if score := rendezvousScore(m.Name, applicationID); owner == "" || score > best {
+			owner, best = m.Name, score
+		}
+	}
+	if owner == "" {
+		return s.self
+	}
+	return owner
+}
+
+// 节点对应用的权重。FNV 的结果再经过 splitmix64 的混合，否则只差一个字节的节点名权重高位几乎相同
+func rendezvousScore(node, applicationID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(node + "\x00" + applicationID))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// 应用是否由本节点负责写入和后台处理（压缩、分层）
+func (s *clusterState) Owns(applicationID string) bool {
+	return s == nil || s.Owner(applicationID) == s.self
+}
+
+// 后台任务（压缩、分层）是否处理后端目录中的应用：共享存储上只由归属节点处理，避免多个节点同时改写同一分段
+func (s *clusterState) OwnsFolder(backend, dir string) bool {
+	if s == nil || s.mode != clusterShared {
+		return true
+	}
+	applicationID := dir
+	if isTenantBackend(backend) {
+		applicationID = strings.TrimPrefix(backend, tenantBackendPrefix) + model.TenantSeparator + dir
+	}
+	return s.Owns(applicationID)
+}
+
+// 节点列表及状态
+func (s *clusterState) Members() []memberStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	members := make([]memberStatus, 0, len(s.members))
+	for _, m := range s.members {
+		members = append(members, *s.status[m.Name])
+	}
+	return members
+}
+
+// 将请求转发给指定节点
+func (s *clusterState) forward(c *gin.Context, node string) {
+	clusterForwarded.Add(1, "node", node)
+	c.Request.Header.Set(clusterSourceHeader, s.svc.requestSourceIP(c))
+	s.proxies[node].ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
+
+// 向其他节点发送请求，返回状态码和响应体
+func (s *clusterState) send(node, method, uri string, header http.Header, body []byte) (int, []byte, error) {
+	var base string
+	for _, m := range s.members {
+		if m.Name == node {
+			base = strings.TrimRight(m.URL, "/")
+		}
+	}
+	req, err := http.NewRequest(method, base+uri, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set(clusterForwardedHeader, s.self)
+	req.Header.Set(clusterTokenHeader, s.token)
+	client := *s.client
+	client.Timeout = time.Minute
+	resp, err := client.Do(req)
+	if err != nil {
+		clusterForwardErrors.Add(1, "node", node)
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	clusterForwarded.Add(1, "node", node)
+	return resp.StatusCode, data, err
+}
+
+// 集群中间件：校验其他节点转发来的请求，标记后的请求不再转发
+func (s *Service) clusterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(clusterForwardedHeader) == "" {
+			c.Next()
+			return
+		}
+		if s.cluster == nil || subtle.ConstantTimeCompare([]byte(c.GetHeader(clusterTokenHeader)), []byte(s.cluster.token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid cluster token"})
+			return
+		}
+		c.Set("cluster.forwarded", true)
+		c.Next()
+	}
+}
+
+// 需要转发时返回 false
+func (s *Service) clusterLocal(c *gin.Context) bool {
+	return s.cluster == nil || c.GetBool("cluster.forwarded")
+}
+
+// 路由中间件：application_id 参数中的应用都归属同一个其他节点时转发给该节点。
+// 写入请求在两种模式下都转发，读取请求只在 partitioned 模式下转发；
+// 涉及多个节点的应用或未指定应用的读取只覆盖本节点上的数据。
+// 其他节点不再校验转发的请求，因此转发前先校验用户对应用的权限
+func (s *Service) clusterRoute(write bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.clusterLocal(c) || (!write && s.cluster.mode == clusterShared) || c.Query("view") != "" {
+			c.Next()
+			return
+		}
+		owner := ""
+		apps := splitList(c.Query("application_id"))
+		// 路径中带应用的接口，如 /applications/:application_id/files
+		if app := c.Param("application_id"); app != "" {
+			apps = []string{app}
+		}
+		for _, app := range apps {
+			// 通配模式和分组匹配的应用可能分布在多个节点，在本节点查询
+			if isApplicationPattern(app) || isGroupReference(app) {
+				c.Next()
+				return
+			}
+			if !authorizeApplication(c, clusterKey(c, app)) {
+				c.Abort()
+				return
+			}
+			node := s.cluster.Owner(clusterKey(c, app))
+			if owner != "" && node != owner {
+				c.Next()
+				return
+			}
+			owner = node
+		}
+		if owner == "" || owner == s.cluster.self {
+			c.Next()
+			return
+		}
+		s.cluster.forward(c, owner)
+	}
+}
+
+// 计算归属使用的应用 ID，租户接口下带租户前缀
+func clusterKey(c *gin.Context, applicationID string) string {
+	if tenant := c.Param("tenant"); tenant != "" {
+		return tenant + model.TenantSeparator + applicationID
+	}
+	return applicationID
+}
+
+// 请求体中带应用 ID 的上传（/upload、/upload/batch）的路由中间件。
+// 批量上传中的日志分属多个节点时按节点拆分转发，再合并各节点的结果
+func (s *Service) clusterRouteBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.clusterLocal(c) {
+			c.Next()
+			return
+		}
+		body, ok := s.readUploadBody(c)
+		if !ok {
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		type owned struct {
+			ApplicationID string `json:"application_id"`
+		}
+		// 无法解析的请求体交给本节点的处理函数返回错误
+		if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+			var entry owned
+			if json.Unmarshal(body, &entry) != nil || entry.ApplicationID == "" {
+				c.Next()
+				return
+			}
+			if !authorizeApplication(c, clusterKey(c, entry.ApplicationID)) {
+				c.Abort()
+				return
+			}
+			if owner := s.cluster.Owner(clusterKey(c, entry.ApplicationID)); owner != s.cluster.self {
+				s.cluster.forward(c, owner)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		var raw []json.RawMessage
+		if json.Unmarshal(body, &raw) != nil {
+			c.Next()
+			return
+		}
+		groups := make(map[string][]json.RawMessage)
+		positions := make(map[string][]int) // 各组日志在原请求中的位置，用于按原顺序合并 ID
+		partial := c.Query("partial") == "true"
+		for i, r := range raw {
+			var entry owned
+			json.Unmarshal(r, &entry)
+			owner := s.cluster.self
+			if entry.ApplicationID != "" {
+				key := clusterKey(c, entry.ApplicationID)
+				// 部分成功的批量上传中无权访问的日志留在本节点，由处理函数逐条拒绝
+				if partial && !applicationAllowed(c, key) {
+					groups[owner] = append(groups[owner], r)
+					positions[owner] = append(positions[owner], i)
+					continue
+				}
+				if !authorizeApplication(c, key) {
+					c.Abort()
+					return
+				}
+				owner = s.cluster.Owner(key)
+			}
+			groups[owner] = append(groups[owner], r)
+			positions[owner] = append(positions[owner], i)
+		}
+		if len(groups) == 1 {
+			for owner := range groups {
+				if owner == s.cluster.self {
+					c.Next()
+				} else {
+					s.cluster.forward(c, owner)
+				}
+			}
+			return
+		}
+		s.forwardBatchGroups(c, groups, positions)
+	}
+}
+
+// 将拆分后的批量上传分别发给各节点（包括本节点），任何一组失败时返回该组的错误。
+// 各组返回的日志 ID 按 positions 放回原请求中的位置；部分成功的批量上传见 forwardPartialBatchGroups
+func (s *Service) forwardBatchGroups(c *gin.Context, groups map[string][]json.RawMessage, positions map[string][]int) {
+	if c.Query("partial") == "true" {
+		s.forwardPartialBatchGroups(c, groups, positions)
+		return
+	}
+	header := c.Request.Header.Clone()
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	header.Set(clusterSourceHeader, s.requestSourceIP(c))
+	// 各组分别做幂等处理
+	idempotencyKey := header.Get("Idempotency-Key")
+
+	var accepted, duplicates, dropped, total int
+	for _, list := range groups {
+		total += len(list)
+	}
+	ids := make([]int64, total)
+	for _, node := range sortedKeys(groups) {
+		body, _ := json.Marshal(groups[node])
+		if idempotencyKey != "" {
+			header.Set("Idempotency-Key", idempotencyKey+"/"+node)
+		}
+		status, data, err := s.cluster.send(node, http.MethodPost, c.Request.URL.RequestURI(), header, body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "Owner node unavailable", "accepted": accepted})
+			return
+		}
+		var result struct {
+			Accepted   int     `json:"accepted"`
+			Duplicates int     `json:"duplicates"`
+			Dropped    int     `json:"dropped"`
+			IDs        []int64 `json:"ids"`
+		}
+		json.Unmarshal(data, &result)
+		if status != http.StatusOK {
+			var failed map[string]interface{}
+			if json.Unmarshal(data, &failed) != nil {
+				failed = gin.H{"error": "Owner node failed"}
+			}
+			failed["accepted"] = accepted + result.Accepted
+			c.AbortWithStatusJSON(status, failed)
+			return
+		}
+		accepted += result.Accepted
+		duplicates += result.Duplicates
+		dropped += result.Dropped
+		for i, id := range result.IDs {
+			if i < len(positions[node]) {
+				ids[positions[node][i]] = id
+			}
+		}
+	}
+	auditCount(c, accepted-duplicates-dropped)
+	c.AbortWithStatusJSON(http.StatusOK, gin.H{"message": "Logs uploaded successfully", "accepted": accepted, "duplicates": duplicates, "dropped": dropped, "ids": ids})
+}
+
+// 部分成功的批量上传：各组的逐条结果按 positions 合并，一组失败或节点不可达时该组的日志全部记为被拒绝，
+// 其余组的结果照常返回
+func (s *Service) forwardPartialBatchGroups(c *gin.Context, groups map[string][]json.RawMessage, positions map[string][]int) {
+	header := c.Request.Header.Clone()
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	header.Set(clusterSourceHeader, s.requestSourceIP(c))
+	idempotencyKey := header.Get("Idempotency-Key")
+
+	var total int
+	for _, list := range groups {
+		total += len(list)
+	}
+	results := make([]EntryResult, total)
+	for _, node := range sortedKeys(groups) {
+		body, _ := json.Marshal(groups[node])
+		if idempotencyKey != "" {
+			header.Set("Idempotency-Key", idempotencyKey+"/"+node)
+		}
+		status, data, err := s.cluster.send(node, http.MethodPost, c.Request.URL.RequestURI(), header, body)
+		var result struct {
+			Error   string        `json:"error"`
+			Results []EntryResult `json:"results"`
+		}
+		if err == nil {
+			json.Unmarshal(data, &result)
+		}
+		if err != nil || (status != http.StatusOK && status != http.StatusMultiStatus) || len(result.Results) != len(groups[node]) {
+			failed := EntryResult{Status: EntryRejected, Reason: "node_failed", Error: "Owner node unavailable", Retryable: true}
+			if err == nil {
+				if result.Error != "" {
+					failed.Error = result.Error
+				}
+				failed.Retryable = status >= 500 || status == http.StatusTooManyRequests
+			}
+			for _, i := range positions[node] {
+				failed.Index = i
+				results[i] = failed
+			}
+			continue
+		}
+		for j, r := range result.Results {
+			r.Index = positions[node][j]
+			results[r.Index] = r
+		}
+	}
+
+	status, body, written := batchResultResponse(results)
+	auditCount(c, written)
+	c.AbortWithStatusJSON(status, body)
+}
+
+// 广播中间件：本节点处理成功的元数据修改（如告警规则）在后台同样发给其他节点，保持各节点一致
+func (s *Service) clusterBroadcast() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.clusterLocal(c) {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unable to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+		if c.Writer.Status() >= 300 {
+			return
+		}
+		if v, ok := c.Get("cluster.broadcast_body"); ok {
+			body = v.([]byte)
+		}
+
+		method, uri, header := c.Request.Method, c.Request.URL.RequestURI(), c.Request.Header.Clone()
+		for _, m := range s.cluster.members {
+			if m.Name == s.cluster.self {
+				continue
+			}
+			go func(node string) {
+				status, data, err := s.cluster.send(node, method, uri, header, body)
+				if err == nil && status >= 300 {
+					err = fmt.Errorf("status %d: %s", status, data)
+				}
+				if err != nil {
+					log.Printf("broadcast %s %s to %s failed: %v", method, uri, node, err)
+				}
+			}(m.Name)
+		}
+	}
+}
+
+// 服务端补全了请求中的值（如生成的 API Key）时，用补全后的请求体广播给其他节点
+func clusterBroadcastBody(c *gin.Context, v interface{}) {
+	if body, err := json.Marshal(v); err == nil {
+		c.Set("cluster.broadcast_body", body)
+	}
+}
+
+// 合并其他节点上的应用列表，partitioned 模式下各节点只存有归属自己的应用
+func (s *Service) clusterApplications(c *gin.Context, local []string) []string {
+	if s.clusterLocal(c) || s.cluster.mode != clusterPartitioned {
+		return local
+	}
+	apps := make(map[string]bool, len(local))
+	for _, app := range local {
+		apps[app] = true
+	}
+	for _, m := range s.cluster.Members() {
+		if m.Self || !m.Live {
+			continue
+		}
+		status, data, err := s.cluster.send(m.Name, http.MethodGet, "/applications", nil, nil)
+		var result struct {
+			Applications []string `json:"applications"`
+		}
+		if err != nil || status != http.StatusOK || json.Unmarshal(data, &result) != nil {
+			log.Printf("list applications on %s failed: %v", m.Name, err)
+			continue
+		}
+		for _, app := range result.Applications {
+			apps[app] = true
+		}
+	}
+	return sortedKeys(apps)
+}
+
+// 节点健康检查接口，供其他节点探测
+func (s *Service) clusterHealthHandler(c *gin.Context) {
+	node := ""
+	if s.cluster != nil {
+		node = s.cluster.self
+	}
+	c.JSON(http.StatusOK, gin.H{"node": node, "status": "ok"})
+}
+
+// 集群节点列表接口
+func (s *Service) clusterMembersHandler(c *gin.Context) {
+	if s.cluster == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster mode is not enabled"})
+		return
+	}
+	members := s.cluster.Members()
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	c.JSON(http.StatusOK, gin.H{"node": s.cluster.self, "mode": s.cluster.mode, "members": members})
+}
+
+// 应用归属查询接口
+func (s *Service) clusterOwnerHandler(c *gin.Context) {
+	if s.cluster == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster mode is not enabled"})
+		return
+	}
+	applicationID := c.Query("application_id")
+	if !validApplicationID(applicationID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+	key := applicationID
+	if tenant := c.Query("tenant"); tenant != "" {
+		key = tenant + model.TenantSeparator + applicationID
+	}
+	c.JSON(http.StatusOK, gin.H{"application_id": applicationID, "tenant": c.Query("tenant"), "node": s.cluster.Owner(key)})
+}
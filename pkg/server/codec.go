@@ -0,0 +1,178 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// 不压缩，用于让某个存储类别保留原文件
+const codecNone = "none"
+
+// 分段压缩编码。压缩文件以编码的后缀区分，查询时按后缀透明地解压，
+// 更换编码后已压缩的分段无需重新压缩
+type segmentCodec struct {
+	name      string
+	suffix    string
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	newReader func(io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	gzipCodec = &segmentCodec{
+		name:      "gzip",
+		suffix:    ".gz",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+	zstdCodec = &segmentCodec{
+		name:      "zstd",
+		suffix:    ".zst",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			// 查询同时打开的分段可能很多，单个解码器不使用额外的并发
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	}
+	lz4Codec = &segmentCodec{
+		name:      "lz4",
+		suffix:    ".lz4",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil },
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(lz4.NewReader(r)), nil },
+	}
+)
+
+// 可识别的压缩编码，按查找压缩文件的顺序排列，gzip 为默认编码
+var segmentCodecs = []*segmentCodec{gzipCodec, zstdCodec, lz4Codec}
+
+// 按名称查找压缩编码，为空时使用 gzip，none 时返回 nil
+func lookupSegmentCodec(name string) (*segmentCodec, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return gzipCodec, nil
+	case codecNone:
+		return nil, nil
+	}
+	for _, codec := range segmentCodecs {
+		if strings.EqualFold(codec.name, name) {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q (expected none, gzip, zstd or lz4)", name)
+}
+
+// 按文件名后缀识别压缩编码，未压缩的文件返回 nil
+func codecOfFile(name string) *segmentCodec {
+	for _, codec := range segmentCodecs {
+		if strings.HasSuffix(name, codec.suffix) {
+			return codec
+		}
+	}
+	return nil
+}
+
+// 去掉压缩文件的后缀
+func trimCompressedSuffix(name string) string {
+	if codec := codecOfFile(name); codec != nil {
+		return strings.TrimSuffix(name, codec.suffix)
+	}
+	return name
+}
+
+// 分段各编码压缩文件的路径
+func compressedPaths(path string) []string {
+	paths := make([]string, len(segmentCodecs))
+	for i, codec := range segmentCodecs {
+		paths[i] = path + codec.suffix
+	}
+	return paths
+}
+
+// 查找分段的压缩文件，不存在时返回空串
+func compressedSegmentPath(path string) (string, os.FileInfo) {
+	for _, p := range compressedPaths(path) {
+		if info, err := os.Stat(p); err == nil {
+			return p, info
+		}
+	}
+	return "", nil
+}
+
+// 压缩文件的读取器，关闭时同时关闭底层文件
+type compressedFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (f *compressedFile) Close() error {
+	f.ReadCloser.Close()
+	return f.file.Close()
+}
+
+// 按后缀打开压缩文件
+func openCompressedFile(path string) (io.ReadCloser, error) {
+	codec := codecOfFile(path)
+	if codec == nil {
+		return nil, fmt.Errorf("%s: not a compressed file", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := codec.newReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &compressedFile{ReadCloser: reader, file: file}, nil
+}
+
+// 将文件压缩为同目录下带编码后缀的文件，保留原文件
+func compressFileWith(path string, codec *segmentCodec) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + codec.suffix + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw, err := codec.newWriter(dst)
+	if err == nil {
+		_, err = io.Copy(zw, src)
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+codec.suffix)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// 检查 rotation 中的压缩编码
+func (c RotationConfig) validate() error {
+	_, err := lookupSegmentCodec(c.Codec)
+	return err
+}
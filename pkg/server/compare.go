@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+)
+
+// 两个时间窗口的对比，如本周与上周、发布前与发布后：按应用比较错误量和全局事务回滚率，
+// 并按统计检验标出显著的变化。两个窗口长度不同时错误量按每小时的速率比较
+const (
+	significanceInsufficient = "insufficient_data" // 样本太少，不做判断
+	significanceNone         = "not_significant"
+	significanceSignificant  = "significant"        // |z| ≥ 1.96，约 p < 0.05
+	significanceHigh         = "highly_significant" // |z| ≥ 2.58，约 p < 0.01
+)
+
+// 做检验所需的最少样本：错误量为两个窗口之和，回滚率为每个窗口结束的事务数
+const compareMinSamples = 5
+
+type compareWindow struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+func (w compareWindow) hours() float64 {
+	return w.To.Sub(w.From).Hours()
+}
+
+// 错误量的对比
+type countDiff struct {
+	Baseline        int      `json:"baseline"`
+	Current         int      `json:"current"`
+	BaselinePerHour float64  `json:"baseline_per_hour"`
+	CurrentPerHour  float64  `json:"current_per_hour"`
+	ChangePct       *float64 `json:"change_pct,omitempty"` // 每小时速率的变化百分比，基线为零时省略
+	Direction       string   `json:"direction"`            // up、down 或 unchanged
+	Z               float64  `json:"z"`
+	Significance    string   `json:"significance"`
+}
+
+// 回滚率的对比，回滚包括回滚成功、超时回滚和回滚失败，分母为窗口内结束的事务
+type rateDiff struct {
+	BaselineTransactions int     `json:"baseline_transactions"`
+	CurrentTransactions  int     `json:"current_transactions"`
+	BaselineRollbacks    int     `json:"baseline_rollbacks"`
+	CurrentRollbacks     int     `json:"current_rollbacks"`
+	BaselineRate         float64 `json:"baseline_rate"`
+	CurrentRate          float64 `json:"current_rate"`
+	ChangePoints         float64 `json:"change_points"` // 百分点
+	Direction            string  `json:"direction"`
+	Z                    float64 `json:"z"`
+	Significance         string  `json:"significance"`
+}
+
+// 一个应用的对比结果
+type applicationComparison struct {
+	ApplicationID string    `json:"application_id"`
+	BaselineLogs  int       `json:"baseline_logs"`
+	CurrentLogs   int       `json:"current_logs"`
+	Errors        countDiff `json:"errors"` // ERROR 和 FATAL 级别的日志
+	RollbackRate  rateDiff  `json:"rollback_rate"`
+}
+
+// 对比接口的响应
+type comparisonReport struct {
+	Baseline     compareWindow           `json:"baseline"`
+	Current      compareWindow           `json:"current"`
+	Applications []applicationComparison `json:"applications"` // 按应用 ID 排列
+	Total        applicationComparison   `json:"total"`        // 所选应用的合计，事务只计一次
+}
+
+// 一个窗口内按应用统计的日志、错误和事务
+type windowStats struct {
+	logs, errors           map[string]int
+	finished, rolledBack   map[string]int
+	totalFinished, totalRB int
+}
+
+// 统计一个窗口，事务按 XID 汇总后计入其涉及的每个应用，合计中只计一次
+func (s *Service) collectWindowStats(ctx context.Context, apps []string, w compareWindow) (windowStats, error) {
+	stats := windowStats{logs: make(map[string]int), errors: make(map[string]int), finished: make(map[string]int), rolledBack: make(map[string]int)}
+	tracker := analysis.NewTransactionTracker()
+	counter := analyzerFunc(func(entry LogData, ref logRef, at time.Time) {
+		stats.logs[ref.ApplicationID]++
+		if levelRanks[entry.LogLevel] >= levelRanks["ERROR"] {
+			stats.errors[ref.ApplicationID]++
+		}
+		tracker.Observe(entry, ref, at)
+	})
+	if err := s.runAnalyzers(ctx, apps, w.From, w.To, []analysis.Analyzer{counter}); err != nil {
+		return stats, err
+	}
+	for _, tx := range tracker.Summaries(w.To, time.Duration(s.cfg.TransactionHangWindow)) {
+		rolledBack := false
+		switch {
+		case tx.Status == analysis.StatusRolledBack || tx.Status == analysis.StatusTimedOut || tx.TerminalEvent == analysis.EventRollbackFailed:
+			rolledBack = true
+		case tx.Status == analysis.StatusCommitted || tx.TerminalEvent == analysis.EventCommitFailed:
+		default:
+			continue
+		}
+		stats.totalFinished++
+		if rolledBack {
+			stats.totalRB++
+		}
+		for _, app := range tx.ApplicationIDs {
+			stats.finished[app]++
+			if rolledBack {
+				stats.rolledBack[app]++
+			}
+		}
+	}
+	return stats, nil
+}
+
+// 函数形式的分析器
+type analyzerFunc func(entry LogData, ref logRef, at time.Time)
+
+func (f analyzerFunc) Observe(entry LogData, ref logRef, at time.Time) { f(entry, ref, at) }
+func (analyzerFunc) Findings() []Finding                               { return nil }
+
+// 比较两个窗口的错误量：给定两个窗口之和，当前窗口的条数在速率不变时服从按窗口长度分配的二项分布，按正态近似计算 z
+func compareCounts(baseline, current int, base, cur compareWindow) countDiff {
+	d := countDiff{Baseline: baseline, Current: current}
+	bh, ch := base.hours(), cur.hours()
+	d.BaselinePerHour = roundTo(float64(baseline)/bh, 3)
+	d.CurrentPerHour = roundTo(float64(current)/ch, 3)
+	d.Direction = direction(float64(current)/ch - float64(baseline)/bh)
+	if baseline > 0 {
+		pct := roundTo((float64(current)/ch/(float64(baseline)/bh)-1)*100, 1)
+		d.ChangePct = &pct
+	}
+	n := float64(baseline + current)
+	if baseline+current < compareMinSamples {
+		d.Significance = significanceInsufficient
+		return d
+	}
+	p := ch / (bh + ch)
+	d.Z = roundTo((float64(current)-n*p)/math.Sqrt(n*p*(1-p)), 2)
+	d.Significance = significanceOf(d.Z)
+	return d
+}
+
+// 比较两个窗口的回滚率，两比例 z 检验
+func compareRates(baseTx, baseRB, curTx, curRB int) rateDiff {
+	d := rateDiff{BaselineTransactions: baseTx, CurrentTransactions: curTx, BaselineRollbacks: baseRB, CurrentRollbacks: curRB}
+	if baseTx > 0 {
+		d.BaselineRate = roundTo(float64(baseRB)/float64(baseTx), 4)
+	}
+	if curTx > 0 {
+		d.CurrentRate = roundTo(float64(curRB)/float64(curTx), 4)
+	}
+	d.ChangePoints = roundTo((d.CurrentRate-d.BaselineRate)*100, 2)
+	d.Direction = direction(d.CurrentRate - d.BaselineRate)
+	if baseTx < compareMinSamples || curTx < compareMinSamples {
+		d.Significance = significanceInsufficient
+		return d
+	}
+	pooled := float64(baseRB+curRB) / float64(baseTx+curTx)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(baseTx) + 1/float64(curTx)))
+	if se == 0 {
+		// 两个窗口全部回滚或全部提交
+		d.Significance = significanceNone
+		return d
+	}
+	d.Z = roundTo((float64(curRB)/float64(curTx)-float64(baseRB)/float64(baseTx))/se, 2)
+	d.Significance = significanceOf(d.Z)
+	return d
+}
+
+func significanceOf(z float64) string {
+	switch z = math.Abs(z); {
+	case z >= 2.58:
+		return significanceHigh
+	case z >= 1.96:
+		return significanceSignificant
+	default:
+		return significanceNone
+	}
+}
+
+func direction(delta float64) string {
+	switch {
+	case delta > 1e-9:
+		return "up"
+	case delta < -1e-9:
+		return "down"
+	default:
+		return "unchanged"
+	}
+}
+
+func roundTo(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
+
+// 解析对比窗口：from、to 为当前窗口，to 默认为现在；baseline_from、baseline_to 为基线窗口，
+// 默认为紧接在当前窗口之前、长度相同的窗口
+func parseCompareWindows(c *gin.Context) (compareWindow, compareWindow, bool) {
+	var base, cur compareWindow
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return base, cur, false
+	}
+	if from.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return base, cur, false
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return base, cur, false
+	}
+	cur = compareWindow{From: from, To: to}
+	base = compareWindow{From: from.Add(-to.Sub(from)), To: from}
+
+	loc, _ := parseLocation(c)
+	for name, t := range map[string]*time.Time{"baseline_from": &base.From, "baseline_to": &base.To} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := parseTimeParam(v, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ": " + err.Error()})
+			return base, cur, false
+		}
+		*t = parsed
+	}
+	if c.Query("baseline_from") != "" && c.Query("baseline_to") == "" {
+		base.To = base.From.Add(to.Sub(from))
+	}
+	if !base.To.After(base.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "baseline_to must be after baseline_from"})
+		return base, cur, false
+	}
+	return base, cur, true
+}
+
+// 对比接口：按应用比较基线窗口与当前窗口的错误量和回滚率，合计行的 application_id 为 *
+func (s *Service) compareHandler(c *gin.Context) {
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+	base, cur, ok := parseCompareWindows(c)
+	if !ok {
+		return
+	}
+
+	baseStats, err := s.collectWindowStats(c.Request.Context(), apps, base)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	curStats, err := s.collectWindowStats(c.Request.Context(), apps, cur)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	comparisons := make([]applicationComparison, 0, len(apps))
+	var total applicationComparison
+	for _, app := range apps {
+		comparisons = append(comparisons, applicationComparison{
+			ApplicationID: app,
+			BaselineLogs:  baseStats.logs[app],
+			CurrentLogs:   curStats.logs[app],
+			Errors:        compareCounts(baseStats.errors[app], curStats.errors[app], base, cur),
+			RollbackRate:  compareRates(baseStats.finished[app], baseStats.rolledBack[app], curStats.finished[app], curStats.rolledBack[app]),
+		})
+		total.BaselineLogs += baseStats.logs[app]
+		total.CurrentLogs += curStats.logs[app]
+		total.Errors.Baseline += baseStats.errors[app]
+		total.Errors.Current += curStats.errors[app]
+	}
+	sort.Slice(comparisons, func(i, j int) bool { return comparisons[i].ApplicationID < comparisons[j].ApplicationID })
+	total.ApplicationID = "*"
+	total.Errors = compareCounts(total.Errors.Baseline, total.Errors.Current, base, cur)
+	total.RollbackRate = compareRates(baseStats.totalFinished, baseStats.totalRB, curStats.totalFinished, curStats.totalRB)
+
+	c.JSON(http.StatusOK, comparisonReport{Baseline: base, Current: cur, Applications: comparisons, Total: total})
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 服务配置
+type Config struct {
+	Listen      string       `json:"listen"`       // 监听地址
+	Server      ServerConfig `json:"server"`       // 超时、keep-alive、HTTP/2 和连接数上限
+	TLS         TLSConfig    `json:"tls"`          // HTTPS 及双向 TLS
+	StorageRoot string       `json:"storage_root"` // 日志存储根目录
+	DataDir     string       `json:"data_dir"`     // 告警规则等服务状态的存放目录
+
+	Backends   map[string]BackendConfig `json:"backends"`   // 额外的存储后端，storage_root 即默认后端 local
+	Rotation   RotationConfig           `json:"rotation"`   // 日志文件按大小滚动及压缩
+	Durability DurabilityConfig         `json:"durability"` // 写入后的 fsync 策略
+	Encryption EncryptionConfig         `json:"encryption"` // 分段的静态加密
+	Tiering    TieringConfig            `json:"tiering"`    // 旧分段上传到对象存储
+
+	StorageRouting StorageRoutingConfig `json:"storage_routing"` // 按应用、级别或字段把日志路由到不同的存储目录
+	StorageVolumes StorageVolumesConfig `json:"storage_volumes"` // 新分段分布到多个磁盘的根目录
+
+	FileHandles FileHandlesConfig `json:"file_handles"` // 追加写入复用的文件句柄
+
+	DiskQuota DiskQuotaConfig `json:"disk_quota"` // 每个应用的磁盘配额
+	Retention RetentionConfig `json:"retention"`  // 按级别保留不同天数的日志
+	Lifecycle LifecycleConfig `json:"lifecycle"`  // 应用的归档、法律保留和软删除
+	Ingest    IngestConfig    `json:"ingest"`     // 写入工作池和队列长度
+
+	WriteLatency WriteLatencyConfig `json:"write_latency"` // 写入延迟的分位数指标和慢写入日志
+	IngestLag    IngestLagConfig    `json:"ingest_lag"`    // 日志时间到接收时间的延迟指标和告警
+
+	UploadLimits  UploadLimitsConfig  `json:"upload_limits"`  // 上传接口的请求体大小和字段长度限制
+	UploadSigning UploadSigningConfig `json:"upload_signing"` // 上传请求的 HMAC 签名校验
+
+	ShutdownTimeout Duration `json:"shutdown_timeout"` // 优雅停机时等待请求完成的最长时间
+
+	Fairness FairnessConfig `json:"fairness"` // 过载时按租户公平分配容量
+	Dedup    DedupConfig    `json:"dedup"`    // 重试上传的去重
+	Forward  ForwardConfig  `json:"forward"`  // Fluent forward 协议输入
+	Syslog   SyslogConfig   `json:"syslog"`   // syslog 输入
+	GRPC     GRPCConfig     `json:"grpc"`     // gRPC 写入和查询接口
+	Import   ImportConfig   `json:"import"`   // 历史日志导入
+	Export   ExportConfig   `json:"export"`   // 导出为 Parquet 文件
+
+	Outputs []OutputConfig `json:"outputs"` // 写入的日志转发到下游
+
+	Pipeline    []ProcessorConfig `json:"pipeline"`     // 写入前依次执行的处理器
+	Escalation  EscalationConfig  `json:"escalation"`   // 已知严重 Seata 错误的级别升级规则
+	JSONMessage JSONMessageConfig `json:"json_message"` // log_message 为 JSON 对象时展开为自定义字段
+	TCNode      TCNodeConfig      `json:"tc_node"`      // 为 TC 应用的日志标记产生它的节点
+	QueryMask   MaskConfig        `json:"query_mask"`   // 查询结果返回前的脱敏
+	Query       QueryConfig       `json:"query"`        // 查询结果的大小限制
+
+	Tenants map[string]TenantConfig `json:"tenants"` // 多租户，通过 /tenants/{tenant}/... 访问
+	Access  AccessConfig            `json:"access"`  // 用户、角色和按应用的访问控制
+	Network NetworkConfig           `json:"network"` // 按来源网段限制写入、查询和管理接口
+	CORS    CORSConfig              `json:"cors"`    // 浏览器跨域访问
+
+	Cluster ClusterConfig `json:"cluster"` // 多实例部署，按应用划分写入
+
+	Replication ReplicationConfig `json:"replication"` // 通过 gRPC 把写入的日志复制到备用实例
+
+	Tracing TracingConfig `json:"tracing"` // 日志与分布式追踪的关联
+
+	TransactionHangWindow Duration `json:"transaction_hang_window"` // 全局事务开始后超过该时长仍无终态日志时视为挂起
+
+	Reports []ReportConfig `json:"reports"` // 定期生成的汇总报告
+
+	Localization LocalizationConfig `json:"localization"` // 分析、诊断、告警和报告文字的默认语言
+
+	Anomaly AnomalyConfig `json:"anomaly"` // 按学习到的基线检测错误量突增
+
+	RetryStorm RetryStormConfig `json:"retry_storm"` // 同一分支反复重试二阶段时告警
+
+	Plugins PluginsConfig `json:"plugins"` // 编译进来的插件的启用和配置
+
+	Jobs []JobConfig `json:"jobs"` // 按 cron 表达式定期执行的分析任务，状态见 /jobs
+
+	Debug DebugConfig `json:"debug"` // /debug 下的运行时诊断接口
+
+	Probes       []ProbeConfig   `json:"probes"`         // 合成探针
+	ProbeBaseURL string          `json:"probe_base_url"` // 探针访问的服务地址，默认为本机监听地址
+	ProbeTLS     ClientTLSConfig `json:"probe_tls"`      // 探针通过 HTTPS 访问服务时的证书配置
+	ProbeAPIKey  string          `json:"probe_api_key"`  // 启用访问控制时探针使用的 API Key
+}
+
+// 支持 "30s"、"5m" 写法的时长配置
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// 默认配置，与最初写死在代码中的取值保持一致
+func defaultConfig() Config {
+	return Config{
+		Listen:      ":8080",
+		StorageRoot: "logs",
+		DataDir:     "data",
+
+		ShutdownTimeout: Duration(30 * time.Second),
+
+		TransactionHangWindow: Duration(5 * time.Minute),
+	}
+}
+
+// 从 JSON 文件加载配置，文件不存在时使用默认配置
+func loadConfig(path string) (Config, error) {
+	c := defaultConfig()
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// 以原子方式将对象写入 JSON 文件
+func saveJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 读取 JSON 文件，文件不存在时不报错
+func loadJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
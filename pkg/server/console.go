@@ -0,0 +1,461 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/parser"
+)
+
+// Seata 控制台（seata-server 自带的 console）的只读数据源：按控制台接口的路径、参数和响应结构
+// 返回从日志推断出的全局事务、分支和全局锁，控制台指向本服务即可浏览，无需另一套界面。
+// 停止、重试、删除等操作 TC 才能执行，不提供
+
+// 未指定 timeStart 时查询的时间范围
+const consoleDefaultWindow = 24 * time.Hour
+
+// Seata 的 GlobalStatus 取值
+const (
+	seataGlobalUnknown           = 0
+	seataGlobalBegin             = 1
+	seataGlobalCommitted         = 9
+	seataGlobalCommitFailed      = 10
+	seataGlobalRollbacked        = 11
+	seataGlobalRollbackFailed    = 12
+	seataGlobalTimeoutRollbacked = 13
+)
+
+// Seata 的 BranchStatus 取值。日志中看不出失败能否重试，二阶段失败按可重试处理，与 TC 的默认行为一致
+const (
+	seataBranchUnknown        = 0
+	seataBranchRegistered     = 1
+	seataBranchCommitted      = 5
+	seataBranchCommitFailed   = 6
+	seataBranchRollbacked     = 8
+	seataBranchRollbackFailed = 9
+)
+
+// TC 开启全局事务的日志：Begin new global transaction applicationId: order,transactionServiceGroup: default_tx_group,
+// transactionName: createOrder(),timeout:60000,xid:...
+var consoleBeginPattern = regexp.MustCompile(`(?i)begin new global transaction applicationId:\s*([^,\s]*)\s*,\s*transactionServiceGroup:\s*([^,\s]*)\s*,\s*transactionName:\s*(.*?)\s*,\s*timeout:\s*(\d+)`)
+
+// Seata 控制台的响应结构，code 为字符串形式的状态码
+type consoleResult struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+	Success bool        `json:"success"`
+}
+
+// 分页查询的响应结构
+type consolePage struct {
+	consoleResult
+	Total    int `json:"total"`
+	Pages    int `json:"pages"`
+	PageNum  int `json:"pageNum"`
+	PageSize int `json:"pageSize"`
+}
+
+// 控制台中的全局事务，字段与 Seata 的 GlobalSessionVO 相同，时间为 Unix 毫秒
+type consoleGlobalSession struct {
+	XID                     string                 `json:"xid"`
+	TransactionID           int64                  `json:"transactionId"`
+	Status                  int                    `json:"status"`
+	ApplicationID           string                 `json:"applicationId"`
+	TransactionServiceGroup string                 `json:"transactionServiceGroup"`
+	TransactionName         string                 `json:"transactionName"`
+	Timeout                 int64                  `json:"timeout"`
+	BeginTime               int64                  `json:"beginTime"`
+	ApplicationData         string                 `json:"applicationData"`
+	GmtCreate               int64                  `json:"gmtCreate"`
+	GmtModified             int64                  `json:"gmtModified"`
+	BranchSessionVOs        []consoleBranchSession `json:"branchSessionVOs"`
+}
+
+// 控制台中的分支，字段与 Seata 的 BranchSessionVO 相同
+type consoleBranchSession struct {
+	XID             string `json:"xid"`
+	TransactionID   int64  `json:"transactionId"`
+	BranchID        int64  `json:"branchId"`
+	ResourceGroupID string `json:"resourceGroupId"`
+	ResourceID      string `json:"resourceId"`
+	BranchType      string `json:"branchType"`
+	Status          int    `json:"status"`
+	ClientID        string `json:"clientId"`
+	ApplicationData string `json:"applicationData"`
+	GmtCreate       int64  `json:"gmtCreate"`
+	GmtModified     int64  `json:"gmtModified"`
+}
+
+// 控制台中的全局锁，字段与 Seata 的 GlobalLockVO 相同
+type consoleGlobalLock struct {
+	XID           string `json:"xid"`
+	TransactionID int64  `json:"transactionId"`
+	BranchID      int64  `json:"branchId"`
+	ResourceID    string `json:"resourceId"`
+	TableName     string `json:"tableName"`
+	PK            string `json:"pk"`
+	RowKey        string `json:"rowKey"`
+	GmtCreate     int64  `json:"gmtCreate"`
+	GmtModified   int64  `json:"gmtModified"`
+}
+
+// 全局事务在开始日志和分支日志中的信息，状态由 analysis.TransactionTracker 推断
+type consoleSession struct {
+	applicationID, group, name string
+	timeout                    int64
+	branches                   map[string]*consoleBranch
+}
+
+type consoleBranch struct {
+	resourceID, lockKeys, mode, client, status string
+	created, modified                          time.Time
+}
+
+// 在事务状态推断之外收集控制台需要的全局事务和分支信息
+type consoleCollector struct {
+	*analysis.TransactionTracker
+	sessions map[string]*consoleSession
+}
+
+func newConsoleCollector() *consoleCollector {
+	return &consoleCollector{TransactionTracker: analysis.NewTransactionTracker(), sessions: make(map[string]*consoleSession)}
+}
+
+func (c *consoleCollector) Findings() []Finding { return nil }
+
+func (c *consoleCollector) Observe(entry LogData, ref logRef, at time.Time) {
+	c.TransactionTracker.Observe(entry, ref, at)
+	xid := analysis.EntryXID(entry)
+	if xid == "" {
+		return
+	}
+	s, ok := c.sessions[xid]
+	if !ok {
+		s = &consoleSession{branches: make(map[string]*consoleBranch)}
+		c.sessions[xid] = s
+	}
+	msg := entry.LogMessage
+	if m := consoleBeginPattern.FindStringSubmatch(msg); m != nil {
+		s.applicationID, s.group, s.name = m[1], m[2], m[3]
+		s.timeout, _ = strconv.ParseInt(m[4], 10, 64)
+		return
+	}
+
+	fields := parser.SeataFields(msg)
+	branchID := entry.BranchID
+	if branchID == "" {
+		branchID = fields["branch_id"]
+	}
+	if branchID == "" {
+		return
+	}
+	b, ok := s.branches[branchID]
+	if !ok {
+		b = &consoleBranch{created: at, client: analysis.EntryService(entry)}
+		s.branches[branchID] = b
+	}
+	if b.resourceID == "" {
+		b.resourceID = fields["resource_id"]
+	}
+	if b.lockKeys == "" {
+		b.lockKeys = fields["lock_keys"]
+	}
+	if b.mode == "" || b.mode == parser.ModeUnknown {
+		b.mode = parser.EntryMode(entry)
+	}
+	if status := analysis.BranchEventStatus(msg); status != "" {
+		b.status = status
+	} else if b.status == "" && parser.BranchRegisterPattern.MatchString(msg) {
+		b.status = analysis.BranchRegistered
+	}
+	if at.After(b.modified) {
+		b.modified = at
+	}
+}
+
+// 推断出的事务状态转换为 Seata 的 GlobalStatus
+func seataGlobalStatus(tx analysis.TransactionSummary) int {
+	switch tx.Status {
+	case analysis.StatusCommitted:
+		return seataGlobalCommitted
+	case analysis.StatusRolledBack:
+		return seataGlobalRollbacked
+	case analysis.StatusTimedOut:
+		return seataGlobalTimeoutRollbacked
+	case analysis.StatusFailed:
+		if tx.TerminalEvent == analysis.EventCommitFailed {
+			return seataGlobalCommitFailed
+		}
+		return seataGlobalRollbackFailed
+	case analysis.StatusHanging, analysis.StatusInProgress:
+		return seataGlobalBegin
+	}
+	return seataGlobalUnknown
+}
+
+func seataBranchStatus(status string) int {
+	switch status {
+	case analysis.BranchRegistered:
+		return seataBranchRegistered
+	case analysis.BranchCommitted:
+		return seataBranchCommitted
+	case analysis.BranchRolledBack:
+		return seataBranchRollbacked
+	case analysis.BranchCommitFailed:
+		return seataBranchCommitFailed
+	case analysis.BranchRollbackFailed:
+		return seataBranchRollbackFailed
+	}
+	return seataBranchUnknown
+}
+
+// XID 的最后一段为 transactionId
+func seataTransactionID(xid string) int64 {
+	id, _ := strconv.ParseInt(xid[strings.LastIndex(xid, ":")+1:], 10, 64)
+	return id
+}
+
+func unixMillis(t *time.Time) int64 {
+	if t == nil || t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// 控制台的分页参数，pageNum 从 1 开始
+func consolePaging(c *gin.Context) (int, int, bool) {
+	pageNum, err1 := strconv.Atoi(c.DefaultQuery("pageNum", "1"))
+	pageSize, err2 := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err1 != nil || err2 != nil || pageNum <= 0 || pageSize <= 0 || pageSize > 1000 {
+		consoleFailure(c, http.StatusBadRequest, "pageNum and pageSize must be positive, pageSize at most 1000")
+		return 0, 0, false
+	}
+	return pageNum, pageSize, true
+}
+
+// 控制台的时间参数 timeStart、timeEnd 为 Unix 毫秒，未指定 timeStart 时查询最近一天
+func consoleTimeRange(c *gin.Context) (time.Time, time.Time, bool) {
+	from, to := time.Now().Add(-consoleDefaultWindow), time.Time{}
+	for name, t := range map[string]*time.Time{"timeStart": &from, "timeEnd": &to} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms < 0 {
+			consoleFailure(c, http.StatusBadRequest, "Invalid "+name)
+			return from, to, false
+		}
+		*t = time.UnixMilli(ms).UTC()
+	}
+	return from, to, true
+}
+
+func consoleFailure(c *gin.Context, status int, message string) {
+	c.JSON(status, consoleResult{Code: strconv.Itoa(status), Message: message})
+}
+
+// 写出一页结果
+func writeConsolePage[T any](c *gin.Context, items []T, pageNum, pageSize int) {
+	total := len(items)
+	start := min((pageNum-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	auditCount(c, end-start)
+	c.JSON(http.StatusOK, consolePage{
+		consoleResult: consoleResult{Code: "200", Message: "success", Data: items[start:end], Success: true},
+		Total:         total,
+		Pages:         (total + pageSize - 1) / pageSize,
+		PageNum:       pageNum,
+		PageSize:      pageSize,
+	})
+}
+
+// 遍历当前用户可访问的全部应用，收集控制台需要的事务信息
+func (s *Service) collectConsoleSessions(c *gin.Context) (*consoleCollector, time.Time, bool) {
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	from, to, ok := consoleTimeRange(c)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	collector := newConsoleCollector()
+	if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{collector}); err != nil {
+		readFailed(c, err)
+		return nil, time.Time{}, false
+	}
+	reference := to
+	if reference.IsZero() {
+		reference = time.Now()
+	}
+	return collector, reference, true
+}
+
+// 控制台的全局事务查询：GET /api/v1/console/globalSession/query，
+// 参数与 Seata 的 GlobalSessionParam 相同（xid、applicationId、status、transactionName、withBranch、timeStart、timeEnd、pageNum、pageSize）
+func (s *Service) consoleGlobalSessionHandler(c *gin.Context) {
+	pageNum, pageSize, ok := consolePaging(c)
+	if !ok {
+		return
+	}
+	status := -1
+	if v := c.Query("status"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			consoleFailure(c, http.StatusBadRequest, "Invalid status")
+			return
+		}
+		status = n
+	}
+	xid, appID, name := c.Query("xid"), c.Query("applicationId"), c.Query("transactionName")
+	withBranch := c.Query("withBranch") == "true"
+
+	collector, reference, ok := s.collectConsoleSessions(c)
+	if !ok {
+		return
+	}
+	summaries := collector.Summaries(reference, time.Duration(s.cfg.TransactionHangWindow))
+	// 最近开始的事务在前
+	sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].FirstSeen.After(summaries[j].FirstSeen) })
+
+	sessions := []consoleGlobalSession{}
+	for _, tx := range summaries {
+		s := collector.sessions[tx.XID]
+		if s == nil {
+			continue
+		}
+		vo := consoleGlobalSession{
+			XID:                     tx.XID,
+			TransactionID:           seataTransactionID(tx.XID),
+			Status:                  seataGlobalStatus(tx),
+			ApplicationID:           s.applicationID,
+			TransactionServiceGroup: s.group,
+			TransactionName:         s.name,
+			Timeout:                 s.timeout,
+			BeginTime:               unixMillis(tx.Begin),
+			GmtCreate:               unixMillis(&tx.FirstSeen),
+			GmtModified:             unixMillis(&tx.LastSeen),
+			BranchSessionVOs:        []consoleBranchSession{},
+		}
+		if vo.BeginTime == 0 {
+			vo.BeginTime = vo.GmtCreate
+		}
+		if (xid != "" && vo.XID != xid) || (appID != "" && vo.ApplicationID != appID) ||
+			(name != "" && !strings.Contains(vo.TransactionName, name)) || (status >= 0 && vo.Status != status) {
+			continue
+		}
+		if withBranch {
+			for _, id := range sortedKeys(s.branches) {
+				b := s.branches[id]
+				branchID, _ := strconv.ParseInt(id, 10, 64)
+				vo.BranchSessionVOs = append(vo.BranchSessionVOs, consoleBranchSession{
+					XID:           tx.XID,
+					TransactionID: vo.TransactionID,
+					BranchID:      branchID,
+					ResourceID:    b.resourceID,
+					BranchType:    b.mode,
+					Status:        seataBranchStatus(b.status),
+					ClientID:      b.client,
+					GmtCreate:     b.created.UnixMilli(),
+					GmtModified:   b.modified.UnixMilli(),
+				})
+			}
+		}
+		sessions = append(sessions, vo)
+	}
+	writeConsolePage(c, sessions, pageNum, pageSize)
+}
+
+// 控制台的全局锁查询：GET /api/v1/console/globalLock/query，列出尚未结束的事务在分支注册时登记的行锁。
+// 参数与 Seata 的 GlobalLockParam 相同（xid、tableName、transactionId、branchId、pk、resourceId、timeStart、timeEnd、pageNum、pageSize）
+func (s *Service) consoleGlobalLockHandler(c *gin.Context) {
+	pageNum, pageSize, ok := consolePaging(c)
+	if !ok {
+		return
+	}
+	filter := map[string]string{}
+	for _, k := range []string{"xid", "tableName", "transactionId", "branchId", "pk", "resourceId"} {
+		if v := c.Query(k); v != "" {
+			filter[k] = v
+		}
+	}
+
+	collector, reference, ok := s.collectConsoleSessions(c)
+	if !ok {
+		return
+	}
+	locks := []consoleGlobalLock{}
+	for _, tx := range collector.Summaries(reference, time.Duration(s.cfg.TransactionHangWindow)) {
+		if seataGlobalStatus(tx) != seataGlobalBegin {
+			continue
+		}
+		s := collector.sessions[tx.XID]
+		for _, id := range sortedKeys(s.branches) {
+			b := s.branches[id]
+			if b.status != "" && b.status != analysis.BranchRegistered {
+				continue
+			}
+			branchID, _ := strconv.ParseInt(id, 10, 64)
+			for _, row := range analysis.ParseLockKeys(b.lockKeys) {
+				lock := consoleGlobalLock{
+					XID:           tx.XID,
+					TransactionID: seataTransactionID(tx.XID),
+					BranchID:      branchID,
+					ResourceID:    b.resourceID,
+					TableName:     row[0],
+					PK:            row[1],
+					RowKey:        b.resourceID + "^^^" + row[0] + "^^^" + row[1],
+					GmtCreate:     b.created.UnixMilli(),
+					GmtModified:   b.modified.UnixMilli(),
+				}
+				values := map[string]string{"xid": lock.XID, "tableName": lock.TableName, "transactionId": strconv.FormatInt(lock.TransactionID, 10),
+					"branchId": id, "pk": lock.PK, "resourceId": lock.ResourceID}
+				matched := true
+				for k, v := range filter {
+					matched = matched && values[k] == v
+				}
+				if matched {
+					locks = append(locks, lock)
+				}
+			}
+		}
+	}
+	sort.SliceStable(locks, func(i, j int) bool { return locks[i].GmtCreate > locks[j].GmtCreate })
+	writeConsolePage(c, locks, pageNum, pageSize)
+}
+
+// 控制台的登录请求
+type consoleLoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// 控制台登录：POST /api/v1/auth/login，用户名为访问控制中的用户，密码为该用户的 API Key，
+// 返回的令牌即 API Key，控制台之后在 Authorization 请求头中带上它。未启用访问控制时任何用户名都可以登录
+func (s *Service) consoleLoginHandler(c *gin.Context) {
+	var req consoleLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		consoleFailure(c, http.StatusBadRequest, "Invalid login request")
+		return
+	}
+	if s.users.enabled {
+		u := s.users.Authenticate(req.Password)
+		if u == nil || subtle.ConstantTimeCompare([]byte(u.Name), []byte(req.Username)) != 1 {
+			rbacDenied.Add(1, "reason", "unauthenticated")
+			// 与 Seata 控制台一样以响应体中的 code 表示登录失败
+			c.JSON(http.StatusOK, consoleResult{Code: "401", Message: "Invalid username or password"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, consoleResult{Code: "200", Message: "success", Data: "Bearer " + req.Password, Success: true})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 跨域访问，单独部署的前端可以在浏览器中直接调用查询和统计接口。未配置 allowed_origins 时不返回任何 CORS 头
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`   // 允许的来源，如 https://dash.example.com，支持 * 通配（https://*.example.com）
+	AllowedMethods   []string `json:"allowed_methods"`   // 默认 GET、POST、PUT、DELETE
+	AllowedHeaders   []string `json:"allowed_headers"`   // 默认为 API Key、租户和 Content-Type 等本服务使用的请求头
+	ExposedHeaders   []string `json:"exposed_headers"`   // 浏览器可以读取的响应头，默认 Retry-After、Content-Disposition
+	AllowCredentials bool     `json:"allow_credentials"` // 允许携带 Cookie 和 HTTP 认证，此时不能使用 * 来源
+	MaxAge           Duration `json:"max_age"`           // 预检结果的缓存时长，默认 10m
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCORSHeaders = []string{"Content-Type", "Accept", "Authorization", "X-API-Key", "X-Tenant", "Idempotency-Key", "X-Chunk-SHA256"}
+	defaultCORSExposed = []string{"Retry-After", "Content-Disposition", "Idempotent-Replayed", "X-Ingest-Queue-Depth", "X-Ingest-Queue-Capacity"}
+)
+
+// 校验跨域配置并补全默认值
+func (c *CORSConfig) validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if _, err := path.Match(origin, ""); err != nil {
+			return fmt.Errorf("invalid origin %q", origin)
+		}
+		if origin == "*" && c.AllowCredentials {
+			return fmt.Errorf("allowed origin * cannot be combined with allow_credentials")
+		}
+	}
+	if len(c.AllowedMethods) == 0 {
+		c.AllowedMethods = defaultCORSMethods
+	}
+	if len(c.AllowedHeaders) == 0 {
+		c.AllowedHeaders = defaultCORSHeaders
+	}
+	if len(c.ExposedHeaders) == 0 {
+		c.ExposedHeaders = defaultCORSExposed
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = Duration(10 * time.Minute)
+	}
+	return nil
+}
+
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	for _, pattern := range c.AllowedOrigins {
+		if ok, _ := path.Match(pattern, origin); ok || pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocket 握手的来源校验。浏览器发起的 WebSocket 连接不受 CORS 限制，其他站点的页面可以带着用户的凭据连接，
+// 因此只接受同源页面和 allowed_origins 中的来源；不带 Origin 的请求来自非浏览器客户端，不做限制
+func (c CORSConfig) allowsWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return c.allowsOrigin(origin)
+}
+
+// 跨域中间件：对允许的来源附加 CORS 头，并直接响应预检请求。放在访问控制之前，
+// 预检请求不携带 API Key，被拒绝的请求也带上 CORS 头以便前端读取错误
+func corsMiddleware(c CORSConfig) gin.HandlerFunc {
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(c.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(time.Duration(c.MaxAge).Seconds()))
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if len(c.AllowedOrigins) == 0 || origin == "" {
+			ctx.Next()
+			return
+		}
+		h := ctx.Writer.Header()
+		h.Add("Vary", "Origin")
+		preflight := ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+		if !c.allowsOrigin(origin) {
+			if preflight {
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		h.Set("Access-Control-Allow-Origin", origin)
+		if c.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", exposed)
+			ctx.Next()
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", methods)
+		h.Set("Access-Control-Allow-Headers", headers)
+		h.Set("Access-Control-Max-Age", maxAge)
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 条数的来源
+const (
+	countFromIndex   = "index"
+	countFromScan    = "scan"
+	countFromBackend = "backend" // 在存储后端中统计（如 clickhouse）
+)
+
+// 只统计查询命中的条数，不排序也不保留结果，用于告警和面板组件。
+// 没有字段、消息、ID 和增量条件、不在视图上查询、未指定 to、from 按分钟对齐且级别为大写时直接读取直方图的计数索引，
+// 否则按查询条件遍历计数。级别与列表查询一样区分大小写，见 entryMatchesLevel
+func (s *Service) countLogQuery(q logQuery) (int, string, error) {
+	// 单个应用所在的后端自行执行查询时直接在后端中统计
+	if q.View == "" && len(q.ApplicationIDs) == 0 && len(q.Fields) == 0 && q.Search == nil {
+		if qs, ok := s.queryStoreOf(q.ApplicationID); ok {
+			if q.explain != nil {
+				q.explain.Strategy = countFromBackend
+				q.explain.application(q.ApplicationID, s.backends.BackendOf(q.ApplicationID))
+			}
+			n, err := qs.Count(q.filter())
+			if q.explain != nil {
+				q.explain.Matched = n
+			}
+			return n, countFromBackend, err
+		}
+	}
+	if q.View == "" && len(q.Fields) == 0 && q.Search == nil && !q.byID() && !q.byWriteOrder() && q.To.IsZero() && minuteAligned(q.From) && indexableLevel(q.LogLevel) && s.indexedApplications(q) {
+		if q.explain != nil {
+			q.explain.Strategy, q.explain.Index.CountIndex = countFromIndex, true
+		}
+		n, err := s.countFromIndexes(q)
+		if q.explain != nil {
+			q.explain.Matched = n
+		}
+		return n, countFromIndex, err
+	}
+
+	n := 0
+	err := s.runLogQuery(q, func(entry LogData, ref logRef) bool {
+		n++
+		return true
+	})
+	return n, countFromScan, err
+}
+
+// 查询的应用是否都有计数索引，不以本地目录存放日志的后端没有
+func (s *Service) indexedApplications(q logQuery) bool {
+	for _, app := range append([]string{q.ApplicationID}, q.ApplicationIDs...) {
+		if _, ok := s.queryStoreOf(app); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// 级别条件能否从计数索引中读取：索引以大写级别为键，其他写法的级别在索引中查不到。
+// 同一级别混用大小写写入时，索引中的大写级别也包括其他写法的条数
+func indexableLevel(level string) bool {
+	return level == strings.ToUpper(level)
+}
+
+func minuteAligned(t time.Time) bool {
+	return t.Equal(t.Truncate(time.Minute))
+}
+
+// 从计数索引中累加 from 之后指定级别的条数
+func (s *Service) countFromIndexes(q logQuery) (int, error) {
+	apps := q.ApplicationIDs
+	if len(apps) == 0 {
+		apps = []string{q.ApplicationID}
+	}
+	n := 0
+	for _, app := range apps {
+		err := s.histogramCounts.View(app, time.Now(), func(segments map[string]*segmentCounts) {
+			for name, seg := range segments {
+				if !segmentInRange(name, seg, q.From, time.Time{}) {
+					continue
+				}
+				for minute, byLevel := range seg.Minutes {
+					at := time.Unix(minute*60, 0)
+					if !q.From.IsZero() && at.Before(q.From) {
+						continue
+					}
+					n += byLevel[q.LogLevel]
+				}
+			}
+		})
+		// 多个应用时跳过没有日志的应用
+		if err != nil && (len(q.ApplicationIDs) == 0 || !errors.Is(err, os.ErrNotExist)) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// count=true 的查询只返回命中条数
+func (s *Service) logCountHandler(c *gin.Context, q logQuery) {
+	began := time.Now()
+	count, source, err := s.countLogQuery(q)
+	q.explain.phase("count", began)
+	if errors.Is(err, errViewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+		return
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	resp := gin.H{
+		"application_id": c.Query("application_id"),
+		"log_level":      q.LogLevel,
+		"count":          count,
+		"source":         source,
+	}
+	if q.Archive.used() {
+		resp["archive"] = q.Archive
+	}
+	if q.explain != nil {
+		resp["explain"] = q.explain.finish()
+	}
+	c.JSON(http.StatusOK, resp)
+}
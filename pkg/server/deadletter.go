@@ -0,0 +1,338 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 死信：进入写入流程后因校验失败或存储写入出错而没能写入的日志，连同失败原因保存下来，
+// 修复问题后可以重放，避免 agent、syslog、导入等无人重试的来源静默丢日志。
+// 整个请求在写入前就被拒绝的（如格式错误的 JSON、批量上传的预检查）由调用方收到错误，不进入死信；
+// 去重、流水线丢弃和租户配额属于预期的拒绝，同样不进入死信
+type deadLetter struct {
+	ID            string     `json:"id"`
+	ApplicationID string     `json:"application_id"`
+	Reason        string     `json:"reason"` // invalid_timestamp、schema_violation 或 write_failed
+	Error         string     `json:"error"`
+	Entry         LogData    `json:"entry"`         // 收到时的原始日志
+	Day           string     `json:"day,omitempty"` // 导入的历史日志写入的日期，重放时写回该日期
+	Attempts      int        `json:"attempts"`      // 已重放的次数
+	ReceivedAt    time.Time  `json:"received_at"`
+	LastReplayAt  *time.Time `json:"last_replay_at,omitempty"`
+}
+
+// 死信原因
+const (
+	deadLetterInvalidTimestamp = "invalid_timestamp"
+	deadLetterSchemaViolation  = "schema_violation"
+	deadLetterWriteFailed      = "write_failed"
+)
+
+// 最多保留的死信条数，超出时丢弃最早的
+const maxDeadLetters = 10000
+
+var deadLettersCaptured = metrics.counter("dead_letters_total", "Entries saved to the dead-letter store, by reason.")
+
+// 死信存储：内存中按收到顺序保存，新增时追加到 NDJSON 文件，删除时整体重写
+type deadLetterStore struct {
+	svc     *Service
+	mu      sync.Mutex
+	letters []*deadLetter
+	path    string
+}
+
+func (s *Service) newDeadLetterStore(dataDir string) (*deadLetterStore, error) {
+	store := &deadLetterStore{svc: s, path: filepath.Join(dataDir, "dead_letters.ndjson")}
+	file, err := os.Open(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var d deadLetter
+		// 写入中途崩溃留下的不完整行被跳过
+		if json.Unmarshal(scanner.Bytes(), &d) == nil && d.ID != "" {
+			store.letters = append(store.letters, &d)
+		}
+	}
+	if len(store.letters) > maxDeadLetters {
+		store.letters = store.letters[len(store.letters)-maxDeadLetters:]
+	}
+	return store, scanner.Err()
+}
+
+// 死信原因，不需要进入死信的错误返回空串
+func deadLetterReason(err error) string {
+	switch {
+	case errors.Is(err, errDuplicateEntry), errors.Is(err, errDroppedEntry), errors.Is(err, errTenantQuotaExceeded), errors.Is(err, errApplicationReadOnly), errors.Is(err, errIngestPaused):
+		return ""
+	case errors.Is(err, errInvalidTimestamp):
+		return deadLetterInvalidTimestamp
+	case errors.Is(err, errSchemaViolation):
+		return deadLetterSchemaViolation
+	}
+	return deadLetterWriteFailed
+}
+
+// 保存写入失败的日志，day 不为零时为导入的历史日志
+func (s *deadLetterStore) Capture(entry LogData, day time.Time, err error) {
+	reason := deadLetterReason(err)
+	if reason == "" {
+		return
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("dead letter: unable to generate id: %v", err)
+		return
+	}
+	d := &deadLetter{
+		ID:            hex.EncodeToString(b),
+		ApplicationID: entry.ApplicationID,
+		Reason:        reason,
+		Error:         err.Error(),
+		Entry:         entry,
+		ReceivedAt:    time.Now(),
+	}
+	if !day.IsZero() {
+		d.Day = day.Format("2006-01-02")
+	}
+	deadLettersCaptured.Add(1, "reason", reason)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, d)
+	if len(s.letters) > maxDeadLetters {
+		s.letters = s.letters[len(s.letters)-maxDeadLetters:]
+		// 丢弃的死信仍在文件中，重写一次
+		if err := s.saveLocked(); err != nil {
+			log.Printf("dead letter: unable to save: %v", err)
+		}
+		return
+	}
+	if err := s.appendLocked(d); err != nil {
+		log.Printf("dead letter: unable to save %s: %v", d.ID, err)
+	}
+}
+
+func (s *deadLetterStore) appendLocked(d *deadLetter) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *deadLetterStore) saveLocked() error {
+	tmp := s.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, d := range s.letters {
+		data, err := json.Marshal(d)
+		if err != nil {
+			continue
+		}
+		w.Write(append(data, '\n'))
+	}
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// 死信的筛选条件
+type deadLetterFilter struct {
+	ApplicationID string
+	Reason        string
+	IDs           map[string]bool
+}
+
+func (f deadLetterFilter) matches(d *deadLetter) bool {
+	return (f.ApplicationID == "" || d.ApplicationID == f.ApplicationID) &&
+		(f.Reason == "" || d.Reason == f.Reason) &&
+		(f.IDs == nil || f.IDs[d.ID])
+}
+
+// 按条件列出死信，最新的在前，同时返回匹配的总数
+func (s *deadLetterStore) List(f deadLetterFilter, limit int) ([]deadLetter, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []deadLetter{}
+	total := 0
+	for i := len(s.letters) - 1; i >= 0; i-- {
+		if !f.matches(s.letters[i]) {
+			continue
+		}
+		total++
+		if len(list) < limit {
+			list = append(list, *s.letters[i])
+		}
+	}
+	return list, total
+}
+
+// 删除一条死信
+func (s *deadLetterStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, d := range s.letters {
+		if d.ID == id {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return true, s.saveLocked()
+		}
+	}
+	return false, nil
+}
+
+// 单条死信的重放结果
+type replayResult struct {
+	ID    string `json:"id"`
+	LogID int64  `json:"log_id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// 重放匹配的死信：写入成功（或已是重复日志）的移出死信，仍然失败的更新原因和重放次数
+func (s *deadLetterStore) Replay(f deadLetterFilter) []replayResult {
+	s.mu.Lock()
+	var targets []*deadLetter
+	for _, d := range s.letters {
+		if f.matches(d) {
+			targets = append(targets, d)
+		}
+	}
+	s.mu.Unlock()
+
+	results := make([]replayResult, 0, len(targets))
+	done := make(map[string]bool, len(targets))
+	failed := make(map[string]error)
+	for _, d := range targets {
+		var id int64
+		var err error
+		if d.Day != "" {
+			day, _ := time.ParseInLocation("2006-01-02", d.Day, time.Local)
+			id, err = s.svc.storeEntry(d.Entry, day, nil)
+		} else {
+			id, err = s.svc.writeEntry(d.Entry)
+		}
+		result := replayResult{ID: d.ID, LogID: id}
+		if err != nil && !errors.Is(err, errDuplicateEntry) {
+			result.Error = err.Error()
+			failed[d.ID] = err
+		} else {
+			done[d.ID] = true
+		}
+		results = append(results, result)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	kept := s.letters[:0]
+	for _, d := range s.letters {
+		if done[d.ID] {
+			continue
+		}
+		if err, ok := failed[d.ID]; ok {
+			d.Attempts++
+			d.LastReplayAt = &now
+			d.Error = err.Error()
+			if reason := deadLetterReason(err); reason != "" {
+				d.Reason = reason
+			}
+		}
+		kept = append(kept, d)
+	}
+	s.letters = kept
+	if err := s.saveLocked(); err != nil {
+		log.Printf("dead letter: unable to save: %v", err)
+	}
+	return results
+}
+
+// 死信列表接口
+func (s *Service) deadLetterListHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	list, total := s.deadLetters.List(deadLetterFilter{ApplicationID: c.Query("application_id"), Reason: c.Query("reason")}, limit)
+	c.JSON(http.StatusOK, gin.H{"dead_letters": list, "total": total})
+}
+
+// 重放请求，ids 为空时重放 application_id 和 reason 匹配的全部死信
+type replayRequest struct {
+	IDs           []string `json:"ids"`
+	ApplicationID string   `json:"application_id"`
+	Reason        string   `json:"reason"`
+}
+
+// 死信重放接口
+func (s *Service) deadLetterReplayHandler(c *gin.Context) {
+	var req replayRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+			return
+		}
+	}
+	f := deadLetterFilter{ApplicationID: req.ApplicationID, Reason: req.Reason}
+	if len(req.IDs) > 0 {
+		f.IDs = make(map[string]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			f.IDs[id] = true
+		}
+	}
+	results := s.deadLetters.Replay(f)
+	replayed := 0
+	for _, r := range results {
+		if r.Error == "" {
+			replayed++
+		}
+	}
+	auditCount(c, replayed)
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed, "failed": len(results) - replayed, "results": results})
+}
+
+// 删除死信接口
+func (s *Service) deadLetterDeleteHandler(c *gin.Context) {
+	ok, err := s.deadLetters.Delete(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save dead letters"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter deleted"})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 运行时诊断接口配置。/debug 下的接口只允许管理员访问：启用访问控制时需要 admin 角色，
+// 否则需要 api_key，两者都没有时拒绝访问
+type DebugConfig struct {
+	Pprof  bool   `json:"pprof"`   // 开启 /debug/pprof
+	APIKey string `json:"api_key"` // 未启用访问控制时访问 /debug 接口的 API Key
+}
+
+// 诊断接口的认证中间件，访问控制已校验过 admin 角色时直接放行
+func (s *Service) debugAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.users.enabled {
+			if currentUser(c) == nil {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+				return
+			}
+			c.Next()
+			return
+		}
+		if s.cfg.Debug.APIKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Debug endpoints require access control or debug.api_key"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(requestAPIKey(c.Request.Header)), []byte(s.cfg.Debug.APIKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// 运行时状态
+type debugStats struct {
+	Uptime     string `json:"uptime"`
+	Goroutines int    `json:"goroutines"`
+	OpenFiles  int    `json:"open_files"` // 打开的文件描述符数，无法获取时为 -1
+
+	Memory struct {
+		HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+		HeapObjects    uint64 `json:"heap_objects"`
+		SysBytes       uint64 `json:"sys_bytes"`
+		NumGC          uint32 `json:"num_gc"`
+		PauseTotalMs   int64  `json:"pause_total_ms"`
+	} `json:"memory"`
+
+	// 内存中等待处理的日志和记录
+	Buffered struct {
+		TailSubscribers int `json:"tail_subscribers"`
+		TailEntries     int `json:"tail_entries"`  // 等待推送给实时订阅者的日志
+		AuditRecords    int `json:"audit_records"` // 等待落盘的审计记录
+	} `json:"buffered"`
+
+	// 写入积压
+	Ingest struct {
+		PendingEntries int  `json:"pending_entries"` // 正在写入的日志条数
+		QueuedEntries  int  `json:"queued_entries"`  // 写入工作池中排队和写入中的日志条数
+		QueueCapacity  int  `json:"queue_capacity"`  // 写入工作池的队列上限
+		RunningImports int  `json:"running_imports"` // 进行中的路径导入任务
+		Draining       bool `json:"draining"`        // 正在停机，不再接收上传
+	} `json:"ingest"`
+}
+
+// 当前进程打开的文件描述符数，只支持提供 /proc 的系统
+func openFileCount() int {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(fds)
+}
+
+// 运行时诊断接口
+func (s *Service) debugStatsHandler(c *gin.Context) {
+	var stats debugStats
+	stats.Uptime = time.Since(s.startedAt).Round(time.Second).String()
+	stats.Goroutines = runtime.NumGoroutine()
+	stats.OpenFiles = openFileCount()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats.Memory.HeapAllocBytes = mem.HeapAlloc
+	stats.Memory.HeapObjects = mem.HeapObjects
+	stats.Memory.SysBytes = mem.Sys
+	stats.Memory.NumGC = mem.NumGC
+	stats.Memory.PauseTotalMs = int64(mem.PauseTotalNs / uint64(time.Millisecond))
+
+	stats.Buffered.TailSubscribers, stats.Buffered.TailEntries = s.tailHub.Buffered()
+	if s.audit != nil {
+		stats.Buffered.AuditRecords = len(s.audit.records)
+	}
+
+	stats.Ingest.PendingEntries = int(s.ingestPending.Load())
+	queued, capacity := s.ingestWorkers.Depth()
+	stats.Ingest.QueuedEntries, stats.Ingest.QueueCapacity = int(queued), int(capacity)
+	for _, job := range s.imports.List() {
+		if job.Status == importRunning {
+			stats.Ingest.RunningImports++
+		}
+	}
+	stats.Ingest.Draining = s.draining.Load()
+	c.JSON(http.StatusOK, stats)
+}
+
+// 转发到 net/http/pprof：/debug/pprof/ 为索引页，其余路径为具体的剖析数据
+func pprofHandler(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
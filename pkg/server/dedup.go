@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传去重配置
+type DedupConfig struct {
+	Enabled     bool     `json:"enabled"`
+	ContentHash bool     `json:"content_hash"` // 没有 Idempotency-Key 时也按应用、时间戳和消息的哈希去重
+	Window      Duration `json:"window"`       // 在该时长内重复的上传被忽略，默认 10m
+	MaxKeys     int      `json:"max_keys"`     // 最多记住的键数量，超出时淘汰最早的键，默认 1000000
+}
+
+// 日志在去重窗口内已写入过
+var errDuplicateEntry = errors.New("duplicate log entry")
+
+var (
+	dedupSkipped      = metrics.counter("dedup_skipped_total", "Log entries skipped because an identical entry was uploaded within the dedup window.")
+	idempotentReplays = metrics.counter("idempotent_replays_total", "Upload requests answered from the idempotency cache.")
+)
+
+// 按时间窗口记住已出现的键，键按插入顺序过期
+type dedupCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	maxKeys int
+	content bool // 按日志内容去重
+	seen    map[string]*dedupRecord
+	order   []dedupEntry // 插入顺序，用于过期淘汰
+}
+
+// 按插入顺序排列的键。键被移除后重新登记时是新的记录，旧的条目不再对应 seen 中的记录，淘汰时直接跳过
+type dedupEntry struct {
+	key string
+	rec *dedupRecord
+}
+
+// 键对应的记录：幂等请求保存第一次的响应，pending 表示第一次请求仍在处理
+type dedupRecord struct {
+	at      time.Time
+	pending bool
+	status  int
+	body    []byte
+}
+
+func newDedupCache(c DedupConfig) *dedupCache {
+	if !c.Enabled {
+		return nil
+	}
+	window := time.Duration(c.Window)
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	maxKeys := c.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 1000000
+	}
+	return &dedupCache{window: window, maxKeys: maxKeys, content: c.ContentHash, seen: make(map[string]*dedupRecord)}
+}
+
+// 淘汰过期和超出数量的键，调用方需持有锁。仍在处理的键不能淘汰，移到队尾，不阻塞之后的键
+func (d *dedupCache) evictLocked(now time.Time) {
+	for requeued := 0; len(d.order) > requeued; {
+		front := d.order[0]
+		if rec, ok := d.seen[front.key]; !ok || rec != front.rec {
+			d.order = d.order[1:]
+			continue
+		}
+		if now.Sub(front.rec.at) < d.window && len(d.seen) <= d.maxKeys {
+			break
+		}
+		d.order = d.order[1:]
+		if front.rec.pending {
+			d.order = append(d.order, front)
+			requeued++
+			continue
+		}
+		delete(d.seen, front.key)
+	}
+}
+
+// 登记键，返回已有的记录；键不存在时登记为处理中并返回 nil
+func (d *dedupCache) Claim(key string, now time.Time) *dedupRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.evictLocked(now)
+	if rec, ok := d.seen[key]; ok {
+		snapshot := *rec
+		return &snapshot
+	}
+	rec := &dedupRecord{at: now, pending: true}
+	d.seen[key] = rec
+	d.order = append(d.order, dedupEntry{key: key, rec: rec})
+	return nil
+}
+
+// 完成键的处理，保存响应供重试时原样返回
+func (d *dedupCache) Complete(key string, status int, body []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rec, ok := d.seen[key]; ok {
+		rec.pending, rec.status, rec.body = false, status, body
+	}
+}
+
+// 处理失败时移除键，允许重试。order 中的条目在淘汰时跳过
+func (d *dedupCache) Forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
+
+// 日志内容的去重键：应用、时间戳和消息相同的日志视为重复
+func entryDedupKey(entry LogData) string {
+	h := sha256.New()
+	h.Write([]byte(entry.ApplicationID))
+	h.Write([]byte{0})
+	h.Write([]byte(entry.Timestamp))
+	h.Write([]byte{0})
+	h.Write([]byte(entry.LogMessage))
+	return "entry:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// 记录响应内容的 ResponseWriter
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// 幂等上传中间件：带 Idempotency-Key 请求头的请求在去重窗口内重复发送时，直接返回第一次的响应
+func (s *Service) idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader("Idempotency-Key")
+		if s.dedup == nil || idempotencyKey == "" {
+			c.Next()
+			return
+		}
+
+		key := "request:" + c.GetString("tenant") + "|" + c.FullPath() + "|" + idempotencyKey
+		if rec := s.dedup.Claim(key, time.Now()); rec != nil {
+			if rec.pending {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+				return
+			}
+			idempotentReplays.Add(1)
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(rec.status, "application/json; charset=utf-8", rec.body)
+			c.Abort()
+			return
+		}
+
+		w := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// 只记住成功的响应，失败的请求可以用同一个键重试
+		if status := w.Status(); status >= 200 && status < 300 {
+			s.dedup.Complete(key, status, w.body.Bytes())
+		} else {
+			s.dedup.Forget(key)
+		}
+	}
+}
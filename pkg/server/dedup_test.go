@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 移除的键重新登记后，旧的插入顺序不会提前淘汰新的记录
+func TestDedupForgetThenClaimAgain(t *testing.T) {
+	d := newDedupCache(DedupConfig{Enabled: true, Window: Duration(time.Minute)})
+	start := time.Now()
+	if d.Claim("a", start) != nil {
+		t.Fatal("first claim found a record")
+	}
+	d.Forget("a")
+	if d.Claim("a", start.Add(50*time.Second)) != nil {
+		t.Fatal("claim after Forget found a record")
+	}
+	d.Complete("a", http.StatusOK, []byte("{}"))
+
+	// 第一次登记已过期，第二次还在窗口内
+	rec := d.Claim("a", start.Add(70*time.Second))
+	if rec == nil || rec.pending || rec.status != http.StatusOK {
+		t.Fatalf("record after the first claim expired: %+v, want the completed second claim", rec)
+	}
+	if len(d.order) != 1 {
+		t.Fatalf("order has %d entries, want only the live one", len(d.order))
+	}
+}
+
+// 处理中的键不阻塞之后的键过期和按数量淘汰
+func TestDedupPendingKeyDoesNotBlockEviction(t *testing.T) {
+	d := newDedupCache(DedupConfig{Enabled: true, Window: Duration(time.Minute), MaxKeys: 3})
+	start := time.Now()
+	d.Claim("slow", start)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		d.Claim(key, start)
+		d.Complete(key, http.StatusOK, nil)
+	}
+	// 登记新键之前淘汰到不超过 max_keys
+	if _, ok := d.seen["a"]; ok || len(d.seen) != 4 {
+		t.Fatalf("keys %v, want a evicted behind the pending key", d.seen)
+	}
+	if _, ok := d.seen["slow"]; !ok {
+		t.Fatal("pending key evicted")
+	}
+
+	d.Claim("e", start.Add(2*time.Minute))
+	if len(d.seen) != 2 {
+		t.Fatalf("%d keys kept after the window, want the pending key and e", len(d.seen))
+	}
+	d.Complete("slow", http.StatusOK, nil)
+	d.Claim("f", start.Add(3*time.Minute))
+	if _, ok := d.seen["slow"]; ok {
+		t.Fatal("completed key kept after the window")
+	}
+}
+
+// 同一 Idempotency-Key 的重试返回第一次的响应，不再写入；失败的请求可以用同一个键重试；
+// 按内容去重时相同的日志只写入一次
+func TestIdempotentUploadReplaysResponse(t *testing.T) {
+	s := openTestServiceWith(t, t.TempDir(), func(c *Config) {
+		c.Dedup = DedupConfig{Enabled: true, ContentHash: true}
+	})
+	router := newTestRouter(t, s)
+	upload := func(body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	at := time.Now().UTC().Format(time.RFC3339Nano)
+
+	if w := upload(`{"application_id":"orders","log_level":"INFO"}`, "k1"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid upload: status %d, want 400", w.Code)
+	}
+	first := upload(`{"application_id":"orders","log_level":"INFO","log_message":"order placed","timestamp":"`+at+`"}`, "k1")
+	if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry after a failed request: status %d, replayed %q", first.Code, first.Header().Get("Idempotent-Replayed"))
+	}
+	replay := upload(`{"application_id":"orders","log_level":"INFO","log_message":"order placed","timestamp":"`+at+`"}`, "k1")
+	if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != first.Body.String() {
+		t.Fatalf("replay: %d %q, want the first response %q", replay.Code, replay.Body, first.Body)
+	}
+	if w := upload(`{"application_id":"orders","log_level":"INFO","log_message":"order placed","timestamp":"`+at+`"}`, ""); w.Code != http.StatusOK {
+		t.Fatalf("duplicate content without a key: status %d", w.Code)
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}}); len(got) != 1 {
+		t.Fatalf("stored %q, want one entry", got)
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 增量查询只返回至少这么久之前写入的日志。写入序号在写入分段之前分配，多个应用或多个分段依次扫描时，
+// 刚分配序号、尚未写入的日志可能排在已返回的日志之前；留出这段时间后游标不会越过它们
+const deltaQuerySettle = time.Second
+
+// 日志的写入顺序：写入序号即写入时的 Unix 纳秒时间，没有写入序号的早期日志用日志时间代替
+func writeOrder(entry LogData, at time.Time) int64 {
+	if entry.Seq > 0 {
+		return entry.Seq
+	}
+	return at.UnixNano()
+}
+
+// 增量查询的起点：since 为日志 ID（单个应用），或 时间戳[,写入序号]，
+// 后者只返回写入顺序晚于该点的日志，可以跨应用查询
+type deltaCursor struct {
+	ID    int64
+	At    time.Time
+	Order int64 // 写入顺序，未指定写入序号时为时间戳的 Unix 纳秒时间
+}
+
+func parseDeltaCursor(value string) (deltaCursor, bool) {
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return deltaCursor{ID: id}, id >= 0
+	}
+	ts, seq, hasSeq := strings.Cut(value, ",")
+	at, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(ts))
+	if err != nil {
+		return deltaCursor{}, false
+	}
+	cur := deltaCursor{At: at, Order: at.UnixNano()}
+	if hasSeq {
+		n, err := strconv.ParseInt(strings.TrimSpace(seq), 10, 64)
+		if err != nil || n <= 0 {
+			return deltaCursor{}, false
+		}
+		cur.Order = n
+	}
+	return cur, true
+}
+
+// 写入顺序游标的字符串形式，时间戳部分为写入时间，便于阅读
+func formatDeltaCursor(order int64) string {
+	return time.Unix(0, order).UTC().Format(storedTimestampLayout) + "," + strconv.FormatInt(order, 10)
+}
+
+// 解析 since 参数并设置到查询条件，未指定时 ok 为 true 且不修改查询
+func applyDeltaCursor(c *gin.Context, q *logQuery) bool {
+	raw := c.Query("since")
+	if raw == "" {
+		return true
+	}
+	cur, ok := parseDeltaCursor(raw)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since: expected a log id or an RFC 3339 timestamp optionally followed by ,seq"})
+		return false
+	}
+	if q.byID() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since cannot be combined with since_id or max_id"})
+		return false
+	}
+	if cur.At.IsZero() {
+		if len(q.ApplicationIDs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since with a log id requires a single application_id; use a timestamp cursor across applications"})
+			return false
+		}
+		q.SinceID = cur.ID
+		q.HasSince = true
+		return true
+	}
+	q.HasSince = true
+	q.SinceOrder = cur.Order
+	q.OrderHorizon = time.Now().Add(-deltaQuerySettle).UnixNano()
+	return true
+}
+
+// 是否按写入顺序增量查询，此时结果按写入顺序排序
+func (q logQuery) byWriteOrder() bool {
+	return q.SinceOrder > 0
+}
+
+// 是否为增量查询（按 ID 或写入顺序），计数索引可以跳过已经返回过的部分。
+// 从 since=0 开始的首次轮询也是增量查询，响应中带有下一次的游标
+func (q logQuery) incremental() bool {
+	return q.HasSince || q.SinceID > 0 || q.byWriteOrder()
+}
+
+func (q logQuery) matchesWriteOrder(entry LogData, at time.Time) bool {
+	order := writeOrder(entry, at)
+	return order > q.SinceOrder && order <= q.OrderHorizon
+}
+
+// 检查点之前的日志是否都已在游标之前
+func (q logQuery) covers(maxID, maxOrder int64) bool {
+	if q.byWriteOrder() {
+		return maxOrder <= q.SinceOrder
+	}
+	return q.SinceID > 0 && maxID <= q.SinceID
+}
+
+// 增量查询中各分段的起始偏移：按计数索引跳过其中已在游标之前的部分。
+// 已关闭且全部在游标之前的分段为 -1，整段跳过（也不会解压或取回已分层的分段）。
+// 索引之后追加的部分总会读取，因此写入与查询并发时不会漏掉日志
+func (s *Service) deltaStartOffsets(q logQuery) map[string]int64 {
+	if !q.incremental() {
+		return nil
+	}
+	starts := make(map[string]int64)
+	err := s.histogramCounts.View(q.ApplicationID, time.Now(), func(segments map[string]*segmentCounts) {
+		for name, seg := range segments {
+			if q.covers(seg.MaxID, seg.MaxOrder) {
+				if seg.Closed {
+					starts[name] = -1
+				} else {
+					starts[name] = seg.Offset
+				}
+				continue
+			}
+			for _, cp := range seg.Checkpoints {
+				if !q.covers(cp.MaxID, cp.MaxOrder) {
+					break
+				}
+				starts[name] = cp.Offset
+			}
+		}
+	})
+	if err != nil {
+		// 没有索引时照常完整扫描
+		return nil
+	}
+	return starts
+}
+
+// 响应中的下一次增量查询起点，返回的结果被 limit 截断且是倒序时为空（中间的日志没有返回，无法接续）
+func nextDeltaCursor(q logQuery, hits []QueryHit, limit int, order string) string {
+	truncated := len(hits) >= limit
+	if truncated && order == sortDesc {
+		return ""
+	}
+	if q.byWriteOrder() {
+		// 没有被截断时已返回全部不晚于 OrderHorizon 的日志
+		next := q.SinceOrder
+		if !truncated {
+			next = max(next, q.OrderHorizon)
+		}
+		for _, h := range hits {
+			next = max(next, writeOrder(h.Entry, h.At))
+		}
+		return formatDeltaCursor(next)
+	}
+	next := q.SinceID
+	for _, h := range hits {
+		next = max(next, h.Entry.ID)
+	}
+	return strconv.FormatInt(next, 10)
+}
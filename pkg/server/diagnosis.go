@@ -0,0 +1,233 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/parser"
+)
+
+// 诊断结论的可信度
+const (
+	diagnosisHigh   = "high"   // 命中已知的失败模式
+	diagnosisMedium = "medium" // 只有错误日志
+	diagnosisLow    = "low"    // 只有耗时线索
+)
+
+// 每个原因最多附带的日志条数
+const maxDiagnosisEvidence = 3
+
+// 已知的失败模式，按作为根因的可能性排列：数据和锁的问题通常是回滚的原因，超时和重试是其结果
+var diagnosisPatterns = []struct {
+	name    string
+	title   string
+	matches func(message string) bool
+}{
+	{"undo_dirty_data", "AT rollback found rows modified outside the global transaction", func(m string) bool { return analysis.ClassifyRollbackFailure(m) == analysis.RollbackDirtyData }},
+	{"undo_log_missing", "Undo log of the branch was not found during rollback", func(m string) bool { return analysis.ClassifyRollbackFailure(m) == analysis.RollbackUndoLogMissing }},
+	{"rollback_unretryable", "A branch rollback failed and will not be retried", func(m string) bool { return analysis.ClassifyRollbackFailure(m) == analysis.RollbackUnretryable }},
+	{"lock_wait_timeout", "A branch timed out waiting for a global lock held by another transaction", analysis.LockTimeoutPattern.MatchString},
+	{"lock_conflict", "A branch could not acquire a global lock held by another transaction", analysis.LockConflictPattern.MatchString},
+	{"branch_register_failed", "A branch could not register with the TC", branchRegisterFailedPattern.MatchString},
+	{"global_timeout", "The global transaction exceeded its timeout and the TC rolled it back", func(m string) bool { return analysis.ClassifyEvent(m) == analysis.EventTimeout }},
+	{"rollback_retrying", "A branch rollback failed and is being retried", func(m string) bool { return analysis.ClassifyRollbackFailure(m) == analysis.RollbackRetrying }},
+}
+
+var branchRegisterFailedPattern = regexp.MustCompile(`(?i)branch ?register\w* (?:request )?fail|fail\w* to register branch|RegisterException`)
+
+// 一个疑似原因
+type DiagnosisCause struct {
+	Pattern   string        `json:"pattern"` // 失败模式或升级规则名
+	Title     string        `json:"title"`
+	Service   string        `json:"service"` // 第一条命中日志所属的服务
+	BranchID  string        `json:"branch_id,omitempty"`
+	Count     int           `json:"count"`
+	FirstSeen time.Time     `json:"first_seen"`
+	Evidence  []EvidenceRef `json:"evidence"`
+
+	priority int
+}
+
+// 回滚事务的根因诊断：按时间线套用几条经验规则（已知的失败模式、第一条 ERROR、最慢的分支），
+// 给出一句话的结论和支撑它的日志。结论由规则生成，只作为排查的起点
+type TransactionDiagnosis struct {
+	XID            string                  `json:"xid"`
+	Status         string                  `json:"status"`
+	Mode           string                  `json:"mode,omitempty"`
+	ApplicationIDs []string                `json:"application_ids"`
+	Diagnosis      string                  `json:"diagnosis"`
+	Confidence     string                  `json:"confidence"` // high、medium 或 low
+	SuspectService string                  `json:"suspect_service,omitempty"`
+	Causes         []DiagnosisCause        `json:"causes"`
+	FirstError     *EvidenceRef            `json:"first_error,omitempty"` // 时间线上第一条 ERROR 或 FATAL
+	SlowestBranch  *analysis.TimeoutBranch `json:"slowest_branch,omitempty"`
+}
+
+// 日志命中的失败模式：写入时升级过的日志以升级规则为准，其余按 diagnosisPatterns 识别
+func (s *Service) matchDiagnosisPattern(entry LogData) (name, title string, priority int, ok bool) {
+	if rule := entry.Fields[escalationField]; rule != "" {
+		title := rule
+		if r := s.escalations.Rule(rule); r != nil && r.Description != "" {
+			title = r.Description
+		}
+		return rule, title, -1, true
+	}
+	for i, p := range diagnosisPatterns {
+		if p.matches(entry.LogMessage) {
+			return p.name, p.title, i, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func evidenceOf(ev TimelineEvent) EvidenceRef {
+	return analysis.NewEvidence(ev.Entry, ev.Ref)
+}
+
+// 按时间线诊断事务，结论和原因的标题使用 lang 语言
+func (s *Service) diagnoseTransaction(t TransactionTimeline, tx analysis.TransactionSummary, lang string) TransactionDiagnosis {
+	d := TransactionDiagnosis{XID: t.XID, Status: tx.Status, Mode: tx.Mode, ApplicationIDs: t.ApplicationIDs, Causes: []DiagnosisCause{}}
+
+	var firstError *TimelineEvent
+	causes := make(map[string]*DiagnosisCause)
+	branches := make(map[string]*analysis.TimeoutBranch)
+	for i, ev := range t.Events {
+		entry := ev.Entry
+		branchID := entry.BranchID
+		if branchID == "" {
+			branchID = parser.SeataFields(entry.LogMessage)["branch_id"]
+		}
+		service := analysis.EntryService(entry)
+
+		if firstError == nil && levelRanks[strings.ToUpper(entry.LogLevel)] >= levelRanks["ERROR"] {
+			firstError = &t.Events[i]
+			e := evidenceOf(ev)
+			d.FirstError = &e
+		}
+		if name, title, priority, ok := s.matchDiagnosisPattern(entry); ok {
+			cause, seen := causes[name]
+			if !seen {
+				cause = &DiagnosisCause{Pattern: name, Title: i18n.Tr(lang, title), Service: service, BranchID: branchID, FirstSeen: ev.At, Evidence: []EvidenceRef{}, priority: priority}
+				causes[name] = cause
+			}
+			cause.Count++
+			if len(cause.Evidence) < maxDiagnosisEvidence {
+				cause.Evidence = append(cause.Evidence, evidenceOf(ev))
+			}
+		}
+
+		// 分支耗时与超时分析相同：该分支第一条到最后一条日志的间隔
+		if branchID == "" {
+			continue
+		}
+		b, ok := branches[branchID]
+		if !ok {
+			b = &analysis.TimeoutBranch{BranchID: branchID, Service: service, FirstSeen: ev.At}
+			branches[branchID] = b
+		}
+		b.Events++
+		b.LastSeen = ev.At
+		b.DurationMs = b.LastSeen.Sub(b.FirstSeen).Milliseconds()
+		if b.ResourceID == "" {
+			b.ResourceID = parser.SeataFields(entry.LogMessage)["resource_id"]
+		}
+		if parser.BranchRegisterPattern.MatchString(entry.LogMessage) {
+			b.Service = service
+		}
+	}
+	for _, id := range sortedKeys(branches) {
+		if b := branches[id]; d.SlowestBranch == nil || b.DurationMs > d.SlowestBranch.DurationMs {
+			d.SlowestBranch = b
+		}
+	}
+	for _, cause := range causes {
+		// 分支日志可能由不带 applicationId 的 RM 写入，服务以分支注册时的为准
+		if b, ok := branches[cause.BranchID]; ok {
+			cause.Service = b.Service
+		}
+		d.Causes = append(d.Causes, *cause)
+	}
+	sort.SliceStable(d.Causes, func(i, j int) bool {
+		if d.Causes[i].priority != d.Causes[j].priority {
+			return d.Causes[i].priority < d.Causes[j].priority
+		}
+		return d.Causes[i].FirstSeen.Before(d.Causes[j].FirstSeen)
+	})
+
+	outcome := i18n.Textf(strings.ReplaceAll(tx.Status, "_", " "))
+	switch {
+	case len(d.Causes) > 0:
+		top := d.Causes[0]
+		d.Confidence, d.SuspectService = diagnosisHigh, top.Service
+		d.Diagnosis = i18n.Textf("Transaction %s; probable cause in %s: %s", outcome, top.Service, top.Title).In(lang)
+		if top.BranchID != "" {
+			d.Diagnosis += i18n.Textf(" (branch %s)", top.BranchID).In(lang)
+		}
+	case firstError != nil:
+		d.Confidence, d.SuspectService = diagnosisMedium, analysis.EntryService(firstError.Entry)
+		d.Diagnosis = i18n.Textf("Transaction %s after the first error in %s: %s", outcome, d.SuspectService, firstLine(firstError.Entry.LogMessage, 200)).In(lang)
+	case d.SlowestBranch != nil:
+		d.Confidence, d.SuspectService = diagnosisLow, d.SlowestBranch.Service
+		d.Diagnosis = i18n.Textf("Transaction %s with no error logged; the slowest branch %s in %s took %s",
+			outcome, d.SlowestBranch.BranchID, d.SlowestBranch.Service, time.Duration(d.SlowestBranch.DurationMs)*time.Millisecond).In(lang)
+	default:
+		d.Confidence = diagnosisLow
+		d.Diagnosis = i18n.Textf("Transaction %s; the logs contain no error or branch activity to explain it", outcome).In(lang)
+	}
+	return d
+}
+
+// 消息的第一行，超过 n 字节时截断
+func firstLine(message string, n int) string {
+	line, _, _ := strings.Cut(message, "\n")
+	return truncateUTF8(line, n)
+}
+
+// 事务诊断接口：XID 的事务未提交成功时，按时间线给出疑似根因、支撑的日志、第一条错误和最慢的分支。
+// 已提交的事务返回 409
+func (s *Service) transactionDiagnosisHandler(c *gin.Context) {
+	xid := c.Param("xid")
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+
+	t, err := s.buildTimeline(c.Request.Context(), xid, apps)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	if len(t.Events) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	tx := s.timelineSummary(t)
+	if tx.Status == analysis.StatusCommitted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction committed; nothing to diagnose"})
+		return
+	}
+	auditCount(c, len(t.Events))
+	c.JSON(http.StatusOK, s.diagnoseTransaction(t, tx, s.requestLanguage(c)))
+}
+
+// 由时间线上的日志汇总事务的状态，无法判断时为 unknown
+func (s *Service) timelineSummary(t TransactionTimeline) analysis.TransactionSummary {
+	tracker := analysis.NewTransactionTracker()
+	for _, ev := range t.Events {
+		tracker.Observe(ev.Entry, ev.Ref, ev.At)
+	}
+	tx := analysis.TransactionSummary{XID: t.XID, Status: analysis.StatusUnknown}
+	for _, s := range tracker.Summaries(time.Now(), time.Duration(s.cfg.TransactionHangWindow)) {
+		if s.XID == t.XID {
+			tx = s
+		}
+	}
+	return tx
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package server
+
+import "syscall"
+
+// 目录所在文件系统的总空间和可用空间（字节）
+func diskSpace(path string) (total, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Blocks) * uint64(st.Bsize), uint64(st.Bavail) * uint64(st.Bsize), nil
+}
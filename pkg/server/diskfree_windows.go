@@ -0,0 +1,10 @@
+//go:build windows
+
+package server
+
+import "errors"
+
+// Windows 上不统计文件系统的空间
+func diskSpace(path string) (total, free uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,10 @@
+// Package server 是日志分析服务本身：写入、查询、分析任务的调度和 HTTP、gRPC、syslog 等接口都在本包中。
+// 已拆出的包只有：model 是各层共用的日志模型，parser 解析 Seata 日志，i18n 是生成文本的译文，
+// analysis 是内置分析器和发现，storage 是存储后端的接口。本地目录和 ClickHouse 后端、对象存储分层、
+// 告警和通知等依赖服务的加密、配额和索引，仍在本包中。
+//
+// 其他 Go 程序通过 Service（Open、Ingest、Query、Transactions、Findings 等）嵌入分析引擎，
+// 需要 HTTP 接口时用 Handler 挂载到自己的 HTTP 服务上；gRPC、syslog 和 forward 输入只由 Main 启动。
+// Close 与服务停机相同，会结束 Handler 上的长连接并关闭全部组件。
+// 依赖在 Open 时注入：WithStore 注入实现 storage.QueryStore 的存储后端，WithNativeAnalyzer 和 WithAnalyzer 登记分析器
+package server
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 写入的持久化策略。默认交给操作系统回写，断电时可能丢失最近的日志，文件末尾也可能留下半行
+type DurabilityConfig struct {
+	Fsync    string   `json:"fsync"`    // none（默认）、always（每次写入）、batch（每 every 次写入）或 interval（每 interval）
+	Every    int      `json:"every"`    // batch 模式下每多少次写入同步一次，默认 100
+	Interval Duration `json:"interval"` // interval 模式下的同步间隔，默认 1s
+}
+
+// 持久化策略
+const (
+	fsyncNone     = "none"
+	fsyncAlways   = "always"
+	fsyncBatch    = "batch"
+	fsyncInterval = "interval"
+)
+
+var (
+	fsyncTotal        = metrics.counter("fsync_total", "fsync calls on log segments and their directories, by policy.")
+	segmentsRecovered = metrics.counter("segments_recovered_total", "Log segments whose partially written last line was repaired on start.")
+)
+
+// 按策略同步写入的分段。batch 和 interval 模式下记录写入过的文件和新建文件所在的目录，
+// 到达次数或间隔时统一同步；nil 表示不同步
+type fileSyncer struct {
+	mode  string
+	every int
+
+	mu      sync.Mutex
+	dirty   map[string]bool // 待同步的文件和目录
+	pending int             // 上次同步后的写入次数
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// 按配置创建同步器，none 时返回 nil
+func newFileSyncer(c DurabilityConfig) (*fileSyncer, error) {
+	switch c.Fsync {
+	case "", fsyncNone:
+		return nil, nil
+	case fsyncAlways, fsyncBatch, fsyncInterval:
+	default:
+		return nil, fmt.Errorf("unknown fsync policy %q", c.Fsync)
+	}
+	s := &fileSyncer{mode: c.Fsync, every: c.Every, dirty: make(map[string]bool), stop: make(chan struct{})}
+	if s.every <= 0 {
+		s.every = 100
+	}
+	if s.mode == fsyncInterval {
+		interval := time.Duration(c.Interval)
+		if interval <= 0 {
+			interval = time.Second
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.stop:
+					return
+				case <-ticker.C:
+					s.Flush()
+				}
+			}
+		}()
+	}
+	return s, nil
+}
+
+// 一次追加写入完成后调用，created 表示文件是本次新建的，此时目录项也需要同步
+func (s *fileSyncer) Written(file *os.File, created bool) error {
+	if s == nil {
+		return nil
+	}
+	if s.mode == fsyncAlways {
+		fsyncTotal.Add(1, "policy", s.mode)
+		if err := file.Sync(); err != nil {
+			return err
+		}
+		if created {
+			return syncPath(filepath.Dir(file.Name()), s.mode)
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty[file.Name()] = true
+	if created {
+		s.dirty[filepath.Dir(file.Name())] = true
+	}
+	s.pending++
+	if s.mode == fsyncBatch && s.pending >= s.every {
+		return s.flushLocked()
+	}
+	return nil
+}
+
+// 同步全部待同步的文件和目录
+func (s *fileSyncer) Flush() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushLocked()
+}
+
+func (s *fileSyncer) flushLocked() error {
+	var firstErr error
+	// 先同步文件再同步目录
+	for _, dirs := range []bool{false, true} {
+		for path := range s.dirty {
+			if info, err := os.Stat(path); err != nil || info.IsDir() != dirs {
+				continue
+			}
+			if err := syncPath(path, s.mode); err != nil && !os.IsNotExist(err) && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	s.dirty = make(map[string]bool)
+	s.pending = 0
+	if firstErr != nil {
+		log.Printf("fsync failed: %v", firstErr)
+	}
+	return firstErr
+}
+
+// 停止定时同步，退出前同步一次
+func (s *fileSyncer) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	return s.Flush()
+}
+
+// 重新打开文件或目录并同步，压缩或滚动后已不存在的文件被跳过
+func syncPath(path, policy string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fsyncTotal.Add(1, "policy", policy)
+	return f.Sync()
+}
+
+// 启动时修复 file 后端中写到一半的分段末尾：最后一行没有换行符时，能解析的补上换行，
+// 否则（如断电留下的半行或填零的块）截断到上一个完整的行，截掉的内容保存到应用的 .quarantine 目录
+func (s *Service) recoverSegmentTails(r *backendRegistry) {
+	for _, name := range r.Names() {
+		store, _, _ := r.Store(name)
+		fs, ok := store.(*fileStore)
+		if !ok {
+			continue
+		}
+		apps, err := os.ReadDir(fs.root)
+		if err != nil {
+			continue
+		}
+		for _, app := range apps {
+			if !app.IsDir() {
+				continue
+			}
+			dir := filepath.Join(fs.root, app.Name())
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, f := range files {
+				if f.IsDir() || !strings.HasSuffix(f.Name(), ".log") {
+					continue
+				}
+				path := filepath.Join(dir, f.Name())
+				if fixed, err := s.recoverSegmentTail(path); err != nil {
+					log.Printf("unable to recover %s: %v", path, err)
+				} else if fixed != "" {
+					segmentsRecovered.Add(1)
+					log.Printf("recovered partially written segment %s: %s", path, fixed)
+				}
+			}
+		}
+	}
+}
+
+// 修复单个分段的末尾，返回所做的修复，无需修复时为空
+func (s *Service) recoverSegmentTail(path string) (string, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return "", err
+	}
+	size := info.Size()
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, size-1); err != nil {
+		return "", err
+	}
+	if last[0] == '\n' {
+		return "", nil
+	}
+
+	// 向前找到最后一个换行符
+	const chunk = 64 << 10
+	cut := int64(0)
+	buf := make([]byte, chunk)
+	for end := size; end > 0 && cut == 0; end -= chunk {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			cut = start + int64(i) + 1
+		}
+	}
+	tail := make([]byte, size-cut)
+	if _, err := file.ReadAt(tail, cut); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	// 只缺换行符的完整日志（或文件头）保留下来
+	if line := string(tail); (cut == 0 && isFormatHeader(line)) || s.validLogRecord(path, line) {
+		if _, err := file.WriteAt([]byte{'\n'}, size); err != nil {
+			return "", err
+		}
+		return "appended missing newline", file.Sync()
+	}
+
+	dir := filepath.Join(filepath.Dir(path), quarantineDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	saved := filepath.Join(dir, time.Now().Format("20060102T150405")+"-"+filepath.Base(path)+".partial")
+	if err := os.WriteFile(saved, tail, 0644); err != nil {
+		return "", err
+	}
+	if err := file.Truncate(cut); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("truncated %d bytes, saved to %s", len(tail), saved), file.Sync()
+}
+
+// 是否为完整的 NDJSON 日志记录，旧格式的文本行无法判断是否完整
+func (s *Service) validLogRecord(path, line string) bool {
+	line = s.encryption.Open(path, line)
+	_, err := parseJSONLogLine(line)
+	return strings.HasPrefix(line, "{") && err == nil
+}
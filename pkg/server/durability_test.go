@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 写入两条日志后关闭服务，在分段末尾追加 tail 模拟写到一半时断电，返回分段路径
+func writeSegmentTail(t *testing.T, dir, tail string) string {
+	t.Helper()
+	s := openTestService(t, dir)
+	now := time.Now()
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "order placed", now))
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "order paid", now.Add(time.Second)))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := filepath.Glob(filepath.Join(dir, "logs", "orders", "*.log"))
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("segments %v, %v, want one", segments, err)
+	}
+	file, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(tail); err != nil {
+		t.Fatal(err)
+	}
+	return segments[0]
+}
+
+// 末尾的半行在启动时被截断并保存到 .quarantine，之后的写入从新的一行开始
+func TestRecoverSegmentTailTruncatesPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	tail := `{"application_id":"orders","log_level":"INFO","log_mess`
+	path := writeSegmentTail(t, dir, tail)
+
+	s := openTestService(t, dir)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "\n") || strings.Contains(string(data), tail) {
+		t.Fatalf("partial line kept:\n%s", data)
+	}
+	saved, err := filepath.Glob(filepath.Join(filepath.Dir(path), quarantineDir, "*.partial"))
+	if err != nil || len(saved) != 1 {
+		t.Fatalf("quarantined %v, %v, want one file", saved, err)
+	}
+	if content, _ := os.ReadFile(saved[0]); string(content) != tail {
+		t.Fatalf("quarantined %q, want %q", content, tail)
+	}
+
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "order shipped", time.Now().Add(2*time.Second)))
+	got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}})
+	if want := []string{"order placed", "order paid", "order shipped"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("messages %q, want %q", got, want)
+	}
+}
+
+// 只缺换行符的完整记录补上换行后保留
+func TestRecoverSegmentTailKeepsCompleteRecord(t *testing.T) {
+	dir := t.TempDir()
+	record, err := json.Marshal(testEntry("orders", "INFO", "order refunded", time.Now().Add(1500*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeSegmentTail(t, dir, string(record))
+
+	s := openTestService(t, dir)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), string(record)+"\n") {
+		t.Fatalf("complete record not terminated:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), quarantineDir)); !os.IsNotExist(err) {
+		t.Fatalf("complete record quarantined: %v", err)
+	}
+
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "order closed", time.Now().Add(2*time.Second)))
+	got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}})
+	if want := []string{"order placed", "order paid", "order refunded", "order closed"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("messages %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 日志分段的静态加密。Seata 的 undo log 会把业务 SQL 和行镜像带进日志，需要加密存放时按应用（或租户）
+// 选择密钥，每行单独以 AES-GCM 加密，仍然逐行追加、按行偏移引用，查询、下载和完整性检查时透明解密。
+// 密文绑定应用和分段文件名，被移到其他应用或分段中的行无法解密。行中记录了密钥 ID，轮换密钥时旧密钥需要保留到旧分段过期。只作用于 file 后端
+type EncryptionConfig struct {
+	Keys       map[string]string `json:"keys"`        // 密钥 ID → base64 编码的 16/24/32 字节 AES 密钥，env:NAME 表示从环境变量读取
+	KMS        KMSConfig         `json:"kms"`         // 未在 keys 中给出的密钥从外部 KMS 获取
+	DefaultKey string            `json:"default_key"` // 未匹配任何规则的应用使用的密钥，为空时不加密
+	Rules      []EncryptionRule  `json:"rules"`       // 按顺序匹配，第一条匹配的规则生效
+}
+
+// 按应用选择密钥的规则
+type EncryptionRule struct {
+	Application string `json:"application"` // 应用 ID，支持 * 通配；租户应用为 租户/应用，如 acme/*
+	Key         string `json:"key"`         // 密钥 ID，为空表示该应用不加密
+}
+
+// 外部 KMS：启动时按 GET {url}/{密钥 ID} 获取密钥，响应为 {"key": "<base64>"}
+type KMSConfig struct {
+	URL     string          `json:"url"`
+	Token   string          `json:"token"`   // 以 Bearer 方式携带
+	Timeout Duration        `json:"timeout"` // 默认 10s
+	TLS     ClientTLSConfig `json:"tls"`
+}
+
+// 加密行的前缀，随后是 密钥 ID:base64(nonce+密文)
+const (
+	encryptedLinePrefix       = "~enc2:" // 以 lineAAD 为附加数据
+	legacyEncryptedLinePrefix = "~enc1:" // 早先写入的行，没有附加数据
+)
+
+// 是否为加密行
+func isEncryptedLine(line string) bool {
+	return strings.HasPrefix(line, encryptedLinePrefix) || strings.HasPrefix(line, legacyEncryptedLinePrefix)
+}
+
+// 加密行的附加数据：分段所在的应用目录名（不含租户的应用 ID）和分段文件名（不含压缩后缀）。
+// 压缩、分层和存储类别的链接都不改变这两部分
+func lineAAD(segmentPath string) []byte {
+	return []byte(filepath.Base(filepath.Dir(segmentPath)) + "/" + trimCompressedSuffix(filepath.Base(segmentPath)))
+}
+
+var decryptFailures = metrics.counter("decrypt_failures_total", "Encrypted log lines that could not be decrypted, by key.")
+
+// 按应用加解密日志行，nil 表示未配置加密
+type lineCipher struct {
+	keys       map[string]cipher.AEAD
+	defaultKey string
+	rules      []EncryptionRule
+}
+
+// 按配置加载密钥，没有配置任何密钥时返回 nil
+func newLineCipher(c EncryptionConfig) (*lineCipher, error) {
+	// 规则和默认值引用的密钥都必须可用
+	needed := make(map[string]bool)
+	for id := range c.Keys {
+		needed[id] = true
+	}
+	if c.DefaultKey != "" {
+		needed[c.DefaultKey] = true
+	}
+	for _, r := range c.Rules {
+		if _, err := path.Match(r.Application, ""); err != nil || r.Application == "" {
+			return nil, fmt.Errorf("invalid rule application %q", r.Application)
+		}
+		if r.Key != "" {
+			needed[r.Key] = true
+		}
+	}
+	if len(needed) == 0 {
+		return nil, nil
+	}
+
+	lc := &lineCipher{keys: make(map[string]cipher.AEAD), defaultKey: c.DefaultKey, rules: c.Rules}
+	for id := range needed {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		encoded, ok := c.Keys[id]
+		if !ok {
+			if c.KMS.URL == "" {
+				return nil, fmt.Errorf("key %s is not configured and no kms is set", id)
+			}
+			var err error
+			if encoded, err = fetchKMSKey(c.KMS, id); err != nil {
+				return nil, fmt.Errorf("key %s: %v", id, err)
+			}
+		} else if name, ok := strings.CutPrefix(encoded, "env:"); ok {
+			encoded = os.Getenv(name)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid base64", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		lc.keys[id] = aead
+	}
+	return lc, nil
+}
+
+// 从 KMS 获取 base64 编码的密钥
+func fetchKMSKey(c KMSConfig, id string) (string, error) {
+	timeout := time.Duration(c.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	client, err := newTLSHTTPClient(c.TLS, timeout)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.URL, "/")+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("kms returned %s", resp.Status)
+	}
+	var body struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid kms response: %v", err)
+	}
+	return body.Key, nil
+}
+
+// 应用使用的密钥 ID，为空表示不加密
+func (lc *lineCipher) keyFor(applicationID string) string {
+	for _, r := range lc.rules {
+		if ok, _ := path.Match(r.Application, applicationID); ok {
+			return r.Key
+		}
+	}
+	return lc.defaultKey
+}
+
+// 按应用的密钥加密写入 segmentPath 的一行日志记录，record 带有结尾的换行符；未配置加密或应用不加密时原样返回
+func (lc *lineCipher) Seal(applicationID, segmentPath, record string) (string, error) {
+	if lc == nil {
+		return record, nil
+	}
+	id := lc.keyFor(applicationID)
+	if id == "" {
+		return record, nil
+	}
+	aead := lc.keys[id]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(strings.TrimSuffix(record, "\n")), lineAAD(segmentPath))
+	return encryptedLinePrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed) + "\n", nil
+}
+
+// 解密从 segmentPath 读取的一行，不是加密行时原样返回；密钥未知、内容损坏或行不属于该分段时也原样返回，
+// 由调用方按无法解析的行处理
+func (lc *lineCipher) Open(segmentPath, line string) string {
+	var aad []byte
+	rest, ok := strings.CutPrefix(line, encryptedLinePrefix)
+	if ok {
+		aad = lineAAD(segmentPath)
+	} else if rest, ok = strings.CutPrefix(line, legacyEncryptedLinePrefix); !ok {
+		return line
+	}
+	id, encoded, _ := strings.Cut(rest, ":")
+	if lc == nil || lc.keys[id] == nil {
+		decryptFailures.Add(1, "key", id)
+		return line
+	}
+	aead := lc.keys[id]
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < aead.NonceSize() {
+		decryptFailures.Add(1, "key", id)
+		return line
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+	if err != nil {
+		decryptFailures.Add(1, "key", id)
+		return line
+	}
+	return string(plain)
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEncryptionKey(t testing.TB) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestLineCipher(t testing.TB, key string) *lineCipher {
+	t.Helper()
+	lc, err := newLineCipher(EncryptionConfig{Keys: map[string]string{"k1": key}, DefaultKey: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lc
+}
+
+// 早先版本写入的行：没有附加数据，前缀为 ~enc1:
+func legacyEncryptedLine(t testing.TB, key, record string) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return legacyEncryptedLinePrefix + "k1:" + base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(record), nil))
+}
+
+func TestLineCipherRoundTripAndBinding(t *testing.T) {
+	key := testEncryptionKey(t)
+	lc := newTestLineCipher(t, key)
+	path := filepath.Join("logs", "orders", "2024-05-01.log")
+	record := `{"application_id":"orders","log_message":"order placed"}`
+
+	sealed, err := lc.Seal("orders", path, record+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, encryptedLinePrefix+"k1:") || !strings.HasSuffix(sealed, "\n") || strings.Contains(sealed, "order placed") {
+		t.Fatalf("sealed line %q", sealed)
+	}
+	line := strings.TrimSuffix(sealed, "\n")
+	if got := lc.Open(path, line); got != record {
+		t.Fatalf("Open = %q, want %q", got, record)
+	}
+	// 压缩后的分段与原分段绑定相同
+	if got := lc.Open(path+gzipCodec.suffix, line); got != record {
+		t.Fatalf("Open on the compressed segment = %q, want %q", got, record)
+	}
+
+	// 移到其他应用或分段、错误的密钥、未配置加密时原样返回
+	for name, open := range map[string]func() string{
+		"other application": func() string { return lc.Open(filepath.Join("logs", "payments", "2024-05-01.log"), line) },
+		"other segment":     func() string { return lc.Open(filepath.Join("logs", "orders", "2024-05-02.log"), line) },
+		"wrong key":         func() string { return newTestLineCipher(t, testEncryptionKey(t)).Open(path, line) },
+		"no encryption":     func() string { return (*lineCipher)(nil).Open(path, line) },
+	} {
+		if got := open(); got != line {
+			t.Errorf("%s: Open = %q, want the line unchanged", name, got)
+		}
+	}
+
+	if corrupted := line[:len(line)-4]; lc.Open(path, corrupted) != corrupted {
+		t.Error("corrupted line changed")
+	}
+	if got := lc.Open(path, record); got != record {
+		t.Fatalf("plain line changed to %q", got)
+	}
+	legacy := legacyEncryptedLine(t, key, record)
+	if got := lc.Open(path, legacy); got != record {
+		t.Fatalf("Open on a ~enc1: line = %q, want %q", got, record)
+	}
+}
+
+// 写入时加密，scanFileLines 解密本分段的加密行（包括早先的 ~enc1: 行），其他分段的密文行原样返回
+func TestScanFileLinesDecryptsEncryptedSegments(t *testing.T) {
+	dir := t.TempDir()
+	key := testEncryptionKey(t)
+	c := DefaultConfig()
+	c.DataDir = filepath.Join(dir, "data")
+	c.StorageRoot = filepath.Join(dir, "logs")
+	c.Encryption = EncryptionConfig{Keys: map[string]string{"k1": key}, DefaultKey: "k1"}
+	s, err := Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	now := time.Now()
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "order placed", now))
+	ingestTestEntry(t, s, testEntry("orders", "ERROR", "branch rollback failed", now.Add(time.Millisecond)))
+	names, err := listSegments(s.applicationDir("orders"))
+	if err != nil || len(names) != 1 {
+		t.Fatalf("segments %v, %v", names, err)
+	}
+	path := filepath.Join(s.applicationDir("orders"), names[0])
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "order placed") || strings.Count(string(data), encryptedLinePrefix) != 2 {
+		t.Fatalf("segment is not encrypted:\n%s", data)
+	}
+
+	// 追加一行早先格式的密文和一行从其他分段复制来的密文
+	legacyRecord, err := encodeLogRecord(testEntry("orders", "WARN", "legacy line", now.Add(2*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := s.encryption.Seal("orders", filepath.Join(s.applicationDir("payments"), names[0]), legacyRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(legacyEncryptedLine(t, key, strings.TrimSuffix(legacyRecord, "\n")) + "\n" + moved)
+	f.Close()
+
+	var messages, undecrypted []string
+	if _, err := s.scanFileLines(context.Background(), path, 0, func(line string, offset, next int64) bool {
+		if isFormatHeader(line) {
+			return true
+		}
+		entry, err := parseLogLine(line)
+		if err != nil {
+			undecrypted = append(undecrypted, line)
+			return true
+		}
+		messages = append(messages, entry.LogMessage)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(messages, "|") != "order placed|branch rollback failed|legacy line" {
+		t.Fatalf("decrypted messages %q", messages)
+	}
+	if len(undecrypted) != 1 || !strings.HasPrefix(undecrypted[0], encryptedLinePrefix) {
+		t.Fatalf("lines moved from another segment: %q, want one undecrypted line", undecrypted)
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// enrich 附加的来源字段
+const (
+	sourceIPField   = "source_ip"
+	sourceHostField = "source_host"
+	datacenterField = "datacenter"
+)
+
+// 反向解析结果（包括解析失败）的缓存时间和单次解析的超时，解析在写入路径上同步进行
+const (
+	sourceHostTTL     = 10 * time.Minute
+	sourceHostTimeout = 500 * time.Millisecond
+	sourceHostMaxSize = 4096
+)
+
+var sourceHostLookups = metrics.counter("enrich_host_lookups_total", "Reverse DNS lookups made by enrich processors, by result.")
+
+// 按上传方的地址附加来源字段：source_ip、反向解析的 source_host 和数据中心标签 datacenter，
+// 多区域部署的 Seata 集群可以按 field.datacenter 等查询。已有的同名字段不会被覆盖，
+// 上传方地址未知（如 Kafka 输入、导入）时只附加静态的数据中心标签
+type enrichProcessor struct {
+	resolve    bool
+	datacenter string
+	networks   []datacenterNetwork // 按前缀长度从长到短排列
+	hosts      *sourceHostCache
+}
+
+// 网段与所在的数据中心
+type datacenterNetwork struct {
+	net        *net.IPNet
+	datacenter string
+}
+
+func (p *enrichProcessor) Process(entry *LogData) bool {
+	fields := map[string]string{datacenterField: p.datacenter}
+	if ip := net.ParseIP(entry.Source); ip != nil {
+		fields[sourceIPField] = ip.String()
+		for _, n := range p.networks {
+			if n.net.Contains(ip) {
+				fields[datacenterField] = n.datacenter
+				break
+			}
+		}
+		if p.resolve {
+			fields[sourceHostField] = p.hosts.Lookup(ip.String(), time.Now())
+		}
+	}
+	for _, k := range []string{sourceIPField, sourceHostField, datacenterField} {
+		v := fields[k]
+		if _, ok := entry.Fields[k]; ok || v == "" || len(entry.Fields) >= 64 {
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[k] = v
+	}
+	return true
+}
+
+// 反向解析结果的缓存
+type sourceHostCache struct {
+	mu      sync.Mutex
+	entries map[string]sourceHost
+}
+
+type sourceHost struct {
+	name    string // 解析失败时为空
+	expires time.Time
+}
+
+func newSourceHostCache() *sourceHostCache {
+	return &sourceHostCache{entries: make(map[string]sourceHost)}
+}
+
+// 地址对应的主机名，取第一个 PTR 记录并去掉末尾的点，解析失败时为空
+func (h *sourceHostCache) Lookup(ip string, now time.Time) string {
+	h.mu.Lock()
+	cached, ok := h.entries[ip]
+	h.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sourceHostTimeout)
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	cancel()
+	name := ""
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+		sourceHostLookups.Add(1, "result", "resolved")
+	} else {
+		sourceHostLookups.Add(1, "result", "failed")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// 来源地址通常只有采集代理的数量级，超出上限时说明缓存了大量一次性地址，整体清空
+	if len(h.entries) >= sourceHostMaxSize {
+		h.entries = make(map[string]sourceHost)
+	}
+	h.entries[ip] = sourceHost{name: name, expires: now.Add(sourceHostTTL)}
+	return name
+}
+
+func init() {
+	processorTypes["enrich"] = func(c ProcessorConfig) (processor, error) {
+		p := &enrichProcessor{resolve: c.ResolveHost, datacenter: c.Datacenter}
+		for cidr, dc := range c.Networks {
+			_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", cidr)
+			}
+			if dc == "" {
+				return nil, fmt.Errorf("network %s: datacenter is required", cidr)
+			}
+			p.networks = append(p.networks, datacenterNetwork{net: n, datacenter: dc})
+		}
+		// 前缀长的网段在前，使最长匹配生效，相同长度的按网段排列，结果不随 map 的遍历顺序变化
+		sort.Slice(p.networks, func(i, j int) bool {
+			li, _ := p.networks[i].net.Mask.Size()
+			lj, _ := p.networks[j].net.Mask.Size()
+			if li != lj {
+				return li > lj
+			}
+			return p.networks[i].net.String() < p.networks[j].net.String()
+		})
+		if p.resolve {
+			p.hosts = newSourceHostCache()
+		}
+		return p, nil
+	}
+}
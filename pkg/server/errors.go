@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 生成消息模板时依次替换的可变部分
+var fingerprintRules = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{parser.BareXIDPattern.Regexp, "{xid}"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "{uuid}"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "{ip}"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]*\d[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*\b`), "{hex}"},
+	{regexp.MustCompile(`\d+`), "{num}"},
+}
+
+var spacePattern = regexp.MustCompile(`\s+`)
+
+// 将消息归一化为模板：只取首行（忽略堆栈），替换数字、ID、地址等可变部分
+func messageTemplate(message string) string {
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		message = message[:i]
+	}
+	for _, rule := range fingerprintRules {
+		message = rule.pattern.ReplaceAllString(message, rule.placeholder)
+	}
+	return strings.TrimSpace(spacePattern.ReplaceAllString(message, " "))
+}
+
+// 模板的指纹，相同模板的日志归为同一错误模式
+func templateFingerprint(template string) string {
+	h := fnv.New64a()
+	h.Write([]byte(template))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// 错误模式的示例日志
+type errorExample struct {
+	logRef
+	Timestamp  string `json:"timestamp"`
+	LogMessage string `json:"log_message"`
+}
+
+// 一个错误模式的统计
+type errorPattern struct {
+	Fingerprint string         `json:"fingerprint"`
+	Template    string         `json:"template"`
+	Logger      string         `json:"logger,omitempty"`
+	Count       int            `json:"count"`
+	FirstSeen   time.Time      `json:"first_seen"`
+	LastSeen    time.Time      `json:"last_seen"`
+	Examples    []errorExample `json:"examples"`
+}
+
+// 单个应用的高频错误
+type appTopErrors struct {
+	ApplicationID string         `json:"application_id"`
+	Total         int            `json:"total"`    // 时间范围内的错误总数
+	Patterns      int            `json:"patterns"` // 不同错误模式的数量
+	Top           []errorPattern `json:"top"`
+}
+
+// 统计一个应用在时间范围内的错误模式，每个模式保留最近的 examples 条示例
+func (s *Service) topErrors(ctx context.Context, applicationID string, levels []string, from, to time.Time, limit, examples int) (appTopErrors, error) {
+	result := appTopErrors{ApplicationID: model.BareApplicationID(applicationID), Top: []errorPattern{}}
+	patterns := make(map[string]*errorPattern)
+
+	err := s.forEachStoredLogBetween(ctx, applicationID, from, to, func(entry LogData, ref logRef) bool {
+		if !levelIn(entry.LogLevel, levels) {
+			return true
+		}
+		at := entryTime(entry, ref)
+		if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+			return true
+		}
+
+		template := messageTemplate(entry.LogMessage)
+		// 同一模板来自不同 logger 时视为不同的错误
+		key := templateFingerprint(entry.Logger + "\x00" + template)
+		p, ok := patterns[key]
+		if !ok {
+			p = &errorPattern{Fingerprint: key, Template: template, Logger: entry.Logger, FirstSeen: at, LastSeen: at}
+			patterns[key] = p
+		}
+		p.Count++
+		if at.Before(p.FirstSeen) {
+			p.FirstSeen = at
+		}
+		if at.After(p.LastSeen) {
+			p.LastSeen = at
+		}
+		ref.ApplicationID = result.ApplicationID
+		p.Examples = append(p.Examples, errorExample{logRef: ref, Timestamp: entry.Timestamp, LogMessage: maskText(s.queryMaskRules, entry.LogMessage)})
+		if len(p.Examples) > examples {
+			p.Examples = p.Examples[len(p.Examples)-examples:]
+		}
+		result.Total++
+		return true
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for _, p := range patterns {
+		result.Top = append(result.Top, *p)
+	}
+	sort.Slice(result.Top, func(i, j int) bool {
+		if result.Top[i].Count != result.Top[j].Count {
+			return result.Top[i].Count > result.Top[j].Count
+		}
+		return result.Top[i].LastSeen.After(result.Top[j].LastSeen)
+	})
+	result.Patterns = len(result.Top)
+	if len(result.Top) > limit {
+		result.Top = result.Top[:limit]
+	}
+	return result, nil
+}
+
+// 判断级别是否在列表中，不区分大小写
+func levelIn(level string, levels []string) bool {
+	for _, l := range levels {
+		if strings.EqualFold(level, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// 高频错误接口：按消息模板聚类，返回各应用出现最多的错误模式及示例日志
+func (s *Service) topErrorsHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	examples, err := strconv.Atoi(c.DefaultQuery("examples", "3"))
+	if err != nil || examples < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid examples"})
+		return
+	}
+	levels := splitList(c.DefaultQuery("log_level", "ERROR,FATAL"))
+
+	results := make([]appTopErrors, 0, len(apps))
+	for _, appID := range apps {
+		r, err := s.topErrors(c.Request.Context(), appID, levels, from, to, limit, examples)
+		if err != nil {
+			readFailed(c, err)
+			return
+		}
+		results = append(results, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"log_level":    levels,
+		"applications": results,
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 严重程度升级：已知的严重 Seata 错误（如需要人工处理的回滚失败）常以 INFO 或 WARN 输出，
+// 写入时按规则把匹配的日志提升到指定级别，并在 escalation 字段记录规则名、original_level 记录原级别，
+// 查询可按 field.escalation 过滤，告警规则可用 log_level 或 field.escalation 匹配。只提升不降低
+type EscalationConfig struct {
+	DisableBuiltin bool             `json:"disable_builtin"` // 不使用内置规则
+	Rules          []EscalationRule `json:"rules"`           // 先于内置规则匹配，与内置规则同名时替换之
+}
+
+// 一条升级规则，第一条匹配的规则生效
+type EscalationRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"` // 匹配日志消息的正则
+	Level       string `json:"level"`   // WARN、ERROR 或 FATAL
+	Description string `json:"description,omitempty"`
+	Builtin     bool   `json:"builtin"`
+
+	re *parser.Pattern
+}
+
+// 升级后记录的字段
+const (
+	escalationField    = "escalation"
+	originalLevelField = "original_level"
+)
+
+// 内置规则，覆盖 Seata 中需要人工介入或说明数据可能不一致的日志
+var builtinEscalationRules = []EscalationRule{
+	{Name: "manual_handling_required", Level: "FATAL", Pattern: `(?i)need\s+(?:to\s+)?manual(?:ly)?\s+handl`,
+		Description: "Phase-two commit or rollback gave up and needs manual handling"},
+	{Name: "undo_dirty_data", Level: "FATAL", Pattern: `(?i)has dirty records when undo|dirty (?:data|records?) (?:found|detected)`,
+		Description: "AT rollback found rows modified outside the global transaction; data is inconsistent"},
+	{Name: "rollback_failed_unretryable", Level: "FATAL", Pattern: `\b(?:PhaseTwo_)?RollbackFailed_Unretryable\b`,
+		Description: "A branch rollback failed and will not be retried"},
+	{Name: "commit_failed_unretryable", Level: "FATAL", Pattern: `\b(?:PhaseTwo_)?CommitFailed_Unretryable\b`,
+		Description: "A branch commit failed and will not be retried"},
+	{Name: "rollback_retry_timeout", Level: "ERROR", Pattern: `(?i)\b(?:TimeoutRollbackRetrying|RollbackRetryTimeout|rollback retry(?:ing)? timeout)\b`,
+		Description: "The TC stopped retrying a global rollback after max_rollback_retry_timeout"},
+	{Name: "commit_retry_timeout", Level: "ERROR", Pattern: `(?i)\b(?:CommitRetryTimeout|commit retry(?:ing)? timeout)\b`,
+		Description: "The TC stopped retrying a global commit after max_commit_retry_timeout"},
+	{Name: "no_available_tc", Level: "ERROR", Pattern: `(?i)no available service .*(?:found in cluster|seata)|can ?not (?:connect|register) to (?:the )?(?:seata[- ]server|TC)\b`,
+		Description: "The client cannot reach any TC server"},
+}
+
+// 级别的先后，未知级别视为 INFO
+var levelRanks = map[string]int{"TRACE": 0, "DEBUG": 1, "INFO": 2, "WARN": 3, "ERROR": 4, "FATAL": 5}
+
+var logsEscalated = metrics.counter("log_escalations_total", "Log entries whose level was raised by a severity escalation rule, by rule.")
+
+// 生效的升级规则，按匹配顺序
+type escalationRules []*EscalationRule
+
+func newEscalationRules(c EscalationConfig) (escalationRules, error) {
+	var rules escalationRules
+	seen := make(map[string]bool)
+	for i := range c.Rules {
+		r := c.Rules[i]
+		if !validApplicationID(r.Name) || seen[r.Name] {
+			return nil, fmt.Errorf("invalid or duplicate rule name %q", r.Name)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		r.Builtin = false
+		seen[r.Name] = true
+		rules = append(rules, &r)
+	}
+	if !c.DisableBuiltin {
+		for i := range builtinEscalationRules {
+			r := builtinEscalationRules[i]
+			if seen[r.Name] {
+				continue
+			}
+			if err := r.compile(); err != nil {
+				return nil, fmt.Errorf("builtin rule %s: %w", r.Name, err)
+			}
+			r.Builtin = true
+			rules = append(rules, &r)
+		}
+	}
+	return rules, nil
+}
+
+func (r *EscalationRule) compile() error {
+	r.Level = strings.ToUpper(r.Level)
+	if r.Level != "WARN" && r.Level != "ERROR" && r.Level != "FATAL" {
+		return errors.New("level must be WARN, ERROR or FATAL")
+	}
+	re, err := parser.CompilePattern(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %v", err)
+	}
+	r.re = re
+	return nil
+}
+
+// 按第一条匹配的规则提升日志级别。已标记过的日志（如重放时）不再处理
+func (rules escalationRules) Apply(entry *LogData) {
+	if _, ok := entry.Fields[escalationField]; ok {
+		return
+	}
+	for _, r := range rules {
+		if !r.re.MatchString(entry.LogMessage) {
+			continue
+		}
+		level := strings.ToUpper(entry.LogLevel)
+		if rank, ok := levelRanks[level]; ok && rank >= levelRanks[r.Level] {
+			return
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[escalationField] = r.Name
+		entry.Fields[originalLevelField] = entry.LogLevel
+		entry.LogLevel = r.Level
+		logsEscalated.Add(1, "rule", r.Name)
+		return
+	}
+}
+
+// 按名称查找生效的规则
+func (rules escalationRules) Rule(name string) *EscalationRule {
+	for _, r := range rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// 生效的升级规则接口
+func (s *Service) escalationListHandler(c *gin.Context) {
+	list := make([]EscalationRule, 0, len(s.escalations))
+	for _, r := range s.escalations {
+		list = append(list, *r)
+	}
+	c.JSON(http.StatusOK, list)
+}
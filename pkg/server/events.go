@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 系统事件类型
+const (
+	eventAlert         = "alert"          // 告警规则或探针触发，data 为告警事件
+	eventQuotaExceeded = "quota_exceeded" // 写入因租户配额或磁盘配额被拒绝
+	eventRetention     = "retention"      // 为满足磁盘配额删除了最旧的分段，按级别保留策略删除了到期的日志，或清除了到期的软删除应用
+	eventMigration     = "migration"      // 后端迁移完成或失败
+	eventSeataVersion  = "seata_version"  // 同一租户的 TM、RM、TC 混用了不同版本系列的 Seata
+)
+
+var eventTypes = map[string]bool{eventAlert: true, eventQuotaExceeded: true, eventRetention: true, eventMigration: true, eventSeataVersion: true}
+
+// 保留最近的事件数，断线重连时按 Last-Event-ID 补发
+const eventHistorySize = 1000
+
+// 同一来源的配额事件至少间隔这么久才再次推送，避免持续超额时刷屏
+const eventThrottle = time.Minute
+
+var (
+	eventsPublished = metrics.counter("events_published_total", "System events published to the event stream, by type.")
+	eventsDropped   = metrics.counter("events_dropped_total", "System events dropped for slow event stream subscribers.")
+)
+
+// 推送给事件流订阅者的系统事件
+type SystemEvent struct {
+	ID            int64       `json:"id"`
+	Type          string      `json:"type"`
+	At            time.Time   `json:"at"`
+	ApplicationID string      `json:"application_id,omitempty"`
+	Message       string      `json:"message"`
+	Data          interface{} `json:"data,omitempty"`
+}
+
+// 系统事件分发中心。事件只在产生它的节点上推送
+type eventHub struct {
+	mu        sync.Mutex
+	nextID    int64
+	recent    []SystemEvent
+	subs      map[chan SystemEvent]struct{}
+	throttled map[string]time.Time // 节流键 → 上次推送时间
+}
+
+// 分发一个事件，慢的订阅者丢弃事件而不阻塞调用方
+func (h *eventHub) Publish(eventType, applicationID, message string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishLocked(eventType, applicationID, message, data)
+}
+
+// 与 Publish 相同，但同一 key 在 eventThrottle 内只推送一次
+func (h *eventHub) PublishThrottled(key, eventType, applicationID, message string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if last, ok := h.throttled[key]; ok && now.Sub(last) < eventThrottle {
+		return
+	}
+	h.throttled[key] = now
+	h.publishLocked(eventType, applicationID, message, data)
+}
+
+func (h *eventHub) publishLocked(eventType, applicationID, message string, data interface{}) {
+	h.nextID++
+	ev := SystemEvent{ID: h.nextID, Type: eventType, At: time.Now().UTC(), ApplicationID: applicationID, Message: message, Data: data}
+	h.recent = append(h.recent, ev)
+	if len(h.recent) > eventHistorySize {
+		h.recent = h.recent[len(h.recent)-eventHistorySize:]
+	}
+	eventsPublished.Add(1, "type", eventType)
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			eventsDropped.Add(1)
+		}
+	}
+}
+
+// 订阅新事件，同时返回 ID 大于 lastID 的最近事件用于补发；lastID 为 0 时不补发
+func (h *eventHub) Subscribe(lastID int64) (chan SystemEvent, []SystemEvent) {
+	ch := make(chan SystemEvent, tailBufferSize)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[ch] = struct{}{}
+	var backlog []SystemEvent
+	if lastID > 0 {
+		for _, ev := range h.recent {
+			if ev.ID > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+	return ch, backlog
+}
+
+func (h *eventHub) Unsubscribe(ch chan SystemEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+// 以 Server-Sent Events 格式写出一个事件
+func writeSSE(w io.Writer, ev SystemEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
+
+// 系统事件流接口（Server-Sent Events）：推送告警触发、配额超限、配额清理和迁移结果，
+// 仪表盘和机器人无需轮询。断线重连时浏览器携带 Last-Event-ID，补发之后的最近事件；注释行为心跳
+func (s *Service) eventStreamHandler(c *gin.Context) {
+	types := make(map[string]bool)
+	if raw := c.Query("types"); raw != "" {
+		for _, t := range strings.Split(raw, ",") {
+			t = strings.TrimSpace(t)
+			if !eventTypes[t] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid types"})
+				return
+			}
+			types[t] = true
+		}
+	}
+	applicationID := c.Query("application_id")
+	lastRaw := c.GetHeader("Last-Event-ID")
+	if lastRaw == "" {
+		lastRaw = c.Query("last_event_id")
+	}
+	var lastID int64
+	if lastRaw != "" {
+		var err error
+		if lastID, err = strconv.ParseInt(lastRaw, 10, 64); err != nil || lastID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_event_id"})
+			return
+		}
+	}
+	match := func(ev SystemEvent) bool {
+		return (len(types) == 0 || types[ev.Type]) && (applicationID == "" || ev.ApplicationID == applicationID)
+	}
+
+	ch, backlog := s.systemEvents.Subscribe(lastID)
+	defer s.systemEvents.Unsubscribe(ch)
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	for _, ev := range backlog {
+		if match(ev) {
+			writeSSE(c.Writer, ev)
+		}
+	}
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev := <-ch:
+			if match(ev) {
+				writeSSE(w, ev)
+			}
+			return true
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+			return true
+		case <-s.shuttingDown:
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
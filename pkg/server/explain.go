@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 执行说明中最多列出的分段数，超出的分段只计入汇总
+const maxExplainSegments = 500
+
+// 查询的执行说明，explain=true 时随结果返回，用于分析慢查询：读取了哪些分段、读了多少行、
+// 多少行通过了各级过滤、是否使用了索引和缓存，以及各阶段的耗时
+type queryExplain struct {
+	Strategy string `json:"strategy"` // scan（遍历分段）、index（计数索引）或 backend（存储后端执行）
+
+	LinesRead int `json:"lines_read"` // 读取的原始行数，缓存命中的分段不计
+	// 满足级别和字段条件的日志数，其后再按时间范围、ID、写入顺序和关键字过滤
+	FilterHits int `json:"filter_hits"`
+	Matched    int `json:"matched"`  // 满足全部条件的日志数
+	Returned   int `json:"returned"` // 排序截断后返回的条数，只统计条数时为 0
+
+	Segments          explainSegmentCounts `json:"segments"`
+	Index             explainIndexUsage    `json:"index"`
+	Applications      []explainApplication `json:"applications"`
+	SegmentsTruncated bool                 `json:"segments_truncated,omitempty"` // 分段过多，applications 中只列出前一部分
+
+	TimingMS map[string]float64 `json:"timing_ms"` // 各阶段耗时（毫秒），total 为写出结果之前的总耗时
+
+	started time.Time
+	listed  int
+}
+
+type explainSegmentCounts struct {
+	Scanned   int   `json:"scanned"`
+	Cached    int   `json:"cached"`  // 命中查询缓存，没有读取文件
+	Skipped   int   `json:"skipped"` // 按日期或增量游标跳过
+	BytesRead int64 `json:"bytes_read"`
+}
+
+type explainIndexUsage struct {
+	CountIndex       bool `json:"count_index"`       // 条数直接取自计数索引
+	IncrementalIndex bool `json:"incremental_index"` // 增量查询按计数索引跳过了已返回的部分
+	QueryCacheHits   int  `json:"query_cache_hits"`  // 命中缓存的分段数
+}
+
+// 一个应用的执行情况
+type explainApplication struct {
+	ApplicationID string           `json:"application_id"`
+	Source        string           `json:"source"` // files、view 或存储后端名称
+	Segments      []explainSegment `json:"segments,omitempty"`
+}
+
+// 一个分段的执行情况
+type explainSegment struct {
+	File        string  `json:"file"`
+	Action      string  `json:"action"`           // scanned、cached 或 skipped
+	Reason      string  `json:"reason,omitempty"` // 跳过的原因：out_of_range（整段不在 from、to 范围内）、index（已在增量游标之前）或 archived（归档分段，未指定 include_archive）
+	Storage     string  `json:"storage,omitempty"`
+	StartOffset int64   `json:"start_offset,omitempty"` // 增量查询时按计数索引确定的起始偏移
+	LinesRead   int     `json:"lines_read,omitempty"`
+	BytesRead   int64   `json:"bytes_read,omitempty"`
+	FilterHits  int     `json:"filter_hits,omitempty"`
+	DurationMS  float64 `json:"duration_ms,omitempty"`
+}
+
+// 分段的执行动作
+const (
+	explainScanned = "scanned"
+	explainCached  = "cached"
+	explainSkipped = "skipped"
+)
+
+// 解析 explain 参数，未开启时返回 nil。NDJSON 响应没有放置执行说明的位置
+func parseExplain(c *gin.Context) (*queryExplain, bool) {
+	if c.Query("explain") != "true" {
+		return nil, true
+	}
+	if wantsNDJSON(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "explain is not supported with NDJSON output"})
+		return nil, false
+	}
+	return &queryExplain{Strategy: countFromScan, Applications: []explainApplication{}, TimingMS: make(map[string]float64), started: time.Now()}, true
+}
+
+// 开始记录一个应用
+func (e *queryExplain) application(applicationID, source string) {
+	if e == nil {
+		return
+	}
+	e.Applications = append(e.Applications, explainApplication{ApplicationID: applicationID, Source: source})
+}
+
+// 记录当前应用的一个分段
+func (e *queryExplain) segment(s explainSegment) {
+	if e == nil {
+		return
+	}
+	switch s.Action {
+	case explainScanned:
+		e.Segments.Scanned++
+		e.Segments.BytesRead += s.BytesRead
+		e.LinesRead += s.LinesRead
+	case explainCached:
+		e.Segments.Cached++
+		e.Index.QueryCacheHits++
+	case explainSkipped:
+		e.Segments.Skipped++
+	}
+	e.FilterHits += s.FilterHits
+	if e.listed >= maxExplainSegments || len(e.Applications) == 0 {
+		e.SegmentsTruncated = e.listed >= maxExplainSegments
+		return
+	}
+	e.listed++
+	app := &e.Applications[len(e.Applications)-1]
+	app.Segments = append(app.Segments, s)
+}
+
+// 记录读取的一行，缓存之外的路径（视图、存储后端）逐行调用
+func (e *queryExplain) lineRead() {
+	if e != nil {
+		e.LinesRead++
+	}
+}
+
+// 记录一条满足级别和字段条件的日志，缓存之外的路径逐条调用
+func (e *queryExplain) filterHit() {
+	if e != nil {
+		e.FilterHits++
+	}
+}
+
+// 记录一个阶段的耗时
+func (e *queryExplain) phase(name string, since time.Time) {
+	if e == nil {
+		return
+	}
+	e.TimingMS[name] += durationMS(time.Since(since))
+}
+
+// 结束记录，补上总耗时
+func (e *queryExplain) finish() *queryExplain {
+	e.TimingMS["total"] = durationMS(time.Since(e.started))
+	return e
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// 分段当前的存放方式：plain、压缩编码名称或 tiered（只在对象存储中）
+func segmentStorage(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return "plain"
+	}
+	if p, _ := compressedSegmentPath(path); p != "" {
+		return codecOfFile(p).name
+	}
+	for _, p := range append([]string{path}, compressedPaths(path)...) {
+		if _, err := os.Stat(p + tieredSuffix); err == nil {
+			return "tiered"
+		}
+	}
+	return ""
+}
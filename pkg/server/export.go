@@ -0,0 +1,414 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 导出配置：按条件把日志写成 Parquet 文件，供 Spark、DuckDB 离线分析数月的日志而不占用查询接口
+type ExportConfig struct {
+	Dir          string        `json:"dir"`            // 本地导出目录，默认 data_dir/exports
+	S3           TieringConfig `json:"s3"`             // 导出到对象存储，只使用连接相关的字段，bucket 为空时只能导出到本地
+	RowGroupRows int           `json:"row_group_rows"` // 每个行组的行数，默认 65536
+	FileRows     int           `json:"file_rows"`      // 每个文件的最多行数，默认 1000000
+}
+
+// 导出文件的列，timestamp 为微秒精度的 UTC 时间，fields 为自定义字段的 JSON
+var exportColumns = []parquetColumn{
+	{Name: "timestamp", Type: parquetInt64, Converted: parquetTimestampMicros},
+	{Name: "application_id", Type: parquetByteArray, Converted: parquetUTF8},
+	{Name: "log_level", Type: parquetByteArray, Converted: parquetUTF8},
+	{Name: "log_message", Type: parquetByteArray, Converted: parquetUTF8},
+	{Name: "logger", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+	{Name: "thread", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+	{Name: "xid", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+	{Name: "branch_id", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+	{Name: "trace_id", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+	{Name: "span_id", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+	{Name: "id", Type: parquetInt64, Converted: parquetNoConverted, Optional: true},
+	{Name: "seq", Type: parquetInt64, Converted: parquetNoConverted, Optional: true},
+	{Name: "sample_rate", Type: parquetDouble, Converted: parquetNoConverted, Optional: true},
+	{Name: "fields", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+}
+
+// 一条日志对应的一行，空字符串和零值写为空值
+func exportRow(entry LogData, at time.Time) []any {
+	text := func(s string) any {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	row := []any{at.UnixMicro(), entry.ApplicationID, entry.LogLevel, entry.LogMessage,
+		text(entry.Logger), text(entry.Thread), text(entry.XID), text(entry.BranchID), text(entry.TraceID), text(entry.SpanID),
+		nil, nil, nil, nil}
+	if entry.ID != 0 {
+		row[10] = entry.ID
+	}
+	if entry.Seq != 0 {
+		row[11] = entry.Seq
+	}
+	if entry.SampleRate != 0 {
+		row[12] = entry.SampleRate
+	}
+	if len(entry.Fields) > 0 {
+		fields, _ := json.Marshal(entry.Fields)
+		row[13] = string(fields)
+	}
+	return row
+}
+
+// 导出目的地
+const (
+	exportLocal = "local"
+	exportS3    = "s3"
+)
+
+// 导出阶段
+const (
+	exportPending = "pending"
+	exportRunning = "running"
+	exportDone    = "done"
+	exportFailed  = "failed"
+)
+
+// 导出任务
+type exportJob struct {
+	ID             string       `json:"id"`
+	ApplicationIDs []string     `json:"application_ids"`
+	From           *time.Time   `json:"from,omitempty"`
+	To             *time.Time   `json:"to,omitempty"`
+	LogLevel       string       `json:"log_level,omitempty"`
+	Destination    string       `json:"destination"`
+	Phase          string       `json:"phase"`
+	Rows           int64        `json:"rows"`
+	Files          []exportFile `json:"files"`
+	Error          string       `json:"error,omitempty"`
+	StartedAt      time.Time    `json:"started_at"`
+	FinishedAt     *time.Time   `json:"finished_at,omitempty"`
+}
+
+// 写出的一个文件，location 为本地路径或 s3://bucket/key
+type exportFile struct {
+	ApplicationID string `json:"application_id"`
+	Location      string `json:"location"`
+	Rows          int64  `json:"rows"`
+	Size          int64  `json:"size"`
+	SHA256        string `json:"sha256"`
+}
+
+// 导出任务管理
+type exportManager struct {
+	svc       *Service
+	mu        sync.Mutex
+	seq       int
+	jobs      map[string]*exportJob
+	dir       string
+	s3        *s3Client
+	bucket    string
+	prefix    string
+	groupRows int
+	fileRows  int
+}
+
+func (s *Service) newExportManager(dataDir string, c ExportConfig) (*exportManager, error) {
+	m := &exportManager{svc: s, jobs: make(map[string]*exportJob), dir: c.Dir, groupRows: c.RowGroupRows, fileRows: c.FileRows}
+	if m.dir == "" {
+		m.dir = filepath.Join(dataDir, "exports")
+	}
+	if m.groupRows <= 0 {
+		m.groupRows = 65536
+	}
+	if m.fileRows <= 0 {
+		m.fileRows = 1000000
+	}
+	if m.fileRows < m.groupRows {
+		return nil, fmt.Errorf("file_rows must not be smaller than row_group_rows")
+	}
+	if c.S3.Bucket != "" {
+		client, err := newS3Client(c.S3)
+		if err != nil {
+			return nil, fmt.Errorf("s3: %v", err)
+		}
+		m.s3, m.bucket = client, c.S3.Bucket
+		if prefix := strings.Trim(c.S3.Prefix, "/"); prefix != "" {
+			m.prefix = prefix + "/"
+		}
+	}
+	return m, nil
+}
+
+// 创建导出任务并在后台执行
+func (m *exportManager) Start(job *exportJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 任务编号在重启后从头开始，跳过已有导出目录的编号
+	for {
+		m.seq++
+		if _, err := os.Stat(filepath.Join(m.dir, strconv.Itoa(m.seq))); os.IsNotExist(err) {
+			break
+		}
+	}
+	job.ID = strconv.Itoa(m.seq)
+	job.Phase = exportPending
+	job.StartedAt = time.Now()
+	job.Files = []exportFile{}
+	m.jobs[job.ID] = job
+
+	go m.run(job)
+}
+
+// 读取任务快照
+func (m *exportManager) Get(id string) (exportJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return exportJob{}, false
+	}
+	snapshot := *job
+	snapshot.Files = append([]exportFile{}, job.Files...)
+	return snapshot, true
+}
+
+// 列出所有任务
+func (m *exportManager) List() []exportJob {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.jobs))
+	for id := range m.jobs {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	jobs := make([]exportJob, 0, len(ids))
+	for _, id := range ids {
+		if job, ok := m.Get(id); ok {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+	return jobs
+}
+
+func (m *exportManager) update(job *exportJob, fn func(job *exportJob)) {
+	m.mu.Lock()
+	fn(job)
+	m.mu.Unlock()
+}
+
+func (m *exportManager) run(job *exportJob) {
+	m.update(job, func(job *exportJob) { job.Phase = exportRunning })
+	var err error
+	for _, app := range job.ApplicationIDs {
+		if err = m.exportApplication(job, app); err != nil {
+			break
+		}
+	}
+	if job.Destination == exportS3 {
+		os.RemoveAll(filepath.Join(m.dir, job.ID))
+	}
+
+	m.update(job, func(job *exportJob) {
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			job.Phase = exportFailed
+			job.Error = err.Error()
+		} else {
+			job.Phase = exportDone
+		}
+	})
+	if err != nil {
+		log.Printf("export %s failed: %v", job.ID, err)
+	} else {
+		log.Printf("export %s completed: %d rows in %d files", job.ID, job.Rows, len(job.Files))
+	}
+}
+
+// 正在写入的导出文件
+type exportPart struct {
+	app    string
+	path   string
+	file   *os.File
+	buf    *bufio.Writer
+	sum    hash.Hash
+	size   int64
+	writer *parquetWriter
+}
+
+func (p *exportPart) Write(b []byte) (int, error) {
+	n, err := p.buf.Write(b)
+	p.sum.Write(b[:n])
+	p.size += int64(n)
+	return n, err
+}
+
+// 导出一个应用，超过 fileRows 行时换到下一个文件；没有符合条件的日志时不写文件
+func (m *exportManager) exportApplication(job *exportJob, app string) error {
+	var from, to time.Time
+	if job.From != nil {
+		from = *job.From
+	}
+	if job.To != nil {
+		to = *job.To
+	}
+	dir := filepath.Join(m.dir, job.ID, app)
+	var part *exportPart
+	parts := 0
+	var writeErr error
+	err := m.svc.forEachStoredLogBetween(context.Background(), app, from, to, func(entry LogData, ref logRef) bool {
+		at := entryTime(entry, ref)
+		if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && !at.Before(to)) || !entryMatchesLevel(entry, job.LogLevel) {
+			return true
+		}
+		if part == nil {
+			if part, writeErr = m.createPart(dir, app, parts); writeErr != nil {
+				return false
+			}
+			parts++
+		}
+		m.svc.maskQueryEntry(&entry)
+		entry.ApplicationID = app
+		if writeErr = part.writer.WriteRow(exportRow(entry, at.UTC())...); writeErr != nil {
+			return false
+		}
+		if part.writer.Rows() >= int64(m.fileRows) {
+			writeErr = m.finishPart(job, part)
+			part = nil
+		}
+		return writeErr == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if part != nil {
+		if err != nil {
+			part.file.Close()
+			return err
+		}
+		err = m.finishPart(job, part)
+	}
+	return err
+}
+
+func (m *exportManager) createPart(dir, app string, index int) (*exportPart, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("part-%05d.parquet", index))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &exportPart{app: app, path: path, file: f, buf: bufio.NewWriterSize(f, 1<<20), sum: sha256.New()}
+	if p.writer, err = newParquetWriter(p, exportColumns, m.groupRows); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// 写完文件尾，导出到对象存储时上传后删除本地文件
+func (m *exportManager) finishPart(job *exportJob, p *exportPart) error {
+	err := p.writer.Close()
+	if err == nil {
+		err = p.buf.Flush()
+	}
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	file := exportFile{ApplicationID: p.app, Location: p.path, Rows: p.writer.Rows(), Size: p.size, SHA256: hex.EncodeToString(p.sum.Sum(nil))}
+	if job.Destination == exportS3 {
+		rel, _ := filepath.Rel(m.dir, p.path)
+		key := m.prefix + filepath.ToSlash(rel)
+		if err := m.upload(key, p.path, file); err != nil {
+			return err
+		}
+		os.Remove(p.path)
+		file.Location = "s3://" + m.bucket + "/" + key
+	}
+	m.update(job, func(job *exportJob) {
+		job.Files = append(job.Files, file)
+		job.Rows += file.Rows
+	})
+	return nil
+}
+
+func (m *exportManager) upload(key, path string, file exportFile) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.s3.Put(key, f, file.Size, file.SHA256)
+}
+
+// 创建导出任务接口：按 application_id、from、to 和 log_level 筛选，destination=s3 时上传到配置的对象存储。
+// 返回的任务在后台执行，完成后列出写出的文件
+func (s *Service) exportCreateHandler(c *gin.Context) {
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+	destination := c.DefaultQuery("destination", exportLocal)
+	switch destination {
+	case exportLocal:
+	case exportS3:
+		if s.exports.s3 == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "S3 export is not configured"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destination must be local or s3"})
+		return
+	}
+
+	job := &exportJob{ApplicationIDs: apps, LogLevel: c.Query("log_level"), Destination: destination}
+	if !from.IsZero() {
+		job.From = &from
+	}
+	if !to.IsZero() {
+		job.To = &to
+	}
+	s.exports.Start(job)
+
+	snapshot, _ := s.exports.Get(job.ID)
+	c.JSON(http.StatusAccepted, snapshot)
+}
+
+// 导出任务列表接口
+func (s *Service) exportListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"exports": s.exports.List()})
+}
+
+// 导出任务详情接口
+func (s *Service) exportGetHandler(c *gin.Context) {
+	job, ok := s.exports.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 多租户公平调度配置。总容量按权重在活跃租户之间分配：
+// 系统空闲时租户可以超出份额使用，容量紧张时每个租户只能使用自己的份额
+type FairnessConfig struct {
+	Enabled       bool               `json:"enabled"`
+	IngestRate    float64            `json:"ingest_rate"`    // 全局每秒允许的上传请求数
+	QueryRate     float64            `json:"query_rate"`     // 全局每秒允许的查询请求数
+	Burst         float64            `json:"burst"`          // 桶容量相对每秒速率的倍数，默认 2
+	Weights       map[string]float64 `json:"weights"`        // 租户权重
+	DefaultWeight float64            `json:"default_weight"` // 未配置租户的权重，默认 1
+}
+
+// 租户在该时长内没有请求即不再参与份额分配
+const tenantIdleAfter = 30 * time.Second
+
+// 全局令牌低于该比例时视为过载，开始按份额限流
+const saturationThreshold = 0.2
+
+// 令牌桶
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	last     time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time, rate float64) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = math.Min(b.capacity, b.tokens+elapsed*rate)
+}
+
+// 单类请求（上传或查询）的公平调度器
+type fairScheduler struct {
+	class   string
+	rate    float64
+	burst   float64
+	weights map[string]float64
+	defWt   float64
+
+	mu         sync.Mutex
+	global     tokenBucket
+	tenants    map[string]*tokenBucket
+	lastSeen   map[string]time.Time
+	rateShares map[string]float64
+}
+
+var fairnessRejected = metrics.counter("fairness_rejected_total", "Requests rejected by per-tenant fair scheduling.")
+
+func newFairScheduler(class string, rate float64, c FairnessConfig) *fairScheduler {
+	burst := c.Burst
+	if burst <= 0 {
+		burst = 2
+	}
+	defWt := c.DefaultWeight
+	if defWt <= 0 {
+		defWt = 1
+	}
+	return &fairScheduler{
+		class:    class,
+		rate:     rate,
+		burst:    burst,
+		weights:  c.Weights,
+		defWt:    defWt,
+		global:   tokenBucket{tokens: rate * burst, capacity: rate * burst, last: time.Now()},
+		tenants:  make(map[string]*tokenBucket),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+func (s *fairScheduler) weight(tenant string) float64 {
+	if w, ok := s.weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return s.defWt
+}
+
+// 租户在活跃租户中按权重分到的速率，调用方需持有锁
+func (s *fairScheduler) shareLocked(tenant string, now time.Time) float64 {
+	total := 0.0
+	for t, seen := range s.lastSeen {
+		if now.Sub(seen) > tenantIdleAfter {
+			delete(s.lastSeen, t)
+			delete(s.tenants, t)
+			continue
+		}
+		total += s.weight(t)
+	}
+	if total == 0 {
+		return s.rate
+	}
+	return s.rate * s.weight(tenant) / total
+}
+
+// 尝试接纳一个请求，拒绝时返回建议的重试等待时间
+func (s *fairScheduler) Admit(tenant string) (bool, time.Duration) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSeen[tenant] = now
+	share := s.shareLocked(tenant, now)
+
+	s.global.refill(now, s.rate)
+	bucket, ok := s.tenants[tenant]
+	if !ok {
+		bucket = &tokenBucket{tokens: share * s.burst, capacity: share * s.burst, last: now}
+		s.tenants[tenant] = bucket
+	}
+	bucket.capacity = share * s.burst
+	bucket.refill(now, share)
+
+	if s.global.tokens < 1 {
+		return false, time.Duration(float64(time.Second) * (1 - s.global.tokens) / s.rate)
+	}
+
+	saturated := s.global.tokens < s.global.capacity*saturationThreshold
+	if saturated && bucket.tokens < 1 {
+		return false, time.Duration(float64(time.Second) * (1 - bucket.tokens) / share)
+	}
+
+	s.global.tokens--
+	bucket.tokens = math.Max(bucket.tokens-1, -s.burst)
+	return true, 0
+}
+
+// 请求所属租户：路径参数 tenant → X-Tenant 请求头 → application_id 查询参数
+func tenantOf(c *gin.Context) string {
+	if tenant := c.Param("tenant"); tenant != "" {
+		return tenant
+	}
+	if tenant := c.GetHeader("X-Tenant"); tenant != "" {
+		return tenant
+	}
+	if app := c.Query("application_id"); app != "" {
+		return app
+	}
+	return "default"
+}
+
+// 公平调度中间件，scheduler 为 nil 时不限流
+func fairnessMiddleware(s *fairScheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s == nil {
+			c.Next()
+			return
+		}
+		tenant := tenantOf(c)
+		ok, retryAfter := s.Admit(tenant)
+		if !ok {
+			fairnessRejected.Add(1, "class", s.class, "tenant", tenant)
+			c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Tenant capacity exceeded, retry later"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// 按配置创建上传和查询的调度器，未启用或速率未配置时返回 nil
+func newFairSchedulers(c FairnessConfig) (ingest, query *fairScheduler) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	if c.IngestRate > 0 {
+		ingest = newFairScheduler("ingest", c.IngestRate, c)
+	}
+	if c.QueryRate > 0 {
+		query = newFairScheduler("query", c.QueryRate, c)
+	}
+	return ingest, query
+}
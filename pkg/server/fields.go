@@ -0,0 +1,91 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 查询参数中字段过滤条件的前缀，如 field.pod=seata-0
+const fieldParamPrefix = "field."
+
+// 日志字段的取值：先查上传时附带的自定义字段，再查内置的结构化字段
+func logFieldValue(entry LogData, key string) (string, bool) {
+	if v, ok := entry.Fields[key]; ok {
+		return v, true
+	}
+	switch key {
+	case "logger":
+		return entry.Logger, entry.Logger != ""
+	case "thread":
+		return entry.Thread, entry.Thread != ""
+	case "xid":
+		return entry.XID, entry.XID != ""
+	case "branch_id":
+		return entry.BranchID, entry.BranchID != ""
+	case "trace_id":
+		return entry.TraceID, entry.TraceID != ""
+	case "span_id":
+		return entry.SpanID, entry.SpanID != ""
+	case parser.ModeField:
+		// 标记事务模式之前写入的日志从消息中识别
+		mode := parser.ClassifyMode(entry.LogMessage)
+		return mode, mode != ""
+	case tcNodeField:
+		// 标记 TC 节点之前写入的日志只能从 raft 日志中识别
+		node := raftNode(entry.LogMessage)
+		return node, node != ""
+	}
+	return "", false
+}
+
+// 从查询参数中解析字段过滤条件，同一字段给出多个值时满足其一即可。
+// mode 是 field.seata_mode 的简写，取值不区分大小写；tc_node 是 field.tc_node 的简写
+func parseFieldFilters(c *gin.Context) map[string][]string {
+	var filters map[string][]string
+	for name, values := range c.Request.URL.Query() {
+		key := strings.TrimPrefix(name, fieldParamPrefix)
+		if name == "mode" {
+			key = parser.ModeField
+		} else if name == tcNodeField {
+			key = tcNodeField
+		} else if key == name || key == "" {
+			continue
+		}
+		if key == parser.ModeField {
+			upper := make([]string, len(values))
+			for i, v := range values {
+				upper[i] = strings.ToUpper(v)
+			}
+			values = upper
+		}
+		if filters == nil {
+			filters = make(map[string][]string)
+		}
+		filters[key] = append(filters[key], values...)
+	}
+	return filters
+}
+
+// 判断日志是否满足全部字段过滤条件
+func matchesFields(entry LogData, filters map[string][]string) bool {
+	for key, values := range filters {
+		v, ok := logFieldValue(entry, key)
+		if !ok {
+			return false
+		}
+		matched := false
+		for _, want := range values {
+			if v == want {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 应用的一个日志分段文件
+type logFileInfo struct {
+	File       string `json:"file"` // 逻辑文件名，与日志引用中的相同
+	Day        string `json:"day"`
+	Segment    int    `json:"segment"`
+	Size       int64  `json:"size"` // 本地文件的字节数，压缩分段为压缩后的大小，只在对象存储中时为 0
+	Compressed bool   `json:"compressed"`
+	Codec      string `json:"codec,omitempty"` // 压缩分段的编码
+	Tiered     bool   `json:"tiered"`          // 已上传到对象存储，下载时从对象存储取回
+}
+
+// 列出应用目录中的分段文件
+func (s *Service) listLogFiles(applicationID string) ([]logFileInfo, error) {
+	dir := s.applicationDir(applicationID)
+	names, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]logFileInfo, 0, len(names))
+	for _, name := range names {
+		day, index, ok := parseSegmentName(name)
+		if !ok {
+			continue
+		}
+		f := logFileInfo{File: name, Day: day, Segment: index}
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil {
+			f.Size = info.Size()
+		} else if p, info := compressedSegmentPath(path); p != "" {
+			f.Size, f.Compressed, f.Codec = info.Size(), true, codecOfFile(p).name
+		}
+		if _, err := os.Stat(path + tieredSuffix); err == nil {
+			f.Tiered = true
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// 解析路径中的应用并确认其存放在本地目录中
+func (s *Service) fileApplication(c *gin.Context) (string, bool) {
+	app, ok := s.queriedApplicationID(c, c.Param("application_id"))
+	if !ok {
+		return "", false
+	}
+	if _, ok := s.queryStoreOf(app); ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Application is stored on a backend without log files"})
+		return "", false
+	}
+	return app, true
+}
+
+// 日志文件列表接口
+func (s *Service) logFileListHandler(c *gin.Context) {
+	app, ok := s.fileApplication(c)
+	if !ok {
+		return
+	}
+	files, err := s.listLogFiles(app)
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list log files"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"application_id": c.Param("application_id"), "files": files})
+}
+
+// 日志文件下载接口：按分段顺序拼接当天的全部分段，输出与磁盘上相同的 NDJSON（只保留第一个文件头，加密的行解密后输出），
+// gzip=true 时压缩后下载。压缩和已分层的分段透明地解压或从对象存储取回。
+// 配置了查询脱敏规则时与查询接口一致，每行解析后脱敏再重新编码输出
+func (s *Service) logFileDownloadHandler(c *gin.Context) {
+	app, ok := s.fileApplication(c)
+	if !ok {
+		return
+	}
+	date := c.Param("date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in 2006-01-02 format"})
+		return
+	}
+	files, err := s.listLogFiles(app)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list log files"})
+		return
+	}
+	var names []string
+	for _, f := range files {
+		if f.Day == date {
+			names = append(names, f.File)
+		}
+	}
+	if len(names) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No log file for this date"})
+		return
+	}
+
+	// 先打开第一个分段，出错时仍可以返回 JSON 错误
+	dir := s.applicationDir(app)
+	first, err := s.openSegment(filepath.Join(dir, names[0]))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read log file"})
+		return
+	}
+
+	// 文件名取不含租户的应用 ID，引号和非 ASCII 字符由 FormatMediaType 转义或按 RFC 2231 编码
+	filename := model.BareApplicationID(app) + "-" + date + ".log"
+	var w io.Writer = c.Writer
+	if c.Query("gzip") == "true" {
+		c.Header("Content-Type", "application/gzip")
+		filename += gzipCodec.suffix
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		w = gz
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Status(http.StatusOK)
+
+	for i, name := range names {
+		rc := first
+		if i > 0 {
+			if rc, err = s.openSegment(filepath.Join(dir, name)); err != nil {
+				// 响应已经开始，只能中断下载
+				c.Error(err)
+				break
+			}
+		}
+		_, err := s.copySegment(w, rc, filepath.Join(dir, name), i > 0)
+		rc.Close()
+		if err != nil {
+			c.Error(err)
+			break
+		}
+	}
+	auditCount(c, len(names))
+}
+
+// 按查询脱敏规则处理一行日志。文件头原样保留，无法解析的行按纯文本脱敏
+func (s *Service) maskLogLine(line string) string {
+	trimmed := strings.TrimRight(line, "\r\n")
+	entry, err := parseLogLine(trimmed)
+	if errors.Is(err, errNotLogRecord) {
+		return line
+	}
+	if err != nil {
+		return maskText(s.queryMaskRules, trimmed) + "\n"
+	}
+	s.maskQueryEntry(&entry)
+	masked, err := encodeLogRecord(entry)
+	if err != nil {
+		return maskText(s.queryMaskRules, trimmed) + "\n"
+	}
+	return masked
+}
+
+// 逐行复制 path 分段的内容并解密加密的行，skipHeader 时去掉开头的文件头
+func (s *Service) copySegment(w io.Writer, r io.Reader, path string, skipHeader bool) (int64, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var written int64
+	for first := true; ; first = false {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return written, err
+		}
+		if line != "" && !(first && skipHeader && isFormatHeader(line)) {
+			if isEncryptedLine(line) {
+				line = s.encryption.Open(path, strings.TrimRight(line, "\r\n")) + "\n"
+			}
+			if len(s.queryMaskRules) > 0 {
+				line = s.maskLogLine(line)
+			}
+			n, werr := io.WriteString(w, line)
+			written += int64(n)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+	}
+}
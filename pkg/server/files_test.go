@@ -0,0 +1,66 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogFileDownloadAppliesQueryMask(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	rules, err := compileMaskRules(MaskConfig{Presets: []string{"email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.queryMaskRules = rules
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "order placed by alice@example.com", time.Now()))
+
+	files, err := s.listLogFiles("orders")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("listLogFiles = %v, %v", files, err)
+	}
+	router := newTestRouter(t, s)
+	req := httptest.NewRequest(http.MethodGet, "/applications/orders/files/"+files[0].Day, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("download returned %d: %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "alice@example.com") || !strings.Contains(body, "order placed by") {
+		t.Fatalf("download was not masked:\n%s", body)
+	}
+	if !isFormatHeader(strings.SplitAfter(body, "\n")[0]) {
+		t.Fatalf("download lost the file header:\n%s", body)
+	}
+}
+
+// 下载的文件名取不含租户的应用 ID，引号和非 ASCII 字符不会破坏 Content-Disposition
+func TestLogFileDownloadContentDisposition(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	app := `订单"v2`
+	ingestTestEntry(t, s, testEntry(app, "INFO", "order placed", time.Now()))
+	files, err := s.listLogFiles(app)
+	if err != nil || len(files) == 0 {
+		t.Fatalf("listLogFiles = %v, %v", files, err)
+	}
+
+	router := newTestRouter(t, s)
+	req := httptest.NewRequest(http.MethodGet, "/applications/"+url.PathEscape(app)+"/files/"+files[0].Day+"?gzip=true", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("download returned %d: %s", w.Code, w.Body)
+	}
+	disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	if err != nil {
+		t.Fatalf("Content-Disposition %q: %v", w.Header().Get("Content-Disposition"), err)
+	}
+	if want := app + "-" + files[0].Day + ".log.gz"; disposition != "attachment" || params["filename"] != want {
+		t.Fatalf("Content-Disposition %q, want attachment with filename %q", w.Header().Get("Content-Disposition"), want)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/i18n"
+)
+
+// 分析器输出的发现及其实体和证据，定义见 analysis 包
+type (
+	Finding     = analysis.Finding
+	Entity      = analysis.Entity
+	EvidenceRef = analysis.EvidenceRef
+)
+
+// 发现结构的 JSON Schema
+const findingJSONSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "seata-log-analysis/finding.json",
+  "title": "Finding",
+  "type": "object",
+  "required": ["code", "severity", "title", "message", "entities", "evidence", "count", "first_seen", "last_seen"],
+  "properties": {
+    "code": {"type": "string", "pattern": "^[A-Z]+(-[A-Z]+)*-[0-9]{3}$", "description": "Stable finding code, see GET /analysis/codes"},
+    "severity": {"enum": ["info", "warning", "error", "critical"]},
+    "title": {"type": "string"},
+    "message": {"type": "string"},
+    "entities": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["type", "id"],
+        "properties": {
+          "type": {"type": "string", "description": "application, xid, branch, resource, table, tc_node, peer, ..."},
+          "id": {"type": "string"}
+        }
+      }
+    },
+    "evidence": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["application_id", "file", "offset"],
+        "properties": {
+          "application_id": {"type": "string"},
+          "file": {"type": "string"},
+          "offset": {"type": "integer", "description": "Byte offset of the log line in the file"},
+          "timestamp": {"type": "string"},
+          "excerpt": {"type": "string"}
+        }
+      }
+    },
+    "count": {"type": "integer"},
+    "first_seen": {"type": "string", "format": "date-time"},
+    "last_seen": {"type": "string", "format": "date-time"}
+  }
+}`
+
+// 发现结构的 JSON Schema 接口
+func findingSchemaHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", []byte(findingJSONSchema))
+}
+
+// 发现编码目录接口
+func (s *Service) findingCodesHandler(c *gin.Context) {
+	lang := s.requestLanguage(c)
+	codes := analysis.Catalog()
+	for i, spec := range codes {
+		codes[i].Title, codes[i].Description = i18n.Tr(lang, spec.Title), i18n.Tr(lang, spec.Description)
+	}
+	c.JSON(http.StatusOK, gin.H{"codes": codes})
+}
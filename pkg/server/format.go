@@ -0,0 +1,402 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 日志文件格式版本
+//
+//	版本 1：[timestamp] [level]: message，没有文件头
+//	版本 2：首行为格式头，之后每行一个 JSON 对象（NDJSON）
+const (
+	formatName    = "seata-log-ndjson"
+	formatVersion = 2
+)
+
+// 文件头，每个新建的日志文件首行写入
+type formatHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+var formatHeaderLine = mustEncodeHeader()
+
+func mustEncodeHeader() string {
+	data, err := json.Marshal(formatHeader{Format: formatName, Version: formatVersion})
+	if err != nil {
+		panic(err)
+	}
+	return string(data) + "\n"
+}
+
+// 将日志编码为一行 NDJSON
+func encodeLogRecord(entry LogData) (string, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+var (
+	errInvalidLogFormat = errors.New("invalid log format")
+	errNotLogRecord     = errors.New("not a log record")
+)
+
+// 解析日志行，将其转换为 LogData 结构体。
+// 同时兼容 NDJSON 行与版本 1 的方括号格式，文件头行返回错误以便调用方跳过
+func parseLogLine(logLine string) (LogData, error) {
+	if strings.HasPrefix(logLine, "{") {
+		return parseJSONLogLine(logLine)
+	}
+	return parseLegacyLogLine(logLine)
+}
+
+// 回退到 encoding/json 时复用的行缓冲，避免每行把字符串复制成新的 []byte
+var jsonLineBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+// 解析 NDJSON 行。写入时由 encodeLogRecord 生成的行先按快速路径解码，
+// 其余情况（未知字段、null、非法 UTF-8 等）交给 encoding/json，结果与之一致
+func parseJSONLogLine(logLine string) (LogData, error) {
+	var log LogData
+	if logLine == formatHeaderLine[:len(formatHeaderLine)-1] {
+		return log, errNotLogRecord
+	}
+	if !decodeLogRecord(logLine, &log) {
+		var err error
+		if log, err = unmarshalLogRecord(logLine); err != nil {
+			return log, fmt.Errorf("%w: %v", errInvalidLogFormat, err)
+		}
+	}
+	if log.LogLevel == "" && log.LogMessage == "" {
+		// 文件头或其他非日志对象
+		return log, errNotLogRecord
+	}
+	return log, nil
+}
+
+func unmarshalLogRecord(logLine string) (LogData, error) {
+	var log LogData
+	buf := jsonLineBuffers.Get().(*[]byte)
+	*buf = append((*buf)[:0], logLine...)
+	err := json.Unmarshal(*buf, &log)
+	jsonLineBuffers.Put(buf)
+	return log, err
+}
+
+// 按 encodeLogRecord 的输出解码一行：字段名精确匹配、没有多余空白，不含转义的字符串直接切自原行，
+// 不再逐个分配。遇到任何不确定的情况返回 false，由调用方交给 encoding/json
+func decodeLogRecord(line string, log *LogData) bool {
+	d := recordDecoder{s: line}
+	if !d.consume('{') {
+		return false
+	}
+	if d.consume('}') {
+		return d.pos == len(d.s)
+	}
+	for {
+		key, ok := d.str()
+		if !ok || !d.consume(':') {
+			return false
+		}
+		switch key {
+		case "application_id":
+			ok = d.strInto(&log.ApplicationID)
+		case "log_level":
+			ok = d.strInto(&log.LogLevel)
+		case "timestamp":
+			ok = d.strInto(&log.Timestamp)
+		case "log_message":
+			ok = d.strInto(&log.LogMessage)
+		case "logger":
+			ok = d.strInto(&log.Logger)
+		case "thread":
+			ok = d.strInto(&log.Thread)
+		case "xid":
+			ok = d.strInto(&log.XID)
+		case "branch_id":
+			ok = d.strInto(&log.BranchID)
+		case "trace_id":
+			ok = d.strInto(&log.TraceID)
+		case "span_id":
+			ok = d.strInto(&log.SpanID)
+		case "id":
+			log.ID, ok = d.int()
+		case "seq":
+			log.Seq, ok = d.int()
+		case "sample_rate":
+			log.SampleRate, ok = d.float()
+		case "fields":
+			ok = d.fields(log)
+		default:
+			return false
+		}
+		if !ok {
+			return false
+		}
+		if d.consume('}') {
+			return d.pos == len(d.s)
+		}
+		if !d.consume(',') {
+			return false
+		}
+	}
+}
+
+type recordDecoder struct {
+	s   string
+	pos int
+}
+
+func (d *recordDecoder) consume(c byte) bool {
+	if d.pos < len(d.s) && d.s[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// 读取一个字符串字面量，返回去掉引号的原文和是否不含转义
+func (d *recordDecoder) literal() (string, bool, bool) {
+	if !d.consume('"') {
+		return "", false, false
+	}
+	start, plain, ascii := d.pos, true, true
+	for d.pos < len(d.s) {
+		c := d.s[d.pos]
+		switch {
+		case c == '"':
+			raw := d.s[start:d.pos]
+			d.pos++
+			if !ascii && !utf8.ValidString(raw) {
+				return "", false, false
+			}
+			return raw, plain, true
+		case c == '\\':
+			plain = false
+			d.pos++
+		case c < 0x20:
+			return "", false, false
+		case c >= utf8.RuneSelf:
+			ascii = false
+		}
+		d.pos++
+	}
+	return "", false, false
+}
+
+// 读取不含转义的字符串，字段名都不含转义
+func (d *recordDecoder) str() (string, bool) {
+	raw, plain, ok := d.literal()
+	return raw, ok && plain
+}
+
+// 读取字符串值，含转义时只对这一个值调用 encoding/json
+func (d *recordDecoder) strInto(dst *string) bool {
+	start := d.pos
+	raw, plain, ok := d.literal()
+	if !ok {
+		return false
+	}
+	if plain {
+		*dst = raw
+		return true
+	}
+	value, ok := unescapeJSON(raw)
+	if !ok {
+		var v string
+		if json.Unmarshal([]byte(d.s[start:d.pos]), &v) != nil {
+			return false
+		}
+		value = v
+	}
+	*dst = value
+	return true
+}
+
+// 还原字符串中的转义，只分配一次结果。\u 转义的代理对不完整等少见情况返回 false
+func unescapeJSON(raw string) (string, bool) {
+	var b strings.Builder
+	b.Grow(len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(raw) {
+			return "", false
+		}
+		switch raw[i] {
+		case '"', '\\', '/':
+			b.WriteByte(raw[i])
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if i+4 >= len(raw) {
+				return "", false
+			}
+			r, err := strconv.ParseUint(raw[i+1:i+5], 16, 16)
+			if err != nil || utf16.IsSurrogate(rune(r)) {
+				return "", false
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// 数字原文，到下一个逗号或右括号为止
+func (d *recordDecoder) number() string {
+	start := d.pos
+	for d.pos < len(d.s) && d.s[d.pos] != ',' && d.s[d.pos] != '}' {
+		d.pos++
+	}
+	return d.s[start:d.pos]
+}
+
+func (d *recordDecoder) int() (int64, bool) {
+	raw := d.number()
+	if !jsonNumber(raw) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	return n, err == nil
+}
+
+func (d *recordDecoder) float() (float64, bool) {
+	raw := d.number()
+	if !jsonNumber(raw) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	return f, err == nil
+}
+
+// 是否符合 JSON 的数字语法，strconv 接受的 0x、Inf、前导零等写法都不算
+func jsonNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	digits := func() int {
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		return i - start
+	}
+	if i < len(s) && s[i] == '0' {
+		i++
+	} else if digits() == 0 {
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		if digits() == 0 {
+			return false
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return i == len(s)
+}
+
+// 读取 fields 对象，与 encoding/json 一样合并到已有的 map 中
+func (d *recordDecoder) fields(log *LogData) bool {
+	if !d.consume('{') {
+		return false
+	}
+	if d.consume('}') {
+		if log.Fields == nil {
+			log.Fields = map[string]string{}
+		}
+		return true
+	}
+	for {
+		start := d.pos
+		key, plain, ok := d.literal()
+		if !ok {
+			return false
+		}
+		if !plain && json.Unmarshal([]byte(d.s[start:d.pos]), &key) != nil {
+			return false
+		}
+		if !d.consume(':') {
+			return false
+		}
+		var value string
+		if !d.strInto(&value) {
+			return false
+		}
+		if log.Fields == nil {
+			log.Fields = make(map[string]string)
+		}
+		log.Fields[key] = value
+		if d.consume('}') {
+			return true
+		}
+		if !d.consume(',') {
+			return false
+		}
+	}
+}
+
+// 解析版本 1 的方括号格式：[timestamp] [level]: message
+func parseLegacyLogLine(logLine string) (LogData, error) {
+	var log LogData
+	if !strings.HasPrefix(logLine, "[") {
+		return log, errInvalidLogFormat
+	}
+
+	rest := logLine[1:]
+	tsEnd := strings.Index(rest, "] [")
+	if tsEnd < 0 {
+		return log, errInvalidLogFormat
+	}
+	log.Timestamp = rest[:tsEnd]
+
+	rest = rest[tsEnd+len("] ["):]
+	levelEnd := strings.Index(rest, "]: ")
+	if levelEnd < 0 {
+		return log, errInvalidLogFormat
+	}
+	log.LogLevel = rest[:levelEnd]
+	log.LogMessage = rest[levelEnd+len("]: "):]
+
+	// 早期上传的 Seata 原始行被拆到了时间戳和级别两个字段中，按 Seata 布局重新解析
+	if entry, ok := parser.ParseSeataLine("", log.Timestamp+"] ["+log.LogLevel+": "+log.LogMessage, time.Time{}); ok {
+		return entry, nil
+	}
+
+	return log, nil
+}
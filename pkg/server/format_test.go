@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 快速路径之前的解码方式，作为对照
+func parseJSONLogLineStdlib(logLine string) (LogData, error) {
+	var log LogData
+	if err := json.Unmarshal([]byte(logLine), &log); err != nil {
+		return log, fmt.Errorf("invalid log format: %v", err)
+	}
+	if log.LogLevel == "" && log.LogMessage == "" {
+		return log, fmt.Errorf("not a log record")
+	}
+	return log, nil
+}
+
+var testMessageParts = []string{
+	"Branch commit failed", "xid=192.168.1.10:8091:2612345678", "中文消息", "tab\there", "quote \"x\"",
+	"back\\slash", "line1\nline2", "<html>&amp;", "emoji 😀", "\u2028", "control \x01", "",
+}
+
+// 随机生成一条日志，约一成带有堆栈和自定义字段
+func randomLogData(r *rand.Rand) LogData {
+	var msg strings.Builder
+	for i := r.Intn(4); i >= 0; i-- {
+		msg.WriteString(testMessageParts[r.Intn(len(testMessageParts))] + " ")
+	}
+	entry := LogData{
+		ApplicationID: "orders",
+		LogLevel:      []string{"INFO", "WARN", "ERROR", "DEBUG"}[r.Intn(4)],
+		Timestamp:     time.Unix(1760000000+int64(r.Intn(86400)), int64(r.Intn(1e9))).UTC().Format(time.RFC3339Nano),
+		LogMessage:    msg.String(),
+		ID:            r.Int63n(1 << 40),
+		Seq:           r.Int63(),
+	}
+	if r.Intn(10) == 0 {
+		entry.LogMessage += "\n\tat io.seata.rm.AbstractResourceManager.branchReport(AbstractResourceManager.java:98)\n\tat io.seata.rm.DefaultResourceManager.branchReport(DefaultResourceManager.java:71)"
+		entry.Logger, entry.Thread = "io.seata.rm.AbstractResourceManager", "rpcDispatch_RMROLE_1_1_16"
+		entry.XID, entry.BranchID = "192.168.1.10:8091:2612345678", "2612345680"
+		entry.SampleRate = []float64{0.5, 0.25, 1e-3}[r.Intn(3)]
+		entry.Fields = map[string]string{"pod": "orders-7d9f", "service": testMessageParts[r.Intn(len(testMessageParts))]}
+	}
+	return entry
+}
+
+func TestDecodeLogRecordMatchesEncodingJSON(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := []string{
+		// 快速路径无法处理、交给 encoding/json 的写法
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":null}`,
+		`{"Application_ID":"a","LOG_LEVEL":"INFO","timestamp":"t","log_message":"m"}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m","unknown":[1,2]}`,
+		`{ "application_id": "a", "log_level": "INFO", "timestamp": "t", "log_message": "m" }`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"bad ` + "\xff" + `"}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"\ud83d\ude00 \ud83d"}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m","id":1e3}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m","id":0x10}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m","id":007}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m","sample_rate":-0.5e-2}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m","fields":{"a\u00e9":"\/x","b":"1"}}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m","fields":{}}`,
+		`{"application_id":"a","log_level":"INFO","log_level":"WARN","timestamp":"t","log_message":"m"}`,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m"} `,
+		`{"application_id":"a","log_level":"INFO","timestamp":"t","log_message":"m"`,
+		`{"application_id":"a"}`,
+		`{}`,
+		strings.TrimSuffix(formatHeaderLine, "\n"),
+	}
+	for i := 0; i < 2000; i++ {
+		line, err := encodeLogRecord(randomLogData(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	for _, line := range lines {
+		got, err := parseJSONLogLine(line)
+		want, wantErr := parseJSONLogLineStdlib(line)
+		if (err != nil) != (wantErr != nil) {
+			t.Fatalf("line %s: error %v, encoding/json error %v", line, err, wantErr)
+		}
+		if err == nil && !reflect.DeepEqual(got, want) {
+			t.Fatalf("line %s:\n got %+v\nwant %+v", line, got, want)
+		}
+	}
+}
+
+// 写入一个 20000 行的分段，约一成带有堆栈和自定义字段
+func writeBenchmarkSegment(b *testing.B, path string) []string {
+	b.Helper()
+	r := rand.New(rand.NewSource(1))
+	lines := make([]string, 0, 20000)
+	var data strings.Builder
+	data.WriteString(formatHeaderLine)
+	for i := 0; i < cap(lines); i++ {
+		line, err := encodeLogRecord(randomLogData(r))
+		if err != nil {
+			b.Fatal(err)
+		}
+		data.WriteString(line)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if err := os.WriteFile(path, []byte(data.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return lines
+}
+
+func BenchmarkParseLogLine(b *testing.B) {
+	lines := writeBenchmarkSegment(b, filepath.Join(b.TempDir(), "segment.log"))
+	for _, bc := range []struct {
+		name  string
+		parse func(string) (LogData, error)
+	}{
+		{"decoder", parseLogLine},
+		{"encoding_json", parseJSONLogLineStdlib},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bc.parse(lines[i%len(lines)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// 读取并解析整个分段，与查询扫描的路径相同
+func BenchmarkScanSegment(b *testing.B) {
+	dir := b.TempDir()
+	s := openTestService(b, dir)
+	path := filepath.Join(dir, "segment.log")
+	lines := writeBenchmarkSegment(b, path)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parsed := 0
+		_, err := s.scanFileLines(context.Background(), path, 0, func(line string, offset, next int64) bool {
+			if _, err := parseLogLine(line); err == nil {
+				parsed++
+			}
+			return true
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if parsed != len(lines) {
+			b.Fatalf("parsed %d of %d lines", parsed, len(lines))
+		}
+	}
+	b.ReportMetric(float64(len(lines)*b.N)/b.Elapsed().Seconds(), "lines/s")
+}
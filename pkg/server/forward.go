@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"logAnalysis/pkg/parser"
+)
+
+// Fluent forward 协议输入：Fluent Bit / Fluentd 的 forward 输出可以直接把日志发到这里
+type ForwardConfig struct {
+	Listen         string `json:"listen"`          // 监听地址，如 :24224，为空时不启用
+	TLS            bool   `json:"tls"`             // 使用 tls 配置中的证书（及客户端证书校验）
+	ApplicationKey string `json:"application_key"` // 记录中应用 ID 的键，默认 application_id，缺失时使用 tag
+	MessageKey     string `json:"message_key"`     // 原始日志行的键，默认 log
+}
+
+var (
+	forwardRecords  = metrics.counter("forward_records_total", "Log entries received over the Fluent forward protocol.")
+	forwardRejected = metrics.counter("forward_rejected_total", "Fluent forward records that could not be ingested.")
+)
+
+// 记录中结构化日志使用的键，与 HTTP 上传的 JSON 字段一致
+var forwardEntryKeys = []string{"application_id", "log_level", "timestamp", "log_message", "logger", "thread", "xid", "branch_id", "trace_id", "span_id"}
+
+// forward 协议监听器
+type forwardServer struct {
+	svc      *Service
+	config   ForwardConfig
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+
+	wg sync.WaitGroup
+}
+
+// 启动 forward 监听，未配置 listen 时返回 nil
+func (s *Service) startForwardServer(c ForwardConfig, tlsConfig *tls.Config) (*forwardServer, error) {
+	if c.Listen == "" {
+		return nil, nil
+	}
+	if c.ApplicationKey == "" {
+		c.ApplicationKey = "application_id"
+	}
+	if c.MessageKey == "" {
+		c.MessageKey = "log"
+	}
+	ln, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return nil, err
+	}
+	if c.TLS {
+		if tlsConfig == nil {
+			ln.Close()
+			return nil, errors.New("forward tls requires the tls section to be configured")
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	srv := &forwardServer{svc: s, config: c, listener: ln, conns: make(map[net.Conn]bool)}
+	srv.wg.Add(1)
+	go srv.acceptLoop()
+	log.Printf("Fluent forward input listening on %s", c.Listen)
+	return srv, nil
+}
+
+func (s *forwardServer) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("forward accept failed: %v", err)
+			}
+			return
+		}
+		if !s.svc.netPolicy.AllowsAddr(permWrite, conn.RemoteAddr().String()) {
+			networkDenied.Add(1, "class", networkClasses[permWrite])
+			conn.Close()
+			continue
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// 停止监听并断开已有连接，客户端会在重连后重发未确认的数据
+func (s *forwardServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// 处理一个连接上的连续消息
+func (s *forwardServer) serve(conn net.Conn) {
+	dec := newMsgpackDecoder(bufio.NewReader(conn))
+	for {
+		msg, err := dec.Decode()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("forward connection %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		chunk, err := s.handleMessage(msg, addrHost(conn.RemoteAddr().String()))
+		if err != nil {
+			log.Printf("forward connection %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		// 客户端要求确认时，写入完成后返回 chunk
+		if chunk != "" {
+			if _, err := conn.Write(encodeMsgpackStringMap(map[string]string{"ack": chunk})); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// 处理一条 forward 消息，支持 Message、Forward、PackedForward 和 CompressedPackedForward 模式，
+// 返回需要确认的 chunk。source 为发送方的地址
+func (s *forwardServer) handleMessage(msg interface{}, source string) (string, error) {
+	arr, ok := msg.([]interface{})
+	if !ok || len(arr) < 2 {
+		return "", errors.New("forward message must be an array of tag and entries")
+	}
+	tag := msgpackString(arr[0])
+
+	var option map[string]interface{}
+	var events [][2]interface{}
+	switch entries := arr[1].(type) {
+	case []interface{}:
+		// Forward 模式：[tag, [[time, record], ...], option]
+		for _, e := range entries {
+			pair, ok := e.([]interface{})
+			if !ok || len(pair) < 2 {
+				return "", errors.New("forward entry must be [time, record]")
+			}
+			events = append(events, [2]interface{}{pair[0], pair[1]})
+		}
+		if len(arr) > 2 {
+			option, _ = arr[2].(map[string]interface{})
+		}
+	case []byte, string:
+		// PackedForward 模式：entries 是连续编码的 [time, record]，可能经过 gzip 压缩
+		if len(arr) > 2 {
+			option, _ = arr[2].(map[string]interface{})
+		}
+		packed := []byte(msgpackString(entries))
+		var r io.Reader = bytes.NewReader(packed)
+		if msgpackString(option["compressed"]) == "gzip" {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return "", err
+			}
+			defer zr.Close()
+			r = zr
+		}
+		inner := newMsgpackDecoder(r)
+		for {
+			e, err := inner.Decode()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return "", fmt.Errorf("packed entries: %w", err)
+			}
+			pair, ok := e.([]interface{})
+			if !ok || len(pair) < 2 {
+				return "", errors.New("forward entry must be [time, record]")
+			}
+			events = append(events, [2]interface{}{pair[0], pair[1]})
+		}
+	default:
+		// Message 模式：[tag, time, record, option]
+		if len(arr) < 3 {
+			return "", errors.New("forward message must be [tag, time, record]")
+		}
+		events = append(events, [2]interface{}{arr[1], arr[2]})
+		if len(arr) > 3 {
+			option, _ = arr[3].(map[string]interface{})
+		}
+	}
+
+	var batch []LogData
+	for _, ev := range events {
+		record, ok := ev[1].(map[string]interface{})
+		if !ok {
+			forwardRejected.Add(1)
+			continue
+		}
+		batch = s.appendRecord(batch, tag, forwardEventTime(ev[0]), record)
+	}
+	for _, entry := range batch {
+		entry.Source = source
+		_, err := s.svc.ingestEntry(entry)
+		if errors.Is(err, errDroppedEntry) {
+			continue
+		}
+		if err != nil && !errors.Is(err, errDuplicateEntry) {
+			forwardRejected.Add(1)
+			log.Printf("forward ingest failed: app=%s err=%v", entry.ApplicationID, err)
+			continue
+		}
+		forwardRecords.Add(1)
+	}
+	return msgpackString(option["chunk"]), nil
+}
+
+// EventTime 扩展类型（秒和纳秒各 4 字节），或整数、浮点秒数
+func forwardEventTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case msgpackExt:
+		if t.Type == 0 && len(t.Data) == 8 {
+			return time.Unix(int64(binary.BigEndian.Uint32(t.Data[:4])), int64(binary.BigEndian.Uint32(t.Data[4:])))
+		}
+	case int64:
+		return time.Unix(t, 0)
+	case uint64:
+		return time.Unix(int64(t), 0)
+	case float64:
+		sec := int64(t)
+		return time.Unix(sec, int64((t-float64(sec))*1e9))
+	}
+	return time.Now()
+}
+
+// 将一条 forward 记录转换为日志条目追加到 batch。带有 log_level 和 log_message 的记录按结构化日志处理；
+// 否则把 message_key 的值当作原始日志行解析，同一消息中相邻的堆栈延续行合并到上一条日志
+func (s *forwardServer) appendRecord(batch []LogData, tag string, at time.Time, record map[string]interface{}) []LogData {
+	app := msgpackString(record[s.config.ApplicationKey])
+	if app == "" {
+		app = tag
+	}
+	if !validApplicationID(app) {
+		forwardRejected.Add(1)
+		return batch
+	}
+
+	consumed := map[string]bool{s.config.ApplicationKey: true}
+	var entry LogData
+	if _, ok := record["log_message"]; ok && record["log_level"] != nil {
+		values := make(map[string]string)
+		for _, k := range forwardEntryKeys {
+			values[k] = msgpackString(record[k])
+			consumed[k] = true
+		}
+		entry = LogData{
+			LogLevel:   strings.ToUpper(values["log_level"]),
+			Timestamp:  values["timestamp"],
+			LogMessage: values["log_message"],
+			Logger:     values["logger"],
+			Thread:     values["thread"],
+			XID:        values["xid"],
+			BranchID:   values["branch_id"],
+			TraceID:    values["trace_id"],
+			SpanID:     values["span_id"],
+		}
+		if entry.Timestamp == "" {
+			entry.Timestamp = at.Format(time.RFC3339Nano)
+		}
+	} else {
+		line := strings.TrimRight(msgpackString(record[s.config.MessageKey]), "\r\n")
+		consumed[s.config.MessageKey] = true
+		if strings.TrimSpace(line) == "" {
+			return batch
+		}
+		if n := len(batch); n > 0 && batch[n-1].ApplicationID == app && parser.IsContinuation(line) {
+			batch[n-1].LogMessage += "\n" + line
+			return batch
+		}
+		entry = s.svc.parseRawLine(app, line, at)
+	}
+	entry.ApplicationID = app
+
+	// 其余标量值作为自定义字段
+	for _, k := range sortedKeys(record) {
+		if consumed[k] || len(entry.Fields) >= 64 {
+			continue
+		}
+		switch record[k].(type) {
+		case map[string]interface{}, []interface{}, nil:
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[k] = msgpackString(record[k])
+	}
+	return append(batch, entry)
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/parser"
+)
+
+// 全局事务依赖图中的节点类型
+const (
+	graphNodeService  = "service"
+	graphNodeResource = "resource"
+)
+
+// 依赖图的节点：参与事务的服务或分支操作的资源
+type graphNode struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"` // service 或 resource
+	Label     string `json:"label"`
+	Initiator bool   `json:"initiator,omitempty"` // 开启全局事务的服务
+}
+
+// 依赖图的边：一个分支，从所属服务指向其资源
+type graphEdge struct {
+	From         string     `json:"from"`
+	To           string     `json:"to"`
+	BranchID     string     `json:"branch_id"`
+	Mode         string     `json:"mode,omitempty"`
+	Status       string     `json:"status"`
+	RegisteredAt *time.Time `json:"registered_at,omitempty"` // 没有看到注册日志时为空
+	Events       int        `json:"events"`                  // 该分支相关的日志条数
+}
+
+// 全局事务依赖图
+type transactionGraph struct {
+	XID   string      `json:"xid"`
+	Mode  string      `json:"mode,omitempty"`
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+func graphNodeID(kind, name string) string {
+	return kind + ":" + name
+}
+
+// 按时间线中的日志构建依赖图：每个出现过的 branch_id 是一条边，服务优先取消息中的 Seata applicationId，
+// 否则为写入日志的应用；资源未知的分支指向 resource:（标签为 unknown）
+func buildTransactionGraph(t TransactionTimeline) transactionGraph {
+	g := transactionGraph{XID: t.XID, Nodes: []graphNode{}, Edges: []graphEdge{}}
+	nodes := make(map[string]*graphNode)
+	addNode := func(kind, name string) *graphNode {
+		id := graphNodeID(kind, name)
+		n, ok := nodes[id]
+		if !ok {
+			label := name
+			if label == "" {
+				label = "unknown"
+			}
+			n = &graphNode{ID: id, Kind: kind, Label: label}
+			nodes[id] = n
+		}
+		return n
+	}
+	edges := make(map[string]*graphEdge)
+	var order []string
+
+	for _, ev := range t.Events {
+		entry := ev.Entry
+		fields := parser.SeataFields(entry.LogMessage)
+		service := analysis.EntryService(entry)
+		mode := parser.EntryMode(entry)
+		if g.Mode == "" {
+			g.Mode = mode
+		}
+		if analysis.ClassifyEvent(entry.LogMessage) == analysis.EventBegin {
+			addNode(graphNodeService, service).Initiator = true
+			continue
+		}
+
+		branchID := entry.BranchID
+		if branchID == "" {
+			branchID = fields["branch_id"]
+		}
+		if branchID == "" {
+			// 不属于具体分支的日志只说明该服务参与了事务
+			addNode(graphNodeService, service)
+			continue
+		}
+		registration := parser.BranchRegisterPattern.MatchString(entry.LogMessage)
+		e, ok := edges[branchID]
+		if !ok {
+			e = &graphEdge{BranchID: branchID, Status: analysis.BranchRegistered, From: service}
+			edges[branchID] = e
+			order = append(order, branchID)
+		}
+		e.Events++
+		// 注册日志确定分支所属的服务
+		if registration {
+			if e.RegisteredAt == nil {
+				at := ev.At
+				e.RegisteredAt = &at
+			}
+			e.From = service
+		}
+		if resource := fields["resource_id"]; resource != "" && e.To == "" {
+			e.To = resource
+		}
+		if e.Mode == "" {
+			e.Mode = mode
+		}
+		if status := analysis.BranchEventStatus(entry.LogMessage); status != "" {
+			e.Status = status
+		}
+	}
+
+	for _, id := range order {
+		e := edges[id]
+		addNode(graphNodeService, e.From)
+		addNode(graphNodeResource, e.To)
+		e.From = graphNodeID(graphNodeService, e.From)
+		e.To = graphNodeID(graphNodeResource, e.To)
+		g.Edges = append(g.Edges, *e)
+	}
+	for _, id := range sortedKeys(nodes) {
+		g.Nodes = append(g.Nodes, *nodes[id])
+	}
+	sort.SliceStable(g.Nodes, func(i, j int) bool { return g.Nodes[i].Kind == graphNodeService && g.Nodes[j].Kind != graphNodeService })
+	return g
+}
+
+// DOT 中的字符串字面量
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// 以 Graphviz DOT 格式输出，服务为方框、资源为圆柱，失败的分支标红
+func (g transactionGraph) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n\trankdir=LR;\n", dotQuote(g.XID))
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Kind == graphNodeResource {
+			shape = "cylinder"
+		}
+		style := ""
+		if n.Initiator {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=%s%s];\n", dotQuote(n.ID), dotQuote(n.Label), shape, style)
+	}
+	for _, e := range g.Edges {
+		label := "branch " + e.BranchID
+		if e.Mode != "" {
+			label += " (" + e.Mode + ")"
+		}
+		label += "\n" + e.Status
+		color := ""
+		if e.Status == analysis.BranchCommitFailed || e.Status == analysis.BranchRollbackFailed {
+			color = ", color=red"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s%s];\n", dotQuote(e.From), dotQuote(e.To), dotQuote(label), color)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// 事务依赖图接口：参与全局事务的服务和资源为节点，分支为边，format=dot 时输出 Graphviz DOT
+func (s *Service) transactionGraphHandler(c *gin.Context) {
+	xid := c.Param("xid")
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "dot" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+
+	t, err := s.buildTimeline(c.Request.Context(), xid, apps)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	if len(t.Events) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	g := buildTransactionGraph(t)
+	auditCount(c, len(g.Edges))
+	if format == "dot" {
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(g.DOT()))
+		return
+	}
+	c.JSON(http.StatusOK, g)
+}
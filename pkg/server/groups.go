@@ -0,0 +1,276 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 应用分组：一个 Seata 全局事务跨越多个应用，运维按系统（如 payments）和环境（prod、staging）考虑问题。
+// 分组把应用 ID 或通配模式按环境归入一个系统，查询、统计和告警规则中以 @系统 或 @系统:环境 引用，
+// 分组修改后立即对引用它的查询和规则生效
+type AppGroup struct {
+	Name         string              `json:"name" binding:"required"`
+	Description  string              `json:"description"`
+	Environments map[string][]string `json:"environments" binding:"required"` // 环境名到应用 ID 或通配模式（如 order-*）
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+// 引用分组的前缀和环境分隔符
+const (
+	groupRefPrefix    = "@"
+	groupEnvSeparator = ":"
+)
+
+// 已登记的应用分组
+type groupRegistry struct {
+	mu     sync.RWMutex
+	groups map[string]*AppGroup
+	path   string
+}
+
+func newGroupRegistry(dataDir string) (*groupRegistry, error) {
+	r := &groupRegistry{groups: make(map[string]*AppGroup), path: filepath.Join(dataDir, "groups.json")}
+	if err := loadJSONFile(r.path, &r.groups); err != nil {
+		return nil, err
+	}
+	for name, g := range r.groups {
+		if err := g.validate(); err != nil {
+			return nil, fmt.Errorf("group %s: %v", name, err)
+		}
+	}
+	return r, nil
+}
+
+// 系统名和环境名不能包含引用语法中的字符
+func validGroupName(name string) bool {
+	return validApplicationID(name) && !strings.ContainsAny(name, groupRefPrefix+groupEnvSeparator+",*?[")
+}
+
+func (g *AppGroup) validate() error {
+	if !validGroupName(g.Name) {
+		return fmt.Errorf("invalid group name %q", g.Name)
+	}
+	if len(g.Environments) == 0 {
+		return fmt.Errorf("at least one environment is required")
+	}
+	for env, apps := range g.Environments {
+		if !validGroupName(env) {
+			return fmt.Errorf("invalid environment name %q", env)
+		}
+		if len(apps) == 0 {
+			return fmt.Errorf("environment %s has no applications", env)
+		}
+		for _, app := range apps {
+			if _, err := path.Match(app, ""); err != nil || !validApplicationID(app) {
+				return fmt.Errorf("invalid application %q in environment %s", app, env)
+			}
+		}
+	}
+	return nil
+}
+
+// 是否为分组引用，如 @payments、@payments:prod
+func isGroupReference(value string) bool {
+	return strings.HasPrefix(value, groupRefPrefix)
+}
+
+// 拆分分组引用，环境为空时为全部环境
+func parseGroupReference(ref string) (name, env string, ok bool) {
+	name, env, _ = strings.Cut(strings.TrimPrefix(ref, groupRefPrefix), groupEnvSeparator)
+	if !isGroupReference(ref) || !validGroupName(name) || (env != "" && !validGroupName(env)) {
+		return "", "", false
+	}
+	return name, env, true
+}
+
+// 登记或替换分组
+func (r *groupRegistry) Put(g *AppGroup) error {
+	if err := g.validate(); err != nil {
+		return err
+	}
+	g.UpdatedAt = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups[g.Name] = g
+	return saveJSONFile(r.path, r.groups)
+}
+
+// 删除分组，引用它的查询返回 404，告警规则不再匹配任何日志
+func (r *groupRegistry) Delete(name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.groups[name]; !ok {
+		return false, nil
+	}
+	delete(r.groups, name)
+	return true, saveJSONFile(r.path, r.groups)
+}
+
+func (r *groupRegistry) List() []AppGroup {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]AppGroup, 0, len(r.groups))
+	for _, g := range r.groups {
+		list = append(list, *g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// 引用涉及的环境及其应用模式，分组或环境不存在时返回错误
+func (r *groupRegistry) Resolve(ref string) (map[string][]string, error) {
+	name, env, ok := parseGroupReference(ref)
+	if !ok {
+		return nil, fmt.Errorf("invalid group reference %q", ref)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g, ok := r.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("group not found: %s", name)
+	}
+	if env == "" {
+		return g.Environments, nil
+	}
+	apps, ok := g.Environments[env]
+	if !ok {
+		return nil, fmt.Errorf("environment %s not found in group %s", env, name)
+	}
+	return map[string][]string{env: apps}, nil
+}
+
+// 应用是否属于引用的分组，按去掉租户前缀的应用 ID 匹配
+func (r *groupRegistry) Match(ref, applicationID string) bool {
+	envs, err := r.Resolve(ref)
+	if err != nil {
+		return false
+	}
+	for _, patterns := range envs {
+		if matchApplicationPatterns(patterns, applicationID) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchApplicationPatterns(patterns []string, applicationID string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, model.BareApplicationID(applicationID)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 展开分组引用：从 candidates 中选出属于分组的应用，分组或环境不存在时返回 404
+func (s *Service) groupApplications(c *gin.Context, ref string, candidates []string) ([]string, bool) {
+	envs, err := s.groups.Resolve(ref)
+	if err != nil {
+		if _, _, ok := parseGroupReference(ref); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group reference"})
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found: " + strings.TrimPrefix(ref, groupRefPrefix)})
+		}
+		return nil, false
+	}
+	var apps []string
+	for _, app := range candidates {
+		for _, patterns := range envs {
+			if matchApplicationPatterns(patterns, app) {
+				apps = append(apps, app)
+				break
+			}
+		}
+	}
+	return apps, true
+}
+
+// 分组一个环境的汇总统计
+type groupStats struct {
+	Group        string         `json:"group"`
+	Environment  string         `json:"environment"`
+	Applications []string       `json:"applications"`
+	Total        int            `json:"total"`
+	Levels       map[string]int `json:"levels"`
+	FirstSeen    *time.Time     `json:"first_seen,omitempty"`
+	LastSeen     *time.Time     `json:"last_seen,omitempty"`
+}
+
+// 按环境汇总 application_id 中引用的分组，没有引用分组时返回 nil
+func (s *Service) collectGroupStats(value string, stats []applicationStats) []groupStats {
+	var list []groupStats
+	for _, ref := range splitList(value) {
+		if !isGroupReference(ref) {
+			continue
+		}
+		name, _, _ := parseGroupReference(ref)
+		envs, err := s.groups.Resolve(ref)
+		if err != nil {
+			continue
+		}
+		for _, env := range sortedKeys(envs) {
+			gs := groupStats{Group: name, Environment: env, Applications: []string{}, Levels: make(map[string]int)}
+			for _, st := range stats {
+				if !matchApplicationPatterns(envs[env], st.ApplicationID) {
+					continue
+				}
+				gs.Applications = append(gs.Applications, st.ApplicationID)
+				gs.Total += st.Total
+				for level, n := range st.Levels {
+					gs.Levels[level] += n
+				}
+				if st.FirstSeen != nil && (gs.FirstSeen == nil || st.FirstSeen.Before(*gs.FirstSeen)) {
+					gs.FirstSeen = st.FirstSeen
+				}
+				if st.LastSeen != nil && (gs.LastSeen == nil || st.LastSeen.After(*gs.LastSeen)) {
+					gs.LastSeen = st.LastSeen
+				}
+			}
+			list = append(list, gs)
+		}
+	}
+	return list
+}
+
+// 分组列表接口
+func (s *Service) groupListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"groups": s.groups.List()})
+}
+
+// 登记或替换分组接口
+func (s *Service) groupPutHandler(c *gin.Context) {
+	var g AppGroup
+	if err := c.ShouldBindJSON(&g); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if err := s.groups.Put(&g); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Group saved", "group": g})
+}
+
+// 删除分组接口
+func (s *Service) groupDeleteHandler(c *gin.Context) {
+	ok, err := s.groups.Delete(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save groups"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
@@ -0,0 +1,836 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"logAnalysis/pkg/model"
+)
+
+// gRPC 接口：与 REST 接口并行提供 Upload、UploadStream 和 Query，以及主备复制使用的 Replicate，定义见 proto/log_service.proto。
+// 直接在 HTTP/2 上实现 gRPC 的消息分帧，消息用 protowire 编解码
+type GRPCConfig struct {
+	Listen string `json:"listen"` // 监听地址，如 :9090，为空时不启用
+	TLS    bool   `json:"tls"`    // 使用 tls 配置中的证书（及客户端证书校验），否则为明文 HTTP/2
+}
+
+// 服务的方法路径前缀
+const grpcServicePath = "/loganalysis.v1.LogService/"
+
+// 单条消息的最大字节数，与 gRPC 客户端默认的接收上限一致
+const maxGRPCMessageBytes = 4 << 20
+
+// gRPC 状态码
+const (
+	grpcOK                 = 0
+	grpcCanceled           = 1
+	grpcInvalidArgument    = 3
+	grpcDeadlineExceeded   = 4
+	grpcNotFound           = 5
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// 审计记录中与状态码对应的 HTTP 状态
+var grpcHTTPStatus = map[int]int{
+	grpcOK:                 http.StatusOK,
+	grpcCanceled:           499, // 客户端关闭请求，沿用 nginx 的约定
+	grpcInvalidArgument:    http.StatusBadRequest,
+	grpcDeadlineExceeded:   http.StatusGatewayTimeout,
+	grpcNotFound:           http.StatusNotFound,
+	grpcPermissionDenied:   http.StatusForbidden,
+	grpcResourceExhausted:  http.StatusTooManyRequests,
+	grpcFailedPrecondition: http.StatusConflict,
+	grpcUnimplemented:      http.StatusNotImplemented,
+	grpcInternal:           http.StatusInternalServerError,
+	grpcUnavailable:        http.StatusServiceUnavailable,
+	grpcUnauthenticated:    http.StatusUnauthorized,
+}
+
+var grpcRequests = metrics.counter("grpc_requests_total", "gRPC calls, by method and status code.")
+
+// 带状态码的 gRPC 错误
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string { return e.message }
+
+func grpcErrorf(code int, format string, args ...interface{}) error {
+	return &grpcError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// gRPC 监听器
+type grpcServer struct {
+	svc      *Service
+	listener net.Listener
+	h2       *http2.Server
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+
+	wg sync.WaitGroup
+}
+
+// 启动 gRPC 监听，未配置 listen 时返回 nil
+func (s *Service) startGRPCServer(c GRPCConfig, tlsConfig *tls.Config) (*grpcServer, error) {
+	if c.Listen == "" {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return nil, err
+	}
+	if c.TLS {
+		if tlsConfig == nil {
+			ln.Close()
+			return nil, errors.New("grpc tls requires the tls section to be configured")
+		}
+		config := tlsConfig.Clone()
+		config.NextProtos = []string{http2.NextProtoTLS}
+		ln = tls.NewListener(ln, config)
+	}
+
+	srv := &grpcServer{svc: s, listener: ln, h2: &http2.Server{}, conns: make(map[net.Conn]bool)}
+	srv.wg.Add(1)
+	go srv.acceptLoop()
+	log.Printf("gRPC service listening on %s", c.Listen)
+	return srv, nil
+}
+
+func (s *grpcServer) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("grpc accept failed: %v", err)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// 停止监听并断开已有连接，进行中的调用会以 Unavailable 失败，由客户端重试
+func (s *grpcServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// 在一个连接上处理 HTTP/2 请求。gRPC 客户端在明文连接上直接发送 HTTP/2 前言，不经过 Upgrade
+func (s *grpcServer) serve(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := tc.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("grpc connection %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+	s.h2.ServeConn(conn, &http2.ServeConnOpts{Handler: http.HandlerFunc(s.handle)})
+}
+
+// 一次 gRPC 调用
+type grpcCall struct {
+	svc     *Service
+	w       http.ResponseWriter
+	r       *http.Request
+	tenant  string
+	user    *User             // 启用访问控制时按 API Key 识别的用户
+	perm    string            // 调用所需的权限
+	trailer map[string]string // 附加的尾部元数据
+	count   int               // 写入或返回的日志条数，用于审计
+}
+
+// 分派 gRPC 调用，结束时写出状态尾部并记录指标和审计
+func (s *grpcServer) handle(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	contentType := r.Header.Get("Content-Type")
+	if r.Method != http.MethodPost || (contentType != "application/grpc" && contentType != "application/grpc+proto") {
+		http.Error(w, "Only gRPC requests are accepted", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Accept-Encoding", "gzip")
+	w.WriteHeader(http.StatusOK)
+
+	call := &grpcCall{svc: s.svc, w: w, r: r, trailer: make(map[string]string)}
+	method := strings.TrimPrefix(r.URL.Path, grpcServicePath)
+	call.perm = permRead
+	if strings.HasPrefix(method, "Upload") {
+		call.perm = permWrite
+	}
+	if method == "Replicate" {
+		call.perm = permAdmin
+	}
+	err := call.authorize()
+	if err == nil && !s.svc.netPolicy.AllowsAddr(call.perm, r.RemoteAddr) {
+		networkDenied.Add(1, "class", networkClasses[call.perm])
+		err = grpcErrorf(grpcPermissionDenied, "Access from this network is not allowed")
+	}
+	if err == nil {
+		switch method {
+		case "Upload":
+			err = call.upload(false)
+		case "UploadStream":
+			err = call.upload(true)
+		case "Query":
+			err = call.query()
+		case "Replicate":
+			err = call.replicate()
+		default:
+			method = "unknown"
+			err = grpcErrorf(grpcUnimplemented, "Unknown method %s", r.URL.Path)
+		}
+	}
+	code := call.finish(err)
+	grpcRequests.Add(1, "method", method, "code", strconv.Itoa(code))
+
+	if s.svc.audit == nil {
+		return
+	}
+	rec := AuditRecord{
+		Time:       start,
+		Method:     r.Method,
+		Route:      r.URL.Path,
+		Path:       r.URL.Path,
+		Tenant:     call.tenant,
+		User:       userName(call.user),
+		APIKey:     apiKeyFingerprint(r.Header),
+		ClientCert: clientCertSubject(r),
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		Status:     grpcHTTPStatus[code],
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		rec.RemoteAddr = host
+	}
+	if code == grpcOK {
+		rec.Count = &call.count
+	}
+	s.svc.audit.Record(rec)
+}
+
+// 写出状态尾部，返回状态码
+func (c *grpcCall) finish(err error) int {
+	code, message := grpcOK, ""
+	var ge *grpcError
+	if errors.As(err, &ge) {
+		code, message = ge.code, ge.message
+	} else if err != nil {
+		// 写出响应失败，通常是客户端已取消
+		code, message = grpcUnavailable, err.Error()
+	}
+	h := c.w.Header()
+	for k, v := range c.trailer {
+		h.Set(http.TrailerPrefix+k, v)
+	}
+	h.Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		h.Set(http.TrailerPrefix+"Grpc-Message", grpcEncodeMessage(message))
+	}
+	return code
+}
+
+// grpc-message 中 ASCII 可打印字符以外的字节和 % 需要百分号编码
+func grpcEncodeMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		ch := message[i]
+		if ch < 0x20 || ch > 0x7e || ch == '%' {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		} else {
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// 校验元数据中的租户和 API Key，未指定租户时访问默认存储。
+// 启用访问控制时与 REST 接口一致：先按用户校验，租户应用上没有匹配的用户时按租户的 API Key 校验
+func (c *grpcCall) authorize() error {
+	tenant := c.r.Header.Get("X-Tenant")
+	if c.svc.users.enabled {
+		c.user = c.svc.users.Authenticate(requestAPIKey(c.r.Header))
+		if c.user == nil && tenant == "" {
+			rbacDenied.Add(1, "reason", "unauthenticated")
+			return grpcErrorf(grpcUnauthenticated, "Invalid API key")
+		}
+		if c.user != nil && !c.user.AllowedSomewhere(c.perm) {
+			rbacDenied.Add(1, "reason", "role")
+			return grpcErrorf(grpcPermissionDenied, "Permission denied")
+		}
+	}
+	if tenant == "" {
+		return nil
+	}
+	if _, ok := c.svc.tenants.configs[tenant]; !ok {
+		return grpcErrorf(grpcNotFound, "Tenant not found")
+	}
+	if c.user == nil && (!c.svc.tenants.Authorized(tenant, c.r.Header) || (c.svc.users.enabled && len(c.svc.tenants.configs[tenant].APIKeys) == 0)) {
+		return grpcErrorf(grpcUnauthenticated, "Invalid API key")
+	}
+	c.tenant = tenant
+	return nil
+}
+
+// 请求中的应用 ID 转换为存储使用的 ID，与 scopedApplicationID 一致
+func (c *grpcCall) scopedApplicationID(applicationID string) (string, error) {
+	if !validApplicationID(applicationID) {
+		return "", grpcErrorf(grpcInvalidArgument, "Invalid application_id")
+	}
+	if c.tenant != "" {
+		applicationID = c.tenant + model.TenantSeparator + applicationID
+	}
+	if c.user != nil && !c.user.Allowed(c.perm, applicationID) {
+		rbacDenied.Add(1, "reason", "application")
+		return "", grpcErrorf(grpcPermissionDenied, "Permission denied for application %s", model.BareApplicationID(applicationID))
+	}
+	return applicationID, nil
+}
+
+// 读取一条长度前缀的消息，请求流结束时返回 io.EOF
+func (c *grpcCall) recv() ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r.Body, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, grpcErrorf(grpcInvalidArgument, "Unable to read message: %v", err)
+	}
+	limit := c.maxMessageBytes()
+	n := binary.BigEndian.Uint32(header[1:])
+	if int64(n) > limit {
+		return nil, c.messageTooLarge(limit)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r.Body, data); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "Unable to read message: %v", err)
+	}
+	if header[0] == 0 {
+		return data, nil
+	}
+
+	// 压缩的消息
+	if encoding := c.r.Header.Get("Grpc-Encoding"); encoding != "gzip" {
+		return nil, grpcErrorf(grpcUnimplemented, "Unsupported message encoding %q", encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "Invalid gzip message")
+	}
+	defer zr.Close()
+	data, err = io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "Invalid gzip message")
+	}
+	if int64(len(data)) > limit {
+		return nil, c.messageTooLarge(limit)
+	}
+	return data, nil
+}
+
+// 单条消息（解压后）的最大字节数。上传的消息同时受 upload_limits.max_body_mb 限制，与 REST 上传一致
+func (c *grpcCall) maxMessageBytes() int64 {
+	limit := int64(maxGRPCMessageBytes)
+	if c.perm == permWrite {
+		limit = min(limit, c.svc.uploadLimits.maxBodyBytes())
+	}
+	return limit
+}
+
+func (c *grpcCall) messageTooLarge(limit int64) error {
+	if c.perm == permWrite {
+		uploadLimitRejected.Add(1, "limit", "body")
+	}
+	return grpcErrorf(grpcResourceExhausted, "Message larger than %d bytes", limit)
+}
+
+// 写出一条不压缩的消息
+func (c *grpcCall) send(data []byte) error {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	if _, err := c.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := c.w.Write(data)
+	return err
+}
+
+// 写入结果，对应 UploadResponse
+type grpcUploadResult struct {
+	accepted, duplicates, dropped int
+	ids                           []int64 // 逐条分配的日志 ID，重复和被丢弃的为 0
+}
+
+// Upload 和 UploadStream：逐条校验并写入，失败时已写入的日志不回滚，
+// 尾部元数据 x-accepted 给出失败前已处理的条数
+func (c *grpcCall) upload(stream bool) error {
+	if c.svc.draining.Load() {
+		return grpcErrorf(grpcUnavailable, "Server is shutting down")
+	}
+	var res grpcUploadResult
+	for i := 0; ; i++ {
+		data, err := c.recv()
+		if errors.Is(err, io.EOF) {
+			if i == 0 && !stream {
+				return grpcErrorf(grpcInvalidArgument, "Missing request message")
+			}
+			break
+		}
+		if err == nil {
+			err = c.ingest(data, i, stream, &res)
+		}
+		if err != nil {
+			c.trailer["X-Accepted"] = strconv.Itoa(res.accepted)
+			return err
+		}
+		if !stream {
+			break
+		}
+	}
+
+	c.count = res.accepted - res.duplicates - res.dropped
+	return c.send(encodeUploadResponse(res))
+}
+
+// 上传签名：Upload 在元数据 x-signature、x-signature-timestamp 中对请求消息（解压后的 LogEntry 字节）签名，
+// 算法与 REST 上传相同。UploadStream 的一个签名覆盖不了逐条写入的消息，签名对消息的应用适用时拒绝
+func (c *grpcCall) verifySignature(applicationID string, data []byte, stream bool) error {
+	signer := c.svc.uploadSigning
+	if signer == nil {
+		return nil
+	}
+	secret, ok := signer.secrets[applicationID]
+	if !ok && !signer.required {
+		return nil
+	}
+	if stream {
+		uploadSignatureRejected.Add(1, "reason", "unsupported")
+		return grpcErrorf(grpcPermissionDenied, "Signed uploads are required for %s; use Upload", model.BareApplicationID(applicationID))
+	}
+	if !ok {
+		uploadSignatureRejected.Add(1, "reason", "no_secret")
+		return grpcErrorf(grpcPermissionDenied, "Signed uploads are required and no secret is configured for %s", model.BareApplicationID(applicationID))
+	}
+	if reason, message := signer.check(c.r.Header.Get(signatureHeader), c.r.Header.Get(signatureTimestampHeader), data, [][]byte{secret}); reason != "" {
+		uploadSignatureRejected.Add(1, "reason", reason)
+		return grpcErrorf(grpcUnauthenticated, "%s", message)
+	}
+	return nil
+}
+
+// 写入一条 LogEntry 消息
+func (c *grpcCall) ingest(data []byte, i int, stream bool, res *grpcUploadResult) error {
+	entry, err := decodeLogEntry(data)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "Entry %d is not a valid LogEntry", i)
+	}
+	if err := binding.Validator.ValidateStruct(&entry); err != nil {
+		return grpcErrorf(grpcInvalidArgument, "Entry %d is missing required fields", i)
+	}
+	var tooLong *fieldTooLongError
+	if errors.As(c.svc.uploadLimits.checkEntry(entry), &tooLong) {
+		uploadLimitRejected.Add(1, "limit", tooLong.Field)
+		return grpcErrorf(grpcInvalidArgument, "Entry %d: %s", i, tooLong.Error())
+	}
+	if entry.ApplicationID, err = c.scopedApplicationID(entry.ApplicationID); err != nil {
+		return err
+	}
+	if err := c.verifySignature(entry.ApplicationID, data, stream); err != nil {
+		return err
+	}
+	if err := c.svc.checkUploadTimestamp(&entry, time.Now()); err != nil {
+		return grpcErrorf(grpcInvalidArgument, "Entry %d has an invalid timestamp%s", i, timestampMismatch(err))
+	}
+	entry.Source = addrHost(c.r.RemoteAddr)
+
+	id, err := c.svc.tryIngestEntry(entry)
+	switch {
+	case errors.Is(err, errIngestQueueFull):
+		return grpcErrorf(grpcUnavailable, "Ingest queue is full, retry later")
+	case errors.Is(err, errDuplicateEntry):
+		res.duplicates++
+	case errors.Is(err, errDroppedEntry):
+		res.dropped++
+	case errors.Is(err, errInvalidTimestamp):
+		return grpcErrorf(grpcInvalidArgument, "Entry %d has an invalid timestamp", i)
+	case errors.Is(err, errSchemaViolation):
+		return grpcErrorf(grpcInvalidArgument, "Entry %d does not match the application schema: %s", i, schemaViolation(err))
+	case errors.Is(err, errTenantQuotaExceeded):
+		return grpcErrorf(grpcResourceExhausted, "Tenant daily quota exceeded")
+	case errors.Is(err, errDiskQuotaExceeded):
+		return grpcErrorf(grpcResourceExhausted, "Application disk quota exceeded")
+	case errors.Is(err, errApplicationReadOnly):
+		return grpcErrorf(grpcFailedPrecondition, "Application is archived or deleted and does not accept writes")
+	case errors.Is(err, errIngestPaused):
+		return grpcErrorf(grpcUnavailable, "Ingestion is paused for the application")
+	case err != nil:
+		return grpcErrorf(grpcInternal, "Unable to write log to file")
+	}
+	res.accepted++
+	res.ids = append(res.ids, id)
+	return nil
+}
+
+// Query：与 /query 相同的条件和排序，逐条返回脱敏后的日志。
+// 结果超过 max_response_bytes 时提前结束，尾部元数据 x-truncated 为 true
+func (c *grpcCall) query() error {
+	data, err := c.recv()
+	if errors.Is(err, io.EOF) {
+		return grpcErrorf(grpcInvalidArgument, "Missing request message")
+	}
+	if err != nil {
+		return err
+	}
+	req, err := decodeQueryRequest(data)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "Invalid QueryRequest")
+	}
+	if req.ApplicationID == "" || req.LogLevel == "" {
+		return grpcErrorf(grpcInvalidArgument, "application_id and log_level are required")
+	}
+	if req.Sort == "" {
+		req.Sort = sortDesc
+	}
+	if req.Sort != sortAsc && req.Sort != sortDesc {
+		return grpcErrorf(grpcInvalidArgument, "sort must be asc or desc")
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+	if max := c.svc.cfg.Query.maxLimit(); req.Limit > max {
+		req.Limit = max
+	}
+	storeID, err := c.scopedApplicationID(req.ApplicationID)
+	if err != nil {
+		return err
+	}
+	loc := time.Local
+	if req.TZ != "" {
+		if loc, err = time.LoadLocation(req.TZ); err != nil {
+			return grpcErrorf(grpcInvalidArgument, "Invalid tz")
+		}
+	}
+	// 与 REST 查询共用并发限制和截止时间，客户端取消调用时 context 随之取消
+	ctx, release, reason := c.svc.admitQuery(c.r.Context())
+	if reason != "" {
+		return grpcErrorf(grpcUnavailable, "Too many concurrent queries, retry later")
+	}
+	defer release()
+	q := logQuery{ApplicationID: storeID, LogLevel: req.LogLevel, Fields: req.Fields, SinceID: req.SinceID, MaxID: req.MaxID, ctx: ctx}
+	if req.From != "" {
+		if q.From, err = parseTimeParam(req.From, loc); err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+	}
+	if req.To != "" {
+		if q.To, err = parseTimeParam(req.To, loc); err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+	}
+
+	hits, err := c.svc.collectSorted(q, req.Sort, req.Limit, nil)
+	if err != nil {
+		return queryFailed(err)
+	}
+	if req.TZ != "" {
+		localizeTimestamps(hits, loc)
+	}
+	limit := c.svc.cfg.Query.maxResponseBytes()
+	var written int64
+	flusher, _ := c.w.(http.Flusher)
+	for i := range hits {
+		c.svc.maskQueryEntry(&hits[i].Entry)
+		msg := encodeLogEntry(hits[i].Entry)
+		if written+int64(len(msg)) > limit {
+			c.trailer["X-Truncated"] = "true"
+			queryTruncated.Add(1)
+			break
+		}
+		written += int64(len(msg))
+		hits[i] = QueryHit{}
+
+		if err := c.send(msg); err != nil {
+			return err
+		}
+		c.count++
+		if flusher != nil && c.count%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	return nil
+}
+
+// 读取日志失败时的状态，与 REST 的 /query 一致：应用没有日志目录时为 NotFound，超过查询截止时间为 DeadlineExceeded
+func queryFailed(err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return grpcErrorf(grpcNotFound, "Application not found")
+	case errors.Is(err, context.DeadlineExceeded):
+		queryTimeouts.Add(1)
+		return grpcErrorf(grpcDeadlineExceeded, "Query exceeded the time limit")
+	case errors.Is(err, context.Canceled):
+		return grpcErrorf(grpcCanceled, "Query canceled")
+	}
+	return grpcErrorf(grpcInternal, "Unable to read application logs")
+}
+
+// 查询请求，对应 QueryRequest
+type grpcQueryRequest struct {
+	ApplicationID, LogLevel, Sort string
+	Limit                         int
+	From, To, TZ                  string
+	SinceID, MaxID                int64
+	Fields                        map[string][]string
+}
+
+// 遍历消息中的字段，长度前缀编码的值通过 value 返回，varint 通过 number 返回，其他类型跳过
+func walkProtoFields(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, number uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		var number uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			number, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			number, n = protowire.ConsumeFixed64(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, typ, value, number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解码 map<string, string> 的一项
+func decodeMapEntry(data []byte) (string, string, error) {
+	var key, value string
+	err := walkProtoFields(data, func(num protowire.Number, typ protowire.Type, b []byte, _ uint64) error {
+		if typ == protowire.BytesType && num == 1 {
+			key = string(b)
+		} else if typ == protowire.BytesType && num == 2 {
+			value = string(b)
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+func decodeLogEntry(data []byte) (LogData, error) {
+	var entry LogData
+	err := walkProtoFields(data, func(num protowire.Number, typ protowire.Type, b []byte, number uint64) error {
+		if num == 13 && typ == protowire.Fixed64Type {
+			entry.SampleRate = math.Float64frombits(number)
+		}
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			entry.ApplicationID = string(b)
+		case 2:
+			entry.LogLevel = string(b)
+		case 3:
+			entry.Timestamp = string(b)
+		case 4:
+			entry.LogMessage = string(b)
+		case 5:
+			entry.Logger = string(b)
+		case 6:
+			entry.Thread = string(b)
+		case 7:
+			entry.XID = string(b)
+		case 8:
+			entry.BranchID = string(b)
+		case 9:
+			k, v, err := decodeMapEntry(b)
+			if err != nil {
+				return err
+			}
+			if entry.Fields == nil {
+				entry.Fields = make(map[string]string)
+			}
+			entry.Fields[k] = v
+		case 10:
+			entry.TraceID = string(b)
+		case 11:
+			entry.SpanID = string(b)
+		}
+		return nil
+	})
+	return entry, err
+}
+
+func encodeLogEntry(entry LogData) []byte {
+	var b []byte
+	for i, v := range []string{entry.ApplicationID, entry.LogLevel, entry.Timestamp, entry.LogMessage, entry.Logger, entry.Thread, entry.XID, entry.BranchID} {
+		if v != "" {
+			b = protowire.AppendTag(b, protowire.Number(i+1), protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	for i, v := range []string{entry.TraceID, entry.SpanID} {
+		if v != "" {
+			b = protowire.AppendTag(b, protowire.Number(i+10), protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	if entry.ID != 0 {
+		b = protowire.AppendTag(b, 12, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(entry.ID))
+	}
+	if entry.SampleRate != 0 {
+		b = protowire.AppendTag(b, 13, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(entry.SampleRate))
+	}
+	if entry.Seq != 0 {
+		b = protowire.AppendTag(b, 14, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(entry.Seq))
+	}
+	for _, k := range sortedKeys(entry.Fields) {
+		var kv []byte
+		kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+		kv = protowire.AppendString(kv, k)
+		kv = protowire.AppendTag(kv, 2, protowire.BytesType)
+		kv = protowire.AppendString(kv, entry.Fields[k])
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, kv)
+	}
+	return b
+}
+
+func encodeUploadResponse(res grpcUploadResult) []byte {
+	var b []byte
+	for i, v := range []int{res.accepted, res.duplicates, res.dropped} {
+		if v != 0 {
+			b = protowire.AppendTag(b, protowire.Number(i+1), protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		}
+	}
+	if len(res.ids) > 0 {
+		var packed []byte
+		for _, id := range res.ids {
+			packed = protowire.AppendVarint(packed, uint64(id))
+		}
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return b
+}
+
+func decodeQueryRequest(data []byte) (grpcQueryRequest, error) {
+	var req grpcQueryRequest
+	err := walkProtoFields(data, func(num protowire.Number, typ protowire.Type, b []byte, number uint64) error {
+		if typ == protowire.VarintType {
+			switch num {
+			case 4:
+				req.Limit = int(int32(number))
+			case 9:
+				req.SinceID = int64(number)
+			case 10:
+				req.MaxID = int64(number)
+			}
+			return nil
+		}
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			req.ApplicationID = string(b)
+		case 2:
+			req.LogLevel = string(b)
+		case 3:
+			req.Sort = string(b)
+		case 5:
+			req.From = string(b)
+		case 6:
+			req.To = string(b)
+		case 7:
+			req.TZ = string(b)
+		case 8:
+			// FieldFilter{key = 1, repeated values = 2}
+			var key string
+			var values []string
+			err := walkProtoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if typ == protowire.BytesType && num == 1 {
+					key = string(v)
+				} else if typ == protowire.BytesType && num == 2 {
+					values = append(values, string(v))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if key != "" && len(values) > 0 {
+				if req.Fields == nil {
+					req.Fields = make(map[string][]string)
+				}
+				req.Fields[key] = append(req.Fields[key], values...)
+			}
+		}
+		return nil
+	})
+	return req, err
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// 在随机端口上启动服务的 gRPC 接口，返回地址
+func startTestGRPC(t testing.TB, s *Service) string {
+	t.Helper()
+	srv, err := s.startGRPCServer(GRPCConfig{Listen: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv.listener.Addr().String()
+}
+
+// 一次 gRPC 调用的结果
+type grpcTestResponse struct {
+	messages [][]byte
+	status   int
+	message  string
+	trailer  http.Header
+}
+
+// 经 net/http 的 h2c 客户端发起一次 gRPC 调用，请求消息按长度前缀分帧依次发送
+func invokeGRPC(t testing.TB, addr, method string, header http.Header, messages ...[]byte) grpcTestResponse {
+	t.Helper()
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	defer client.CloseIdleConnections()
+
+	var body bytes.Buffer
+	for _, m := range messages {
+		body.Write(grpcFrame(m))
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+grpcServicePath+method, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := grpcTestResponse{trailer: resp.Trailer}
+	for len(data) > 0 {
+		if len(data) < 5 || data[0] != 0 {
+			t.Fatalf("malformed response frame % x", data)
+		}
+		n := int(binary.BigEndian.Uint32(data[1:5]))
+		if len(data) < 5+n {
+			t.Fatalf("response frame of %d bytes truncated to %d", n, len(data)-5)
+		}
+		res.messages = append(res.messages, data[5:5+n])
+		data = data[5+n:]
+	}
+	if res.status, err = strconv.Atoi(resp.Trailer.Get("Grpc-Status")); err != nil {
+		t.Fatalf("missing grpc-status trailer: %v", resp.Trailer)
+	}
+	res.message = resp.Trailer.Get("Grpc-Message")
+	return res
+}
+
+// 不压缩的长度前缀消息
+func grpcFrame(m []byte) []byte {
+	frame := make([]byte, 5, 5+len(m))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(m)))
+	return append(frame, m...)
+}
+
+func TestGRPCUploadRejectsOversizedFields(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	addr := startTestGRPC(t, s)
+	now := time.Now()
+
+	entry := testEntry("orders", "INFO", strings.Repeat("x", s.uploadLimits.MaxMessageBytes+1), now)
+	res := invokeGRPC(t, addr, "Upload", nil, encodeLogEntry(entry))
+	if res.status != grpcInvalidArgument || !strings.Contains(res.message, "log_message exceeds") {
+		t.Fatalf("oversized log_message: status %d %q, want InvalidArgument", res.status, res.message)
+	}
+	entry = testEntry("orders", strings.Repeat("L", s.uploadLimits.MaxLevelLength+1), "ok", now)
+	if res := invokeGRPC(t, addr, "Upload", nil, encodeLogEntry(entry)); res.status != grpcInvalidArgument {
+		t.Fatalf("oversized log_level: status %d %q, want InvalidArgument", res.status, res.message)
+	}
+
+	// 消息超过 max_body_mb 时在读取阶段拒绝
+	s.uploadLimits.MaxBodyMB = 1
+	s.uploadLimits.MaxMessageBytes = 2 << 20
+	entry = testEntry("orders", "INFO", strings.Repeat("x", 1<<20), now)
+	if res := invokeGRPC(t, addr, "Upload", nil, encodeLogEntry(entry)); res.status != grpcResourceExhausted {
+		t.Fatalf("message over max_body_mb: status %d %q, want ResourceExhausted", res.status, res.message)
+	}
+	if _, err := s.Query(context.Background(), Query{ApplicationIDs: []string{"orders"}}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("rejected entries created the application: %v", err)
+	}
+}
+
+// 按 proto/log_service.proto 手工编码的消息，与 protoc 生成的客户端发出的字节一致
+func TestGRPCMessageGoldenBytes(t *testing.T) {
+	got := encodeLogEntry(LogData{ApplicationID: "orders", LogLevel: "INFO", ID: 7})
+	want := []byte("\x0a\x06orders\x12\x04INFO\x60\x07")
+	if !bytes.Equal(got, want) {
+		t.Fatalf("LogEntry = % x, want % x", got, want)
+	}
+	got = encodeUploadResponse(grpcUploadResult{accepted: 2, ids: []int64{1, 2}})
+	want = []byte{0x08, 0x02, 0x22, 0x02, 0x01, 0x02}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("UploadResponse = % x, want % x", got, want)
+	}
+
+	req, err := decodeQueryRequest([]byte("\x0a\x06orders\x12\x04INFO\x1a\x03asc\x20\x05\x42\x0b\x0a\x03env\x12\x04prod\x48\x03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ApplicationID != "orders" || req.LogLevel != "INFO" || req.Sort != "asc" || req.Limit != 5 || req.SinceID != 3 ||
+		len(req.Fields["env"]) != 1 || req.Fields["env"][0] != "prod" {
+		t.Fatalf("QueryRequest = %+v", req)
+	}
+}
+
+func TestGRPCUploadAndQueryRoundTrip(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	addr := startTestGRPC(t, s)
+	now := time.Now()
+
+	first := testEntry("orders", "INFO", "order created", now)
+	first.Fields = map[string]string{"env": "prod"}
+	second := testEntry("orders", "INFO", "order paid", now.Add(time.Millisecond))
+	res := invokeGRPC(t, addr, "UploadStream", nil, encodeLogEntry(first), encodeLogEntry(second))
+	if res.status != grpcOK || len(res.messages) != 1 {
+		t.Fatalf("UploadStream: status %d %q, %d messages", res.status, res.message, len(res.messages))
+	}
+	if got, want := res.messages[0], encodeUploadResponse(grpcUploadResult{accepted: 2, ids: []int64{1, 2}}); !bytes.Equal(got, want) {
+		t.Fatalf("UploadResponse = % x, want % x", got, want)
+	}
+
+	query := []byte("\x0a\x06orders\x12\x04INFO\x1a\x03asc")
+	res = invokeGRPC(t, addr, "Query", nil, query)
+	if res.status != grpcOK || len(res.messages) != 2 {
+		t.Fatalf("Query: status %d %q, %d messages", res.status, res.message, len(res.messages))
+	}
+	for i, want := range []LogData{first, second} {
+		got, err := decodeLogEntry(res.messages[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.LogMessage != want.LogMessage || got.Fields["env"] != want.Fields["env"] {
+			t.Fatalf("entry %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestGRPCQueryErrorStatus(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	addr := startTestGRPC(t, s)
+	query := []byte("\x0a\x06orders\x12\x04INFO")
+
+	// 与 REST 的 /query 一致，没有日志的应用返回 NotFound
+	if res := invokeGRPC(t, addr, "Query", nil, query); res.status != grpcNotFound {
+		t.Fatalf("unknown application: status %d %q, want NotFound", res.status, res.message)
+	}
+
+	// 扫描每 cancelCheckLines 行检查一次截止时间
+	now := time.Now()
+	entries := make([]LogData, cancelCheckLines+1)
+	for i := range entries {
+		entries[i] = testEntry("orders", "INFO", fmt.Sprintf("order %d created", i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if _, err := s.Ingest(entries); err != nil {
+		t.Fatal(err)
+	}
+	s.queryLimits.timeout = time.Nanosecond
+	if res := invokeGRPC(t, addr, "Query", nil, query); res.status != grpcDeadlineExceeded {
+		t.Fatalf("expired deadline: status %d %q, want DeadlineExceeded", res.status, res.message)
+	}
+
+	// 槽位被占满且排队超时时拒绝，不绕过并发限制
+	s.queryLimits.timeout = 0
+	s.queryLimits.slots = make(chan struct{}, 1)
+	s.queryLimits.slots <- struct{}{}
+	s.queryLimits.queueTimeout = time.Millisecond
+	if res := invokeGRPC(t, addr, "Query", nil, query); res.status != grpcUnavailable {
+		t.Fatalf("no free query slot: status %d %q, want Unavailable", res.status, res.message)
+	}
+}
+
+func TestGRPCUploadRequiresSignature(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	signer, err := newUploadSigner(UploadSigningConfig{Secrets: map[string]string{"orders": "s3cret"}, Required: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.uploadSigning = signer
+	addr := startTestGRPC(t, s)
+	msg := encodeLogEntry(testEntry("orders", "INFO", "order placed", time.Now()))
+
+	if res := invokeGRPC(t, addr, "Upload", nil, msg); res.status != grpcUnauthenticated {
+		t.Fatalf("unsigned Upload: status %d %q, want Unauthenticated", res.status, res.message)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	forged := http.Header{"X-Signature": {signaturePrefix + uploadSignature([]byte("wrong"), timestamp, msg)}, "X-Signature-Timestamp": {timestamp}}
+	if res := invokeGRPC(t, addr, "Upload", forged, msg); res.status != grpcUnauthenticated {
+		t.Fatalf("Upload signed with the wrong secret: status %d %q, want Unauthenticated", res.status, res.message)
+	}
+	other := encodeLogEntry(testEntry("payments", "INFO", "payment captured", time.Now()))
+	if res := invokeGRPC(t, addr, "Upload", nil, other); res.status != grpcPermissionDenied {
+		t.Fatalf("Upload for an application without a secret: status %d %q, want PermissionDenied", res.status, res.message)
+	}
+	if res := invokeGRPC(t, addr, "UploadStream", nil, msg); res.status != grpcPermissionDenied {
+		t.Fatalf("unsigned UploadStream: status %d %q, want PermissionDenied", res.status, res.message)
+	}
+	if _, err := s.Query(context.Background(), Query{ApplicationIDs: []string{"orders"}}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("rejected uploads created the application: %v", err)
+	}
+
+	signed := http.Header{"X-Signature": {signaturePrefix + uploadSignature([]byte("s3cret"), timestamp, msg)}, "X-Signature-Timestamp": {timestamp}}
+	if res := invokeGRPC(t, addr, "Upload", signed, msg); res.status != grpcOK {
+		t.Fatalf("signed Upload: status %d %q, want OK", res.status, res.message)
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}}); len(got) != 1 {
+		t.Fatalf("signed Upload stored %q, want one entry", got)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/parser"
+)
+
+// 事务列表接口：按 TC 日志推断全局事务状态，可按 status 过滤，并单独列出疑似挂起的事务
+func (s *Service) transactionListHandler(c *gin.Context) {
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+
+	hangAfter := time.Duration(s.cfg.TransactionHangWindow)
+	if v := c.Query("hang_after"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hang_after"})
+			return
+		}
+		hangAfter = d
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	statuses := make(map[string]bool)
+	for _, s := range splitList(c.Query("status")) {
+		switch s {
+		case analysis.StatusCommitted, analysis.StatusRolledBack, analysis.StatusTimedOut, analysis.StatusFailed, analysis.StatusHanging, analysis.StatusInProgress, analysis.StatusUnknown:
+			statuses[s] = true
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status: " + s})
+			return
+		}
+	}
+	modes, ok := parseSeataModes(c)
+	if !ok {
+		return
+	}
+
+	tracker := analysis.NewTransactionTracker()
+	if err := s.runAnalyzers(c.Request.Context(), apps, from, to, []analysis.Analyzer{tracker}); err != nil {
+		readFailed(c, err)
+		return
+	}
+
+	// 未指定 to 时以当前时间判断是否挂起
+	reference := to
+	if reference.IsZero() {
+		reference = time.Now()
+	}
+	counts := make(map[string]int)
+	modeCounts := make(map[string]int)
+	transactions := []analysis.TransactionSummary{}
+	suspicious := []analysis.TransactionSummary{}
+	for _, tx := range tracker.Summaries(reference, hangAfter) {
+		if len(modes) > 0 && !modes[tx.Mode] {
+			continue
+		}
+		counts[tx.Status]++
+		modeCounts[parser.ModeKey(tx.Mode)]++
+		if tx.Status == analysis.StatusHanging {
+			suspicious = append(suspicious, tx)
+		}
+		if len(statuses) == 0 || statuses[tx.Status] {
+			transactions = append(transactions, tx)
+		}
+	}
+	// 最近开始的事务在前
+	sort.SliceStable(transactions, func(i, j int) bool { return transactions[i].FirstSeen.After(transactions[j].FirstSeen) })
+	truncated := len(transactions) > limit
+	if truncated {
+		transactions = transactions[:limit]
+	}
+
+	auditCount(c, len(transactions))
+	c.JSON(http.StatusOK, gin.H{
+		"application_ids": apps,
+		"hang_after":      hangAfter.String(),
+		"counts":          counts,
+		"modes":           modeCounts,
+		"transactions":    transactions,
+		"truncated":       truncated,
+		"suspicious":      suspicious,
+	})
+}
+
+// 事务状态的可选值，用于接口文档
+var transactionStatuses = strings.Join(analysis.Statuses, ", ")
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// 追加写入复用的文件句柄。每次写入都打开和关闭分段文件时，高并发上传会耗尽进程的文件描述符；
+// 句柄缓存限制同时打开的分段数，超出时关闭最久未用的空闲句柄，全部在用时等待句柄释放
+type FileHandlesConfig struct {
+	MaxOpen     int      `json:"max_open"`     // 同时打开的分段文件数上限，默认 256
+	IdleTimeout Duration `json:"idle_timeout"` // 句柄空闲超过该时长后关闭，默认 1m
+}
+
+var (
+	fileHandlesOpened  = metrics.counter("file_handles_opened_total", "Segment files opened for appending.")
+	fileHandlesClosed  = metrics.counter("file_handles_closed_total", "Cached segment file handles closed, by reason (limit, idle, stale, error, shutdown).")
+	fileHandlesReused  = metrics.counter("file_handles_reused_total", "Appends that reused a cached segment file handle.")
+	fileHandlesWaited  = metrics.counter("file_handles_waited_total", "Appends that waited for a handle because max_open handles were in use.")
+	fileHandlesOpenNow = metrics.gauge("file_handles_open", "Segment file handles currently open.")
+)
+
+// 缓存的句柄。mu 串行化同一文件的追加，写入前计算的偏移才不会与并发写入交错
+type fileHandle struct {
+	path string
+	file *os.File
+
+	mu       sync.Mutex
+	refs     int // 持有或等待该句柄的写入数，由缓存的锁保护
+	lastUsed time.Time
+	elem     *list.Element
+}
+
+// 文件句柄缓存，按最近使用排序
+type fileHandleCache struct {
+	max  int
+	idle time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	handles map[string]*fileHandle
+	lru     *list.List // 最近使用的在前
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newFileHandleCache(c FileHandlesConfig) (*fileHandleCache, error) {
+	if c.MaxOpen < 0 {
+		return nil, fmt.Errorf("max_open must not be negative")
+	}
+	if c.IdleTimeout < 0 {
+		return nil, fmt.Errorf("idle_timeout must not be negative")
+	}
+	if c.MaxOpen == 0 {
+		c.MaxOpen = 256
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = Duration(time.Minute)
+	}
+	h := &fileHandleCache{
+		max:     c.MaxOpen,
+		idle:    time.Duration(c.IdleTimeout),
+		handles: make(map[string]*fileHandle),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+	h.cond = sync.NewCond(&h.mu)
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(h.idle / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case now := <-ticker.C:
+				h.closeIdle(now)
+			}
+		}
+	}()
+	return h, nil
+}
+
+// 取得文件的追加句柄并独占之，用完后调用 Release。文件不存在时创建；
+// 缓存的句柄指向的文件已被改名或删除（压缩、滚动、改写分段等）时重新打开
+func (h *fileHandleCache) Acquire(path string) (*fileHandle, error) {
+	if h == nil {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &fileHandle{path: path, file: file}, nil
+	}
+
+	h.mu.Lock()
+	waited := false
+	for {
+		if fh, ok := h.handles[path]; ok {
+			fh.refs++
+			h.lru.MoveToFront(fh.elem)
+			h.mu.Unlock()
+			fh.mu.Lock()
+			if err := fh.validate(); err != nil {
+				h.Release(fh)
+				return nil, err
+			}
+			return fh, nil
+		}
+		if len(h.handles) < h.max || h.evictLocked() {
+			break
+		}
+		if !waited {
+			waited = true
+			fileHandlesWaited.Add(1)
+		}
+		h.cond.Wait()
+	}
+	fh := &fileHandle{path: path, refs: 1}
+	fh.mu.Lock()
+	fh.elem = h.lru.PushFront(fh)
+	h.handles[path] = fh
+	h.mu.Unlock()
+	if err := fh.validate(); err != nil {
+		h.Release(fh)
+		return nil, err
+	}
+	return fh, nil
+}
+
+// 确认句柄仍指向 path 对应的文件，必要时重新打开。调用方持有 fh.mu
+func (fh *fileHandle) validate() error {
+	if fh.file != nil {
+		current, err := os.Stat(fh.path)
+		opened, openedErr := fh.file.Stat()
+		if err == nil && openedErr == nil && os.SameFile(current, opened) {
+			fileHandlesReused.Add(1)
+			return nil
+		}
+		fh.close("stale")
+	}
+	file, err := os.OpenFile(fh.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fh.file = file
+	fileHandlesOpened.Add(1)
+	return nil
+}
+
+// 写入失败后丢弃句柄，下次写入重新打开。调用方持有 fh.mu
+func (fh *fileHandle) discard() {
+	if fh.file != nil {
+		fh.close("error")
+	}
+}
+
+func (fh *fileHandle) close(reason string) {
+	if err := fh.file.Close(); err != nil {
+		log.Printf("unable to close %s: %v", fh.path, err)
+	}
+	fh.file = nil
+	fileHandlesClosed.Add(1, "reason", reason)
+}
+
+// 释放 Acquire 取得的句柄
+func (h *fileHandleCache) Release(fh *fileHandle) {
+	if h == nil {
+		fh.file.Close()
+		return
+	}
+	fh.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fh.refs--
+	fh.lastUsed = time.Now()
+	// 没能打开的句柄不留在缓存中，关闭服务期间释放的句柄直接关闭
+	if fh.refs == 0 && (fh.file == nil || h.handles[fh.path] != fh) {
+		if fh.file != nil {
+			fh.close("shutdown")
+		}
+		h.removeLocked(fh)
+	}
+	h.updateGauge()
+	h.cond.Signal()
+}
+
+// 关闭最久未用的一个空闲句柄，没有空闲句柄时返回 false。调用方持有 h.mu
+func (h *fileHandleCache) evictLocked() bool {
+	for e := h.lru.Back(); e != nil; e = e.Prev() {
+		fh := e.Value.(*fileHandle)
+		if fh.refs > 0 {
+			continue
+		}
+		if fh.file != nil {
+			fh.close("limit")
+		}
+		h.removeLocked(fh)
+		return true
+	}
+	return false
+}
+
+// 调用方持有 h.mu
+func (h *fileHandleCache) removeLocked(fh *fileHandle) {
+	if h.handles[fh.path] == fh {
+		delete(h.handles, fh.path)
+		h.lru.Remove(fh.elem)
+	}
+}
+
+// 调用方持有 h.mu
+func (h *fileHandleCache) updateGauge() {
+	open := 0
+	for _, fh := range h.handles {
+		if fh.file != nil {
+			open++
+		}
+	}
+	fileHandlesOpenNow.Set(float64(open))
+}
+
+// 关闭空闲超时的句柄
+func (h *fileHandleCache) closeIdle(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for e := h.lru.Back(); e != nil; {
+		prev := e.Prev()
+		fh := e.Value.(*fileHandle)
+		if fh.refs == 0 && now.Sub(fh.lastUsed) >= h.idle {
+			if fh.file != nil {
+				fh.close("idle")
+			}
+			h.removeLocked(fh)
+		}
+		e = prev
+	}
+	h.updateGauge()
+	h.cond.Broadcast()
+}
+
+// 关闭全部句柄，在存储后端写出缓冲之后执行
+func (h *fileHandleCache) Close() error {
+	close(h.stop)
+	h.wg.Wait()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fh := range h.handles {
+		// 仍在写入的句柄由写入方释放
+		if fh.refs == 0 && fh.file != nil {
+			fh.close("shutdown")
+		}
+		h.removeLocked(fh)
+	}
+	h.updateGauge()
+	return nil
+}
@@ -0,0 +1,463 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单个分段按分钟、按级别的日志条数，以及 /stats 使用的采样还原条数和时间范围。
+// 增量查询按 MaxID、MaxOrder 和检查点跳过已经返回过的部分
+type segmentCounts struct {
+	Offset      int64                    `json:"offset"`              // 已计入的字节偏移，未关闭的分段下次从这里继续
+	Closed      bool                     `json:"closed"`              // 分段已关闭且全部计入，不再读取
+	Minutes     map[int64]map[string]int `json:"minutes"`             // Unix 分钟 → 级别 → 条数
+	Estimated   map[string]float64       `json:"estimated,omitempty"` // 级别 → 按采样比例还原的条数
+	Sampled     bool                     `json:"sampled,omitempty"`   // 包含经过采样的日志
+	First       time.Time                `json:"first"`
+	Last        time.Time                `json:"last"`
+	MaxID       int64                    `json:"max_id,omitempty"`      // 已计入日志的最大 ID
+	MaxOrder    int64                    `json:"max_order,omitempty"`   // 已计入日志的最大写入顺序，见 writeOrder
+	Checkpoints []countCheckpoint        `json:"checkpoints,omitempty"` // 按偏移递增
+}
+
+// 分段中一个位置之前全部日志的最大 ID 和写入顺序，大约每隔 countCheckpointBytes 记录一个
+type countCheckpoint struct {
+	Offset   int64 `json:"offset"`
+	MaxID    int64 `json:"max_id"`
+	MaxOrder int64 `json:"max_order"`
+}
+
+// 检查点的间隔，增量查询最多重新读取这么多已经返回过的日志
+const countCheckpointBytes = 1 << 20
+
+// 计入一条日志，end 为这条日志之后的字节偏移
+func (seg *segmentCounts) add(entry LogData, ref logRef, end int64) {
+	at := entryTime(entry, ref)
+	level := strings.ToUpper(entry.LogLevel)
+	levels := seg.Minutes[at.Unix()/60]
+	if levels == nil {
+		levels = make(map[string]int)
+		seg.Minutes[at.Unix()/60] = levels
+	}
+	levels[level]++
+	if seg.Estimated == nil {
+		seg.Estimated = make(map[string]float64)
+	}
+	seg.Estimated[level] += entryWeight(entry)
+	seg.Sampled = seg.Sampled || entry.SampleRate > 0
+	if seg.First.IsZero() || at.Before(seg.First) {
+		seg.First = at
+	}
+	if at.After(seg.Last) {
+		seg.Last = at
+	}
+	seg.MaxID = max(seg.MaxID, entry.ID)
+	seg.MaxOrder = max(seg.MaxOrder, writeOrder(entry, at))
+	last := int64(0)
+	if n := len(seg.Checkpoints); n > 0 {
+		last = seg.Checkpoints[n-1].Offset
+	}
+	if end-last >= countCheckpointBytes {
+		seg.Checkpoints = append(seg.Checkpoints, countCheckpoint{Offset: end, MaxID: seg.MaxID, MaxOrder: seg.MaxOrder})
+	}
+}
+
+// 索引格式版本，版本不一致的索引丢弃重建
+const countIndexVersion = 3
+
+// 写入时计入的计数定期落盘的间隔，重启后未落盘的部分由查询时补读
+const countFlushInterval = 10 * time.Second
+
+// 一个应用目录的计数索引
+type appCounts struct {
+	mu       sync.Mutex
+	path     string
+	dirty    bool                      // 有写入时计入、尚未落盘的计数
+	Version  int                       `json:"version"`
+	Dir      string                    `json:"dir"`
+	Segments map[string]*segmentCounts `json:"segments"` // 逻辑文件名 → 计数
+}
+
+// 直方图和统计使用的计数索引：写入日志时同步计入，查询时只补读索引之后追加的部分（如重启前未落盘的写入），
+// 关闭的分段只读取一次，之后的查询只读索引，不再扫描原始日志（也不会取回已分层的分段）
+type countIndex struct {
+	svc  *Service
+	mu   sync.Mutex
+	dir  string
+	apps map[string]*appCounts // 应用目录 → 索引
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (s *Service) newCountIndex(dataDir string) (*countIndex, error) {
+	dir := filepath.Join(dataDir, "histogram")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	x := &countIndex{svc: s, dir: dir, apps: make(map[string]*appCounts), stop: make(chan struct{})}
+	x.wg.Add(1)
+	go func() {
+		defer x.wg.Done()
+		ticker := time.NewTicker(countFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-x.stop:
+				return
+			case <-ticker.C:
+				x.Flush()
+			}
+		}
+	}()
+	return x, nil
+}
+
+// 应用的索引，首次访问时从磁盘加载
+func (x *countIndex) app(appFolder string) (*appCounts, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if a, ok := x.apps[appFolder]; ok {
+		return a, nil
+	}
+	sum := sha256.Sum256([]byte(appFolder))
+	a := &appCounts{path: filepath.Join(x.dir, hex.EncodeToString(sum[:8])+".json")}
+	if err := loadJSONFile(a.path, a); err != nil {
+		return nil, err
+	}
+	// 文件名只取哈希的一部分，目录不一致时重建
+	if a.Dir != appFolder || a.Version != countIndexVersion {
+		a.Version, a.Dir, a.Segments = countIndexVersion, appFolder, nil
+	}
+	if a.Segments == nil {
+		a.Segments = make(map[string]*segmentCounts)
+	}
+	x.apps[appFolder] = a
+	return a, nil
+}
+
+// 将新写入的日志计入索引后，在持有应用索引锁的情况下调用 fn 读取各分段的计数
+func (x *countIndex) View(applicationID string, now time.Time, fn func(segments map[string]*segmentCounts)) error {
+	appFolder := x.svc.applicationDir(applicationID)
+	a, err := x.app(appFolder)
+	if err != nil {
+		return err
+	}
+	names, err := listSegments(appFolder)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	last := make(map[string]int)
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+		if day, index, ok := parseSegmentName(name); ok && index >= last[day] {
+			last[day] = index
+		}
+	}
+	changed := false
+	// 已删除的分段不再计入
+	for name := range a.Segments {
+		if !present[name] {
+			delete(a.Segments, name)
+			changed = true
+		}
+	}
+
+	for _, name := range names {
+		day, index, ok := parseSegmentName(name)
+		if !ok {
+			continue
+		}
+		seg := a.Segments[name]
+		if seg == nil {
+			seg = &segmentCounts{Minutes: make(map[int64]map[string]int)}
+			a.Segments[name] = seg
+		}
+		// 导入历史日志时已关闭的分段可能被追加
+		if seg.Closed {
+			info, err := os.Stat(filepath.Join(appFolder, name))
+			if err != nil || info.Size() <= seg.Offset {
+				continue
+			}
+		}
+		// 当天最后一个分段仍在写入；前一天的分段在零点后留出一段时间再视为关闭
+		closed := index < last[day] || now.Sub(logFileDate(day).AddDate(0, 0, 1)) > compressGrace
+
+		ref := logRef{ApplicationID: applicationID, File: name}
+		offset := seg.Offset
+		_, err := x.svc.scanFileLines(context.Background(), filepath.Join(appFolder, name), seg.Offset, func(line string, offset, next int64) bool {
+			// 只计入完整的行，写入中的半行留到下次
+			if next-offset == int64(len(line)) && !closed {
+				return false
+			}
+			seg.Offset = next
+			entry, err := parseLogLine(line)
+			if err != nil {
+				return true
+			}
+			seg.add(entry, ref, next)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if seg.Offset != offset || closed {
+			changed = true
+		}
+		seg.Closed = closed
+	}
+
+	if changed || a.dirty {
+		if err := saveJSONFile(a.path, a); err != nil {
+			return err
+		}
+		a.dirty = false
+	}
+	fn(a.Segments)
+	return nil
+}
+
+// 写入一条日志后调用，offset 和 length 为这条记录在分段文件中的位置。只在索引正好计到该位置时计入，
+// 否则（如分段此前尚未读取）留给查询时补读；查询持有索引锁时同样不等待
+func (x *countIndex) Record(appFolder, name string, offset, length int64, entry LogData) {
+	if x == nil {
+		return
+	}
+	a, err := x.app(appFolder)
+	if err != nil || !a.mu.TryLock() {
+		return
+	}
+	defer a.mu.Unlock()
+	seg := a.Segments[name]
+	if seg == nil && offset == int64(len(formatHeaderLine)) {
+		// 本次写入新建的分段
+		seg = &segmentCounts{Offset: offset, Minutes: make(map[int64]map[string]int)}
+		a.Segments[name] = seg
+	}
+	if seg == nil || seg.Closed || seg.Offset != offset {
+		return
+	}
+	seg.add(entry, logRef{File: name}, offset+length)
+	seg.Offset = offset + length
+	a.dirty = true
+}
+
+// 保存写入时计入的计数
+func (x *countIndex) Flush() error {
+	x.mu.Lock()
+	apps := make([]*appCounts, 0, len(x.apps))
+	for _, a := range x.apps {
+		apps = append(apps, a)
+	}
+	x.mu.Unlock()
+	var firstErr error
+	for _, a := range apps {
+		a.mu.Lock()
+		if a.dirty {
+			if err := saveJSONFile(a.path, a); err != nil && firstErr == nil {
+				firstErr = err
+			} else if err == nil {
+				a.dirty = false
+			}
+		}
+		a.mu.Unlock()
+	}
+	return firstErr
+}
+
+// 停止定时落盘，退出前保存一次
+func (x *countIndex) Close() error {
+	close(x.stop)
+	x.wg.Wait()
+	return x.Flush()
+}
+
+// 丢弃分段的计数，下次查询时重新读取该分段
+func (x *countIndex) Forget(applicationID, name string) error {
+	a, err := x.app(x.svc.applicationDir(applicationID))
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.Segments[name]; !ok {
+		return nil
+	}
+	delete(a.Segments, name)
+	return saveJSONFile(a.path, a)
+}
+
+// 计数索引中已关闭分段的计数，用于按时间范围跳过分段。索引未加载该分段、分段未关闭或索引正被占用时返回 nil，不等待
+func (x *countIndex) ClosedSegment(appFolder, name string) *segmentCounts {
+	if x == nil {
+		return nil
+	}
+	a, err := x.app(appFolder)
+	if err != nil || !a.mu.TryLock() {
+		return nil
+	}
+	defer a.mu.Unlock()
+	if seg := a.Segments[name]; seg != nil && seg.Closed {
+		return seg
+	}
+	return nil
+}
+
+// 丢弃应用全部分段的计数，下次查询时重新读取
+func (x *countIndex) Reset(applicationID string) error {
+	a, err := x.app(x.svc.applicationDir(applicationID))
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Segments = make(map[string]*segmentCounts)
+	a.dirty = false
+	return saveJSONFile(a.path, a)
+}
+
+// 直方图中的一个分桶，total 为全部级别的条数，可用于计算错误率
+type histogramBucket struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Count int       `json:"count"`
+	Total int       `json:"total"`
+}
+
+// 直方图接口：基于计数索引按时间分桶统计指定级别的日志条数，
+// 分桶最小为 1 分钟，时间范围按分钟精度生效
+func (s *Service) histogramHandler(c *gin.Context) {
+	applicationID := c.Query("application_id")
+	if applicationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id is required"})
+		return
+	}
+	interval := c.DefaultQuery("interval", "1h")
+	loc, err := parseLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tz"})
+		return
+	}
+	b, err := newBucketer(interval, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if b.unit == 's' {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be at least 1m"})
+		return
+	}
+	fill := c.DefaultQuery("fill", "zero")
+	if fill != "zero" && fill != "none" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fill must be zero or none"})
+		return
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+	storeID, ok := s.queriedApplicationID(c, applicationID)
+	if !ok {
+		return
+	}
+	levels := make(map[string]bool)
+	for _, level := range splitList(c.Query("log_level")) {
+		levels[strings.ToUpper(level)] = true
+	}
+
+	buckets := make(map[time.Time]*histogramBucket)
+	var first, last time.Time
+	matched := 0
+	err = s.histogramCounts.View(storeID, time.Now(), func(segments map[string]*segmentCounts) {
+		for name, seg := range segments {
+			// 与查询一样跳过不可能包含时间范围内日志的分段
+			if !segmentInRange(name, seg, from, to) {
+				continue
+			}
+			for minute, byLevel := range seg.Minutes {
+				at := time.Unix(minute*60, 0)
+				if (!from.IsZero() && at.Before(from.Truncate(time.Minute))) || (!to.IsZero() && at.After(to)) {
+					continue
+				}
+				if first.IsZero() || at.Before(first) {
+					first = at
+				}
+				if at.After(last) {
+					last = at
+				}
+				start := b.Truncate(at)
+				bucket, ok := buckets[start]
+				if !ok {
+					bucket = &histogramBucket{Start: start, End: b.Next(start)}
+					buckets[start] = bucket
+				}
+				for level, n := range byLevel {
+					bucket.Total += n
+					if len(levels) == 0 || levels[level] {
+						bucket.Count += n
+						matched += n
+					}
+				}
+			}
+		}
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read application logs"})
+		return
+	}
+
+	result := make([]histogramBucket, 0, len(buckets))
+	if fill == "zero" && (len(buckets) > 0 || (!from.IsZero() && !to.IsZero())) {
+		if from.IsZero() {
+			from = first
+		}
+		if to.IsZero() {
+			to = last
+		}
+		starts, err := b.Range(from, to, maxBuckets)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, start := range starts {
+			if bucket, ok := buckets[start]; ok {
+				result = append(result, *bucket)
+			} else {
+				result = append(result, histogramBucket{Start: start, End: b.Next(start)})
+			}
+		}
+	} else {
+		for _, bucket := range buckets {
+			result = append(result, *bucket)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	}
+
+	auditCount(c, matched)
+	c.JSON(http.StatusOK, gin.H{
+		"application_id": applicationID,
+		"log_level":      c.Query("log_level"),
+		"interval":       interval,
+		"tz":             loc.String(),
+		"buckets":        result,
+	})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/i18n"
+)
+
+// 生成文本的本地化，译文见 i18n 包。接口按 Accept-Language 选择语言，告警和定期报告没有请求，使用渠道或报告配置的语言，
+// 其次为这里的默认语言。接口的错误信息、字段名和枚举值不翻译
+type LocalizationConfig struct {
+	Language string `json:"language"` // 默认语言：en（默认）或 zh-CN
+}
+
+func (c *LocalizationConfig) validate() error {
+	if c.Language == "" {
+		c.Language = i18n.English
+	}
+	lang, ok := i18n.Normalize(c.Language)
+	if !ok {
+		return fmt.Errorf("unsupported language %q, use en or zh-CN", c.Language)
+	}
+	c.Language = lang
+	return nil
+}
+
+// 校验渠道或报告配置中的语言，为空时沿用默认语言
+func configuredLanguage(lang string) (string, error) {
+	if lang == "" {
+		return "", nil
+	}
+	if l, ok := i18n.Normalize(lang); ok {
+		return l, nil
+	}
+	return "", fmt.Errorf("unsupported language %q, use en or zh-CN", lang)
+}
+
+// 配置的默认语言
+func (s *Service) defaultLanguage() string {
+	if s.cfg.Localization.Language == "" {
+		return i18n.English
+	}
+	return s.cfg.Localization.Language
+}
+
+// 按 Accept-Language 选择权重最高的支持语言，没有时为默认语言；同时设置 Content-Language
+func (s *Service) requestLanguage(c *gin.Context) string {
+	lang := s.defaultLanguage()
+	if header := c.GetHeader("Accept-Language"); header != "" {
+		type candidate struct {
+			lang string
+			q    float64
+		}
+		var candidates []candidate
+		for _, part := range strings.Split(header, ",") {
+			tag, params, _ := strings.Cut(part, ";")
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+			if l, ok := i18n.Normalize(tag); ok && q > 0 {
+				candidates = append(candidates, candidate{l, q})
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+		if len(candidates) > 0 {
+			lang = candidates[0].lang
+		}
+	}
+	c.Header("Content-Language", lang)
+	c.Header("Vary", "Accept-Language")
+	return lang
+}
@@ -0,0 +1,512 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 历史日志导入
+type ImportConfig struct {
+	Dirs []string `json:"dirs"` // 允许按服务端路径导入的目录，为空时只能上传文件导入
+}
+
+// 无法读取或解压的导入文件
+var errInvalidImportFile = errors.New("invalid log file")
+
+// 单个文件的导入结果
+type importFileResult struct {
+	Name       string            `json:"name"`
+	Status     string            `json:"status"` // done 或 failed
+	Imported   int               `json:"imported"`
+	Duplicates int               `json:"duplicates"`
+	Dropped    int               `json:"dropped"`
+	Invalid    int               `json:"invalid"`              // 时间戳无效或不符合 Schema 而跳过的条数
+	Rejections []importRejection `json:"rejections,omitempty"` // 跳过的日志，最多 maxImportRejections 条
+	FirstDay   string            `json:"first_day,omitempty"`  // 写入的最早和最晚日期
+	LastDay    string            `json:"last_day,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Reason     string            `json:"reason,omitempty"`    // 失败的原因，与批量上传逐条结果中的 reason 相同，文件无法读取时为 invalid_file
+	Retryable  bool              `json:"retryable,omitempty"` // 稍后重新导入该文件可能成功
+}
+
+// 导入时跳过的一条日志，Line 为日志第一行在文件中的行号
+type importRejection struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+}
+
+// 每个文件最多记录的跳过的日志
+const maxImportRejections = 20
+
+// 记录文件导入失败的原因
+func (r *importFileResult) fail(err error) {
+	r.Status, r.Error = importFailed, err.Error()
+	if errors.Is(err, errInvalidImportFile) {
+		r.Reason = "invalid_file"
+		return
+	}
+	class := classifyIngestError(err)
+	r.Reason, r.Retryable = class.reason, class.retryable
+}
+
+// 滚动后的 Seata 日志文件名中带有日期，如 seata-server.log.2024-10-25.0.gz
+var importDatePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// 从文件名推断日志日期，没有日期时返回零值
+func importFileDate(name string) time.Time {
+	for _, m := range importDatePattern.FindAllString(filepath.Base(name), -1) {
+		if day, err := time.ParseInLocation("2006-01-02", m, time.Local); err == nil {
+			return day
+		}
+	}
+	return time.Time{}
+}
+
+// 解析 date 参数，为空时返回零值
+func parseImportDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// 导入一个日志文件，gzip 压缩的文件自动解压。每行按 Seata TC 布局或常见格式解析，
+// 以 { 开头的行按 NDJSON 存储格式解析，异常堆栈合并到上一条日志。
+// 只有时分秒的时间戳用 day（未指定时取文件名中的日期）补全，日志按自身的日期写入对应的文件
+func (s *Service) importLogFile(applicationID, name string, r io.Reader, day time.Time, result *importFileResult) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidImportFile, err)
+		}
+		defer zr.Close()
+		br = bufio.NewReaderSize(zr, 64<<10)
+	}
+	if day.IsZero() {
+		day = importFileDate(name)
+	}
+	// 无法确定日期时，只有时分秒的日志记在今天
+	now := day
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var pending *LogData
+	var lineNo, pendingLine int
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		entry := *pending
+		pending = nil
+		return s.importEntry(entry, now, pendingLine, result)
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			lineNo++
+			line = strings.TrimRight(line, "\r\n")
+			if pending != nil && parser.IsContinuation(line) {
+				pending.LogMessage += "\n" + line
+			} else if strings.TrimSpace(line) != "" {
+				if err := flush(); err != nil {
+					return err
+				}
+				entry := s.parseImportLine(applicationID, line, now)
+				pending, pendingLine = &entry, lineNo
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidImportFile, err)
+		}
+	}
+	return flush()
+}
+
+// 解析导入文件中的一行，NDJSON 记录中的应用 ID 以导入目标为准
+func (s *Service) parseImportLine(applicationID, line string, now time.Time) LogData {
+	if strings.HasPrefix(line, "{") {
+		if entry, err := parseLogLine(line); err == nil {
+			entry.ApplicationID = applicationID
+			return entry
+		}
+	}
+	return s.parseRawLine(applicationID, line, now)
+}
+
+// 按日志时间写入历史文件，line 为日志在文件中的行号。导入的是历史日志，不触发告警也不推送给实时订阅者
+func (s *Service) importEntry(entry LogData, day time.Time, line int, result *importFileResult) error {
+	if at, ok := parser.ParseTime(entry.Timestamp, day); ok {
+		day = at.In(time.Local)
+	}
+	_, err := s.storeEntry(entry, day, nil)
+	if err != nil {
+		s.deadLetters.Capture(entry, day, err)
+	}
+	switch {
+	case errors.Is(err, errDuplicateEntry):
+		result.Duplicates++
+	case errors.Is(err, errDroppedEntry):
+		result.Dropped++
+	case errors.Is(err, errInvalidTimestamp), errors.Is(err, errSchemaViolation):
+		result.Invalid++
+		if len(result.Rejections) < maxImportRejections {
+			r := rejectedEntry(0, err)
+			result.Rejections = append(result.Rejections, importRejection{Line: line, Reason: r.Reason, Error: r.Error})
+		}
+	case err != nil:
+		return err
+	default:
+		result.Imported++
+		d := day.Format("2006-01-02")
+		if result.FirstDay == "" || d < result.FirstDay {
+			result.FirstDay = d
+		}
+		if d > result.LastDay {
+			result.LastDay = d
+		}
+	}
+	return nil
+}
+
+// 导入接口：以 multipart/form-data 上传一个或多个日志文件（字段名 file，可以是 .gz），
+// 日志按各自的日期写入历史文件，用于迁移到本服务时导入已有的日志。
+// 一个文件失败时停止；partial=true 时继续导入后面的文件，有文件失败时返回 207，客户端只需重新上传失败的文件
+func (s *Service) importHandler(c *gin.Context) {
+	applicationID := c.Query("application_id")
+	if applicationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id is required"})
+		return
+	}
+	storeID, ok := scopedApplicationID(c, applicationID)
+	if !ok {
+		return
+	}
+	day, err := parseImportDate(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be multipart/form-data"})
+		return
+	}
+
+	partial := c.Query("partial") == "true"
+	files := []importFileResult{}
+	total, failed := 0, 0
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			auditCount(c, total)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart body", "imported": total, "files": files})
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		result := importFileResult{Name: part.FileName(), Status: importDone}
+		err = s.importLogFile(storeID, part.FileName(), part, day, &result)
+		part.Close()
+		total += result.Imported
+		if err != nil {
+			result.fail(err)
+			files = append(files, result)
+			failed++
+			if partial {
+				continue
+			}
+			auditCount(c, total)
+			if errors.Is(err, errInvalidImportFile) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read " + result.Name, "imported": total, "files": files})
+				return
+			}
+			class := classifyIngestError(err)
+			c.JSON(class.status, gin.H{"error": class.message, "imported": total, "files": files})
+			return
+		}
+		files = append(files, result)
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file in request body"})
+		return
+	}
+
+	auditCount(c, total)
+	if failed > 0 {
+		c.JSON(http.StatusMultiStatus, gin.H{"message": "Some files failed to import", "application_id": applicationID, "imported": total, "failed": failed, "files": files})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logs imported successfully", "application_id": applicationID, "imported": total, "files": files})
+}
+
+// 导入任务状态
+const (
+	importRunning = "running"
+	importDone    = "done"
+	importFailed  = "failed"
+)
+
+// 按路径导入的请求
+type importRequest struct {
+	ApplicationID string `json:"application_id" binding:"required"`
+	Path          string `json:"path" binding:"required"` // 文件或目录，须位于 import.dirs 之中
+	Pattern       string `json:"pattern"`                 // 目录中参与导入的文件名模式，默认 *.log*
+	Date          string `json:"date"`                    // 只有时分秒的日志所在的日期，默认取文件名中的日期
+	Partial       bool   `json:"partial"`                 // 一个文件失败时继续导入后面的文件
+}
+
+// 按路径导入的任务
+type importJob struct {
+	ID            string             `json:"id"`
+	ApplicationID string             `json:"application_id"`
+	Path          string             `json:"path"`
+	Pattern       string             `json:"pattern"`
+	Date          string             `json:"date,omitempty"`
+	Partial       bool               `json:"partial,omitempty"`
+	Status        string             `json:"status"`
+	Current       string             `json:"current,omitempty"` // 正在导入的文件
+	Imported      int                `json:"imported"`
+	Files         []importFileResult `json:"files"`
+	Error         string             `json:"error,omitempty"`
+	StartedAt     time.Time          `json:"started_at"`
+	FinishedAt    *time.Time         `json:"finished_at,omitempty"`
+}
+
+// 导入任务管理
+type importManager struct {
+	svc  *Service
+	mu   sync.Mutex
+	seq  int
+	jobs map[string]*importJob
+}
+
+// 创建导入任务并在后台执行
+func (m *importManager) Start(job *importJob, files []string, day time.Time) {
+	m.mu.Lock()
+	m.seq++
+	job.ID = strconv.Itoa(m.seq)
+	job.Status = importRunning
+	job.Files = []importFileResult{}
+	job.StartedAt = time.Now()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	go m.run(job, files, day)
+}
+
+// 读取任务快照
+func (m *importManager) Get(id string) (importJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return importJob{}, false
+	}
+	snapshot := *job
+	snapshot.Files = append([]importFileResult{}, job.Files...)
+	return snapshot, true
+}
+
+// 列出所有任务
+func (m *importManager) List() []importJob {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.jobs))
+	for id := range m.jobs {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	jobs := make([]importJob, 0, len(ids))
+	for _, id := range ids {
+		if job, ok := m.Get(id); ok {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+	return jobs
+}
+
+// 依次导入文件，任何一个文件失败时停止；job.Partial 时继续导入后面的文件，任务以最后一个失败的文件为准记为失败
+func (m *importManager) run(job *importJob, files []string, day time.Time) {
+	var err error
+	for _, path := range files {
+		m.mu.Lock()
+		job.Current = path
+		m.mu.Unlock()
+
+		result := importFileResult{Name: path, Status: importDone}
+		fileErr := m.svc.importPath(job.ApplicationID, path, day, &result)
+		if fileErr != nil {
+			result.fail(fileErr)
+			err = fileErr
+		}
+		m.mu.Lock()
+		job.Files = append(job.Files, result)
+		job.Imported += result.Imported
+		m.mu.Unlock()
+		if err != nil && !job.Partial {
+			break
+		}
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Current = ""
+	if err != nil {
+		job.Status = importFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = importDone
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		log.Printf("import %s into %s failed: %v", job.ID, job.ApplicationID, err)
+	} else {
+		log.Printf("import %s into %s completed: %d entries from %d files", job.ID, job.ApplicationID, job.Imported, len(files))
+	}
+}
+
+func (s *Service) importPath(applicationID, path string, day time.Time, result *importFileResult) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.importLogFile(applicationID, path, file, day, result)
+}
+
+// 路径是否位于允许导入的目录之中，符号链接按实际路径判断
+func (s *Service) importAllowed(path string) bool {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return false
+	}
+	for _, dir := range s.cfg.Import.Dirs {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if root, err = filepath.Abs(root); err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 列出待导入的文件：单个文件，或目录中（不含子目录）匹配模式的文件，按文件名排序
+func importFiles(path, pattern string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, e.Name()); ok {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// 按路径导入接口：扫描服务端 import.dirs 中的文件或目录，在后台导入
+func (s *Service) importCreateHandler(c *gin.Context) {
+	var req importRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if req.Pattern == "" {
+		req.Pattern = "*.log*"
+	}
+	if _, err := filepath.Match(req.Pattern, ""); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pattern"})
+		return
+	}
+	day, err := parseImportDate(req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	if !s.importAllowed(req.Path) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Path is not in an import directory"})
+		return
+	}
+	files, err := importFiles(req.Path, req.Pattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read path"})
+		return
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files match the pattern"})
+		return
+	}
+
+	job := &importJob{ApplicationID: req.ApplicationID, Path: req.Path, Pattern: req.Pattern, Date: req.Date, Partial: req.Partial}
+	s.imports.Start(job, files, day)
+	snapshot, _ := s.imports.Get(job.ID)
+	c.JSON(http.StatusAccepted, snapshot)
+}
+
+// 导入任务列表接口
+func (s *Service) importListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"imports": s.imports.List()})
+}
+
+// 导入任务详情接口
+func (s *Service) importGetHandler(c *gin.Context) {
+	job, ok := s.imports.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
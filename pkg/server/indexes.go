@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 派生索引的校验与重建：计数索引（直方图、/stats 和计数查询使用的按分钟、按级别条数）、XID 布隆过滤器和日志 ID 预留值
+// 都由原始分段推导，恢复备份、崩溃或存储迁移后可能与分段不一致。校验逐个读取分段与索引比对，
+// 重建丢弃应用的全部索引后从分段重新建立，再校验一次确认一致
+type indexReport struct {
+	Applications int          `json:"applications"`
+	Segments     int          `json:"segments"`
+	Skipped      int          `json:"skipped"` // 已分层到对象存储的分段不读取
+	Rebuilt      bool         `json:"rebuilt"`
+	Consistent   bool         `json:"consistent"`
+	Issues       []indexIssue `json:"issues"`
+}
+
+// 一处不一致
+type indexIssue struct {
+	ApplicationID string `json:"application_id"`
+	Index         string `json:"index"` // counts、xid_bloom 或 log_ids
+	File          string `json:"file,omitempty"`
+	Problem       string `json:"problem"` // mismatch、stale（分段已不存在）、false_negative 或 behind
+	Detail        string `json:"detail"`
+}
+
+var indexIssuesFound = metrics.counter("index_issues_total", "Derived index inconsistencies found by verification, by index.")
+
+// 计数索引中一个分段的快照，校验期间不持有索引锁
+type countsSnapshot struct {
+	Offset      int64
+	Minutes     map[int64]map[string]int
+	First, Last time.Time
+	MaxID       int64
+}
+
+func (s *Service) snapshotCounts(applicationID string) (map[string]countsSnapshot, error) {
+	a, err := s.histogramCounts.app(s.applicationDir(applicationID))
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	snap := make(map[string]countsSnapshot, len(a.Segments))
+	for name, seg := range a.Segments {
+		// 未关闭的分段仍在计入，不做比对
+		if !seg.Closed {
+			continue
+		}
+		minutes := make(map[int64]map[string]int, len(seg.Minutes))
+		for m, levels := range seg.Minutes {
+			minutes[m] = maps.Clone(levels)
+		}
+		snap[name] = countsSnapshot{Offset: seg.Offset, Minutes: minutes, First: seg.First, Last: seg.Last, MaxID: seg.MaxID}
+	}
+	return snap, nil
+}
+
+func (s *Service) snapshotBlooms(applicationID string) (map[string]*xidBloom, error) {
+	a, err := s.xidBlooms.app(s.applicationDir(applicationID))
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	snap := make(map[string]*xidBloom, len(a.Segments))
+	for name, b := range a.Segments {
+		c := *b
+		c.Bits = append([]byte(nil), b.Bits...)
+		snap[name] = &c
+	}
+	return snap, nil
+}
+
+func levelTotals(minutes map[int64]map[string]int) map[string]int {
+	totals := make(map[string]int)
+	for _, levels := range minutes {
+		for level, n := range levels {
+			totals[level] += n
+		}
+	}
+	return totals
+}
+
+func minutesEqual(a, b map[int64]map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for m, levels := range a {
+		if !maps.Equal(levels, b[m]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 对比分段的计数，索引计到的位置超过分段末尾说明分段被替换或截短；分段在索引之后被追加的，留给查询时补读
+func diffSegmentCounts(indexed countsSnapshot, fresh *segmentCounts) string {
+	if indexed.Offset > fresh.Offset {
+		return fmt.Sprintf("indexed up to offset %d, segment ends at %d", indexed.Offset, fresh.Offset)
+	}
+	if indexed.Offset < fresh.Offset {
+		return ""
+	}
+	var diffs []string
+	want, got := levelTotals(fresh.Minutes), levelTotals(indexed.Minutes)
+	levels := maps.Clone(want)
+	maps.Copy(levels, got)
+	for _, level := range sortedKeys(levels) {
+		if want[level] != got[level] {
+			diffs = append(diffs, fmt.Sprintf("%s: indexed %d, stored %d", level, got[level], want[level]))
+		}
+	}
+	if len(diffs) == 0 && !minutesEqual(indexed.Minutes, fresh.Minutes) {
+		diffs = append(diffs, "per-minute counts differ")
+	}
+	if !indexed.First.Equal(fresh.First) || !indexed.Last.Equal(fresh.Last) {
+		diffs = append(diffs, fmt.Sprintf("time range indexed %s..%s, stored %s..%s",
+			indexed.First.Format(time.RFC3339), indexed.Last.Format(time.RFC3339), fresh.First.Format(time.RFC3339), fresh.Last.Format(time.RFC3339)))
+	}
+	if indexed.MaxID != fresh.MaxID {
+		diffs = append(diffs, fmt.Sprintf("max id indexed %d, stored %d", indexed.MaxID, fresh.MaxID))
+	}
+	return strings.Join(diffs, "; ")
+}
+
+// 校验一个应用的计数和过滤器，返回存储中的最大日志 ID
+func (s *Service) verifyApplicationIndexes(ctx context.Context, applicationID string, report *indexReport) (int64, error) {
+	dir := s.applicationDir(applicationID)
+	names, err := listSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+	counts, err := s.snapshotCounts(applicationID)
+	if err != nil {
+		return 0, err
+	}
+	blooms, err := s.snapshotBlooms(applicationID)
+	if err != nil {
+		return 0, err
+	}
+	issue := func(index, file, problem, detail string) {
+		indexIssuesFound.Add(1, "index", index)
+		report.Issues = append(report.Issues, indexIssue{ApplicationID: applicationID, Index: index, File: file, Problem: problem, Detail: detail})
+	}
+
+	present := make(map[string]bool, len(names))
+	var maxID int64
+	for _, name := range names {
+		present[name] = true
+		path := filepath.Join(dir, name)
+		if segmentOnlyTiered(path) {
+			report.Skipped++
+			continue
+		}
+		report.Segments++
+
+		fresh := &segmentCounts{Minutes: make(map[int64]map[string]int)}
+		bloom := blooms[name]
+		missing, tokens := 0, 0
+		ref := logRef{ApplicationID: applicationID, File: name}
+		_, err := s.scanFileLines(ctx, path, 0, func(line string, offset, next int64) bool {
+			fresh.Offset = next
+			if bloom != nil && next <= bloom.Offset {
+				xidTokens(line, func(token string) {
+					tokens++
+					if !bloom.mayContain(token) {
+						missing++
+					}
+				})
+			}
+			if entry, err := parseLogLine(line); err == nil {
+				fresh.add(entry, ref, next)
+			}
+			return true
+		})
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		maxID = max(maxID, fresh.MaxID)
+
+		if indexed, ok := counts[name]; ok {
+			if detail := diffSegmentCounts(indexed, fresh); detail != "" {
+				issue("counts", name, "mismatch", detail)
+			}
+		}
+		if bloom != nil {
+			if bloom.Offset > fresh.Offset {
+				issue("xid_bloom", name, "mismatch", fmt.Sprintf("filter covers up to offset %d, segment ends at %d", bloom.Offset, fresh.Offset))
+			} else if missing > 0 {
+				issue("xid_bloom", name, "false_negative", fmt.Sprintf("%d of %d XID occurrences are not in the filter", missing, tokens))
+			}
+		}
+	}
+	for _, name := range sortedKeys(counts) {
+		if !present[name] {
+			issue("counts", name, "stale", "segment no longer exists")
+		}
+	}
+	for _, name := range sortedKeys(blooms) {
+		if !present[name] {
+			issue("xid_bloom", name, "stale", "segment no longer exists")
+		}
+	}
+	return maxID, nil
+}
+
+// 丢弃应用的计数和过滤器并从分段重新建立，丢弃缓存的查询结果
+func (s *Service) rebuildApplicationIndexes(ctx context.Context, applicationID string) error {
+	dir := s.applicationDir(applicationID)
+	names, err := listSegments(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		s.queryCache.Invalidate(filepath.Join(dir, name))
+	}
+	if err := s.histogramCounts.Reset(applicationID); err != nil {
+		return err
+	}
+	if err := s.histogramCounts.View(applicationID, time.Now(), func(map[string]*segmentCounts) {}); err != nil {
+		return err
+	}
+	if err := s.xidBlooms.Reset(applicationID); err != nil {
+		return err
+	}
+	// 不查询任何 XID，只为已关闭的分段建立过滤器
+	_, err = s.xidBlooms.Skippable(ctx, applicationID, nil, time.Now())
+	return err
+}
+
+// 校验一组应用的索引，rebuild 时先重建，并修正落后的日志 ID 预留值
+func (s *Service) checkIndexes(ctx context.Context, apps []string, rebuild bool) (indexReport, error) {
+	report := indexReport{Rebuilt: rebuild, Issues: []indexIssue{}}
+	for _, app := range apps {
+		// 只有本地目录存放日志的后端有派生索引
+		if _, bc, _ := s.backends.Store(s.backends.BackendOf(app)); bc.Type != "file" {
+			continue
+		}
+		if _, err := listSegments(s.applicationDir(app)); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		report.Applications++
+		if rebuild {
+			if err := s.rebuildApplicationIndexes(ctx, app); err != nil {
+				return report, fmt.Errorf("%s: %w", app, err)
+			}
+		}
+		maxID, err := s.verifyApplicationIndexes(ctx, app, &report)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", app, err)
+		}
+		// 预留值落后时重启后分配的 ID 可能与已有日志重复
+		if reserved := s.logIDs.Reserved(app); reserved < maxID {
+			if rebuild {
+				if err := s.logIDs.Ensure(app, maxID); err != nil {
+					return report, fmt.Errorf("%s: %w", app, err)
+				}
+				continue
+			}
+			indexIssuesFound.Add(1, "index", "log_ids")
+			report.Issues = append(report.Issues, indexIssue{ApplicationID: app, Index: "log_ids", Problem: "behind",
+				Detail: fmt.Sprintf("reserved up to %d, stored ids reach %d", reserved, maxID)})
+		}
+	}
+	sort.SliceStable(report.Issues, func(i, j int) bool { return report.Issues[i].ApplicationID < report.Issues[j].ApplicationID })
+	report.Consistent = len(report.Issues) == 0
+	return report, nil
+}
+
+// 索引校验接口：GET /admin/indexes/verify 只报告，POST /admin/indexes/rebuild 重建后校验。
+// application_id 为空时处理全部应用
+func (s *Service) indexesHandler(rebuild bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apps, ok := s.storageApplications(c)
+		if !ok {
+			return
+		}
+		report, err := s.checkIndexes(c.Request.Context(), apps, rebuild)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to check indexes: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
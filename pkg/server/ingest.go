@@ -0,0 +1,370 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 单次批量上传最多包含的日志条数
+const maxBatchSize = 1000
+
+// 写入一条日志并执行后续处理（告警规则、实时推送），因校验或存储出错没能写入的日志进入死信。
+// 由写入工作池调用，其他地方使用 ingestEntry 或 tryIngestEntry
+func (s *Service) ingestOne(entry LogData) (int64, error) {
+	received := time.Now()
+	id, err := s.writeEntry(entry)
+	if err != nil {
+		s.deadLetters.Capture(entry, time.Time{}, err)
+		return id, err
+	}
+	s.ingestLag.Observe(entry, received)
+	return id, nil
+}
+
+// 同 ingestEntry，但失败时不进入死信，用于重放死信
+func (s *Service) writeEntry(entry LogData) (int64, error) {
+	now := time.Now()
+	ts, err := normalizeTimestamp(entry.Timestamp, now, now)
+	if err != nil {
+		return 0, err
+	}
+	entry.Timestamp = ts
+
+	id, err := s.storeEntry(entry, now, func(stored LogData) {
+		// 推送给实时订阅者，在应用的写入锁内推送，订阅者按写入顺序收到日志
+		entry.ID, entry.Seq = stored.ID, stored.Seq
+		s.tailHub.Publish(entry)
+	})
+	if err != nil || id == 0 {
+		// 暂停写入时暂存的日志恢复后写入，不再执行告警规则
+		return 0, err
+	}
+
+	// 对新日志执行告警规则和重试风暴检测，再交给订阅写入事件的插件
+	s.alertEngine.Observe(entry)
+	s.retryStorms.Observe(entry)
+	s.plugins.Ingest(entry, now)
+	return id, nil
+}
+
+// 经过写入前处理、去重和配额检查后，将日志写入 day 当天的日志文件，返回分配的日志 ID。
+// stored 不为 nil 时在写入成功后、释放应用的写入锁之前以写入的日志调用。
+// 应用暂停写入时按暂停模式拒绝，或暂存日志并返回 ID 0，恢复写入时再写入
+func (s *Service) storeEntry(entry LogData, day time.Time, stored func(LogData)) (int64, error) {
+	if held, err := s.ingestPauses.Hold(entry, day, stored); held || err != nil {
+		return 0, err
+	}
+	return s.persistEntry(entry, day, stored)
+}
+
+// 同 storeEntry，但不检查暂停，用于写入暂存的日志
+func (s *Service) persistEntry(entry LogData, day time.Time, stored func(LogData)) (id int64, err error) {
+	s.ingestPending.Add(1)
+	defer s.ingestPending.Add(-1)
+
+	repairUTF8(&entry)
+
+	// JSON 格式的消息展开为自定义字段，其中的 trace_id 等键也用于下面补全上下文
+	s.jsonMessages.Apply(&entry)
+	// 补全追踪上下文
+	extractTraceContext(&entry)
+	// 提取 RPC 请求 ID，关联调用方和被调用方的日志
+	extractRequestID(&entry)
+	// 标记 Seata 事务模式，流水线规则也可以按 seata_mode 处理
+	parser.TagMode(&entry)
+	// 标记产生日志的 TC 节点
+	s.tcNodes.Tag(&entry)
+	// 已知的严重 Seata 错误提升级别，流水线规则按提升后的级别处理
+	s.escalations.Apply(&entry)
+	// 客户端采样的比例只接受 (0, 1)，其余视为未采样
+	if entry.SampleRate <= 0 || entry.SampleRate >= 1 {
+		entry.SampleRate = 0
+	}
+
+	// 写入前处理：丢弃、脱敏、附加字段、改写级别
+	if !s.pipeline.Process(&entry) {
+		return 0, errDroppedEntry
+	}
+
+	// 处理器可能改写时间戳，写入前统一为 UTC
+	ts, err := normalizeTimestamp(entry.Timestamp, day, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	entry.Timestamp = ts
+
+	// 按应用登记的 Schema 校验，tag 模式下只做标记
+	if err := s.schemas.Check(&entry); err != nil {
+		return 0, err
+	}
+	// 归档或软删除的应用只读
+	if err := s.lifecycle.CheckWrite(entry.ApplicationID); err != nil {
+		return 0, err
+	}
+
+	// 去重窗口内内容相同的日志只写入一次
+	if s.dedup != nil && s.dedup.content {
+		key := entryDedupKey(entry)
+		if s.dedup.Claim(key, time.Now()) != nil {
+			dedupSkipped.Add(1)
+			return 0, errDuplicateEntry
+		}
+		defer func() {
+			if err != nil {
+				s.dedup.Forget(key)
+			} else {
+				s.dedup.Complete(key, 0, nil)
+			}
+		}()
+	}
+
+	// 租户应用先扣除当天的配额
+	if tenant, _ := model.SplitApplicationID(entry.ApplicationID); tenant != "" {
+		if err := s.tenants.Reserve(tenant, int64(len(entry.LogMessage)), time.Now()); err != nil {
+			return 0, err
+		}
+	}
+
+	// 根据日期写入对应的日志文件，迁移切换或记录快照期间写入会短暂阻塞
+	logFileName := day.Format("2006-01-02") + ".log"
+	s.backends.writes.RLock()
+	defer s.backends.writes.RUnlock()
+	gate := s.backends.WriteGate(entry.ApplicationID)
+	gate.RLock()
+	defer gate.RUnlock()
+	store, _, _ := s.backends.Store(s.backends.BackendOf(entry.ApplicationID))
+	return s.logIDs.Assign(entry.ApplicationID, func(id int64) error {
+		entry.ID = id
+		entry.Seq = s.ingestSeq.Next()
+		started := time.Now()
+		if err := store.AppendEntry(entry.ApplicationID, logFileName, entry); err != nil {
+			return err
+		}
+		s.writeLatency.Observe(entry.ApplicationID, s.backends.BackendOf(entry.ApplicationID), logFileName, time.Since(started))
+		s.replication.Append(entry.ApplicationID, logFileName, entry)
+		if stored != nil {
+			stored(entry)
+		}
+		s.outputs.Publish(entry)
+		s.seataVersions.Observe(entry)
+		s.logMetrics.Observe(entry)
+		return nil
+	})
+}
+
+// 纯文本行上传：只提供应用和一行原始日志，由服务端按应用登记的解析规则（其次为内置布局）推断级别、时间戳和消息，
+// 都无法识别时级别取行首附近的级别关键字，默认为 INFO，时间戳默认为服务端收到的时间。fields 覆盖解析出的同名字段
+type RawLineUpload struct {
+	ApplicationID string            `json:"application_id" binding:"required"`
+	RawLine       string            `json:"raw_line" binding:"required"`
+	Fields        map[string]string `json:"fields,omitempty" binding:"max=64"`
+}
+
+// 上传的 JSON 对象缺少必填字段或格式错误
+var errInvalidUpload = errors.New("invalid upload entry")
+
+// 解码上传的一条日志并按租户限定应用 ID，带 raw_line 字段的按纯文本行上传处理。ok 为 false 时已写出无权访问等响应；
+// 校验失败时返回 errInvalidUpload、errInvalidTimestamp 或字段超长的 *fieldTooLongError
+func (s *Service) decodeUploadEntry(c *gin.Context, data []byte, now time.Time) (LogData, bool, error) {
+	entry, err := s.decodeEntry(c, data, now)
+	var appErr *applicationIDError
+	if errors.As(err, &appErr) {
+		c.JSON(appErr.status, gin.H{"error": appErr.message})
+		return LogData{}, false, nil
+	}
+	return entry, true, err
+}
+
+// 同 decodeUploadEntry，但不写出响应，应用 ID 非法或无权访问时返回 *applicationIDError
+func (s *Service) decodeEntry(c *gin.Context, data []byte, now time.Time) (LogData, error) {
+	var probe struct {
+		RawLine *string `json:"raw_line"`
+	}
+	if json.Unmarshal(data, &probe) != nil {
+		return LogData{}, errInvalidUpload
+	}
+	if probe.RawLine != nil {
+		var upload RawLineUpload
+		if binding.JSON.BindBody(data, &upload) != nil {
+			return LogData{}, errInvalidUpload
+		}
+		if err := s.uploadLimits.checkMessage("raw_line", upload.RawLine); err != nil {
+			return LogData{}, err
+		}
+		// 解析规则按租户应用登记，先限定应用 ID 再解析
+		appID, err := resolveApplicationID(c, upload.ApplicationID)
+		if err != nil {
+			return LogData{}, err
+		}
+		entry := s.rawLineEntry(upload, appID, now)
+		entry.Source = s.requestSourceIP(c)
+		return entry, nil
+	}
+
+	var entry LogData
+	if binding.JSON.BindBody(data, &entry) != nil {
+		return LogData{}, errInvalidUpload
+	}
+	if err := s.uploadLimits.checkEntry(entry); err != nil {
+		return LogData{}, err
+	}
+	appID, err := resolveApplicationID(c, entry.ApplicationID)
+	if err != nil {
+		return LogData{}, err
+	}
+	entry.ApplicationID = appID
+	if err := s.checkUploadTimestamp(&entry, now); err != nil {
+		return LogData{}, err
+	}
+	entry.Source = s.requestSourceIP(c)
+	return entry, nil
+}
+
+// 解析原始行，推断出的时间戳无效（如解析规则没有给出布局）时使用 now
+func (s *Service) rawLineEntry(u RawLineUpload, applicationID string, now time.Time) LogData {
+	entry := s.parseRawLine(applicationID, u.RawLine, now)
+	if !validTimestamp(entry.Timestamp) {
+		entry.Timestamp = now.Format(time.RFC3339Nano)
+	}
+	for k, v := range u.Fields {
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string, len(u.Fields))
+		}
+		entry.Fields[k] = v
+	}
+	return entry
+}
+
+// 批量上传接口，请求体为日志对象数组，任何一条校验失败时整批拒绝；partial=true 时见 partialBatchUpload
+func (s *Service) logBatchUploadHandler(c *gin.Context) {
+	body, ok := s.readUploadBody(c)
+	if !ok {
+		return
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	if len(items) == 0 || len(items) > maxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Batch must contain 1 to %d entries", maxBatchSize)})
+		return
+	}
+	if c.Query("partial") == "true" {
+		s.partialBatchUpload(c, items)
+		return
+	}
+	batch := make([]LogData, len(items))
+	now := time.Now()
+	for i, item := range items {
+		entry, ok, err := s.decodeUploadEntry(c, item, now)
+		if !ok || fieldTooLong(c, err, fmt.Sprintf("Entry %d: ", i)) {
+			return
+		}
+		if errors.Is(err, errInvalidTimestamp) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Entry %d has an invalid timestamp%s", i, timestampMismatch(err))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Entry %d is missing required fields", i)})
+			return
+		}
+		batch[i] = entry
+	}
+
+	ids, duplicates, dropped, ok := s.ingestUploaded(c, batch)
+	if !ok {
+		return
+	}
+
+	auditCount(c, len(batch)-duplicates-dropped)
+	c.JSON(http.StatusOK, gin.H{"message": "Logs uploaded successfully", "accepted": len(batch), "duplicates": duplicates, "dropped": dropped, "ids": ids})
+}
+
+// 纯文本上传接口：请求体为原始日志行（如 Seata TC 日志），由服务端解析时间、级别、线程、logger 和 XID，
+// 以空白或 "at " 开头的行视为上一条日志的延续（异常堆栈）
+func (s *Service) logRawUploadHandler(c *gin.Context) {
+	applicationID := c.Query("application_id")
+	if applicationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id is required"})
+		return
+	}
+	applicationID, ok := scopedApplicationID(c, applicationID)
+	if !ok {
+		return
+	}
+
+	body, ok := s.readUploadBody(c)
+	if !ok {
+		return
+	}
+
+	entries := s.parseRawLines(applicationID, string(body), time.Now())
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No log lines in request body"})
+		return
+	}
+	for i := range entries {
+		if fieldTooLong(c, s.uploadLimits.checkEntry(entries[i]), fmt.Sprintf("Entry %d: ", i)) {
+			return
+		}
+	}
+	source := s.requestSourceIP(c)
+	for i := range entries {
+		entries[i].Source = source
+	}
+	ids, duplicates, dropped, ok := s.ingestUploaded(c, entries)
+	if !ok {
+		return
+	}
+
+	auditCount(c, len(entries)-duplicates-dropped)
+	c.JSON(http.StatusOK, gin.H{"message": "Logs uploaded successfully", "accepted": len(entries), "duplicates": duplicates, "dropped": dropped, "ids": ids})
+}
+
+// 经写入工作池写入上传的一批日志，按顺序返回分配的 ID（重复和被丢弃的为 0）。
+// 遇到其他错误时停止并写出失败的响应，ok 为 false
+func (s *Service) ingestUploaded(c *gin.Context, entries []LogData) (ids []int64, duplicates, dropped int, ok bool) {
+	results, err := s.tryIngestEntries(entries)
+	if err != nil {
+		s.ingestFailed(c, err, 0)
+		return nil, 0, 0, false
+	}
+	ids = make([]int64, 0, len(entries))
+	for i, r := range results {
+		if errors.Is(r.Err, errDuplicateEntry) {
+			duplicates++
+		} else if errors.Is(r.Err, errDroppedEntry) {
+			dropped++
+		} else if r.Err != nil {
+			s.ingestFailed(c, r.Err, i)
+			return nil, 0, 0, false
+		}
+		ids = append(ids, r.ID)
+	}
+	return ids, duplicates, dropped, true
+}
+
+// 返回写入失败的响应，accepted 为失败前已写入的条数
+func (s *Service) ingestFailed(c *gin.Context, err error, accepted int) {
+	class := classifyIngestError(err)
+	body := gin.H{"error": class.message, "accepted": accepted}
+	switch {
+	case errors.Is(err, errIngestQueueFull):
+		s.setBackpressureHeaders(c)
+	case errors.Is(err, errInvalidTimestamp):
+		body["error"] = class.message + timestampMismatch(err)
+	case errors.Is(err, errSchemaViolation):
+		body["violation"] = schemaViolation(err)
+	}
+	c.JSON(class.status, body)
+}
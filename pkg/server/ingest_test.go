@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 经完整的中间件和写入流程处理 /upload/batch，每批 100 条 loadgen 生成的 200 字节消息
+func BenchmarkUploadBatch(b *testing.B) {
+	router := newTestRouter(b, openTestService(b, b.TempDir()))
+	apps := benchmarkLoadgenApps()
+	gen := newLoadgenMessages(loadgenConfig{messageBytes: 200, errorRatio: 0.05})
+	const batch = 100
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		body, err := json.Marshal(gen.batch(apps[i%len(apps):i%len(apps)+1], batch))
+		if err != nil {
+			b.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/upload/batch", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+	b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "entries/s")
+	b.ReportMetric(float64(b.Elapsed().Microseconds())/float64(b.N*batch), "us/entry")
+}
+
+// 一批中不同应用的日志进入各自的分片；整批写入时某条出错，排在后面的其他分片的日志也不再写入
+func TestIngestPoolSplitsMixedBatches(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	pool, err := s.newIngestPool(IngestConfig{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	a, b := "orders", "payments"
+	for i := 0; pool.shardOf(a) == pool.shardOf(b); i++ {
+		b = fmt.Sprintf("payments%d", i)
+	}
+
+	now := time.Now()
+	batch := []LogData{
+		testEntry(a, "INFO", "a1", now),
+		testEntry(b, "INFO", "b1", now),
+		testEntry(a, "INFO", "a2", now.Add(time.Millisecond)),
+	}
+	results, err := pool.Submit(batch, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].ID != 1 || results[1].ID != 1 || results[2].ID != 2 {
+		t.Fatalf("results = %+v, want ids 1, 1, 2 in batch order", results)
+	}
+	if depth, _ := pool.Depth(); depth != 0 {
+		t.Fatalf("depth after the batch = %d", depth)
+	}
+
+	bad := testEntry(b, "INFO", "b2", now)
+	bad.Timestamp = "not a time"
+	batch = []LogData{testEntry(a, "INFO", "a3", now.Add(2*time.Millisecond)), bad, testEntry(a, "INFO", "a4", now.Add(3*time.Millisecond))}
+	if results, err = pool.Submit(batch, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Err != nil || results[1].Err == nil {
+		t.Fatalf("results = %+v, want a3 written and b2 failed", results)
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{a}}); !reflect.DeepEqual(got, []string{"a1", "a2", "a3"}) {
+		t.Fatalf("%s has %q", a, got)
+	}
+	if depth, _ := pool.Depth(); depth != 0 {
+		t.Fatalf("depth after the failed batch = %d", depth)
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/i18n"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// 接收延迟（日志时间到接收时间）监控：按应用记录收到的日志比其自身时间晚了多久，以 ingest_lag_seconds 输出，
+// 采集端积压或卡住时延迟持续升高，超过阈值时告警，不必等到排查问题时才发现日志缺了一段。
+// 只统计上传接口接收的日志，导入和重放死信写入的历史日志不计入
+type IngestLagConfig struct {
+	Threshold Duration `json:"threshold"` // 延迟超过该时长时告警，默认 5m
+	Interval  Duration `json:"interval"`  // 检查间隔，默认 1m
+	Cooldown  Duration `json:"cooldown"`  // 同一应用两次告警的最短间隔，默认 30m
+	Webhook   string   `json:"webhook"`   // 为空时告警只记录在告警事件中
+}
+
+// 告警事件中的规则名
+const ingestLagRuleName = "ingest_lag"
+
+var (
+	ingestLagSeconds   = metrics.gauge("ingest_lag_seconds", "Delay between the timestamp of the freshest entry received in the last check interval and its receipt, by application.")
+	ingestLagMax       = metrics.gauge("ingest_lag_max_seconds", "Largest delay between an entry's timestamp and its receipt in the last check interval, by application.")
+	ingestLastReceived = metrics.gauge("ingest_last_received_timestamp_seconds", "Unix time the last entry of the application was received.")
+	ingestLagAlerts    = metrics.counter("ingest_lag_alerts_total", "Ingest lag alerts fired, by application.")
+)
+
+// 单个应用的延迟
+type ingestLagStatus struct {
+	ApplicationID string    `json:"application_id"`
+	Lag           float64   `json:"lag_seconds"`     // 最近一个检查周期内最新一条日志的延迟
+	MaxLag        float64   `json:"max_lag_seconds"` // 最近一个检查周期内的最大延迟
+	Entries       int       `json:"entries"`         // 最近一个检查周期内收到的日志数
+	LastReceived  time.Time `json:"last_received"`
+	Behind        bool      `json:"behind"` // 延迟超过阈值
+	LastFired     time.Time `json:"last_fired"`
+	EvaluatedAt   time.Time `json:"evaluated_at"`
+}
+
+// 当前检查周期内的累计值
+type lagWindow struct {
+	min, max float64
+	count    int
+	received time.Time
+}
+
+// 按应用统计延迟
+type ingestLagTracker struct {
+	svc    *Service
+	config IngestLagConfig
+
+	mu      sync.Mutex
+	windows map[string]*lagWindow
+	status  map[string]*ingestLagStatus
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (s *Service) newIngestLagTracker(c IngestLagConfig) (*ingestLagTracker, error) {
+	if c.Threshold < 0 || c.Interval < 0 || c.Cooldown < 0 {
+		return nil, fmt.Errorf("threshold, interval and cooldown must not be negative")
+	}
+	if c.Threshold == 0 {
+		c.Threshold = Duration(5 * time.Minute)
+	}
+	if c.Interval == 0 {
+		c.Interval = Duration(time.Minute)
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = Duration(30 * time.Minute)
+	}
+	return &ingestLagTracker{svc: s, config: c, windows: make(map[string]*lagWindow), status: make(map[string]*ingestLagStatus), stop: make(chan struct{})}, nil
+}
+
+// 记录收到的一条日志，时间晚于接收时间（时钟偏差）的按零计
+func (t *ingestLagTracker) Observe(entry LogData, received time.Time) {
+	if t == nil {
+		return
+	}
+	at, ok := parser.ParseTime(entry.Timestamp, received)
+	if !ok {
+		return
+	}
+	lag := max(received.Sub(at).Seconds(), 0)
+	t.mu.Lock()
+	w, ok := t.windows[entry.ApplicationID]
+	if !ok || w.count == 0 {
+		w = &lagWindow{min: lag, max: lag}
+		t.windows[entry.ApplicationID] = w
+	}
+	w.min, w.max = min(w.min, lag), max(w.max, lag)
+	w.count++
+	w.received = received
+	t.mu.Unlock()
+}
+
+// 启动定期检查
+func (t *ingestLagTracker) Start() {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(time.Duration(t.config.Interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				t.runOnce(time.Now())
+			}
+		}
+	}()
+}
+
+// 停止检查
+func (t *ingestLagTracker) Close() error {
+	close(t.stop)
+	t.wg.Wait()
+	return nil
+}
+
+// 结束当前检查周期：更新指标，最新一条日志的延迟仍超过阈值时说明采集端落后，不在冷却期内时告警。
+// 以最新一条而不是全部日志判断，个别补发的旧日志不会触发告警
+func (t *ingestLagTracker) runOnce(now time.Time) {
+	t.mu.Lock()
+	windows := t.windows
+	t.windows = make(map[string]*lagWindow, len(windows))
+	var fire []ingestLagStatus
+	for app, w := range windows {
+		st, ok := t.status[app]
+		if !ok {
+			st = &ingestLagStatus{ApplicationID: app}
+			t.status[app] = st
+		}
+		st.Lag, st.MaxLag, st.Entries, st.LastReceived, st.EvaluatedAt = w.min, w.max, w.count, w.received, now
+		wasBehind := st.Behind
+		st.Behind = w.min > time.Duration(t.config.Threshold).Seconds()
+		if wasBehind && !st.Behind {
+			log.Printf("ingest lag recovered: app=%s lag_s=%.1f", app, st.Lag)
+		}
+		if st.Behind && now.Sub(st.LastFired) >= time.Duration(t.config.Cooldown) {
+			st.LastFired = now
+			fire = append(fire, *st)
+		}
+	}
+	// 本周期没有收到日志的应用只更新检查时间，保留上一次的延迟
+	for app, st := range t.status {
+		if _, ok := windows[app]; !ok {
+			st.Entries, st.EvaluatedAt = 0, now
+		}
+	}
+	t.mu.Unlock()
+
+	for app, w := range windows {
+		ingestLagSeconds.Set(w.min, "application_id", app)
+		ingestLagMax.Set(w.max, "application_id", app)
+		ingestLastReceived.Set(float64(w.received.Unix()), "application_id", app)
+	}
+	for _, st := range fire {
+		ingestLagAlerts.Add(1, "application_id", st.ApplicationID)
+		threshold := time.Duration(t.config.Threshold)
+		t.svc.alertEngine.Fire(AlertEvent{
+			Rule:          ingestLagRuleName,
+			ApplicationID: model.BareApplicationID(st.ApplicationID),
+			Value:         int(st.Lag),
+			Threshold:     int(threshold.Seconds()),
+			LogTime:       now.Add(-time.Duration(st.Lag * float64(time.Second))),
+			FiredAt:       now,
+			text: i18n.Textf("Freshest of %d entries received in the last %s was %s old (threshold %s); the log shipper is falling behind",
+				st.Entries, time.Duration(t.config.Interval), (time.Duration(st.Lag) * time.Second).Round(time.Second), threshold),
+		}, t.config.Webhook)
+	}
+}
+
+// 各应用最近一次检查的结果
+func (t *ingestLagTracker) Statuses() []ingestLagStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]ingestLagStatus, 0, len(t.status))
+	for _, st := range t.status {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 接收延迟状态接口
+func (s *Service) ingestLagHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"threshold": s.ingestLag.config.Threshold, "applications": s.ingestLag.Statuses()})
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"errors"
+	"hash/fnv"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 写入工作池：上传的日志按应用 ID 哈希分片，进入有界队列，由每个分片的写入协程按顺序写入。
+// 同一应用的日志总在同一分片中，写入顺序与到达顺序一致；不同应用并行写入，减少对写入锁的争用。
+// 队列满时上传接口返回 503 和 Retry-After，而不是堆积无限多的请求
+type IngestConfig struct {
+	Workers   int `json:"workers"`    // 写入协程（分片）数，默认为 CPU 数
+	QueueSize int `json:"queue_size"` // 全部分片排队等待写入的日志总数上限，默认 10000
+}
+
+var errIngestQueueFull = errors.New("ingest queue is full")
+
+var (
+	ingestQueueDepth    = metrics.gauge("ingest_queue_depth", "Log entries queued or being written by the ingest workers.")
+	ingestQueueRejected = metrics.counter("ingest_queue_rejected_total", "Uploads rejected because the ingest queue was full.")
+)
+
+// 一条日志的写入结果
+type ingestResult struct {
+	ID  int64
+	Err error
+}
+
+// 一次提交的日志，由同一个写入协程依次写入
+type ingestJob struct {
+	entries []LogData
+	each    bool // 出错后继续写入后面的日志
+	results []ingestResult
+	done    chan struct{}
+}
+
+type ingestPool struct {
+	svc      *Service
+	shards   []chan *ingestJob
+	depth    []atomic.Int64 // 各分片排队和写入中的日志条数
+	capacity int64          // 每个分片的日志条数上限
+	total    atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func (s *Service) newIngestPool(c IngestConfig) (*ingestPool, error) {
+	if c.Workers < 0 || c.QueueSize < 0 {
+		return nil, errors.New("workers and queue_size must not be negative")
+	}
+	workers := c.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	size := c.QueueSize
+	if size == 0 {
+		size = 10000
+	}
+	capacity := (size + workers - 1) / workers
+	p := &ingestPool{svc: s, shards: make([]chan *ingestJob, workers), depth: make([]atomic.Int64, workers), capacity: int64(capacity)}
+	for i := range p.shards {
+		p.shards[i] = make(chan *ingestJob, capacity)
+		p.wg.Add(1)
+		go p.work(i)
+	}
+	return p, nil
+}
+
+func (p *ingestPool) work(shard int) {
+	defer p.wg.Done()
+	for job := range p.shards[shard] {
+		job.results = p.svc.writeEntries(job.entries, job.each)
+		p.depth[shard].Add(-int64(len(job.entries)))
+		ingestQueueDepth.Set(float64(p.total.Add(-int64(len(job.entries)))))
+		close(job.done)
+	}
+}
+
+// 提交一组日志并等待写入完成。wait 为 false 时队列已满立即返回 errIngestQueueFull，
+// 分片空闲时超过上限的一批日志仍然接受；each 见 writeEntries。停机后直接在调用方写入。
+// 一批中不同应用的日志各自进入所属的分片，保持同一应用的日志总由同一个写入协程按顺序写入
+func (p *ingestPool) Submit(entries []LogData, wait, each bool) ([]ingestResult, error) {
+	if len(entries) == 0 {
+		return p.svc.writeEntries(entries, each), nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return p.svc.writeEntries(entries, each), nil
+	}
+	parts := p.split(entries, each)
+	if !p.reserve(parts, wait) {
+		ingestQueueRejected.Add(1)
+		return nil, errIngestQueueFull
+	}
+
+	if each {
+		// 各分片并行写入，结果按原顺序排列
+		jobs := make([]*ingestJob, len(parts))
+		for i, part := range parts {
+			jobs[i] = p.enqueue(part, true)
+		}
+		if len(parts) == 1 {
+			<-jobs[0].done
+			return jobs[0].results, nil
+		}
+		results := make([]ingestResult, len(entries))
+		for i, job := range jobs {
+			<-job.done
+			for j, r := range job.results {
+				results[parts[i].index[j]] = r
+			}
+		}
+		return results, nil
+	}
+
+	// 相邻的同分片日志为一段，依次写入，某条出错时不再写入后面的段，与逐条写入的结果相同
+	var results []ingestResult
+	for i, part := range parts {
+		job := p.enqueue(part, false)
+		<-job.done
+		results = append(results, job.results...)
+		if last := job.results[len(job.results)-1]; stopsBatch(last.Err) {
+			p.release(parts[i+1:])
+			break
+		}
+	}
+	return results, nil
+}
+
+// 一批日志中进入同一分片的部分，index 为各条日志在批次中的位置，整批在一个分片时为 nil
+type ingestPart struct {
+	shard   int
+	entries []LogData
+	index   []int
+}
+
+func (p *ingestPool) shardOf(applicationID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(applicationID))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+// 按应用所属的分片拆分一批日志。each 时每个分片一部分，否则按相邻的同分片日志分段
+func (p *ingestPool) split(entries []LogData, each bool) []ingestPart {
+	shards := make([]int, len(entries))
+	single := true
+	for i := range entries {
+		shards[i] = p.shardOf(entries[i].ApplicationID)
+		single = single && shards[i] == shards[0]
+	}
+	if single {
+		return []ingestPart{{shard: shards[0], entries: entries}}
+	}
+
+	var parts []ingestPart
+	for i, shard := range shards {
+		k := len(parts) - 1
+		if each {
+			for k >= 0 && parts[k].shard != shard {
+				k--
+			}
+		}
+		if k < 0 || parts[k].shard != shard {
+			parts = append(parts, ingestPart{shard: shard})
+			k = len(parts) - 1
+		}
+		parts[k].entries = append(parts[k].entries, entries[i])
+		parts[k].index = append(parts[k].index, i)
+	}
+	return parts
+}
+
+// 为各部分预留所属分片的深度。wait 为 false 时任一分片放不下则整批拒绝，不预留
+func (p *ingestPool) reserve(parts []ingestPart, wait bool) bool {
+	if !wait {
+		for _, part := range parts {
+			// 同一分片可能有多段，按合计的条数判断
+			n := int64(0)
+			for _, other := range parts {
+				if other.shard == part.shard {
+					n += int64(len(other.entries))
+				}
+			}
+			if d := p.depth[part.shard].Load(); d > 0 && d+n > p.capacity {
+				return false
+			}
+		}
+	}
+	for _, part := range parts {
+		n := int64(len(part.entries))
+		p.depth[part.shard].Add(n)
+		ingestQueueDepth.Set(float64(p.total.Add(n)))
+	}
+	return true
+}
+
+// 释放未写入的部分预留的深度
+func (p *ingestPool) release(parts []ingestPart) {
+	for _, part := range parts {
+		n := int64(len(part.entries))
+		p.depth[part.shard].Add(-n)
+		ingestQueueDepth.Set(float64(p.total.Add(-n)))
+	}
+}
+
+// 将一部分日志交给所属分片的写入协程。深度已经预留，通道满时只需等待写入协程取走排在前面的任务
+func (p *ingestPool) enqueue(part ingestPart, each bool) *ingestJob {
+	job := &ingestJob{entries: part.entries, each: each, done: make(chan struct{})}
+	p.shards[part.shard] <- job
+	return job
+}
+
+// 排队和写入中的日志条数及上限
+func (p *ingestPool) Depth() (int64, int64) {
+	if p == nil {
+		return 0, 0
+	}
+	return p.total.Load(), p.capacity * int64(len(p.shards))
+}
+
+// 写完队列中的日志后停止写入协程
+func (p *ingestPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	for _, ch := range p.shards {
+		close(ch)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+// 依次写入一组日志，遇到重复和被丢弃以外的错误时停止，返回已尝试写入的结果；
+// each 为 true 时每条日志各自写入，出错后继续，结果与 entries 一一对应
+func (s *Service) writeEntries(entries []LogData, each bool) []ingestResult {
+	results := make([]ingestResult, 0, len(entries))
+	for _, entry := range entries {
+		id, err := s.ingestOne(entry)
+		results = append(results, ingestResult{ID: id, Err: err})
+		if !each && stopsBatch(err) {
+			break
+		}
+	}
+	return results
+}
+
+// 整批写入时遇到后停止的错误：重复和被丢弃的日志不算失败
+func stopsBatch(err error) bool {
+	return err != nil && !errors.Is(err, errDuplicateEntry) && !errors.Is(err, errDroppedEntry)
+}
+
+// 经写入工作池写入一组日志，见 Submit；工作池尚未创建时直接在调用方写入
+func (s *Service) submitEntries(entries []LogData, wait, each bool) ([]ingestResult, error) {
+	if s.ingestWorkers == nil {
+		return s.writeEntries(entries, each), nil
+	}
+	return s.ingestWorkers.Submit(entries, wait, each)
+}
+
+// 经写入工作池写入一条日志，队列满时等待，用于导入、forward 和 syslog 等输入
+func (s *Service) ingestEntry(entry LogData) (int64, error) {
+	results, _ := s.submitEntries([]LogData{entry}, true, false)
+	return results[0].ID, results[0].Err
+}
+
+// 上传接口经写入工作池写入一条日志，队列满时返回 errIngestQueueFull
+func (s *Service) tryIngestEntry(entry LogData) (int64, error) {
+	results, err := s.submitEntries([]LogData{entry}, false, false)
+	if err != nil {
+		return 0, err
+	}
+	return results[0].ID, results[0].Err
+}
+
+// 上传接口经写入工作池写入一批日志，队列满时整批拒绝
+func (s *Service) tryIngestEntries(entries []LogData) ([]ingestResult, error) {
+	return s.submitEntries(entries, false, false)
+}
+
+// 同 tryIngestEntries，但一条日志出错不影响后面的日志，用于部分成功的批量上传
+func (s *Service) tryIngestEach(entries []LogData) ([]ingestResult, error) {
+	return s.submitEntries(entries, false, true)
+}
+
+// 队列满时的响应头，带上队列深度供客户端调整发送速率
+func (s *Service) setBackpressureHeaders(c *gin.Context) {
+	depth, capacity := s.ingestWorkers.Depth()
+	c.Header("Retry-After", "1")
+	c.Header("X-Ingest-Queue-Depth", strconv.FormatInt(depth, 10))
+	c.Header("X-Ingest-Queue-Capacity", strconv.FormatInt(capacity, 10))
+}
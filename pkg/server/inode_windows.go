@@ -0,0 +1,10 @@
+//go:build windows
+
+package server
+
+import "os"
+
+// Windows 上不依赖 inode，只通过文件截断识别轮转
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
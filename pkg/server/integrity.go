@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 存储完整性检查：找出分段中无法解析的行和无法完整读取的分段（如截断的 .gz）。
+// 手工编辑或写入中途崩溃留下的坏行在查询时被静默跳过，压缩数据损坏时查询会在文件中途出错。
+// 隔离时原分段移到应用目录下的 .quarantine 目录，再用其中可以解析的行重写该分段
+const quarantineDir = ".quarantine"
+
+// 每个分段最多返回的坏行示例
+const maxIntegritySamples = 10
+
+// 一个无法解析的行
+type badLine struct {
+	Offset int64  `json:"offset"`
+	Line   string `json:"line"` // 最多 200 个字符
+}
+
+// 单个分段的检查结果
+type segmentCheck struct {
+	ApplicationID string    `json:"application_id"`
+	File          string    `json:"file"`
+	Lines         int       `json:"lines"`
+	BadLines      int       `json:"bad_lines"`
+	Samples       []badLine `json:"samples,omitempty"`
+	Error         string    `json:"error,omitempty"`       // 分段无法完整读取
+	Quarantined   string    `json:"quarantined,omitempty"` // 隔离后原分段在 .quarantine 下的文件名
+	Kept          int       `json:"kept,omitempty"`        // 隔离后重写的分段中保留的行数
+}
+
+func (chk segmentCheck) damaged() bool {
+	return chk.BadLines > 0 || chk.Error != ""
+}
+
+// 检查结果汇总
+type integrityReport struct {
+	Applications int            `json:"applications"`
+	Segments     int            `json:"segments"`
+	Skipped      int            `json:"skipped"` // 已分层到对象存储的分段不检查
+	Lines        int            `json:"lines"`
+	Damaged      []segmentCheck `json:"damaged"`
+}
+
+// 是否为文件头行
+func isFormatHeader(line string) bool {
+	var h formatHeader
+	return json.Unmarshal([]byte(line), &h) == nil && h.Format == formatName
+}
+
+// 逐行检查分段，空行和文件头不计入
+func (s *Service) checkSegment(applicationID, name string) segmentCheck {
+	chk := segmentCheck{ApplicationID: applicationID, File: name}
+	path := filepath.Join(s.applicationDir(applicationID), name)
+	_, err := s.scanFileLines(context.Background(), path, 0, func(line string, offset, next int64) bool {
+		if strings.TrimSpace(line) == "" || (offset == 0 && isFormatHeader(line)) {
+			return true
+		}
+		chk.Lines++
+		if _, err := parseLogLine(line); err != nil {
+			chk.BadLines++
+			if len(chk.Samples) < maxIntegritySamples {
+				chk.Samples = append(chk.Samples, badLine{Offset: offset, Line: truncateUTF8(line, 200)})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		chk.Error = err.Error()
+	}
+	return chk
+}
+
+// 分段只剩对象存储中的副本
+func segmentOnlyTiered(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return false
+	}
+	if p, _ := compressedSegmentPath(path); p != "" {
+		return false
+	}
+	_, err := os.Stat(path + tieredSuffix)
+	return err == nil
+}
+
+// 隔离损坏的分段：先写出只含可解析行的新分段，再将原文件移入 .quarantine，期间阻塞该应用的写入。
+// 没有可保留的行时不再生成新分段
+func (s *Service) quarantineSegment(chk *segmentCheck) error {
+	gate := s.backends.WriteGate(chk.ApplicationID)
+	gate.Lock()
+	defer gate.Unlock()
+
+	dir := s.applicationDir(chk.ApplicationID)
+	path := filepath.Join(dir, chk.File)
+	src := path
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		if p, _ := compressedSegmentPath(path); p != "" {
+			src = p
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, quarantineDir), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp := path + ".repair.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	kept := 0
+	// 读取错误之前的内容照常保留，压缩分段重写为普通文件
+	s.scanFileLines(context.Background(), path, 0, func(line string, offset, next int64) bool {
+		if offset == 0 && isFormatHeader(line) {
+			w.WriteString(line + "\n")
+			return true
+		}
+		if _, err := parseLogLine(line); err == nil {
+			// 读取时已解密，按应用当前的密钥重新加密
+			record, err := s.encryption.Seal(chk.ApplicationID, path, line+"\n")
+			if err != nil {
+				return true
+			}
+			w.WriteString(record)
+			kept++
+		}
+		return true
+	})
+	err = w.Flush()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	chk.Quarantined = time.Now().Format("20060102T150405") + "-" + filepath.Base(src)
+	if err := os.Rename(src, filepath.Join(dir, quarantineDir, chk.Quarantined)); err != nil {
+		os.Remove(tmp)
+		chk.Quarantined = ""
+		return err
+	}
+	if kept == 0 {
+		os.Remove(tmp)
+	} else if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	chk.Kept = kept
+
+	// 分段内容变了，丢弃缓存的查询结果和计数
+	s.queryCache.Invalidate(path)
+	s.histogramCounts.Forget(chk.ApplicationID, chk.File)
+	s.xidBlooms.Forget(chk.ApplicationID, chk.File)
+	log.Printf("quarantined damaged segment: app=%s file=%s bad_lines=%d kept=%d", chk.ApplicationID, chk.File, chk.BadLines, kept)
+	return nil
+}
+
+// 检查一组应用的分段，from 不为零时只检查可能包含 from 之后日志的分段
+func (s *Service) checkIntegrity(apps []string, from time.Time, quarantine bool) (integrityReport, error) {
+	report := integrityReport{Damaged: []segmentCheck{}}
+	for _, app := range apps {
+		if _, bc, _ := s.backends.Store(s.backends.BackendOf(app)); bc.Type != "file" {
+			continue
+		}
+		dir := s.applicationDir(app)
+		names, err := listSegments(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		report.Applications++
+		for _, name := range names {
+			if !segmentInRange(name, nil, from, time.Time{}) {
+				continue
+			}
+			if segmentOnlyTiered(filepath.Join(dir, name)) {
+				report.Skipped++
+				continue
+			}
+			chk := s.checkSegment(app, name)
+			report.Segments++
+			report.Lines += chk.Lines
+			if !chk.damaged() {
+				continue
+			}
+			if quarantine {
+				if err := s.quarantineSegment(&chk); err != nil {
+					return report, err
+				}
+			}
+			report.Damaged = append(report.Damaged, chk)
+		}
+	}
+	return report, nil
+}
+
+// 完整性检查接口：GET 只报告，POST /admin/integrity/quarantine 同时隔离并修复损坏的分段。
+// application_id 为空时检查全部应用，指定 from 时只检查较新的分段
+func (s *Service) integrityHandler(quarantine bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apps, ok := s.requestApplications(c)
+		if !ok {
+			return
+		}
+		from, _, ok := parseTimeRange(c)
+		if !ok {
+			return
+		}
+		report, err := s.checkIntegrity(apps, from, quarantine)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to check application logs: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,356 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 按 cron 表达式定期执行的分析任务
+type JobConfig struct {
+	Name         string   `json:"name"`
+	Task         string   `json:"task"`         // index_rebuild、stats_rollup、report 或 anomaly_scan
+	Schedule     string   `json:"schedule"`     // cron 表达式
+	TZ           string   `json:"tz"`           // 匹配 schedule 的时区，默认本地时区
+	Applications []string `json:"applications"` // index_rebuild、stats_rollup 处理的应用，为空时为全部非租户应用
+	Report       string   `json:"report"`       // report 任务生成的报告，对应 reports 中的名称
+	Full         bool     `json:"full"`         // index_rebuild 丢弃已有计数和 XID 过滤器重新读取全部分段，默认只补读索引之后追加的部分
+}
+
+// 可在 jobs 中引用的任务，返回值为本次执行的结果摘要
+type jobTask func(s *Service, c JobConfig, at time.Time) (interface{}, error)
+
+var jobTasks = map[string]jobTask{
+	"index_rebuild": (*Service).indexRebuildTask,
+	"stats_rollup":  (*Service).statsRollupTask,
+	"report":        (*Service).reportTask,
+	"anomaly_scan":  (*Service).anomalyScanTask,
+}
+
+// 任务的执行状态，持久化在 data_dir/jobs.json，重启后保留上次执行的结果
+type jobStatus struct {
+	Name       string      `json:"name"`
+	Task       string      `json:"task"`
+	Schedule   string      `json:"schedule"`
+	Running    bool        `json:"running"`
+	NextRun    *time.Time  `json:"next_run,omitempty"`
+	LastStart  *time.Time  `json:"last_start,omitempty"`
+	DurationMS float64     `json:"duration_ms"` // 上次执行的耗时
+	LastError  string      `json:"last_error,omitempty"`
+	LastResult interface{} `json:"last_result,omitempty"`
+	Runs       int         `json:"runs"`
+	Failures   int         `json:"failures"`
+	Skipped    int         `json:"skipped"` // 到点时上次执行尚未结束而跳过的次数
+}
+
+type scheduledJob struct {
+	config   JobConfig
+	task     jobTask
+	schedule *cronSchedule
+	loc      *time.Location
+	status   *jobStatus
+}
+
+var jobRuns = metrics.counter("job_runs_total", "Scheduled job runs, by job and result.")
+
+var errJobNotFound = errors.New("job not found")
+var errJobRunning = errors.New("job is already running")
+
+// 任务调度器：每分钟检查一次 schedule，同一任务不会重叠执行
+type jobScheduler struct {
+	svc  *Service
+	path string
+	jobs map[string]*scheduledJob
+
+	mu sync.Mutex // 保护任务状态
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (s *Service) newJobScheduler(dataDir string, configs []JobConfig) (*jobScheduler, error) {
+	sched := &jobScheduler{
+		svc:  s,
+		path: filepath.Join(dataDir, "jobs.json"),
+		jobs: make(map[string]*scheduledJob),
+		stop: make(chan struct{}),
+	}
+	saved := make(map[string]*jobStatus)
+	if err := loadJSONFile(sched.path, &saved); err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if !validApplicationID(c.Name) {
+			return nil, fmt.Errorf("invalid job name %q", c.Name)
+		}
+		if _, ok := sched.jobs[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate job %q", c.Name)
+		}
+		task, ok := jobTasks[c.Task]
+		if !ok {
+			return nil, fmt.Errorf("job %s: unknown task %q (expected index_rebuild, stats_rollup, report or anomaly_scan)", c.Name, c.Task)
+		}
+		switch {
+		case c.Task == "report" && s.reports.jobs[c.Report] == nil:
+			return nil, fmt.Errorf("job %s: report %q is not configured", c.Name, c.Report)
+		case c.Task == "anomaly_scan" && s.anomalies == nil:
+			return nil, fmt.Errorf("job %s: anomaly_scan requires anomaly.enabled", c.Name)
+		}
+		schedule, err := parseCron(c.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", c.Name, err)
+		}
+		loc := time.Local
+		if c.TZ != "" {
+			if loc, err = time.LoadLocation(c.TZ); err != nil {
+				return nil, fmt.Errorf("job %s: %w", c.Name, err)
+			}
+		}
+		status := saved[c.Name]
+		if status == nil || status.Task != c.Task {
+			status = &jobStatus{}
+		}
+		status.Name, status.Task, status.Schedule, status.Running = c.Name, c.Task, c.Schedule, false
+		sched.jobs[c.Name] = &scheduledJob{config: c, task: task, schedule: schedule, loc: loc, status: status}
+	}
+	return sched, nil
+}
+
+// 启动调度，每到整分钟检查一次
+func (s *jobScheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			now := time.Now()
+			timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case at := <-timer.C:
+				at = at.Truncate(time.Minute)
+				for _, name := range sortedKeys(s.jobs) {
+					job := s.jobs[name]
+					if !job.schedule.Matches(at.In(job.loc)) {
+						continue
+					}
+					if !s.begin(job) {
+						log.Printf("job %s skipped: previous run still in progress", name)
+						continue
+					}
+					s.wg.Add(1)
+					go func() {
+						defer s.wg.Done()
+						s.run(job, at)
+					}()
+				}
+			}
+		}
+	}()
+}
+
+// 停机时等待正在执行的任务完成
+func (s *jobScheduler) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	return nil
+}
+
+// 标记任务开始执行，上次执行尚未结束时返回 false
+func (s *jobScheduler) begin(job *scheduledJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.status.Running {
+		job.status.Skipped++
+		jobRuns.Add(1, "job", job.config.Name, "result", "skipped")
+		return false
+	}
+	job.status.Running = true
+	return true
+}
+
+// 执行任务并记录结果，调用前须已通过 begin 标记
+func (s *jobScheduler) run(job *scheduledJob, at time.Time) {
+	started := time.Now()
+	result, err := job.task(s.svc, job.config, at)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := job.status
+	st.Running = false
+	st.LastStart = &started
+	st.DurationMS = durationMS(time.Since(started))
+	st.LastResult = result
+	st.Runs++
+	st.LastError = ""
+	if err != nil {
+		st.Failures++
+		st.LastError = err.Error()
+		jobRuns.Add(1, "job", job.config.Name, "result", "error")
+		log.Printf("job %s failed: %v", job.config.Name, err)
+	} else {
+		jobRuns.Add(1, "job", job.config.Name, "result", "ok")
+	}
+	statuses := make(map[string]*jobStatus, len(s.jobs))
+	for name, j := range s.jobs {
+		statuses[name] = j.status
+	}
+	if err := saveJSONFile(s.path, statuses); err != nil {
+		log.Printf("unable to save job status: %v", err)
+	}
+}
+
+// 立即执行一个任务，等待执行结束
+func (s *jobScheduler) Run(name string) (jobStatus, error) {
+	job, ok := s.jobs[name]
+	if !ok {
+		return jobStatus{}, errJobNotFound
+	}
+	if !s.begin(job) {
+		return jobStatus{}, errJobRunning
+	}
+	s.run(job, time.Now().Truncate(time.Minute))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *job.status, nil
+}
+
+// 全部任务的状态，按名称排序
+func (s *jobScheduler) Statuses(now time.Time) []jobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]jobStatus, 0, len(s.jobs))
+	for _, name := range sortedKeys(s.jobs) {
+		job := s.jobs[name]
+		st := *job.status
+		st.NextRun = job.schedule.Next(now.In(job.loc))
+		list = append(list, st)
+	}
+	return list
+}
+
+// 下一次满足表达式的时间，一年内没有时返回 nil
+func (s *cronSchedule) Next(after time.Time) *time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(1, 0, 0); t.Before(end); t = t.Add(time.Minute) {
+		if s.Matches(t) {
+			return &t
+		}
+	}
+	return nil
+}
+
+// 任务处理的应用
+func (s *Service) jobApplications(c JobConfig) ([]string, error) {
+	if len(c.Applications) > 0 {
+		return c.Applications, nil
+	}
+	return s.listApplications()
+}
+
+// 更新各应用的计数索引，full 时丢弃已有计数和 XID 过滤器重新读取全部分段，之后的统计和直方图查询不必再补读
+func (s *Service) indexRebuildTask(c JobConfig, at time.Time) (interface{}, error) {
+	apps, err := s.jobApplications(c)
+	if err != nil {
+		return nil, err
+	}
+	segments := 0
+	var failed []string
+	for _, app := range apps {
+		// 不以本地目录存放日志的后端没有计数索引
+		if _, ok := s.queryStoreOf(app); ok {
+			continue
+		}
+		if c.Full {
+			if err := s.rebuildApplicationIndexes(context.Background(), app); err != nil {
+				failed = append(failed, app)
+				continue
+			}
+		}
+		err := s.histogramCounts.View(app, time.Now(), func(s map[string]*segmentCounts) { segments += len(s) })
+		if err != nil {
+			failed = append(failed, app)
+		}
+	}
+	result := gin.H{"applications": len(apps), "segments": segments}
+	if len(failed) > 0 {
+		result["failed"] = failed
+		return result, fmt.Errorf("unable to index %d applications", len(failed))
+	}
+	return result, nil
+}
+
+// 汇总各应用的日志条数和级别分布
+func (s *Service) statsRollupTask(c JobConfig, at time.Time) (interface{}, error) {
+	apps, err := s.jobApplications(c)
+	if err != nil {
+		return nil, err
+	}
+	total, levels := 0, make(map[string]int)
+	var failed []string
+	for _, app := range apps {
+		st, err := s.collectApplicationStats(app)
+		if err != nil {
+			failed = append(failed, app)
+			continue
+		}
+		total += st.Total
+		for level, n := range st.Levels {
+			levels[level] += n
+		}
+	}
+	result := gin.H{"applications": len(apps), "total": total, "levels": levels}
+	if len(failed) > 0 {
+		result["failed"] = failed
+		return result, fmt.Errorf("unable to collect stats for %d applications", len(failed))
+	}
+	return result, nil
+}
+
+// 生成 reports 中配置的报告
+func (s *Service) reportTask(c JobConfig, at time.Time) (interface{}, error) {
+	report, err := s.reports.Run(c.Report, at)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"report_id": report.ID, "applications": len(report.Applications)}, nil
+}
+
+// 执行一次错误量异常检测，结果见 /alerts/anomalies
+func (s *Service) anomalyScanTask(c JobConfig, at time.Time) (interface{}, error) {
+	s.anomalies.runOnce(time.Now())
+	anomalous := 0
+	statuses := s.anomalies.Statuses()
+	for _, st := range statuses {
+		if st.Anomalous {
+			anomalous++
+		}
+	}
+	return gin.H{"applications": len(statuses), "anomalous": anomalous}, nil
+}
+
+// 任务状态接口
+func (s *Service) jobListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.jobs.Statuses(time.Now()))
+}
+
+// 立即执行任务
+func (s *Service) jobRunHandler(c *gin.Context) {
+	status, err := s.jobs.Run(c.Param("name"))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not configured"})
+	case errors.Is(err, errJobRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": "Job is already running"})
+	default:
+		c.JSON(http.StatusOK, status)
+	}
+}
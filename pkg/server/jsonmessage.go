@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"logAnalysis/pkg/model"
+)
+
+// JSON 消息解析：服务以结构化方式输出日志时 log_message 本身就是一个 JSON 对象，写入前把其中的键展开为自定义字段
+// （嵌套对象为以点分隔的键，数组的元素以逗号连接），不必为每个应用登记解析器就能按 field.orderId=123 查询。
+// 消息原样保存，上传时已提供的字段优先；xid、branch_id、trace_id、span_id 未提供时从对应的键中取值
+type JSONMessageConfig struct {
+	Disabled      bool     `json:"disabled"`        // 不解析 JSON 消息
+	Applications  []string `json:"applications"`    // 解析的应用（支持通配符），为空时为全部应用
+	MaxFields     int      `json:"max_fields"`      // 每条日志最多展开的键数，超过时按键名排序保留，默认 32
+	MaxValueBytes int      `json:"max_value_bytes"` // 单个字段值的最大字节数，超过时截断，默认 1024
+}
+
+var jsonMessagesParsed = metrics.counter("json_messages_parsed_total", "Entries whose JSON log_message was expanded into fields.")
+
+// 编译后的配置，为 nil 时不解析
+type jsonMessageParser struct {
+	config JSONMessageConfig
+}
+
+func newJSONMessageParser(c JSONMessageConfig) (*jsonMessageParser, error) {
+	if c.Disabled {
+		return nil, nil
+	}
+	if c.MaxFields < 0 || c.MaxValueBytes < 0 {
+		return nil, fmt.Errorf("max_fields and max_value_bytes must not be negative")
+	}
+	if c.MaxFields == 0 {
+		c.MaxFields = 32
+	}
+	if c.MaxValueBytes == 0 {
+		c.MaxValueBytes = 1024
+	}
+	for _, pattern := range c.Applications {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid application pattern %q", pattern)
+		}
+	}
+	return &jsonMessageParser{config: c}, nil
+}
+
+func (p *jsonMessageParser) matches(applicationID string) bool {
+	if len(p.config.Applications) == 0 {
+		return true
+	}
+	for _, pattern := range p.config.Applications {
+		if ok, _ := path.Match(pattern, model.BareApplicationID(applicationID)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 消息为 JSON 对象时展开为自定义字段，不是 JSON 对象的消息不做处理
+func (p *jsonMessageParser) Apply(entry *LogData) {
+	if p == nil || !p.matches(entry.ApplicationID) {
+		return
+	}
+	msg := bytes.TrimSpace([]byte(entry.LogMessage))
+	if len(msg) < 2 || msg[0] != '{' || msg[len(msg)-1] != '}' {
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil || dec.More() || len(obj) == 0 {
+		return
+	}
+	flat := make(map[string]any, len(obj))
+	flattenLogstash("", obj, flat)
+
+	// 补全 Seata 和追踪上下文，键名与 Java appender 的 MDC 一致
+	for _, f := range []struct {
+		field *string
+		keys  []string
+	}{
+		{&entry.XID, logstashXIDKeys},
+		{&entry.BranchID, logstashBranchKeys},
+		{&entry.TraceID, logstashTraceKeys},
+		{&entry.SpanID, logstashSpanKeys},
+	} {
+		if *f.field != "" {
+			continue
+		}
+		for _, key := range f.keys {
+			if v := logstashString(flat[key]); v != "" {
+				*f.field = v
+				break
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		if _, ok := entry.Fields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	added := 0
+	for _, key := range keys {
+		if added == p.config.MaxFields {
+			break
+		}
+		v := logstashString(flat[key])
+		if v == "" {
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[key] = truncateUTF8(v, p.config.MaxValueBytes)
+		added++
+	}
+	jsonMessagesParsed.Add(1)
+}
@@ -0,0 +1,442 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kafka 输出：直接实现 Kafka 协议中发送消息所需的部分（Metadata v1、Produce v3，RecordBatch v2，不压缩）。
+// 消息值为日志的 JSON，键为应用 ID，按键的哈希选择分区，同一应用的日志在同一分区中保持顺序
+type KafkaOutputConfig struct {
+	Brokers  []string `json:"brokers"`   // 初始 broker 地址，如 kafka-1:9092，从中获取分区的 leader
+	Topic    string   `json:"topic"`     // 主题需要事先创建
+	TLS      bool     `json:"tls"`       // 按输出的 tls 配置以 TLS 连接 broker
+	Acks     int      `json:"acks"`      // 1 表示 leader 写入即确认，-1（默认）表示等待全部同步副本
+	ClientID string   `json:"client_id"` // 默认 log-analysis
+}
+
+// Kafka 协议的 API
+const (
+	kafkaAPIProduce  = 0
+	kafkaAPIMetadata = 3
+)
+
+// 单个响应的最大字节数
+const maxKafkaResponseBytes = 16 << 20
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type kafkaOutput struct {
+	config  KafkaOutputConfig
+	tls     *tls.Config // 为 nil 时明文连接
+	timeout time.Duration
+
+	mu          sync.Mutex
+	conns       map[string]*kafkaConn // broker 地址 → 连接
+	leaders     []string              // 分区 → leader 的地址，为 nil 时需要重新获取
+	correlation int32
+}
+
+type kafkaConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newKafkaOutput(c KafkaOutputConfig, t ClientTLSConfig, timeout time.Duration) (*kafkaOutput, error) {
+	if len(c.Brokers) == 0 || c.Topic == "" {
+		return nil, errors.New("kafka requires brokers and topic")
+	}
+	switch c.Acks {
+	case 0:
+		c.Acks = -1
+	case 1, -1:
+	default:
+		return nil, fmt.Errorf("kafka acks must be 1 or -1")
+	}
+	if c.ClientID == "" {
+		c.ClientID = "log-analysis"
+	}
+	k := &kafkaOutput{config: c, timeout: timeout, conns: make(map[string]*kafkaConn)}
+	if c.TLS {
+		var err error
+		if k.tls, err = buildClientTLSConfig(t); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// 一条待发送的消息
+type kafkaRecord struct {
+	key, value []byte
+}
+
+func (k *kafkaOutput) Send(ctx context.Context, _ string, entries []LogData) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	err := k.send(ctx, entries)
+	if err != nil {
+		// 连接或分区信息可能已失效，下次重新获取
+		k.closeLocked()
+	}
+	return err
+}
+
+func (k *kafkaOutput) send(ctx context.Context, entries []LogData) error {
+	if k.leaders == nil {
+		if err := k.refreshMetadata(ctx); err != nil {
+			return err
+		}
+	}
+
+	// 按分区分组，再按 leader 合并为一个请求
+	byLeader := make(map[string]map[int32][]kafkaRecord)
+	for _, entry := range entries {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		h := fnv.New32a()
+		h.Write([]byte(entry.ApplicationID))
+		partition := int32(h.Sum32() % uint32(len(k.leaders)))
+		leader := k.leaders[partition]
+		if byLeader[leader] == nil {
+			byLeader[leader] = make(map[int32][]kafkaRecord)
+		}
+		byLeader[leader][partition] = append(byLeader[leader][partition], kafkaRecord{key: []byte(entry.ApplicationID), value: value})
+	}
+
+	now := time.Now()
+	for _, leader := range sortedKeys(byLeader) {
+		partitions := byLeader[leader]
+		ids := make([]int32, 0, len(partitions))
+		for id := range partitions {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		var req kafkaEncoder
+		req.int16(-1) // transactional_id
+		req.int16(int16(k.config.Acks))
+		req.int32(int32(k.timeout.Milliseconds()))
+		req.int32(1)
+		req.string(k.config.Topic)
+		req.int32(int32(len(ids)))
+		for _, id := range ids {
+			req.int32(id)
+			req.bytes(encodeRecordBatch(partitions[id], now))
+		}
+		resp, err := k.roundTrip(ctx, leader, kafkaAPIProduce, 3, req.buf)
+		if err != nil {
+			return err
+		}
+		if err := checkProduceResponse(resp); err != nil {
+			return fmt.Errorf("broker %s: %v", leader, err)
+		}
+	}
+	return nil
+}
+
+// 从初始 broker 中的任意一个获取主题各分区的 leader
+func (k *kafkaOutput) refreshMetadata(ctx context.Context) error {
+	var req kafkaEncoder
+	req.int32(1)
+	req.string(k.config.Topic)
+
+	var lastErr error
+	for _, broker := range k.config.Brokers {
+		resp, err := k.roundTrip(ctx, broker, kafkaAPIMetadata, 1, req.buf)
+		if err != nil {
+			lastErr = fmt.Errorf("broker %s: %v", broker, err)
+			continue
+		}
+		leaders, err := parseMetadataResponse(resp, k.config.Topic)
+		if err != nil {
+			return fmt.Errorf("broker %s: %v", broker, err)
+		}
+		k.leaders = leaders
+		return nil
+	}
+	return lastErr
+}
+
+// 发送一个请求并读取响应体
+func (k *kafkaOutput) roundTrip(ctx context.Context, addr string, apiKey, version int16, body []byte) (*kafkaDecoder, error) {
+	c, err := k.conn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+	k.correlation++
+	var req kafkaEncoder
+	req.int32(0) // 长度，稍后填写
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(k.correlation)
+	req.string(k.config.ClientID)
+	req.buf = append(req.buf, body...)
+	binary.BigEndian.PutUint32(req.buf, uint32(len(req.buf)-4))
+	if _, err := c.conn.Write(req.buf); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxKafkaResponseBytes {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, err
+	}
+	resp := &kafkaDecoder{buf: data}
+	if id := resp.int32(); id != k.correlation {
+		return nil, fmt.Errorf("unexpected correlation id %d", id)
+	}
+	return resp, nil
+}
+
+func (k *kafkaOutput) conn(ctx context.Context, addr string) (*kafkaConn, error) {
+	if c, ok := k.conns[addr]; ok {
+		return c, nil
+	}
+	d := net.Dialer{Timeout: k.timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if k.tls != nil {
+		config := k.tls.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		conn = tls.Client(conn, config)
+	}
+	c := &kafkaConn{conn: conn, r: bufio.NewReader(conn)}
+	k.conns[addr] = c
+	return c, nil
+}
+
+func (k *kafkaOutput) closeLocked() {
+	for addr, c := range k.conns {
+		c.conn.Close()
+		delete(k.conns, addr)
+	}
+	k.leaders = nil
+}
+
+func (k *kafkaOutput) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.closeLocked()
+	return nil
+}
+
+// 编码 RecordBatch v2，所有消息使用同一时间戳
+func encodeRecordBatch(records []kafkaRecord, now time.Time) []byte {
+	var recs []byte
+	for i, r := range records {
+		var body []byte
+		body = append(body, 0)                     // attributes
+		body = binary.AppendVarint(body, 0)        // timestamp delta
+		body = binary.AppendVarint(body, int64(i)) // offset delta
+		body = binary.AppendVarint(body, int64(len(r.key)))
+		body = append(body, r.key...)
+		body = binary.AppendVarint(body, int64(len(r.value)))
+		body = append(body, r.value...)
+		body = binary.AppendVarint(body, 0) // headers
+		recs = binary.AppendVarint(recs, int64(len(body)))
+		recs = append(recs, body...)
+	}
+
+	// crc 覆盖从 attributes 开始的全部内容
+	ms := uint64(now.UnixMilli())
+	var tail []byte
+	tail = binary.BigEndian.AppendUint16(tail, 0) // attributes：不压缩，CreateTime
+	tail = binary.BigEndian.AppendUint32(tail, uint32(len(records)-1))
+	tail = binary.BigEndian.AppendUint64(tail, ms)         // first timestamp
+	tail = binary.BigEndian.AppendUint64(tail, ms)         // max timestamp
+	tail = binary.BigEndian.AppendUint64(tail, ^uint64(0)) // producer id -1
+	tail = binary.BigEndian.AppendUint16(tail, ^uint16(0)) // producer epoch -1
+	tail = binary.BigEndian.AppendUint32(tail, ^uint32(0)) // base sequence -1
+	tail = binary.BigEndian.AppendUint32(tail, uint32(len(records)))
+	tail = append(tail, recs...)
+
+	var batch []byte
+	batch = binary.BigEndian.AppendUint64(batch, 0)                       // base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(tail))) // batch length
+	batch = binary.BigEndian.AppendUint32(batch, ^uint32(0))              // partition leader epoch -1
+	batch = append(batch, 2)                                              // magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(tail, castagnoli))
+	return append(batch, tail...)
+}
+
+// 解析 Metadata v1 响应，返回主题各分区 leader 的地址
+func parseMetadataResponse(d *kafkaDecoder, topic string) ([]string, error) {
+	brokers := make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller id
+	var leaders []string
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is_internal
+		var partitions []string
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			partCode := d.int16()
+			index := d.int32()
+			leader := d.int32()
+			for r := d.int32(); r > 0 && d.err == nil; r-- {
+				d.int32()
+			}
+			for r := d.int32(); r > 0 && d.err == nil; r-- {
+				d.int32()
+			}
+			if name != topic {
+				continue
+			}
+			addr, ok := brokers[leader]
+			if partCode != 0 || !ok {
+				return nil, fmt.Errorf("partition %d of topic %s has no leader (error %d)", index, topic, partCode)
+			}
+			for int(index) >= len(partitions) {
+				partitions = append(partitions, "")
+			}
+			partitions[index] = addr
+		}
+		if name != topic {
+			continue
+		}
+		if code != 0 {
+			return nil, fmt.Errorf("topic %s: error %d", topic, code)
+		}
+		leaders = partitions
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(leaders) == 0 {
+		return nil, fmt.Errorf("topic %s has no partitions", topic)
+	}
+	for i, addr := range leaders {
+		if addr == "" {
+			return nil, fmt.Errorf("partition %d of topic %s is missing", i, topic)
+		}
+	}
+	return leaders, nil
+}
+
+// 检查 Produce v3 响应中各分区的错误码
+func checkProduceResponse(d *kafkaDecoder) error {
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.string() // topic
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			index := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 && d.err == nil {
+				return fmt.Errorf("partition %d: error %d", index, code)
+			}
+		}
+	}
+	return d.err
+}
+
+// Kafka 协议的大端编码
+type kafkaEncoder struct {
+	buf []byte
+}
+
+func (e *kafkaEncoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *kafkaEncoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// Kafka 协议的解码，数据不足时记录错误并返回零值
+type kafkaDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errors.New("truncated response")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// 字符串，长度为 -1 的空值返回空串
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// CRC-32C 的标准校验值，见 RFC 3720 B.4
+func TestKafkaCastagnoliCheckValue(t *testing.T) {
+	if got := crc32.Checksum([]byte("123456789"), castagnoli); got != 0xe3069283 {
+		t.Fatalf("crc32c(123456789) = %#08x, want 0xe3069283", got)
+	}
+}
+
+func TestEncodeRecordBatchGoldenBytes(t *testing.T) {
+	batch := encodeRecordBatch([]kafkaRecord{{key: []byte("orders"), value: []byte("{}")}}, time.UnixMilli(1700000000000))
+	want, _ := hex.DecodeString("" +
+		"0000000000000000" + // base offset
+		"00000040" + // batch length
+		"ffffffff" + // partition leader epoch
+		"02" + // magic
+		"fb222884" + // crc32c
+		"0000" + "00000000" + // attributes, last offset delta
+		"0000018bcfe56800" + "0000018bcfe56800" + // first / max timestamp
+		"ffffffffffffffff" + "ffff" + "ffffffff" + // producer id, epoch, base sequence
+		"00000001" + // records
+		"1c" + "00" + "00" + "00" + "0c" + "6f7264657273" + "04" + "7b7d" + "00")
+	if !bytes.Equal(batch, want) {
+		t.Fatalf("record batch\n got %x\nwant %x", batch, want)
+	}
+}
+
+// 解码 RecordBatch v2 并校验 crc，返回各消息的键和值
+func decodeTestRecordBatch(t *testing.T, batch []byte) (keys, values []string) {
+	t.Helper()
+	if len(batch) < 61 || batch[16] != 2 {
+		t.Fatalf("not a v2 record batch: %x", batch)
+	}
+	if n := binary.BigEndian.Uint32(batch[8:]); int(n) != len(batch)-12 {
+		t.Fatalf("batch length %d, have %d bytes", n, len(batch)-12)
+	}
+	if crc := binary.BigEndian.Uint32(batch[17:]); crc != crc32.Checksum(batch[21:], castagnoli) {
+		t.Fatalf("batch crc %#08x does not match its contents", crc)
+	}
+	count := int(binary.BigEndian.Uint32(batch[57:]))
+	recs := batch[61:]
+	varint := func() int64 {
+		v, n := binary.Varint(recs)
+		if n <= 0 {
+			t.Fatalf("malformed varint in %x", recs)
+		}
+		recs = recs[n:]
+		return v
+	}
+	for i := 0; i < count; i++ {
+		varint() // length
+		recs = recs[1:]
+		varint() // timestamp delta
+		if delta := varint(); delta != int64(i) {
+			t.Fatalf("record %d has offset delta %d", i, delta)
+		}
+		n := varint()
+		keys = append(keys, string(recs[:n]))
+		recs = recs[n:]
+		n = varint()
+		values = append(values, string(recs[:n]))
+		recs = recs[n:]
+		varint() // headers
+	}
+	return keys, values
+}
+
+// 只有一个分区的 broker：应答 Metadata v1，把 Produce v3 请求中的 RecordBatch 交给 produced
+func startTestKafkaBroker(t *testing.T, topic string, produced chan<- []byte) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	host, portText, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portText)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return
+			}
+			data := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			req := &kafkaDecoder{buf: data}
+			apiKey, version, correlation := req.int16(), req.int16(), req.int32()
+			req.string() // client id
+
+			var resp kafkaEncoder
+			resp.int32(0)
+			resp.int32(correlation)
+			switch {
+			case apiKey == kafkaAPIMetadata && version == 1:
+				resp.int32(1)
+				resp.int32(0)
+				resp.string(host)
+				resp.int32(int32(port))
+				resp.int16(-1) // rack
+				resp.int32(0)  // controller id
+				resp.int32(1)
+				resp.int16(0)
+				resp.string(topic)
+				resp.buf = append(resp.buf, 0) // is_internal
+				resp.int32(1)
+				resp.int16(0)
+				resp.int32(0) // partition
+				resp.int32(0) // leader
+				resp.int32(0) // replicas
+				resp.int32(0) // isr
+			case apiKey == kafkaAPIProduce && version == 3:
+				req.string() // transactional id
+				req.int16()  // acks
+				req.int32()  // timeout
+				req.int32()  // topics
+				name := req.string()
+				req.int32() // partitions
+				partition := req.int32()
+				produced <- req.next(int(req.int32()))
+				resp.int32(1)
+				resp.string(name)
+				resp.int32(1)
+				resp.int32(partition)
+				resp.int16(0)
+				resp.buf = binary.BigEndian.AppendUint64(resp.buf, 0) // base offset
+				resp.buf = binary.BigEndian.AppendUint64(resp.buf, ^uint64(0))
+				resp.int32(0) // throttle time
+			default:
+				return
+			}
+			binary.BigEndian.PutUint32(resp.buf, uint32(len(resp.buf)-4))
+			if _, err := conn.Write(resp.buf); err != nil {
+				return
+			}
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestKafkaOutputProduceRoundTrip(t *testing.T) {
+	produced := make(chan []byte, 1)
+	addr := startTestKafkaBroker(t, "seata-logs", produced)
+	k, err := newKafkaOutput(KafkaOutputConfig{Brokers: []string{addr}, Topic: "seata-logs"}, ClientTLSConfig{}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	entries := []LogData{
+		testEntry("orders", "INFO", "order created", time.Now()),
+		testEntry("orders", "ERROR", "order failed", time.Now()),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := k.Send(ctx, "kafka", entries); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, values := decodeTestRecordBatch(t, <-produced)
+	if len(values) != len(entries) {
+		t.Fatalf("batch has %d records, want %d", len(values), len(entries))
+	}
+	for i, value := range values {
+		var got LogData
+		if err := json.Unmarshal([]byte(value), &got); err != nil {
+			t.Fatal(err)
+		}
+		if keys[i] != "orders" || got.LogMessage != entries[i].LogMessage {
+			t.Fatalf("record %d = %s %s", i, keys[i], value)
+		}
+	}
+}
+
+// broker 返回分区错误码时发送失败
+func TestCheckProduceResponseReportsPartitionError(t *testing.T) {
+	var resp kafkaEncoder
+	resp.int32(1)
+	resp.string("seata-logs")
+	resp.int32(1)
+	resp.int32(0)
+	resp.int16(6) // NOT_LEADER_FOR_PARTITION
+	resp.buf = binary.BigEndian.AppendUint64(resp.buf, 0)
+	resp.buf = binary.BigEndian.AppendUint64(resp.buf, 0)
+	if err := checkProduceResponse(&kafkaDecoder{buf: resp.buf}); err == nil {
+		t.Fatal("partition error was not reported")
+	}
+}
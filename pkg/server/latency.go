@@ -0,0 +1,134 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/model"
+)
+
+// 一组事务耗时的分位数，单位毫秒
+type latencyStats struct {
+	Count int   `json:"count"`
+	P50Ms int64 `json:"p50_ms"`
+	P95Ms int64 `json:"p95_ms"`
+	P99Ms int64 `json:"p99_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// 一个时间窗口内的耗时分位数，窗口按事务开始时间划分
+type latencyWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	latencyStats
+}
+
+// 单个应用的事务耗时
+type applicationLatency struct {
+	ApplicationID string `json:"application_id"`
+	latencyStats
+	Windows []latencyWindow `json:"windows"`
+}
+
+// 计算分位数（最近秩法），durations 须已排序
+func percentile(durations []int64, p float64) int64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(durations))))
+	if rank < 1 {
+		rank = 1
+	}
+	return durations[rank-1]
+}
+
+func newLatencyStats(durations []int64) latencyStats {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	s := latencyStats{Count: len(durations)}
+	if len(durations) > 0 {
+		s.P50Ms = percentile(durations, 50)
+		s.P95Ms = percentile(durations, 95)
+		s.P99Ms = percentile(durations, 99)
+		s.MaxMs = durations[len(durations)-1]
+	}
+	return s
+}
+
+// 事务耗时接口：按 TC 日志中开始到提交/回滚的时间计算各应用的 p50/p95/p99，
+// 并按 interval 划分时间窗口，便于比较升级前后的耗时变化
+func (s *Service) transactionLatencyHandler(c *gin.Context) {
+	apps, from, to, ok := s.parseAnalysisScope(c)
+	if !ok {
+		return
+	}
+	loc, err := parseLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tz"})
+		return
+	}
+	interval := c.DefaultQuery("interval", "1h")
+	b, err := newBucketer(interval, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 默认只统计正常结束的事务，失败和超时的耗时与重试、超时配置有关
+	statuses := map[string]bool{analysis.StatusCommitted: true, analysis.StatusRolledBack: true}
+	if list := splitList(c.Query("status")); len(list) > 0 {
+		statuses = make(map[string]bool)
+		for _, s := range list {
+			switch s {
+			case analysis.StatusCommitted, analysis.StatusRolledBack, analysis.StatusTimedOut, analysis.StatusFailed:
+				statuses[s] = true
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "status must be committed, rolled_back, timed_out or failed"})
+				return
+			}
+		}
+	}
+
+	results := make([]applicationLatency, 0, len(apps))
+	total := 0
+	for _, app := range apps {
+		tracker := analysis.NewTransactionTracker()
+		if err := s.runAnalyzers(c.Request.Context(), []string{app}, from, to, []analysis.Analyzer{tracker}); err != nil {
+			readFailed(c, err)
+			return
+		}
+
+		var all []int64
+		windows := make(map[time.Time][]int64)
+		for _, tx := range tracker.Summaries(time.Now(), time.Duration(s.cfg.TransactionHangWindow)) {
+			if tx.DurationMs == nil || !statuses[tx.Status] {
+				continue
+			}
+			all = append(all, *tx.DurationMs)
+			start := b.Truncate(*tx.Begin)
+			windows[start] = append(windows[start], *tx.DurationMs)
+		}
+		total += len(all)
+
+		result := applicationLatency{ApplicationID: model.BareApplicationID(app), latencyStats: newLatencyStats(all), Windows: []latencyWindow{}}
+		starts := make([]time.Time, 0, len(windows))
+		for start := range windows {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+		for _, start := range starts {
+			result.Windows = append(result.Windows, latencyWindow{Start: start, End: b.Next(start), latencyStats: newLatencyStats(windows[start])})
+		}
+		results = append(results, result)
+	}
+
+	auditCount(c, total)
+	c.JSON(http.StatusOK, gin.H{
+		"interval":     interval,
+		"tz":           loc.String(),
+		"applications": results,
+	})
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 应用的生命周期，满足合规要求：
+//   - 归档：只读，拒绝新的写入，不受磁盘配额的 delete_oldest 清理
+//   - 法律保留：任何情况下都不删除该应用的日志，不能软删除，已软删除的不会到期清除
+//   - 软删除：应用从列表和查询中隐藏并拒绝写入，恢复期内可以恢复，到期后清除全部日志
+type LifecycleConfig struct {
+	RecoveryWindow Duration `json:"recovery_window"` // 软删除后可以恢复的时长，到期后清除，默认 720h（30 天）
+}
+
+// 应用的生命周期状态，只记录归档、保留或软删除的应用，持久化在 data_dir/lifecycle.json
+type applicationLifecycle struct {
+	ApplicationID string     `json:"application_id"` // 租户应用为 租户/应用
+	Archived      bool       `json:"archived"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	LegalHold     bool       `json:"legal_hold"`
+	HoldReason    string     `json:"hold_reason,omitempty"`
+	HeldAt        *time.Time `json:"held_at,omitempty"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt       *time.Time `json:"purge_at,omitempty"` // 软删除的恢复期截止时间，处于法律保留时不清除
+	UpdatedBy     string     `json:"updated_by,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// 是否不需要再记录
+func (s *applicationLifecycle) empty() bool {
+	return !s.Archived && !s.LegalHold && s.DeletedAt == nil
+}
+
+var (
+	errApplicationReadOnly = errors.New("application is archived or deleted")
+	errLegalHold           = errors.New("application is under legal hold")
+	errNotDeleted          = errors.New("application is not deleted")
+	errRecoveryExpired     = errors.New("recovery window has expired")
+)
+
+var applicationsPurged = metrics.counter("application_purged_total", "Soft-deleted applications purged after the recovery window.")
+
+// 检查恢复期是否到期的间隔
+const lifecyclePurgeInterval = time.Hour
+
+// 应用生命周期状态的注册表，到期的软删除应用由后台定期清除
+type lifecycleRegistry struct {
+	svc    *Service
+	mu     sync.RWMutex
+	states map[string]*applicationLifecycle
+	path   string
+	window time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (s *Service) newLifecycleRegistry(dataDir string, c LifecycleConfig) (*lifecycleRegistry, error) {
+	if c.RecoveryWindow < 0 {
+		return nil, fmt.Errorf("recovery_window must not be negative")
+	}
+	if c.RecoveryWindow == 0 {
+		c.RecoveryWindow = Duration(30 * 24 * time.Hour)
+	}
+	r := &lifecycleRegistry{
+		svc:    s,
+		states: make(map[string]*applicationLifecycle),
+		path:   filepath.Join(dataDir, "lifecycle.json"),
+		window: time.Duration(c.RecoveryWindow),
+		stop:   make(chan struct{}),
+	}
+	if err := loadJSONFile(r.path, &r.states); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 定期清除恢复期已过的软删除应用，启动时先检查一次
+func (r *lifecycleRegistry) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(lifecyclePurgeInterval)
+		defer ticker.Stop()
+		for {
+			r.purgeExpired(time.Now())
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *lifecycleRegistry) Close() error {
+	close(r.stop)
+	r.wg.Wait()
+	return nil
+}
+
+// 应用的状态，未记录时返回 nil
+func (r *lifecycleRegistry) state(applicationID string) *applicationLifecycle {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.states[applicationID]
+}
+
+// 写入前检查，归档或软删除的应用返回 errApplicationReadOnly
+func (r *lifecycleRegistry) CheckWrite(applicationID string) error {
+	if s := r.state(applicationID); s != nil && (s.Archived || s.DeletedAt != nil) {
+		return errApplicationReadOnly
+	}
+	return nil
+}
+
+// 应用的日志是否不能被清理：归档或处于法律保留
+func (r *lifecycleRegistry) Retained(applicationID string) bool {
+	s := r.state(applicationID)
+	return s != nil && (s.Archived || s.LegalHold)
+}
+
+// 应用是否已软删除，软删除的应用不出现在列表和查询中
+func (r *lifecycleRegistry) Deleted(applicationID string) bool {
+	s := r.state(applicationID)
+	return s != nil && s.DeletedAt != nil
+}
+
+// 去掉已软删除的应用
+func (r *lifecycleRegistry) Visible(apps []string) []string {
+	visible := apps[:0:0]
+	for _, app := range apps {
+		if !r.Deleted(app) {
+			visible = append(visible, app)
+		}
+	}
+	return visible
+}
+
+func (r *lifecycleRegistry) List() []applicationLifecycle {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]applicationLifecycle, 0, len(r.states))
+	for _, s := range r.states {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 生命周期的变更，未指定的字段保持不变
+type lifecycleRequest struct {
+	ApplicationID string `json:"application_id" binding:"required"`
+	Archived      *bool  `json:"archived"`
+	LegalHold     *bool  `json:"legal_hold"`
+	HoldReason    string `json:"hold_reason"` // 设置法律保留时的原因，如案件编号
+	Deleted       *bool  `json:"deleted"`     // true 软删除，false 在恢复期内恢复
+}
+
+// 应用变更并保存，返回变更后的状态。处于法律保留的应用不能软删除，未软删除或恢复期已过的应用不能恢复
+func (r *lifecycleRegistry) Update(req lifecycleRequest, user string, now time.Time) (applicationLifecycle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &applicationLifecycle{ApplicationID: req.ApplicationID}
+	if old, ok := r.states[req.ApplicationID]; ok {
+		copied := *old
+		s = &copied
+	}
+
+	if req.LegalHold != nil {
+		if *req.LegalHold && !s.LegalHold {
+			s.HeldAt = &now
+		}
+		s.LegalHold = *req.LegalHold
+		s.HoldReason = req.HoldReason
+		if !s.LegalHold {
+			s.HeldAt, s.HoldReason = nil, ""
+		}
+	}
+	if req.Archived != nil {
+		if *req.Archived && !s.Archived {
+			s.ArchivedAt = &now
+		}
+		s.Archived = *req.Archived
+		if !s.Archived {
+			s.ArchivedAt = nil
+		}
+	}
+	if req.Deleted != nil {
+		switch {
+		case *req.Deleted && s.LegalHold:
+			return *s, errLegalHold
+		case *req.Deleted && s.DeletedAt == nil:
+			purgeAt := now.Add(r.window)
+			s.DeletedAt, s.PurgeAt = &now, &purgeAt
+		case !*req.Deleted && s.DeletedAt == nil:
+			return *s, errNotDeleted
+		case !*req.Deleted && !s.LegalHold && !now.Before(*s.PurgeAt):
+			return *s, errRecoveryExpired
+		case !*req.Deleted:
+			s.DeletedAt, s.PurgeAt = nil, nil
+		}
+	}
+	s.UpdatedBy, s.UpdatedAt = user, now
+
+	if s.empty() {
+		delete(r.states, req.ApplicationID)
+	} else {
+		r.states[req.ApplicationID] = s
+	}
+	return *s, saveJSONFile(r.path, r.states)
+}
+
+// 清除恢复期已过且不处于法律保留的软删除应用
+func (r *lifecycleRegistry) purgeExpired(now time.Time) {
+	r.mu.RLock()
+	var expired []string
+	for app, s := range r.states {
+		if s.PurgeAt != nil && !s.LegalHold && !now.Before(*s.PurgeAt) {
+			expired = append(expired, app)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Strings(expired)
+
+	for _, app := range expired {
+		if err := r.purge(app); err != nil {
+			log.Printf("unable to purge deleted application %s: %v", app, err)
+		}
+	}
+}
+
+// 删除应用的全部日志和计数索引，并清除其状态。删除前再次确认状态，期间可能已被恢复或设置了法律保留
+func (r *lifecycleRegistry) purge(applicationID string) error {
+	gate := r.svc.backends.WriteGate(applicationID)
+	gate.Lock()
+	defer gate.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.states[applicationID]
+	if !ok || s.PurgeAt == nil || s.LegalHold {
+		return nil
+	}
+	store, _, _ := r.svc.backends.Store(r.svc.backends.BackendOf(applicationID))
+	if _, ok := r.svc.queryStoreOf(applicationID); !ok {
+		if err := r.svc.histogramCounts.Reset(applicationID); err != nil {
+			return err
+		}
+	}
+	if err := store.RemoveApplication(applicationID); err != nil {
+		return err
+	}
+	delete(r.states, applicationID)
+	applicationsPurged.Add(1)
+	log.Printf("purged application %s deleted at %s", applicationID, s.DeletedAt.Format(time.RFC3339))
+	r.svc.systemEvents.Publish(eventRetention, applicationID, "Purged soft-deleted application after the recovery window",
+		gin.H{"deleted_at": s.DeletedAt, "updated_by": s.UpdatedBy})
+	return saveJSONFile(r.path, r.states)
+}
+
+// 查询接口解析路径或参数中的应用，软删除的应用在恢复前返回 404
+func (s *Service) queriedApplicationID(c *gin.Context, applicationID string) (string, bool) {
+	app, ok := scopedApplicationID(c, applicationID)
+	if ok && s.lifecycle.Deleted(app) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found: " + applicationID})
+		return "", false
+	}
+	return app, ok
+}
+
+// 应用生命周期列表接口
+func (s *Service) lifecycleListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"applications": s.lifecycle.List(), "recovery_window": s.lifecycle.window.String()})
+}
+
+// 归档、法律保留、软删除和恢复接口
+func (s *Service) lifecyclePutHandler(c *gin.Context) {
+	var req lifecycleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if tenant, app := model.SplitApplicationID(req.ApplicationID); !validApplicationID(app) || (tenant != "" && !validApplicationID(tenant)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+	if req.LegalHold != nil && *req.LegalHold && req.HoldReason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hold_reason is required when setting legal_hold"})
+		return
+	}
+	user := ""
+	if u := currentUser(c); u != nil {
+		user = u.Name
+	}
+	state, err := s.lifecycle.Update(req, user, time.Now())
+	switch {
+	case errors.Is(err, errLegalHold):
+		c.JSON(http.StatusConflict, gin.H{"error": "Application is under legal hold and cannot be deleted"})
+	case errors.Is(err, errNotDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "Application is not deleted"})
+	case errors.Is(err, errRecoveryExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Recovery window has expired"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save application lifecycle"})
+	default:
+		c.JSON(http.StatusOK, state)
+	}
+}
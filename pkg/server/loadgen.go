@@ -0,0 +1,342 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"logAnalysis/pkg/client"
+)
+
+// loadgen 子命令：按配置的应用数、速率和消息大小向运行中的实例持续上传和查询，结束后报告吞吐和延迟，
+// 用于发布前验证影响性能的改动。速率是开环的：实例处理不过来、并发都在等待响应时，
+// 到点的请求不排队而是计入 missed，这样吞吐不足会直接体现出来，不会被排队拉长的延迟掩盖。
+// 请求不重试，失败按状态码计数；Ctrl-C 提前结束时仍输出已完成部分的结果
+type loadgenConfig struct {
+	apps         int
+	appPrefix    string
+	rate         int // 每秒上传的日志条数
+	batch        int
+	messageBytes int
+	errorRatio   float64
+	queryRate    int // 每秒查询次数
+	queryLimit   int
+	queryWindow  time.Duration
+	queryKeyword string
+	duration     time.Duration
+	concurrency  int
+}
+
+// 一类请求的结果，延迟单位毫秒
+type loadgenResult struct {
+	Requests      int            `json:"requests"`
+	Errors        int            `json:"errors"`
+	ErrorsByCause map[string]int `json:"errors_by_cause"` // HTTP 状态码，连接失败和超时为 network
+	Missed        int            `json:"missed"`          // 并发已满、没有按时发出的请求
+	Entries       int            `json:"entries"`         // 上传成功的日志条数，或查询返回的条数
+	PerSecond     float64        `json:"per_second"`      // 每秒成功的请求数
+	EntriesPerSec float64        `json:"entries_per_second"`
+	P50Ms         float64        `json:"p50_ms"`
+	P90Ms         float64        `json:"p90_ms"`
+	P99Ms         float64        `json:"p99_ms"`
+	MaxMs         float64        `json:"max_ms"`
+	MeanMs        float64        `json:"mean_ms"`
+
+	mu        sync.Mutex
+	latencies []int64 // 微秒
+}
+
+type loadgenReport struct {
+	Server       string         `json:"server"`
+	Applications []string       `json:"applications"`
+	DurationSec  float64        `json:"duration_seconds"`
+	Uploads      *loadgenResult `json:"uploads,omitempty"`
+	Queries      *loadgenResult `json:"queries,omitempty"`
+}
+
+func newLoadgenResult() *loadgenResult {
+	return &loadgenResult{ErrorsByCause: make(map[string]int)}
+}
+
+// 记录一次请求
+func (r *loadgenResult) record(latency time.Duration, entries int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Requests++
+	if err != nil {
+		r.Errors++
+		r.ErrorsByCause[loadgenCause(err)]++
+		return
+	}
+	r.Entries += entries
+	r.latencies = append(r.latencies, latency.Microseconds())
+}
+
+func (r *loadgenResult) miss() {
+	r.mu.Lock()
+	r.Missed++
+	r.mu.Unlock()
+}
+
+// 按实际运行时长计算吞吐和成功请求的延迟分位数
+func (r *loadgenResult) finish(elapsed time.Duration) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	ms := func(us int64) float64 { return float64(us) / 1000 }
+	if n := len(r.latencies); n > 0 {
+		var sum int64
+		for _, us := range r.latencies {
+			sum += us
+		}
+		r.P50Ms, r.P90Ms, r.P99Ms = ms(percentile(r.latencies, 50)), ms(percentile(r.latencies, 90)), ms(percentile(r.latencies, 99))
+		r.MaxMs, r.MeanMs = ms(r.latencies[n-1]), ms(sum/int64(n))
+		r.PerSecond = float64(n) / elapsed.Seconds()
+		r.EntriesPerSec = float64(r.Entries) / elapsed.Seconds()
+	}
+}
+
+// 失败的原因：服务端返回的状态码，其余为 network
+func loadgenCause(err error) string {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.StatusCode)
+	}
+	return "network"
+}
+
+func runLoadgen(args []string) {
+	var opts cliOptions
+	var c loadgenConfig
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	opts.register(fs)
+	fs.IntVar(&c.apps, "apps", 4, "number of applications to write to and query")
+	fs.StringVar(&c.appPrefix, "app-prefix", "loadgen", "prefix of the generated application IDs, followed by -1, -2, ...")
+	fs.IntVar(&c.rate, "rate", 1000, "log entries uploaded per second across all applications, 0 to only query")
+	fs.IntVar(&c.batch, "batch", 100, "entries per /upload/batch request")
+	fs.IntVar(&c.messageBytes, "message-bytes", 200, "approximate size of each log message")
+	fs.Float64Var(&c.errorRatio, "error-ratio", 0.05, "fraction of entries uploaded as ERROR, the rest as INFO")
+	fs.IntVar(&c.queryRate, "query-rate", 10, "queries per second, 0 to only upload")
+	fs.IntVar(&c.queryLimit, "query-limit", 100, "limit of each query")
+	fs.DurationVar(&c.queryWindow, "query-window", 5*time.Minute, "time range of each query, ending now")
+	fs.StringVar(&c.queryKeyword, "query-keyword", "", "keyword filter of each query, default none")
+	fs.DurationVar(&c.duration, "duration", 30*time.Second, "how long to generate load")
+	fs.IntVar(&c.concurrency, "concurrency", 16, "maximum requests in flight for each of uploads and queries")
+	if err := parseCLIFlags(fs, args); err != nil {
+		fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+		os.Exit(2)
+	}
+	if err := runLoadgenWith(opts, c); err != nil {
+		fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runLoadgenWith(opts cliOptions, c loadgenConfig) error {
+	switch {
+	case c.apps <= 0 || c.batch <= 0 || c.concurrency <= 0 || c.duration <= 0:
+		return errors.New("-apps, -batch, -concurrency and -duration must be positive")
+	case c.rate < 0 || c.queryRate < 0:
+		return errors.New("-rate and -query-rate must not be negative")
+	case c.rate == 0 && c.queryRate == 0:
+		return errors.New("nothing to do: -rate and -query-rate are both 0")
+	case c.errorRatio < 0 || c.errorRatio > 1:
+		return errors.New("-error-ratio must be between 0 and 1")
+	}
+	// 默认的连接池每个地址只保留 2 个空闲连接，并发高时会不断新建连接
+	httpClient, err := newTLSHTTPClient(opts.tls, opts.timeout)
+	if err != nil {
+		return err
+	}
+	httpClient.Transport.(*http.Transport).MaxIdleConnsPerHost = 2 * c.concurrency
+	cl, err := opts.client(client.WithHTTPClient(httpClient), client.WithRetries(0))
+	if err != nil {
+		return err
+	}
+
+	apps := make([]string, c.apps)
+	for i := range apps {
+		apps[i] = fmt.Sprintf("%s-%d", c.appPrefix, i+1)
+	}
+	report := loadgenReport{Server: opts.server, Applications: apps}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, c.duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	if c.rate > 0 {
+		report.Uploads = newLoadgenResult()
+		gen := newLoadgenMessages(c)
+		// 每批 batch 条，按 rate 换算发送间隔；rate 小于 batch 时每秒一批 rate 条
+		batch := min(c.batch, c.rate)
+		interval := time.Duration(float64(time.Second) * float64(batch) / float64(c.rate))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runLoadgenWorkload(ctx, interval, c.concurrency, report.Uploads, func(ctx context.Context) (int, error) {
+				entries := gen.batch(apps, batch)
+				_, err := cl.UploadBatch(ctx, entries)
+				return len(entries), err
+			})
+		}()
+	}
+	if c.queryRate > 0 {
+		report.Queries = newLoadgenResult()
+		var mu sync.Mutex
+		next := 0
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runLoadgenWorkload(ctx, time.Second/time.Duration(c.queryRate), c.concurrency, report.Queries, func(ctx context.Context) (int, error) {
+				// 轮流查询各应用，级别交替为 INFO 和 ERROR
+				mu.Lock()
+				n := next
+				next++
+				mu.Unlock()
+				level := "INFO"
+				if n/len(apps)%2 == 1 {
+					level = "ERROR"
+				}
+				now := time.Now()
+				entries, err := cl.Query(ctx, client.QueryOptions{
+					ApplicationID: apps[n%len(apps)],
+					LogLevel:      level,
+					Limit:         c.queryLimit,
+					From:          now.Add(-c.queryWindow).Format(time.RFC3339),
+					To:            now.Format(time.RFC3339),
+					Keyword:       c.queryKeyword,
+				})
+				return len(entries), err
+			})
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	report.DurationSec = elapsed.Seconds()
+	for _, r := range []*loadgenResult{report.Uploads, report.Queries} {
+		if r != nil {
+			r.finish(elapsed)
+		}
+	}
+
+	if opts.output == "json" {
+		return writeCLIJSON(os.Stdout, report)
+	}
+	fmt.Fprintf(os.Stdout, "%s, %d applications, %.1fs\n\n", report.Server, len(apps), report.DurationSec)
+	rows := []struct {
+		name string
+		r    *loadgenResult
+	}{{"upload", report.Uploads}, {"query", report.Queries}}
+	w := newCLITable(os.Stdout, "WORKLOAD", "REQUESTS", "ERRORS", "MISSED", "REQ/S", "ENTRIES/S", "P50", "P90", "P99", "MAX")
+	for _, row := range rows {
+		if row.r == nil {
+			continue
+		}
+		r := row.r
+		w.row(row.name, strconv.Itoa(r.Requests), strconv.Itoa(r.Errors), strconv.Itoa(r.Missed),
+			fmt.Sprintf("%.1f", r.PerSecond), fmt.Sprintf("%.0f", r.EntriesPerSec),
+			loadgenMs(r.P50Ms), loadgenMs(r.P90Ms), loadgenMs(r.P99Ms), loadgenMs(r.MaxMs))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.r == nil || row.r.Errors == 0 {
+			continue
+		}
+		causes := make([]string, 0, len(row.r.ErrorsByCause))
+		for _, cause := range sortedKeys(row.r.ErrorsByCause) {
+			causes = append(causes, fmt.Sprintf("%s=%d", cause, row.r.ErrorsByCause[cause]))
+		}
+		fmt.Fprintf(os.Stdout, "\n%s errors: %s", row.name, strings.Join(causes, " "))
+	}
+	fmt.Fprintln(os.Stdout)
+	return nil
+}
+
+func loadgenMs(ms float64) string {
+	return fmt.Sprintf("%.1fms", ms)
+}
+
+// 每隔 interval 发出一个请求，最多 concurrency 个同时进行；全部并发都在等待时这次请求计入 missed。
+// ctx 结束后等待进行中的请求返回，它们不受 ctx 影响，以免把结束时中断的请求计为失败
+func runLoadgenWorkload(ctx context.Context, interval time.Duration, concurrency int, r *loadgenResult, do func(ctx context.Context) (int, error)) {
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(max(interval, time.Microsecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			r.miss()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			started := time.Now()
+			n, err := do(context.WithoutCancel(ctx))
+			r.record(time.Since(started), n, err)
+		}()
+	}
+}
+
+// 生成上传的日志：消息带有序号和 Seata 风格的 XID，用填充词补足长度
+type loadgenMessages struct {
+	mu           sync.Mutex
+	rnd          *rand.Rand
+	seq          int64
+	messageBytes int
+	errorRatio   float64
+}
+
+var loadgenWords = strings.Fields("branch commit rollback global transaction resource lock undo register status phase timeout retry order stock account payment")
+
+func newLoadgenMessages(c loadgenConfig) *loadgenMessages {
+	return &loadgenMessages{rnd: rand.New(rand.NewSource(time.Now().UnixNano())), messageBytes: c.messageBytes, errorRatio: c.errorRatio}
+}
+
+// 一批日志，应用轮流选取
+func (g *loadgenMessages) batch(apps []string, n int) []client.LogEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	entries := make([]client.LogEntry, n)
+	for i := range entries {
+		g.seq++
+		level := "INFO"
+		if g.rnd.Float64() < g.errorRatio {
+			level = "ERROR"
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "loadgen seq=%d xid=10.0.0.1:8091:%d", g.seq, g.seq/10)
+		for b.Len() < g.messageBytes {
+			b.WriteByte(' ')
+			b.WriteString(loadgenWords[g.rnd.Intn(len(loadgenWords))])
+		}
+		entries[i] = client.LogEntry{ApplicationID: apps[int(g.seq)%len(apps)], LogLevel: level, Timestamp: now, LogMessage: b.String()}
+	}
+	return entries
+}
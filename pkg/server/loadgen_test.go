@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"logAnalysis/pkg/client"
+)
+
+// 在临时目录中启动完整的 HTTP 服务，返回与 loadgen 相同方式访问它的客户端
+func startLoadgenServer(b *testing.B) (*Service, *client.Client) {
+	b.Helper()
+	s := openTestService(b, b.TempDir())
+	srv := httptest.NewServer(newTestRouter(b, s))
+	b.Cleanup(srv.Close)
+	return s, client.New(srv.URL, client.WithRetries(0))
+}
+
+func benchmarkLoadgenApps() []string {
+	apps := make([]string, 4)
+	for i := range apps {
+		apps[i] = fmt.Sprintf("loadgen-%d", i+1)
+	}
+	return apps
+}
+
+// loadgen 默认参数下的上传：每批 100 条 200 字节的消息，多个请求同时进行
+func BenchmarkLoadgenUpload(b *testing.B) {
+	_, cl := startLoadgenServer(b)
+	apps := benchmarkLoadgenApps()
+	gen := newLoadgenMessages(loadgenConfig{messageBytes: 200, errorRatio: 0.05})
+	const batch = 100
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cl.UploadBatch(context.Background(), gen.batch(apps, batch)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "entries/s")
+}
+
+// loadgen 默认参数下的查询：各应用轮流，级别在 INFO 和 ERROR 之间交替，查询最近 5 分钟的 100 条
+func BenchmarkLoadgenQuery(b *testing.B) {
+	s, cl := startLoadgenServer(b)
+	apps := benchmarkLoadgenApps()
+	gen := newLoadgenMessages(loadgenConfig{messageBytes: 200, errorRatio: 0.05})
+	for i := 0; i < 200; i++ {
+		var entries []LogData
+		for _, e := range gen.batch(apps, 100) {
+			entries = append(entries, LogData{ApplicationID: e.ApplicationID, LogLevel: e.LogLevel, Timestamp: e.Timestamp, LogMessage: e.LogMessage})
+		}
+		if _, err := s.Ingest(entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		level := "INFO"
+		if i/len(apps)%2 == 1 {
+			level = "ERROR"
+		}
+		now := time.Now()
+		entries, err := cl.Query(context.Background(), client.QueryOptions{
+			ApplicationID: apps[i%len(apps)],
+			LogLevel:      level,
+			Limit:         100,
+			From:          now.Add(-5 * time.Minute).Format(time.RFC3339),
+			To:            now.Add(time.Second).Format(time.RFC3339),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(entries) == 0 {
+			b.Fatalf("query %s level=%s returned no entries", apps[i%len(apps)], level)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每次预留的 ID 数量，用完后才写一次 data_dir/log_ids.json
+const logIDBlock = 1000
+
+// 只读取最近写入的分段末尾这么多字节来恢复已分配的最大 ID
+const logIDTailBytes = 64 << 10
+
+// 日志 ID 分配器：每个应用的日志按写入顺序获得单调递增的 ID，可用于 since_id 增量消费。
+// 已预留到的 ID 保存在 data_dir/log_ids.json，重启后从预留值之后继续分配，
+// 未用完的预留会留下空洞，但不会重复或回退
+type logIDAllocator struct {
+	svc  *Service
+	path string
+
+	mu       sync.Mutex
+	apps     map[string]*appLogIDs
+	reserved map[string]int64 // 应用 → 已持久化的预留上限
+}
+
+// 单个应用的分配状态，mu 在分配后一直持有到日志写入完成，保证文件中的 ID 有序
+type appLogIDs struct {
+	mu       sync.Mutex
+	loaded   bool
+	last     int64 // 最后一条写入成功的日志的 ID
+	reserved int64
+}
+
+// 写入序号：取写入时的 Unix 纳秒时间，并保证严格递增，因此不需要持久化，重启后也不会回退
+// （除非系统时钟大幅回拨）。在应用的 ID 锁内分配，同一应用内序号与 ID 的顺序一致
+type ingestSequence struct {
+	mu   sync.Mutex
+	last int64
+}
+
+func (s *ingestSequence) Next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := time.Now().UnixNano()
+	if next <= s.last {
+		next = s.last + 1
+	}
+	s.last = next
+	return next
+}
+
+// 时间戳相同的两条日志按写入顺序比较：都有写入序号时比较序号，同一应用内比较日志 ID；
+// 都无法比较（如早于写入序号的数据跨应用比较）时 ok 为 false
+func ingestOrder(a, b LogData) (before, ok bool) {
+	if a.Seq > 0 && b.Seq > 0 && a.Seq != b.Seq {
+		return a.Seq < b.Seq, true
+	}
+	if a.ApplicationID == b.ApplicationID && a.ID > 0 && b.ID > 0 && a.ID != b.ID {
+		return a.ID < b.ID, true
+	}
+	return false, false
+}
+
+// 按 (时间, 写入顺序) 判断 a 是否排在 b 之前，用于时间线等按时间升序的排序
+func timeOrderBefore(atA time.Time, a LogData, atB time.Time, b LogData) bool {
+	if !atA.Equal(atB) {
+		return atA.Before(atB)
+	}
+	before, _ := ingestOrder(a, b)
+	return before
+}
+
+func (s *Service) newLogIDAllocator(dataDir string) (*logIDAllocator, error) {
+	a := &logIDAllocator{
+		svc:      s,
+		path:     filepath.Join(dataDir, "log_ids.json"),
+		apps:     make(map[string]*appLogIDs),
+		reserved: make(map[string]int64),
+	}
+	if err := loadJSONFile(a.path, &a.reserved); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// 为应用分配下一个 ID 并调用 fn 写入日志，fn 失败时该 ID 不计为已使用
+func (a *logIDAllocator) Assign(applicationID string, fn func(id int64) error) (int64, error) {
+	a.mu.Lock()
+	s, ok := a.apps[applicationID]
+	if !ok {
+		s = &appLogIDs{}
+		a.apps[applicationID] = s
+	}
+	a.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		a.mu.Lock()
+		s.reserved = a.reserved[applicationID]
+		a.mu.Unlock()
+		// 集群中应用换了归属节点时本节点的预留值可能落后，以存储中的最大 ID 为准
+		s.last = s.reserved
+		if stored := a.svc.lastStoredLogID(applicationID); stored > s.last {
+			s.last, s.reserved = stored, stored
+		}
+		s.loaded = true
+	}
+
+	id := s.last + 1
+	if id > s.reserved {
+		if err := a.reserve(applicationID, id+logIDBlock-1); err != nil {
+			return 0, err
+		}
+		s.reserved = id + logIDBlock - 1
+	}
+	if err := fn(id); err != nil {
+		return 0, err
+	}
+	s.last = id
+	return id, nil
+}
+
+// 持久化应用新的预留上限
+func (a *logIDAllocator) reserve(applicationID string, upTo int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reserved[applicationID] = upTo
+	return saveJSONFile(a.path, a.reserved)
+}
+
+// 已持久化的预留上限
+func (a *logIDAllocator) Reserved(applicationID string) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reserved[applicationID]
+}
+
+// 确保之后分配的 ID 大于 id，用于恢复备份等使存储中的 ID 超过预留值之后
+func (a *logIDAllocator) Ensure(applicationID string, id int64) error {
+	a.mu.Lock()
+	s, ok := a.apps[applicationID]
+	a.mu.Unlock()
+	if ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.loaded && s.last < id {
+			s.last = id
+			s.reserved = max(s.reserved, id)
+		}
+	}
+	if a.Reserved(applicationID) >= id {
+		return nil
+	}
+	return a.reserve(applicationID, id)
+}
+
+// 存储中应用已有的最大 ID：写入是按 ID 顺序进行的，最大 ID 在最近修改的分段末尾。
+// 只读取未压缩的分段，读不到时返回 0
+func (s *Service) lastStoredLogID(applicationID string) int64 {
+	if qs, ok := s.queryStoreOf(applicationID); ok {
+		id, _ := qs.LastID(applicationID)
+		return id
+	}
+	dir := s.applicationDir(applicationID)
+	names, err := listSegments(dir)
+	if err != nil {
+		return 0
+	}
+	var newest string
+	var newestInfo os.FileInfo
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err == nil && (newestInfo == nil || info.ModTime().After(newestInfo.ModTime())) {
+			newest, newestInfo = name, info
+		}
+	}
+	if newestInfo == nil {
+		return 0
+	}
+
+	var last int64
+	start := newestInfo.Size() - logIDTailBytes
+	if start < 0 {
+		start = 0
+	}
+	// 从中间开始读取时第一行不完整，解析失败后被跳过
+	visit := parsedLineVisitor(func(entry LogData, ref logRef) bool {
+		if entry.ID > last {
+			last = entry.ID
+		}
+		return true
+	})
+	ref := logRef{ApplicationID: applicationID, File: newest}
+	s.scanFileLines(context.Background(), filepath.Join(dir, newest), start, func(line string, offset, next int64) bool {
+		return visit(line, ref)
+	})
+	return last
+}
+
+// 解析 since_id、max_id 参数，未指定时为 0
+func parseIDRange(c *gin.Context) (int64, int64, bool) {
+	var ids [2]int64
+	for i, name := range []string{"since_id", "max_id"} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+			return 0, 0, false
+		}
+		ids[i] = id
+	}
+	return ids[0], ids[1], true
+}
+
+// 按 ID 获取一条完整的日志：查询结果中被截断的长消息通过它取回全文。application_id 必填，
+// tz 与 /query 相同
+func (s *Service) logGetHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	applicationID := c.Query("application_id")
+	if applicationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id is required"})
+		return
+	}
+	storeID, ok := s.queriedApplicationID(c, applicationID)
+	if !ok {
+		return
+	}
+	q := logQuery{ApplicationID: storeID, SinceID: id - 1, MaxID: id, ctx: c.Request.Context()}
+	hits, err := s.collectSorted(q, sortAsc, 1, nil)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	if len(hits) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
+		return
+	}
+	if c.Query("tz") != "" {
+		loc, err := parseLocation(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tz"})
+			return
+		}
+		localizeTimestamps(hits, loc)
+	}
+	entry := hits[0].Entry
+	s.maskQueryEntry(&entry)
+	auditCount(c, 1)
+	c.JSON(http.StatusOK, s.linkTrace(entry))
+}
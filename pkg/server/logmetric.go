@@ -0,0 +1,376 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 从日志中计算的指标：匹配正则的日志按 aggregation 聚合，在 /metrics 中以 log_metric_<name> 输出，
+// 如从 "cost 123ms" 中提取耗时得到接口延迟，不需要额外的日志转指标工具
+type LogMetric struct {
+	Name          string    `json:"name" binding:"required"` // 小写字母、数字和下划线
+	Help          string    `json:"help"`
+	ApplicationID string    `json:"application_id"` // 应用 ID，支持 * 通配；租户应用为 租户/应用；为空表示所有应用
+	Level         string    `json:"level"`          // 只统计该级别的日志，不区分大小写
+	Field         string    `json:"field"`          // 匹配的字段，默认 log_message，也可以是 logger、xid 等内置字段或自定义字段
+	Pattern       string    `json:"pattern" binding:"required"`
+	Aggregation   string    `json:"aggregation"` // count（默认）、rate 或 avg
+	Labels        []string  `json:"labels"`      // 标签取自同名的命名分组，其次为同名的日志字段，如 application_id、log_level、pod
+	Window        Duration  `json:"window"`      // rate 和 avg 的统计窗口，默认 1m
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	re *regexp.Regexp
+}
+
+const (
+	logMetricCount = "count" // 计数器 log_metric_<name>_total
+	logMetricRate  = "rate"  // 窗口内每秒的条数 log_metric_<name>_per_second，同时输出计数器
+	logMetricAvg   = "avg"   // 提取命名分组 value（没有时为第一个分组）中的数字，输出 _sum、_count 和窗口内的平均值
+)
+
+// 窗口按这个粒度分桶累计，窗口的上下限
+const (
+	logMetricBucket    = 5 * time.Second
+	logMetricMinWindow = 10 * time.Second
+	logMetricMaxWindow = time.Hour
+)
+
+// 每个指标最多的标签组合数，超出的组合不再统计，避免按 XID 等取值打标签时无限增长
+const maxLogMetricSeries = 1000
+
+var logMetricNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+var logMetricsDropped = metrics.counter("log_metrics_dropped_total", "Log entries not recorded by a log metric because it reached its series limit, by metric.")
+
+func (m *LogMetric) compile() error {
+	if !logMetricNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("name must consist of lowercase letters, digits and underscores")
+	}
+	if _, err := path.Match(m.ApplicationID, ""); err != nil {
+		return fmt.Errorf("invalid application pattern %q", m.ApplicationID)
+	}
+	re, err := regexp.Compile(m.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %v", err)
+	}
+	switch m.Aggregation {
+	case "":
+		m.Aggregation = logMetricCount
+	case logMetricCount, logMetricRate:
+	case logMetricAvg:
+		if re.NumSubexp() == 0 {
+			return fmt.Errorf("avg requires a capturing group with the number, e.g. cost (?P<value>\\d+)ms")
+		}
+	default:
+		return fmt.Errorf("unsupported aggregation %q", m.Aggregation)
+	}
+	if m.Field == "" {
+		m.Field = "log_message"
+	}
+	if m.Window == 0 {
+		m.Window = Duration(time.Minute)
+	}
+	if w := time.Duration(m.Window); w < logMetricMinWindow || w > logMetricMaxWindow {
+		return fmt.Errorf("window must be between %s and %s", logMetricMinWindow, logMetricMaxWindow)
+	}
+	seen := make(map[string]bool)
+	for _, label := range m.Labels {
+		if !logMetricNamePattern.MatchString(label) || seen[label] {
+			return fmt.Errorf("invalid or duplicate label %q", label)
+		}
+		seen[label] = true
+	}
+	m.Level = strings.ToUpper(m.Level)
+	m.re = re
+	return nil
+}
+
+// 提取日志的标签和数值，不匹配或 avg 的数值无法解析时 ok 为 false
+func (m *LogMetric) extract(entry *LogData) (labels []string, value float64, ok bool) {
+	if m.ApplicationID != "" {
+		if matched, _ := path.Match(m.ApplicationID, entry.ApplicationID); !matched {
+			return nil, 0, false
+		}
+	}
+	if m.Level != "" && !strings.EqualFold(entry.LogLevel, m.Level) {
+		return nil, 0, false
+	}
+	match := m.re.FindStringSubmatch(entryFieldValue(entry, m.Field))
+	if match == nil {
+		return nil, 0, false
+	}
+	value = 1
+	if m.Aggregation == logMetricAvg {
+		i := m.re.SubexpIndex("value")
+		if i < 0 {
+			i = 1
+		}
+		v, err := strconv.ParseFloat(match[i], 64)
+		if err != nil {
+			return nil, 0, false
+		}
+		value = v
+	}
+	labels = make([]string, 0, 2*len(m.Labels))
+	for _, label := range m.Labels {
+		v := ""
+		if i := m.re.SubexpIndex(label); i >= 0 {
+			v = match[i]
+		} else {
+			v = entryFieldValue(entry, label)
+		}
+		labels = append(labels, label, v)
+	}
+	return labels, value, true
+}
+
+// 一个标签组合的累计值和窗口内按桶累计的值
+type logMetricSeries struct {
+	count, sum float64
+	buckets    []logMetricWindowBucket // 按开始时间升序
+}
+
+type logMetricWindowBucket struct {
+	start      int64 // Unix 秒
+	count, sum float64
+}
+
+// 丢弃窗口之外的桶
+func (s *logMetricSeries) prune(now time.Time, window time.Duration) {
+	cutoff := now.Add(-window).Unix()
+	i := 0
+	for i < len(s.buckets) && s.buckets[i].start+int64(logMetricBucket/time.Second) <= cutoff {
+		i++
+	}
+	s.buckets = s.buckets[i:]
+}
+
+func (s *logMetricSeries) add(value float64, now time.Time, window time.Duration) {
+	s.count++
+	s.sum += value
+	start := now.Truncate(logMetricBucket).Unix()
+	if n := len(s.buckets); n == 0 || s.buckets[n-1].start != start {
+		s.buckets = append(s.buckets, logMetricWindowBucket{start: start})
+		s.prune(now, window)
+	}
+	last := &s.buckets[len(s.buckets)-1]
+	last.count++
+	last.sum += value
+}
+
+// 窗口内的条数和数值之和
+func (s *logMetricSeries) window(now time.Time, window time.Duration) (count, sum float64) {
+	s.prune(now, window)
+	for _, b := range s.buckets {
+		count += b.count
+		sum += b.sum
+	}
+	return count, sum
+}
+
+// 已定义的日志指标及其运行时的值，值不持久化，重启后从零开始
+type logMetricRegistry struct {
+	mu      sync.Mutex
+	metrics map[string]*LogMetric
+	series  map[string]map[string]*logMetricSeries // 指标 → 标签 → 值
+	path    string
+}
+
+func newLogMetricRegistry(dataDir string) (*logMetricRegistry, error) {
+	r := &logMetricRegistry{metrics: make(map[string]*LogMetric), series: make(map[string]map[string]*logMetricSeries), path: filepath.Join(dataDir, "log_metrics.json")}
+	if err := loadJSONFile(r.path, &r.metrics); err != nil {
+		return nil, err
+	}
+	for name, m := range r.metrics {
+		if err := m.compile(); err != nil {
+			return nil, fmt.Errorf("log metric %s: %v", name, err)
+		}
+		r.series[name] = make(map[string]*logMetricSeries)
+	}
+	return r, nil
+}
+
+// 在写入的日志上计算全部指标
+func (r *logMetricRegistry) Observe(entry LogData) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, m := range r.metrics {
+		labels, value, ok := m.extract(&entry)
+		if !ok {
+			continue
+		}
+		key := labelKey(labels)
+		s, ok := r.series[name][key]
+		if !ok {
+			if len(r.series[name]) >= maxLogMetricSeries {
+				logMetricsDropped.Add(1, "metric", name)
+				continue
+			}
+			s = &logMetricSeries{}
+			r.series[name][key] = s
+		}
+		s.add(value, now, time.Duration(m.Window))
+	}
+}
+
+// 定义或替换指标，替换时已累计的值清零
+func (r *logMetricRegistry) Put(m *LogMetric) error {
+	if err := m.compile(); err != nil {
+		return err
+	}
+	m.UpdatedAt = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics[m.Name] = m
+	r.series[m.Name] = make(map[string]*logMetricSeries)
+	return saveJSONFile(r.path, r.metrics)
+}
+
+func (r *logMetricRegistry) Delete(name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; !ok {
+		return false, nil
+	}
+	delete(r.metrics, name)
+	delete(r.series, name)
+	return true, saveJSONFile(r.path, r.metrics)
+}
+
+func (r *logMetricRegistry) List() []LogMetric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]LogMetric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// 按 Prometheus 文本格式写出全部指标
+func (r *logMetricRegistry) WriteText(w io.Writer) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range sortedKeys(r.metrics) {
+		m := r.metrics[name]
+		window := time.Duration(m.Window)
+		keys := sortedKeys(r.series[name])
+		help := m.Help
+		if help == "" {
+			help = "Log entries matching " + m.Pattern
+		}
+		help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+		family := "log_metric_" + name
+		writeFamily := func(suffix, kind string, value func(s *logMetricSeries) (float64, bool)) {
+			fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", family, suffix, help, family, suffix, kind)
+			for _, key := range keys {
+				if v, ok := value(r.series[name][key]); ok {
+					fmt.Fprintf(w, "%s%s%s %g\n", family, suffix, key, v)
+				}
+			}
+		}
+
+		switch m.Aggregation {
+		case logMetricCount, logMetricRate:
+			writeFamily("_total", "counter", func(s *logMetricSeries) (float64, bool) { return s.count, true })
+			if m.Aggregation == logMetricRate {
+				writeFamily("_per_second", "gauge", func(s *logMetricSeries) (float64, bool) {
+					count, _ := s.window(now, window)
+					return count / window.Seconds(), true
+				})
+			}
+		case logMetricAvg:
+			writeFamily("_sum", "counter", func(s *logMetricSeries) (float64, bool) { return s.sum, true })
+			writeFamily("_count", "counter", func(s *logMetricSeries) (float64, bool) { return s.count, true })
+			// 窗口内没有日志时不输出平均值
+			writeFamily("", "gauge", func(s *logMetricSeries) (float64, bool) {
+				count, sum := s.window(now, window)
+				return sum / count, count > 0
+			})
+		}
+	}
+}
+
+// 日志指标列表接口
+func (s *Service) logMetricListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"metrics": s.logMetrics.List()})
+}
+
+// 定义或替换日志指标请求，samples 中的示例消息按新定义提取后随响应返回，便于确认正则
+type putLogMetricRequest struct {
+	LogMetric
+	Samples []string `json:"samples"`
+}
+
+// 示例消息的提取结果
+type logMetricSample struct {
+	Message string            `json:"message"`
+	Matched bool              `json:"matched"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Value   float64           `json:"value,omitempty"`
+}
+
+// 定义或替换日志指标接口
+func (s *Service) logMetricPutHandler(c *gin.Context) {
+	var req putLogMetricRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	m := req.LogMetric
+	if err := s.logMetrics.Put(&m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	samples := make([]logMetricSample, 0, len(req.Samples))
+	for _, msg := range req.Samples {
+		// 示例只检验正则，不受应用和级别条件限制
+		entry := LogData{ApplicationID: m.ApplicationID, LogLevel: m.Level, LogMessage: msg}
+		probe := m
+		probe.ApplicationID, probe.Level, probe.Field = "", "", "log_message"
+		labels, value, ok := probe.extract(&entry)
+		sample := logMetricSample{Message: msg, Matched: ok, Value: value}
+		for i := 0; i+1 < len(labels); i += 2 {
+			if sample.Labels == nil {
+				sample.Labels = make(map[string]string)
+			}
+			sample.Labels[labels[i]] = labels[i+1]
+		}
+		samples = append(samples, sample)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Log metric saved", "metric": m, "samples": samples})
+}
+
+// 删除日志指标接口
+func (s *Service) logMetricDeleteHandler(c *gin.Context) {
+	ok, err := s.logMetrics.Delete(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save log metrics"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log metric not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Log metric deleted"})
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Java HTTP appender 的兼容上传：请求体为 logstash-logback-encoder 的 LogstashEncoder、Log4j2 的 JsonLayout、
+// JsonTemplateLayout（LogstashJsonEventLayoutV1、EcsLayout）输出的 JSON 事件，可以是单个对象、数组或每行一个对象，
+// 按下面的字段名映射到日志字段，其余字段（包括 MDC）作为自定义字段保存
+var (
+	logstashTimestampKeys = []string{"@timestamp", "timestamp", "time"}
+	logstashLevelKeys     = []string{"level", "log.level", "severity"}
+	logstashMessageKeys   = []string{"message", "msg"}
+	logstashLoggerKeys    = []string{"logger_name", "loggerName", "logger", "log.logger"}
+	logstashThreadKeys    = []string{"thread_name", "thread", "threadName", "process.thread.name"}
+	logstashStackKeys     = []string{"stack_trace", "error.stack_trace", "exception.stacktrace", "exception.stack_trace", "thrown.extendedStackTrace"}
+	// Seata 放入 MDC 的键为 X-TX-XID、X-TX-BRANCH-ID
+	logstashXIDKeys    = []string{"xid", "X-TX-XID", "TX_XID"}
+	logstashBranchKeys = []string{"branch_id", "X-TX-BRANCH-ID", "TX_BRANCH_ID"}
+	logstashTraceKeys  = []string{"trace_id", "traceId", "X-B3-TraceId", "trace.id"}
+	logstashSpanKeys   = []string{"span_id", "spanId", "X-B3-SpanId", "span.id"}
+)
+
+// 不保存的布局元数据
+var logstashIgnoredKeys = map[string]bool{
+	"@version": true, "level_value": true, "ecs.version": true, "endOfBatch": true, "loggerFqcn": true,
+	"threadId": true, "threadPriority": true, "timeMillis": true, "instant.epochSecond": true, "instant.nanoOfSecond": true,
+}
+
+// 其内容直接作为自定义字段的 MDC 容器，logback 的 MDC 本身就在顶层
+var logstashMDCKeys = map[string]bool{"mdc": true, "contextMap": true, "context_map": true}
+
+var logstashRecords = metrics.counter("logstash_records_total", "Log entries received through the Logstash JSON endpoint.")
+
+// 把嵌套对象展开为以点分隔的键，数组的元素以逗号连接
+func flattenLogstash(prefix string, v map[string]any, out map[string]any) {
+	for key, value := range v {
+		if prefix == "" && logstashMDCKeys[key] {
+			if m, ok := value.(map[string]any); ok {
+				flattenLogstash("", m, out)
+				continue
+			}
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch value := value.(type) {
+		case map[string]any:
+			flattenLogstash(key, value, out)
+		case []any:
+			parts := make([]string, 0, len(value))
+			for _, item := range value {
+				if s := logstashString(item); s != "" {
+					parts = append(parts, s)
+				}
+			}
+			out[key] = strings.Join(parts, ",")
+		case nil:
+		default:
+			out[key] = value
+		}
+	}
+}
+
+func logstashString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return ""
+}
+
+// 取第一个存在的键并从 event 中删除，剩余的键作为自定义字段
+func takeLogstash(event map[string]any, keys []string) string {
+	value := ""
+	for _, key := range keys {
+		if v, ok := event[key]; ok {
+			if value == "" {
+				value = logstashString(v)
+			}
+			delete(event, key)
+		}
+	}
+	return value
+}
+
+// Log4j2 JsonLayout 的时间为 instant 对象或 timeMillis
+func logstashEpochTime(event map[string]any) string {
+	if s, ok := event["instant.epochSecond"].(json.Number); ok {
+		sec, err := s.Int64()
+		if err == nil {
+			var nanos int64
+			if n, ok := event["instant.nanoOfSecond"].(json.Number); ok {
+				nanos, _ = n.Int64()
+			}
+			return time.Unix(sec, nanos).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	if ms, ok := event["timeMillis"].(json.Number); ok {
+		return ms.String()
+	}
+	return ""
+}
+
+// 把一个 JSON 事件映射为日志，没有时间的取 now，没有级别的视为 INFO
+func logstashEntry(applicationID string, event map[string]any, now time.Time) (LogData, error) {
+	flat := make(map[string]any, len(event))
+	flattenLogstash("", event, flat)
+
+	entry := LogData{ApplicationID: applicationID}
+	entry.LogMessage = takeLogstash(flat, logstashMessageKeys)
+	if entry.LogMessage == "" {
+		return entry, errInvalidUpload
+	}
+	entry.Timestamp = takeLogstash(flat, logstashTimestampKeys)
+	if entry.Timestamp == "" {
+		entry.Timestamp = logstashEpochTime(flat)
+	}
+	if entry.Timestamp == "" {
+		entry.Timestamp = now.Format(time.RFC3339Nano)
+	}
+	entry.LogLevel = strings.Replace(strings.ToUpper(takeLogstash(flat, logstashLevelKeys)), "WARNING", "WARN", 1)
+	if entry.LogLevel == "" {
+		entry.LogLevel = "INFO"
+	}
+	entry.Logger = takeLogstash(flat, logstashLoggerKeys)
+	entry.Thread = takeLogstash(flat, logstashThreadKeys)
+	entry.XID = takeLogstash(flat, logstashXIDKeys)
+	entry.BranchID = takeLogstash(flat, logstashBranchKeys)
+	entry.TraceID = takeLogstash(flat, logstashTraceKeys)
+	entry.SpanID = takeLogstash(flat, logstashSpanKeys)
+
+	// 异常堆栈接在消息后面，与纯文本日志的多行合并一致
+	stack := takeLogstash(flat, logstashStackKeys)
+	if name := takeLogstash(flat, []string{"thrown.name"}); stack == "" && name != "" {
+		stack = name
+		if msg := takeLogstash(flat, []string{"thrown.message"}); msg != "" {
+			stack += ": " + msg
+		}
+	}
+	if stack != "" {
+		entry.LogMessage += "\n" + stack
+	}
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		if !logstashIgnoredKeys[key] && !strings.HasPrefix(key, "thrown.") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	// 自定义字段最多 64 个，按键名排序保留
+	for _, key := range keys[:min(len(keys), 64)] {
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[key] = logstashString(flat[key])
+	}
+	return entry, nil
+}
+
+// 解码请求体中的 JSON 事件：数组、单个对象或每行一个对象
+func decodeLogstashEvents(body []byte) ([]map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var events []map[string]any
+		if err := dec.Decode(&events); err != nil {
+			return nil, err
+		}
+		return events, nil
+	}
+	var events []map[string]any
+	for {
+		var event map[string]any
+		err := dec.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
+
+// Logstash JSON 上传接口：application_id 参数指定应用，同一请求中的事件都写入该应用，
+// 响应与 /upload/batch 相同，任何一条校验失败时整批拒绝
+func (s *Service) logstashUploadHandler(c *gin.Context) {
+	applicationID := c.Query("application_id")
+	if applicationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id is required"})
+		return
+	}
+	applicationID, ok := scopedApplicationID(c, applicationID)
+	if !ok {
+		return
+	}
+	body, ok := s.readUploadBody(c)
+	if !ok {
+		return
+	}
+	events, err := decodeLogstashEvents(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	if len(events) == 0 || len(events) > maxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Batch must contain 1 to %d entries", maxBatchSize)})
+		return
+	}
+
+	now := time.Now()
+	source := s.requestSourceIP(c)
+	entries := make([]LogData, len(events))
+	for i, event := range events {
+		entry, err := logstashEntry(applicationID, event, now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Entry %d has no message", i)})
+			return
+		}
+		if fieldTooLong(c, s.uploadLimits.checkEntry(entry), fmt.Sprintf("Entry %d: ", i)) {
+			return
+		}
+		if err := s.checkUploadTimestamp(&entry, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Entry %d has an invalid timestamp%s", i, timestampMismatch(err))})
+			return
+		}
+		entry.Source = source
+		entries[i] = entry
+	}
+
+	ids, duplicates, dropped, ok := s.ingestUploaded(c, entries)
+	if !ok {
+		return
+	}
+	logstashRecords.Add(float64(len(entries)))
+	auditCount(c, len(entries)-duplicates-dropped)
+	c.JSON(http.StatusOK, gin.H{"message": "Logs uploaded successfully", "accepted": len(entries), "duplicates": duplicates, "dropped": dropped, "ids": ids})
+}
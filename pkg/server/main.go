@@ -0,0 +1,653 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 日志数据结构，见 model.LogData
+type LogData = model.LogData
+
+// 日志上传接口
+func (s *Service) logUploadHandler(c *gin.Context) {
+	body, ok := s.readUploadBody(c)
+	if !ok {
+		return
+	}
+
+	// 解析请求体中的日志数据，纯文本行上传由服务端推断级别和时间戳
+	logData, ok, err := s.decodeUploadEntry(c, body, time.Now())
+	if !ok || fieldTooLong(c, err, "") {
+		return
+	}
+	if errors.Is(err, errInvalidTimestamp) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timestamp" + timestampMismatch(err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+
+	// 写入日志并执行后续处理
+	id, err := s.tryIngestEntry(logData)
+	if errors.Is(err, errDuplicateEntry) {
+		c.JSON(http.StatusOK, gin.H{"message": "Duplicate log ignored", "duplicate": true})
+		return
+	}
+	if errors.Is(err, errDroppedEntry) {
+		c.JSON(http.StatusOK, gin.H{"message": "Log dropped by pipeline", "dropped": true})
+		return
+	}
+	if err != nil {
+		if errors.Is(err, errIngestQueueFull) {
+			s.setBackpressureHeaders(c)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ingest queue is full, retry later"})
+			return
+		}
+		if errors.Is(err, errInvalidTimestamp) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timestamp"})
+			return
+		}
+		if errors.Is(err, errSchemaViolation) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Entry does not match the application schema", "violation": schemaViolation(err)})
+			return
+		}
+		if errors.Is(err, errTenantQuotaExceeded) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Tenant daily quota exceeded"})
+			return
+		}
+		if errors.Is(err, errDiskQuotaExceeded) {
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": "Application disk quota exceeded"})
+			return
+		}
+		if errors.Is(err, errApplicationReadOnly) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Application is archived or deleted and does not accept writes"})
+			return
+		}
+		if errors.Is(err, errIngestPaused) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ingestion is paused for the application"})
+			return
+		}
+		if errors.Is(err, errClickHouseBacklog) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage backend write backlog is full"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to write log to file"})
+		return
+	}
+
+	// 返回成功响应
+	auditCount(c, 1)
+	c.JSON(http.StatusOK, gin.H{"message": "Log uploaded successfully", "id": id})
+}
+
+// 查询日志接口
+func (s *Service) logQueryHandler(c *gin.Context) {
+	// 从查询参数中获取 application_id、log_level、view、sort、limit 以及可选的 from、to、since、since_id、max_id、fields、q、regex、highlight、explain
+	applicationID := c.Query("application_id")
+	logLevel := c.Query("log_level")
+	view := c.Query("view")
+	order := c.DefaultQuery("sort", sortDesc) // 默认最新的日志在前，增量查询默认最早的在前
+	if c.Query("sort") == "" && c.Query("since") != "" {
+		order = sortAsc
+	}
+	limitParam := c.DefaultQuery("limit", "100") // 默认返回100条
+
+	// 解析 limit 参数
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit <= 0 {
+		limit = 100 // 如果 limit 非法，设置默认值
+	}
+	if max := s.cfg.Query.maxLimit(); limit > max {
+		limit = max
+	}
+
+	// 检查参数是否存在，在视图上查询时可以不指定应用和级别
+	if view == "" && (applicationID == "" || logLevel == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id and log_level are required"})
+		return
+	}
+	if order != sortAsc && order != sortDesc {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be asc or desc"})
+		return
+	}
+	if rejectTenantView(c, view) {
+		return
+	}
+	// application_id 可以是逗号分隔的多个应用、通配模式（如 order-*）或分组引用（如 @payments:prod），结果按时间合并
+	storeID := applicationID
+	var storeIDs []string
+	multi := view == "" && (strings.Contains(applicationID, ",") || isApplicationPattern(applicationID) || isGroupReference(applicationID))
+	if view == "" {
+		var ok bool
+		if multi {
+			if storeIDs, ok = s.queryApplications(c, applicationID); !ok {
+				return
+			}
+			if len(storeIDs) == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No application matches application_id"})
+				return
+			}
+		} else if storeID, ok = s.queriedApplicationID(c, applicationID); !ok {
+			return
+		}
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+	sinceID, maxID, ok := parseIDRange(c)
+	if !ok {
+		return
+	}
+	if multi && (sinceID > 0 || maxID > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since_id and max_id require a single application_id"})
+		return
+	}
+
+	project, ok := parseProjection(c)
+	if !ok {
+		return
+	}
+	search, ok := parseSearch(c)
+	if !ok {
+		return
+	}
+	highlight, ok := parseHighlight(c, search)
+	if !ok {
+		return
+	}
+	explain, ok := parseExplain(c)
+	if !ok {
+		return
+	}
+
+	q := logQuery{ApplicationID: storeID, ApplicationIDs: storeIDs, LogLevel: logLevel, View: view, Fields: parseFieldFilters(c), From: from, To: to, SinceID: sinceID, MaxID: maxID, Search: search, ctx: c.Request.Context(), explain: explain}
+	// 归档到对象存储的旧分段只在 include_archive=true 时读取
+	q.Archive = &archiveScan{Include: c.Query("include_archive") == "true"}
+	if !applyDeltaCursor(c, &q) {
+		return
+	}
+	if c.Query("count") == "true" {
+		s.logCountHandler(c, q)
+		return
+	}
+
+	// 遍历日志，按时间排序后取前 limit 条，JSON 响应同时附带按文件的概览（summary=false 时省略）
+	var summary *querySummary
+	if !wantsNDJSON(c) && c.Query("summary") != "false" {
+		summary = newQuerySummary()
+	}
+	began := time.Now()
+	hits, err := s.collectSorted(q, order, limit, summary)
+	explain.phase("scan", began)
+	if errors.Is(err, errViewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+		return
+	}
+	// 与 count=true 相同，单个应用没有日志目录时返回 404
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	// 增量查询的游标在按时区改写时间戳之前计算
+	next := ""
+	if q.incremental() {
+		next = nextDeltaCursor(q, hits, limit, order)
+	}
+
+	// 指定 tz 时按该时区显示时间戳，否则为存储的 UTC 时间
+	loc := time.UTC
+	if c.Query("tz") != "" {
+		loc, _ = parseLocation(c)
+		localizeTimestamps(hits, loc)
+	}
+
+	// 逐条写出结构化的日志结果，默认为 JSON 对象，也可以按 NDJSON 流式返回
+	meta := gin.H{
+		"application_id": applicationID,
+		"log_level":      logLevel,
+		"sort":           order,
+	}
+	if summary != nil {
+		meta["summary"] = summary.Files(loc)
+	}
+	if next != "" {
+		// NDJSON 响应没有元数据，游标放在响应头中
+		meta["next_since"] = next
+		c.Header("X-Next-Since", next)
+	}
+	if q.Archive.used() {
+		meta["archive"] = q.Archive
+		if q.Archive.Skipped > 0 {
+			c.Header("X-Archive-Skipped", strconv.Itoa(q.Archive.Skipped))
+		}
+	}
+	if !wantsNDJSON(c) {
+		began = time.Now()
+		meta["annotations"] = s.queryAnnotations(q, hits)
+		explain.phase("annotations", began)
+	}
+	if explain != nil {
+		explain.Returned = len(hits)
+		meta["explain"] = explain.finish()
+	}
+	count, _ := s.writeQueryResults(c, meta, hits, project, highlight)
+	auditCount(c, count)
+}
+
+// 辅助函数：追加日志到文件，新建的文件先写入格式版本头，写入后按持久化策略同步，返回这条日志在文件中的偏移。
+// 文件句柄取自句柄缓存，同一文件的追加依次进行
+func (s *Service) appendToFile(filePath, logEntry string) (int64, error) {
+	handle, err := s.fileHandles.Acquire(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer s.fileHandles.Release(handle)
+	file := handle.file
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	offset := info.Size()
+	created := offset == 0
+	if created {
+		logEntry = formatHeaderLine + logEntry
+		offset = int64(len(formatHeaderLine))
+	}
+
+	_, err = file.WriteString(logEntry)
+	if err != nil {
+		handle.discard()
+		return 0, err
+	}
+
+	return offset, s.durability.Written(file, created)
+}
+
+// 程序入口：执行 agent、seata-log 等子命令，否则按 -config 启动服务。根目录的 main 包只调用它，
+// 需要引入插件的程序可以在自己的 main 包中空白导入插件后调用
+func Main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "agent":
+			runAgent(os.Args[2:])
+			return
+		case "snapshot":
+			runSnapshot(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "seata-log":
+			runCLI(os.Args[2:])
+			return
+		case "loadgen":
+			runLoadgen(os.Args[2:])
+			return
+		}
+	}
+
+	configPath := flag.String("config", "config.json", "path to the JSON config file")
+	flag.Parse()
+
+	// 加载配置
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Unable to load config: %v", err)
+	}
+	// 初始化存储、写入和分析组件
+	s := newService(c)
+	if err := s.openEngine(); err != nil {
+		s.fatalf("Unable to start: %v", err)
+	}
+
+	// 初始化只有 HTTP 服务使用的组件和 Gin 路由
+	router, err := s.Handler()
+	if err != nil {
+		s.fatalf("Unable to start HTTP server: %v", err)
+	}
+
+	// 启动服务器
+	var tlsConfig *tls.Config
+	if s.cfg.TLS.Enabled() {
+		if tlsConfig, err = buildServerTLSConfig(s.cfg.TLS); err != nil {
+			s.fatalf("Unable to load TLS config: %v", err)
+		}
+	}
+	srv, err := newHTTPServer(s.cfg.Server, s.cfg.Listen, router, tlsConfig)
+	if err != nil {
+		s.fatalf("Invalid server config: %v", err)
+	}
+
+	// Fluent forward 协议输入
+	forward, err := s.startForwardServer(s.cfg.Forward, tlsConfig)
+	if err != nil {
+		s.fatalf("Unable to start forward input: %v", err)
+	}
+	if forward != nil {
+		s.registerShutdownHook("forward input", forward.Close)
+	}
+
+	// syslog 输入
+	syslog, err := s.startSyslogServer(s.cfg.Syslog)
+	if err != nil {
+		s.fatalf("Unable to start syslog input: %v", err)
+	}
+	if syslog != nil {
+		s.registerShutdownHook("syslog input", syslog.Close)
+	}
+
+	// gRPC 接口
+	grpcSrv, err := s.startGRPCServer(s.cfg.GRPC, tlsConfig)
+	if err != nil {
+		s.fatalf("Unable to start gRPC service: %v", err)
+	}
+	if grpcSrv != nil {
+		s.registerShutdownHook("grpc service", grpcSrv.Close)
+	}
+	ln, err := listenHTTP(s.cfg.Server, s.cfg.Listen)
+	if err != nil {
+		s.fatalf("Unable to listen on %s: %v", s.cfg.Listen, err)
+	}
+	fmt.Printf("Server is running on port %s\n", s.cfg.Listen)
+	if err := s.serveWithGracefulShutdown(srv, ln, time.Duration(s.cfg.ShutdownTimeout)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 按 cfg 初始化存储、写入和分析使用的全部组件，并登记停机清理函数；HTTP 服务和嵌入式 Service 共用
+func (s *Service) openEngine() error {
+	var err error
+	if err := os.MkdirAll(s.cfg.DataDir, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create data directory: %w", err)
+	}
+
+	// 初始化存储后端
+	s.tenants = newTenantRegistry(s.cfg.Tenants, s.systemEvents)
+	if err := s.tenants.validate(); err != nil {
+		return fmt.Errorf("invalid tenant config: %w", err)
+	}
+	if err := s.cfg.Rotation.validate(); err != nil {
+		return fmt.Errorf("invalid rotation config: %w", err)
+	}
+	if err := s.cfg.Localization.validate(); err != nil {
+		return fmt.Errorf("invalid localization config: %w", err)
+	}
+	// 分段的静态加密，读取任何分段之前加载密钥
+	s.encryption, err = newLineCipher(s.cfg.Encryption)
+	if err != nil {
+		return fmt.Errorf("invalid encryption config: %w", err)
+	}
+	s.storageRouting, err = newStorageRouter(s.cfg.StorageRouting)
+	if err != nil {
+		return fmt.Errorf("invalid storage routing config: %w", err)
+	}
+	s.storageVolumes, err = newVolumeSet(s.cfg.StorageVolumes)
+	if err != nil {
+		return fmt.Errorf("invalid storage volumes config: %w", err)
+	}
+	// 追加写入复用的文件句柄，在存储后端写出缓冲之后关闭
+	s.fileHandles, err = newFileHandleCache(s.cfg.FileHandles)
+	if err != nil {
+		return fmt.Errorf("invalid file_handles config: %w", err)
+	}
+	s.registerShutdownHook("file handles", s.fileHandles.Close)
+	s.backends, err = s.newBackendRegistry(s.cfg.Backends, s.cfg.StorageRoot, s.cfg.DataDir, s.cfg.Rotation, s.tenants)
+	if err != nil {
+		return fmt.Errorf("unable to initialize storage backends: %w", err)
+	}
+	s.registerShutdownHook("storage backends", s.backends.Close)
+	// 修复上次断电或崩溃时写到一半的分段末尾，之后才开始写入
+	s.recoverSegmentTails(s.backends)
+	s.durability, err = newFileSyncer(s.cfg.Durability)
+	if err != nil {
+		return fmt.Errorf("invalid durability config: %w", err)
+	}
+	if s.durability != nil {
+		s.registerShutdownHook("fsync", s.durability.Close)
+	}
+	s.logIDs, err = s.newLogIDAllocator(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load log IDs: %w", err)
+	}
+	if compressor := s.startSegmentCompressor(s.backends, s.cfg.Rotation); compressor != nil {
+		s.registerShutdownHook("segment compressor", compressor.Close)
+	}
+	s.tiering, err = s.startSegmentTierer(s.backends, s.cfg.Tiering, s.cfg.DataDir, s.cfg.Rotation)
+	if err != nil {
+		return fmt.Errorf("invalid tiering config: %w", err)
+	}
+	if s.tiering != nil {
+		s.registerShutdownHook("segment tiering", s.tiering.Close)
+	}
+
+	// 写入失败的日志
+	s.deadLetters, err = s.newDeadLetterStore(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load dead letters: %w", err)
+	}
+
+	// 应用的写入校验
+	s.schemas, err = newSchemaRegistry(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load schemas: %w", err)
+	}
+	s.groups, err = newGroupRegistry(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load groups: %w", err)
+	}
+	s.parsers, err = newParserRegistry(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load parsers: %w", err)
+	}
+	s.timestampFormats, err = newTimestampFormatRegistry(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load timestamp formats: %w", err)
+	}
+
+	// 从启动和注册日志中识别的 Seata 版本
+	s.seataVersions, err = newSeataVersionRegistry(s.cfg.DataDir, s.systemEvents)
+	if err != nil {
+		return fmt.Errorf("unable to load seata versions: %w", err)
+	}
+	s.logMetrics, err = newLogMetricRegistry(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load log metrics: %w", err)
+	}
+
+	// 排障注记
+	s.annotations, err = newAnnotationStore(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load annotations: %w", err)
+	}
+
+	// 写入前处理流水线
+	s.pipeline, err = newIngestPipeline(s.cfg.Pipeline)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline config: %w", err)
+	}
+	s.escalations, err = newEscalationRules(s.cfg.Escalation)
+	if err != nil {
+		return fmt.Errorf("invalid escalation config: %w", err)
+	}
+	s.jsonMessages, err = newJSONMessageParser(s.cfg.JSONMessage)
+	if err != nil {
+		return fmt.Errorf("invalid json_message config: %w", err)
+	}
+	s.tcNodes, err = newTCNodeTagger(s.cfg.TCNode)
+	if err != nil {
+		return fmt.Errorf("invalid tc_node config: %w", err)
+	}
+	s.queryMaskRules, err = compileMaskRules(s.cfg.QueryMask)
+	if err != nil {
+		return fmt.Errorf("invalid query_mask config: %w", err)
+	}
+
+	// 写入延迟监控
+	s.writeLatency, err = newWriteLatencyTracker(s.cfg.WriteLatency)
+	if err != nil {
+		return fmt.Errorf("invalid write_latency config: %w", err)
+	}
+	s.ingestLag, err = s.newIngestLagTracker(s.cfg.IngestLag)
+	if err != nil {
+		return fmt.Errorf("invalid ingest_lag config: %w", err)
+	}
+
+	// 应用的磁盘配额
+	s.diskQuotas, err = s.newDiskQuotaManager(s.cfg.DiskQuota)
+	if err != nil {
+		return fmt.Errorf("invalid disk_quota config: %w", err)
+	}
+
+	// 应用的归档、法律保留和软删除
+	s.lifecycle, err = s.newLifecycleRegistry(s.cfg.DataDir, s.cfg.Lifecycle)
+	if err != nil {
+		return fmt.Errorf("invalid lifecycle config: %w", err)
+	}
+	s.lifecycle.Start()
+	s.registerShutdownHook("application lifecycle", s.lifecycle.Close)
+
+	// 按级别的保留策略
+	s.retention, err = s.newRetentionManager(s.cfg.Retention)
+	if err != nil {
+		return fmt.Errorf("invalid retention config: %w", err)
+	}
+	s.retention.Start()
+	s.registerShutdownHook("retention", s.retention.Close)
+
+	// 按应用暂停写入
+	s.ingestPauses, err = s.newIngestPauseRegistry(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load ingest pauses: %w", err)
+	}
+	s.registerShutdownHook("ingest pauses", s.ingestPauses.Close)
+
+	// 集群成员与应用归属
+	s.cluster, err = s.startCluster(s.cfg.Cluster)
+	if err != nil {
+		return fmt.Errorf("invalid cluster config: %w", err)
+	}
+	if s.cluster != nil {
+		s.registerShutdownHook("cluster heartbeat", s.cluster.Close)
+	}
+
+	// 重试上传的去重
+	s.dedup = newDedupCache(s.cfg.Dedup)
+
+	// 查询结果的分段缓存
+	s.queryCache = newSegmentCache(s.cfg.Query.cacheBytes())
+	s.queryLimits, err = newQueryLimiter(s.cfg.Query)
+	if err != nil {
+		return fmt.Errorf("invalid query config: %w", err)
+	}
+
+	// 直方图和统计使用的计数索引
+	s.histogramCounts, err = s.newCountIndex(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to create histogram index: %w", err)
+	}
+	s.registerShutdownHook("count index", s.histogramCounts.Close)
+
+	// 按 XID 查询事务时跳过分段的布隆过滤器
+	s.xidBlooms, err = s.newXIDBloomIndex(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to create XID bloom index: %w", err)
+	}
+
+	// 导出为 Parquet 文件
+	s.exports, err = s.newExportManager(s.cfg.DataDir, s.cfg.Export)
+	if err != nil {
+		return fmt.Errorf("invalid export config: %w", err)
+	}
+
+	// 初始化告警引擎
+	s.alertEngine, err = s.newAlertEngine(s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load alert rules: %w", err)
+	}
+	s.registerShutdownHook("alert engine", s.alertEngine.Close)
+	s.retryStorms = s.newRetryStormDetector(s.cfg.RetryStorm)
+	// 插件在告警引擎之后初始化，Init 中即可触发告警
+	s.plugins, err = s.newPluginManager(s.cfg.Plugins)
+	if err != nil {
+		return fmt.Errorf("invalid plugins config: %w", err)
+	}
+	s.registerShutdownHook("plugins", s.plugins.Close)
+	if s.anomalies = s.newAnomalyDetector(s.cfg.Anomaly); s.anomalies != nil {
+		s.anomalies.Start()
+		s.registerShutdownHook("anomaly detection", s.anomalies.Close)
+	}
+	s.ingestLag.Start()
+	s.registerShutdownHook("ingest lag", s.ingestLag.Close)
+
+	// 定期报告
+	s.reports, err = s.newReportScheduler(s.cfg.DataDir, s.cfg.Reports)
+	if err != nil {
+		return fmt.Errorf("invalid report config: %w", err)
+	}
+	s.reports.Start()
+	s.registerShutdownHook("reports", s.reports.Close)
+
+	// 定期执行的分析任务
+	s.jobs, err = s.newJobScheduler(s.cfg.DataDir, s.cfg.Jobs)
+	if err != nil {
+		return fmt.Errorf("invalid jobs config: %w", err)
+	}
+	s.jobs.Start()
+	s.registerShutdownHook("jobs", s.jobs.Close)
+
+	// 输出转发，停机时在写入工作池之后关闭，发送完写入的日志
+	s.outputs, err = newOutputSet(s.cfg.Outputs)
+	if err != nil {
+		return fmt.Errorf("invalid outputs config: %w", err)
+	}
+	if s.outputs != nil {
+		s.registerShutdownHook("outputs", s.outputs.Close)
+	}
+
+	// 主备复制，停机时在写入工作池之后关闭，写完队列中的日志再停止推送
+	s.replication, err = newReplicator(s.cfg.Replication, s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("invalid replication config: %w", err)
+	}
+	if s.replication != nil {
+		s.replication.Start()
+		s.registerShutdownHook("replication", s.replication.Close)
+	}
+	s.replica, err = s.newReplicaReceiver(s.cfg.Replication, s.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("unable to load replication state: %w", err)
+	}
+
+	// 写入工作池，停机时先于存储后端关闭，写完队列中的日志
+	s.ingestWorkers, err = s.newIngestPool(s.cfg.Ingest)
+	if err != nil {
+		return fmt.Errorf("invalid ingest config: %w", err)
+	}
+	s.registerShutdownHook("ingest workers", s.ingestWorkers.Close)
+	s.uploadLimits, err = s.cfg.UploadLimits.resolve()
+	if err != nil {
+		return fmt.Errorf("invalid upload limits config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 脱敏规则：把匹配正则的内容替换为 replacement，可以引用分组如 $1
+type MaskRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"` // 默认 ***
+}
+
+// 脱敏配置：内置规则集加自定义规则
+type MaskConfig struct {
+	Presets []string   `json:"presets"` // credit_card、phone、email、jdbc_password
+	Rules   []MaskRule `json:"rules"`
+}
+
+// 编译后的脱敏规则，replace 为 nil 时使用 replacement 模板
+type maskRule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+	replace     func(match string) string
+}
+
+var maskedValues = metrics.counter("masked_values_total", "Sensitive values replaced by masking rules.")
+
+// 内置规则集
+var maskPresets = map[string][]maskRule{
+	// 13 到 19 位、可带空格或连字符的卡号，通过 Luhn 校验的才脱敏，保留后四位
+	"credit_card": {{
+		name:    "credit_card",
+		re:      regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		replace: maskCardNumber,
+	}},
+	// 中国大陆手机号和带国家码的号码，保留前三位和后四位
+	"phone": {{
+		name:    "phone",
+		re:      regexp.MustCompile(`(?:\+\d{1,3}[ -]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[ -]?\d{6,14}\b`),
+		replace: maskKeepEnds(3, 4),
+	}},
+	"email": {{
+		name:        "email",
+		re:          regexp.MustCompile(`\b([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*(@[A-Za-z0-9.-]+\.[A-Za-z]{2,})\b`),
+		replacement: "${1}***${2}",
+	}},
+	// JDBC 连接串和配置中的密码，以及 Seata undo log 中 SQL 对密码列的赋值
+	"jdbc_password": {
+		{
+			name:        "jdbc_password",
+			re:          regexp.MustCompile(`(?i)\b((?:password|passwd|pwd)\s*[=:]\s*)([^\s;&,'"]+)`),
+			replacement: "${1}***",
+		},
+		{
+			name:        "sql_password",
+			re:          regexp.MustCompile(`(?i)(\b(?:password|passwd|pwd)\b` + "`?" + `\s*=\s*)'(?:[^'\\]|\\.|'')*'`),
+			replacement: "${1}'***'",
+		},
+	},
+}
+
+// 编译脱敏配置
+func compileMaskRules(c MaskConfig) ([]maskRule, error) {
+	var rules []maskRule
+	for _, name := range c.Presets {
+		preset, ok := maskPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown mask preset %q", name)
+		}
+		rules = append(rules, preset...)
+	}
+	for i, r := range c.Rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("mask rule %d: %w", i, err)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if r.Replacement == "" {
+			r.Replacement = "***"
+		}
+		rules = append(rules, maskRule{name: r.Name, re: re, replacement: r.Replacement})
+	}
+	return rules, nil
+}
+
+// 对一段文本应用全部规则
+func maskText(rules []maskRule, s string) string {
+	for _, r := range rules {
+		if !r.re.MatchString(s) {
+			continue
+		}
+		before := s
+		if r.replace != nil {
+			s = r.re.ReplaceAllStringFunc(s, r.replace)
+		} else {
+			s = r.re.ReplaceAllString(s, r.replacement)
+		}
+		if s != before {
+			maskedValues.Add(1, "rule", r.name)
+		}
+	}
+	return s
+}
+
+// 对日志消息和全部自定义字段脱敏。字段 map 可能与实时订阅者共享，脱敏结果写入新的 map
+func maskEntry(rules []maskRule, entry *LogData) {
+	if len(rules) == 0 {
+		return
+	}
+	entry.LogMessage = maskText(rules, entry.LogMessage)
+	if len(entry.Fields) == 0 {
+		return
+	}
+	fields := make(map[string]string, len(entry.Fields))
+	for k, v := range entry.Fields {
+		fields[k] = maskText(rules, v)
+	}
+	entry.Fields = fields
+}
+
+// 卡号通过 Luhn 校验时只保留后四位
+func maskCardNumber(match string) string {
+	var digits []byte
+	for i := 0; i < len(match); i++ {
+		if match[i] >= '0' && match[i] <= '9' {
+			digits = append(digits, match[i])
+		}
+	}
+	if !luhnValid(digits) {
+		return match
+	}
+	return strings.Repeat("*", len(digits)-4) + string(digits[len(digits)-4:])
+}
+
+func luhnValid(digits []byte) bool {
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return len(digits) >= 13 && sum%10 == 0
+}
+
+// 保留开头 head 个和结尾 tail 个字符，中间替换为 *
+func maskKeepEnds(head, tail int) func(string) string {
+	return func(match string) string {
+		if len(match) <= head+tail {
+			return strings.Repeat("*", len(match))
+		}
+		return match[:head] + strings.Repeat("*", len(match)-head-tail) + match[len(match)-tail:]
+	}
+}
+
+// 写入前脱敏的处理器
+type maskProcessor struct {
+	rules []maskRule
+}
+
+func (p *maskProcessor) Process(entry *LogData) bool {
+	maskEntry(p.rules, entry)
+	return true
+}
+
+// 返回给查询方之前脱敏
+func (s *Service) maskQueryEntry(entry *LogData) {
+	maskEntry(s.queryMaskRules, entry)
+}
+
+func init() {
+	processorTypes["mask"] = func(c ProcessorConfig) (processor, error) {
+		rules, err := compileMaskRules(c.MaskConfig)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) == 0 {
+			return nil, errors.New("mask requires presets or rules")
+		}
+		return &maskProcessor{rules: rules}, nil
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 简单的指标注册表，按 Prometheus 文本格式输出
+type metricRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+// 一组同名指标，按标签区分
+type metricFamily struct {
+	name string
+	help string
+	kind string // counter 或 gauge
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+var metrics = &metricRegistry{families: make(map[string]*metricFamily)}
+
+func (r *metricRegistry) family(name, help, kind string) *metricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	f := &metricFamily{name: name, help: help, kind: kind, values: make(map[string]float64)}
+	r.families[name] = f
+	return f
+}
+
+// 注册（或获取）计数器
+func (r *metricRegistry) counter(name, help string) *metricFamily {
+	return r.family(name, help, "counter")
+}
+
+// 注册（或获取）仪表
+func (r *metricRegistry) gauge(name, help string) *metricFamily {
+	return r.family(name, help, "gauge")
+}
+
+// 标签以 key, value 成对传入
+func labelKey(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// 增加指标值
+func (f *metricFamily) Add(v float64, labels ...string) {
+	key := labelKey(labels)
+	f.mu.Lock()
+	f.values[key] += v
+	f.mu.Unlock()
+}
+
+// 设置指标值
+func (f *metricFamily) Set(v float64, labels ...string) {
+	key := labelKey(labels)
+	f.mu.Lock()
+	f.values[key] = v
+	f.mu.Unlock()
+}
+
+// 按文本格式写出全部指标
+func (r *metricRegistry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.mu.Lock()
+		f := r.families[name]
+		r.mu.Unlock()
+
+		f.mu.Lock()
+		keys := make([]string, 0, len(f.values))
+		for key := range f.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s%s %g\n", f.name, key, f.values[key])
+		}
+		f.mu.Unlock()
+	}
+}
+
+// 指标接口
+func (s *Service) metricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(http.StatusOK)
+	metrics.WriteText(c.Writer)
+	s.writeLatency.WriteText(c.Writer)
+	s.logMetrics.WriteText(c.Writer)
+}
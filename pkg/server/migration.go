@@ -0,0 +1,313 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/storage"
+)
+
+// 迁移阶段
+const (
+	migrationPending   = "pending"
+	migrationCopying   = "copying"
+	migrationCatchUp   = "catching_up" // 暂停写入，复制迁移期间新增的日志
+	migrationVerifying = "verifying"
+	migrationCutover   = "cutover"
+	migrationDone      = "done"
+	migrationFailed    = "failed"
+)
+
+// 迁移任务
+type migrationJob struct {
+	ID            string     `json:"id"`
+	ApplicationID string     `json:"application_id"`
+	Source        string     `json:"source"`
+	Target        string     `json:"target"`
+	RateLimit     int        `json:"rate_limit"` // 每秒最多复制的日志条数，0 表示不限
+	Cutover       bool       `json:"cutover"`
+	DeleteSource  bool       `json:"delete_source"`
+	Phase         string     `json:"phase"`
+	Copied        int        `json:"copied"`
+	SourceCount   int        `json:"source_count"`
+	TargetCount   int        `json:"target_count"`
+	Checksum      string     `json:"checksum,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// 迁移任务管理
+type migrationManager struct {
+	svc    *Service
+	mu     sync.Mutex
+	seq    int
+	jobs   map[string]*migrationJob
+	active map[string]string // 应用 ID → 进行中的任务 ID
+}
+
+// 创建迁移任务并在后台执行
+func (m *migrationManager) Start(job *migrationJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, ok := m.active[job.ApplicationID]; ok {
+		return fmt.Errorf("migration %s is already running for %s", id, job.ApplicationID)
+	}
+	m.seq++
+	job.ID = strconv.Itoa(m.seq)
+	job.Phase = migrationPending
+	job.StartedAt = time.Now()
+	m.jobs[job.ID] = job
+	m.active[job.ApplicationID] = job.ID
+
+	go m.run(job)
+	return nil
+}
+
+// 读取任务快照
+func (m *migrationManager) Get(id string) (migrationJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return migrationJob{}, false
+	}
+	return *job, true
+}
+
+// 列出所有任务
+func (m *migrationManager) List() []migrationJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]migrationJob, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+	return jobs
+}
+
+func (m *migrationManager) update(job *migrationJob, fn func(job *migrationJob)) {
+	m.mu.Lock()
+	fn(job)
+	m.mu.Unlock()
+}
+
+// 执行迁移：全量复制 → 暂停写入并追平增量 → 校验 → 切换 → 恢复写入
+func (m *migrationManager) run(job *migrationJob) {
+	err := m.migrate(job)
+
+	m.mu.Lock()
+	delete(m.active, job.ApplicationID)
+	now := time.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Phase = migrationFailed
+		job.Error = err.Error()
+	} else {
+		job.Phase = migrationDone
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		log.Printf("migration %s for %s failed: %v", job.ID, job.ApplicationID, err)
+		m.svc.systemEvents.Publish(eventMigration, job.ApplicationID, "Migration failed: "+err.Error(), gin.H{"id": job.ID, "phase": migrationFailed})
+	} else {
+		log.Printf("migration %s for %s completed: %d entries", job.ID, job.ApplicationID, job.Copied)
+		m.svc.systemEvents.Publish(eventMigration, job.ApplicationID, fmt.Sprintf("Migration completed: %d entries", job.Copied), gin.H{"id": job.ID, "phase": migrationDone})
+	}
+}
+
+func (m *migrationManager) migrate(job *migrationJob) error {
+	source, _, _ := m.svc.backends.Store(job.Source)
+	target, _, _ := m.svc.backends.Store(job.Target)
+
+	// 目标上可能残留上次失败的迁移数据
+	if err := target.RemoveApplication(job.ApplicationID); err != nil {
+		return fmt.Errorf("clean target: %v", err)
+	}
+
+	m.update(job, func(job *migrationJob) { job.Phase = migrationCopying })
+	cursor, err := m.copyFrom(job, source, target, storage.Cursor{}, true)
+	if err != nil {
+		return err
+	}
+
+	// 暂停该应用的写入，直到切换完成
+	gate := m.svc.backends.WriteGate(job.ApplicationID)
+	gate.Lock()
+	defer gate.Unlock()
+
+	m.update(job, func(job *migrationJob) { job.Phase = migrationCatchUp })
+	if _, err := m.copyFrom(job, source, target, cursor, false); err != nil {
+		return err
+	}
+
+	m.update(job, func(job *migrationJob) { job.Phase = migrationVerifying })
+	sourceCount, sourceSum, err := checksumStore(source, job.ApplicationID)
+	if err != nil {
+		return fmt.Errorf("verify source: %v", err)
+	}
+	targetCount, targetSum, err := checksumStore(target, job.ApplicationID)
+	if err != nil {
+		return fmt.Errorf("verify target: %v", err)
+	}
+	m.update(job, func(job *migrationJob) {
+		job.SourceCount, job.TargetCount, job.Checksum = sourceCount, targetCount, targetSum
+	})
+	if sourceCount != targetCount || sourceSum != targetSum {
+		return fmt.Errorf("verification failed: source %d entries (%s), target %d entries (%s)",
+			sourceCount, sourceSum, targetCount, targetSum)
+	}
+
+	if !job.Cutover {
+		return nil
+	}
+	m.update(job, func(job *migrationJob) { job.Phase = migrationCutover })
+	if err := m.svc.backends.Place(job.ApplicationID, job.Target); err != nil {
+		return fmt.Errorf("cutover: %v", err)
+	}
+	if job.DeleteSource {
+		if err := source.RemoveApplication(job.ApplicationID); err != nil {
+			return fmt.Errorf("delete source after cutover: %v", err)
+		}
+	}
+	return nil
+}
+
+// 从游标处开始复制日志，throttle 为 true 时按 rate_limit 限速
+func (m *migrationManager) copyFrom(job *migrationJob, source, target storage.LogStore, cursor storage.Cursor, throttle bool) (storage.Cursor, error) {
+	var copyErr error
+	batchStart := time.Now()
+	inBatch := 0
+
+	next, err := source.ScanFrom(job.ApplicationID, cursor, func(entry LogData, ref logRef) bool {
+		if copyErr = target.AppendEntry(job.ApplicationID, ref.File, entry); copyErr != nil {
+			return false
+		}
+		m.update(job, func(job *migrationJob) { job.Copied++ })
+
+		if throttle && job.RateLimit > 0 {
+			inBatch++
+			if inBatch >= job.RateLimit {
+				if elapsed := time.Since(batchStart); elapsed < time.Second {
+					time.Sleep(time.Second - elapsed)
+				}
+				batchStart = time.Now()
+				inBatch = 0
+			}
+		}
+		return true
+	})
+	if copyErr != nil {
+		return next, fmt.Errorf("write target: %v", copyErr)
+	}
+	if err != nil {
+		return next, fmt.Errorf("read source: %v", err)
+	}
+	return next, nil
+}
+
+// 计算后端中应用日志的条数和内容摘要，用于校验迁移结果
+func checksumStore(store storage.LogStore, applicationID string) (int, string, error) {
+	h := sha256.New()
+	count := 0
+	_, err := store.ScanFrom(applicationID, storage.Cursor{}, func(entry LogData, ref logRef) bool {
+		record, err := encodeLogRecord(entry)
+		if err != nil {
+			return true
+		}
+		h.Write([]byte(ref.File))
+		h.Write([]byte(record))
+		count++
+		return true
+	})
+	return count, hex.EncodeToString(h.Sum(nil))[:16], err
+}
+
+// 创建迁移任务请求
+type migrationRequest struct {
+	ApplicationID string `json:"application_id" binding:"required"`
+	Target        string `json:"target" binding:"required"`
+	RateLimit     int    `json:"rate_limit"`
+	Cutover       *bool  `json:"cutover"` // 默认校验通过后切换
+	DeleteSource  bool   `json:"delete_source"`
+}
+
+// 创建迁移任务接口
+func (s *Service) migrationCreateHandler(c *gin.Context) {
+	var req migrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+
+	source := s.backends.BackendOf(req.ApplicationID)
+	if _, _, ok := s.backends.Store(req.Target); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown target backend"})
+		return
+	}
+	if req.Target == source {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Application is already on the target backend"})
+		return
+	}
+	if req.DeleteSource && s.lifecycle.Retained(req.ApplicationID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Application is archived or under legal hold; delete_source is not allowed"})
+		return
+	}
+
+	job := &migrationJob{
+		ApplicationID: req.ApplicationID,
+		Source:        source,
+		Target:        req.Target,
+		RateLimit:     req.RateLimit,
+		Cutover:       req.Cutover == nil || *req.Cutover,
+		DeleteSource:  req.DeleteSource,
+	}
+	if err := s.migrations.Start(job); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshot, _ := s.migrations.Get(job.ID)
+	c.JSON(http.StatusAccepted, snapshot)
+}
+
+// 迁移任务列表接口
+func (s *Service) migrationListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"migrations": s.migrations.List()})
+}
+
+// 迁移任务详情接口
+func (s *Service) migrationGetHandler(c *gin.Context) {
+	job, ok := s.migrations.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Migration not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// 存储后端列表接口
+func (s *Service) backendListHandler(c *gin.Context) {
+	type backendInfo struct {
+		Name string `json:"name"`
+		BackendConfig
+	}
+	var list []backendInfo
+	for _, name := range s.backends.Names() {
+		_, bc, _ := s.backends.Store(name)
+		bc.Password = ""
+		list = append(list, backendInfo{Name: name, BackendConfig: bc})
+	}
+	c.JSON(http.StatusOK, gin.H{"backends": list})
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// 最小的 MessagePack 编解码，仅覆盖 Fluent forward 协议用到的类型
+
+// 单个字符串、二进制或扩展值的最大长度，以及数组、map 的最大元素数，防止恶意数据占满内存
+const (
+	maxMsgpackBytes = 64 << 20
+	maxMsgpackItems = 1 << 20
+)
+
+// 扩展类型的值，如 Fluent 的 EventTime（类型 0）
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+type msgpackDecoder struct {
+	r *bufio.Reader
+}
+
+func newMsgpackDecoder(r io.Reader) *msgpackDecoder {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &msgpackDecoder{r: br}
+	}
+	return &msgpackDecoder{r: bufio.NewReader(r)}
+}
+
+func (d *msgpackDecoder) readN(n int) ([]byte, error) {
+	if n > maxMsgpackBytes {
+		return nil, fmt.Errorf("msgpack value of %d bytes exceeds limit", n)
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(d.r, buf)
+	return buf, err
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	buf, err := d.readN(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(buf)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(buf)), nil
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (d *msgpackDecoder) readLen(size int) (int, error) {
+	n, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxInt32 {
+		return 0, fmt.Errorf("msgpack length %d too large", n)
+	}
+	return int(n), nil
+}
+
+// 解码一个值：nil、bool、int64、uint64、float64、string、[]byte、[]interface{}、
+// map[string]interface{} 或 msgpackExt
+func (d *msgpackDecoder) Decode() (interface{}, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.decodeMap(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.decodeArray(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.decodeString(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLen(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.readN(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLen(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		v, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.readUint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.readUint(1 << (b - 0xcc))
+	case 0xd0:
+		v, err := d.readUint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := d.readUint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := d.readUint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := d.readUint(8)
+		return int64(v), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLen(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLen(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n)
+	case 0xde, 0xdf:
+		n, err := d.readLen(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n)
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%02x", b)
+}
+
+func (d *msgpackDecoder) decodeString(n int) (string, error) {
+	buf, err := d.readN(n)
+	return string(buf), err
+}
+
+func (d *msgpackDecoder) decodeExt(n int) (msgpackExt, error) {
+	t, err := d.r.ReadByte()
+	if err != nil {
+		return msgpackExt{}, err
+	}
+	data, err := d.readN(n)
+	return msgpackExt{Type: int8(t), Data: data}, err
+}
+
+func (d *msgpackDecoder) decodeArray(n int) ([]interface{}, error) {
+	if n > maxMsgpackItems {
+		return nil, fmt.Errorf("msgpack array of %d items exceeds limit", n)
+	}
+	items := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.Decode()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+// map 的键统一转换为字符串
+func (d *msgpackDecoder) decodeMap(n int) (map[string]interface{}, error) {
+	if n > maxMsgpackItems {
+		return nil, fmt.Errorf("msgpack map of %d items exceeds limit", n)
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.Decode()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		v, err := d.Decode()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		m[msgpackString(k)] = v
+	}
+	return m, nil
+}
+
+// 值读到一半时的 EOF 表示数据被截断
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// 将标量值转换为字符串，Fluent Bit 常把字符串编码为 bin
+func msgpackString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// 编码只含字符串值的 map，用于 forward 协议的 ack 响应
+func encodeMsgpackStringMap(m map[string]string) []byte {
+	var buf []byte
+	buf = appendMsgpackLen(buf, len(m), 0x80, 0xde)
+	for _, k := range sortedKeys(m) {
+		buf = appendMsgpackString(buf, k)
+		buf = appendMsgpackString(buf, m[k])
+	}
+	return buf
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n < 1<<8:
+		buf = append(buf, 0xd9, byte(n))
+	case n < 1<<16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendMsgpackLen(buf []byte, n int, fix, wide byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n < 1<<16:
+		return binary.BigEndian.AppendUint16(append(buf, wide), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, wide+1), uint32(n))
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 按来源网段限制接口访问，写入、查询和管理接口分别配置，为空的一类不限制。
+// 写入包括 HTTP 上传、gRPC 上传以及 syslog、forward 输入；接口归属于哪一类与访问控制所需的权限一致，
+// 合成探针经本机访问服务，限制查询或管理接口时需要把 127.0.0.1 也列入
+type NetworkConfig struct {
+	Ingest []string `json:"ingest"` // 允许写入的网段（CIDR）或地址，如集群子网
+	Query  []string `json:"query"`  // 允许查询和分析的网段，如办公网络
+	Admin  []string `json:"admin"`  // 允许调用管理接口的网段
+
+	// 可信的反向代理，来自这些地址的请求按 X-Forwarded-For 取客户端地址；为空时只看连接的对端地址
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+var networkDenied = metrics.counter("network_denied_total", "Requests rejected by the network allowlist, by endpoint class.")
+
+// 权限对应的接口类别，用于指标
+var networkClasses = map[string]string{permWrite: "ingest", permRead: "query", permAdmin: "admin"}
+
+// 编译后的网段限制
+type networkPolicy struct {
+	lists   map[string][]*net.IPNet // 权限 → 允许的网段，没有条目的权限不限制
+	proxied bool                    // 配置了可信代理，客户端地址可以取自 X-Forwarded-For
+}
+
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func newNetworkPolicy(c NetworkConfig) (*networkPolicy, error) {
+	p := &networkPolicy{lists: make(map[string][]*net.IPNet), proxied: len(c.TrustedProxies) > 0}
+	for perm, list := range map[string][]string{permWrite: c.Ingest, permRead: c.Query, permAdmin: c.Admin} {
+		nets, err := parseNetworks(list)
+		if err != nil {
+			return nil, err
+		}
+		if len(nets) > 0 {
+			p.lists[perm] = nets
+		}
+	}
+	if _, err := parseNetworks(c.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	return p, nil
+}
+
+// 来源地址是否可以访问需要 perm 权限的接口
+func (p *networkPolicy) Allows(perm string, ip net.IP) bool {
+	nets, ok := p.lists[perm]
+	if !ok {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按 host:port 形式的对端地址判断
+func (p *networkPolicy) AllowsAddr(perm, addr string) bool {
+	if _, ok := p.lists[perm]; !ok {
+		return true
+	}
+	return p.Allows(perm, net.ParseIP(addrHost(addr)))
+}
+
+// host:port 形式地址中的主机部分，没有端口时原样返回
+func addrHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// 上传方的地址：配置了可信代理时按 X-Forwarded-For 取客户端地址，其他节点转发的请求取转发方记录的原始地址
+func (s *Service) requestSourceIP(c *gin.Context) string {
+	if c.GetBool("cluster.forwarded") {
+		if ip := c.GetHeader(clusterSourceHeader); ip != "" {
+			return ip
+		}
+	}
+	if s.netPolicy.proxied {
+		return c.ClientIP()
+	}
+	return c.RemoteIP()
+}
+
+// 接口所属的类别，与访问控制的路由权限一致；公开接口不受限制
+func routeClass(c *gin.Context) (string, bool) {
+	route := c.FullPath()
+	if route == "" {
+		return "", false
+	}
+	key := c.Request.Method + " " + strings.TrimPrefix(route, tenantRoutePrefix)
+	if publicRoutes[key] && !strings.HasPrefix(route, tenantRoutePrefix+"/") {
+		return "", false
+	}
+	if access, ok := routePermissions[key]; ok {
+		return access.permission, true
+	}
+	return permAdmin, true
+}
+
+// 网段限制中间件，其他节点转发的请求已在原节点检查过
+func (s *Service) networkPolicyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(s.netPolicy.lists) == 0 || c.GetBool("cluster.forwarded") {
+			c.Next()
+			return
+		}
+		perm, ok := routeClass(c)
+		if !ok {
+			c.Next()
+			return
+		}
+		if !s.netPolicy.Allows(perm, net.ParseIP(s.requestSourceIP(c))) {
+			networkDenied.Add(1, "class", networkClasses[perm])
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access from this network is not allowed"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/i18n"
+)
+
+// 告警通知渠道，按规则配置，一条规则可以同时推送到多个渠道
+type NotifierConfig struct {
+	Type   string       `json:"type"`             // slack、dingtalk、wecom、email 或 webhook
+	URL    string       `json:"url,omitempty"`    // 机器人或 webhook 地址，email 以外必填
+	Secret string       `json:"secret,omitempty"` // 钉钉机器人的加签密钥，未开启加签时留空
+	Email  *ReportEmail `json:"email,omitempty"`  // type 为 email 时的 SMTP 配置
+	// 消息的语言：en 或 zh-CN，默认为 localization.language；webhook 推送的 JSON 始终使用默认语言
+	Language string `json:"language,omitempty"`
+}
+
+// 告警投递
+type Notifier interface {
+	Channel() string // 渠道类型，用于日志和指标
+	Notify(ctx context.Context, ev AlertEvent) error
+}
+
+// 已登记的渠道类型，类型 → 构造函数
+var notifierTypes = map[string]func(NotifierConfig) (Notifier, error){
+	"slack":    newSlackNotifier,
+	"dingtalk": newDingTalkNotifier,
+	"wecom":    newWeComNotifier,
+	"email":    newEmailNotifier,
+	"webhook":  newWebhookNotifier,
+}
+
+// 单次推送的超时
+const notifyTimeout = 10 * time.Second
+
+var (
+	alertNotifications     = metrics.counter("alert_notifications_total", "Alert notifications delivered, by channel.")
+	alertNotificationFails = metrics.counter("alert_notification_failures_total", "Alert notifications that failed, by channel.")
+)
+
+// defaultLang 为渠道未配置 language 时使用的语言
+func newNotifier(c NotifierConfig, defaultLang string) (Notifier, error) {
+	build, ok := notifierTypes[c.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported channel type %q", c.Type)
+	}
+	lang, err := configuredLanguage(c.Language)
+	if err != nil {
+		return nil, err
+	}
+	if lang == "" {
+		lang = defaultLang
+	}
+	c.Language = lang
+	return build(c)
+}
+
+func newNotifiers(list []NotifierConfig, defaultLang string) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(list))
+	for i, c := range list {
+		n, err := newNotifier(c, defaultLang)
+		if err != nil {
+			return nil, fmt.Errorf("channel %d: %w", i, err)
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+// 不返回密钥和 SMTP 密码
+func (c NotifierConfig) redacted() NotifierConfig {
+	if c.Secret != "" {
+		c.Secret = "******"
+	}
+	if c.Email != nil && c.Email.Password != "" {
+		email := *c.Email
+		email.Password = "******"
+		c.Email = &email
+	}
+	return c
+}
+
+func notifierURL(c NotifierConfig) (string, error) {
+	u, err := url.Parse(c.URL)
+	if c.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%s channel requires an http(s) url", c.Type)
+	}
+	return c.URL, nil
+}
+
+// 聊天机器人和邮件使用的纯文本消息
+func alertText(ev AlertEvent, lang string) string {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString(i18n.Textf(format, args...).In(lang))
+		b.WriteString("\n")
+	}
+	line("[seata-log-analysis] Alert %s fired", ev.Rule)
+	if ev.ApplicationID != "" {
+		line("Application: %s", ev.ApplicationID)
+	}
+	if ev.GroupKey != "" {
+		line("Group: %s", ev.GroupKey)
+	}
+	line("Value: %d (threshold %d)", ev.Value, ev.Threshold)
+	if !ev.LogTime.IsZero() {
+		line("Log time: %s", ev.LogTime.Format(time.RFC3339))
+	}
+	if message := ev.localizedMessage(lang); message != "" {
+		line("Message: %s", message)
+	}
+	if ev.Sample.LogMessage != "" {
+		line("Sample: [%s] %s", ev.Sample.LogLevel, truncateUTF8(ev.Sample.LogMessage, 500))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// 以 JSON 推送，返回响应体，非 2xx 状态码视为失败
+func postNotification(ctx context.Context, target string, payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return data, fmt.Errorf("%s returned %d", req.URL.Host, resp.StatusCode)
+	}
+	return data, nil
+}
+
+// 钉钉和企业微信机器人出错时仍返回 200，错误在 errcode 中
+func checkRobotResponse(data []byte) error {
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("unexpected robot response: %s", truncateUTF8(string(data), 200))
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("robot returned errcode %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// Slack incoming webhook
+type slackNotifier struct{ url, lang string }
+
+func newSlackNotifier(c NotifierConfig) (Notifier, error) {
+	u, err := notifierURL(c)
+	return &slackNotifier{url: u, lang: c.Language}, err
+}
+
+func (n *slackNotifier) Channel() string { return "slack" }
+
+func (n *slackNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	_, err := postNotification(ctx, n.url, map[string]string{"text": alertText(ev, n.lang)})
+	return err
+}
+
+// 钉钉自定义机器人，配置了 secret 时按加签方式在地址上附加 timestamp 和 sign
+type dingTalkNotifier struct{ url, secret, lang string }
+
+func newDingTalkNotifier(c NotifierConfig) (Notifier, error) {
+	u, err := notifierURL(c)
+	return &dingTalkNotifier{url: u, secret: c.Secret, lang: c.Language}, err
+}
+
+func (n *dingTalkNotifier) Channel() string { return "dingtalk" }
+
+func (n *dingTalkNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	target := n.url
+	if n.secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write([]byte(ts + "\n" + n.secret))
+		sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(sign)
+	}
+	data, err := postNotification(ctx, target, gin.H{"msgtype": "text", "text": gin.H{"content": alertText(ev, n.lang)}})
+	if err != nil {
+		return err
+	}
+	return checkRobotResponse(data)
+}
+
+// 企业微信群机器人
+type weComNotifier struct{ url, lang string }
+
+func newWeComNotifier(c NotifierConfig) (Notifier, error) {
+	u, err := notifierURL(c)
+	return &weComNotifier{url: u, lang: c.Language}, err
+}
+
+func (n *weComNotifier) Channel() string { return "wecom" }
+
+func (n *weComNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	data, err := postNotification(ctx, n.url, gin.H{"msgtype": "text", "text": gin.H{"content": alertText(ev, n.lang)}})
+	if err != nil {
+		return err
+	}
+	return checkRobotResponse(data)
+}
+
+// 通过 SMTP 发送纯文本邮件
+type emailNotifier struct {
+	email ReportEmail
+	lang  string
+}
+
+func newEmailNotifier(c NotifierConfig) (Notifier, error) {
+	if c.Email == nil || c.Email.SMTPAddr == "" || c.Email.From == "" || len(c.Email.To) == 0 {
+		return nil, fmt.Errorf("email channel requires email.smtp_addr, email.from and email.to")
+	}
+	return &emailNotifier{email: *c.Email, lang: c.Language}, nil
+}
+
+func (n *emailNotifier) Channel() string { return "email" }
+
+func (n *emailNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	subject := i18n.Textf("[seata-log-analysis] Alert %s", ev.Rule)
+	if ev.ApplicationID != "" {
+		subject = i18n.Textf("[seata-log-analysis] Alert %s on %s", ev.Rule, ev.ApplicationID)
+	}
+	return sendEmail(n.email, subject.In(n.lang), alertText(ev, n.lang))
+}
+
+// 通用 webhook，推送 JSON 格式的告警事件
+type webhookNotifier struct{ url string }
+
+func newWebhookNotifier(c NotifierConfig) (Notifier, error) {
+	u, err := notifierURL(c)
+	return &webhookNotifier{url: u}, err
+}
+
+func (n *webhookNotifier) Channel() string { return "webhook" }
+
+func (n *webhookNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	_, err := postNotification(ctx, n.url, ev)
+	return err
+}
+
+// 推送到一个渠道并记录结果
+func notify(n Notifier, ev AlertEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := n.Notify(ctx, ev); err != nil {
+		alertNotificationFails.Add(1, "channel", n.Channel())
+		return err
+	}
+	alertNotifications.Add(1, "channel", n.Channel())
+	return nil
+}
+
+// 渠道测试接口：向请求体中的渠道发送一条测试告警，用于在保存规则前确认地址和密钥
+func (s *Service) alertChannelTestHandler(c *gin.Context) {
+	var channel NotifierConfig
+	if err := c.ShouldBindJSON(&channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	n, err := newNotifier(channel, s.defaultLanguage())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	ev := AlertEvent{Rule: "channel-test", Value: 1, LogTime: now, FiredAt: now, text: i18n.Textf("Test notification from seata-log-analysis")}
+	ev.Message = ev.text.In(s.defaultLanguage())
+	if err := notify(n, ev); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Notification failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Test notification sent", "channel": n.Channel()})
+}
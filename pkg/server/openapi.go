@@ -0,0 +1,672 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+)
+
+// 接口参数说明
+type apiParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// 接口说明，未登记的路由仍会出现在文档中，只是没有描述
+type apiDoc struct {
+	Tag         string
+	Summary     string
+	Query       []apiParam
+	Body        interface{} // 请求体类型示例，用于生成 schema
+	Response    interface{} // 响应体类型示例
+	ContentType string      // 非 JSON 响应的类型，如 text/plain
+}
+
+// 接口文档登记表，键为 "METHOD /path"
+var apiDocs = map[string]apiDoc{
+	"POST /upload": {Tag: "ingest", Summary: "Upload a single log entry; timestamp accepts RFC3339, 2006-01-02 15:04:05.000 or epoch millis and is stored as UTC RFC3339; the response carries its assigned id; alternatively send only application_id and raw_line (plus optional fields) and the server infers level, timestamp and message with the application's registered parser, then the built-in layouts, defaulting to INFO and the receive time; 413 when the body exceeds upload_limits.max_body_mb and 422 when log_message, raw_line or log_level exceeds its length limit; 503 with Retry-After and X-Ingest-Queue-Depth when the ingest queue is full; invalid UTF-8 is replaced with U+FFFD; when upload_signing configures a secret for the application, X-Signature must carry sha256=<hex HMAC-SHA256 of X-Signature-Timestamp + \".\" + raw body> with X-Signature-Timestamp in Unix seconds within max_skew, otherwise 401", Query: []apiParam{
+		{Name: "charset", Description: "Charset of the body (e.g. gbk, gb18030, big5), transcoded to UTF-8 before parsing; also read from the Content-Type charset parameter; default UTF-8"},
+	}, Body: LogData{}},
+	"POST /upload/batch": {Tag: "ingest", Summary: "Upload a batch of log entries; the whole batch is rejected if any timestamp is invalid; ids lists the assigned ids in order, 0 for duplicates and dropped entries; entries may also be raw_line objects as in POST /upload; body and field limits apply as in POST /upload; signing applies as in POST /upload, every application in the batch that has a secret must verify", Query: []apiParam{
+		{Name: "charset", Description: "Charset of the body (e.g. gbk, gb18030, big5), transcoded to UTF-8 before parsing; also read from the Content-Type charset parameter; default UTF-8"},
+		{Name: "partial", Description: "true to validate and write each entry on its own: rejected entries do not fail the batch, the response adds rejected and results (index, status accepted, duplicate, dropped or rejected, id, reason, error, field, retryable) in request order, and the status is 207 when any entry was rejected; retry only the entries marked retryable, with a new Idempotency-Key; a full ingest queue still fails the whole batch with 503"},
+	}, Body: []LogData{}},
+	"POST /upload/raw": {Tag: "ingest", Summary: "Upload raw text log lines (Seata TC layout is parsed automatically); 413 when the body exceeds upload_limits.max_body_mb, 422 when a message exceeds max_message_bytes; signing applies as in POST /upload", Query: []apiParam{
+		{Name: "application_id", Description: "Application the lines belong to", Required: true},
+		{Name: "charset", Description: "Charset of the body (e.g. gbk, gb18030, big5), transcoded to UTF-8 before parsing; also read from the Content-Type charset parameter; default UTF-8"},
+	}},
+	"POST /upload/logstash": {Tag: "ingest", Summary: "Upload JSON events from a Java HTTP appender: logstash-logback-encoder LogstashEncoder, Log4j2 JsonLayout or JsonTemplateLayout (LogstashJsonEventLayoutV1, EcsLayout); the body is one event, an array or one event per line; @timestamp (or instant/timeMillis), level, message, logger_name, thread_name and stack_trace map to the log fields, the stack trace is appended to the message, MDC keys X-TX-XID, X-TX-BRANCH-ID, traceId and spanId map to xid, branch_id, trace_id and span_id, and the remaining keys (mdc and contextMap flattened, nested objects as dotted keys) become custom fields, at most 64 by key order; level defaults to INFO and the timestamp to the receive time; the response, limits and signing are as in POST /upload/batch", Query: []apiParam{
+		{Name: "application_id", Description: "Application the events belong to", Required: true},
+		{Name: "charset", Description: "Charset of the body, default UTF-8"},
+	}},
+	"POST /import": {Tag: "ingest", Summary: "Import existing log files (multipart field file, .gz accepted) into their historical dates; each file result carries status, reason and retryable on failure and, in rejections, the line number and reason of up to 20 entries skipped for an invalid timestamp or schema; 403 when upload_signing.required is set", Query: []apiParam{
+		{Name: "application_id", Description: "Application to import into", Required: true},
+		{Name: "date", Description: "Date (YYYY-MM-DD) for lines that only carry a time of day; defaults to the date in the file name"},
+		{Name: "partial", Description: "true to continue with the next file when one fails; the status is 207 when any file failed, so only the failed files need to be uploaded again"},
+	}},
+	"POST /upload/sessions":                    {Tag: "ingest", Summary: "Start a resumable upload; the body field chunks gives the number of chunks, which concatenated in order form NDJSON, one log entry per line; the optional field charset (e.g. gbk) gives their encoding, transcoded to UTF-8 on complete; 403 when upload_signing.required is set", Response: uploadSessionStatus{}},
+	"GET /upload/sessions/{id}":                {Tag: "ingest", Summary: "Received and missing chunks of an upload session", Response: uploadSessionStatus{}},
+	"PUT /upload/sessions/{id}/chunks/{index}": {Tag: "ingest", Summary: "Upload or retransmit one chunk (raw bytes, up to 8 MiB); an X-Chunk-SHA256 header is verified when present"},
+	"POST /upload/sessions/{id}/complete":      {Tag: "ingest", Summary: "Validate and write all chunks once none are missing; the response matches /upload/batch, and retrying after a failure does not write entries twice"},
+	"DELETE /upload/sessions/{id}":             {Tag: "ingest", Summary: "Abandon an upload session; sessions also expire 24 hours after creation"},
+	"GET /tail": {Tag: "query", Summary: "Stream newly ingested logs as NDJSON", ContentType: "application/x-ndjson", Query: []apiParam{
+		{Name: "application_id", Description: "Application to follow", Required: true},
+		{Name: "log_level", Description: "Only stream entries with this level"},
+	}},
+	"GET /tail/ws": {Tag: "query", Summary: "WebSocket subscription for an interactive console: send a JSON filter (applications, levels, regex, XID, fields, backfill count) and receive the most recent matches oldest first as backfill messages, a backfill_end message, then entry messages for new matches and periodic heartbeats; sending another filter replaces the subscription; streams logs ingested on this node", Body: subscriptionFilter{}, Response: subscriptionMessage{}},
+	"GET /logs/{id}": {Tag: "query", Summary: "One complete entry by id, e.g. to fetch a message truncated in query results; 404 when the application has no entry with this id", Query: []apiParam{
+		{Name: "application_id", Description: "Application of the entry (required); ids are unique per application"},
+		{Name: "tz", Description: "IANA time zone to show the timestamp in"},
+	}, Response: LogData{}},
+	"GET /query": {Tag: "query", Summary: "Query logs of an application", Query: []apiParam{
+		{Name: "application_id", Description: "Application to query (required unless view is set); a comma-separated list, glob pattern such as order-* or group reference such as @payments or @payments:prod queries several applications, merged by time"},
+		{Name: "log_level", Description: "Level filter (required unless view is set)"},
+		{Name: "view", Description: "Query within a temporary view"},
+		{Name: "sort", Description: "asc or desc by timestamp (by id when since_id or max_id is set), default desc"},
+		{Name: "limit", Description: "Maximum number of entries, default 100, capped by query.max_limit"},
+		{Name: "from", Description: "Start time (RFC3339 or 2006-01-02 15:04:05); older segments, including archived ones, are not read. Segments are named by the server-local day they were received, and from/to are compared as instants, so clients in any tz need not know the file naming"},
+		{Name: "to", Description: "End time; closed segments whose indexed entries all start after it are not read"},
+		{Name: "tz", Description: "IANA time zone for from/to without an offset; returned timestamps are also shown in it (UTC as stored otherwise)"},
+		{Name: "since", Description: "Incremental polling: a log id (single application), or an RFC 3339 timestamp optionally followed by ,seq to return only entries written after that point across applications; defaults sort to asc, skips already returned parts of segments using the count index, and returns the cursor for the next poll as next_since (X-Next-Since header for NDJSON); entries written in the last second are left for the next poll"},
+		{Name: "since_id", Description: "Only entries with an id greater than this; with sort=asc, pass the last id received to consume incrementally; single application only"},
+		{Name: "max_id", Description: "Only entries with an id up to and including this"},
+		{Name: "field.{key}", Description: "Structured field filter, e.g. field.pod=seata-0; repeat for any-of; keys of a JSON log_message are expanded into fields on ingest (nested keys dotted, e.g. field.order.id), so field.orderId=123 matches {\"orderId\":123}"},
+		{Name: "mode", Description: "Seata transaction mode (AT, TCC, SAGA, XA), shorthand for field.seata_mode; entries are tagged on ingest and older entries are classified from the message"},
+		{Name: "tc_node", Description: "TC node that produced the entry, shorthand for field.tc_node; TC applications are tagged on ingest from the uploaded tc_node, tc_node.fields, the raft node address or the uploader IP"},
+		{Name: "q", Description: "Keyword that log_message must contain, case-insensitive"},
+		{Name: "regex", Description: "RE2 regular expression that log_message must match; cannot be combined with q"},
+		{Name: "highlight", Description: "With q or regex: offsets adds highlight.matches per entry, the [start, end) positions of the hits in log_message counted in Unicode code points (first 100); html or markdown also add highlight.snippet, up to 240 characters around the first hit with hits wrapped in <mark> or ** and the rest escaped"},
+		{Name: "fields", Description: "Comma-separated fields to return per entry, e.g. timestamp,log_message; fields.{key} keeps a single custom field; absent fields are omitted"},
+		{Name: "full_message", Description: "true to return log_message in full; otherwise messages longer than query.max_message_bytes (default 16 KiB) are cut at a UTF-8 boundary and the entry carries message_truncated: true and the original message_bytes; fetch the full entry with GET /logs/{id}"},
+		{Name: "format", Description: "ndjson to stream one entry per line (same as Accept: application/x-ndjson); truncation is reported in the X-Truncated trailer"},
+		{Name: "include_archive", Description: "true to also read segments tiered to object storage (only a .tiered stub left locally); segments whose recorded time range misses from/to are skipped without a request, uncompressed objects are read with range requests for only the blocks overlapping from/to, compressed or older objects are fetched whole into the tier cache. Without it, archived segments are skipped and counted in archive.skipped (X-Archive-Skipped header for NDJSON); the response carries archive with skipped, pruned, ranged, fetched and range_bytes"},
+		{Name: "explain", Description: "true to add explain: the strategy (scan, index or backend), lines read, entries passing the level and field filters and matching all conditions, per-segment actions (scanned, served from the query cache, or skipped as entirely outside from/to, by the incremental index or as archived) with bytes read and duration, and a timing breakdown in milliseconds; also works with count=true; not available with NDJSON"},
+		{Name: "summary", Description: "false to omit summary, which lists per file touched the number of matches by level and the earliest and latest timestamp, over all matches rather than only the returned ones; not included in ndjson responses"},
+		{Name: "count", Description: "true to return only the number of matches; without field filters, q, regex, a view or to, and with a minute-aligned from, it is read from the count index (exact level match); source reports which was used; id ranges always scan; applications on a clickhouse backend are counted there (source backend)"},
+	}},
+	"GET /aggregate": {Tag: "query", Summary: "Count matching logs per calendar-aligned time bucket", Query: []apiParam{
+		{Name: "application_id", Description: "Application to aggregate (required unless view is set)"},
+		{Name: "log_level", Description: "Level filter"},
+		{Name: "view", Description: "Aggregate a temporary view"},
+		{Name: "field.{key}", Description: "Structured field filter"},
+		{Name: "mode", Description: "Seata transaction mode, shorthand for field.seata_mode"},
+		{Name: "tc_node", Description: "TC node, shorthand for field.tc_node"},
+		{Name: "interval", Description: "Bucket size: 30s, 5m, 1h, 1d, 1w, 1M, 1y (default 1h)"},
+		{Name: "tz", Description: "IANA time zone used for bucket alignment, default server time zone"},
+		{Name: "from", Description: "Start time (RFC3339 or 2006-01-02 15:04:05)"},
+		{Name: "to", Description: "End time"},
+		{Name: "group_by", Description: "log_level, application_id or tc_node"},
+		{Name: "fill", Description: "zero (default) fills empty buckets, none omits them"},
+	}},
+	"GET /histogram": {Tag: "query", Summary: "Per-bucket counts from the persistent count index, for sparklines and error-rate charts", Query: []apiParam{
+		{Name: "application_id", Description: "Application to chart", Required: true},
+		{Name: "log_level", Description: "Comma-separated levels counted in count (exact match); total always covers all levels"},
+		{Name: "interval", Description: "Bucket size: 1m, 5m, 1h, 1d, 1w, 1M, 1y (default 1h, at least 1m)"},
+		{Name: "tz", Description: "IANA time zone used for bucket alignment, default server time zone"},
+		{Name: "from", Description: "Start time, applied at minute resolution"},
+		{Name: "to", Description: "End time"},
+		{Name: "fill", Description: "zero (default) to emit empty buckets, none to omit them"},
+	}, Response: []histogramBucket{}},
+	"GET /applications":                        {Tag: "query", Summary: "List applications with their disk usage and disk quota, the Seata version detected per application from startup and registration logs, and warnings when TM/RM/TC versions from different release lines are mixed"},
+	"GET /applications/{application_id}/files": {Tag: "query", Summary: "List the daily log segment files of an application with their size, compression and tiering state; file backends only", Response: []logFileInfo{}},
+	"GET /applications/{application_id}/files/{date}": {Tag: "query", Summary: "Download all segments of a day (2006-01-02) concatenated as one NDJSON file, including compressed and tiered ones", Query: []apiParam{
+		{Name: "gzip", Description: "true to download gzip-compressed"},
+	}},
+	"GET /stats": {Tag: "query", Summary: "Per-application entry counts, level distribution and disk usage; estimated_total and estimated_levels extrapolate sampled entries by their sample_rate; groups totals each environment of the referenced application groups", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications or group references (@payments, @payments:prod), default all"},
+	}, Response: []applicationStats{}},
+	"GET /transactions": {Tag: "analysis", Summary: "Global transactions with status inferred from TC log events", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to scan, default all"},
+		{Name: "status", Description: "Comma-separated statuses: " + transactionStatuses},
+		{Name: "mode", Description: "Comma-separated Seata transaction modes (AT, TCC, SAGA, XA); per-mode counts are returned in modes"},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time, also the reference for hang detection (default now)"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "hang_after", Description: "Begin without terminal event older than this is hanging (default transaction_hang_window)"},
+		{Name: "limit", Description: "Maximum transactions returned, default 100"},
+	}, Response: []analysis.TransactionSummary{}},
+	"GET /transactions/{xid}": {Tag: "analysis", Summary: "Chronological timeline of a global transaction across applications; closed segments whose XID bloom filter rules out the XID are not read", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to search, default all"},
+	}, Response: TransactionTimeline{}},
+	"POST /transactions/logs": {Tag: "analysis", Summary: "Timelines of up to 100 global transactions in one scan, grouped per XID; XIDs without any log are listed in not_found", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to search, default all"},
+	}, Body: transactionLogsRequest{}, Response: []TransactionTimeline{}},
+	"GET /transactions/{xid}/graph": {Tag: "analysis", Summary: "Dependency graph of a global transaction: participating services and resources as nodes, branches as edges (service to resource) with mode and phase-two status", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to search, default all"},
+		{Name: "format", Description: "json (default) or dot for Graphviz"},
+	}, Response: transactionGraph{}},
+	"GET /transactions/{xid}/diagnosis": {Tag: "analysis", Summary: "Probable root cause of a transaction that did not commit: known failure patterns (escalated entries, dirty undo data, missing undo log, global lock conflicts, branch registration failures, global timeout) ranked by likelihood with supporting log lines, the first ERROR in the timeline and the slowest branch, summarised in one machine-generated sentence with a confidence; 409 when the transaction committed; diagnosis and cause titles follow Accept-Language (en or zh-CN, default localization.language) and the response carries Content-Language", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to search, default all"},
+	}, Response: TransactionDiagnosis{}},
+	"GET /events/seata": {Tag: "analysis", Summary: "Typed Seata lifecycle events recognised from TM, RM and TC logs instead of raw lines: GlobalBegin, BranchRegister, BranchCommit, BranchRollback, GlobalCommit and GlobalRollback with xid, transactionId, branchId, resourceId, lockKeys, branchType, Seata status name and, for GlobalBegin, transactionName, transactionServiceGroup and timeout", Response: []seataEvent{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to read, default all"},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "xid", Description: "Only events of this global transaction"},
+		{Name: "type", Description: "Comma-separated event types"},
+		{Name: "sort", Description: "asc or desc by timestamp, default desc"},
+		{Name: "limit", Description: "Maximum number of events, default 100"},
+	}},
+	"GET /tc/nodes": {Tag: "analysis", Summary: "Per TC node entry counts, levels and time range for TC applications, with raft leader elections and conflicts where several nodes became leader for the same term (split brain)", Response: []tcNodeStats{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications, default those matching tc_node.applications"},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+	}},
+	"GET /saga/{key}": {Tag: "analysis", Summary: "Execution trace of a Seata SAGA state machine by business key or XID: executed states, triggered compensation and the state where forward execution stopped", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to search, default all"},
+	}, Response: sagaTrace{}},
+	"GET /traces/{trace_id}/logs": {Tag: "analysis", Summary: "Logs of a distributed trace across applications, with a link to the tracing UI", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to search, default all"},
+		{Name: "from", Description: "Start time; older segments are not read"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "IANA time zone for from/to without an offset"},
+	}, Response: traceLogs{}},
+	"GET /requests/{request_id}/logs": {Tag: "analysis", Summary: "Logs of a Dubbo or Spring Cloud RPC request across caller and callee applications, linked by the request ID extracted at ingest (requestId=, X-Request-Id: ...) into field request_id; lists each hop's role, the XIDs and traces the request touched and the earliest error, usually where a failing branch originated", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to search, default all"},
+		{Name: "from", Description: "Start time; older segments are not read"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "IANA time zone for from/to without an offset"},
+	}, Response: requestLogs{}},
+	"GET /analysis/findings": {Tag: "analysis", Summary: "Run analyzers and return machine-readable findings; title and message follow Accept-Language (en or zh-CN, default localization.language), codes and data stay untranslated", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications", Required: true},
+		{Name: "analyzers", Description: "Comma-separated analyzer names, default all; analyzers provided by plugins are named plugin:<name>"},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+	}, Response: []Finding{}},
+	"GET /analysis/codes":  {Tag: "analysis", Summary: "Catalog of stable finding codes; title and description follow Accept-Language"},
+	"GET /analysis/schema": {Tag: "analysis", Summary: "JSON Schema of a finding", ContentType: "application/schema+json"},
+	"GET /analysis/lock-conflicts": {Tag: "analysis", Summary: "Tables, rows and XIDs contending most for Seata global locks", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications", Required: true},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "limit", Description: "Maximum tables, rows and XIDs returned, default 10"},
+	}, Response: analysis.LockConflictSummary{}},
+	"GET /analysis/rollback-failures": {Tag: "analysis", Summary: "Branch rollback failures (dirty data, missing undo log, failed retries) grouped by resource and XID", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications", Required: true},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "limit", Description: "Maximum resources and XIDs returned, default 50; XIDs needing manual repair come first"},
+		{Name: "mode", Description: "Comma-separated Seata transaction modes (AT, TCC, SAGA, XA); failures are attributed to the mode of their XID, and per-mode counts are returned in modes"},
+	}, Response: []analysis.RollbackXIDStats{}},
+	"GET /analysis/retry-storms": {Tag: "analysis", Summary: "Branches whose phase-two commit or rollback the TC retried at least threshold times, with the affected XIDs and resources", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications", Required: true},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "threshold", Description: "Minimum retries of a branch, default retry_storm.threshold (10)"},
+		{Name: "limit", Description: "Maximum branches and resources returned, most retried first, default 50"},
+		{Name: "mode", Description: "Comma-separated Seata transaction modes (AT, TCC, SAGA, XA)"},
+	}, Response: []analysis.RetryStormBranch{}},
+	"GET /analysis/transaction-latency": {Tag: "analysis", Summary: "p50/p95/p99 global transaction duration per application and time window", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications", Required: true},
+		{Name: "interval", Description: "Window size by transaction begin time: 5m, 1h, 1d, 1w ... (default 1h)"},
+		{Name: "status", Description: "Comma-separated terminal statuses to include, default committed,rolled_back; also timed_out, failed"},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "Time zone for window alignment and from/to without offset"},
+	}, Response: []applicationLatency{}},
+	"GET /analysis/compare": {Tag: "analysis", Summary: "Error counts and rollback rates per application in a window compared with a baseline window, with significance markers", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications, default all"},
+		{Name: "from", Description: "Start of the current window", Required: true},
+		{Name: "to", Description: "End of the current window (default now)"},
+		{Name: "baseline_from", Description: "Start of the baseline window (default the window of the same length right before from)"},
+		{Name: "baseline_to", Description: "End of the baseline window (default baseline_from plus the current window length)"},
+		{Name: "tz", Description: "Time zone for times without offset"},
+	}, Response: comparisonReport{}},
+	"GET /analysis/timeouts": {Tag: "analysis", Summary: "Timed-out global transactions with the last branch activity before the timeout, the slowest branch and the suspected stalling service, with a one-paragraph summary that follows Accept-Language (en or zh-CN, default localization.language)", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications; include both TC and RM applications to see branch activity", Required: true},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "limit", Description: "Maximum transactions returned, most recent timeouts first, default 50"},
+		{Name: "mode", Description: "Comma-separated Seata transaction modes (AT, TCC, SAGA, XA)"},
+	}, Response: []analysis.TransactionTimeout{}},
+	"GET /analysis/consistency": {Tag: "analysis", Summary: "Branches whose RM logs contradict, miss or failed the phase-two outcome the TC recorded, cross-checked per XID", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications; include both TC and RM applications", Required: true},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time; decisions within grace of it (or of now) are reported as pending"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "grace", Description: "Time the RM is given to apply a phase-two decision, default 1m"},
+		{Name: "limit", Description: "Maximum inconsistencies returned, most recent decisions first, default 50"},
+		{Name: "mode", Description: "Comma-separated Seata transaction modes (AT, TCC, SAGA, XA)"},
+	}, Response: analysis.ConsistencyReport{}},
+	"POST /api/v1/auth/login": {Tag: "console", Summary: "Seata console login; username is an access-control user and password its API key, returned as the Bearer token; any username succeeds when access control is disabled; failures answer HTTP 200 with code 401 as the console expects", Body: consoleLoginRequest{}, Response: consoleResult{}},
+	"GET /api/v1/console/globalSession/query": {Tag: "console", Summary: "Global transactions inferred from the logs of all permitted applications, in the Seata console's GlobalSessionVO page format", Query: []apiParam{
+		{Name: "xid", Description: "Exact XID"},
+		{Name: "applicationId", Description: "Application id reported by the TC when the transaction began"},
+		{Name: "status", Description: "Seata GlobalStatus code (1 begin, 9 committed, 10 commit failed, 11 rollbacked, 12 rollback failed, 13 timeout rollbacked)"},
+		{Name: "transactionName", Description: "Substring of the transaction name"},
+		{Name: "withBranch", Description: "true to include branchSessionVOs"},
+		{Name: "timeStart", Description: "Start time in epoch milliseconds, default 24 hours ago"},
+		{Name: "timeEnd", Description: "End time in epoch milliseconds"},
+		{Name: "pageNum", Description: "Page number starting at 1, default 1"},
+		{Name: "pageSize", Description: "Page size, default 10, at most 1000"},
+	}, Response: consolePage{}},
+	"GET /api/v1/console/globalLock/query": {Tag: "console", Summary: "Row locks registered by branches of unfinished global transactions, in the Seata console's GlobalLockVO page format", Query: []apiParam{
+		{Name: "xid", Description: "Exact XID"},
+		{Name: "tableName", Description: "Table name"},
+		{Name: "transactionId", Description: "Transaction id (last XID segment)"},
+		{Name: "branchId", Description: "Branch id"},
+		{Name: "pk", Description: "Primary key value"},
+		{Name: "resourceId", Description: "Resource id"},
+		{Name: "timeStart", Description: "Start time in epoch milliseconds, default 24 hours ago"},
+		{Name: "timeEnd", Description: "End time in epoch milliseconds"},
+		{Name: "pageNum", Description: "Page number starting at 1, default 1"},
+		{Name: "pageSize", Description: "Page size, default 10, at most 1000"},
+	}, Response: consolePage{}},
+	"GET /errors/top": {Tag: "analysis", Summary: "Most frequent error patterns per application", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications", Required: true},
+		{Name: "log_level", Description: "Comma-separated levels, default ERROR,FATAL"},
+		{Name: "from", Description: "Start time"},
+		{Name: "to", Description: "End time"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "limit", Description: "Patterns per application, default 10"},
+		{Name: "examples", Description: "Example lines per pattern, default 3"},
+	}, Response: []appTopErrors{}},
+
+	"GET /alerts/rules":                 {Tag: "alerts", Summary: "List alert rules"},
+	"POST /alerts/rules":                {Tag: "alerts", Summary: "Create or replace an alert rule (new rules stay disabled until enabled; replacing keeps the enabled state)", Body: AlertRule{}},
+	"DELETE /alerts/rules/{name}":       {Tag: "alerts", Summary: "Delete an alert rule"},
+	"POST /alerts/rules/{name}/enable":  {Tag: "alerts", Summary: "Enable an alert rule"},
+	"POST /alerts/rules/{name}/disable": {Tag: "alerts", Summary: "Disable an alert rule"},
+	"POST /alerts/rules/test":           {Tag: "alerts", Summary: "Backtest a rule against stored logs between from and to", Body: alertTestRequest{}},
+	"POST /alerts/channels/test":        {Tag: "alerts", Summary: "Send a test alert to a notification channel (slack, dingtalk, wecom, email or webhook) before adding it to a rule", Body: NotifierConfig{}},
+	"GET /alerts/events":                {Tag: "alerts", Summary: "Recent alert events"},
+	"GET /events": {Tag: "alerts", Summary: "Server-Sent Events stream of this node's system events: alert, quota_exceeded, retention (oldest segments deleted for the disk quota, entries past their level retention removed, or a soft-deleted application purged after its recovery window), migration and seata_version (TM/RM/TC of a tenant running different Seata release lines); reconnecting with Last-Event-ID replays recent missed events", ContentType: "text/event-stream", Query: []apiParam{
+		{Name: "types", Description: "Comma-separated event types, default all"},
+		{Name: "application_id", Description: "Only events of this application"},
+		{Name: "last_event_id", Description: "Replay recent events after this id, like the Last-Event-ID header"},
+	}},
+	"GET /alerts/anomalies":  {Tag: "alerts", Summary: "Latest error-rate anomaly check per application, with the learned hourly baseline", Response: []anomalyStatus{}},
+	"GET /alerts/ingest-lag": {Tag: "alerts", Summary: "Ingest lag per application at the last check: the delay between the freshest received entry's timestamp and its receipt, the largest delay and entries received in the interval; behind is set when the lag exceeds ingest_lag.threshold, which fires an ingest_lag alert at most once per cooldown; imports and dead-letter replays are not counted", Response: []ingestLagStatus{}},
+
+	"GET /reports": {Tag: "reports", Summary: "Configured scheduled reports"},
+	"GET /reports/history": {Tag: "reports", Summary: "Generated reports, newest first", Query: []apiParam{
+		{Name: "name", Description: "Only reports with this name"},
+		{Name: "limit", Description: "Maximum number of reports, default 100"},
+	}, Response: []reportSummary{}},
+	"GET /reports/history/{id}": {Tag: "reports", Summary: "Download a generated report", Query: []apiParam{
+		{Name: "format", Description: "json (default) or text; the text labels follow Accept-Language (en or zh-CN)"},
+		{Name: "download", Description: "true to return the report as an attachment"},
+	}, Response: Report{}},
+	"POST /reports/{name}/run": {Tag: "reports", Summary: "Generate and deliver a report now", Response: Report{}},
+
+	"GET /jobs":             {Tag: "jobs", Summary: "Scheduled analysis jobs with next run, last run start, duration, result and error", Response: []jobStatus{}},
+	"POST /jobs/{name}/run": {Tag: "jobs", Summary: "Run a job now and wait for it to finish; 409 when it is already running", Response: jobStatus{}},
+
+	"GET /plugins": {Tag: "admin", Summary: "Plugins compiled into the server and enabled by the plugins config: the events each subscribes to (ingest, query, alert), the analyzer name it adds to /analysis/findings, and its queue depth and delivered, dropped and panicked event counts"},
+
+	"GET /groups":           {Tag: "groups", Summary: "Application groups: systems whose environments list application IDs or glob patterns"},
+	"PUT /groups":           {Tag: "groups", Summary: "Register or replace an application group; reference it as @name or @name:env in application_id of queries, stats, analysis endpoints and alert rules", Body: AppGroup{}},
+	"DELETE /groups/{name}": {Tag: "groups", Summary: "Remove an application group; alert rules referencing it stop matching"},
+
+	"GET /views":  {Tag: "views", Summary: "List temporary views"},
+	"POST /views": {Tag: "views", Summary: "Materialize a query into a temporary view", Body: createViewRequest{}, Response: logView{}},
+	"GET /annotations": {Tag: "annotations", Summary: "Incident notes attached to time ranges or XIDs", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications; notes for all applications are always included"},
+		{Name: "xid", Description: "Only notes attached to this XID"},
+		{Name: "incident_id", Description: "Only notes with this incident ID"},
+		{Name: "from", Description: "Only notes overlapping the range from this time"},
+		{Name: "to", Description: "Only notes overlapping the range up to this time"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+	}, Response: []Annotation{}},
+	"POST /annotations":        {Tag: "annotations", Summary: "Attach a note (free text, optional incident ID) to a time range or an XID, optionally limited to one application; matching notes are returned in annotations by /query and the transaction timelines", Body: Annotation{}, Response: Annotation{}},
+	"DELETE /annotations/{id}": {Tag: "annotations", Summary: "Delete a note; only its author or an admin may delete it"},
+	"DELETE /views/{name}":     {Tag: "views", Summary: "Delete a temporary view"},
+
+	"GET /admin/backends":        {Tag: "admin", Summary: "List storage backends (file, clickhouse, or custom stores injected with WithStore); passwords are omitted"},
+	"GET /admin/migrations":      {Tag: "admin", Summary: "List migration jobs"},
+	"POST /admin/migrations":     {Tag: "admin", Summary: "Migrate an application to another backend", Body: migrationRequest{}, Response: migrationJob{}},
+	"GET /admin/migrations/{id}": {Tag: "admin", Summary: "Get a migration job", Response: migrationJob{}},
+	"GET /cluster/health":        {Tag: "cluster", Summary: "Node health, used by the heartbeats of other members"},
+	"GET /cluster/members":       {Tag: "cluster", Summary: "Cluster members with their heartbeat status"},
+	"GET /cluster/owner": {Tag: "cluster", Summary: "Node that owns an application", Query: []apiParam{
+		{Name: "application_id", Description: "Application to look up", Required: true},
+		{Name: "tenant", Description: "Tenant of the application"},
+	}},
+	"GET /debug/stats":              {Tag: "admin", Summary: "Runtime diagnostics: goroutines, open files, memory, buffered entries and ingest backlog", Response: debugStats{}},
+	"GET /debug/pprof/{profile}":    {Tag: "admin", Summary: "Go pprof profiles, when debug.pprof is enabled (e.g. /debug/pprof/heap, /debug/pprof/profile?seconds=30)"},
+	"POST /debug/pprof/{profile}":   {Tag: "admin", Summary: "Go pprof symbol lookup"},
+	"GET /auth/whoami":              {Tag: "admin", Summary: "Current user and roles"},
+	"GET /admin/users":              {Tag: "admin", Summary: "List users and their roles", Response: []User{}},
+	"POST /admin/users":             {Tag: "admin", Summary: "Create a user; the API key is generated when omitted and only returned once", Body: createUserRequest{}},
+	"PUT /admin/users/{name}/roles": {Tag: "admin", Summary: "Replace the roles of a user"},
+	"POST /admin/users/{name}/key":  {Tag: "admin", Summary: "Rotate the API key of a user"},
+	"DELETE /admin/users/{name}":    {Tag: "admin", Summary: "Delete a user"},
+	"GET /admin/imports":            {Tag: "admin", Summary: "List path import jobs"},
+	"POST /admin/imports":           {Tag: "admin", Summary: "Import log files from a server directory listed in import.dirs", Body: importRequest{}, Response: importJob{}},
+	"GET /admin/imports/{id}":       {Tag: "admin", Summary: "Get a path import job", Response: importJob{}},
+	"GET /dead-letters": {Tag: "admin", Summary: "Entries that failed validation (invalid timestamp, schema) or the storage write after reaching the write path, newest first; requests rejected as a whole are not kept", Query: []apiParam{
+		{Name: "application_id", Description: "Only entries of this application (tenant/app for tenant applications)"},
+		{Name: "reason", Description: "invalid_timestamp, schema_violation or write_failed"},
+		{Name: "limit", Description: "Maximum entries, default 100"},
+	}},
+	"POST /dead-letters/replay":                        {Tag: "admin", Summary: "Write dead letters again; written ones are removed, failing ones keep their latest error; without ids replays all matching application_id and reason", Body: replayRequest{}},
+	"DELETE /dead-letters/{id}":                        {Tag: "admin", Summary: "Discard a dead letter"},
+	"GET /admin/schemas":                               {Tag: "admin", Summary: "List per-application ingest schemas"},
+	"PUT /admin/schemas":                               {Tag: "admin", Summary: "Register or replace the JSON Schema uploads of an application must match; mode reject (default, 422) or tag (stored with fields.schema_error); supports type, enum, const, required, properties, additionalProperties, items, minItems, maxItems, pattern, minLength, maxLength, minimum and maximum", Body: AppSchema{}},
+	"DELETE /admin/schemas/{application_id}":           {Tag: "admin", Summary: "Remove the schema of an application (tenant/app for tenant applications)"},
+	"GET /admin/escalations":                           {Tag: "admin", Summary: "Severity escalation rules applied at ingest and replay, custom rules first: a matching message raises the entry to the rule's level and records the rule in field escalation and the previous level in field original_level; filter with field.escalation in queries and alert conditions", Response: []EscalationRule{}},
+	"GET /admin/parsers":                               {Tag: "admin", Summary: "List per-application custom line parsers"},
+	"PUT /admin/parsers":                               {Tag: "admin", Summary: "Register or replace the regex rules raw lines of an application are parsed with, tried in order before the built-in layouts; named groups timestamp, level, message, xid, branch_id, thread and logger fill the entry, other named groups go to fields; optional samples are parsed with the new rules and returned", Body: putParserRequest{}},
+	"DELETE /admin/parsers/{application_id}":           {Tag: "admin", Summary: "Remove the custom parser of an application (tenant/app for tenant applications)"},
+	"GET /admin/log-metrics":                           {Tag: "admin", Summary: "List metrics computed from log patterns"},
+	"PUT /admin/log-metrics":                           {Tag: "admin", Summary: "Define or replace a metric computed from incoming logs matching pattern, exposed on /metrics as log_metric_{name}: count (_total), rate (also _per_second over window) or avg (number from the value group or the first group; _sum, _count and the average over window); labels come from named groups or entry fields; optional samples are matched against the new pattern and returned", Body: putLogMetricRequest{}},
+	"DELETE /admin/log-metrics/{name}":                 {Tag: "admin", Summary: "Remove a log metric"},
+	"GET /admin/timestamp-formats":                     {Tag: "admin", Summary: "List per-application timestamp formats"},
+	"PUT /admin/timestamp-formats":                     {Tag: "admin", Summary: "Register or replace the timestamp format of an application: a Go layout (must contain the date) or rfc3339, unix, unix_ms, with an optional IANA timezone for layouts without an offset; structured uploads must then match it exactly and are rejected with the reason otherwise; optional samples are parsed with the new format and returned", Body: putTimestampFormatRequest{}},
+	"DELETE /admin/timestamp-formats/{application_id}": {Tag: "admin", Summary: "Remove the timestamp format of an application (tenant/app for tenant applications), restoring the built-in format detection"},
+	"GET /admin/lifecycle":                             {Tag: "admin", Summary: "Applications that are archived (read-only, writes rejected with 409, excluded from retention), under legal hold (never deleted) or soft-deleted (hidden from lists and queries until restored or purged at purge_at), with the configured recovery_window", Response: []applicationLifecycle{}},
+	"PUT /admin/lifecycle":                             {Tag: "admin", Summary: "Archive or unarchive an application, set or release a legal hold (hold_reason required), soft-delete it (409 under legal hold) or restore it within the recovery window; omitted fields are unchanged", Body: lifecycleRequest{}, Response: applicationLifecycle{}},
+	"GET /admin/ingest/pauses":                         {Tag: "admin", Summary: "Applications with paused ingestion, their mode, reason, buffered entry count and entries rejected since startup", Response: []ingestPause{}},
+	"PUT /admin/ingest/pauses":                         {Tag: "admin", Summary: "Pause ingestion for an application without restarting: reject mode answers uploads with 503; buffer mode accepts them (id 0) into a bounded in-memory buffer written in order on resume or shutdown and rejects once buffer_limit is reached; the pause survives restarts", Body: ingestPauseRequest{}, Response: ingestPause{}},
+	"DELETE /admin/ingest/pauses": {Tag: "admin", Summary: "Resume ingestion for an application, writing its buffered entries in order; entries that fail go to the dead-letter queue", Response: ingestResumeResult{}, Query: []apiParam{
+		{Name: "application_id", Description: "Application to resume, tenant/app for tenant applications", Required: true},
+		{Name: "discard", Description: "true to drop the buffered entries instead of writing them"},
+	}},
+	"GET /admin/storage": {Tag: "admin", Summary: "Disk usage of this node's applications per day, with the free space of each file backend's file system and of each storage_volumes root", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications, default all including tenant applications"},
+	}},
+	"GET /admin/storage/prune/preview": {Tag: "admin", Summary: "Dry run of retention: segments that would be deleted for being older than max_age_days or, oldest first, to bring each application under max_mb (default its disk quota); archived and legal-hold applications are skipped; nothing is deleted", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications, default all including tenant applications"},
+		{Name: "max_age_days", Description: "Keep this many days including today"},
+		{Name: "max_mb", Description: "Size limit per application, default the application's disk quota"},
+	}},
+	"GET /admin/retention": {Tag: "admin", Summary: "Level-aware retention policy in effect for each application (days per level, default_days for other levels, 0 keeps forever) and the result of the last background run", Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications, default all including tenant applications"},
+	}},
+	"POST /admin/retention/run": {Tag: "admin", Summary: "Apply level retention now on this node: segments whose every level has expired are deleted, partially expired ones are rewritten keeping only unexpired entries; days count from the segment's day including today; archived, legal-hold and tiered segments are skipped", Response: retentionReport{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications, default all this node owns"},
+		{Name: "dry_run", Description: "true to only count the segments and entries that would be removed"},
+	}},
+	"GET /admin/snapshot": {Tag: "admin", Summary: "Download a tar.gz snapshot of this node's file backends and data directory (log IDs, backend placement, schemas, parsers, users, indexes) for migration; writes pause only while the files are opened; restore it on a fresh instance with the restore command before starting the server", ContentType: "application/gzip"},
+	"GET /admin/integrity": {Tag: "admin", Summary: "Scan stored segments for unparsable lines and unreadable (e.g. truncated .gz) files", Response: integrityReport{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to check, default all"},
+		{Name: "from", Description: "Only check segments that may contain logs after this time"},
+	}},
+	"POST /admin/integrity/quarantine": {Tag: "admin", Summary: "Check like GET /admin/integrity, then move damaged segments to the application's .quarantine directory and rewrite them with their parsable lines", Response: integrityReport{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to check, default all"},
+		{Name: "from", Description: "Only check segments that may contain logs after this time"},
+	}},
+	"GET /admin/indexes/verify": {Tag: "admin", Summary: "Compare the derived indexes with the raw segments: per-minute level counts of closed segments (histogram, /stats and counts), XID bloom filters (no stored XID may be missing) and the log id reservation (must not be behind the stored ids); also reports index entries for deleted segments; tiered segments are skipped", Response: indexReport{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to verify, default all"},
+	}},
+	"POST /admin/indexes/rebuild": {Tag: "admin", Summary: "Discard the counts, XID bloom filters and cached query results of the applications, rebuild them from the raw segments, raise a lagging log id reservation, then verify as GET /admin/indexes/verify; run after restoring a backup, a crash or a storage migration", Response: indexReport{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to rebuild, default all"},
+	}},
+	"GET /admin/replication": {Tag: "admin", Summary: "Replication state: on a primary with replication.standby set, per application the write-ahead log bytes not yet acknowledged by the standby, entries shipped and dropped (write-ahead log over max_pending_mb), the last acknowledged id and the last push error; on a standby with replication.accept set, the highest replicated id per application; entries are pushed over the gRPC method Replicate and written on the standby with their original ids, skipping ids already written, so a standby can take over without shared storage"},
+	"POST /admin/replay": {Tag: "admin", Summary: "Re-process stored logs through the current parser rules and Seata XID, branch, trace and mode extraction, rewriting changed segments and discarding their counts, XID bloom filters and cached results; ids, write order and sample rates are kept; tiered segments are skipped", Response: replayReport{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to replay, default all"},
+		{Name: "from", Description: "Only replay segments that may contain logs after this time"},
+		{Name: "pipeline", Description: "true to also re-run the ingest processors except sample; entries matched by drop processors are deleted"},
+		{Name: "dry_run", Description: "true to only count the entries that would change"},
+	}},
+	"GET /admin/exports": {Tag: "admin", Summary: "List Parquet export jobs"},
+	"POST /admin/exports": {Tag: "admin", Summary: "Export filtered logs in the background to Parquet files with a typed schema (timestamp as TIMESTAMP_MICROS, Seata and trace context as UTF8 columns, id, seq, sample_rate, and custom fields as JSON), one directory per job and application under the export dir or the configured S3 prefix; query masking is applied", Response: exportJob{}, Query: []apiParam{
+		{Name: "application_id", Description: "Comma-separated applications to export, default all"},
+		{Name: "from", Description: "Start time (inclusive)"},
+		{Name: "to", Description: "End time (exclusive)"},
+		{Name: "log_level", Description: "Only export entries with this level"},
+		{Name: "destination", Description: "local (default) or s3"},
+	}},
+	"GET /admin/exports/{id}": {Tag: "admin", Summary: "Get a Parquet export job and the files it wrote", Response: exportJob{}},
+	"GET /audit": {Tag: "admin", Summary: "API access audit records, newest first", Query: []apiParam{
+		{Name: "from", Description: "Start time, default 24 hours before to"},
+		{Name: "to", Description: "End time, default now"},
+		{Name: "tz", Description: "Time zone for from/to without offset"},
+		{Name: "route", Description: "Route template, e.g. /tenants/:tenant/query"},
+		{Name: "method", Description: "HTTP method"},
+		{Name: "tenant", Description: "Tenant name"},
+		{Name: "user", Description: "User name, when access control is enabled"},
+		{Name: "remote_addr", Description: "Client address"},
+		{Name: "status", Description: "Response status code"},
+		{Name: "limit", Description: "Maximum records, default 100"},
+	}, Response: []AuditRecord{}},
+
+	"GET /tenants/{tenant}/usage": {Tag: "tenants", Summary: "Tenant quota and today's usage"},
+
+	"GET /metrics": {Tag: "ops", Summary: "Prometheus metrics, including ingest_write_latency_seconds, a per-application summary (p50, p90, p99 over the last write_latency.window appends) of segment write latency", ContentType: "text/plain"},
+	"GET /probes":  {Tag: "ops", Summary: "Synthetic probe status"},
+}
+
+// 租户接口的路径前缀
+const tenantPathPrefix = "/tenants/{tenant}"
+
+// 生成 OpenAPI 3 文档
+func buildOpenAPISpec(routes gin.RoutesInfo) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	for _, route := range routes {
+		if strings.HasPrefix(route.Path, "/docs") || route.Path == "/" || strings.HasPrefix(route.Path, "/ui/") {
+			continue
+		}
+		path, pathParams := openAPIPath(route.Path)
+		doc, ok := apiDocs[route.Method+" "+path]
+		// 租户接口与对应的全局接口参数相同
+		if scoped := strings.TrimPrefix(path, tenantPathPrefix); !ok && scoped != path {
+			doc = apiDocs[route.Method+" "+scoped]
+			doc.Tag = "tenants"
+		}
+
+		op := map[string]interface{}{
+			"operationId": strings.ToLower(route.Method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(path),
+		}
+		if doc.Summary != "" {
+			op["summary"] = doc.Summary
+		}
+		if doc.Tag != "" {
+			op["tags"] = []string{doc.Tag}
+		}
+
+		var params []map[string]interface{}
+		for _, name := range pathParams {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+			})
+		}
+		for _, p := range doc.Query {
+			params = append(params, map[string]interface{}{
+				"name": p.Name, "in": "query", "required": p.Required, "description": p.Description,
+				"schema": map[string]string{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if doc.Body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaRef(reflect.TypeOf(doc.Body), schemas)},
+				},
+			}
+		}
+
+		contentType := doc.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		respSchema := interface{}(map[string]string{"type": "object"})
+		if doc.Response != nil {
+			respSchema = schemaRef(reflect.TypeOf(doc.Response), schemas)
+		} else if contentType != "application/json" {
+			respSchema = map[string]string{"type": "string"}
+		}
+		op["responses"] = map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "OK",
+				"content":     map[string]interface{}{contentType: map[string]interface{}{"schema": respSchema}},
+			},
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"error": map[string]string{"type": "string"}},
+					},
+				}},
+			},
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":       "Seata Log Analysis API",
+			"version":     "1.0.0",
+			"description": "Log ingestion, query and Seata transaction analysis.",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// 将 gin 的 :param 路径转换为 OpenAPI 的 {param} 形式
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			params = append(params, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// 根据 Go 类型生成 schema，结构体登记到 components 中并返回引用
+func schemaRef(t reflect.Type, schemas map[string]interface{}) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]string{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(Duration(0)) {
+		return map[string]string{"type": "string", "example": "30s"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]string{"type": "string"}
+	case reflect.Bool:
+		return map[string]string{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]string{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]string{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaRef(t.Elem(), schemas)}
+	case reflect.Struct:
+	default:
+		return map[string]string{"type": "object"}
+	}
+
+	name := t.Name()
+	if name == "" {
+		name = "Anonymous"
+	}
+	name = strings.ToUpper(name[:1]) + name[1:]
+	ref := map[string]string{"$ref": "#/components/schemas/" + name}
+	if _, ok := schemas[name]; ok {
+		return ref
+	}
+	schemas[name] = nil // 先占位，防止递归类型无限展开
+
+	properties := make(map[string]interface{})
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+			if jsonName == "-" {
+				continue
+			}
+			if jsonName == "" {
+				jsonName = field.Name
+			}
+			properties[jsonName] = schemaRef(field.Type, schemas)
+			if strings.Contains(field.Tag.Get("binding"), "required") {
+				required = append(required, jsonName)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	schemas[name] = schema
+	return ref
+}
+
+// 文档在首次请求时生成，此时所有路由均已注册
+var (
+	openAPIOnce sync.Once
+	openAPISpec map[string]interface{}
+)
+
+// OpenAPI 文档接口
+func openAPIHandler(router *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		openAPIOnce.Do(func() {
+			openAPISpec = buildOpenAPISpec(router.Routes())
+		})
+		c.JSON(http.StatusOK, openAPISpec)
+	}
+}
+
+// Swagger UI 页面，静态资源来自公共 CDN
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Seata Log Analysis API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/docs/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+// Swagger UI 接口
+func swaggerUIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
@@ -0,0 +1,394 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"logAnalysis/pkg/model"
+)
+
+// 输出转发：把写入成功的日志（可按应用和级别过滤）复制到下游，如上一级机房的本服务实例、Kafka 主题或 HTTP 接口，
+// 用于跨机房逐级汇聚。每个输出有独立的有界队列和发送协程，下游不可用时按退避重试同一批日志，
+// 队列满时丢弃新日志并计数，不会阻塞写入。HTTP 输出重试时带相同的 Idempotency-Key，
+// 下游开启去重时不会重复写入；Kafka 输出重试可能产生重复的消息
+type OutputConfig struct {
+	Name          string                       `json:"name"`           // 指标和日志中使用的名称，默认为 type
+	Type          string                       `json:"type"`           // loganalysis（本服务的另一个实例）、http 或 kafka
+	URL           string                       `json:"url"`            // loganalysis 为对方的服务地址，http 为接收 NDJSON 的地址
+	Headers       map[string]string            `json:"headers"`        // 随请求发送，如 X-API-Key
+	TenantHeaders map[string]map[string]string `json:"tenant_headers"` // loganalysis 发送租户应用时按租户使用的请求头，如租户的 API Key，覆盖 headers 中的同名项
+	Kafka         KafkaOutputConfig            `json:"kafka"`          // kafka 输出的 broker 和主题
+	Applications  []string                     `json:"applications"`   // 只转发这些应用，支持 * 通配，租户应用为 租户/应用；为空时不限
+	Levels        []string                     `json:"levels"`         // 只转发这些级别，如 ["ERROR"]，为空时不限
+	BatchSize     int                          `json:"batch_size"`     // 每批最多条数，默认 500
+	FlushInterval Duration                     `json:"flush_interval"` // 不足一批时的发送间隔，默认 1s
+	QueueSize     int                          `json:"queue_size"`     // 等待发送的日志上限，默认 10000
+	Timeout       Duration                     `json:"timeout"`        // 单次发送的超时，默认 10s
+	TLS           ClientTLSConfig              `json:"tls"`
+}
+
+// 输出类型
+const (
+	outputLogAnalysis = "loganalysis"
+	outputHTTP        = "http"
+	outputKafka       = "kafka"
+)
+
+// 发送失败后的重试间隔上限
+const maxOutputBackoff = 30 * time.Second
+
+var (
+	outputSent    = metrics.counter("output_sent_total", "Log entries delivered to downstream outputs, by output.")
+	outputDropped = metrics.counter("output_dropped_total", "Log entries not delivered to downstream outputs, by output and reason.")
+	outputErrors  = metrics.counter("output_errors_total", "Failed deliveries to downstream outputs, by output.")
+	outputQueued  = metrics.gauge("output_queue_depth", "Log entries waiting to be delivered, by output.")
+)
+
+// 下游拒绝了这批日志（如校验失败），重试也不会成功
+var errOutputRejected = errors.New("rejected by the output")
+
+// 下游的写入方式，key 为这批日志的标识，重试时不变
+type outputSink interface {
+	Send(ctx context.Context, key string, entries []LogData) error
+	Close() error
+}
+
+// 一个输出
+type output struct {
+	name     string
+	apps     []string
+	levels   map[string]bool
+	sink     outputSink
+	batch    int
+	interval time.Duration
+	timeout  time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan LogData
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// 全部输出
+type outputSet struct {
+	outputs []*output
+}
+
+// 按配置创建输出并启动发送协程，没有配置输出时返回 nil
+func newOutputSet(configs []OutputConfig) (*outputSet, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	set := &outputSet{}
+	names := make(map[string]bool)
+	for i, c := range configs {
+		if c.Name == "" {
+			c.Name = c.Type
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("output %d: duplicate name %q", i, c.Name)
+		}
+		names[c.Name] = true
+		o, err := newOutput(c)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %v", c.Name, err)
+		}
+		set.outputs = append(set.outputs, o)
+	}
+	for _, o := range set.outputs {
+		o.wg.Add(1)
+		go o.run()
+	}
+	return set, nil
+}
+
+func newOutput(c OutputConfig) (*output, error) {
+	if c.BatchSize < 0 || c.QueueSize < 0 {
+		return nil, errors.New("batch_size and queue_size must not be negative")
+	}
+	for _, pattern := range c.Applications {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid application %q", pattern)
+		}
+	}
+	o := &output{name: c.Name, apps: c.Applications, batch: c.BatchSize, interval: time.Duration(c.FlushInterval), timeout: time.Duration(c.Timeout), stop: make(chan struct{})}
+	if o.batch == 0 {
+		o.batch = 500
+	}
+	if o.interval <= 0 {
+		o.interval = time.Second
+	}
+	if o.timeout <= 0 {
+		o.timeout = 10 * time.Second
+	}
+	size := c.QueueSize
+	if size == 0 {
+		size = 10000
+	}
+	o.queue = make(chan LogData, size)
+	if len(c.Levels) > 0 {
+		o.levels = make(map[string]bool, len(c.Levels))
+		for _, level := range c.Levels {
+			o.levels[strings.ToUpper(level)] = true
+		}
+	}
+
+	var err error
+	switch c.Type {
+	case outputLogAnalysis:
+		if o.batch > maxBatchSize {
+			return nil, fmt.Errorf("batch_size must not exceed %d", maxBatchSize)
+		}
+		o.sink, err = newHTTPOutput(c, o.timeout, true)
+	case outputHTTP:
+		o.sink, err = newHTTPOutput(c, o.timeout, false)
+	case outputKafka:
+		o.sink, err = newKafkaOutput(c.Kafka, c.TLS, o.timeout)
+	default:
+		return nil, fmt.Errorf("unknown type %q", c.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// 写入成功后调用，把日志放入匹配的输出的队列，队列已满的输出丢弃这条日志
+func (s *outputSet) Publish(entry LogData) {
+	if s == nil {
+		return
+	}
+	for _, o := range s.outputs {
+		if o.matches(entry) {
+			o.enqueue(entry)
+		}
+	}
+}
+
+func (o *output) matches(entry LogData) bool {
+	if o.levels != nil && !o.levels[strings.ToUpper(entry.LogLevel)] {
+		return false
+	}
+	if len(o.apps) == 0 {
+		return true
+	}
+	for _, pattern := range o.apps {
+		if ok, _ := path.Match(pattern, entry.ApplicationID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *output) enqueue(entry LogData) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		outputDropped.Add(1, "output", o.name, "reason", "shutdown")
+		return
+	}
+	select {
+	case o.queue <- entry:
+		outputQueued.Set(float64(len(o.queue)), "output", o.name)
+	default:
+		outputDropped.Add(1, "output", o.name, "reason", "queue_full")
+	}
+}
+
+// 发送协程：凑满一批或到达发送间隔时发送，停机时发送队列中剩余的日志，下游不可用时直接丢弃
+func (o *output) run() {
+	defer o.wg.Done()
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	var batch []LogData
+	flush := func() {
+		if len(batch) > 0 && !o.deliver(batch) && o.stopped() {
+			n := len(o.queue)
+			for range o.queue {
+			}
+			outputDropped.Add(float64(n), "output", o.name, "reason", "shutdown")
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case entry, ok := <-o.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= o.batch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+		outputQueued.Set(float64(len(o.queue)), "output", o.name)
+	}
+}
+
+func (o *output) stopped() bool {
+	select {
+	case <-o.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// 发送一批日志，失败时按退避重试直到成功或被下游拒绝；停机后只再尝试一次
+func (o *output) deliver(batch []LogData) bool {
+	b := make([]byte, 16)
+	rand.Read(b)
+	key := hex.EncodeToString(b)
+	backoff := time.Second
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+		err := o.sink.Send(ctx, key, batch)
+		cancel()
+		if err == nil {
+			outputSent.Add(float64(len(batch)), "output", o.name)
+			return true
+		}
+		outputErrors.Add(1, "output", o.name)
+		log.Printf("output %s: unable to deliver %d entries: %v", o.name, len(batch), err)
+		if errors.Is(err, errOutputRejected) {
+			outputDropped.Add(float64(len(batch)), "output", o.name, "reason", "rejected")
+			return false
+		}
+		select {
+		case <-o.stop:
+			outputDropped.Add(float64(len(batch)), "output", o.name, "reason", "shutdown")
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxOutputBackoff {
+			backoff = maxOutputBackoff
+		}
+	}
+}
+
+// 停止接收新日志，尝试发送完队列中的日志后关闭
+func (s *outputSet) Close() error {
+	for _, o := range s.outputs {
+		o.mu.Lock()
+		o.closed = true
+		close(o.queue)
+		close(o.stop)
+		o.mu.Unlock()
+	}
+	var firstErr error
+	for _, o := range s.outputs {
+		o.wg.Wait()
+		if err := o.sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// HTTP 输出。loganalysis 类型按批量上传接口发送到另一个实例，租户应用发送到对方的租户接口；
+// http 类型以 NDJSON 发送到配置的地址
+type httpOutput struct {
+	url         string
+	headers     map[string]string
+	tenants     map[string]map[string]string
+	client      *http.Client
+	loganalysis bool
+}
+
+func newHTTPOutput(c OutputConfig, timeout time.Duration, loganalysis bool) (*httpOutput, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be an http or https URL")
+	}
+	client, err := newTLSHTTPClient(c.TLS, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &httpOutput{url: strings.TrimRight(c.URL, "/"), headers: c.Headers, tenants: c.TenantHeaders, client: client, loganalysis: loganalysis}, nil
+}
+
+func (h *httpOutput) Send(ctx context.Context, key string, entries []LogData) error {
+	if !h.loganalysis {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, entry := range entries {
+			if err := enc.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return h.post(ctx, h.url, key, "application/x-ndjson", buf.Bytes(), nil)
+	}
+
+	// 按租户分组，日志中的应用 ID 为对方接口下的原始 ID
+	groups := make(map[string][]LogData)
+	for _, entry := range entries {
+		tenant, app := model.SplitApplicationID(entry.ApplicationID)
+		entry.ApplicationID = app
+		entry.ID, entry.Seq = 0, 0
+		groups[tenant] = append(groups[tenant], entry)
+	}
+	for _, tenant := range sortedKeys(groups) {
+		body, err := json.Marshal(groups[tenant])
+		if err != nil {
+			return err
+		}
+		endpoint, groupKey := h.url+"/upload/batch", key
+		if tenant != "" {
+			endpoint, groupKey = h.url+"/tenants/"+url.PathEscape(tenant)+"/upload/batch", key+"-"+tenant
+		}
+		if err := h.post(ctx, endpoint, groupKey, "application/json", body, h.tenants[tenant]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *httpOutput) post(ctx context.Context, endpoint, key, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Idempotency-Key", key)
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s returned %s", errOutputRejected, endpoint, resp.Status)
+	}
+	return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+}
+
+func (h *httpOutput) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
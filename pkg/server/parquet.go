@@ -0,0 +1,402 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// 最小的 Parquet 写入实现：平铺的列（没有嵌套和重复字段），PLAIN 编码，每个行组的每列一个 v1 数据页，
+// Snappy 压缩；INT64 列记录最小值和最大值，DuckDB、Spark 可据此按时间跳过行组。
+// 元数据使用 Thrift compact 协议编码
+const parquetMagic = "PAR1"
+
+// 物理类型和转换类型，取值见 parquet.thrift
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetNoConverted     = -1
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+)
+
+const (
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+	parquetCodecSnappy   = 1
+)
+
+// 列的定义及当前行组中已写入的值
+type parquetColumn struct {
+	Name      string
+	Type      int32
+	Converted int32
+	Optional  bool
+
+	defined  []bool // 可选列每行是否有值
+	values   bytes.Buffer
+	nulls    int64
+	min, max int64
+	hasStats bool
+}
+
+// 已写出的列块
+type parquetChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+	values       int64
+	nulls        int64
+	min, max     int64
+	hasStats     bool
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+	size   int64
+}
+
+// 按行写入 Parquet 文件，每 groupRows 行写出一个行组，Close 时写出文件尾
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	groupRows int
+	rows      int
+	total     int64
+	groups    []parquetRowGroup
+}
+
+func newParquetWriter(w io.Writer, columns []parquetColumn, groupRows int) (*parquetWriter, error) {
+	p := &parquetWriter{w: w, groupRows: groupRows}
+	for i := range columns {
+		c := columns[i]
+		p.columns = append(p.columns, &c)
+	}
+	return p, p.write([]byte(parquetMagic))
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// 写入一行，values 与列一一对应：INT64 列为 int64，DOUBLE 列为 float64，BYTE_ARRAY 列为 string，
+// nil 表示空值，只允许出现在可选列
+func (p *parquetWriter) WriteRow(values ...any) error {
+	if len(values) != len(p.columns) {
+		return fmt.Errorf("expected %d values, got %d", len(p.columns), len(values))
+	}
+	for i, c := range p.columns {
+		v := values[i]
+		if c.Optional {
+			c.defined = append(c.defined, v != nil)
+		}
+		if v == nil {
+			if !c.Optional {
+				return fmt.Errorf("column %s is required", c.Name)
+			}
+			c.nulls++
+			continue
+		}
+		var scratch [8]byte
+		switch c.Type {
+		case parquetInt64:
+			n, ok := v.(int64)
+			if !ok {
+				return fmt.Errorf("column %s expects int64", c.Name)
+			}
+			binary.LittleEndian.PutUint64(scratch[:], uint64(n))
+			c.values.Write(scratch[:])
+			if !c.hasStats || n < c.min {
+				c.min = n
+			}
+			if !c.hasStats || n > c.max {
+				c.max = n
+			}
+			c.hasStats = true
+		case parquetDouble:
+			f, ok := v.(float64)
+			if !ok {
+				return fmt.Errorf("column %s expects float64", c.Name)
+			}
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(f))
+			c.values.Write(scratch[:])
+		case parquetByteArray:
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("column %s expects string", c.Name)
+			}
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(s)))
+			c.values.Write(scratch[:4])
+			c.values.WriteString(s)
+		}
+	}
+	p.rows++
+	if p.rows >= p.groupRows {
+		return p.flush()
+	}
+	return nil
+}
+
+// 当前文件已写入的行数
+func (p *parquetWriter) Rows() int64 {
+	return p.total + int64(p.rows)
+}
+
+// 写出当前行组
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(p.rows)}
+	for _, c := range p.columns {
+		var page bytes.Buffer
+		if c.Optional {
+			levels := encodeDefinitionLevels(c.defined)
+			var length [4]byte
+			binary.LittleEndian.PutUint32(length[:], uint32(len(levels)))
+			page.Write(length[:])
+			page.Write(levels)
+		}
+		page.Write(c.values.Bytes())
+		compressed := s2.EncodeSnappy(nil, page.Bytes())
+
+		var header thriftWriter
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(len(compressed)))
+		header.beginStruct(5)
+		header.i32(1, int32(p.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.stop()
+
+		chunk := parquetChunk{
+			offset:       p.offset,
+			uncompressed: int64(header.buf.Len() + page.Len()),
+			compressed:   int64(header.buf.Len() + len(compressed)),
+			values:       int64(p.rows),
+			nulls:        c.nulls,
+			min:          c.min,
+			max:          c.max,
+			hasStats:     c.hasStats,
+		}
+		if err := p.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := p.write(compressed); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.uncompressed
+
+		c.defined, c.nulls, c.hasStats = c.defined[:0], 0, false
+		c.values.Reset()
+	}
+	p.groups = append(p.groups, group)
+	p.total += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+// 写出剩余的行和文件尾，不关闭底层的 Writer
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	var meta thriftWriter
+	meta.i32(1, 1)
+	meta.listHeader(2, thriftStruct, len(p.columns)+1)
+	meta.beginElement()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(p.columns)))
+	meta.endStruct()
+	for _, c := range p.columns {
+		meta.beginElement()
+		meta.i32(1, c.Type)
+		repetition := int32(0) // REQUIRED
+		if c.Optional {
+			repetition = 1 // OPTIONAL
+		}
+		meta.i32(3, repetition)
+		meta.binary(4, c.Name)
+		if c.Converted != parquetNoConverted {
+			meta.i32(6, c.Converted)
+		}
+		meta.endStruct()
+	}
+	meta.i64(3, p.total)
+	meta.listHeader(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		meta.beginElement()
+		meta.listHeader(1, thriftStruct, len(g.chunks))
+		for i, chunk := range g.chunks {
+			c := p.columns[i]
+			meta.beginElement()
+			meta.i64(2, chunk.offset)
+			meta.beginStruct(3)
+			meta.i32(1, c.Type)
+			meta.listHeader(2, thriftI32, 2)
+			meta.element32(parquetEncodingPlain)
+			meta.element32(parquetEncodingRLE)
+			meta.listHeader(3, thriftBinary, 1)
+			meta.elementBinary(c.Name)
+			meta.i32(4, parquetCodecSnappy)
+			meta.i64(5, chunk.values)
+			meta.i64(6, chunk.uncompressed)
+			meta.i64(7, chunk.compressed)
+			meta.i64(9, chunk.offset)
+			meta.beginStruct(12)
+			meta.i64(3, chunk.nulls)
+			if chunk.hasStats {
+				var min, max [8]byte
+				binary.LittleEndian.PutUint64(min[:], uint64(chunk.min))
+				binary.LittleEndian.PutUint64(max[:], uint64(chunk.max))
+				meta.binary(5, string(max[:]))
+				meta.binary(6, string(min[:]))
+			}
+			meta.endStruct()
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, g.size)
+		meta.i64(3, g.rows)
+		meta.endStruct()
+	}
+	meta.binary(6, "seata-log-analysis")
+	// 按类型定义的排序，读取方才会使用 min_value 和 max_value
+	meta.listHeader(7, thriftStruct, len(p.columns))
+	for range p.columns {
+		meta.beginElement()
+		meta.beginStruct(1)
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.stop()
+
+	if err := p.write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+	if err := p.write(length[:]); err != nil {
+		return err
+	}
+	return p.write([]byte(parquetMagic))
+}
+
+// 定义级别的 RLE 编码（位宽 1），连续相同的值编码为一段
+func encodeDefinitionLevels(defined []bool) []byte {
+	var out []byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if defined[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+// Thrift compact 协议的字段类型
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// Thrift compact 协议编码，只实现 Parquet 元数据用到的部分
+type thriftWriter struct {
+	buf   bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) varint(v int64) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(v<<1^v>>63)))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.elementBinary(s)
+}
+
+func (t *thriftWriter) listHeader(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		t.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+	}
+}
+
+func (t *thriftWriter) element32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) elementBinary(s string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
+
+// 结构体字段
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.beginElement()
+}
+
+// 列表中的结构体元素
+func (t *thriftWriter) beginElement() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
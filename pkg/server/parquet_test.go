@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// Thrift compact 协议的解码，只用于测试：结构体解码为字段 ID → 值，列表为 []any，整数为 int64，binary 为 string
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (r *thriftReader) byte() byte {
+	if len(r.buf) == 0 {
+		r.t.Fatal("thrift data truncated")
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("malformed thrift varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		if len(r.buf) < n {
+			r.t.Fatal("thrift binary truncated")
+		}
+		s := string(r.buf[:n])
+		r.buf = r.buf[n:]
+		return s
+	case thriftList:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+		last = id
+	}
+}
+
+// 读取文件尾的 FileMetaData
+func readParquetFooter(t *testing.T, file []byte) map[int16]any {
+	t.Helper()
+	if len(file) < 12 || string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+		t.Fatalf("missing PAR1 magic: %x", file)
+	}
+	n := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if n > len(file)-12 {
+		t.Fatalf("footer length %d exceeds the file", n)
+	}
+	r := &thriftReader{t: t, buf: file[len(file)-8-n : len(file)-8]}
+	meta := r.structure()
+	if len(r.buf) != 0 {
+		t.Fatalf("%d bytes after FileMetaData", len(r.buf))
+	}
+	return meta
+}
+
+// 读取列块的数据页，返回解压后的页内容
+func readParquetPage(t *testing.T, file []byte, offset int64) []byte {
+	t.Helper()
+	r := &thriftReader{t: t, buf: file[offset:]}
+	header := r.structure()
+	if header[1] != int64(0) {
+		t.Fatalf("page type %v, want DATA_PAGE", header[1])
+	}
+	compressed := r.buf[:header[3].(int64)]
+	page, err := s2.Decode(nil, compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(page)) != header[2].(int64) {
+		t.Fatalf("page is %d bytes, header says %d", len(page), header[2])
+	}
+	return page
+}
+
+func TestParquetFooterRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	columns := []parquetColumn{
+		{Name: "timestamp", Type: parquetInt64, Converted: parquetTimestampMicros},
+		{Name: "log_level", Type: parquetByteArray, Converted: parquetUTF8},
+		{Name: "trace_id", Type: parquetByteArray, Converted: parquetUTF8, Optional: true},
+	}
+	w, err := newParquetWriter(&out, columns, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]any{{int64(300), "INFO", "t1"}, {int64(100), "ERROR", nil}, {int64(200), "WARN", "t3"}}
+	for _, row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := out.Bytes()
+	meta := readParquetFooter(t, file)
+
+	if meta[1] != int64(1) || meta[3] != int64(3) || meta[6] != "seata-log-analysis" {
+		t.Fatalf("version %v, num_rows %v, created_by %v", meta[1], meta[3], meta[6])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != 4 || schema[0].(map[int16]any)[5] != int64(3) {
+		t.Fatalf("schema = %v", schema)
+	}
+	for i, c := range columns {
+		element := schema[i+1].(map[int16]any)
+		repetition := int64(0)
+		if c.Optional {
+			repetition = 1
+		}
+		if element[4] != c.Name || element[1] != int64(c.Type) || element[3] != repetition || element[6] != int64(c.Converted) {
+			t.Fatalf("schema element %d = %v", i+1, element)
+		}
+	}
+
+	groups := meta[4].([]any)
+	if len(groups) != 2 {
+		t.Fatalf("%d row groups, want 2", len(groups))
+	}
+	wantRows := []int64{2, 1}
+	wantMin, wantMax := []int64{100, 200}, []int64{300, 200}
+	for g, group := range groups {
+		group := group.(map[int16]any)
+		if group[3] != wantRows[g] {
+			t.Fatalf("row group %d has %v rows, want %d", g, group[3], wantRows[g])
+		}
+		chunks := group[1].([]any)
+		for i, chunk := range chunks {
+			chunk := chunk.(map[int16]any)
+			cm := chunk[3].(map[int16]any)
+			if cm[4] != int64(parquetCodecSnappy) || cm[5] != wantRows[g] || cm[9] != chunk[2] {
+				t.Fatalf("row group %d column %d metadata = %v", g, i, cm)
+			}
+			page := readParquetPage(t, file, cm[9].(int64))
+			switch i {
+			case 0:
+				stats := cm[12].(map[int16]any)
+				min := int64(binary.LittleEndian.Uint64([]byte(stats[6].(string))))
+				max := int64(binary.LittleEndian.Uint64([]byte(stats[5].(string))))
+				if min != wantMin[g] || max != wantMax[g] {
+					t.Fatalf("row group %d timestamp stats [%d, %d], want [%d, %d]", g, min, max, wantMin[g], wantMax[g])
+				}
+				for r := 0; r < int(wantRows[g]); r++ {
+					if v := int64(binary.LittleEndian.Uint64(page[8*r:])); v != rows[2*g+r][0] {
+						t.Fatalf("row %d timestamp = %d", 2*g+r, v)
+					}
+				}
+			case 2:
+				// 第一个行组的第二行为空值，定义级别为 RLE 的两段
+				if g == 0 {
+					if stats := cm[12].(map[int16]any); stats[3] != int64(1) {
+						t.Fatalf("trace_id null count = %v, want 1", stats[3])
+					}
+					levels := page[4 : 4+binary.LittleEndian.Uint32(page)]
+					if !bytes.Equal(levels, []byte{0x02, 1, 0x02, 0}) {
+						t.Fatalf("definition levels = %x", levels)
+					}
+				}
+			}
+		}
+	}
+}
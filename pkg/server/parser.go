@@ -0,0 +1,249 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 应用的自定义行解析规则：遗留服务的日志布局既不是 Seata TC 布局也不是「时间 级别 消息」时，
+// 管理员为应用登记带命名分组的正则，原始文本上传、导入和 forward 输入按规则结构化。
+// 规则按顺序尝试，都不匹配时回退到内置的解析
+type AppParser struct {
+	ApplicationID string       `json:"application_id" binding:"required"` // 租户应用为 租户/应用
+	Rules         []ParserRule `json:"rules" binding:"required"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// 一条解析规则。命名分组 timestamp、level、message、xid、branch_id、thread、logger 填入对应字段，
+// 其他命名分组写入 fields；没有 message 分组时消息为整行
+type ParserRule struct {
+	Name            string `json:"name" binding:"required"`
+	Pattern         string `json:"pattern" binding:"required"`
+	TimestampLayout string `json:"timestamp_layout"` // Go 时间布局，如 2006/01/02 15:04:05；为空时保留原文，按常见格式识别
+
+	compiled *regexp.Regexp
+}
+
+var parserMatches = metrics.counter("custom_parser_matches_total", "Raw lines structured by a custom parser rule, by application and rule.")
+
+// 已登记的自定义解析规则
+type parserRegistry struct {
+	mu      sync.RWMutex
+	parsers map[string]*AppParser
+	path    string
+}
+
+func newParserRegistry(dataDir string) (*parserRegistry, error) {
+	r := &parserRegistry{parsers: make(map[string]*AppParser), path: filepath.Join(dataDir, "parsers.json")}
+	if err := loadJSONFile(r.path, &r.parsers); err != nil {
+		return nil, err
+	}
+	for app, p := range r.parsers {
+		if err := p.compile(); err != nil {
+			return nil, fmt.Errorf("parser for %s: %v", app, err)
+		}
+	}
+	return r, nil
+}
+
+func (p *AppParser) compile() error {
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
+	names := make(map[string]bool)
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid pattern: %v", rule.Name, err)
+		}
+		named := 0
+		for _, group := range re.SubexpNames() {
+			if group != "" {
+				named++
+			}
+		}
+		if named == 0 {
+			return fmt.Errorf("rule %s: pattern has no named groups", rule.Name)
+		}
+		rule.compiled = re
+	}
+	return nil
+}
+
+// 按规则解析一行，匹配时返回结构化的日志。now 用作缺省的时间和只有时分秒时的日期
+func (rule *ParserRule) parse(applicationID, line string, now time.Time) (LogData, bool) {
+	m := rule.compiled.FindStringSubmatch(line)
+	if m == nil {
+		return LogData{}, false
+	}
+	entry := LogData{
+		ApplicationID: applicationID,
+		LogLevel:      "INFO",
+		Timestamp:     now.Format(time.RFC3339Nano),
+		LogMessage:    line,
+	}
+	for i, name := range rule.compiled.SubexpNames() {
+		value := strings.TrimSpace(m[i])
+		if name == "" || value == "" {
+			continue
+		}
+		switch name {
+		case "timestamp":
+			entry.Timestamp = rule.timestamp(value, now)
+		case "level":
+			entry.LogLevel = strings.Replace(strings.ToUpper(value), "WARNING", "WARN", 1)
+		case "message":
+			entry.LogMessage = m[i]
+		case "xid":
+			entry.XID = value
+		case "branch_id":
+			entry.BranchID = value
+		case "thread":
+			entry.Thread = value
+		case "logger":
+			entry.Logger = value
+		default:
+			if entry.Fields == nil {
+				entry.Fields = make(map[string]string)
+			}
+			entry.Fields[name] = value
+		}
+	}
+	return entry, true
+}
+
+// 按布局转换时间戳，布局中没有日期时以 now 补全；无法解析时保留原文
+func (rule *ParserRule) timestamp(value string, now time.Time) string {
+	if rule.TimestampLayout == "" {
+		return value
+	}
+	t, err := time.ParseInLocation(rule.TimestampLayout, value, time.Local)
+	if err != nil {
+		return value
+	}
+	if t.Year() == 0 {
+		t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// 按应用的规则解析一行，没有登记规则或都不匹配时返回 false
+func (r *parserRegistry) Parse(applicationID, line string, now time.Time) (LogData, bool) {
+	if r == nil {
+		return LogData{}, false
+	}
+	r.mu.RLock()
+	p, ok := r.parsers[applicationID]
+	r.mu.RUnlock()
+	if !ok {
+		return LogData{}, false
+	}
+	for i := range p.Rules {
+		if entry, ok := p.Rules[i].parse(applicationID, line, now); ok {
+			parserMatches.Add(1, "application", applicationID, "rule", p.Rules[i].Name)
+			return entry, true
+		}
+	}
+	return LogData{}, false
+}
+
+// 登记或替换应用的解析规则
+func (r *parserRegistry) Put(p *AppParser) error {
+	if err := p.compile(); err != nil {
+		return err
+	}
+	p.UpdatedAt = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parsers[p.ApplicationID] = p
+	return saveJSONFile(r.path, r.parsers)
+}
+
+// 删除应用的解析规则
+func (r *parserRegistry) Delete(applicationID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.parsers[applicationID]; !ok {
+		return false, nil
+	}
+	delete(r.parsers, applicationID)
+	return true, saveJSONFile(r.path, r.parsers)
+}
+
+func (r *parserRegistry) List() []AppParser {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]AppParser, 0, len(r.parsers))
+	for _, p := range r.parsers {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 解析规则列表接口
+func (s *Service) parserListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"parsers": s.parsers.List()})
+}
+
+// 登记或替换解析规则请求，samples 中的示例行按新规则解析后随响应返回，便于确认规则
+type putParserRequest struct {
+	AppParser
+	Samples []string `json:"samples"`
+}
+
+// 登记或替换应用解析规则接口
+func (s *Service) parserPutHandler(c *gin.Context) {
+	var req putParserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	p := req.AppParser
+	if tenant, app := model.SplitApplicationID(p.ApplicationID); !validApplicationID(app) || (tenant != "" && !validApplicationID(tenant)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+	if err := s.parsers.Put(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	parsed := make([]LogData, 0, len(req.Samples))
+	now := time.Now()
+	for _, line := range req.Samples {
+		parsed = append(parsed, s.parseRawLine(p.ApplicationID, line, now))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Parser saved", "parser": p, "samples": parsed})
+}
+
+// 删除应用解析规则接口，路径中的应用 ID 可以带租户前缀
+func (s *Service) parserDeleteHandler(c *gin.Context) {
+	ok, err := s.parsers.Delete(strings.TrimPrefix(c.Param("application_id"), "/"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save parsers"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Parser not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Parser deleted"})
+}
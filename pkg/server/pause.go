@@ -0,0 +1,288 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 按应用暂停写入，用于隔离失控的服务而不必重启整个服务：
+//   - reject：拒绝该应用的新日志，HTTP 上传返回 503
+//   - buffer：新日志暂存在内存中，恢复写入时按收到的顺序写入；缓冲满后拒绝
+//
+// 暂停状态持久化在 data_dir/ingest_pauses.json，重启后保持；缓冲只在内存中，关闭服务时写入存储
+const (
+	pauseReject = "reject"
+	pauseBuffer = "buffer"
+)
+
+// 缓冲模式默认最多暂存的日志条数
+const defaultPauseBufferLimit = 10000
+
+var (
+	errIngestPaused = errors.New("ingestion is paused for the application")
+	errNotPaused    = errors.New("ingestion is not paused for the application")
+	errResuming     = errors.New("ingestion is being resumed for the application")
+)
+
+var pausedEntries = metrics.counter("ingest_paused_entries_total", "Log entries received for applications with paused ingestion, by result (rejected, buffered).")
+
+// 一个应用的暂停状态
+type ingestPause struct {
+	ApplicationID string    `json:"application_id"` // 租户应用为 租户/应用
+	Mode          string    `json:"mode"`
+	Reason        string    `json:"reason,omitempty"`
+	BufferLimit   int       `json:"buffer_limit,omitempty"`
+	PausedBy      string    `json:"paused_by,omitempty"`
+	PausedAt      time.Time `json:"paused_at"`
+	Buffered      int       `json:"buffered"` // 当前暂存的条数
+	Rejected      int64     `json:"rejected"` // 本次启动以来拒绝的条数
+
+	buffer   []pausedEntry
+	resuming bool // 正在写入缓冲，新日志继续排在缓冲之后
+}
+
+// 暂存的日志及写入时的参数
+type pausedEntry struct {
+	entry  LogData
+	day    time.Time
+	stored func(LogData)
+}
+
+// 暂停写入的应用
+type ingestPauseRegistry struct {
+	svc    *Service
+	mu     sync.Mutex
+	pauses map[string]*ingestPause
+	path   string
+	active atomic.Int32 // 暂停的应用数，为零时写入不加锁
+}
+
+func (s *Service) newIngestPauseRegistry(dataDir string) (*ingestPauseRegistry, error) {
+	r := &ingestPauseRegistry{svc: s, pauses: make(map[string]*ingestPause), path: filepath.Join(dataDir, "ingest_pauses.json")}
+	if err := loadJSONFile(r.path, &r.pauses); err != nil {
+		return nil, err
+	}
+	r.active.Store(int32(len(r.pauses)))
+	return r, nil
+}
+
+// 调用方持有 r.mu
+func (r *ingestPauseRegistry) save() error {
+	r.active.Store(int32(len(r.pauses)))
+	for _, p := range r.pauses {
+		p.Buffered = len(p.buffer)
+	}
+	return saveJSONFile(r.path, r.pauses)
+}
+
+// 写入前检查：应用未暂停时返回 false；缓冲模式下暂存日志并返回 true，拒绝模式或缓冲已满时返回 errIngestPaused
+func (r *ingestPauseRegistry) Hold(entry LogData, day time.Time, stored func(LogData)) (bool, error) {
+	if r == nil || r.active.Load() == 0 {
+		return false, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pauses[entry.ApplicationID]
+	if !ok {
+		return false, nil
+	}
+	if (p.Mode == pauseReject && !p.resuming) || len(p.buffer) >= p.BufferLimit {
+		p.Rejected++
+		pausedEntries.Add(1, "result", "rejected")
+		return false, errIngestPaused
+	}
+	p.buffer = append(p.buffer, pausedEntry{entry: entry, day: day, stored: stored})
+	p.Buffered = len(p.buffer)
+	pausedEntries.Add(1, "result", "buffered")
+	return true, nil
+}
+
+// 暂停请求
+type ingestPauseRequest struct {
+	ApplicationID string `json:"application_id" binding:"required"`
+	Mode          string `json:"mode"`         // reject 或 buffer，默认 reject
+	Reason        string `json:"reason"`       // 暂停的原因，如事故单号
+	BufferLimit   int    `json:"buffer_limit"` // 缓冲模式最多暂存的条数，默认 10000
+}
+
+// 暂停应用的写入，已暂停时更新模式和原因，已暂存的日志保留到恢复
+func (r *ingestPauseRegistry) Pause(req ingestPauseRequest, user string, now time.Time) (ingestPause, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pauses[req.ApplicationID]
+	if ok && p.resuming {
+		return ingestPause{}, errResuming
+	}
+	if !ok {
+		p = &ingestPause{ApplicationID: req.ApplicationID, PausedAt: now}
+		r.pauses[req.ApplicationID] = p
+	}
+	p.Mode, p.Reason, p.BufferLimit, p.PausedBy = req.Mode, req.Reason, req.BufferLimit, user
+	if err := r.save(); err != nil {
+		return ingestPause{}, err
+	}
+	return *p, nil
+}
+
+// 恢复写入的结果
+type ingestResumeResult struct {
+	ApplicationID string `json:"application_id"`
+	Written       int    `json:"written"`
+	Failed        int    `json:"failed"` // 写入失败的进入死信
+	Discarded     int    `json:"discarded"`
+}
+
+// 恢复应用的写入：按收到的顺序写入暂存的日志，discard 时丢弃之。写入缓冲期间收到的新日志排在缓冲之后
+func (r *ingestPauseRegistry) Resume(applicationID string, discard bool) (ingestResumeResult, error) {
+	res := ingestResumeResult{ApplicationID: applicationID}
+	r.mu.Lock()
+	p, ok := r.pauses[applicationID]
+	if !ok {
+		r.mu.Unlock()
+		return res, errNotPaused
+	}
+	if p.resuming {
+		r.mu.Unlock()
+		return res, errResuming
+	}
+	p.resuming = true
+	if discard {
+		res.Discarded = len(p.buffer)
+		p.buffer = nil
+	}
+	r.mu.Unlock()
+
+	for {
+		r.mu.Lock()
+		if len(p.buffer) == 0 {
+			if r.pauses[applicationID] == p {
+				delete(r.pauses, applicationID)
+			}
+			err := r.save()
+			r.mu.Unlock()
+			return res, err
+		}
+		item := p.buffer[0]
+		p.buffer = p.buffer[1:]
+		p.Buffered = len(p.buffer)
+		r.mu.Unlock()
+
+		if _, err := r.svc.persistEntry(item.entry, item.day, item.stored); err != nil {
+			res.Failed++
+			r.svc.deadLetters.Capture(item.entry, item.day, err)
+		} else {
+			res.Written++
+		}
+	}
+}
+
+// 关闭服务时写入所有暂存的日志，它们已向客户端确认收到。暂停状态保留到重启后
+func (r *ingestPauseRegistry) Close() error {
+	r.mu.Lock()
+	var items []pausedEntry
+	for _, p := range r.pauses {
+		items = append(items, p.buffer...)
+		p.buffer = nil
+	}
+	r.mu.Unlock()
+	for _, item := range items {
+		if _, err := r.svc.persistEntry(item.entry, item.day, item.stored); err != nil {
+			log.Printf("ingest pause: unable to write buffered entry: app=%s err=%v", item.entry.ApplicationID, err)
+			r.svc.deadLetters.Capture(item.entry, item.day, err)
+		}
+	}
+	return nil
+}
+
+// 暂停的应用
+func (r *ingestPauseRegistry) List() []ingestPause {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]ingestPause, 0, len(r.pauses))
+	for _, p := range r.pauses {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 暂停写入的应用列表接口
+func (s *Service) ingestPauseListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"pauses": s.ingestPauses.List()})
+}
+
+// 暂停写入接口
+func (s *Service) ingestPauseHandler(c *gin.Context) {
+	var req ingestPauseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if tenant, app := model.SplitApplicationID(req.ApplicationID); !validApplicationID(app) || (tenant != "" && !validApplicationID(tenant)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = pauseReject
+	}
+	if req.Mode != pauseReject && req.Mode != pauseBuffer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be reject or buffer"})
+		return
+	}
+	if req.BufferLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "buffer_limit must not be negative"})
+		return
+	}
+	if req.Mode == pauseBuffer && req.BufferLimit == 0 {
+		req.BufferLimit = defaultPauseBufferLimit
+	}
+	user := ""
+	if u := currentUser(c); u != nil {
+		user = u.Name
+	}
+	pause, err := s.ingestPauses.Pause(req, user, time.Now())
+	if errors.Is(err, errResuming) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ingestion is being resumed for " + req.ApplicationID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save ingest pause"})
+		return
+	}
+	log.Printf("ingest paused: app=%s mode=%s reason=%q by=%s", req.ApplicationID, req.Mode, req.Reason, user)
+	c.JSON(http.StatusOK, pause)
+}
+
+// 恢复写入接口，discard=true 时丢弃暂存的日志
+func (s *Service) ingestResumeHandler(c *gin.Context) {
+	applicationID := c.Query("application_id")
+	if tenant, app := model.SplitApplicationID(applicationID); !validApplicationID(app) || (tenant != "" && !validApplicationID(tenant)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+	res, err := s.ingestPauses.Resume(applicationID, c.Query("discard") == "true")
+	if errors.Is(err, errNotPaused) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ingestion is not paused for " + applicationID})
+		return
+	}
+	if errors.Is(err, errResuming) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ingestion is being resumed for " + applicationID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save ingest pause"})
+		return
+	}
+	log.Printf("ingest resumed: app=%s written=%d failed=%d discarded=%d", applicationID, res.Written, res.Failed, res.Discarded)
+	c.JSON(http.StatusOK, res)
+}
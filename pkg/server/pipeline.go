@@ -0,0 +1,321 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// 写入前处理流水线中的一个处理器
+type ProcessorConfig struct {
+	Type          string `json:"type"`           // drop、redact、mask、add_fields、rewrite_level、sample 或 enrich
+	Name          string `json:"name"`           // 用于指标和错误信息，默认为 type 加序号
+	ApplicationID string `json:"application_id"` // 只处理该应用的日志，租户应用写作 tenant/app，为空表示所有应用
+
+	Field       string             `json:"field"`        // 匹配或改写的字段，默认 log_message，也可以是 logger、xid 等内置字段或自定义字段
+	Pattern     string             `json:"pattern"`      // 正则表达式：drop 丢弃匹配的日志，redact 替换匹配的内容，rewrite_level 只改写匹配的日志
+	Replacement string             `json:"replacement"`  // redact 的替换内容，可引用分组如 $1，默认 ***
+	Fields      map[string]string  `json:"fields"`       // add_fields 附加的字段，已有的同名字段不会被覆盖
+	Level       string             `json:"level"`        // rewrite_level 的目标级别
+	Levels      map[string]string  `json:"levels"`       // rewrite_level 的级别映射，如 {"WARNING": "WARN"}
+	Rates       map[string]float64 `json:"rates"`        // sample 按级别保留的比例，如 {"DEBUG": 0.1}，* 为其余级别，未列出的全部保留
+	ResolveHost bool               `json:"resolve_host"` // enrich 反向解析上传方地址，附加 source_host 字段
+	Datacenter  string             `json:"datacenter"`   // enrich 附加的数据中心标签
+	Networks    map[string]string  `json:"networks"`     // enrich 按上传方所在网段（CIDR）确定数据中心，最长匹配优先，未匹配时使用 datacenter
+
+	MaskConfig // mask 使用的内置规则集和自定义规则，作用于日志消息和全部自定义字段
+}
+
+// 处理器：返回 false 时丢弃这条日志
+type processor interface {
+	Process(entry *LogData) bool
+}
+
+// 已登记的处理器类型，类型名 → 构造函数
+var processorTypes = map[string]func(ProcessorConfig) (processor, error){}
+
+// 日志被流水线丢弃
+var errDroppedEntry = errors.New("log entry dropped by pipeline")
+
+var pipelineDropped = metrics.counter("pipeline_dropped_total", "Log entries dropped by an ingest pipeline processor.")
+
+// 处理器及其作用范围
+type pipelineStage struct {
+	name          string
+	applicationID string
+	processor     processor
+}
+
+// 写入前依次执行的处理器
+type ingestPipeline []pipelineStage
+
+func newIngestPipeline(configs []ProcessorConfig) (ingestPipeline, error) {
+	var p ingestPipeline
+	for i, c := range configs {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("%s-%d", c.Type, i)
+		}
+		if c.Field == "" {
+			c.Field = "log_message"
+		}
+		build, ok := processorTypes[c.Type]
+		if !ok {
+			return nil, fmt.Errorf("processor %s: unknown type %q", c.Name, c.Type)
+		}
+		proc, err := build(c)
+		if err != nil {
+			return nil, fmt.Errorf("processor %s: %w", c.Name, err)
+		}
+		p = append(p, pipelineStage{name: c.Name, applicationID: c.ApplicationID, processor: proc})
+	}
+	return p, nil
+}
+
+// 依次执行处理器，返回 false 表示日志被丢弃
+func (p ingestPipeline) Process(entry *LogData) bool {
+	for _, stage := range p {
+		if stage.applicationID != "" && stage.applicationID != entry.ApplicationID {
+			continue
+		}
+		if !stage.processor.Process(entry) {
+			pipelineDropped.Add(1, "processor", stage.name)
+			return false
+		}
+	}
+	return true
+}
+
+// 重放已存储的日志时执行处理器，跳过采样：存储的日志已经过采样，再次采样会丢失日志
+func (p ingestPipeline) Replay(entry *LogData) bool {
+	for _, stage := range p {
+		if _, ok := stage.processor.(*sampleProcessor); ok {
+			continue
+		}
+		if stage.applicationID != "" && stage.applicationID != entry.ApplicationID {
+			continue
+		}
+		if !stage.processor.Process(entry) {
+			pipelineDropped.Add(1, "processor", stage.name)
+			return false
+		}
+	}
+	return true
+}
+
+// 读取处理器操作的字段
+func entryFieldValue(entry *LogData, field string) string {
+	switch field {
+	case "log_message":
+		return entry.LogMessage
+	case "log_level":
+		return entry.LogLevel
+	case "timestamp":
+		return entry.Timestamp
+	}
+	v, _ := logFieldValue(*entry, field)
+	return v
+}
+
+// 改写处理器操作的字段，内置字段之外的写入自定义字段
+func setEntryField(entry *LogData, field, value string) {
+	switch field {
+	case "log_message":
+		entry.LogMessage = value
+	case "log_level":
+		entry.LogLevel = value
+	case "timestamp":
+		entry.Timestamp = value
+	case "logger":
+		entry.Logger = value
+	case "thread":
+		entry.Thread = value
+	case "xid":
+		entry.XID = value
+	case "branch_id":
+		entry.BranchID = value
+	case "trace_id":
+		entry.TraceID = value
+	case "span_id":
+		entry.SpanID = value
+	default:
+		if _, ok := entry.Fields[field]; !ok {
+			return
+		}
+		entry.Fields[field] = value
+	}
+}
+
+func compileProcessorPattern(c ProcessorConfig, required bool) (*regexp.Regexp, error) {
+	if c.Pattern == "" {
+		if required {
+			return nil, errors.New("pattern is required")
+		}
+		return nil, nil
+	}
+	return regexp.Compile(c.Pattern)
+}
+
+// 丢弃字段匹配正则的日志，如健康检查、心跳
+type dropProcessor struct {
+	field   string
+	pattern *regexp.Regexp
+}
+
+func (p *dropProcessor) Process(entry *LogData) bool {
+	return !p.pattern.MatchString(entryFieldValue(entry, p.field))
+}
+
+// 替换字段中匹配正则的内容，如密码、令牌
+type redactProcessor struct {
+	field       string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func (p *redactProcessor) Process(entry *LogData) bool {
+	if v := entryFieldValue(entry, p.field); v != "" {
+		setEntryField(entry, p.field, p.pattern.ReplaceAllString(v, p.replacement))
+	}
+	return true
+}
+
+// 附加固定字段，如环境、集群
+type addFieldsProcessor struct {
+	fields map[string]string
+}
+
+func (p *addFieldsProcessor) Process(entry *LogData) bool {
+	for k, v := range p.fields {
+		if _, ok := entry.Fields[k]; ok || len(entry.Fields) >= 64 {
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[k] = v
+	}
+	return true
+}
+
+// 改写日志级别：按映射转换，或将字段匹配正则的日志改为指定级别
+type rewriteLevelProcessor struct {
+	field   string
+	pattern *regexp.Regexp
+	level   string
+	levels  map[string]string
+}
+
+func (p *rewriteLevelProcessor) Process(entry *LogData) bool {
+	if level, ok := p.levels[strings.ToUpper(entry.LogLevel)]; ok {
+		entry.LogLevel = level
+	}
+	if p.pattern != nil && p.pattern.MatchString(entryFieldValue(entry, p.field)) {
+		entry.LogLevel = p.level
+	}
+	return true
+}
+
+// 按级别采样，保留的日志记录累计的保留比例。带 XID 或 trace_id 的日志按其哈希决定去留，
+// 同一个事务或 trace 的日志在各应用中一起保留或一起丢弃
+type sampleProcessor struct {
+	rates map[string]float64
+}
+
+func (p *sampleProcessor) Process(entry *LogData) bool {
+	rate, ok := p.rates[strings.ToUpper(entry.LogLevel)]
+	if !ok {
+		if rate, ok = p.rates["*"]; !ok {
+			return true
+		}
+	}
+	if rate >= 1 {
+		return true
+	}
+
+	var x float64
+	if key := entry.XID; key != "" || entry.TraceID != "" {
+		if key == "" {
+			key = entry.TraceID
+		}
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		x = float64(h.Sum64()>>11) / (1 << 53)
+	} else {
+		x = rand.Float64()
+	}
+	if x >= rate {
+		return false
+	}
+	entry.SampleRate = entrySampleRate(*entry) * rate
+	return true
+}
+
+// 日志的保留比例，未经采样的为 1
+func entrySampleRate(entry LogData) float64 {
+	if entry.SampleRate > 0 && entry.SampleRate < 1 {
+		return entry.SampleRate
+	}
+	return 1
+}
+
+// 统计时一条日志代表的条数，即保留比例的倒数
+func entryWeight(entry LogData) float64 {
+	return 1 / entrySampleRate(entry)
+}
+
+func init() {
+	processorTypes["drop"] = func(c ProcessorConfig) (processor, error) {
+		re, err := compileProcessorPattern(c, true)
+		if err != nil {
+			return nil, err
+		}
+		return &dropProcessor{field: c.Field, pattern: re}, nil
+	}
+	processorTypes["redact"] = func(c ProcessorConfig) (processor, error) {
+		re, err := compileProcessorPattern(c, true)
+		if err != nil {
+			return nil, err
+		}
+		replacement := c.Replacement
+		if replacement == "" {
+			replacement = "***"
+		}
+		return &redactProcessor{field: c.Field, pattern: re, replacement: replacement}, nil
+	}
+	processorTypes["add_fields"] = func(c ProcessorConfig) (processor, error) {
+		if len(c.Fields) == 0 {
+			return nil, errors.New("fields is required")
+		}
+		return &addFieldsProcessor{fields: c.Fields}, nil
+	}
+	processorTypes["rewrite_level"] = func(c ProcessorConfig) (processor, error) {
+		re, err := compileProcessorPattern(c, false)
+		if err != nil {
+			return nil, err
+		}
+		if (re == nil) == (c.Level != "") || (re == nil && len(c.Levels) == 0) {
+			return nil, errors.New("requires levels, or pattern together with level")
+		}
+		levels := make(map[string]string, len(c.Levels))
+		for from, to := range c.Levels {
+			levels[strings.ToUpper(from)] = strings.ToUpper(to)
+		}
+		return &rewriteLevelProcessor{field: c.Field, pattern: re, level: strings.ToUpper(c.Level), levels: levels}, nil
+	}
+	processorTypes["sample"] = func(c ProcessorConfig) (processor, error) {
+		if len(c.Rates) == 0 {
+			return nil, errors.New("rates is required")
+		}
+		rates := make(map[string]float64, len(c.Rates))
+		for level, rate := range c.Rates {
+			if rate < 0 || rate > 1 {
+				return nil, fmt.Errorf("rate for %s must be between 0 and 1", level)
+			}
+			rates[strings.ToUpper(level)] = rate
+		}
+		return &sampleProcessor{rates: rates}, nil
+	}
+}
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+	"logAnalysis/pkg/plugin"
+)
+
+// 插件：通过 pkg/plugin 登记的第三方代码订阅写入、查询和告警事件，或提供 /analysis/findings 中的分析器。
+// 插件与服务编译在一起（Go 的 plugin 包要求插件与服务以完全相同的依赖和工具链构建，部署时难以保证），
+// 在 main 包中以空白导入引入即可启用。每个插件有自己的事件队列和处理协程，队列满时丢弃事件
+type PluginsConfig struct {
+	Disabled  []string                   `json:"disabled"`   // 已编译进来但不启用的插件
+	Config    map[string]json.RawMessage `json:"config"`     // 插件名 → 传给插件 Init 的配置
+	QueueSize int                        `json:"queue_size"` // 每个插件的事件队列长度，默认 1024
+	Webhook   string                     `json:"webhook"`    // 插件触发的告警推送到该地址，为空时只记录
+}
+
+var (
+	pluginEvents  = metrics.counter("plugin_events_total", "Events delivered to plugins, by plugin and event type.")
+	pluginDropped = metrics.counter("plugin_events_dropped_total", "Events dropped because the plugin's queue was full, by plugin and event type.")
+	pluginPanics  = metrics.counter("plugin_panics_total", "Plugin callbacks that panicked, by plugin.")
+)
+
+// 事件类型，也用于指标标签
+const (
+	pluginEventIngest = "ingest"
+	pluginEventQuery  = "query"
+	pluginEventAlert  = "alert"
+)
+
+// 一个启用的插件
+type loadedPlugin struct {
+	name   string
+	plugin plugin.Plugin
+	ingest plugin.IngestHook
+	query  plugin.QueryHook
+	alert  plugin.AlertHook
+	queue  chan func(context.Context)
+
+	delivered atomic.Int64
+	dropped   atomic.Int64
+	panics    atomic.Int64
+}
+
+// 启用的插件及其事件分发，没有插件时为 nil，各方法可以在 nil 上调用
+type pluginManager struct {
+	plugins []*loadedPlugin
+	webhook string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	hasIngest, hasQuery, hasAlert bool
+
+	mu     sync.RWMutex // 停机后不再放入队列
+	closed bool
+}
+
+func (s *Service) newPluginManager(c PluginsConfig) (*pluginManager, error) {
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+	registered := plugin.Registered()
+	known := make(map[string]bool, len(registered))
+	for _, p := range registered {
+		known[p.Name()] = true
+	}
+	for _, name := range c.Disabled {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown plugin %q in disabled", name)
+		}
+	}
+	for name := range c.Config {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown plugin %q in config", name)
+		}
+	}
+
+	m := &pluginManager{webhook: c.Webhook}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	for _, p := range registered {
+		name := p.Name()
+		if slices.Contains(c.Disabled, name) {
+			continue
+		}
+		if initializer, ok := p.(plugin.Initializer); ok {
+			if err := initializer.Init(c.Config[name], pluginHost{svc: s, name: name, manager: m}); err != nil {
+				m.cancel()
+				return nil, fmt.Errorf("plugin %s: %w", name, err)
+			}
+		}
+		lp := &loadedPlugin{name: name, plugin: p, queue: make(chan func(context.Context), c.QueueSize)}
+		lp.ingest, _ = p.(plugin.IngestHook)
+		lp.query, _ = p.(plugin.QueryHook)
+		lp.alert, _ = p.(plugin.AlertHook)
+		m.hasIngest = m.hasIngest || lp.ingest != nil
+		m.hasQuery = m.hasQuery || lp.query != nil
+		m.hasAlert = m.hasAlert || lp.alert != nil
+		if provider, ok := p.(plugin.AnalyzerProvider); ok {
+			s.analyzers[pluginAnalyzerName(name)] = func() analysis.Analyzer { return &pluginAnalyzer{inner: provider.NewAnalyzer()} }
+		}
+		m.plugins = append(m.plugins, lp)
+		log.Printf("Plugin %s enabled", name)
+	}
+	if len(m.plugins) == 0 {
+		m.cancel()
+		return nil, nil
+	}
+	for _, lp := range m.plugins {
+		m.wg.Add(1)
+		go m.run(lp)
+	}
+	return m, nil
+}
+
+// 插件分析器在 analyzers 中的名称
+func pluginAnalyzerName(name string) string {
+	return "plugin:" + name
+}
+
+// 依次执行插件队列中的回调，回调 panic 时记录并继续
+func (m *pluginManager) run(lp *loadedPlugin) {
+	defer m.wg.Done()
+	for fn := range lp.queue {
+		m.call(lp, fn)
+	}
+}
+
+func (m *pluginManager) call(lp *loadedPlugin, fn func(context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			lp.panics.Add(1)
+			pluginPanics.Add(1, "plugin", lp.name)
+			log.Printf("Plugin %s panicked: %v\n%s", lp.name, r, debug.Stack())
+		}
+	}()
+	fn(m.ctx)
+}
+
+// 放入插件的队列，队列满时丢弃
+func (m *pluginManager) dispatch(lp *loadedPlugin, eventType string, fn func(context.Context)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return
+	}
+	select {
+	case lp.queue <- fn:
+		lp.delivered.Add(1)
+		pluginEvents.Add(1, "plugin", lp.name, "type", eventType)
+	default:
+		lp.dropped.Add(1)
+		pluginDropped.Add(1, "plugin", lp.name, "type", eventType)
+	}
+}
+
+// 一条日志已写入
+func (m *pluginManager) Ingest(entry LogData, received time.Time) {
+	if m == nil || !m.hasIngest {
+		return
+	}
+	ev := plugin.IngestEvent{Entry: pluginEntry(entry), ReceivedAt: received}
+	for _, lp := range m.plugins {
+		if h := lp.ingest; h != nil {
+			m.dispatch(lp, pluginEventIngest, func(ctx context.Context) { h.OnIngest(ctx, ev) })
+		}
+	}
+}
+
+// 一个查询接口的请求已完成
+func (m *pluginManager) Query(c *gin.Context, start time.Time) {
+	if m == nil || !m.hasQuery {
+		return
+	}
+	ev := plugin.QueryEvent{
+		Route:          c.FullPath(),
+		Tenant:         c.GetString("tenant"),
+		User:           userName(currentUser(c)),
+		ApplicationIDs: splitList(c.Query("application_id")),
+		Params:         c.Request.URL.Query(),
+		Status:         c.Writer.Status(),
+		Count:          c.GetInt("audit.count"),
+		Duration:       time.Since(start),
+		At:             start,
+	}
+	for _, lp := range m.plugins {
+		if h := lp.query; h != nil {
+			m.dispatch(lp, pluginEventQuery, func(ctx context.Context) { h.OnQuery(ctx, ev) })
+		}
+	}
+}
+
+// 一条告警已触发
+func (m *pluginManager) Alert(ev AlertEvent) {
+	if m == nil || !m.hasAlert {
+		return
+	}
+	pev := plugin.AlertEvent{
+		Rule:          ev.Rule,
+		ApplicationID: ev.ApplicationID,
+		GroupKey:      ev.GroupKey,
+		Value:         ev.Value,
+		Threshold:     ev.Threshold,
+		Message:       ev.Message,
+		FiredAt:       ev.FiredAt,
+	}
+	if ev.Sample.ApplicationID != "" {
+		sample := pluginEntry(ev.Sample)
+		pev.Sample = &sample
+	}
+	for _, lp := range m.plugins {
+		if h := lp.alert; h != nil {
+			m.dispatch(lp, pluginEventAlert, func(ctx context.Context) { h.OnAlert(ctx, pev) })
+		}
+	}
+}
+
+// 处理完队列中的事件后停止插件
+func (m *pluginManager) Close() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	m.closed = true
+	for _, lp := range m.plugins {
+		close(lp.queue)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+	m.cancel()
+	for _, lp := range m.plugins {
+		if closer, ok := lp.plugin.(plugin.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("Plugin %s close failed: %v", lp.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 提供给插件的 plugin.Host
+type pluginHost struct {
+	svc     *Service
+	name    string
+	manager *pluginManager
+}
+
+func (h pluginHost) Alert(a plugin.Alert) {
+	ev := AlertEvent{
+		Rule:          "plugin:" + h.name + "/" + a.Rule,
+		ApplicationID: a.ApplicationID,
+		GroupKey:      a.GroupKey,
+		Value:         a.Value,
+		Threshold:     a.Threshold,
+		Message:       a.Message,
+		LogTime:       time.Now(),
+	}
+	if a.Sample != nil {
+		ev.Sample = logDataFromPlugin(*a.Sample)
+		if at, ok := parser.ParseTime(a.Sample.Timestamp, time.Now()); ok {
+			ev.LogTime = at
+		}
+	}
+	h.svc.alertEngine.Fire(ev, h.manager.webhook)
+}
+
+func (h pluginHost) Logf(format string, args ...any) {
+	log.Printf("Plugin %s: %s", h.name, fmt.Sprintf(format, args...))
+}
+
+// 转换为插件使用的日志结构
+func pluginEntry(entry LogData) plugin.Entry {
+	tenant, app := model.SplitApplicationID(entry.ApplicationID)
+	return plugin.Entry{
+		Tenant:        tenant,
+		ApplicationID: app,
+		ID:            entry.ID,
+		Seq:           entry.Seq,
+		LogLevel:      entry.LogLevel,
+		Timestamp:     entry.Timestamp,
+		LogMessage:    entry.LogMessage,
+		Logger:        entry.Logger,
+		Thread:        entry.Thread,
+		XID:           entry.XID,
+		BranchID:      entry.BranchID,
+		TraceID:       entry.TraceID,
+		SpanID:        entry.SpanID,
+		Fields:        entry.Fields,
+	}
+}
+
+func logDataFromPlugin(e plugin.Entry) LogData {
+	app := e.ApplicationID
+	if e.Tenant != "" {
+		app = e.Tenant + model.TenantSeparator + app
+	}
+	return LogData{
+		ApplicationID: app,
+		LogLevel:      e.LogLevel,
+		Timestamp:     e.Timestamp,
+		LogMessage:    e.LogMessage,
+		Logger:        e.Logger,
+		Thread:        e.Thread,
+		XID:           e.XID,
+		BranchID:      e.BranchID,
+		TraceID:       e.TraceID,
+		SpanID:        e.SpanID,
+		ID:            e.ID,
+		Seq:           e.Seq,
+		Fields:        e.Fields,
+	}
+}
+
+// 把插件的分析器接入 runAnalyzers，发现转换为服务的 Finding，证据指向存储中的日志
+type pluginAnalyzer struct {
+	inner plugin.Analyzer
+}
+
+func (a *pluginAnalyzer) Observe(entry LogData, ref logRef, at time.Time) {
+	e := pluginEntry(entry)
+	e.Ref = &plugin.Ref{ApplicationID: ref.ApplicationID, File: ref.File, Offset: ref.Offset}
+	a.inner.Observe(e, at)
+}
+
+func (a *pluginAnalyzer) Findings() []Finding {
+	var findings []Finding
+	for _, pf := range a.inner.Findings() {
+		f := Finding{
+			Code:      pf.Code,
+			Severity:  pf.Severity,
+			Title:     pf.Title,
+			Message:   pf.Message,
+			Entities:  []Entity{},
+			Evidence:  []EvidenceRef{},
+			Count:     pf.Count,
+			FirstSeen: pf.FirstSeen,
+			LastSeen:  pf.LastSeen,
+		}
+		for _, e := range pf.Entities {
+			f.Entities = append(f.Entities, Entity{Type: e.Type, ID: e.ID})
+		}
+		for _, e := range pf.Evidence {
+			if len(f.Evidence) >= analysis.MaxEvidence {
+				break
+			}
+			if e.Ref != nil {
+				ref := logRef{ApplicationID: e.Ref.ApplicationID, File: e.Ref.File, Offset: e.Ref.Offset}
+				f.Evidence = append(f.Evidence, analysis.NewEvidence(logDataFromPlugin(e), ref))
+			}
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// 启用的插件
+type pluginStatus struct {
+	Name      string   `json:"name"`
+	Hooks     []string `json:"hooks"`              // ingest、query、alert
+	Analyzer  string   `json:"analyzer,omitempty"` // 在 /analysis/findings 的 analyzers 中使用的名称
+	Queued    int      `json:"queued"`
+	Delivered int64    `json:"delivered"`
+	Dropped   int64    `json:"dropped"`
+	Panics    int64    `json:"panics"`
+}
+
+// 插件接口：列出启用的插件、订阅的事件和投递情况
+func (s *Service) pluginListHandler(c *gin.Context) {
+	list := make([]pluginStatus, 0)
+	if s.plugins != nil {
+		for _, lp := range s.plugins.plugins {
+			st := pluginStatus{Name: lp.name, Hooks: []string{}, Queued: len(lp.queue), Delivered: lp.delivered.Load(), Dropped: lp.dropped.Load(), Panics: lp.panics.Load()}
+			if lp.ingest != nil {
+				st.Hooks = append(st.Hooks, pluginEventIngest)
+			}
+			if lp.query != nil {
+				st.Hooks = append(st.Hooks, pluginEventQuery)
+			}
+			if lp.alert != nil {
+				st.Hooks = append(st.Hooks, pluginEventAlert)
+			}
+			if _, ok := lp.plugin.(plugin.AnalyzerProvider); ok {
+				st.Analyzer = pluginAnalyzerName(lp.name)
+			}
+			list = append(list, st)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	c.JSON(http.StatusOK, gin.H{"plugins": list})
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 合成探针配置：定期上传一条已知日志，并验证其在 SLA 内可被查询到
+type ProbeConfig struct {
+	Name          string   `json:"name"`
+	ApplicationID string   `json:"application_id"`
+	Interval      Duration `json:"interval"`
+	SLA           Duration `json:"sla"`
+	Webhook       string   `json:"webhook"` // 探针失败时的告警推送地址
+}
+
+// 探针运行状态
+type probeStatus struct {
+	Name          string    `json:"name"`
+	ApplicationID string    `json:"application_id"`
+	Runs          int       `json:"runs"`
+	Failures      int       `json:"failures"`
+	LastRun       time.Time `json:"last_run"`
+	LastSuccess   bool      `json:"last_success"`
+	LastLatencyMs float64   `json:"last_latency_ms"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+var (
+	probeRunsTotal    = metrics.counter("probe_runs_total", "Synthetic probe runs.")
+	probeFailureTotal = metrics.counter("probe_failures_total", "Synthetic probe runs that missed the SLA or failed.")
+	probeLatency      = metrics.gauge("probe_last_latency_seconds", "Time from upload until the probe entry became queryable.")
+	probeUp           = metrics.gauge("probe_up", "Whether the last probe run succeeded.")
+)
+
+// 探针调度器
+type ProbeRunner struct {
+	svc     *Service
+	baseURL string
+	apiKey  string // 启用访问控制时使用的 API Key
+	probes  []ProbeConfig
+	client  *http.Client
+
+	mu     sync.Mutex
+	status map[string]*probeStatus
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// 创建探针调度器，补全缺省配置
+func (s *Service) newProbeRunner(baseURL, apiKey string, probes []ProbeConfig, client *http.Client) *ProbeRunner {
+	r := &ProbeRunner{
+		svc:     s,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  client,
+		status:  make(map[string]*probeStatus),
+		stop:    make(chan struct{}),
+	}
+	for _, p := range probes {
+		if p.ApplicationID == "" {
+			p.ApplicationID = "synthetic-probe"
+		}
+		if p.Interval <= 0 {
+			p.Interval = Duration(time.Minute)
+		}
+		if p.SLA <= 0 {
+			p.SLA = Duration(10 * time.Second)
+		}
+		r.probes = append(r.probes, p)
+		r.status[p.Name] = &probeStatus{Name: p.Name, ApplicationID: p.ApplicationID}
+	}
+	return r
+}
+
+// 探针默认访问本机监听地址
+func probeBaseURL(listen string, https bool) string {
+	scheme := "http://"
+	if https {
+		scheme = "https://"
+	}
+	if strings.HasPrefix(listen, ":") {
+		return scheme + "127.0.0.1" + listen
+	}
+	return scheme + listen
+}
+
+// 启动所有探针
+func (r *ProbeRunner) Start() {
+	for _, p := range r.probes {
+		r.wg.Add(1)
+		go func(p ProbeConfig) {
+			defer r.wg.Done()
+			ticker := time.NewTicker(time.Duration(p.Interval))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-r.stop:
+					return
+				case <-ticker.C:
+					r.runOnce(p)
+				}
+			}
+		}(p)
+	}
+}
+
+// 停止所有探针
+func (r *ProbeRunner) Close() error {
+	close(r.stop)
+	r.wg.Wait()
+	return nil
+}
+
+// 执行一次探测
+func (r *ProbeRunner) runOnce(p ProbeConfig) {
+	start := time.Now()
+	latency, err := r.probe(p, start)
+
+	probeRunsTotal.Add(1, "probe", p.Name)
+	r.mu.Lock()
+	st := r.status[p.Name]
+	st.Runs++
+	st.LastRun = start
+	st.LastSuccess = err == nil
+	st.LastError = ""
+	if err != nil {
+		st.Failures++
+		st.LastError = err.Error()
+	} else {
+		st.LastLatencyMs = float64(latency) / float64(time.Millisecond)
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		probeFailureTotal.Add(1, "probe", p.Name)
+		probeUp.Set(0, "probe", p.Name)
+		r.svc.alertEngine.Fire(AlertEvent{
+			Rule:          "probe:" + p.Name,
+			ApplicationID: p.ApplicationID,
+			Value:         1,
+			LogTime:       start,
+			Message:       err.Error(),
+		}, p.Webhook)
+		return
+	}
+	probeUp.Set(1, "probe", p.Name)
+	probeLatency.Set(latency.Seconds(), "probe", p.Name)
+}
+
+// 上传探针日志并轮询查询接口，返回从上传到可查询的耗时
+func (r *ProbeRunner) probe(p ProbeConfig, start time.Time) (time.Duration, error) {
+	token := fmt.Sprintf("probe-%s-%d", p.Name, start.UnixNano())
+	body, _ := json.Marshal(LogData{
+		ApplicationID: p.ApplicationID,
+		LogLevel:      "INFO",
+		Timestamp:     start.UTC().Format(time.RFC3339Nano),
+		LogMessage:    "synthetic probe " + token,
+	})
+
+	resp, err := r.do(http.MethodPost, "/upload", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("upload failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("upload returned status %d", resp.StatusCode)
+	}
+
+	deadline := start.Add(time.Duration(p.SLA))
+	params := url.Values{"application_id": {p.ApplicationID}, "log_level": {"INFO"}, "limit": {"1000"}}
+	for {
+		found, err := r.queryContains(params, token)
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			return time.Since(start), nil
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("entry not queryable within SLA %s", time.Duration(p.SLA))
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// 向服务发送请求，配置了 API Key 时附带在 X-API-Key 中
+func (r *ProbeRunner) do(method, uri string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, r.baseURL+uri, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.apiKey != "" {
+		req.Header.Set("X-API-Key", r.apiKey)
+	}
+	return r.client.Do(req)
+}
+
+// 查询并判断结果中是否包含探针标记
+func (r *ProbeRunner) queryContains(params url.Values, token string) (bool, error) {
+	resp, err := r.do(http.MethodGet, "/query?"+params.Encode(), nil)
+	if err != nil {
+		return false, fmt.Errorf("query failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("query returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Logs []LogData `json:"logs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("invalid query response: %v", err)
+	}
+	for _, entry := range result.Logs {
+		if strings.Contains(entry.LogMessage, token) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 探针状态接口
+func (s *Service) probeStatusHandler(c *gin.Context) {
+	s.probeRunner.mu.Lock()
+	defer s.probeRunner.mu.Unlock()
+	statuses := make([]probeStatus, 0, len(s.probeRunner.probes))
+	for _, p := range s.probeRunner.probes {
+		statuses = append(statuses, *s.probeRunner.status[p.Name])
+	}
+	c.JSON(http.StatusOK, gin.H{"probes": statuses})
+}
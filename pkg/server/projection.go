@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 查询结果中可以选择的字段：LogData 的 JSON 字段和 trace_url
+var projectableFields = func() map[string]bool {
+	names := map[string]bool{"trace_url": true}
+	t := reflect.TypeOf(LogData{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// 查询结果的字段投影，如 fields=timestamp,log_message；fields.<key> 只保留自定义字段中的该项
+type fieldProjection struct {
+	keys   map[string]bool
+	custom map[string]bool // 只保留的自定义字段，keys 包含 fields 时忽略
+}
+
+// 解析 fields 参数，未指定时返回 nil，表示返回完整的日志
+func parseProjection(c *gin.Context) (*fieldProjection, bool) {
+	names := splitList(c.Query("fields"))
+	if len(names) == 0 {
+		return nil, true
+	}
+	p := &fieldProjection{keys: make(map[string]bool), custom: make(map[string]bool)}
+	for _, name := range names {
+		if key, ok := strings.CutPrefix(name, fieldParamPrefix); ok && key != "" {
+			p.custom[key] = true
+			continue
+		}
+		if !projectableFields[name] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown field: " + name})
+			return nil, false
+		}
+		p.keys[name] = true
+	}
+	return p, true
+}
+
+// 是否输出该字段，未指定投影时输出全部字段
+func (p *fieldProjection) Selects(name string) bool {
+	return p == nil || p.keys[name]
+}
+
+// 编码日志并只保留选择的字段，未出现在日志中的字段（如空的 xid）不输出
+func (p *fieldProjection) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if p == nil || err != nil {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	out := make(map[string]json.RawMessage, len(p.keys)+1)
+	for key := range p.keys {
+		if value, ok := all[key]; ok {
+			out[key] = value
+		}
+	}
+	if len(p.custom) > 0 && !p.keys["fields"] {
+		var fields map[string]string
+		json.Unmarshal(all["fields"], &fields)
+		picked := make(map[string]string)
+		for key := range p.custom {
+			if value, ok := fields[key]; ok {
+				picked[key] = value
+			}
+		}
+		if len(picked) > 0 {
+			if out["fields"], err = json.Marshal(picked); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/parser"
+	"logAnalysis/pkg/storage"
+)
+
+// 日志查询条件
+type logQuery struct {
+	ApplicationID  string
+	ApplicationIDs []string // 同时查询的多个应用，设置时忽略 ApplicationID
+	LogLevel       string
+	View           string              // 在临时视图的结果集上查询
+	Fields         map[string][]string // 结构化字段过滤条件
+	From, To       time.Time           // 日志时间范围，零值表示不限
+	SinceID        int64               // 只匹配 ID 大于 SinceID 的日志，零值表示不限
+	MaxID          int64               // 只匹配 ID 不大于 MaxID 的日志，零值表示不限
+	HasSince       bool                // 指定了 since 游标，since=0 时 SinceID 为零也是增量查询
+	SinceOrder     int64               // 增量查询：只匹配写入顺序晚于该值的日志，零值表示不限
+	OrderHorizon   int64               // 增量查询只匹配写入顺序不晚于该值的日志，见 deltaQuerySettle
+	Search         *regexp.Regexp      // 日志消息须匹配的关键字或正则，nil 表示不限
+	Match          func(LogData) bool  // 其他逐条匹配的条件，nil 表示不限
+	Archive        *archiveScan        // 是否读取归档到对象存储的分段并记录处理情况，nil 时透明地读取
+
+	ctx     context.Context // 请求的取消和截止时间，nil 表示不限
+	explain *queryExplain   // 记录执行说明，nil 表示不记录
+}
+
+func (q logQuery) context() context.Context {
+	if q.ctx == nil {
+		return context.Background()
+	}
+	return q.ctx
+}
+
+// 交给自行执行查询的后端的过滤条件
+func (q logQuery) filter() storage.Filter {
+	return storage.Filter{Context: q.ctx, ApplicationID: q.ApplicationID, LogLevel: q.LogLevel, From: q.From, To: q.To, SinceID: q.SinceID, MaxID: q.MaxID}
+}
+
+// 是否按 ID 范围查询，此时结果按 ID 排序
+func (q logQuery) byID() bool {
+	return q.SinceID > 0 || q.MaxID > 0 || (q.HasSince && !q.byWriteOrder())
+}
+
+func (q logQuery) matchesID(entry LogData) bool {
+	return entry.ID > q.SinceID && (q.MaxID == 0 || entry.ID <= q.MaxID)
+}
+
+// 解析前的快速过滤：级别必然出现在原始行中，不包含的行直接跳过。
+// 消息中出现级别关键字的行也会通过，解析后还要用 entryMatchesLevel 比较级别字段
+func matchesLevel(line, level string) bool {
+	return level == "" || strings.Contains(line, level)
+}
+
+// 日志的级别字段是否满足级别条件，与实时推送一样精确比较
+func entryMatchesLevel(entry LogData, level string) bool {
+	return level == "" || entry.LogLevel == level
+}
+
+// 执行查询，按存储顺序回调每条匹配的日志，fn 返回 false 时停止
+func (s *Service) runLogQuery(q logQuery, fn func(entry LogData, ref logRef) bool) error {
+	if len(q.ApplicationIDs) > 0 {
+		return s.runMultiLogQuery(q, fn)
+	}
+	if q.explain != nil {
+		matched := fn
+		fn = func(entry LogData, ref logRef) bool {
+			q.explain.Matched++
+			return matched(entry, ref)
+		}
+	}
+	if q.byID() {
+		matched := fn
+		fn = func(entry LogData, ref logRef) bool {
+			return !q.matchesID(entry) || matched(entry, ref)
+		}
+	}
+	if q.byWriteOrder() {
+		matched := fn
+		fn = func(entry LogData, ref logRef) bool {
+			return !q.matchesWriteOrder(entry, entryTime(entry, ref)) || matched(entry, ref)
+		}
+	}
+	if q.Search != nil {
+		matched := fn
+		fn = func(entry LogData, ref logRef) bool {
+			return !q.Search.MatchString(entry.LogMessage) || matched(entry, ref)
+		}
+	}
+	if q.Match != nil {
+		matched := fn
+		fn = func(entry LogData, ref logRef) bool {
+			return !q.Match(entry) || matched(entry, ref)
+		}
+	}
+	visit := parsedLineVisitor(func(entry LogData, ref logRef) bool {
+		if !entryMatchesLevel(entry, q.LogLevel) || !matchesFields(entry, q.Fields) {
+			return true
+		}
+		q.explain.filterHit()
+		if !q.From.IsZero() || !q.To.IsZero() {
+			if at := entryTime(entry, ref); (!q.From.IsZero() && at.Before(q.From)) || (!q.To.IsZero() && at.After(q.To)) {
+				return true
+			}
+		}
+		return fn(entry, ref)
+	})
+	match := func(line string, ref logRef) bool {
+		q.explain.lineRead()
+		if !matchesLevel(line, q.LogLevel) {
+			return true
+		}
+		return visit(line, ref)
+	}
+
+	if q.View != "" {
+		refs, err := s.viewStore.Refs(q.View)
+		if err != nil {
+			return err
+		}
+		q.explain.application(q.View, "view")
+		return s.forEachRefLine(refs, match)
+	}
+
+	// 级别、时间和 ID 范围在后端中过滤，其余条件逐条匹配
+	if qs, ok := s.queryStoreOf(q.ApplicationID); ok {
+		if q.explain != nil {
+			q.explain.Strategy = countFromBackend
+			q.explain.application(q.ApplicationID, s.backends.BackendOf(q.ApplicationID))
+		}
+		return qs.ScanLines(q.filter(), match)
+	}
+
+	// 级别和字段条件的匹配结果按分段缓存，时间范围在缓存之外过滤
+	return s.scanStoredCached(q, q.From, func(entry LogData, ref logRef) bool {
+		if !q.From.IsZero() || !q.To.IsZero() {
+			if at := entryTime(entry, ref); (!q.From.IsZero() && at.Before(q.From)) || (!q.To.IsZero() && at.After(q.To)) {
+				return true
+			}
+		}
+		return fn(entry, ref)
+	})
+}
+
+// 依次在每个应用上执行查询，没有日志的应用被跳过
+func (s *Service) runMultiLogQuery(q logQuery, fn func(entry LogData, ref logRef) bool) error {
+	apps := q.ApplicationIDs
+	q.ApplicationIDs = nil
+	stopped := false
+	for _, app := range apps {
+		q.ApplicationID = app
+		err := s.runLogQuery(q, func(entry LogData, ref logRef) bool {
+			stopped = !fn(entry, ref)
+			return !stopped
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 排序方式
+const (
+	sortAsc  = "asc"
+	sortDesc = "desc"
+)
+
+// 查询命中的日志及其排序用时间
+type QueryHit struct {
+	Entry LogData
+	Ref   logRef
+	At    time.Time
+}
+
+// 日志的排序时间，无法解析时使用所在文件的日期
+func entryTime(entry LogData, ref logRef) time.Time {
+	day := logFileDate(ref.File)
+	if at, ok := parser.ParseTime(entry.Timestamp, day); ok {
+		return at
+	}
+	return day
+}
+
+// 带存储顺序的命中，用于稳定排序
+type seqHit struct {
+	QueryHit
+	seq int
+}
+
+// 按排序方向判断 a 是否排在 b 之前，时间相同的日志按写入顺序排列（倒序时反过来），
+// 无法比较写入顺序时保持扫描顺序。byID 时按日志 ID 排序，byOrder 时按写入顺序排序
+func hitBefore(a, b seqHit, desc, byID, byOrder bool) bool {
+	if byID && a.Entry.ID != b.Entry.ID {
+		return (a.Entry.ID < b.Entry.ID) != desc
+	}
+	if byOrder {
+		if oa, ob := writeOrder(a.Entry, a.At), writeOrder(b.Entry, b.At); oa != ob {
+			return (oa < ob) != desc
+		}
+	}
+	if !a.At.Equal(b.At) {
+		return a.At.Before(b.At) != desc
+	}
+	if before, ok := ingestOrder(a.Entry, b.Entry); ok {
+		return before != desc
+	}
+	return (a.seq < b.seq) != desc
+}
+
+// 保留排序最靠前的若干条命中，堆顶是其中最靠后的一条
+type topHits struct {
+	desc, byID, byOrder bool
+	hits                []seqHit
+}
+
+func (h *topHits) Len() int           { return len(h.hits) }
+func (h *topHits) Less(i, j int) bool { return h.before(h.hits[j], h.hits[i]) }
+func (h *topHits) Swap(i, j int)      { h.hits[i], h.hits[j] = h.hits[j], h.hits[i] }
+func (h *topHits) Push(x interface{}) { h.hits = append(h.hits, x.(seqHit)) }
+func (h *topHits) Pop() interface{} {
+	last := h.hits[len(h.hits)-1]
+	h.hits = h.hits[:len(h.hits)-1]
+	return last
+}
+
+func (h *topHits) before(a, b seqHit) bool { return hitBefore(a, b, h.desc, h.byID, h.byOrder) }
+
+// 执行查询并按时间（按 ID 范围查询时按 ID，按写入顺序增量查询时按写入顺序）排序，返回前 limit 条。内存中最多保留 limit 条命中，
+// summary 不为 nil 时汇总全部命中
+func (s *Service) collectSorted(q logQuery, order string, limit int, summary *querySummary) ([]QueryHit, error) {
+	h := &topHits{desc: order == sortDesc, byID: q.byID(), byOrder: q.byWriteOrder()}
+	seq := 0
+	err := s.runLogQuery(q, func(entry LogData, ref logRef) bool {
+		seq++
+		hit := seqHit{QueryHit{Entry: entry, Ref: ref, At: entryTime(entry, ref)}, seq}
+		if summary != nil {
+			summary.Add(hit.QueryHit)
+		}
+		if h.Len() < limit {
+			heap.Push(h, hit)
+		} else if h.before(hit, h.hits[0]) {
+			// 比保留结果中最靠后的一条更靠前时替换之
+			h.hits[0] = hit
+			heap.Fix(h, 0)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(h.hits, func(i, j int) bool { return h.before(h.hits[i], h.hits[j]) })
+	hits := make([]QueryHit, len(h.hits))
+	for i, hit := range h.hits {
+		hits[i] = hit.QueryHit
+	}
+	return hits, nil
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelMatchesLevelFieldOnly(t *testing.T) {
+	at := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, tc := range []struct {
+		level, message string
+		want           bool
+	}{
+		{"ERROR", "Branch commit failed", true},
+		{"INFO", "TC reported ERROR for branch 42", false},
+		{"WARN", "ERROR", false},
+		{"DEBUG", "retrying after ERRORS", false},
+	} {
+		line, err := encodeLogRecord(LogData{ApplicationID: "orders", LogLevel: tc.level, LogMessage: tc.message, Timestamp: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		// 与查询相同：原始行的子串只作为预过滤，解析后比较级别字段
+		got := matchesLevel(line, "ERROR")
+		if got {
+			entry, err := parseLogLine(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = entryMatchesLevel(entry, "ERROR")
+		}
+		if got != tc.want {
+			t.Errorf("level=ERROR on %s entry %q = %v, want %v", tc.level, tc.message, got, tc.want)
+		}
+	}
+}
+
+// 执行查询并记录执行说明，返回按存储顺序匹配的日志消息
+func runExplainedQuery(t *testing.T, s *Service, q logQuery) ([]string, *queryExplain) {
+	t.Helper()
+	q.explain = &queryExplain{TimingMS: make(map[string]float64), started: time.Now()}
+	var messages []string
+	err := s.runLogQuery(q, func(entry LogData, ref logRef) bool {
+		messages = append(messages, entry.LogMessage)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages, q.explain
+}
+
+func TestQueryLevelMatchesLevelFieldOnly(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	now := time.Now()
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "TC reported ERROR for branch 42", now))
+	ingestTestEntry(t, s, testEntry("orders", "ERROR", "Branch commit failed", now.Add(time.Millisecond)))
+	ingestTestEntry(t, s, testEntry("orders", "WARN", "ERROR", now.Add(2*time.Millisecond)))
+	ingestTestEntry(t, s, testEntry("orders", "DEBUG", "retrying after ERRORS", now.Add(3*time.Millisecond)))
+
+	want := []string{"Branch commit failed"}
+	// 第二次查询命中缓存，结果应当相同
+	for i := 0; i < 2; i++ {
+		if got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}, LogLevel: "ERROR"}); !reflect.DeepEqual(got, want) {
+			t.Fatalf("query %d: level=ERROR returned %q, want %q", i+1, got, want)
+		}
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}, LogLevel: "WARN"}); !reflect.DeepEqual(got, []string{"ERROR"}) {
+		t.Fatalf("level=WARN returned %q", got)
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}}); len(got) != 4 {
+		t.Fatalf("query without level returned %q, want all 4 entries", got)
+	}
+}
+
+func TestQueryCacheHitAndInvalidationOnAppend(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	now := time.Now()
+	ingestTestEntry(t, s, testEntry("orders", "ERROR", "first failure", now))
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "ERROR mentioned in passing", now.Add(time.Millisecond)))
+	q := logQuery{ApplicationID: "orders", LogLevel: "ERROR"}
+
+	got, explain := runExplainedQuery(t, s, q)
+	if !reflect.DeepEqual(got, []string{"first failure"}) || explain.Segments.Scanned != 1 || explain.Segments.Cached != 0 {
+		t.Fatalf("first query: got %q, segments %+v, want one scanned segment", got, explain.Segments)
+	}
+	got, explain = runExplainedQuery(t, s, q)
+	if !reflect.DeepEqual(got, []string{"first failure"}) || explain.Segments.Scanned != 0 || explain.Segments.Cached != 1 {
+		t.Fatalf("repeated query: got %q, segments %+v, want one cached segment", got, explain.Segments)
+	}
+
+	// 追加写入使分段的缓存失效
+	ingestTestEntry(t, s, testEntry("orders", "ERROR", "second failure", now.Add(2*time.Millisecond)))
+	if n := len(s.queryCache.items); n != 0 {
+		t.Fatalf("cache holds %d results after append, want 0", n)
+	}
+	got, explain = runExplainedQuery(t, s, q)
+	if !reflect.DeepEqual(got, []string{"first failure", "second failure"}) || explain.Segments.Scanned != 1 || explain.Segments.Cached != 0 {
+		t.Fatalf("query after append: got %q, segments %+v, want a rescan with both failures", got, explain.Segments)
+	}
+	got, explain = runExplainedQuery(t, s, q)
+	if len(got) != 2 || explain.Segments.Cached != 1 {
+		t.Fatalf("query after rescan: got %q, segments %+v, want the rescanned result cached", got, explain.Segments)
+	}
+}
+
+func TestDeltaQueryStartsFromSinceZero(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	now := time.Now()
+	for _, msg := range []string{"first", "second", "third"} {
+		ingestTestEntry(t, s, testEntry("orders", "INFO", msg, now))
+		now = now.Add(time.Millisecond)
+	}
+	router := newTestRouter(t, s)
+	poll := func(since string) ([]string, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/query?application_id=orders&log_level=INFO&limit=2&since="+since, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("since=%s returned %d: %s", since, w.Code, w.Body)
+		}
+		var resp struct {
+			Logs []struct {
+				LogMessage string `json:"log_message"`
+			} `json:"logs"`
+			NextSince string `json:"next_since"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.NextSince != w.Header().Get("X-Next-Since") {
+			t.Fatalf("next_since %q differs from X-Next-Since %q", resp.NextSince, w.Header().Get("X-Next-Since"))
+		}
+		var messages []string
+		for _, l := range resp.Logs {
+			messages = append(messages, l.LogMessage)
+		}
+		return messages, resp.NextSince
+	}
+
+	got, next := poll("0")
+	if !reflect.DeepEqual(got, []string{"first", "second"}) || next == "" {
+		t.Fatalf("since=0 returned %q with cursor %q, want the first two entries and a cursor", got, next)
+	}
+	got, next = poll(next)
+	if !reflect.DeepEqual(got, []string{"third"}) || next == "" {
+		t.Fatalf("second poll returned %q with cursor %q, want the third entry and a cursor", got, next)
+	}
+	if got, _ = poll(next); len(got) != 0 {
+		t.Fatalf("third poll returned %q, want nothing new", got)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	queryRejected   = metrics.counter("query_rejected_total", "Heavy queries rejected by the concurrency limit, by reason.")
+	queryTimeouts   = metrics.counter("query_timeouts_total", "Heavy queries stopped by the per-query deadline.")
+	queriesRunning  = metrics.gauge("queries_running", "Heavy queries currently executing.")
+	queriesQueueing = metrics.gauge("queries_queued", "Heavy queries waiting for a free slot.")
+)
+
+// 重查询（查询、聚合、分析、事务时间线等需要扫描日志的接口）的并发和耗时限制，
+// 避免一次昂贵的正则搜索占满磁盘和 CPU，拖慢写入。slots 为 nil 时不限并发
+type queryLimiter struct {
+	slots        chan struct{}
+	maxQueued    int
+	queueTimeout time.Duration
+	timeout      time.Duration
+
+	mu     sync.Mutex
+	queued int
+}
+
+func newQueryLimiter(c QueryConfig) (*queryLimiter, error) {
+	if c.MaxConcurrent < 0 || c.MaxQueued < 0 || c.Timeout < 0 || c.QueueTimeout < 0 {
+		return nil, fmt.Errorf("limits must not be negative")
+	}
+	l := &queryLimiter{maxQueued: c.MaxQueued, queueTimeout: time.Duration(c.QueueTimeout), timeout: time.Duration(c.Timeout)}
+	if c.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, c.MaxConcurrent)
+	}
+	if l.maxQueued == 0 {
+		l.maxQueued = c.MaxConcurrent
+	}
+	if l.queueTimeout == 0 {
+		l.queueTimeout = 10 * time.Second
+	}
+	return l, nil
+}
+
+// 取得执行槽位，队列已满、排队超时或请求被取消时返回拒绝的原因
+func (l *queryLimiter) acquire(ctx context.Context) string {
+	select {
+	case l.slots <- struct{}{}:
+		return ""
+	default:
+	}
+
+	l.mu.Lock()
+	if l.queued >= l.maxQueued {
+		l.mu.Unlock()
+		return "queue_full"
+	}
+	l.queued++
+	queriesQueueing.Set(float64(l.queued))
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		queriesQueueing.Set(float64(l.queued))
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return ""
+	case <-timer.C:
+		return "queue_timeout"
+	case <-ctx.Done():
+		return "canceled"
+	}
+}
+
+func (l *queryLimiter) release() {
+	<-l.slots
+}
+
+// 为一次重查询排队取得执行槽位，返回带查询截止时间的 context 和查询结束时调用的 release；
+// 取不到槽位时返回拒绝的原因。REST 接口经 queryGuard 调用，gRPC 的 Query 直接调用
+func (s *Service) admitQuery(ctx context.Context) (context.Context, func(), string) {
+	l := s.queryLimits
+	release := func() {}
+	if l.slots != nil {
+		if reason := l.acquire(ctx); reason != "" {
+			queryRejected.Add(1, "reason", reason)
+			return ctx, release, reason
+		}
+		queriesRunning.Set(float64(len(l.slots)))
+		release = func() {
+			l.release()
+			queriesRunning.Set(float64(len(l.slots)))
+		}
+	}
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		free := release
+		release = func() {
+			cancel()
+			free()
+		}
+	}
+	return ctx, release, ""
+}
+
+// 重查询中间件：排队取得执行槽位，并为请求设置截止时间；扫描日志的函数从请求的 context 中得知超时并停止。
+// 放在集群路由之后，只在实际执行查询的节点上占用槽位；请求完成后通知订阅查询事件的插件
+func (s *Service) queryGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx, release, reason := s.admitQuery(c.Request.Context())
+		if reason != "" {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many concurrent queries, retry later"})
+			return
+		}
+		defer release()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		s.plugins.Query(c, start)
+	}
+}
+
+// 读取日志失败时的响应：超过查询截止时间返回 504，其他错误返回 500
+func readFailed(c *gin.Context, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		queryTimeouts.Add(1)
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Query exceeded the time limit"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read application logs"})
+}
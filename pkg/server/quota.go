@@ -0,0 +1,244 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 应用的磁盘配额
+type DiskQuotaConfig struct {
+	DefaultMB    int            `json:"default_mb"`   // 未单独配置的应用的配额，0 表示不限
+	Applications map[string]int `json:"applications"` // 应用 ID（租户应用为 租户/应用）→ 配额 MB，0 表示不限
+	Policy       string         `json:"policy"`       // reject（默认）：超出时拒绝写入；delete_oldest：删除最旧的分段腾出空间
+}
+
+// 超出配额时的处理方式
+const (
+	quotaReject       = "reject"
+	quotaDeleteOldest = "delete_oldest"
+)
+
+var errDiskQuotaExceeded = errors.New("application disk quota exceeded")
+
+var (
+	diskQuotaRejected = metrics.counter("disk_quota_rejected_total", "Writes rejected by the application disk quota, by application.")
+	diskQuotaDeleted  = metrics.counter("disk_quota_deleted_segments_total", "Segments deleted to stay within the application disk quota, by application.")
+)
+
+// 占用超过这么久重新统计一次，压缩、分层和其他节点的写入都会改变实际占用
+const quotaRecountInterval = time.Minute
+
+type dirUsage struct {
+	bytes     int64
+	countedAt time.Time
+}
+
+// 按应用目录统计磁盘占用并执行配额
+type diskQuotaManager struct {
+	svc    *Service
+	config DiskQuotaConfig
+
+	mu    sync.Mutex
+	usage map[string]*dirUsage // 应用目录 → 占用
+}
+
+func (s *Service) newDiskQuotaManager(c DiskQuotaConfig) (*diskQuotaManager, error) {
+	if c.Policy == "" {
+		c.Policy = quotaReject
+	}
+	if c.Policy != quotaReject && c.Policy != quotaDeleteOldest {
+		return nil, fmt.Errorf("policy must be %s or %s", quotaReject, quotaDeleteOldest)
+	}
+	return &diskQuotaManager{svc: s, config: c, usage: make(map[string]*dirUsage)}, nil
+}
+
+// 应用的配额字节数，0 表示不限
+func (m *diskQuotaManager) Limit(applicationID string) int64 {
+	if m == nil {
+		return 0
+	}
+	mb, ok := m.config.Applications[applicationID]
+	if !ok {
+		mb = m.config.DefaultMB
+	}
+	return int64(mb) << 20
+}
+
+// 应用目录当前的磁盘占用
+func (m *diskQuotaManager) Usage(appFolder string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, err := m.usageLocked(appFolder, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return u.bytes, nil
+}
+
+func (m *diskQuotaManager) usageLocked(appFolder string, now time.Time) (*dirUsage, error) {
+	u, ok := m.usage[appFolder]
+	if ok && now.Sub(u.countedAt) < quotaRecountInterval {
+		return u, nil
+	}
+	bytes, err := folderBytes(appFolder)
+	if err != nil {
+		return nil, err
+	}
+	u = &dirUsage{bytes: bytes, countedAt: now}
+	m.usage[appFolder] = u
+	return u, nil
+}
+
+// 登记即将写入的字节数。超出配额时按策略拒绝，或删除最旧的分段直到放得下；
+// 只剩正在写入的分段仍放不下时同样拒绝
+func (m *diskQuotaManager) Reserve(applicationID, appFolder string, n int64) error {
+	limit := m.Limit(applicationID)
+	if limit <= 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, err := m.usageLocked(appFolder, time.Now())
+	if errors.Is(err, os.ErrNotExist) {
+		u, err = &dirUsage{countedAt: time.Now()}, nil
+		m.usage[appFolder] = u
+	}
+	if err != nil {
+		return err
+	}
+	// 归档和法律保留的应用不删除分段，超出时只能拒绝
+	if u.bytes+n > limit && m.config.Policy == quotaDeleteOldest && !m.svc.lifecycle.Retained(applicationID) {
+		freed, err := m.svc.deleteOldestSegments(applicationID, appFolder, u.bytes+n-limit)
+		u.bytes -= freed
+		if err != nil {
+			return err
+		}
+	}
+	if u.bytes+n > limit {
+		diskQuotaRejected.Add(1, "application", applicationID)
+		m.svc.systemEvents.PublishThrottled("disk/"+applicationID, eventQuotaExceeded, applicationID, "Disk quota exceeded",
+			gin.H{"quota": "disk", "limit_bytes": limit, "used_bytes": u.bytes})
+		return errDiskQuotaExceeded
+	}
+	u.bytes += n
+	return nil
+}
+
+// 应用目录中日志文件的总大小，已分层的分段只计占位文件
+func folderBytes(appFolder string) (int64, error) {
+	files, err := os.ReadDir(appFolder)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, file := range files {
+		info, err := file.Info()
+		// 路由到存储类别的分段按链接指向的文件计算
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(filepath.Join(appFolder, file.Name()))
+		}
+		if err == nil && !info.IsDir() {
+			total += info.Size()
+		}
+	}
+	return total, nil
+}
+
+// 可以删除的一个分段及其本地文件（未压缩或已压缩的），已分层的分段不占本地空间，保留占位文件
+type prunableSegment struct {
+	Name  string
+	Day   string
+	Files []string
+	Bytes int64
+}
+
+// 按日期顺序列出可以删除的分段，最新一天的最后一个分段正在写入，不包含在内
+func prunableSegments(appFolder string) ([]prunableSegment, error) {
+	names, err := listSegments(appFolder)
+	if err != nil {
+		return nil, err
+	}
+	var segments []prunableSegment
+	for i, name := range names {
+		if i == len(names)-1 {
+			break
+		}
+		day, _, ok := parseSegmentName(name)
+		if !ok {
+			continue
+		}
+		seg := prunableSegment{Name: name, Day: day}
+		for _, file := range append([]string{name}, compressedPaths(name)...) {
+			if info, err := os.Stat(filepath.Join(appFolder, file)); err == nil {
+				seg.Files = append(seg.Files, file)
+				seg.Bytes += info.Size()
+			}
+		}
+		if len(seg.Files) > 0 {
+			segments = append(segments, seg)
+		}
+	}
+	return segments, nil
+}
+
+// 按日期顺序删除最旧的分段，至少腾出 need 字节，返回实际腾出的字节数
+func (s *Service) deleteOldestSegments(applicationID, appFolder string, need int64) (int64, error) {
+	segments, err := prunableSegments(appFolder)
+	if err != nil {
+		return 0, err
+	}
+	var freed int64
+	var deleted []string
+	for _, seg := range segments {
+		if freed >= need {
+			break
+		}
+		for _, file := range seg.Files {
+			path := filepath.Join(appFolder, file)
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if err := removeSegmentFile(path); err != nil {
+				return freed, err
+			}
+			freed += info.Size()
+		}
+		diskQuotaDeleted.Add(1, "application", applicationID)
+		log.Printf("deleted segment %s of %s to stay within the disk quota", seg.Name, applicationID)
+		deleted = append(deleted, seg.Name)
+	}
+	if len(deleted) > 0 {
+		s.systemEvents.Publish(eventRetention, applicationID, fmt.Sprintf("Deleted %d oldest segments to stay within the disk quota", len(deleted)),
+			gin.H{"segments": deleted, "freed_bytes": freed})
+	}
+	return freed, nil
+}
+
+// 应用的磁盘占用，用于应用列表接口
+type applicationUsage struct {
+	Bytes      int64 `json:"bytes"`
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+}
+
+// 列出应用的磁盘占用和配额
+func (s *Service) applicationUsages(apps []string) map[string]applicationUsage {
+	usages := make(map[string]applicationUsage, len(apps))
+	for _, app := range apps {
+		bytes, err := s.diskQuotas.Usage(s.applicationDir(app))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("disk usage of %s: %v", app, err)
+			continue
+		}
+		usages[app] = applicationUsage{Bytes: bytes, QuotaBytes: s.diskQuotas.Limit(app)}
+	}
+	return usages
+}
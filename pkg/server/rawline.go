@@ -0,0 +1,20 @@
+package server
+
+import (
+	"time"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 将一行原始文本解析为日志条目：优先使用应用登记的解析规则，其次按 parser.ParseLine 的内置布局解析
+func (s *Service) parseRawLine(applicationID, line string, now time.Time) LogData {
+	if entry, ok := s.parsers.Parse(applicationID, line, now); ok {
+		return entry
+	}
+	return parser.ParseLine(applicationID, line, now)
+}
+
+// 解析多行原始文本，合并异常堆栈等延续行
+func (s *Service) parseRawLines(applicationID, text string, now time.Time) []LogData {
+	return parser.ParseLinesWith(applicationID, text, now, s.parseRawLine)
+}
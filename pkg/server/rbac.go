@@ -0,0 +1,638 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 访问控制配置。启用后除文档、网页面板和健康检查外的接口都需要用户的 API Key，
+// 用户的角色决定能访问哪些接口和应用
+type AccessConfig struct {
+	Enabled bool                  `json:"enabled"`
+	Users   map[string]UserConfig `json:"users"` // 配置文件中的用户（如初始管理员），不能通过接口修改
+}
+
+// 配置文件中的用户
+type UserConfig struct {
+	APIKeys []string      `json:"api_keys"`
+	Roles   []RoleBinding `json:"roles"`
+}
+
+// 角色
+const (
+	roleAdmin  = "admin"  // 全部接口，包括用户、告警规则、迁移等管理接口
+	roleWriter = "writer" // 写入和查询
+	roleReader = "reader" // 只读查询
+)
+
+// 接口所需的权限
+const (
+	permRead  = "read"
+	permWrite = "write"
+	permAdmin = "admin"
+)
+
+// 用户在一组应用上的角色
+type RoleBinding struct {
+	Role string `json:"role"`
+	// 应用 ID 或通配模式（如 orders-*、acme/*，租户应用为 租户/应用），为空或 * 时为全部应用。管理员不区分应用
+	Applications []string `json:"applications,omitempty"`
+}
+
+// 用户
+type User struct {
+	Name    string        `json:"name"`
+	Roles   []RoleBinding `json:"roles"`
+	Builtin bool          `json:"builtin,omitempty"` // 来自配置文件
+	KeyHash string        `json:"key_hash,omitempty"`
+}
+
+var rbacDenied = metrics.counter("rbac_denied_total", "Requests rejected by access control, by reason.")
+
+// 角色是否包含权限
+func roleGrants(role, permission string) bool {
+	switch role {
+	case roleAdmin:
+		return true
+	case roleWriter:
+		return permission == permRead || permission == permWrite
+	case roleReader:
+		return permission == permRead
+	}
+	return false
+}
+
+func (b RoleBinding) allApplications() bool {
+	if b.Role == roleAdmin || len(b.Applications) == 0 {
+		return true
+	}
+	for _, pattern := range b.Applications {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (b RoleBinding) covers(applicationID string) bool {
+	if b.allApplications() {
+		return true
+	}
+	for _, pattern := range b.Applications {
+		if ok, _ := path.Match(pattern, applicationID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (b RoleBinding) validate() error {
+	if b.Role != roleAdmin && b.Role != roleWriter && b.Role != roleReader {
+		return fmt.Errorf("role must be %s, %s or %s", roleAdmin, roleWriter, roleReader)
+	}
+	if b.Role == roleAdmin && len(b.Applications) > 0 {
+		return errors.New("admin role applies to all applications")
+	}
+	for _, pattern := range b.Applications {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid application pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// 用户对应用是否有权限，applicationID 为存储使用的 ID
+func (u *User) Allowed(permission, applicationID string) bool {
+	for _, b := range u.Roles {
+		if roleGrants(b.Role, permission) && b.covers(applicationID) {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户是否对全部应用有权限
+func (u *User) AllowedEverywhere(permission string) bool {
+	for _, b := range u.Roles {
+		if roleGrants(b.Role, permission) && b.allApplications() {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户是否至少在一个应用上有权限
+func (u *User) AllowedSomewhere(permission string) bool {
+	for _, b := range u.Roles {
+		if roleGrants(b.Role, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// 用户注册表：配置文件中的用户和通过接口创建的用户，后者保存在 data_dir/users.json。
+// 只保存 API Key 的 SHA-256，原文只在创建和轮换时返回一次
+type userRegistry struct {
+	enabled bool
+	path    string
+
+	mu    sync.Mutex
+	users map[string]*User // 用户名 → 用户
+	keys  map[string]*User // API Key 的哈希 → 用户
+}
+
+func newUserRegistry(c AccessConfig, dataDir string) (*userRegistry, error) {
+	r := &userRegistry{
+		enabled: c.Enabled,
+		path:    filepath.Join(dataDir, "users.json"),
+		users:   make(map[string]*User),
+		keys:    make(map[string]*User),
+	}
+	var saved []*User
+	if err := loadJSONFile(r.path, &saved); err != nil {
+		return nil, err
+	}
+	for _, u := range saved {
+		r.users[u.Name] = u
+		r.keys[u.KeyHash] = u
+	}
+	for name, uc := range c.Users {
+		for _, b := range uc.Roles {
+			if err := b.validate(); err != nil {
+				return nil, fmt.Errorf("user %s: %w", name, err)
+			}
+		}
+		if len(uc.APIKeys) == 0 {
+			return nil, fmt.Errorf("user %s has no api_keys", name)
+		}
+		u := &User{Name: name, Roles: uc.Roles, Builtin: true}
+		r.users[name] = u
+		for _, key := range uc.APIKeys {
+			r.keys[hashAPIKey(key)] = u
+		}
+	}
+	if r.enabled && len(r.users) == 0 {
+		return nil, errors.New("access control is enabled but no users are configured")
+	}
+	return r, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// 生成新的 API Key
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 按 API Key 查找用户
+func (r *userRegistry) Authenticate(key string) *User {
+	if key == "" {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys[hashAPIKey(key)]
+}
+
+// 持久化接口创建的用户，调用方需持有锁
+func (r *userRegistry) saveLocked() error {
+	saved := make([]*User, 0, len(r.users))
+	for _, u := range r.users {
+		if !u.Builtin {
+			saved = append(saved, u)
+		}
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Name < saved[j].Name })
+	return saveJSONFile(r.path, saved)
+}
+
+var (
+	errUserExists  = errors.New("user already exists")
+	errUserBuiltin = errors.New("user is defined in the config file")
+)
+
+// 创建用户
+func (r *userRegistry) Create(name string, roles []RoleBinding, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[name]; ok {
+		return errUserExists
+	}
+	u := &User{Name: name, Roles: roles, KeyHash: hashAPIKey(key)}
+	r.users[name] = u
+	r.keys[u.KeyHash] = u
+	return r.saveLocked()
+}
+
+// 修改接口创建的用户，用户不存在时返回 false
+func (r *userRegistry) update(name string, fn func(u *User)) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[name]
+	if !ok {
+		return false, nil
+	}
+	if u.Builtin {
+		return true, errUserBuiltin
+	}
+	delete(r.keys, u.KeyHash)
+	fn(u)
+	if u.KeyHash != "" {
+		r.keys[u.KeyHash] = u
+	}
+	return true, r.saveLocked()
+}
+
+// 替换用户的角色
+func (r *userRegistry) SetRoles(name string, roles []RoleBinding) (bool, error) {
+	return r.update(name, func(u *User) { u.Roles = roles })
+}
+
+// 更换用户的 API Key，旧的立即失效
+func (r *userRegistry) SetKey(name, key string) (bool, error) {
+	return r.update(name, func(u *User) { u.KeyHash = hashAPIKey(key) })
+}
+
+// 删除用户
+func (r *userRegistry) Delete(name string) (bool, error) {
+	return r.update(name, func(u *User) {
+		delete(r.users, name)
+		u.KeyHash = ""
+	})
+}
+
+// 列出用户，不包含 API Key 的哈希
+func (r *userRegistry) List() []User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]User, 0, len(r.users))
+	for _, u := range r.users {
+		v := *u
+		v.KeyHash = ""
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// 接口的访问要求
+type routeAccess struct {
+	permission string
+	// 处理函数按请求中的应用逐一校验（见 authorizeApplication），否则要求对全部应用有权限
+	perApplication bool
+}
+
+// 各接口所需的权限，键为 "方法 路由模板"，租户接口去掉 /tenants/:tenant 前缀后查找。
+// 未列出的接口只允许管理员访问
+var routePermissions = map[string]routeAccess{
+	"POST /upload":          {permWrite, true},
+	"POST /upload/batch":    {permWrite, true},
+	"POST /upload/raw":      {permWrite, true},
+	"POST /upload/logstash": {permWrite, true},
+	"POST /import":          {permWrite, true},
+
+	"POST /upload/sessions":                  {permWrite, true},
+	"GET /upload/sessions/:id":               {permWrite, true},
+	"PUT /upload/sessions/:id/chunks/:index": {permWrite, true},
+	"POST /upload/sessions/:id/complete":     {permWrite, true},
+	"DELETE /upload/sessions/:id":            {permWrite, true},
+
+	"GET /query":        {permRead, true},
+	"GET /logs/:id":     {permRead, true},
+	"GET /tail":         {permRead, true},
+	"GET /tail/ws":      {permRead, true},
+	"GET /aggregate":    {permRead, true},
+	"GET /histogram":    {permRead, true},
+	"GET /applications": {permRead, true},
+	"GET /applications/:application_id/files":       {permRead, true},
+	"GET /applications/:application_id/files/:date": {permRead, true},
+	"GET /stats":                              {permRead, true},
+	"GET /tc/nodes":                           {permRead, true},
+	"GET /events/seata":                       {permRead, true},
+	"GET /transactions":                       {permRead, true},
+	"GET /transactions/:xid":                  {permRead, true},
+	"POST /transactions/logs":                 {permRead, true},
+	"GET /transactions/:xid/graph":            {permRead, true},
+	"GET /transactions/:xid/diagnosis":        {permRead, true},
+	"GET /saga/:key":                          {permRead, true},
+	"GET /traces/:trace_id/logs":              {permRead, true},
+	"GET /requests/:request_id/logs":          {permRead, true},
+	"GET /errors/top":                         {permRead, true},
+	"GET /analysis/findings":                  {permRead, true},
+	"GET /analysis/compare":                   {permRead, true},
+	"GET /analysis/codes":                     {permRead, true},
+	"GET /analysis/schema":                    {permRead, true},
+	"GET /analysis/lock-conflicts":            {permRead, true},
+	"GET /analysis/rollback-failures":         {permRead, true},
+	"GET /analysis/transaction-latency":       {permRead, true},
+	"GET /analysis/timeouts":                  {permRead, true},
+	"GET /analysis/consistency":               {permRead, true},
+	"GET /analysis/retry-storms":              {permRead, true},
+	"GET /auth/whoami":                        {permRead, true},
+	"GET /api/v1/console/globalSession/query": {permRead, true},
+	"GET /api/v1/console/globalLock/query":    {permRead, true},
+
+	// 以下接口的结果跨应用，只能由可以读取全部应用的用户访问
+	"GET /usage":               {permRead, false},
+	"GET /alerts/rules":        {permRead, false},
+	"POST /alerts/rules/test":  {permRead, false},
+	"GET /alerts/events":       {permRead, false},
+	"GET /events":              {permRead, false},
+	"GET /alerts/anomalies":    {permRead, false},
+	"GET /alerts/ingest-lag":   {permRead, false},
+	"GET /reports":             {permRead, false},
+	"GET /reports/history":     {permRead, false},
+	"GET /reports/history/:id": {permRead, false},
+	"GET /jobs":                {permRead, false},
+	"GET /plugins":             {permRead, false},
+	"GET /views":               {permRead, false},
+	"GET /groups":              {permRead, false},
+	"POST /views":              {permRead, false},
+	"DELETE /views/:name":      {permRead, false},
+	"GET /annotations":         {permRead, true},
+	"POST /annotations":        {permRead, true},
+	"DELETE /annotations/:id":  {permRead, true},
+	"GET /cluster/owner":       {permRead, false},
+	"GET /metrics":             {permRead, false},
+	"GET /probes":              {permRead, false},
+}
+
+// 不需要认证的接口
+var publicRoutes = map[string]bool{
+	"GET /":                   true,
+	"GET /ui/*filepath":       true,
+	"HEAD /ui/*filepath":      true,
+	"GET /docs":               true,
+	"GET /docs/openapi.json":  true,
+	"GET /cluster/health":     true,
+	"POST /api/v1/auth/login": true,
+}
+
+// 租户接口的路由前缀
+const tenantRoutePrefix = "/tenants/:tenant"
+
+// 访问控制中间件：按 API Key 识别用户并校验接口权限，应用级的权限由处理函数校验。
+// 租户接口上没有匹配的用户时交给 tenantAuth 按租户的 API Key 校验；
+// 其他节点转发的请求已在原节点校验过，不再重复校验
+func (s *Service) accessControl() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if !s.users.enabled || route == "" || c.GetBool("cluster.forwarded") {
+			c.Next()
+			return
+		}
+		tenantRoute := strings.HasPrefix(route, tenantRoutePrefix+"/")
+		key := c.Request.Method + " " + strings.TrimPrefix(route, tenantRoutePrefix)
+		if publicRoutes[key] && !tenantRoute {
+			c.Next()
+			return
+		}
+
+		user := s.users.Authenticate(requestAPIKey(c.Request.Header))
+		if user == nil {
+			if tenantRoute {
+				c.Next()
+				return
+			}
+			rbacDenied.Add(1, "reason", "unauthenticated")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		access, ok := routePermissions[key]
+		if !ok {
+			access = routeAccess{permission: permAdmin}
+		}
+		allowed := user.AllowedEverywhere(access.permission)
+		if access.perApplication {
+			allowed = user.AllowedSomewhere(access.permission)
+		}
+		if !allowed {
+			rbacDenied.Add(1, "reason", "role")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			return
+		}
+		c.Set("user", user)
+		c.Set("permission", access.permission)
+		c.Next()
+	}
+}
+
+// 当前请求的用户，未启用访问控制或通过租户 API Key 访问时为 nil
+func currentUser(c *gin.Context) *User {
+	if v, ok := c.Get("user"); ok {
+		return v.(*User)
+	}
+	return nil
+}
+
+// 用于审计记录的用户名
+func userName(u *User) string {
+	if u == nil {
+		return ""
+	}
+	return u.Name
+}
+
+// 校验当前用户对应用（存储使用的 ID）的权限，无权访问时返回 403
+func authorizeApplication(c *gin.Context, applicationID string) bool {
+	if applicationAllowed(c, applicationID) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied for application " + model.BareApplicationID(applicationID)})
+	return false
+}
+
+// 同 authorizeApplication，但不写出响应
+func applicationAllowed(c *gin.Context, applicationID string) bool {
+	user := currentUser(c)
+	if user == nil || user.Allowed(c.GetString("permission"), applicationID) {
+		return true
+	}
+	rbacDenied.Add(1, "reason", "application")
+	return false
+}
+
+// 过滤出当前用户有权访问的应用
+func permittedApplications(c *gin.Context, apps []string) []string {
+	user := currentUser(c)
+	if user == nil {
+		return apps
+	}
+	permission := c.GetString("permission")
+	filtered := make([]string, 0, len(apps))
+	for _, app := range apps {
+		if user.Allowed(permission, app) {
+			filtered = append(filtered, app)
+		}
+	}
+	return filtered
+}
+
+// 只能访问部分应用的用户不能使用跨应用的临时视图
+func rejectRestrictedView(c *gin.Context, view string) bool {
+	if user := currentUser(c); view != "" && user != nil && !user.AllowedEverywhere(permRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "view requires read access to all applications"})
+		return true
+	}
+	return false
+}
+
+// 当前用户及其角色
+func (s *Service) whoamiHandler(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": s.users.enabled})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "name": user.Name, "roles": user.Roles})
+}
+
+// 用户列表接口
+func (s *Service) userListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"users": s.users.List()})
+}
+
+// 创建用户的请求，api_key 为空时由服务端生成
+type createUserRequest struct {
+	Name   string        `json:"name" binding:"required"`
+	Roles  []RoleBinding `json:"roles"`
+	APIKey string        `json:"api_key"`
+}
+
+func validateRoles(c *gin.Context, roles []RoleBinding) bool {
+	for _, b := range roles {
+		if err := b.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// 创建用户接口，返回的 API Key 之后无法再次查看
+func (s *Service) userCreateHandler(c *gin.Context) {
+	var req createUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if !validApplicationID(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user name"})
+		return
+	}
+	if !validateRoles(c, req.Roles) {
+		return
+	}
+	if req.APIKey == "" {
+		key, err := newAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to generate API key"})
+			return
+		}
+		req.APIKey = key
+		clusterBroadcastBody(c, req)
+	}
+	err := s.users.Create(req.Name, req.Roles, req.APIKey)
+	if errors.Is(err, errUserExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save users"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"name": req.Name, "roles": req.Roles, "api_key": req.APIKey})
+}
+
+// 修改接口创建的用户失败时的响应
+func userUpdateFailed(c *gin.Context, found bool, err error) bool {
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return true
+	}
+	if errors.Is(err, errUserBuiltin) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is defined in the config file"})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save users"})
+		return true
+	}
+	return false
+}
+
+// 分配角色接口：替换用户的全部角色
+func (s *Service) userRolesHandler(c *gin.Context) {
+	var req struct {
+		Roles []RoleBinding `json:"roles"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	if !validateRoles(c, req.Roles) {
+		return
+	}
+	found, err := s.users.SetRoles(c.Param("name"), req.Roles)
+	if userUpdateFailed(c, found, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "roles": req.Roles})
+}
+
+// 更换 API Key 接口
+func (s *Service) userKeyHandler(c *gin.Context) {
+	var req struct {
+		APIKey string `json:"api_key"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+			return
+		}
+	}
+	if req.APIKey == "" {
+		key, err := newAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to generate API key"})
+			return
+		}
+		req.APIKey = key
+		clusterBroadcastBody(c, req)
+	}
+	found, err := s.users.SetKey(c.Param("name"), req.APIKey)
+	if userUpdateFailed(c, found, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "api_key": req.APIKey})
+}
+
+// 删除用户接口
+func (s *Service) userDeleteHandler(c *gin.Context) {
+	found, err := s.users.Delete(c.Param("name"))
+	if userUpdateFailed(c, found, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 故意只允许管理员访问的 GET 接口；/admin/ 和 /debug/ 下的接口都只允许管理员访问
+var adminOnlyGETRoutes = map[string]bool{
+	"GET /audit":           true,
+	"GET /dead-letters":    true,
+	"GET /cluster/members": true,
+}
+
+// 每个 GET 接口都须在 routePermissions 中登记权限（或为公开接口），否则只读用户会被当作管理员接口拒绝
+func TestGETRoutesHavePermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, err := newService(DefaultConfig()).newRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range router.Routes() {
+		if r.Method != http.MethodGet {
+			continue
+		}
+		key := r.Method + " " + strings.TrimPrefix(r.Path, tenantRoutePrefix)
+		if publicRoutes[key] || adminOnlyGETRoutes[key] || strings.HasPrefix(r.Path, "/admin/") || strings.HasPrefix(r.Path, "/debug/") {
+			continue
+		}
+		if _, ok := routePermissions[key]; !ok {
+			t.Errorf("%s is not listed in routePermissions", key)
+		}
+	}
+}
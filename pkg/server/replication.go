@@ -0,0 +1,680 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"logAnalysis/pkg/model"
+)
+
+// 主备复制：主实例把写入的日志先追加到按应用的预写日志（data_dir/replication），再由后台按批通过 gRPC 的 Replicate
+// 方法推送到备用实例，收到确认后才推进位置，备用实例不可用时日志留在预写日志中，恢复后继续推送。
+// 备用实例按原日志 ID 写入自己的存储，不共享存储也能作为故障切换的目标，切换后分配的 ID 接着主实例的继续
+type ReplicationConfig struct {
+	Standby      string           `json:"standby"`           // 备用实例的 gRPC 地址 host:port，为空时不复制
+	TLS          *ClientTLSConfig `json:"tls,omitempty"`     // 备用实例的 gRPC 接口启用了 TLS 时的证书配置，为空时使用明文 HTTP/2
+	APIKey       string           `json:"api_key,omitempty"` // 备用实例启用访问控制时使用的 API Key，需要 admin 角色
+	Applications []string         `json:"applications"`      // 复制的应用（支持通配符，租户应用为 租户/应用），为空时为全部应用
+	BatchSize    int              `json:"batch_size"`        // 每次推送的最多条数，默认 500
+	Interval     Duration         `json:"interval"`          // 没有新日志或推送失败后的重试间隔，默认 1s
+	MaxPendingMB int              `json:"max_pending_mb"`    // 每个应用未确认的预写日志上限，超过后新日志不再复制，默认 1024
+	Accept       bool             `json:"accept"`            // 作为备用实例接受其他实例复制的日志
+}
+
+var (
+	replicationShipped  = metrics.counter("replication_shipped_total", "Entries acknowledged by the standby, by application.")
+	replicationFailures = metrics.counter("replication_failures_total", "Failed pushes to the standby.")
+	replicationDropped  = metrics.counter("replication_dropped_total", "Entries not replicated because the write-ahead log was full or could not be written, by application.")
+	replicationPending  = metrics.gauge("replication_pending_bytes", "Write-ahead log bytes not yet acknowledged by the standby, by application.")
+	replicationApplied  = metrics.counter("replication_applied_total", "Entries written on this standby from the primary, by application.")
+)
+
+// 预写日志中的一条记录
+type replicationRecord struct {
+	File  string  `json:"file"`
+	Entry LogData `json:"entry"`
+}
+
+// 一个应用的预写日志，offset 之前的部分已被备用实例确认
+type replicationWAL struct {
+	applicationID string
+
+	mu          sync.Mutex
+	file        *os.File
+	size        int64
+	offset      int64
+	shipped     int64
+	dropped     int64
+	lastID      int64
+	lastShipped time.Time
+	lastError   string
+}
+
+// 一个应用的复制状态
+type replicationAppStatus struct {
+	ApplicationID string    `json:"application_id"`
+	PendingBytes  int64     `json:"pending_bytes"` // 未确认的预写日志字节数
+	Shipped       int64     `json:"shipped"`       // 启动以来已确认的条数
+	Dropped       int64     `json:"dropped"`       // 预写日志已满等原因未复制的条数
+	LastID        int64     `json:"last_id"`       // 最近确认的日志 ID
+	LastShipped   time.Time `json:"last_shipped"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// 主实例上的复制：维护预写日志并推送到备用实例
+type replicator struct {
+	config ReplicationConfig
+	dir    string
+	target string
+	client *http.Client
+
+	mu      sync.Mutex
+	wals    map[string]*replicationWAL
+	offsets map[string]int64 // 已确认的位置，持久化到 offsets.json
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// 按配置创建复制，未配置 standby 时返回 nil
+func newReplicator(c ReplicationConfig, dataDir string) (*replicator, error) {
+	if c.Standby == "" {
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(c.Standby); err != nil {
+		return nil, fmt.Errorf("standby must be host:port: %v", err)
+	}
+	if c.BatchSize < 0 || c.Interval < 0 || c.MaxPendingMB < 0 {
+		return nil, fmt.Errorf("batch_size, interval and max_pending_mb must not be negative")
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 500
+	}
+	if c.Interval == 0 {
+		c.Interval = Duration(time.Second)
+	}
+	if c.MaxPendingMB == 0 {
+		c.MaxPendingMB = 1024
+	}
+	for _, pattern := range c.Applications {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid application pattern %q", pattern)
+		}
+	}
+
+	// 直接在 HTTP/2 上发起 gRPC 调用，明文时不经过 TLS 协商
+	transport := &http2.Transport{}
+	scheme := "https"
+	if c.TLS != nil {
+		config, err := buildClientTLSConfig(*c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = config
+	} else {
+		scheme = "http"
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
+	r := &replicator{
+		config:  c,
+		dir:     filepath.Join(dataDir, "replication"),
+		target:  scheme + "://" + c.Standby + grpcServicePath + "Replicate",
+		client:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		wals:    make(map[string]*replicationWAL),
+		offsets: make(map[string]int64),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := loadJSONFile(filepath.Join(r.dir, "offsets.json"), &r.offsets); err != nil {
+		return nil, err
+	}
+	// 打开上次未推送完的预写日志
+	names, err := filepath.Glob(filepath.Join(r.dir, "*.wal"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		app, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(name), ".wal"))
+		if err != nil {
+			continue
+		}
+		if _, err := r.wal(app); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *replicator) matches(applicationID string) bool {
+	if len(r.config.Applications) == 0 {
+		return true
+	}
+	for _, pattern := range r.config.Applications {
+		if ok, _ := path.Match(pattern, applicationID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 应用的预写日志，不存在时创建
+func (r *replicator) wal(applicationID string) (*replicationWAL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if w, ok := r.wals[applicationID]; ok {
+		return w, nil
+	}
+	f, err := os.OpenFile(filepath.Join(r.dir, url.PathEscape(applicationID)+".wal"), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &replicationWAL{applicationID: applicationID, file: f, size: info.Size(), offset: r.offsets[applicationID]}
+	// 位置超过文件末尾说明截断前停机，文件中的内容都未确认
+	if w.offset > w.size {
+		w.offset = 0
+	}
+	r.wals[applicationID] = w
+	replicationPending.Set(float64(w.size-w.offset), "application_id", applicationID)
+	return w, nil
+}
+
+// 记录一条已写入的日志，在应用的写入锁内调用，预写日志中的顺序即日志 ID 的顺序。
+// 预写日志写入失败不影响本地写入，只记录为未复制
+func (r *replicator) Append(applicationID, fileName string, entry LogData) {
+	if r == nil || !r.matches(applicationID) {
+		return
+	}
+	drop := func(err error) {
+		replicationDropped.Add(1, "application_id", applicationID)
+		log.Printf("replication: entry %d of %s not replicated: %v", entry.ID, applicationID, err)
+	}
+	w, err := r.wal(applicationID)
+	if err != nil {
+		drop(err)
+		return
+	}
+	line, err := json.Marshal(replicationRecord{File: fileName, Entry: entry})
+	if err != nil {
+		drop(err)
+		return
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	if w.size-w.offset+int64(len(line)) > int64(r.config.MaxPendingMB)<<20 {
+		w.dropped++
+		w.mu.Unlock()
+		replicationDropped.Add(1, "application_id", applicationID)
+		return
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	pending := w.size - w.offset
+	if err != nil {
+		w.dropped++
+	}
+	w.mu.Unlock()
+	if err != nil {
+		drop(err)
+		return
+	}
+	replicationPending.Set(float64(pending), "application_id", applicationID)
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 启动后台推送
+func (r *replicator) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(time.Duration(r.config.Interval))
+		defer ticker.Stop()
+		var retryAt time.Time
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-r.wake:
+				// 推送失败后等到下一个间隔再重试，不因每条新日志重试
+				if time.Now().Before(retryAt) {
+					continue
+				}
+			case <-ticker.C:
+			}
+			if !r.shipAll() {
+				retryAt = time.Now().Add(time.Duration(r.config.Interval))
+			}
+		}
+	}()
+	log.Printf("Replicating to standby %s", r.config.Standby)
+}
+
+// 停止推送并关闭预写日志，未确认的部分在下次启动时继续推送
+func (r *replicator) Close() error {
+	close(r.stop)
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range r.wals {
+		w.mu.Lock()
+		w.file.Close()
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// 推送全部应用未确认的日志，备用实例不可用时返回 false，等下一次重试
+func (r *replicator) shipAll() bool {
+	r.mu.Lock()
+	wals := make([]*replicationWAL, 0, len(r.wals))
+	for _, app := range sortedKeys(r.wals) {
+		wals = append(wals, r.wals[app])
+	}
+	r.mu.Unlock()
+
+	for _, w := range wals {
+		for {
+			select {
+			case <-r.stop:
+				return true
+			default:
+			}
+			shipped, err := r.shipBatch(w)
+			if err != nil {
+				replicationFailures.Add(1)
+				w.mu.Lock()
+				// 同一个错误只在第一次出现时记录日志
+				changed := w.lastError != err.Error()
+				w.lastError = err.Error()
+				w.mu.Unlock()
+				if changed {
+					log.Printf("replication: push of %s to %s failed: %v", w.applicationID, r.config.Standby, err)
+				}
+				return false
+			}
+			if shipped == 0 {
+				break
+			}
+		}
+	}
+	return true
+}
+
+// 推送一批日志并推进位置，返回推送的条数
+func (r *replicator) shipBatch(w *replicationWAL) (int, error) {
+	w.mu.Lock()
+	start, end := w.offset, w.size
+	w.mu.Unlock()
+	if start >= end {
+		return 0, nil
+	}
+
+	// 只读取已完整写入的记录，一次最多读取 batch_size 条
+	buf := make([]byte, min(end-start, int64(maxGRPCMessageBytes)))
+	n, err := w.file.ReadAt(buf, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	buf = buf[:n]
+	var body []byte
+	var consumed int64
+	var lastID int64
+	count := 0
+	for count < r.config.BatchSize {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := buf[:i]
+		buf = buf[i+1:]
+		consumed += int64(i + 1)
+		var rec replicationRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			// 停机时写了一半的记录，跳过
+			continue
+		}
+		body = appendGRPCFrame(body, encodeReplicatedEntry(rec))
+		lastID = rec.Entry.ID
+		count++
+	}
+	if consumed == 0 {
+		return 0, fmt.Errorf("write-ahead record at offset %d exceeds %d bytes", start, maxGRPCMessageBytes)
+	}
+	if count > 0 {
+		if err := r.push(body); err != nil {
+			return 0, err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.offset += consumed
+	w.shipped += int64(count)
+	if count > 0 {
+		w.lastID = lastID
+	}
+	w.lastShipped, w.lastError = time.Now(), ""
+	// 全部确认后清空预写日志，先保存位置再截断，截断前停机时重新推送的日志由备用实例按 ID 跳过
+	drained := w.offset == w.size
+	saved := w.offset
+	if drained {
+		saved = 0
+	}
+	if err := r.saveOffset(w.applicationID, saved); err != nil {
+		return count, err
+	}
+	if drained {
+		if err := w.file.Truncate(0); err != nil {
+			return count, err
+		}
+		w.offset, w.size = 0, 0
+	}
+	replicationShipped.Add(float64(count), "application_id", w.applicationID)
+	replicationPending.Set(float64(w.size-w.offset), "application_id", w.applicationID)
+	return max(count, 1), nil
+}
+
+func (r *replicator) saveOffset(applicationID string, offset int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.offsets[applicationID] = offset
+	return saveJSONFile(filepath.Join(r.dir, "offsets.json"), r.offsets)
+}
+
+// 调用备用实例的 Replicate，请求体为一组 ReplicatedEntry 消息
+func (r *replicator) push(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, r.target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if r.config.APIKey != "" {
+		req.Header.Set("X-API-Key", r.config.APIKey)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("standby returned HTTP %d", resp.StatusCode)
+	}
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != strconv.Itoa(grpcOK) {
+		message, _ := url.PathUnescape(resp.Trailer.Get("Grpc-Message"))
+		return fmt.Errorf("standby returned status %s: %s", status, message)
+	}
+	return nil
+}
+
+// 各应用的复制状态
+func (r *replicator) Statuses() []replicationAppStatus {
+	r.mu.Lock()
+	wals := make([]*replicationWAL, 0, len(r.wals))
+	for _, app := range sortedKeys(r.wals) {
+		wals = append(wals, r.wals[app])
+	}
+	r.mu.Unlock()
+	list := make([]replicationAppStatus, 0, len(wals))
+	for _, w := range wals {
+		w.mu.Lock()
+		list = append(list, replicationAppStatus{
+			ApplicationID: w.applicationID,
+			PendingBytes:  w.size - w.offset,
+			Shipped:       w.shipped,
+			Dropped:       w.dropped,
+			LastID:        w.lastID,
+			LastShipped:   w.lastShipped,
+			LastError:     w.lastError,
+		})
+		w.mu.Unlock()
+	}
+	return list
+}
+
+func appendGRPCFrame(b, msg []byte) []byte {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	return append(append(b, header[:]...), msg...)
+}
+
+// ReplicatedEntry{file = 1, entry = 2}，entry 中带有日志 ID
+func encodeReplicatedEntry(rec replicationRecord) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, rec.File)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, encodeLogEntry(rec.Entry))
+}
+
+func decodeReplicatedEntry(data []byte) (replicationRecord, error) {
+	var rec replicationRecord
+	err := walkProtoFields(data, func(num protowire.Number, typ protowire.Type, b []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			rec.File = string(b)
+		case 2:
+			entry, err := decodeLogEntry(b)
+			if err != nil {
+				return err
+			}
+			// 上传时忽略的日志 ID 在复制时保留
+			err = walkProtoFields(b, func(num protowire.Number, typ protowire.Type, _ []byte, number uint64) error {
+				if num == 12 && typ == protowire.VarintType {
+					entry.ID = int64(number)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			rec.Entry = entry
+		}
+		return nil
+	})
+	return rec, err
+}
+
+// 备用实例上的复制：按原日志 ID 写入，已写入的 ID 跳过，使主实例重试推送时不会重复写入
+type replicaReceiver struct {
+	svc  *Service
+	path string
+
+	mu      sync.Mutex
+	applied map[string]int64 // 应用 → 已写入的最大日志 ID
+}
+
+// 按配置创建接收端，未开启 accept 时返回 nil
+func (s *Service) newReplicaReceiver(c ReplicationConfig, dataDir string) (*replicaReceiver, error) {
+	if !c.Accept {
+		return nil, nil
+	}
+	dir := filepath.Join(dataDir, "replication")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &replicaReceiver{svc: s, path: filepath.Join(dir, "applied.json"), applied: make(map[string]int64)}
+	if err := loadJSONFile(r.path, &r.applied); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 写入一批复制的日志，返回写入和跳过的条数。日志已经过主实例的写入前处理，直接写入存储，
+// 不再执行流水线、告警规则和输出转发
+func (r *replicaReceiver) Apply(records []replicationRecord) (applied, skipped int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	touched := make(map[string]int64)
+	defer func() {
+		// 切换到备用实例后分配的 ID 从复制的最大 ID 之后开始
+		for _, app := range sortedKeys(touched) {
+			if ensureErr := r.svc.logIDs.Ensure(app, touched[app]); ensureErr != nil && err == nil {
+				err = ensureErr
+			}
+		}
+		if len(touched) > 0 {
+			if saveErr := saveJSONFile(r.path, r.applied); saveErr != nil && err == nil {
+				err = saveErr
+			}
+		}
+	}()
+
+	for _, rec := range records {
+		app := rec.Entry.ApplicationID
+		last, ok := r.applied[app]
+		if !ok {
+			// 没有复制记录的应用以存储中已有的日志为准，如从备份恢复的备用实例
+			last = r.svc.lastStoredLogID(app)
+			r.applied[app] = last
+		}
+		if rec.Entry.ID <= last {
+			skipped++
+			continue
+		}
+		if err := r.write(rec); err != nil {
+			return applied, skipped, err
+		}
+		r.applied[app] = rec.Entry.ID
+		touched[app] = rec.Entry.ID
+		applied++
+		replicationApplied.Add(1, "application_id", app)
+	}
+	return applied, skipped, nil
+}
+
+func (r *replicaReceiver) write(rec replicationRecord) error {
+	entry := rec.Entry
+	r.svc.backends.writes.RLock()
+	defer r.svc.backends.writes.RUnlock()
+	gate := r.svc.backends.WriteGate(entry.ApplicationID)
+	gate.RLock()
+	defer gate.RUnlock()
+	store, _, _ := r.svc.backends.Store(r.svc.backends.BackendOf(entry.ApplicationID))
+	// 写入序号只在实例内有序，按本实例的顺序重新分配
+	entry.Seq = r.svc.ingestSeq.Next()
+	return store.AppendEntry(entry.ApplicationID, rec.File, entry)
+}
+
+// 各应用已写入的最大日志 ID
+func (r *replicaReceiver) Applied() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	applied := make(map[string]int64, len(r.applied))
+	for app, id := range r.applied {
+		applied[app] = id
+	}
+	return applied
+}
+
+// Replicate：接收主实例推送的一批 ReplicatedEntry，全部写入后返回 ReplicateResponse
+func (c *grpcCall) replicate() error {
+	if c.svc.replica == nil {
+		return grpcErrorf(grpcFailedPrecondition, "This instance does not accept replication")
+	}
+	var records []replicationRecord
+	for i := 0; ; i++ {
+		data, err := c.recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rec, err := decodeReplicatedEntry(data)
+		if err != nil {
+			return grpcErrorf(grpcInvalidArgument, "Entry %d is not a valid ReplicatedEntry", i)
+		}
+		if _, _, ok := parseSegmentName(rec.File); !ok || rec.Entry.ID <= 0 || !validStoreApplicationID(rec.Entry.ApplicationID) {
+			return grpcErrorf(grpcInvalidArgument, "Entry %d has an invalid file, id or application_id", i)
+		}
+		records = append(records, rec)
+	}
+
+	applied, skipped, err := c.svc.replica.Apply(records)
+	c.count = applied
+	if err != nil {
+		c.trailer["X-Applied"] = strconv.Itoa(applied)
+		return grpcErrorf(grpcInternal, "Unable to write replicated entries: %v", err)
+	}
+	var b []byte
+	for i, v := range []int{applied, skipped} {
+		if v != 0 {
+			b = protowire.AppendTag(b, protowire.Number(i+1), protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		}
+	}
+	return c.send(b)
+}
+
+// 存储使用的应用 ID：应用 ID 或 租户/应用
+func validStoreApplicationID(applicationID string) bool {
+	tenant, app := model.SplitApplicationID(applicationID)
+	if tenant != "" && !validApplicationID(tenant) {
+		return false
+	}
+	return validApplicationID(app)
+}
+
+// 复制状态接口：主实例上为各应用的推送进度，备用实例上为各应用已写入的最大日志 ID
+func (s *Service) replicationHandler(c *gin.Context) {
+	status := gin.H{"standby": "", "accepting": s.replica != nil, "shipping": []replicationAppStatus{}, "applied": map[string]int64{}}
+	if s.replication != nil {
+		status["standby"] = s.replication.config.Standby
+		status["shipping"] = s.replication.Statuses()
+	}
+	if s.replica != nil {
+		status["applied"] = s.replica.Applied()
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,540 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/i18n"
+)
+
+// 周期报告配置
+type ReportConfig struct {
+	Name           string      `json:"name"`
+	Period         string      `json:"period"`          // daily 或 weekly，报告覆盖触发当天零点之前的一天或七天
+	Schedule       string      `json:"schedule"`        // cron 表达式，默认 daily 为 "0 1 * * *"，weekly 为 "0 1 * * 1"
+	TZ             string      `json:"tz"`              // 计算周期和匹配 schedule 的时区，默认本地时区
+	ApplicationIDs []string    `json:"application_ids"` // 为空表示所有应用
+	TopErrors      int         `json:"top_errors"`      // 每个应用列出的高频错误模式数量，默认 10
+	Keep           int         `json:"keep"`            // 保留的历史报告数量，默认 90
+	Webhook        string      `json:"webhook"`         // 以 JSON 推送报告
+	Email          ReportEmail `json:"email"`           // 以纯文本邮件发送报告
+	Language       string      `json:"language"`        // 邮件的语言：en 或 zh-CN，默认为 localization.language
+}
+
+// 报告邮件的 SMTP 配置
+type ReportEmail struct {
+	SMTPAddr string   `json:"smtp_addr"` // 如 smtp.example.com:587
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// 单个应用在报告周期内的汇总
+type applicationReport struct {
+	ApplicationID string         `json:"application_id"`
+	Total         int            `json:"total"`
+	Levels        map[string]int `json:"levels"`
+	Errors        int            `json:"errors"` // ERROR 和 FATAL 的条数
+	TopErrors     []errorPattern `json:"top_errors"`
+	Transactions  map[string]int `json:"transactions"`            // 按推断状态统计的全局事务数
+	RollbackRate  *float64       `json:"rollback_rate,omitempty"` // 回滚和超时占已结束事务的比例
+}
+
+// 一次报告投递的结果
+type reportDelivery struct {
+	Channel string `json:"channel"` // webhook 或 email
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// 生成的报告
+type Report struct {
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	Period       string              `json:"period"`
+	From         time.Time           `json:"from"`
+	To           time.Time           `json:"to"`
+	GeneratedAt  time.Time           `json:"generated_at"`
+	Applications []applicationReport `json:"applications"`
+	Deliveries   []reportDelivery    `json:"deliveries,omitempty"`
+}
+
+// 报告列表中的摘要
+type reportSummary struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Period      string    `json:"period"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+var (
+	reportsGenerated    = metrics.counter("reports_generated_total", "Scheduled or manually triggered reports generated.")
+	reportDeliveryFails = metrics.counter("report_delivery_failures_total", "Report deliveries that failed.")
+)
+
+// 报告错误数统计的级别
+var reportErrorLevels = []string{"ERROR", "FATAL"}
+
+// 报告配置及编译后的调度
+type reportJob struct {
+	config   ReportConfig
+	schedule *cronSchedule
+	loc      *time.Location
+}
+
+// 报告调度器：每分钟检查一次 schedule，生成的报告保存在 data_dir/reports
+type reportScheduler struct {
+	svc  *Service
+	dir  string
+	jobs map[string]*reportJob
+
+	mu sync.Mutex // 串行生成报告，并保护历史文件
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (s *Service) newReportScheduler(dataDir string, configs []ReportConfig) (*reportScheduler, error) {
+	sched := &reportScheduler{
+		svc:  s,
+		dir:  filepath.Join(dataDir, "reports"),
+		jobs: make(map[string]*reportJob),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := os.MkdirAll(sched.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if !validApplicationID(c.Name) {
+			return nil, fmt.Errorf("invalid report name %q", c.Name)
+		}
+		if _, ok := sched.jobs[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate report %q", c.Name)
+		}
+		if c.Period == "" {
+			c.Period = "daily"
+		}
+		if c.Schedule == "" {
+			switch c.Period {
+			case "daily":
+				c.Schedule = "0 1 * * *"
+			case "weekly":
+				c.Schedule = "0 1 * * 1"
+			}
+		}
+		if c.Period != "daily" && c.Period != "weekly" {
+			return nil, fmt.Errorf("report %s: period must be daily or weekly", c.Name)
+		}
+		if len(c.Email.To) > 0 && (c.Email.SMTPAddr == "" || c.Email.From == "") {
+			return nil, fmt.Errorf("report %s: email requires smtp_addr and from", c.Name)
+		}
+		if c.TopErrors <= 0 {
+			c.TopErrors = 10
+		}
+		if c.Keep <= 0 {
+			c.Keep = 90
+		}
+		lang, err := configuredLanguage(c.Language)
+		if err != nil {
+			return nil, fmt.Errorf("report %s: %w", c.Name, err)
+		}
+		c.Language = lang
+		schedule, err := parseCron(c.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("report %s: %w", c.Name, err)
+		}
+		loc := time.Local
+		if c.TZ != "" {
+			if loc, err = time.LoadLocation(c.TZ); err != nil {
+				return nil, fmt.Errorf("report %s: %w", c.Name, err)
+			}
+		}
+		sched.jobs[c.Name] = &reportJob{config: c, schedule: schedule, loc: loc}
+	}
+	return sched, nil
+}
+
+// 启动调度，每到整分钟检查一次
+func (s *reportScheduler) Start() {
+	go func() {
+		defer close(s.done)
+		for {
+			now := time.Now()
+			timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case at := <-timer.C:
+				at = at.Truncate(time.Minute)
+				for _, name := range sortedKeys(s.jobs) {
+					job := s.jobs[name]
+					if !job.schedule.Matches(at.In(job.loc)) {
+						continue
+					}
+					if _, err := s.Run(name, at); err != nil {
+						log.Printf("report %s failed: %v", name, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// 停机时等待正在生成的报告完成
+func (s *reportScheduler) Close() error {
+	close(s.stop)
+	<-s.done
+	return nil
+}
+
+// 报告覆盖的时间范围：触发当天零点之前的一天或七天
+func reportRange(period string, at time.Time, loc *time.Location) (time.Time, time.Time) {
+	local := at.In(loc)
+	to := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	if period == "weekly" {
+		return to.AddDate(0, 0, -7), to
+	}
+	return to.AddDate(0, 0, -1), to
+}
+
+// 生成、保存并投递一份报告
+func (s *reportScheduler) Run(name string, at time.Time) (*Report, error) {
+	job, ok := s.jobs[name]
+	if !ok {
+		return nil, errReportNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := job.config
+	from, to := reportRange(c.Period, at, job.loc)
+	apps := c.ApplicationIDs
+	if len(apps) == 0 {
+		var err error
+		if apps, err = s.svc.listApplications(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	report := &Report{
+		ID:           c.Name + "-" + now.Format("20060102T150405"),
+		Name:         c.Name,
+		Period:       c.Period,
+		From:         from,
+		To:           to,
+		GeneratedAt:  now,
+		Applications: make([]applicationReport, 0, len(apps)),
+	}
+	for _, app := range apps {
+		r, err := s.svc.buildApplicationReport(app, from, to, c.TopErrors)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", app, err)
+		}
+		report.Applications = append(report.Applications, r)
+	}
+	reportsGenerated.Add(1)
+
+	if c.Webhook != "" {
+		report.Deliveries = append(report.Deliveries, deliveryResult("webhook", postReportWebhook(c.Webhook, report)))
+	}
+	if len(c.Email.To) > 0 {
+		report.Deliveries = append(report.Deliveries, deliveryResult("email", s.svc.sendReportEmail(c.Email, report, c.Language)))
+	}
+
+	if err := saveJSONFile(filepath.Join(s.dir, report.ID+".json"), report); err != nil {
+		return nil, err
+	}
+	s.pruneLocked(c.Name, c.Keep)
+	return report, nil
+}
+
+func deliveryResult(channel string, err error) reportDelivery {
+	if err != nil {
+		reportDeliveryFails.Add(1, "channel", channel)
+		log.Printf("report %s delivery failed: %v", channel, err)
+		return reportDelivery{Channel: channel, Error: err.Error()}
+	}
+	return reportDelivery{Channel: channel, OK: true}
+}
+
+// 汇总一个应用在时间范围内的日志级别、高频错误和事务结果
+func (s *Service) buildApplicationReport(app string, from, to time.Time, topN int) (applicationReport, error) {
+	r := applicationReport{ApplicationID: app, Levels: make(map[string]int), Transactions: make(map[string]int)}
+
+	counter := &levelCounter{levels: r.Levels}
+	tracker := analysis.NewTransactionTracker()
+	// 报告的截止时间为开区间
+	if err := s.runAnalyzers(context.Background(), []string{app}, from, to.Add(-time.Nanosecond), []analysis.Analyzer{counter, tracker}); err != nil {
+		return r, err
+	}
+	r.Total = counter.total
+	for _, level := range reportErrorLevels {
+		r.Errors += r.Levels[level]
+	}
+
+	top, err := s.topErrors(context.Background(), app, reportErrorLevels, from, to.Add(-time.Nanosecond), topN, 1)
+	if err != nil {
+		return r, err
+	}
+	r.TopErrors = top.Top
+
+	for _, tx := range tracker.Summaries(to, time.Duration(s.cfg.TransactionHangWindow)) {
+		r.Transactions[tx.Status]++
+	}
+	rolledBack := r.Transactions[analysis.StatusRolledBack] + r.Transactions[analysis.StatusTimedOut]
+	if finished := rolledBack + r.Transactions[analysis.StatusCommitted]; finished > 0 {
+		rate := float64(rolledBack) / float64(finished)
+		r.RollbackRate = &rate
+	}
+	return r, nil
+}
+
+// 按级别计数的分析器
+type levelCounter struct {
+	levels map[string]int
+	total  int
+}
+
+func (l *levelCounter) Observe(entry LogData, ref logRef, at time.Time) {
+	l.levels[strings.ToUpper(entry.LogLevel)]++
+	l.total++
+}
+
+func (l *levelCounter) Findings() []Finding { return nil }
+
+// 报告的纯文本形式，用于邮件和下载
+func (r *Report) Text(lang string) string {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString(i18n.Textf(format, args...).In(lang))
+		b.WriteString("\n")
+	}
+	line("Report %q (%s)", r.Name, i18n.Textf(r.Period))
+	line("Period: %s - %s", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	line("Generated: %s", r.GeneratedAt.Format(time.RFC3339))
+	for _, app := range r.Applications {
+		fmt.Fprintf(&b, "\n== %s ==\n", app.ApplicationID)
+		line("Logs: %d, errors: %d", app.Total, app.Errors)
+		for _, level := range sortedKeys(app.Levels) {
+			fmt.Fprintf(&b, "  %s: %d\n", level, app.Levels[level])
+		}
+		if len(app.Transactions) > 0 {
+			b.WriteString(i18n.Tr(lang, "Transactions:"))
+			for _, status := range sortedKeys(app.Transactions) {
+				fmt.Fprintf(&b, " %s=%d", status, app.Transactions[status])
+			}
+			b.WriteString("\n")
+		}
+		if app.RollbackRate != nil {
+			line("Rollback rate: %.1f%%", *app.RollbackRate*100)
+		}
+		if len(app.TopErrors) > 0 {
+			line("Top errors:")
+			for _, p := range app.TopErrors {
+				fmt.Fprintf(&b, "  %6d  %s\n", p.Count, p.Template)
+			}
+		}
+	}
+	return b.String()
+}
+
+// 将报告推送到 webhook
+func postReportWebhook(url string, report *Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 通过 SMTP 发送纯文本报告，lang 为空时使用默认语言
+func (s *Service) sendReportEmail(e ReportEmail, report *Report, lang string) error {
+	if lang == "" {
+		lang = s.defaultLanguage()
+	}
+	subject := i18n.Textf("[seata-log-analysis] %s report %s (%s)", i18n.Textf(report.Period), report.Name, report.From.Format("2006-01-02"))
+	return sendEmail(e, subject.In(lang), report.Text(lang))
+}
+
+// 通过 SMTP 发送纯文本邮件，报告和告警共用
+func sendEmail(e ReportEmail, subject, body string) error {
+	if e.SMTPAddr == "" || e.From == "" {
+		return fmt.Errorf("email requires smtp_addr and from")
+	}
+	var auth smtp.Auth
+	if e.Username != "" {
+		host := e.SMTPAddr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	// 非 ASCII 的主题（如中文）按 RFC 2047 编码
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(e.SMTPAddr, auth, e.From, e.To, []byte(msg.String()))
+}
+
+var errReportNotFound = errors.New("report not found")
+
+// 历史报告，最新的在前，name 为空时返回全部
+func (s *reportScheduler) History(name string) ([]reportSummary, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []reportSummary
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), ".json")
+		if e.IsDir() || id == e.Name() || (name != "" && !strings.HasPrefix(id, name+"-")) {
+			continue
+		}
+		report, err := s.Load(id)
+		if err != nil || (name != "" && report.Name != name) {
+			continue
+		}
+		result = append(result, reportSummary{ID: report.ID, Name: report.Name, Period: report.Period,
+			From: report.From, To: report.To, GeneratedAt: report.GeneratedAt})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GeneratedAt.After(result[j].GeneratedAt) })
+	return result, nil
+}
+
+// 读取一份历史报告
+func (s *reportScheduler) Load(id string) (*Report, error) {
+	if !validApplicationID(id) {
+		return nil, errReportNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// 只保留最近 keep 份同名报告，调用方需持有锁
+func (s *reportScheduler) pruneLocked(name string, keep int) {
+	history, err := s.History(name)
+	if err != nil {
+		return
+	}
+	for _, old := range history[min(keep, len(history)):] {
+		os.Remove(filepath.Join(s.dir, old.ID+".json"))
+	}
+}
+
+// 报告配置列表接口
+func (s *Service) reportConfigListHandler(c *gin.Context) {
+	configs := make([]ReportConfig, 0, len(s.reports.jobs))
+	for _, name := range sortedKeys(s.reports.jobs) {
+		rc := s.reports.jobs[name].config
+		rc.Email.Password = "" // 不返回 SMTP 密码
+		configs = append(configs, rc)
+	}
+	c.JSON(http.StatusOK, gin.H{"reports": configs})
+}
+
+// 历史报告列表接口，可按 name 过滤
+func (s *Service) reportHistoryHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	history, err := s.reports.History(c.Query("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list reports"})
+		return
+	}
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	if history == nil {
+		history = []reportSummary{}
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// 读取报告接口，format=text 返回纯文本，download=true 时作为附件下载
+func (s *Service) reportGetHandler(c *gin.Context) {
+	report, err := s.reports.Load(c.Param("id"))
+	if errors.Is(err, errReportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read report"})
+		return
+	}
+
+	text := c.Query("format") == "text"
+	if c.Query("download") == "true" {
+		ext := ".json"
+		if text {
+			ext = ".txt"
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+report.ID+ext+`"`)
+	}
+	if text {
+		c.String(http.StatusOK, report.Text(s.requestLanguage(c)))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// 立即生成一份报告，覆盖的时间范围与当前时刻触发时相同
+func (s *Service) reportRunHandler(c *gin.Context) {
+	report, err := s.reports.Run(c.Param("name"), time.Now())
+	if errors.Is(err, errReportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not configured"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to generate report: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,564 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 分片上传：大批量日志拆成多个分片分别上传，网络中断后只需重传缺失的分片。
+// 各分片按序号拼接后为 NDJSON（每行一条日志），分片边界可以落在一行中间。
+// 会话和分片保存在 data_dir/uploads 下，重启后可以继续上传
+const (
+	maxUploadChunkBytes   = 8 << 20
+	maxUploadSessionBytes = 256 << 20
+	maxUploadChunks       = 10000
+	uploadSessionTTL      = 24 * time.Hour // 创建后超过这么久的会话被清理
+)
+
+// 上传会话，保存在会话目录的 session.json 中
+type uploadSession struct {
+	ID        string        `json:"session_id"`
+	Tenant    string        `json:"tenant,omitempty"`
+	User      string        `json:"user,omitempty"`
+	Chunks    int           `json:"chunks"`            // 分片总数
+	Charset   string        `json:"charset,omitempty"` // 分片内容的字符集，完成时逐行转为 UTF-8
+	Sizes     map[int]int64 `json:"chunk_sizes"`       // 已收到的分片 → 字节数
+	CreatedAt time.Time     `json:"created_at"`
+
+	// complete 中途失败时已写入的条数，按归属节点记录，重试时跳过
+	Written   map[string]int `json:"written,omitempty"`
+	Result    uploadResult   `json:"result"` // 累计的写入结果，完成后重复 complete 时直接返回
+	Completed bool           `json:"completed"`
+
+	mu sync.Mutex // complete 期间持有
+}
+
+// 分片上传的写入结果，与批量上传的响应一致
+type uploadResult struct {
+	Accepted   int     `json:"accepted"`
+	Duplicates int     `json:"duplicates"`
+	Dropped    int     `json:"dropped"`
+	IDs        []int64 `json:"ids"`
+}
+
+// 会话状态
+type uploadSessionStatus struct {
+	ID        string    `json:"session_id"`
+	Chunks    int       `json:"chunks"`
+	Received  []int     `json:"received"`
+	Missing   []int     `json:"missing"`
+	Bytes     int64     `json:"bytes"`
+	Completed bool      `json:"completed"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *uploadSession) status() uploadSessionStatus {
+	st := uploadSessionStatus{ID: s.ID, Chunks: s.Chunks, Received: []int{}, Missing: []int{}, Completed: s.Completed, ExpiresAt: s.CreatedAt.Add(uploadSessionTTL)}
+	for i := 0; i < s.Chunks; i++ {
+		if size, ok := s.Sizes[i]; ok {
+			st.Received = append(st.Received, i)
+			st.Bytes += size
+		} else {
+			st.Missing = append(st.Missing, i)
+		}
+	}
+	return st
+}
+
+// 上传会话的存储
+type uploadSessionStore struct {
+	svc *Service
+	dir string
+
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+var errUploadSessionNotFound = errors.New("upload session not found")
+
+// 加载 dir 下的会话，过期的直接删除
+func (s *Service) newUploadSessionStore(dir string) (*uploadSessionStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	store := &uploadSessionStore{svc: s, dir: dir, sessions: make(map[string]*uploadSession)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		var sess uploadSession
+		if err := loadJSONFile(filepath.Join(dir, e.Name(), "session.json"), &sess); err != nil || sess.ID != e.Name() || now.Sub(sess.CreatedAt) > uploadSessionTTL {
+			os.RemoveAll(filepath.Join(dir, e.Name()))
+			continue
+		}
+		if sess.Sizes == nil {
+			sess.Sizes = make(map[int]int64)
+		}
+		store.sessions[sess.ID] = &sess
+	}
+	return store, nil
+}
+
+// 删除过期的会话，调用方持有 s.mu
+func (s *uploadSessionStore) expireLocked(now time.Time) {
+	for id, sess := range s.sessions {
+		if now.Sub(sess.CreatedAt) > uploadSessionTTL {
+			delete(s.sessions, id)
+			os.RemoveAll(filepath.Join(s.dir, id))
+		}
+	}
+}
+
+// 创建会话。集群中会话 ID 以创建节点的名称开头，后续请求转发给该节点
+func (s *uploadSessionStore) Create(tenant, user string, chunks int, charset string) (*uploadSession, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+	if s.svc.cluster != nil {
+		id = s.svc.cluster.self + "-" + id
+	}
+	sess := &uploadSession{ID: id, Tenant: tenant, User: user, Chunks: chunks, Charset: charset, Sizes: make(map[int]int64), CreatedAt: time.Now()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(sess.CreatedAt)
+	if err := os.MkdirAll(filepath.Join(s.dir, id), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := s.saveLocked(sess); err != nil {
+		return nil, err
+	}
+	s.sessions[id] = sess
+	return sess, nil
+}
+
+func (s *uploadSessionStore) saveLocked(sess *uploadSession) error {
+	return saveJSONFile(filepath.Join(s.dir, sess.ID, "session.json"), sess)
+}
+
+// 查找会话，只能访问同一租户和用户创建的会话
+func (s *uploadSessionStore) Get(id, tenant, user string) (*uploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	sess, ok := s.sessions[id]
+	if !ok || sess.Tenant != tenant || sess.User != user {
+		return nil, errUploadSessionNotFound
+	}
+	return sess, nil
+}
+
+// 保存一个分片，重传的分片覆盖之前收到的内容
+func (s *uploadSessionStore) PutChunk(sess *uploadSession, index int, data []byte) error {
+	path := s.chunkPath(sess, index)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.Sizes[index] = int64(len(data))
+	return s.saveLocked(sess)
+}
+
+func (s *uploadSessionStore) chunkPath(sess *uploadSession, index int) string {
+	return filepath.Join(s.dir, sess.ID, strconv.Itoa(index)+".chunk")
+}
+
+// 删除会话及其分片
+func (s *uploadSessionStore) Delete(sess *uploadSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sess.ID)
+	os.RemoveAll(filepath.Join(s.dir, sess.ID))
+}
+
+// 按序号依次读取各分片，回调拼接后的每一行日志，序号从 0 开始，空行被跳过
+func (s *uploadSessionStore) forEachLine(sess *uploadSession, fn func(i int, line []byte) error) error {
+	var readers []io.Reader
+	for index := 0; index < sess.Chunks; index++ {
+		f, err := os.Open(s.chunkPath(sess, index))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	br := bufio.NewReaderSize(io.MultiReader(readers...), 64<<10)
+	i := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if err := fn(i, decodeCharset(sess.Charset, line)); err != nil {
+				return err
+			}
+			i++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 会话接口的公共部分：按 ID 查找当前租户和用户的会话，不存在时返回 404
+func (s *Service) requestUploadSession(c *gin.Context) (*uploadSession, bool) {
+	sess, err := s.uploadSessions.Get(c.Param("id"), c.GetString("tenant"), userName(currentUser(c)))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+		return nil, false
+	}
+	return sess, true
+}
+
+// 创建分片上传会话，请求体为 {"chunks": 分片总数, "charset": 分片内容的字符集}
+func (s *Service) uploadSessionCreateHandler(c *gin.Context) {
+	var req struct {
+		Chunks  int    `json:"chunks"`
+		Charset string `json:"charset"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	if req.Chunks <= 0 || req.Chunks > maxUploadChunks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("chunks must be between 1 and %d", maxUploadChunks)})
+		return
+	}
+	charset, err := uploadCharsetName(req.Charset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported charset " + req.Charset})
+		return
+	}
+	sess, err := s.uploadSessions.Create(c.GetString("tenant"), userName(currentUser(c)), req.Chunks, charset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create upload session"})
+		return
+	}
+	c.JSON(http.StatusCreated, sess.status())
+}
+
+// 会话状态接口，missing 为还需要上传的分片
+func (s *Service) uploadSessionStatusHandler(c *gin.Context) {
+	sess, ok := s.requestUploadSession(c)
+	if !ok {
+		return
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	c.JSON(http.StatusOK, sess.status())
+}
+
+// 上传一个分片，请求体为分片的原始内容。带 X-Chunk-SHA256 请求头时校验内容，不一致时返回 400 以便重传
+func (s *Service) uploadChunkHandler(c *gin.Context) {
+	sess, ok := s.requestUploadSession(c)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 || index >= sess.Chunks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Chunk index must be between 0 and %d", sess.Chunks-1)})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxUploadChunkBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read request body"})
+		return
+	}
+	if len(data) > maxUploadChunkBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk too large"})
+		return
+	}
+	if want := c.GetHeader("X-Chunk-SHA256"); want != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(want, hex.EncodeToString(sum[:])) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Chunk checksum mismatch"})
+			return
+		}
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.Completed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload session already completed"})
+		return
+	}
+	total := int64(len(data))
+	for i, size := range sess.Sizes {
+		if i != index {
+			total += size
+		}
+	}
+	if total > maxUploadSessionBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload session too large"})
+		return
+	}
+	if err := s.uploadSessions.PutChunk(sess, index, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save chunk"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_id": sess.ID, "index": index, "bytes": len(data)})
+}
+
+// 放弃会话
+func (s *Service) uploadSessionDeleteHandler(c *gin.Context) {
+	sess, ok := s.requestUploadSession(c)
+	if !ok {
+		return
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	s.uploadSessions.Delete(sess)
+	c.JSON(http.StatusOK, gin.H{"message": "Upload session deleted"})
+}
+
+// 校验失败时已写出错误响应
+var errUploadRejected = errors.New("upload rejected")
+
+// 完成上传：全部分片到齐后校验并写入，与批量上传一样任何一条校验失败时整批拒绝。
+// 写入中途失败时可以重试，已写入的日志不会重复写入；完成后重复调用返回同样的结果
+func (s *Service) uploadSessionCompleteHandler(c *gin.Context) {
+	sess, ok := s.requestUploadSession(c)
+	if !ok {
+		return
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.Completed {
+		writeUploadResult(c, &sess.Result)
+		return
+	}
+	if st := sess.status(); len(st.Missing) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Missing chunks", "missing": st.Missing})
+		return
+	}
+
+	// 先校验全部日志，并记下每条日志的归属节点
+	var owners []string
+	err := s.uploadSessions.forEachLine(sess, func(i int, line []byte) error {
+		var entry LogData
+		if json.Unmarshal(line, &entry) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Entry %d is not valid JSON", i)})
+			return errUploadRejected
+		}
+		if binding.Validator.ValidateStruct(&entry) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Entry %d is missing required fields", i)})
+			return errUploadRejected
+		}
+		if fieldTooLong(c, s.uploadLimits.checkEntry(entry), fmt.Sprintf("Entry %d: ", i)) {
+			return errUploadRejected
+		}
+		appID, ok := scopedApplicationID(c, entry.ApplicationID)
+		if !ok {
+			return errUploadRejected
+		}
+		entry.ApplicationID = appID
+		if err := s.checkUploadTimestamp(&entry, time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Entry %d has an invalid timestamp%s", i, timestampMismatch(err))})
+			return errUploadRejected
+		}
+		owner := ""
+		if s.cluster != nil {
+			owner = s.cluster.Owner(appID)
+		}
+		owners = append(owners, owner)
+		return nil
+	})
+	if errors.Is(err, errUploadRejected) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read upload chunks"})
+		return
+	}
+	if len(owners) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No log entries in upload"})
+		return
+	}
+
+	if sess.Written == nil {
+		sess.Written = make(map[string]int)
+	}
+	res := &sess.Result
+	if len(res.IDs) != len(owners) {
+		res.IDs = make([]int64, len(owners))
+	}
+	err = s.ingestUploadSession(c, sess, owners, res)
+	s.uploadSessions.mu.Lock()
+	sess.Completed = err == nil
+	s.uploadSessions.saveLocked(sess)
+	s.uploadSessions.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, errUploadRejected) {
+			return
+		}
+		s.ingestFailed(c, err, res.Accepted)
+		return
+	}
+	// 结果已保存，分片不再需要
+	for index := 0; index < sess.Chunks; index++ {
+		os.Remove(s.uploadSessions.chunkPath(sess, index))
+	}
+	auditCount(c, res.Accepted-res.Duplicates-res.Dropped)
+	writeUploadResult(c, res)
+}
+
+func writeUploadResult(c *gin.Context, res *uploadResult) {
+	c.JSON(http.StatusOK, gin.H{"message": "Logs uploaded successfully", "accepted": res.Accepted, "duplicates": res.Duplicates, "dropped": res.Dropped, "ids": res.IDs})
+}
+
+// 按归属节点依次写入会话中的日志：本节点的直接写入，其他节点的以批量上传转发。
+// sess.Written 记录各节点已写入的条数，重试时跳过这些日志
+func (s *Service) ingestUploadSession(c *gin.Context, sess *uploadSession, owners []string, res *uploadResult) error {
+	nodes := make(map[string]bool)
+	for _, owner := range owners {
+		nodes[owner] = true
+	}
+	for _, node := range sortedKeys(nodes) {
+		local := node == "" || node == s.cluster.self
+		var batch []json.RawMessage
+		var positions []int
+		n := 0
+		err := s.uploadSessions.forEachLine(sess, func(i int, line []byte) error {
+			if owners[i] != node {
+				return nil
+			}
+			if n++; n <= sess.Written[node] {
+				return nil
+			}
+			if !local {
+				batch = append(batch, json.RawMessage(append([]byte(nil), line...)))
+				positions = append(positions, i)
+				if len(batch) < maxBatchSize {
+					return nil
+				}
+				err := s.forwardUploadBatch(c, sess, node, batch, positions, res)
+				batch, positions = nil, nil
+				return err
+			}
+
+			var entry LogData
+			json.Unmarshal(line, &entry)
+			entry.ApplicationID, _ = scopedApplicationID(c, entry.ApplicationID)
+			entry.Source = s.requestSourceIP(c)
+			// 校验时已确认能按应用的格式解析，这里转换为存储格式
+			if err := s.checkUploadTimestamp(&entry, time.Now()); err != nil {
+				return err
+			}
+			id, err := s.ingestEntry(entry)
+			if errors.Is(err, errDuplicateEntry) {
+				res.Duplicates++
+			} else if errors.Is(err, errDroppedEntry) {
+				res.Dropped++
+			} else if err != nil {
+				return err
+			}
+			res.Accepted++
+			res.IDs[i] = id
+			sess.Written[node]++
+			return nil
+		})
+		if err == nil && len(batch) > 0 {
+			err = s.forwardUploadBatch(c, sess, node, batch, positions, res)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 以批量上传将一组日志转发给所属节点。幂等键由会话 ID 和该节点已写入的条数组成，
+// 重试时转发的是同一组日志，所属节点直接返回第一次的结果
+func (s *Service) forwardUploadBatch(c *gin.Context, sess *uploadSession, node string, batch []json.RawMessage, positions []int, res *uploadResult) error {
+	header := c.Request.Header.Clone()
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	header.Set(clusterSourceHeader, s.requestSourceIP(c))
+	header.Set("Idempotency-Key", fmt.Sprintf("upload-session/%s/%s/%d", sess.ID, node, sess.Written[node]))
+	uri := c.Request.URL.Path[:strings.Index(c.Request.URL.Path, "/upload/sessions/")] + "/upload/batch"
+
+	body, _ := json.Marshal(batch)
+	status, data, err := s.cluster.send(node, http.MethodPost, uri, header, body)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Owner node unavailable", "accepted": res.Accepted})
+		return errUploadRejected
+	}
+	var result struct {
+		uploadResult
+		Error string `json:"error"`
+	}
+	json.Unmarshal(data, &result)
+	if status != http.StatusOK {
+		// 所属节点写入了一部分时同样计入，重试时从之后继续
+		sess.Written[node] += result.Accepted
+		res.Accepted += result.Accepted
+		if result.Error == "" {
+			result.Error = "Owner node failed"
+		}
+		c.JSON(status, gin.H{"error": result.Error, "accepted": res.Accepted})
+		return errUploadRejected
+	}
+	sess.Written[node] += len(batch)
+	res.Accepted += result.Accepted
+	res.Duplicates += result.Duplicates
+	res.Dropped += result.Dropped
+	for k, id := range result.IDs {
+		if k < len(positions) {
+			res.IDs[positions[k]] = id
+		}
+	}
+	return nil
+}
+
+// 路由中间件：集群中会话的请求转发给创建会话的节点
+func (s *Service) clusterRouteSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.clusterLocal(c) {
+			c.Next()
+			return
+		}
+		id := c.Param("id")
+		i := strings.LastIndex(id, "-")
+		if i <= 0 {
+			c.Next()
+			return
+		}
+		node := id[:i]
+		for _, m := range s.cluster.members {
+			if m.Name == node && node != s.cluster.self {
+				s.cluster.forward(c, node)
+				return
+			}
+		}
+		c.Next()
+	}
+}
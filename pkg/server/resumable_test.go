@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 服务的 HTTP 接口，会话存储只在 Handler 中初始化
+func openUploadHandler(t *testing.T, s *Service) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	handler, err := s.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+func sendUploadRequest(t *testing.T, router http.Handler, method, path string, body []byte, header ...string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var res map[string]any
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res
+}
+
+// 分片边界落在一行中间，缺失的分片可在重启后补传，完成后重复调用返回同样的结果且不重复写入
+func TestUploadSessionResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	var ndjson bytes.Buffer
+	now := time.Now()
+	for i, message := range []string{"order placed", "order paid", "order shipped"} {
+		line, err := json.Marshal(testEntry("orders", "INFO", message, now.Add(time.Duration(i)*time.Millisecond)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ndjson.Write(append(line, '\n'))
+	}
+	data := ndjson.Bytes()
+	chunks := [][]byte{data[:len(data)/3], data[len(data)/3 : 2*len(data)/3], data[2*len(data)/3:]}
+
+	s := openTestService(t, dir)
+	router := openUploadHandler(t, s)
+	code, res := sendUploadRequest(t, router, http.MethodPost, "/upload/sessions", []byte(`{"chunks":3}`))
+	if code != http.StatusCreated {
+		t.Fatalf("create session: %d %v", code, res)
+	}
+	base := "/upload/sessions/" + res["session_id"].(string)
+	for _, index := range []int{0, 2} {
+		if code, res := sendUploadRequest(t, router, http.MethodPut, base+"/chunks/"+strconv.Itoa(index), chunks[index]); code != http.StatusOK {
+			t.Fatalf("chunk %d: %d %v", index, code, res)
+		}
+	}
+	if code, res := sendUploadRequest(t, router, http.MethodPost, base+"/complete", nil); code != http.StatusConflict || !reflect.DeepEqual(res["missing"], []any{float64(1)}) {
+		t.Fatalf("complete with a missing chunk: %d %v, want 409 missing [1]", code, res)
+	}
+	if code, res := sendUploadRequest(t, router, http.MethodPut, base+"/chunks/1", chunks[1], "X-Chunk-SHA256", strings.Repeat("0", 64)); code != http.StatusBadRequest {
+		t.Fatalf("chunk with a wrong checksum: %d %v, want 400", code, res)
+	}
+	if code, res := sendUploadRequest(t, router, http.MethodPut, base+"/chunks/3", chunks[1]); code != http.StatusBadRequest {
+		t.Fatalf("chunk index out of range: %d %v, want 400", code, res)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestService(t, dir)
+	router = openUploadHandler(t, s)
+	if code, res := sendUploadRequest(t, router, http.MethodGet, base, nil); code != http.StatusOK || !reflect.DeepEqual(res["missing"], []any{float64(1)}) {
+		t.Fatalf("status after restart: %d %v, want missing [1]", code, res)
+	}
+	sum := sha256.Sum256(chunks[1])
+	if code, res := sendUploadRequest(t, router, http.MethodPut, base+"/chunks/1", chunks[1], "X-Chunk-SHA256", hex.EncodeToString(sum[:])); code != http.StatusOK {
+		t.Fatalf("chunk 1: %d %v", code, res)
+	}
+	code, first := sendUploadRequest(t, router, http.MethodPost, base+"/complete", nil)
+	if code != http.StatusOK || first["accepted"] != float64(3) {
+		t.Fatalf("complete: %d %v, want 3 accepted", code, first)
+	}
+	if code, again := sendUploadRequest(t, router, http.MethodPost, base+"/complete", nil); code != http.StatusOK || !reflect.DeepEqual(again, first) {
+		t.Fatalf("repeated complete: %d %v, want %v", code, again, first)
+	}
+	if code, res := sendUploadRequest(t, router, http.MethodPut, base+"/chunks/0", chunks[0]); code != http.StatusConflict {
+		t.Fatalf("chunk after completion: %d %v, want 409", code, res)
+	}
+	got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}})
+	if want := []string{"order placed", "order paid", "order shipped"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("messages %q, want %q", got, want)
+	}
+
+	if code, res := sendUploadRequest(t, router, http.MethodDelete, base, nil); code != http.StatusOK {
+		t.Fatalf("delete session: %d %v", code, res)
+	}
+	if code, _ := sendUploadRequest(t, router, http.MethodGet, base, nil); code != http.StatusNotFound {
+		t.Fatalf("status after delete: %d, want 404", code)
+	}
+}
+
+// 任何一条日志校验失败时整个会话被拒绝，不写入其他日志
+func TestUploadSessionRejectsInvalidEntry(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	router := openUploadHandler(t, s)
+	code, res := sendUploadRequest(t, router, http.MethodPost, "/upload/sessions", []byte(`{"chunks":1}`))
+	if code != http.StatusCreated {
+		t.Fatalf("create session: %d %v", code, res)
+	}
+	base := "/upload/sessions/" + res["session_id"].(string)
+	line, err := json.Marshal(testEntry("orders", "INFO", "order placed", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := append(append(line, '\n'), `{"application_id":"orders"}`+"\n"...)
+	if code, res := sendUploadRequest(t, router, http.MethodPut, base+"/chunks/0", chunk); code != http.StatusOK {
+		t.Fatalf("chunk 0: %d %v", code, res)
+	}
+	if code, res := sendUploadRequest(t, router, http.MethodPost, base+"/complete", nil); code != http.StatusBadRequest || res["error"] != "Entry 1 is missing required fields" {
+		t.Fatalf("complete: %d %v, want 400 for entry 1", code, res)
+	}
+	if _, err := s.Query(context.Background(), Query{ApplicationIDs: []string{"orders"}}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("entries written from a rejected session: %v", err)
+	}
+}
@@ -0,0 +1,508 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 按级别的保留策略：不同级别的日志保留不同的天数，如 ERROR 90 天、INFO 14 天、DEBUG 3 天。
+// 天数从分段的收到日期算起，包含当天。全部级别都到期的分段整个删除，部分到期的分段改写为只含未到期的行
+type RetentionPolicy struct {
+	DefaultDays int            `json:"default_days"` // 未单独配置的级别保留的天数，0 表示不限
+	Levels      map[string]int `json:"levels"`       // 级别 → 保留天数，0 表示不限
+}
+
+// 保留策略配置，未配置任何天数时不启用
+type RetentionConfig struct {
+	RetentionPolicy
+	Applications map[string]RetentionPolicy `json:"applications"` // 应用 ID（租户应用为 租户/应用）→ 策略，覆盖全局策略中的同名级别，default_days 非零时覆盖全局默认值
+	Interval     Duration                   `json:"interval"`     // 清理的间隔，默认 1h
+}
+
+var (
+	retentionDeleted   = metrics.counter("retention_deleted_segments_total", "Segments deleted because every level in them passed its retention, by application.")
+	retentionRewritten = metrics.counter("retention_rewritten_segments_total", "Segments rewritten to drop entries past their level's retention, by application.")
+	retentionDropped   = metrics.counter("retention_dropped_entries_total", "Entries removed by level retention, by application and level.")
+)
+
+// 一次清理的结果
+type retentionReport struct {
+	Applications int            `json:"applications"`
+	Segments     int            `json:"segments"`  // 检查的分段
+	Deleted      int            `json:"deleted"`   // 整个删除的分段
+	Rewritten    int            `json:"rewritten"` // 改写的分段
+	Skipped      int            `json:"skipped"`   // 已分层到对象存储的分段不清理
+	Dropped      map[string]int `json:"dropped"`   // 按级别统计删除的日志条数
+	FreedBytes   int64          `json:"freed_bytes"`
+	DryRun       bool           `json:"dry_run"`
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   time.Time      `json:"finished_at"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// 按级别清理到期日志的后台任务
+type retentionManager struct {
+	svc    *Service
+	config RetentionConfig
+
+	mu      sync.Mutex        // 同一时间只执行一次清理
+	applied map[string]string // 分段路径 → 已清除的级别，到期级别不变的分段不再重复读取
+	last    *retentionReport  // 最近一次后台清理的结果
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (s *Service) newRetentionManager(c RetentionConfig) (*retentionManager, error) {
+	if c.Interval < 0 {
+		return nil, fmt.Errorf("interval must not be negative")
+	}
+	if c.Interval == 0 {
+		c.Interval = Duration(time.Hour)
+	}
+	normalize := func(name string, p *RetentionPolicy) error {
+		if p.DefaultDays < 0 {
+			return fmt.Errorf("%sdefault_days must not be negative", name)
+		}
+		levels := make(map[string]int, len(p.Levels))
+		for level, days := range p.Levels {
+			if days < 0 {
+				return fmt.Errorf("%slevels.%s must not be negative", name, level)
+			}
+			levels[strings.ToUpper(level)] = days
+		}
+		p.Levels = levels
+		return nil
+	}
+	if err := normalize("", &c.RetentionPolicy); err != nil {
+		return nil, err
+	}
+	for app, p := range c.Applications {
+		if err := normalize("applications."+app+".", &p); err != nil {
+			return nil, err
+		}
+		c.Applications[app] = p
+	}
+	return &retentionManager{svc: s, config: c, applied: make(map[string]string), stop: make(chan struct{})}, nil
+}
+
+// 是否配置了任何保留天数
+func (m *retentionManager) enabled() bool {
+	configured := func(p RetentionPolicy) bool {
+		if p.DefaultDays > 0 {
+			return true
+		}
+		for _, days := range p.Levels {
+			if days > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if configured(m.config.RetentionPolicy) {
+		return true
+	}
+	for _, p := range m.config.Applications {
+		if configured(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// 应用生效的策略
+func (m *retentionManager) Policy(applicationID string) RetentionPolicy {
+	p := RetentionPolicy{DefaultDays: m.config.DefaultDays, Levels: make(map[string]int)}
+	for level, days := range m.config.Levels {
+		p.Levels[level] = days
+	}
+	if o, ok := m.config.Applications[applicationID]; ok {
+		if o.DefaultDays > 0 {
+			p.DefaultDays = o.DefaultDays
+		}
+		for level, days := range o.Levels {
+			p.Levels[level] = days
+		}
+	}
+	return p
+}
+
+// 级别保留的天数，0 表示不限
+func (p RetentionPolicy) days(level string) int {
+	if days, ok := p.Levels[strings.ToUpper(level)]; ok {
+		return days
+	}
+	return p.DefaultDays
+}
+
+// 日志所属日期是否已超过保留天数，与清理预览的 max_age_days 一样包含当天
+func retentionExpired(days int, day, now time.Time) bool {
+	if days <= 0 {
+		return false
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return day.Before(today.AddDate(0, 0, -days+1))
+}
+
+// 启动后台清理，未配置保留天数时不启动
+func (m *retentionManager) Start() {
+	if !m.enabled() {
+		return
+	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(time.Duration(m.config.Interval))
+		defer ticker.Stop()
+		for {
+			report := m.Run(nil, false)
+			if report.Error != "" {
+				log.Printf("retention failed: %s", report.Error)
+			}
+			m.mu.Lock()
+			m.last = &report
+			m.mu.Unlock()
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *retentionManager) Close() error {
+	close(m.stop)
+	m.wg.Wait()
+	return nil
+}
+
+func (m *retentionManager) stopping() bool {
+	select {
+	case <-m.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// 本节点负责清理的应用：文件后端中由本节点处理的应用，归档和法律保留的应用除外
+func (s *Service) retentionApplications() ([]string, error) {
+	apps, err := s.listApplications()
+	if err != nil {
+		return nil, err
+	}
+	for _, tenant := range sortedKeys(s.tenants.configs) {
+		tenantApps, err := s.tenantApplications(tenant)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, tenantApps...)
+	}
+	var owned []string
+	for _, app := range apps {
+		backend := s.backends.BackendOf(app)
+		if _, bc, _ := s.backends.Store(backend); bc.Type != "file" {
+			continue
+		}
+		if !s.cluster.OwnsFolder(backend, model.BareApplicationID(app)) || s.lifecycle.Retained(app) {
+			continue
+		}
+		owned = append(owned, app)
+	}
+	return owned, nil
+}
+
+// 清理一组应用，apps 为空时清理本节点负责的全部应用；dryRun 时只统计不改写
+func (m *retentionManager) Run(apps []string, dryRun bool) retentionReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := retentionReport{Dropped: make(map[string]int), DryRun: dryRun, StartedAt: time.Now().UTC()}
+
+	if len(apps) == 0 {
+		var err error
+		if apps, err = m.svc.retentionApplications(); err != nil {
+			report.Error = err.Error()
+			report.FinishedAt = time.Now().UTC()
+			return report
+		}
+	}
+	now := time.Now().UTC()
+	for _, app := range apps {
+		if m.svc.lifecycle.Retained(app) {
+			continue
+		}
+		if err := m.retainApplication(app, now, dryRun, &report); err != nil {
+			report.Error = fmt.Sprintf("%s: %v", app, err)
+			break
+		}
+		if m.stopping() {
+			break
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+	return report
+}
+
+// 清理一个应用的分段，正在写入的分段不处理
+func (m *retentionManager) retainApplication(applicationID string, now time.Time, dryRun bool, report *retentionReport) error {
+	policy := m.Policy(applicationID)
+	dir := m.svc.applicationDir(applicationID)
+	segments, err := prunableSegments(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	report.Applications++
+
+	var deleted []string
+	var freed int64
+	rewritten, dropped := 0, 0
+	for _, seg := range segments {
+		if m.stopping() {
+			break
+		}
+		day := logFileDate(seg.Day)
+		path := filepath.Join(dir, seg.Name)
+		report.Segments++
+
+		// 默认天数不限时，未单独配置的级别永不到期，分段不会整个删除
+		all := retentionExpired(policy.DefaultDays, day, now)
+		var expired []string
+		for level, days := range policy.Levels {
+			if retentionExpired(days, day, now) {
+				expired = append(expired, level)
+			} else {
+				all = false
+			}
+		}
+		sort.Strings(expired)
+
+		if all {
+			if !dryRun {
+				for _, file := range seg.Files {
+					if err := removeSegmentFile(filepath.Join(dir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+						return err
+					}
+				}
+				m.forget(applicationID, seg.Name, path)
+				retentionDeleted.Add(1, "application", applicationID)
+			}
+			deleted = append(deleted, seg.Name)
+			freed += seg.Bytes
+			report.Deleted++
+			report.FreedBytes += seg.Bytes
+			continue
+		}
+		if len(expired) == 0 && !retentionExpired(policy.DefaultDays, day, now) {
+			continue
+		}
+		if segmentOnlyTiered(path) {
+			report.Skipped++
+			continue
+		}
+		// 到期的级别与上次清理时相同，分段中已没有需要删除的行
+		key := strings.Join(expired, ",")
+		if policy.DefaultDays > 0 && retentionExpired(policy.DefaultDays, day, now) {
+			key += ";default"
+		}
+		if !dryRun && m.applied[path] == key {
+			continue
+		}
+		counts, saved, err := m.svc.rewriteRetainedSegment(applicationID, seg.Name, day, policy, now, dryRun)
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			if len(counts) > 0 {
+				m.forget(applicationID, seg.Name, path)
+			}
+			m.applied[path] = key
+		}
+		n := 0
+		for level, count := range counts {
+			report.Dropped[level] += count
+			n += count
+			if !dryRun {
+				retentionDropped.Add(float64(count), "application", applicationID, "level", level)
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		report.Rewritten++
+		report.FreedBytes += saved
+		rewritten++
+		dropped += n
+		freed += saved
+		if !dryRun {
+			retentionRewritten.Add(1, "application", applicationID)
+		}
+	}
+	if dryRun || len(deleted)+rewritten == 0 {
+		return nil
+	}
+	log.Printf("retention: app=%s deleted=%d rewritten=%d dropped=%d freed=%d", applicationID, len(deleted), rewritten, dropped, freed)
+	m.svc.systemEvents.Publish(eventRetention, applicationID,
+		fmt.Sprintf("Deleted %d segments and removed %d entries past their level retention", len(deleted), dropped),
+		gin.H{"segments": deleted, "rewritten": rewritten, "dropped_entries": dropped, "freed_bytes": freed})
+	return nil
+}
+
+// 分段被删除或改写后丢弃缓存的查询结果、计数和 XID 过滤器
+func (m *retentionManager) forget(applicationID, name, path string) {
+	delete(m.applied, path)
+	m.svc.queryCache.Invalidate(path)
+	m.svc.histogramCounts.Forget(applicationID, name)
+	m.svc.xidBlooms.Forget(applicationID, name)
+}
+
+// 改写分段，只保留未到期级别的日志，返回按级别删除的条数和腾出的字节数。没有保留的行时删除分段。
+// 改写期间阻塞该应用的写入，压缩分段改写为普通文件，由压缩任务重新压缩；无法解析的行原样保留
+func (s *Service) rewriteRetainedSegment(applicationID, name string, day time.Time, policy RetentionPolicy, now time.Time, dryRun bool) (map[string]int, int64, error) {
+	dir := s.applicationDir(applicationID)
+	path := filepath.Join(dir, name)
+	if !dryRun {
+		gate := s.backends.WriteGate(applicationID)
+		gate.Lock()
+		defer gate.Unlock()
+	}
+	src, size := path, int64(0)
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	} else if p, info := compressedSegmentPath(path); p != "" {
+		src, size = p, info.Size()
+	}
+	// 改写存储类别链接指向的文件，链接保持不变
+	target := path
+	if src == path {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			target = resolved
+		}
+	}
+
+	var out *os.File
+	var w *bufio.Writer
+	tmp := target + ".retention.tmp"
+	if !dryRun {
+		var err error
+		if out, err = os.Create(tmp); err != nil {
+			return nil, 0, err
+		}
+		w = bufio.NewWriter(out)
+	}
+	dropped := make(map[string]int)
+	kept, droppedBytes := 0, int64(0)
+	var writeErr error
+	// 读取时已解密，按应用当前的密钥重新加密
+	write := func(record string) bool {
+		if w == nil {
+			return true
+		}
+		if record, writeErr = s.encryption.Seal(applicationID, path, record); writeErr == nil {
+			_, writeErr = w.WriteString(record)
+		}
+		return writeErr == nil
+	}
+	_, err := s.scanFileLines(context.Background(), path, 0, func(line string, offset, next int64) bool {
+		if offset == 0 && isFormatHeader(line) {
+			if w != nil {
+				w.WriteString(line + "\n")
+			}
+			return true
+		}
+		entry, err := parseLogLine(line)
+		if err != nil || !retentionExpired(policy.days(entry.LogLevel), day, now) {
+			kept++
+			return write(line + "\n")
+		}
+		dropped[strings.ToUpper(entry.LogLevel)]++
+		droppedBytes += int64(len(line)) + 1
+		return true
+	})
+	if err == nil {
+		err = writeErr
+	}
+	// 试运行时按删除的行估算腾出的空间
+	if dryRun {
+		return dropped, droppedBytes, err
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || len(dropped) == 0 {
+		os.Remove(tmp)
+		return dropped, 0, err
+	}
+	if kept == 0 {
+		os.Remove(tmp)
+		if err := removeSegmentFile(src); err != nil {
+			return nil, 0, err
+		}
+		return dropped, size, nil
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, 0, err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return nil, 0, err
+	}
+	if src != path {
+		removeSegmentFile(src)
+	}
+	return dropped, size - info.Size(), nil
+}
+
+// 保留策略接口：各应用生效的策略及最近一次后台清理的结果
+func (s *Service) retentionHandler(c *gin.Context) {
+	apps, ok := s.storageApplications(c)
+	if !ok {
+		return
+	}
+	policies := make(map[string]RetentionPolicy, len(apps))
+	for _, app := range apps {
+		policies[app] = s.retention.Policy(app)
+	}
+	s.retention.mu.Lock()
+	last := s.retention.last
+	s.retention.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"enabled": s.retention.enabled(), "interval": s.retention.config.Interval, "applications": policies, "last_run": last})
+}
+
+// 立即执行一次清理，application_id 为空时清理全部应用；dry_run=true 时只统计会删除的分段和日志
+func (s *Service) retentionRunHandler(c *gin.Context) {
+	var apps []string
+	if c.Query("application_id") != "" {
+		var ok bool
+		if apps, ok = s.requestApplications(c); !ok {
+			return
+		}
+	}
+	report := s.retention.Run(apps, c.Query("dry_run") == "true")
+	if report.Error != "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to apply retention: " + report.Error})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 在应用目录中写入 days 天前收到的分段，每个级别一条日志
+func writeRetentionSegment(t *testing.T, dir string, days int, levels ...string) string {
+	t.Helper()
+	day := time.Now().AddDate(0, 0, -days)
+	var data strings.Builder
+	data.WriteString(formatHeaderLine)
+	for _, level := range levels {
+		line, err := encodeLogRecord(testEntry("orders", level, level+" "+day.Format("2006-01-02"), day))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data.WriteString(line)
+	}
+	path := filepath.Join(dir, day.Format("2006-01-02")+".log")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 全部级别到期的分段被删除，部分到期的分段改写为只含未到期的行，试运行不改动文件
+func TestRetentionDeletesAndRewritesSegments(t *testing.T) {
+	dir := t.TempDir()
+	appDir := filepath.Join(dir, "logs", "orders")
+	expired := writeRetentionSegment(t, appDir, 70, "ERROR", "INFO")
+	partial := writeRetentionSegment(t, appDir, 30, "ERROR", "INFO", "DEBUG")
+	recent := writeRetentionSegment(t, appDir, 5, "ERROR", "INFO", "DEBUG")
+	s := openTestService(t, dir)
+	ingestTestEntry(t, s, testEntry("orders", "DEBUG", "today", time.Now()))
+
+	m, err := s.newRetentionManager(RetentionConfig{RetentionPolicy: RetentionPolicy{DefaultDays: 60, Levels: map[string]int{"info": 14, "debug": 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := m.Run([]string{"orders"}, true)
+	if report.Error != "" || report.Deleted != 1 || report.Rewritten != 2 || !reflect.DeepEqual(report.Dropped, map[string]int{"INFO": 1, "DEBUG": 2}) {
+		t.Fatalf("dry run report %+v", report)
+	}
+	if after, err := os.ReadFile(partial); err != nil || string(after) != string(before) {
+		t.Fatalf("dry run changed %s: %v", partial, err)
+	}
+	if _, err := os.Stat(expired); err != nil {
+		t.Fatalf("dry run deleted %s: %v", expired, err)
+	}
+
+	report = m.Run([]string{"orders"}, false)
+	if report.Error != "" || report.Deleted != 1 || report.Rewritten != 2 || report.FreedBytes <= 0 {
+		t.Fatalf("report %+v", report)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Fatalf("expired segment kept: %v", err)
+	}
+	data, err := os.ReadFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), formatHeaderLine) {
+		t.Fatalf("rewritten segment lost the file header:\n%s", data)
+	}
+	got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}})
+	day := func(days int) string { return time.Now().AddDate(0, 0, -days).Format("2006-01-02") }
+	want := []string{"ERROR " + day(30), "ERROR " + day(5), "INFO " + day(5), "today"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("messages %q, want %q", got, want)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Fatal(err)
+	}
+
+	// 到期级别不变时不再改写
+	if report := m.Run([]string{"orders"}, false); report.Rewritten != 0 || report.Deleted != 0 {
+		t.Fatalf("second run %+v, want nothing to do", report)
+	}
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 服务的 HTTP 接口，与 Main 启动的服务相同，供嵌入引擎的程序挂载到自己的 HTTP 服务上。
+// 同时初始化只有 HTTP 服务使用的组件（用户、网络策略、断点续传、上传签名、审计和探针），
+// 它们随 Service 关闭；每个 Service 只应调用一次
+func (s *Service) Handler() (http.Handler, error) {
+	if err := s.openHTTP(); err != nil {
+		return nil, err
+	}
+	router, err := s.newRouter()
+	if err != nil {
+		return nil, fmt.Errorf("invalid network config: %w", err)
+	}
+	return router, nil
+}
+
+// 初始化只有 HTTP 服务使用的组件
+func (s *Service) openHTTP() error {
+	var err error
+	if s.users, err = newUserRegistry(s.cfg.Access, s.cfg.DataDir); err != nil {
+		return fmt.Errorf("invalid access config: %w", err)
+	}
+	if s.netPolicy, err = newNetworkPolicy(s.cfg.Network); err != nil {
+		return fmt.Errorf("invalid network config: %w", err)
+	}
+	if err := s.cfg.CORS.validate(); err != nil {
+		return fmt.Errorf("invalid cors config: %w", err)
+	}
+	if s.uploadSessions, err = s.newUploadSessionStore(filepath.Join(s.cfg.DataDir, "uploads")); err != nil {
+		return fmt.Errorf("unable to load upload sessions: %w", err)
+	}
+	if s.uploadSigning, err = newUploadSigner(s.cfg.UploadSigning); err != nil {
+		return fmt.Errorf("invalid upload signing config: %w", err)
+	}
+
+	// 接口访问审计
+	if s.audit, err = newAuditLog(s.cfg.DataDir); err != nil {
+		return fmt.Errorf("unable to open audit log: %w", err)
+	}
+	s.registerShutdownHook("audit log", s.audit.Close)
+
+	// 启动合成探针
+	baseURL := s.cfg.ProbeBaseURL
+	if baseURL == "" {
+		baseURL = probeBaseURL(s.cfg.Listen, s.cfg.TLS.Enabled())
+	}
+	probeClient, err := newTLSHTTPClient(s.cfg.ProbeTLS, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("unable to load probe TLS config: %w", err)
+	}
+	s.probeRunner = s.newProbeRunner(baseURL, s.cfg.ProbeAPIKey, s.cfg.Probes, probeClient)
+	s.probeRunner.Start()
+	s.registerShutdownHook("probes", s.probeRunner.Close)
+	return nil
+}
+
+// 创建路由并注册全部接口，SetTrustedProxies 失败时返回错误
+func (s *Service) newRouter() (*gin.Engine, error) {
+	router := gin.Default()
+	if len(s.cfg.Network.TrustedProxies) > 0 {
+		if err := router.SetTrustedProxies(s.cfg.Network.TrustedProxies); err != nil {
+			return nil, err
+		}
+	}
+	router.Use(corsMiddleware(s.cfg.CORS), s.auditMiddleware(), s.clusterMiddleware(), s.networkPolicyMiddleware(), s.accessControl())
+
+	// 过载时按租户公平分配上传和查询容量
+	ingestFairness, queryFairness := newFairSchedulers(s.cfg.Fairness)
+
+	// 定义日志上传和查询的路由
+	router.POST("/upload", s.rejectWhenDraining(), s.verifyUploadSignature(signedByBody), fairnessMiddleware(ingestFairness), s.clusterRouteBody(), s.idempotency(), s.logUploadHandler)
+	router.POST("/upload/batch", s.rejectWhenDraining(), s.verifyUploadSignature(signedByBody), fairnessMiddleware(ingestFairness), s.clusterRouteBody(), s.idempotency(), s.logBatchUploadHandler)
+	router.POST("/upload/raw", s.rejectWhenDraining(), s.verifyUploadSignature(signedByQuery), fairnessMiddleware(ingestFairness), s.clusterRoute(true), s.idempotency(), s.logRawUploadHandler)
+	router.POST("/upload/logstash", s.rejectWhenDraining(), s.verifyUploadSignature(signedByQuery), fairnessMiddleware(ingestFairness), s.clusterRoute(true), s.idempotency(), s.logstashUploadHandler)
+	router.POST("/import", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), fairnessMiddleware(ingestFairness), s.clusterRoute(true), s.importHandler)
+	router.POST("/upload/sessions", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), s.uploadSessionCreateHandler)
+	router.GET("/upload/sessions/:id", s.clusterRouteSession(), s.uploadSessionStatusHandler)
+	router.PUT("/upload/sessions/:id/chunks/:index", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), fairnessMiddleware(ingestFairness), s.clusterRouteSession(), s.uploadChunkHandler)
+	router.POST("/upload/sessions/:id/complete", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), fairnessMiddleware(ingestFairness), s.clusterRouteSession(), s.uploadSessionCompleteHandler)
+	router.DELETE("/upload/sessions/:id", s.clusterRouteSession(), s.uploadSessionDeleteHandler)
+	router.GET("/query", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.logQueryHandler)
+	router.GET("/logs/:id", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.logGetHandler)
+	router.GET("/tail", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.logTailHandler)
+	router.GET("/tail/ws", fairnessMiddleware(queryFairness), s.logSubscribeHandler)
+	router.GET("/aggregate", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.aggregateHandler)
+	router.GET("/histogram", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.histogramHandler)
+	router.GET("/applications", s.applicationListHandler)
+	router.GET("/applications/:application_id/files", s.clusterRoute(false), s.logFileListHandler)
+	router.GET("/applications/:application_id/files/:date", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.logFileDownloadHandler)
+	router.GET("/stats", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.applicationStatsHandler)
+	router.GET("/transactions", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.transactionListHandler)
+	router.GET("/transactions/:xid", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.transactionTimelineHandler)
+	router.POST("/transactions/logs", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.transactionLogsHandler)
+	router.GET("/transactions/:xid/graph", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.transactionGraphHandler)
+	router.GET("/transactions/:xid/diagnosis", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.transactionDiagnosisHandler)
+	router.GET("/events/seata", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.seataEventsHandler)
+	router.GET("/tc/nodes", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.tcNodesHandler)
+	router.GET("/saga/:key", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.sagaTraceHandler)
+	router.GET("/traces/:trace_id/logs", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.traceLogsHandler)
+	router.GET("/requests/:request_id/logs", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.requestLogsHandler)
+
+	// 租户接口：与上面的上传查询接口相同，数据写入租户独立的存储根目录并受租户配额限制
+	tenantAPI := router.Group("/tenants/:tenant", s.tenantAuth())
+	tenantAPI.POST("/upload", s.rejectWhenDraining(), s.verifyUploadSignature(signedByBody), fairnessMiddleware(ingestFairness), s.clusterRouteBody(), s.idempotency(), s.logUploadHandler)
+	tenantAPI.POST("/upload/batch", s.rejectWhenDraining(), s.verifyUploadSignature(signedByBody), fairnessMiddleware(ingestFairness), s.clusterRouteBody(), s.idempotency(), s.logBatchUploadHandler)
+	tenantAPI.POST("/upload/raw", s.rejectWhenDraining(), s.verifyUploadSignature(signedByQuery), fairnessMiddleware(ingestFairness), s.clusterRoute(true), s.idempotency(), s.logRawUploadHandler)
+	tenantAPI.POST("/upload/logstash", s.rejectWhenDraining(), s.verifyUploadSignature(signedByQuery), fairnessMiddleware(ingestFairness), s.clusterRoute(true), s.idempotency(), s.logstashUploadHandler)
+	tenantAPI.POST("/import", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), fairnessMiddleware(ingestFairness), s.clusterRoute(true), s.importHandler)
+	tenantAPI.POST("/upload/sessions", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), s.uploadSessionCreateHandler)
+	tenantAPI.GET("/upload/sessions/:id", s.clusterRouteSession(), s.uploadSessionStatusHandler)
+	tenantAPI.PUT("/upload/sessions/:id/chunks/:index", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), fairnessMiddleware(ingestFairness), s.clusterRouteSession(), s.uploadChunkHandler)
+	tenantAPI.POST("/upload/sessions/:id/complete", s.rejectWhenDraining(), s.verifyUploadSignature(unsignedUpload), fairnessMiddleware(ingestFairness), s.clusterRouteSession(), s.uploadSessionCompleteHandler)
+	tenantAPI.DELETE("/upload/sessions/:id", s.clusterRouteSession(), s.uploadSessionDeleteHandler)
+	tenantAPI.GET("/query", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.logQueryHandler)
+	tenantAPI.GET("/logs/:id", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.logGetHandler)
+	tenantAPI.GET("/tail", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.logTailHandler)
+	tenantAPI.GET("/tail/ws", fairnessMiddleware(queryFairness), s.logSubscribeHandler)
+	tenantAPI.GET("/aggregate", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.aggregateHandler)
+	tenantAPI.GET("/histogram", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.histogramHandler)
+	tenantAPI.GET("/errors/top", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.topErrorsHandler)
+	tenantAPI.GET("/applications/:application_id/files", s.clusterRoute(false), s.logFileListHandler)
+	tenantAPI.GET("/applications/:application_id/files/:date", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.logFileDownloadHandler)
+	tenantAPI.GET("/usage", s.tenantUsageHandler)
+
+	// 日志分析
+	router.GET("/analysis/findings", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.findingsHandler)
+	router.GET("/analysis/codes", s.findingCodesHandler)
+	router.GET("/analysis/schema", findingSchemaHandler)
+	router.GET("/analysis/lock-conflicts", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.lockConflictsHandler)
+	router.GET("/analysis/rollback-failures", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.rollbackFailuresHandler)
+	router.GET("/analysis/transaction-latency", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.transactionLatencyHandler)
+	router.GET("/analysis/timeouts", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.transactionTimeoutsHandler)
+	router.GET("/analysis/consistency", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.consistencyHandler)
+	router.GET("/analysis/compare", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.compareHandler)
+	router.GET("/analysis/retry-storms", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.retryStormsHandler)
+	router.GET("/errors/top", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.topErrorsHandler)
+
+	// Seata 控制台数据源
+	router.POST("/api/v1/auth/login", s.consoleLoginHandler)
+	router.GET("/api/v1/console/globalSession/query", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.consoleGlobalSessionHandler)
+	router.GET("/api/v1/console/globalLock/query", fairnessMiddleware(queryFairness), s.clusterRoute(false), s.queryGuard(), s.consoleGlobalLockHandler)
+
+	// 告警规则管理、回测与告警事件
+	router.GET("/alerts/rules", s.alertRulesListHandler)
+	router.POST("/alerts/rules", s.clusterBroadcast(), s.alertRulePutHandler)
+	router.DELETE("/alerts/rules/:name", s.clusterBroadcast(), s.alertRuleDeleteHandler)
+	router.POST("/alerts/rules/:name/enable", s.clusterBroadcast(), s.alertRuleEnableHandler(true))
+	router.POST("/alerts/rules/:name/disable", s.clusterBroadcast(), s.alertRuleEnableHandler(false))
+	router.POST("/alerts/rules/test", s.alertRuleTestHandler)
+	router.POST("/alerts/channels/test", s.alertChannelTestHandler)
+	router.GET("/alerts/events", s.alertEventsHandler)
+	router.GET("/events", s.eventStreamHandler)
+	router.GET("/alerts/anomalies", s.anomalyStatusHandler)
+	router.GET("/alerts/ingest-lag", s.ingestLagHandler)
+
+	// 定期报告与历史报告下载
+	router.GET("/reports", s.reportConfigListHandler)
+	router.GET("/reports/history", s.reportHistoryHandler)
+	router.GET("/reports/history/:id", s.reportGetHandler)
+	router.POST("/reports/:name/run", s.reportRunHandler)
+
+	// 定期任务的状态与手动执行
+	router.GET("/jobs", s.jobListHandler)
+	router.POST("/jobs/:name/run", s.jobRunHandler)
+
+	// 启用的插件及其事件投递
+	router.GET("/plugins", s.pluginListHandler)
+
+	// 临时视图
+	router.GET("/views", s.viewListHandler)
+	router.POST("/views", s.viewCreateHandler)
+	router.DELETE("/views/:name", s.viewDeleteHandler)
+
+	// 排障注记
+	router.GET("/annotations", s.annotationListHandler)
+	router.POST("/annotations", s.clusterBroadcast(), s.annotationCreateHandler)
+	router.DELETE("/annotations/:id", s.clusterBroadcast(), s.annotationDeleteHandler)
+
+	// 存储后端之间的数据迁移
+	router.GET("/admin/backends", s.backendListHandler)
+	router.GET("/admin/migrations", s.migrationListHandler)
+	router.POST("/admin/migrations", s.migrationCreateHandler)
+	router.GET("/admin/migrations/:id", s.migrationGetHandler)
+
+	// 写入失败的死信日志的查看、重放与删除
+	router.GET("/dead-letters", s.deadLetterListHandler)
+	router.POST("/dead-letters/replay", s.deadLetterReplayHandler)
+	router.DELETE("/dead-letters/:id", s.deadLetterDeleteHandler)
+
+	// 应用分组
+	router.GET("/groups", s.groupListHandler)
+	router.PUT("/groups", s.clusterBroadcast(), s.groupPutHandler)
+	router.DELETE("/groups/:name", s.clusterBroadcast(), s.groupDeleteHandler)
+
+	// 应用的日志 Schema
+	router.GET("/admin/schemas", s.schemaListHandler)
+	router.PUT("/admin/schemas", s.clusterBroadcast(), s.schemaPutHandler)
+	router.DELETE("/admin/schemas/*application_id", s.clusterBroadcast(), s.schemaDeleteHandler)
+
+	// 日志级别升级规则
+	router.GET("/admin/escalations", s.escalationListHandler)
+
+	// 按应用的纯文本行解析规则
+	router.GET("/admin/parsers", s.parserListHandler)
+	router.PUT("/admin/parsers", s.clusterBroadcast(), s.parserPutHandler)
+	router.DELETE("/admin/parsers/*application_id", s.clusterBroadcast(), s.parserDeleteHandler)
+
+	// 从日志派生的指标
+	router.GET("/admin/log-metrics", s.logMetricListHandler)
+	router.PUT("/admin/log-metrics", s.clusterBroadcast(), s.logMetricPutHandler)
+	router.DELETE("/admin/log-metrics/:name", s.clusterBroadcast(), s.logMetricDeleteHandler)
+
+	// 按应用的时间戳格式
+	router.GET("/admin/timestamp-formats", s.timestampFormatListHandler)
+	router.PUT("/admin/timestamp-formats", s.clusterBroadcast(), s.timestampFormatPutHandler)
+	router.DELETE("/admin/timestamp-formats/*application_id", s.clusterBroadcast(), s.timestampFormatDeleteHandler)
+
+	// 应用的生命周期状态（归档、法律保留、软删除）
+	router.GET("/admin/lifecycle", s.lifecycleListHandler)
+	router.PUT("/admin/lifecycle", s.clusterBroadcast(), s.lifecyclePutHandler)
+
+	// 按应用暂停和恢复写入
+	router.GET("/admin/ingest/pauses", s.ingestPauseListHandler)
+	router.PUT("/admin/ingest/pauses", s.clusterBroadcast(), s.ingestPauseHandler)
+	router.DELETE("/admin/ingest/pauses", s.clusterBroadcast(), s.ingestResumeHandler)
+
+	// 存储占用、保留策略与快照
+	router.GET("/admin/storage", s.storageUsageHandler)
+	router.GET("/admin/storage/prune/preview", s.prunePreviewHandler)
+	router.GET("/admin/retention", s.retentionHandler)
+	router.POST("/admin/retention/run", s.retentionRunHandler)
+	router.GET("/admin/snapshot", s.snapshotHandler)
+
+	// 日志文件与索引的校验和修复
+	router.GET("/admin/integrity", s.integrityHandler(false))
+	router.POST("/admin/integrity/quarantine", s.integrityHandler(true))
+	router.GET("/admin/indexes/verify", s.indexesHandler(false))
+	router.POST("/admin/indexes/rebuild", s.indexesHandler(true))
+
+	// 主备复制状态
+	router.GET("/admin/replication", s.replicationHandler)
+
+	// 按当前规则重新处理已存储的日志
+	router.POST("/admin/replay", s.replayHandler)
+
+	// 导出任务
+	router.GET("/admin/exports", s.exportListHandler)
+	router.POST("/admin/exports", s.exportCreateHandler)
+	router.GET("/admin/exports/:id", s.exportGetHandler)
+
+	// 按服务端路径导入历史日志
+	router.GET("/admin/imports", s.importListHandler)
+	router.POST("/admin/imports", s.importCreateHandler)
+	router.GET("/admin/imports/:id", s.importGetHandler)
+
+	// 用户与角色
+	router.GET("/auth/whoami", s.whoamiHandler)
+	router.GET("/admin/users", s.userListHandler)
+	router.POST("/admin/users", s.clusterBroadcast(), s.userCreateHandler)
+	router.PUT("/admin/users/:name/roles", s.clusterBroadcast(), s.userRolesHandler)
+	router.POST("/admin/users/:name/key", s.clusterBroadcast(), s.userKeyHandler)
+	router.DELETE("/admin/users/:name", s.clusterBroadcast(), s.userDeleteHandler)
+
+	// 接口访问审计记录
+	router.GET("/audit", s.auditHandler)
+
+	// 集群成员及应用归属
+	router.GET("/cluster/health", s.clusterHealthHandler)
+	router.GET("/cluster/members", s.clusterMembersHandler)
+	router.GET("/cluster/owner", s.clusterOwnerHandler)
+
+	// 运行时诊断，只允许管理员访问
+	debugAPI := router.Group("/debug", s.debugAuth())
+	debugAPI.GET("/stats", s.debugStatsHandler)
+	if s.cfg.Debug.Pprof {
+		debugAPI.GET("/pprof/*profile", pprofHandler)
+		debugAPI.POST("/pprof/*profile", pprofHandler)
+	}
+
+	// 运行指标与探针状态
+	router.GET("/metrics", s.metricsHandler)
+	router.GET("/probes", s.probeStatusHandler)
+
+	// 接口文档
+	router.GET("/docs", swaggerUIHandler)
+	router.GET("/docs/openapi.json", openAPIHandler(router))
+
+	// 网页面板
+	registerUI(router)
+	return router, nil
+}
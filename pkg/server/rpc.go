@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/parser"
+)
+
+// RPC 请求 ID 的关联：Dubbo、Spring Cloud 的调用方和被调用方通常都记录同一个请求 ID（requestId=、X-Request-Id: 等），
+// 按它把不同应用的日志串起来，定位由上游 RPC 错误引起的 Seata 分支失败
+const (
+	requestIDField = "request_id"
+	rpcSideField   = "rpc_side" // consumer 或 provider，从 Dubbo URL 的 side= 或 Feign 的 --->、<--- 识别
+)
+
+var (
+	requestIDPattern = parser.MustCompilePattern(`(?i)\b(?:x-)?req(?:uest)?[_\-.]?id\s*[=:]\s*\[?"?([0-9a-z][0-9a-z_\-.]{5,63})`)
+	rpcSidePattern   = parser.MustCompilePattern(`\bside=(consumer|provider)\b`)
+	feignPattern     = parser.MustCompilePattern(`(?:^|\s)(?:--->|<---)\s`)
+)
+
+// 从消息中提取请求 ID 和调用方向，放在自定义字段 request_id、rpc_side 中，上传时已提供的保留不变
+func extractRequestID(entry *LogData) {
+	id := entry.Fields[requestIDField]
+	if id == "" {
+		if m := requestIDPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+			id = m[1]
+		}
+	}
+	if id == "" {
+		return
+	}
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]string)
+	}
+	entry.Fields[requestIDField] = id
+	if entry.Fields[rpcSideField] != "" {
+		return
+	}
+	if m := rpcSidePattern.FindStringSubmatch(entry.LogMessage); m != nil {
+		entry.Fields[rpcSideField] = m[1]
+	} else if feignPattern.MatchString(entry.LogMessage) {
+		entry.Fields[rpcSideField] = "consumer"
+	}
+}
+
+// 请求经过的一个应用
+type requestHop struct {
+	ApplicationID string    `json:"application_id"`
+	Role          string    `json:"role"` // caller、callee 或 both（既被调用又调用下游）
+	FirstSeen     time.Time `json:"first_seen"`
+	Logs          int       `json:"logs"`
+	Errors        int       `json:"errors"` // ERROR 和 FATAL 级别的日志数
+}
+
+// 一个请求在各应用中的日志
+type requestLogs struct {
+	RequestID  string          `json:"request_id"`
+	Hops       []requestHop    `json:"hops"` // 按首次出现的时间排列
+	XIDs       []string        `json:"xids"` // 请求经过的全局事务
+	TraceIDs   []string        `json:"trace_ids"`
+	FirstError *TimelineEvent  `json:"first_error,omitempty"` // 最早的错误日志，通常是故障的源头
+	FirstSeen  time.Time       `json:"first_seen"`
+	LastSeen   time.Time       `json:"last_seen"`
+	DurationMs int64           `json:"duration_ms"`
+	Logs       []TimelineEvent `json:"logs"`
+}
+
+// 在一组应用中收集请求的日志，按时间升序排列
+func (s *Service) collectRequestLogs(ctx context.Context, requestID string, applicationIDs []string, from, to time.Time) (requestLogs, error) {
+	r := requestLogs{RequestID: requestID, Hops: []requestHop{}, XIDs: []string{}, TraceIDs: []string{}, Logs: []TimelineEvent{}}
+	xids := make(map[string]bool)
+	traces := make(map[string]bool)
+
+	visit := parsedLineVisitor(func(entry LogData, ref logRef) bool {
+		// 本功能之前写入的日志没有 request_id 字段，读取时再提取一次
+		if entry.Fields[requestIDField] == "" {
+			extractRequestID(&entry)
+		}
+		if entry.Fields[requestIDField] != requestID {
+			return true
+		}
+		at := entryTime(entry, ref)
+		if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+			return true
+		}
+		if xid := analysis.EntryXID(entry); xid != "" {
+			xids[xid] = true
+		}
+		if entry.TraceID != "" {
+			traces[entry.TraceID] = true
+		}
+		s.maskQueryEntry(&entry)
+		r.Logs = append(r.Logs, TimelineEvent{At: at, Entry: entry, Ref: ref})
+		return true
+	})
+	for _, appID := range applicationIDs {
+		// 先按原始行过滤，只解析包含请求 ID 的行
+		err := s.forEachStoredLineBetween(ctx, appID, from, to, func(line string, ref logRef) bool {
+			if !strings.Contains(line, requestID) {
+				return true
+			}
+			return visit(line, ref)
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return r, err
+		}
+	}
+
+	sort.SliceStable(r.Logs, func(i, j int) bool {
+		return timeOrderBefore(r.Logs[i].At, r.Logs[i].Entry, r.Logs[j].At, r.Logs[j].Entry)
+	})
+	r.XIDs = append(r.XIDs, sortedKeys(xids)...)
+	r.TraceIDs = append(r.TraceIDs, sortedKeys(traces)...)
+	if len(r.Logs) == 0 {
+		return r, nil
+	}
+	r.FirstSeen = r.Logs[0].At
+	r.LastSeen = r.Logs[len(r.Logs)-1].At
+	r.DurationMs = r.LastSeen.Sub(r.FirstSeen).Milliseconds()
+	r.Hops = requestHops(r.Logs)
+	for i := range r.Logs {
+		if levelRanks[r.Logs[i].Entry.LogLevel] >= levelRanks["ERROR"] {
+			r.FirstError = &r.Logs[i]
+			break
+		}
+	}
+	return r, nil
+}
+
+// 按应用汇总请求的日志。日志标明了 consumer 或 provider 时按之确定角色，
+// 否则最先记录该请求的应用视为调用方，其余为被调用方
+func requestHops(logs []TimelineEvent) []requestHop {
+	type sides struct{ consumer, provider bool }
+	index := make(map[string]int)
+	seen := make(map[string]*sides)
+	var hops []requestHop
+	for _, ev := range logs {
+		app := ev.Entry.ApplicationID
+		i, ok := index[app]
+		if !ok {
+			i = len(hops)
+			index[app] = i
+			hops = append(hops, requestHop{ApplicationID: app, FirstSeen: ev.At})
+			seen[app] = &sides{}
+		}
+		hops[i].Logs++
+		if levelRanks[ev.Entry.LogLevel] >= levelRanks["ERROR"] {
+			hops[i].Errors++
+		}
+		switch ev.Entry.Fields[rpcSideField] {
+		case "consumer":
+			seen[app].consumer = true
+		case "provider":
+			seen[app].provider = true
+		}
+	}
+	for i := range hops {
+		s := seen[hops[i].ApplicationID]
+		switch {
+		case s.consumer && s.provider:
+			hops[i].Role = "both"
+		case s.consumer:
+			hops[i].Role = "caller"
+		case s.provider:
+			hops[i].Role = "callee"
+		case i == 0:
+			hops[i].Role = "caller"
+		default:
+			hops[i].Role = "callee"
+		}
+	}
+	return hops
+}
+
+// 请求日志接口：按时间顺序返回某个 RPC 请求 ID 在调用方和被调用方的全部日志，
+// application_id 为空时搜索全部应用，指定 from 时只读取之后的分段
+func (s *Service) requestLogsHandler(c *gin.Context) {
+	requestID := c.Param("request_id")
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+
+	r, err := s.collectRequestLogs(c.Request.Context(), requestID, apps, from, to)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	if len(r.Logs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+	auditCount(c, len(r.Logs))
+	c.JSON(http.StatusOK, r)
+}
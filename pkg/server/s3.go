@@ -0,0 +1,233 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 最小的 S3 兼容对象存储客户端，使用 AWS Signature V4 签名，
+// 适用于 AWS S3、阿里云 OSS 的 S3 兼容接口和 MinIO
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	pathStyle bool
+	accessKey string
+	secretKey string
+	http      *http.Client
+}
+
+func newS3Client(c TieringConfig) (*s3Client, error) {
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid endpoint %q", c.Endpoint)
+	}
+	s := &s3Client{
+		endpoint:  endpoint,
+		region:    c.Region,
+		bucket:    c.Bucket,
+		pathStyle: c.PathStyle,
+		accessKey: c.AccessKey,
+		secretKey: c.SecretKey,
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	// 未在配置中写明密钥时使用标准的环境变量
+	if s.accessKey == "" {
+		s.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if s.secretKey == "" {
+		s.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("access_key and secret_key are required")
+	}
+	if s.http, err = newTLSHTTPClient(c.TLS, 10*time.Minute); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 上传对象，payloadHash 为内容的十六进制 SHA-256
+func (s *s3Client) Put(key string, body io.Reader, size int64, payloadHash string) error {
+	resp, err := s.do(http.MethodPut, key, body, size, payloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 下载对象，调用方负责关闭返回的 Body
+func (s *s3Client) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0, emptySHA256)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// 删除对象，对象不存在不视为错误
+func (s *s3Client) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, 0, emptySHA256)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 空内容的 SHA-256
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// 按范围下载对象中 [offset, offset+length) 的字节，调用方负责关闭返回的 Body。
+// 不支持 Range 的服务返回整个对象时跳过范围之前的部分
+func (s *s3Client) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	req, err := s.newRequest(http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := s.send(req, key, emptySHA256)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, length), resp.Body}, nil
+}
+
+func (s *s3Client) do(method, key string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := s.newRequest(method, key, body, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(req, key, payloadHash)
+}
+
+func (s *s3Client) newRequest(method, key string, body io.Reader, size int64) (*http.Request, error) {
+	u := *s.endpoint
+	path := "/" + key
+	if s.pathStyle {
+		path = "/" + s.bucket + path
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(s.endpoint.Path, "/") + path
+	u.RawPath = s3EscapePath(u.Path)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	return req, nil
+}
+
+// 签名并发送请求，非 2xx 响应（删除时的 404 除外）返回错误
+func (s *s3Client) send(req *http.Request, key, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 && !(req.Method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// 按 Signature V4 为请求签名，签名的头部为 host、x-amz-content-sha256 和 x-amz-date
+func (s *s3Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// 签名使用的查询字符串：参数按名称和值排序后编码，没有值的参数（如 ?lifecycle）写作 lifecycle=
+func s3CanonicalQuery(query url.Values) string {
+	var params []string
+	for _, k := range sortedKeys(query) {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// 按 S3 的规则编码路径：除未保留字符和 / 外全部百分号编码
+func s3EscapePath(path string) string {
+	return s3Escape(path, true)
+}
+
+// 除未保留字符（keepSlash 时还有 /）外全部百分号编码
+func s3Escape(text string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~", c) >= 0 || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+)
+
+// Seata SAGA 状态机引擎的日志，如：
+//
+//	Start StateMachine[reduceInventoryAndBalance] with businessKey[order-1001]
+//	>>>>>>>>>>>>>>>>>>>>>>Start to execute State[ReduceInventory], ServiceName[inventoryAction], Method[reduce], Input:[...]
+//	<<<<<<<<<<<<<<<<<<<<<< State[ReduceInventory], ServiceName[inventoryAction], Method[reduce] Execute finish. result: true
+//	<<<<<<<<<<<<<<<<<<<<<< State[ReduceBalance], ServiceName[balanceAction], Method[reduce] Execute failed.
+var (
+	sagaMachinePattern      = regexp.MustCompile(`(?i)\bstate ?machine\s*\[([^\]]+)\]`)
+	sagaStateStartPattern   = regexp.MustCompile(`(?i)\bstart(?:ed)?\s+(?:to\s+)?execut\w*\s+state\s*\[([^\]]+)\]`)
+	sagaStateEndPattern     = regexp.MustCompile(`(?i)\bstate\s*\[([^\]]+)\].*?\bexecute\s+(finish|failed)`)
+	sagaServicePattern      = regexp.MustCompile(`(?i)\bservice_?name\s*\[([^\]]*)\]`)
+	sagaMethodPattern       = regexp.MustCompile(`(?i)\bmethod\s*\[([^\]]*)\]`)
+	sagaTriggerPattern      = regexp.MustCompile(`(?i)compensation ?trigger|\b(?:start|begin)\w*\s+(?:to\s+)?compensat|\btrigger\w*\s+compensat`)
+	sagaStatusPattern       = regexp.MustCompile(`(?i)\b(compensation_?status|status)\s*[=:]\s*\[?(SU|FA|UN|RU|SK)\b`)
+	sagaBusinessKeyPattern  = regexp.MustCompile(`(?i)\bbusiness_?key\s*[=:]?\s*\[([^\]]+)\]|\bbusiness_?key\s*[=:]\s*([^\s,\]]+)`)
+	sagaMachineDonePattern  = regexp.MustCompile(`(?i)\bstate ?machine\b.*\b(?:finish|complete|end)(?:ed|s)?\b`)
+	sagaCompensationPattern = regexp.MustCompile(`(?i)^compensat`)
+)
+
+// SAGA 执行状态
+const (
+	sagaRunning            = "running"
+	sagaSucceeded          = "succeeded"
+	sagaFailed             = "failed"
+	sagaUnknown            = "unknown"
+	sagaCompensating       = "compensating" // 已触发补偿，补偿状态仍在执行
+	sagaCompensated        = "compensated"  // 补偿全部成功
+	sagaCompensationFailed = "compensation_failed"
+)
+
+// 状态机引擎记录的执行状态（ExecutionStatus）
+var sagaExecutionStatus = map[string]string{"SU": sagaSucceeded, "FA": sagaFailed, "UN": sagaUnknown, "RU": sagaRunning, "SK": sagaSucceeded}
+
+// 一次状态（State）的执行
+type sagaStateRun struct {
+	Name          string     `json:"name"`
+	Service       string     `json:"service,omitempty"`
+	Method        string     `json:"method,omitempty"`
+	Compensation  bool       `json:"compensation"` // 补偿状态
+	Status        string     `json:"status"`       // running、succeeded 或 failed
+	ApplicationID string     `json:"application_id"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	DurationMs    int64      `json:"duration_ms,omitempty"`
+	Error         string     `json:"error,omitempty"` // 执行期间的第一条错误日志
+	Ref           logRef     `json:"ref"`
+}
+
+// 正向执行停下的位置
+type sagaStopPoint struct {
+	State  string    `json:"state"`
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// 一次 SAGA 状态机执行的轨迹
+type sagaTrace struct {
+	Key                   string          `json:"key"` // 查询使用的业务键或 XID
+	BusinessKey           string          `json:"business_key,omitempty"`
+	XIDs                  []string        `json:"xids"`
+	StateMachine          string          `json:"state_machine,omitempty"`
+	ApplicationIDs        []string        `json:"application_ids"`
+	Status                string          `json:"status"`
+	States                []sagaStateRun  `json:"states"`
+	CompensationTriggered *time.Time      `json:"compensation_triggered,omitempty"`
+	StoppedAt             *sagaStopPoint  `json:"stopped_at,omitempty"` // 未成功完成时正向执行的最后一个状态
+	FirstSeen             time.Time       `json:"first_seen"`
+	LastSeen              time.Time       `json:"last_seen"`
+	DurationMs            int64           `json:"duration_ms"`
+	Events                []TimelineEvent `json:"events"`
+}
+
+// 在一组应用中收集业务键或 XID 相关的日志，按时间升序排列。按业务键查询时，
+// 再收集同一业务键所属 XID 的日志，状态执行日志通常只带 XID
+func (s *Service) collectSagaEvents(ctx context.Context, key string, applicationIDs []string) ([]TimelineEvent, []string, error) {
+	var events []TimelineEvent
+	seen := make(map[logRef]bool)
+	xids := make(map[string]bool)
+	collect := func(match func(line string) bool) error {
+		visit := parsedLineVisitor(func(entry LogData, ref logRef) bool {
+			if seen[ref] {
+				return true
+			}
+			seen[ref] = true
+			if xid := analysis.EntryXID(entry); xid != "" {
+				xids[xid] = true
+			}
+			s.maskQueryEntry(&entry)
+			events = append(events, TimelineEvent{At: entryTime(entry, ref), Entry: entry, Ref: ref})
+			return true
+		})
+		for _, appID := range applicationIDs {
+			err := s.forEachStoredLineBetween(ctx, appID, time.Time{}, time.Time{}, func(line string, ref logRef) bool {
+				if !match(line) {
+					return true
+				}
+				return visit(line, ref)
+			})
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := collect(func(line string) bool { return strings.Contains(line, key) }); err != nil {
+		return nil, nil, err
+	}
+	var more []string
+	for xid := range xids {
+		if !strings.Contains(xid, key) {
+			more = append(more, xid)
+		}
+	}
+	if len(more) > 0 {
+		err := collect(func(line string) bool {
+			for _, xid := range more {
+				if strings.Contains(line, xid) {
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return timeOrderBefore(events[i].At, events[i].Entry, events[j].At, events[j].Entry)
+	})
+	return events, sortedKeys(xids), nil
+}
+
+// 按时间顺序重建状态机的执行：各状态的开始和结束、补偿的触发，以及最终状态
+func buildSagaTrace(key string, events []TimelineEvent, xids []string) sagaTrace {
+	t := sagaTrace{Key: key, XIDs: xids, ApplicationIDs: []string{}, States: []sagaStateRun{}, Events: events}
+	apps := make(map[string]bool)
+	open := make(map[string][]int) // 状态名 → 未结束的执行
+	var status, compensationStatus string
+	done := false
+
+	for _, ev := range events {
+		msg := ev.Entry.LogMessage
+		apps[ev.Entry.ApplicationID] = true
+		if t.StateMachine == "" {
+			if m := sagaMachinePattern.FindStringSubmatch(msg); m != nil {
+				t.StateMachine = strings.TrimSpace(m[1])
+			}
+		}
+		if t.BusinessKey == "" {
+			if m := sagaBusinessKeyPattern.FindStringSubmatch(msg); m != nil {
+				t.BusinessKey = strings.TrimSpace(m[1] + m[2])
+			}
+		}
+		if m := sagaStatusPattern.FindStringSubmatch(msg); m != nil {
+			if strings.HasPrefix(strings.ToLower(m[1]), "compensation") {
+				compensationStatus = strings.ToUpper(m[2])
+			} else {
+				status = strings.ToUpper(m[2])
+			}
+		}
+		if sagaMachineDonePattern.MatchString(msg) {
+			done = true
+		}
+		if t.CompensationTriggered == nil && sagaTriggerPattern.MatchString(msg) {
+			at := ev.At
+			t.CompensationTriggered = &at
+		}
+
+		if m := sagaStateStartPattern.FindStringSubmatch(msg); m != nil {
+			run := sagaStateRun{Name: strings.TrimSpace(m[1]), Status: sagaRunning, ApplicationID: ev.Entry.ApplicationID, StartedAt: ev.At, Ref: ev.Ref}
+			run.Service, run.Method = sagaServiceMethod(msg)
+			run.Compensation = t.CompensationTriggered != nil || sagaCompensationPattern.MatchString(run.Name)
+			open[run.Name] = append(open[run.Name], len(t.States))
+			t.States = append(t.States, run)
+			continue
+		}
+		if m := sagaStateEndPattern.FindStringSubmatch(msg); m != nil {
+			name := strings.TrimSpace(m[1])
+			var run *sagaStateRun
+			if stack := open[name]; len(stack) > 0 {
+				run = &t.States[stack[len(stack)-1]]
+				open[name] = stack[:len(stack)-1]
+			} else {
+				// 开始日志在 DEBUG 级别，未必会记录
+				r := sagaStateRun{Name: name, ApplicationID: ev.Entry.ApplicationID, StartedAt: ev.At, Ref: ev.Ref}
+				r.Service, r.Method = sagaServiceMethod(msg)
+				r.Compensation = t.CompensationTriggered != nil || sagaCompensationPattern.MatchString(name)
+				t.States = append(t.States, r)
+				run = &t.States[len(t.States)-1]
+			}
+			at := ev.At
+			run.EndedAt = &at
+			run.DurationMs = at.Sub(run.StartedAt).Milliseconds()
+			run.Status = sagaSucceeded
+			if strings.EqualFold(m[2], "failed") {
+				run.Status = sagaFailed
+				if run.Error == "" && !strings.EqualFold(ev.Entry.LogLevel, "INFO") {
+					run.Error = msg
+				}
+			}
+			continue
+		}
+		// 错误日志归入同一应用中最近开始、仍在执行的状态
+		if level := strings.ToUpper(ev.Entry.LogLevel); level == "ERROR" || level == "FATAL" {
+			for i := len(t.States) - 1; i >= 0; i-- {
+				if run := &t.States[i]; run.Status == sagaRunning && run.ApplicationID == ev.Entry.ApplicationID {
+					if run.Error == "" {
+						run.Error = msg
+					}
+					break
+				}
+			}
+		}
+	}
+
+	t.ApplicationIDs = append(t.ApplicationIDs, sortedKeys(apps)...)
+	if len(events) > 0 {
+		t.FirstSeen = events[0].At
+		t.LastSeen = events[len(events)-1].At
+		t.DurationMs = t.LastSeen.Sub(t.FirstSeen).Milliseconds()
+	}
+	t.Status = sagaStatus(t, status, compensationStatus, done)
+
+	// 未成功完成时，正向执行停在最后一个执行的非补偿状态
+	if t.Status != sagaSucceeded {
+		for i := len(t.States) - 1; i >= 0; i-- {
+			if run := t.States[i]; !run.Compensation {
+				at := run.StartedAt
+				if run.EndedAt != nil {
+					at = *run.EndedAt
+				}
+				t.StoppedAt = &sagaStopPoint{State: run.Name, Status: run.Status, At: at, Error: run.Error}
+				break
+			}
+		}
+	}
+	return t
+}
+
+// 状态执行日志中的服务名和方法名
+func sagaServiceMethod(message string) (string, string) {
+	var service, method string
+	if m := sagaServicePattern.FindStringSubmatch(message); m != nil {
+		service = strings.TrimSpace(m[1])
+	}
+	if m := sagaMethodPattern.FindStringSubmatch(message); m != nil {
+		method = strings.TrimSpace(m[1])
+	}
+	return service, method
+}
+
+// 状态机的最终状态：优先使用引擎记录的执行状态和补偿状态，没有记录时按各状态的执行结果推断
+func sagaStatus(t sagaTrace, status, compensationStatus string, done bool) string {
+	switch compensationStatus {
+	case "SU":
+		return sagaCompensated
+	case "FA", "UN":
+		return sagaCompensationFailed
+	case "RU":
+		return sagaCompensating
+	}
+	if t.CompensationTriggered != nil {
+		result := sagaCompensated
+		for _, run := range t.States {
+			if !run.Compensation {
+				continue
+			}
+			if run.Status == sagaFailed {
+				return sagaCompensationFailed
+			}
+			if run.Status == sagaRunning {
+				result = sagaCompensating
+			}
+		}
+		if !done && result == sagaCompensated {
+			result = sagaCompensating
+		}
+		return result
+	}
+	if s, ok := sagaExecutionStatus[status]; ok {
+		return s
+	}
+	if len(t.States) == 0 {
+		return sagaUnknown
+	}
+	switch last := t.States[len(t.States)-1]; {
+	case last.Status == sagaFailed:
+		return sagaFailed
+	case last.Status == sagaRunning || !done:
+		return sagaRunning
+	}
+	return sagaSucceeded
+}
+
+// SAGA 执行轨迹接口：按业务键或 XID 重建状态机执行过的状态、触发的补偿和正向执行停下的位置，
+// application_id 为空时搜索全部应用
+func (s *Service) sagaTraceHandler(c *gin.Context) {
+	key := c.Param("key")
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+
+	events, xids, err := s.collectSagaEvents(c.Request.Context(), key, apps)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	if len(events) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saga not found"})
+		return
+	}
+	auditCount(c, len(events))
+	c.JSON(http.StatusOK, buildSagaTrace(key, events, xids))
+}
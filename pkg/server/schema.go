@@ -0,0 +1,464 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 按应用校验上传的日志：管理员为应用登记 JSON Schema，描述日志对象（如 fields 中必须有 pod、env，必须带 xid），
+// 不符合的日志按 mode 拒绝或写入时打上标记，保证下游分析拿到的字段可靠。
+// 只支持常用的校验关键字，登记时遇到不支持的关键字直接报错，避免误以为生效
+type AppSchema struct {
+	ApplicationID string          `json:"application_id" binding:"required"` // 租户应用为 租户/应用
+	Mode          string          `json:"mode"`                              // reject（默认）或 tag
+	Schema        json.RawMessage `json:"schema" binding:"required"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+
+	compiled *jsonSchema
+}
+
+// 校验方式
+const (
+	schemaReject = "reject"
+	schemaTag    = "tag" // 照常写入，在 fields 中记录第一处不符合的原因
+)
+
+// tag 模式下记录不符合原因的字段
+const schemaErrorField = "schema_error"
+
+var errSchemaViolation = errors.New("entry does not match the application schema")
+
+var schemaViolations = metrics.counter("schema_violations_total", "Uploaded entries not matching the application schema, by application and mode.")
+
+// 已登记的应用 Schema
+type schemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string]*AppSchema
+	path    string
+}
+
+func newSchemaRegistry(dataDir string) (*schemaRegistry, error) {
+	r := &schemaRegistry{schemas: make(map[string]*AppSchema), path: filepath.Join(dataDir, "schemas.json")}
+	if err := loadJSONFile(r.path, &r.schemas); err != nil {
+		return nil, err
+	}
+	for app, s := range r.schemas {
+		if err := s.compile(); err != nil {
+			return nil, fmt.Errorf("schema for %s: %v", app, err)
+		}
+	}
+	return r, nil
+}
+
+func (s *AppSchema) compile() error {
+	if s.Mode == "" {
+		s.Mode = schemaReject
+	}
+	if s.Mode != schemaReject && s.Mode != schemaTag {
+		return fmt.Errorf("mode must be %s or %s", schemaReject, schemaTag)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(s.Schema, &raw); err != nil {
+		return fmt.Errorf("invalid schema: %v", err)
+	}
+	compiled, err := compileJSONSchema(raw, "")
+	if err != nil {
+		return err
+	}
+	s.compiled = compiled
+	return nil
+}
+
+// 登记或替换应用的 Schema
+func (r *schemaRegistry) Put(s *AppSchema) error {
+	if err := s.compile(); err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[s.ApplicationID] = s
+	return saveJSONFile(r.path, r.schemas)
+}
+
+// 删除应用的 Schema
+func (r *schemaRegistry) Delete(applicationID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.schemas[applicationID]; !ok {
+		return false, nil
+	}
+	delete(r.schemas, applicationID)
+	return true, saveJSONFile(r.path, r.schemas)
+}
+
+func (r *schemaRegistry) List() []AppSchema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]AppSchema, 0, len(r.schemas))
+	for _, s := range r.schemas {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 按应用的 Schema 校验日志：reject 模式下不符合时返回 errSchemaViolation，tag 模式下在 fields 中记录原因
+func (r *schemaRegistry) Check(entry *LogData) error {
+	r.mu.RLock()
+	s, ok := r.schemas[entry.ApplicationID]
+	r.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	// 按写入后的 JSON 形式校验，租户前缀不属于日志内容
+	doc := *entry
+	doc.ApplicationID = model.BareApplicationID(doc.ApplicationID)
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	problem := s.compiled.validate(value, "")
+	if problem == "" {
+		return nil
+	}
+	schemaViolations.Add(1, "application_id", entry.ApplicationID, "mode", s.Mode)
+	if s.Mode == schemaReject {
+		return fmt.Errorf("%w: %s", errSchemaViolation, problem)
+	}
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]string)
+	}
+	entry.Fields[schemaErrorField] = problem
+	return nil
+}
+
+// 从校验错误中取出不符合的描述
+func schemaViolation(err error) string {
+	return strings.TrimPrefix(err.Error(), errSchemaViolation.Error()+": ")
+}
+
+// JSON Schema 的一个子集：type、enum、const、required、properties、additionalProperties、
+// items、minItems、maxItems、pattern、minLength、maxLength、minimum、maximum
+type jsonSchema struct {
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	required             []string
+	properties           map[string]*jsonSchema
+	additionalProperties *bool
+	items                *jsonSchema
+	minItems, maxItems   *int
+	pattern              *regexp.Regexp
+	minLength, maxLength *int
+	minimum, maximum     *float64
+}
+
+// 只起说明作用、不影响校验的关键字
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true, "examples": true,
+}
+
+func compileJSONSchema(raw interface{}, path string) (*jsonSchema, error) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object", schemaPath(path))
+	}
+	s := &jsonSchema{}
+	for key, v := range obj {
+		var err error
+		switch key {
+		case "type":
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, item := range t {
+					name, ok := item.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: type must be a string or an array of strings", schemaPath(path))
+					}
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, fmt.Errorf("%s: type must be a string or an array of strings", schemaPath(path))
+			}
+			for _, t := range s.types {
+				if !validSchemaType(t) {
+					return nil, fmt.Errorf("%s: unknown type %q", schemaPath(path), t)
+				}
+			}
+		case "enum":
+			if s.enum, ok = v.([]interface{}); !ok {
+				return nil, fmt.Errorf("%s: enum must be an array", schemaPath(path))
+			}
+		case "const":
+			s.constValue, s.hasConst = v, true
+		case "required":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: required must be an array of strings", schemaPath(path))
+			}
+			for _, item := range list {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: required must be an array of strings", schemaPath(path))
+				}
+				s.required = append(s.required, name)
+			}
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: properties must be an object", schemaPath(path))
+			}
+			s.properties = make(map[string]*jsonSchema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = compileJSONSchema(prop, joinSchemaPath(path, name)); err != nil {
+					return nil, err
+				}
+			}
+		case "additionalProperties":
+			allowed, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: additionalProperties must be a boolean", schemaPath(path))
+			}
+			s.additionalProperties = &allowed
+		case "items":
+			if s.items, err = compileJSONSchema(v, path+"[]"); err != nil {
+				return nil, err
+			}
+		case "minItems":
+			s.minItems, err = schemaCount(v, key, path)
+		case "maxItems":
+			s.maxItems, err = schemaCount(v, key, path)
+		case "minLength":
+			s.minLength, err = schemaCount(v, key, path)
+		case "maxLength":
+			s.maxLength, err = schemaCount(v, key, path)
+		case "pattern":
+			expr, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: pattern must be a string", schemaPath(path))
+			}
+			if s.pattern, err = regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern: %v", schemaPath(path), err)
+			}
+		case "minimum", "maximum":
+			n, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a number", schemaPath(path), key)
+			}
+			if key == "minimum" {
+				s.minimum = &n
+			} else {
+				s.maximum = &n
+			}
+		default:
+			if !schemaAnnotations[key] {
+				return nil, fmt.Errorf("%s: unsupported keyword %q", schemaPath(path), key)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func validSchemaType(t string) bool {
+	switch t {
+	case "string", "number", "integer", "boolean", "object", "array", "null":
+		return true
+	}
+	return false
+}
+
+func schemaCount(v interface{}, key, path string) (*int, error) {
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != math.Trunc(n) {
+		return nil, fmt.Errorf("%s: %s must be a non-negative integer", schemaPath(path), key)
+	}
+	count := int(n)
+	return &count, nil
+}
+
+func joinSchemaPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func schemaPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// 校验值，返回第一处不符合的描述，符合时返回空串
+func (s *jsonSchema) validate(v interface{}, path string) string {
+	if len(s.types) > 0 && !matchesSchemaType(v, s.types) {
+		return fmt.Sprintf("%s: must be %s", schemaPath(path), strings.Join(s.types, " or "))
+	}
+	if s.hasConst && !reflect.DeepEqual(v, s.constValue) {
+		return fmt.Sprintf("%s: must be %v", schemaPath(path), s.constValue)
+	}
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			found = found || reflect.DeepEqual(v, allowed)
+		}
+		if !found {
+			return fmt.Sprintf("%s: must be one of %v", schemaPath(path), s.enum)
+		}
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := value[name]; !ok {
+				return fmt.Sprintf("%s: missing required property %q", schemaPath(path), name)
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.properties[name]
+			if !ok {
+				if s.additionalProperties != nil && !*s.additionalProperties {
+					return fmt.Sprintf("%s: property %q is not allowed", schemaPath(path), name)
+				}
+				continue
+			}
+			if problem := prop.validate(value[name], joinSchemaPath(path, name)); problem != "" {
+				return problem
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(value) < *s.minItems {
+			return fmt.Sprintf("%s: must have at least %d items", schemaPath(path), *s.minItems)
+		}
+		if s.maxItems != nil && len(value) > *s.maxItems {
+			return fmt.Sprintf("%s: must have at most %d items", schemaPath(path), *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range value {
+				if problem := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); problem != "" {
+					return problem
+				}
+			}
+		}
+	case string:
+		n := len([]rune(value))
+		if s.minLength != nil && n < *s.minLength {
+			return fmt.Sprintf("%s: must be at least %d characters", schemaPath(path), *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			return fmt.Sprintf("%s: must be at most %d characters", schemaPath(path), *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			return fmt.Sprintf("%s: must match %s", schemaPath(path), s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && value < *s.minimum {
+			return fmt.Sprintf("%s: must be at least %v", schemaPath(path), *s.minimum)
+		}
+		if s.maximum != nil && value > *s.maximum {
+			return fmt.Sprintf("%s: must be at most %v", schemaPath(path), *s.maximum)
+		}
+	}
+	return ""
+}
+
+func matchesSchemaType(v interface{}, types []string) bool {
+	for _, t := range types {
+		switch value := v.(type) {
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && value == math.Trunc(value)) {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Schema 列表接口
+func (s *Service) schemaListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"schemas": s.schemas.List()})
+}
+
+// 登记或替换应用 Schema 接口
+func (s *Service) schemaPutHandler(c *gin.Context) {
+	var schema AppSchema
+	if err := c.ShouldBindJSON(&schema); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if tenant, app := model.SplitApplicationID(schema.ApplicationID); !validApplicationID(app) || (tenant != "" && !validApplicationID(tenant)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+	if err := s.schemas.Put(&schema); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schema saved", "schema": schema})
+}
+
+// 删除应用 Schema 接口，路径中的应用 ID 可以带租户前缀
+func (s *Service) schemaDeleteHandler(c *gin.Context) {
+	ok, err := s.schemas.Delete(strings.TrimPrefix(c.Param("application_id"), "/"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save schemas"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schema deleted"})
+}
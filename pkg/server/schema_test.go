@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fields 中须有 pod 和 env，env 取固定值，须带 XID
+const testAppSchema = `{
+	"type": "object",
+	"required": ["xid", "fields"],
+	"properties": {
+		"log_level": {"enum": ["INFO", "WARN", "ERROR"]},
+		"xid": {"type": "string", "pattern": "^[\\w.\\-]+:\\d+:\\d+$"},
+		"fields": {
+			"type": "object",
+			"required": ["pod", "env"],
+			"properties": {"env": {"enum": ["prod", "staging"]}, "pod": {"minLength": 3}}
+		}
+	}
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	var raw interface{}
+	if err := json.Unmarshal([]byte(testAppSchema), &raw); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compileJSONSchema(raw, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := `{"log_level":"ERROR","xid":"10.0.0.1:8091:123","fields":{"pod":"orders-1","env":"prod"}}`
+	for doc, want := range map[string]string{
+		valid: "",
+		`{"log_level":"ERROR","fields":{"pod":"orders-1","env":"prod"}}`:                           `(root): missing required property "xid"`,
+		`{"log_level":"TRACE","xid":"10.0.0.1:8091:123","fields":{"pod":"orders-1","env":"prod"}}`: "log_level: must be one of [INFO WARN ERROR]",
+		`{"log_level":"ERROR","xid":"not-a-xid","fields":{"pod":"orders-1","env":"prod"}}`:         `xid: must match ^[\w.\-]+:\d+:\d+$`,
+		`{"log_level":"ERROR","xid":"10.0.0.1:8091:123","fields":{"pod":"orders-1"}}`:              `fields: missing required property "env"`,
+		`{"log_level":"ERROR","xid":"10.0.0.1:8091:123","fields":{"pod":"o1","env":"prod"}}`:       "fields.pod: must be at least 3 characters",
+		`{"log_level":"ERROR","xid":123,"fields":{"pod":"orders-1","env":"prod"}}`:                 "xid: must be string",
+	} {
+		var value interface{}
+		if err := json.Unmarshal([]byte(doc), &value); err != nil {
+			t.Fatal(err)
+		}
+		if got := schema.validate(value, ""); got != want {
+			t.Errorf("validate(%s) = %q, want %q", doc, got, want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"type": "text"}`,
+		`{"properties": {"xid": {"pattern": "("}}}`,
+		`{"minLength": -1}`,
+		`[]`,
+	} {
+		var raw interface{}
+		json.Unmarshal([]byte(bad), &raw)
+		if _, err := compileJSONSchema(raw, ""); err == nil {
+			t.Errorf("compiled unsupported schema %s", bad)
+		}
+	}
+}
+
+// reject 模式拒绝不符合的上传并返回原因，tag 模式照常写入并在 fields 中记录原因
+func TestUploadSchemaRejectAndTag(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	router := newTestRouter(t, s)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	putSchema := func(app, mode string) {
+		t.Helper()
+		if w := do(http.MethodPut, "/admin/schemas", `{"application_id":"`+app+`","mode":"`+mode+`","schema":`+testAppSchema+`}`); w.Code != http.StatusOK {
+			t.Fatalf("PUT schema: %d %s", w.Code, w.Body)
+		}
+	}
+	putSchema("orders", "")
+	putSchema("payments", schemaTag)
+	if w := do(http.MethodPut, "/admin/schemas", `{"application_id":"stock","schema":{"anyOf":[]}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported keyword: status %d, want 400", w.Code)
+	}
+
+	at := time.Now().UTC().Format(time.RFC3339Nano)
+	entry := func(app, fields string) string {
+		return `{"application_id":"` + app + `","log_level":"ERROR","log_message":"branch rollback failed","timestamp":"` + at + `","xid":"10.0.0.1:8091:123","fields":` + fields + `}`
+	}
+
+	w := do(http.MethodPost, "/upload", entry("orders", `{"pod":"orders-1"}`))
+	var res map[string]any
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusUnprocessableEntity || res["violation"] != `fields: missing required property "env"` {
+		t.Fatalf("non-matching upload: %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/upload", entry("orders", `{"pod":"orders-1","env":"prod"}`)); w.Code != http.StatusOK {
+		t.Fatalf("matching upload: %d %s", w.Code, w.Body)
+	}
+
+	if w := do(http.MethodPost, "/upload", entry("payments", `{"pod":"pay-1"}`)); w.Code != http.StatusOK {
+		t.Fatalf("tag mode upload: %d %s", w.Code, w.Body)
+	}
+	hits, err := s.Query(context.Background(), Query{ApplicationIDs: []string{"payments"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || !strings.Contains(hits[0].Entry.Fields[schemaErrorField], `missing required property "env"`) {
+		t.Fatalf("tag mode stored %+v, want one entry with %s", hits, schemaErrorField)
+	}
+
+	if w := do(http.MethodDelete, "/admin/schemas/orders", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE schema: %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/upload", entry("orders", `{"pod":"orders-1"}`)); w.Code != http.StatusOK {
+		t.Fatalf("upload after deleting the schema: %d %s", w.Code, w.Body)
+	}
+}
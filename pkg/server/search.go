@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每条日志最多返回的命中位置数
+const maxHighlightMatches = 100
+
+// 摘要的长度（字符数），以及第一个命中之前保留的上下文长度
+const (
+	highlightSnippetRunes = 240
+	highlightContextRunes = 80
+)
+
+// 命中高亮的输出方式
+const (
+	highlightOffsets  = "offsets"  // 只返回命中在日志消息中的位置
+	highlightHTML     = "html"     // 另附 HTML 摘要，命中包在 <mark> 中，其余内容已转义
+	highlightMarkdown = "markdown" // 另附 Markdown 摘要，命中加粗，其余内容已转义
+)
+
+// 解析 q（关键字，不区分大小写）和 regex（RE2 正则）参数，都未指定时返回 nil
+func parseSearch(c *gin.Context) (*regexp.Regexp, bool) {
+	keyword, pattern := c.Query("q"), c.Query("regex")
+	if keyword != "" && pattern != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q and regex cannot be combined"})
+		return nil, false
+	}
+	if keyword != "" {
+		pattern = "(?i)" + regexp.QuoteMeta(keyword)
+	}
+	if pattern == "" {
+		return nil, true
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid regex: " + err.Error()})
+		return nil, false
+	}
+	return re, true
+}
+
+// 解析 highlight 参数，需要同时指定 q 或 regex；未指定时返回 nil
+func parseHighlight(c *gin.Context, search *regexp.Regexp) (*searchHighlighter, bool) {
+	mode := c.Query("highlight")
+	if mode == "" {
+		return nil, true
+	}
+	switch mode {
+	case highlightOffsets, highlightHTML, highlightMarkdown:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "highlight must be offsets, html or markdown"})
+		return nil, false
+	}
+	if search == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "highlight requires q or regex"})
+		return nil, false
+	}
+	return &searchHighlighter{re: search, mode: mode}, true
+}
+
+// 为查询结果中的日志标出命中
+type searchHighlighter struct {
+	re   *regexp.Regexp
+	mode string
+}
+
+// 一条日志的命中：Matches 为日志消息中命中的 [起, 止) 位置，按字符（Unicode 码点）计，
+// 只返回前 maxHighlightMatches 个；Snippet 为围绕第一个命中截取的摘要
+type searchHighlight struct {
+	Matches [][2]int `json:"matches"`
+	Snippet string   `json:"snippet,omitempty"`
+}
+
+func (h *searchHighlighter) Highlight(message string) searchHighlight {
+	hl := searchHighlight{Matches: [][2]int{}}
+	locs := h.re.FindAllStringIndex(message, maxHighlightMatches)
+	// 字节位置转换为字符位置
+	pos, runes := 0, 0
+	at := func(b int) int {
+		runes += utf8.RuneCountInString(message[pos:b])
+		pos = b
+		return runes
+	}
+	for _, loc := range locs {
+		if loc[0] == loc[1] {
+			continue
+		}
+		hl.Matches = append(hl.Matches, [2]int{at(loc[0]), at(loc[1])})
+	}
+	if h.mode != highlightOffsets {
+		hl.Snippet = h.snippet(message, hl.Matches)
+	}
+	return hl
+}
+
+// 截取摘要并标出其中的命中，超出摘要的部分以省略号表示
+func (h *searchHighlighter) snippet(message string, matches [][2]int) string {
+	chars := []rune(message)
+	start, end := 0, len(chars)
+	if end > highlightSnippetRunes {
+		if len(matches) > 0 {
+			start = max(0, matches[0][0]-highlightContextRunes)
+		}
+		end = min(len(chars), start+highlightSnippetRunes)
+		start = max(0, end-highlightSnippetRunes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	i := start
+	for _, m := range matches {
+		from, to := max(m[0], start), min(m[1], end)
+		if from >= to {
+			continue
+		}
+		b.WriteString(h.escape(string(chars[i:from])))
+		b.WriteString(h.mark(string(chars[from:to])))
+		i = to
+	}
+	b.WriteString(h.escape(string(chars[i:end])))
+	if end < len(chars) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// Markdown 中需要转义的字符
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `&lt;`, `>`, `&gt;`, `#`, `\#`, `|`, `\|`, "\n", " ", "\r", "",
+)
+
+func (h *searchHighlighter) escape(s string) string {
+	if h.mode == highlightMarkdown {
+		return markdownEscaper.Replace(s)
+	}
+	return html.EscapeString(s)
+}
+
+func (h *searchHighlighter) mark(s string) string {
+	if h.mode == highlightMarkdown {
+		return "**" + markdownEscaper.Replace(s) + "**"
+	}
+	return "<mark>" + html.EscapeString(s) + "</mark>"
+}
+
+// 在编码后的日志对象中加入 highlight 字段
+func (h *searchHighlighter) Append(data []byte, message string) []byte {
+	if h == nil || len(data) < 2 || data[len(data)-1] != '}' {
+		return data
+	}
+	hl, err := json.Marshal(h.Highlight(message))
+	if err != nil {
+		return data
+	}
+	out := append([]byte(nil), data[:len(data)-1]...)
+	if len(data) > 2 {
+		out = append(out, ',')
+	}
+	out = append(out, `"highlight":`...)
+	out = append(out, hl...)
+	return append(out, '}')
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 解析分析接口的 mode 参数（逗号分隔，不区分大小写），未指定时返回 nil
+func parseSeataModes(c *gin.Context) (map[string]bool, bool) {
+	var modes map[string]bool
+	for _, v := range splitList(c.Query("mode")) {
+		mode := parser.NormalizeMode(v)
+		if mode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown mode: " + v})
+			return nil, false
+		}
+		if modes == nil {
+			modes = make(map[string]bool)
+		}
+		modes[mode] = true
+	}
+	return modes, true
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// Seata 角色：TM、RM、TC，以及只能从依赖中看出是客户端、分不清 TM 和 RM 的 client
+const (
+	seataRoleTM     = "TM"
+	seataRoleRM     = "RM"
+	seataRoleTC     = "TC"
+	seataRoleClient = "client"
+)
+
+// 上传时可以直接给出版本和角色的自定义字段，优先于从消息中识别
+const (
+	seataVersionField = "seata_version"
+	seataRoleField    = "seata_role"
+)
+
+// 版本号，依赖名中的版本号后可能跟着 .jar
+const seataVersionExpr = `(\d+\.\d+\.\d+(?:-[A-Za-z0-9.]+?)?)(?:\.jar)?\b`
+
+var (
+	// 客户端注册成功时同时记录自己和 TC 的版本：register TM success. client version:1.5.2, server version:1.5.2,channel:...
+	seataRegisteredPattern = regexp.MustCompile(`(?i)\bregister (TM|RM) success\b.*?client version\s*:\s*` + seataVersionExpr + `.*?server version\s*:\s*` + seataVersionExpr)
+	// TC 记录客户端的注册：RM register success,message:RegisterRMRequest{..., applicationId='order', ...},channel:...,client version:1.5.2
+	seataClientRegisterPattern = regexp.MustCompile(`\b(TM|RM) register success\b.*?applicationId='([^']*)'.*?client version\s*:\s*` + seataVersionExpr)
+	// TC 启动日志中的版本：Seata server version: 1.6.1、seata-server v2.0.0
+	seataServerVersionPattern = regexp.MustCompile(`(?i)\bseata[ -]server\b.*?\bv(?:ersion)?\s*[:=]?\s*` + seataVersionExpr)
+	// 启动时打印的依赖：seata-all-1.4.2.jar、seata-spring-boot-starter-1.5.2
+	seataArtifactPattern = regexp.MustCompile(`\bseata-(server|all|spring-boot-starter|core|rm-datasource|tm)-` + seataVersionExpr)
+)
+
+// 从一条日志中识别出的版本
+type seataVersionHint struct {
+	role          string
+	version       string
+	serverVersion string // 客户端注册时 TC 返回的版本
+	client        string // TC 日志中注册的客户端应用
+}
+
+// 识别日志中的 Seata 版本，没有版本信息时 ok 为 false
+func detectSeataVersion(entry LogData) (h seataVersionHint, ok bool) {
+	if v := strings.TrimSpace(entry.Fields[seataVersionField]); v != "" {
+		role := strings.TrimSpace(entry.Fields[seataRoleField])
+		switch strings.ToUpper(role) {
+		case seataRoleTM, seataRoleRM, seataRoleTC:
+			role = strings.ToUpper(role)
+		default:
+			role = seataRoleClient
+		}
+		return seataVersionHint{role: role, version: strings.TrimPrefix(v, "v")}, true
+	}
+	msg := entry.LogMessage
+	// 绝大多数日志不含版本信息，先做廉价的检查
+	if !strings.Contains(msg, "version") && !strings.Contains(msg, "seata-") {
+		return h, false
+	}
+	if m := seataRegisteredPattern.FindStringSubmatch(msg); m != nil {
+		return seataVersionHint{role: strings.ToUpper(m[1]), version: m[2], serverVersion: m[3]}, true
+	}
+	if m := seataClientRegisterPattern.FindStringSubmatch(msg); m != nil {
+		return seataVersionHint{role: seataRoleTC, client: m[2], version: m[3]}, true
+	}
+	if m := seataServerVersionPattern.FindStringSubmatch(msg); m != nil {
+		return seataVersionHint{role: seataRoleTC, version: m[1]}, true
+	}
+	if m := seataArtifactPattern.FindStringSubmatch(msg); m != nil {
+		role := seataRoleClient
+		if m[1] == "server" {
+			role = seataRoleTC
+		}
+		return seataVersionHint{role: role, version: m[2]}, true
+	}
+	return h, false
+}
+
+// 某个角色最近识别出的版本
+type seataVersionSighting struct {
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"first_seen"` // 第一次识别出该版本的日志时间
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// 应用的 Seata 版本指纹
+type SeataFingerprint struct {
+	ApplicationID string                           `json:"application_id"`
+	Version       string                           `json:"version"`                  // 最近识别出的版本
+	Roles         map[string]*seataVersionSighting `json:"roles"`                    // 角色 → 版本
+	ServerVersion string                           `json:"server_version,omitempty"` // 作为客户端注册时 TC 返回的版本
+	Clients       map[string]string                `json:"clients,omitempty"`        // 作为 TC 时注册的客户端应用 → 客户端版本
+	UpdatedAt     time.Time                        `json:"updated_at"`
+}
+
+// 参与版本比较的一个版本来源
+type seataVersionRef struct {
+	ApplicationID string `json:"application_id"`
+	Role          string `json:"role"`
+	Version       string `json:"version"`
+	ReportedBy    string `json:"reported_by,omitempty"` // 从其他应用的日志中得知时为该应用
+}
+
+// 混用不同版本的提示
+type seataVersionWarning struct {
+	Message  string            `json:"message"`
+	Versions []seataVersionRef `json:"versions"`
+}
+
+// 各应用的 Seata 版本指纹，写入时从启动和注册日志中识别，只包含写入到本节点的日志
+type seataVersionRegistry struct {
+	events       *eventHub // 出现新的版本混用时推送系统事件
+	mu           sync.Mutex
+	fingerprints map[string]*SeataFingerprint
+	path         string
+	warned       map[string]string // 租户 → 上次提示混用时的版本系列
+}
+
+func newSeataVersionRegistry(dataDir string, events *eventHub) (*seataVersionRegistry, error) {
+	r := &seataVersionRegistry{events: events, fingerprints: make(map[string]*SeataFingerprint), path: filepath.Join(dataDir, "seata_versions.json"), warned: make(map[string]string)}
+	if err := loadJSONFile(r.path, &r.fingerprints); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 记录写入的日志中的版本信息。只有版本、角色或对端版本变化时才保存，出现新的混用时推送事件
+func (r *seataVersionRegistry) Observe(entry LogData) {
+	if r == nil {
+		return
+	}
+	h, ok := detectSeataVersion(entry)
+	if !ok {
+		return
+	}
+	at, ok := parser.ParseTime(entry.Timestamp, time.Now())
+	if !ok {
+		at = time.Now()
+	}
+	at = at.UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fp := r.fingerprints[entry.ApplicationID]
+	if fp == nil {
+		fp = &SeataFingerprint{ApplicationID: entry.ApplicationID, Roles: make(map[string]*seataVersionSighting)}
+		r.fingerprints[entry.ApplicationID] = fp
+	}
+	changed := false
+	// TC 日志中客户端的注册只说明本应用是 TC，版本属于客户端
+	if h.client != "" {
+		if fp.Clients == nil {
+			fp.Clients = make(map[string]string)
+		}
+		if fp.Clients[h.client] != h.version {
+			fp.Clients[h.client], changed = h.version, true
+		}
+	} else {
+		s := fp.Roles[h.role]
+		if s == nil || s.Version != h.version {
+			s, changed = &seataVersionSighting{Version: h.version, FirstSeen: at}, true
+			fp.Roles[h.role] = s
+		}
+		if at.After(s.LastSeen) {
+			s.LastSeen = at
+		}
+		if fp.Version != h.version && (fp.Version == "" || !at.Before(fp.latestSighting())) {
+			fp.Version, changed = h.version, true
+		}
+		if h.serverVersion != "" && fp.ServerVersion != h.serverVersion {
+			fp.ServerVersion, changed = h.serverVersion, true
+		}
+	}
+	if !changed {
+		return
+	}
+	fp.UpdatedAt = time.Now().UTC()
+	if err := saveJSONFile(r.path, r.fingerprints); err != nil {
+		log.Printf("unable to save seata versions: %v", err)
+	}
+	r.warnMixedLocked(entry.ApplicationID)
+}
+
+// 各角色中最近一次识别出版本的时间
+func (fp *SeataFingerprint) latestSighting() time.Time {
+	var last time.Time
+	for _, s := range fp.Roles {
+		if s.LastSeen.After(last) {
+			last = s.LastSeen
+		}
+	}
+	return last
+}
+
+// 同一租户的应用出现新的版本混用时推送事件，不同租户的 Seata 集群互不相关
+func (r *seataVersionRegistry) warnMixedLocked(applicationID string) {
+	tenant, _ := model.SplitApplicationID(applicationID)
+	var apps []string
+	for app := range r.fingerprints {
+		if t, _ := model.SplitApplicationID(app); t == tenant {
+			apps = append(apps, app)
+		}
+	}
+	w := mixedSeataVersions(r.snapshotLocked(apps))
+	if w == nil {
+		delete(r.warned, tenant)
+		return
+	}
+	lines := strings.Join(seataReleaseLines(w.Versions), ",")
+	if r.warned[tenant] == lines {
+		return
+	}
+	r.warned[tenant] = lines
+	log.Printf("mixed seata versions: %s", w.Message)
+	r.events.Publish(eventSeataVersion, applicationID, w.Message, w)
+}
+
+func (r *seataVersionRegistry) snapshotLocked(apps []string) []SeataFingerprint {
+	list := make([]SeataFingerprint, 0, len(apps))
+	for _, app := range apps {
+		fp, ok := r.fingerprints[app]
+		if !ok {
+			continue
+		}
+		c := *fp
+		c.Roles = make(map[string]*seataVersionSighting, len(fp.Roles))
+		for role, s := range fp.Roles {
+			copied := *s
+			c.Roles[role] = &copied
+		}
+		c.Clients = make(map[string]string, len(fp.Clients))
+		for client, v := range fp.Clients {
+			c.Clients[client] = v
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 这些应用的版本指纹，没有识别出版本的应用不包含在内
+func (r *seataVersionRegistry) Fingerprints(apps []string) []SeataFingerprint {
+	if r == nil {
+		return []SeataFingerprint{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshotLocked(apps)
+}
+
+// 版本系列（主版本.次版本），Seata 的 TM、RM 与 TC 不在同一系列时协议和配置可能不兼容
+func seataReleaseLine(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// 按版本号顺序排列的版本系列
+func seataReleaseLines(refs []seataVersionRef) []string {
+	seen := make(map[string]bool)
+	var lines []string
+	for _, ref := range refs {
+		if line := seataReleaseLine(ref.Version); !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return compareVersions(lines[i], lines[j]) < 0 })
+	return lines
+}
+
+// 按数字逐段比较版本号
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		var na, nb int
+		fmt.Sscanf(pa[i], "%d", &na)
+		fmt.Sscanf(pb[i], "%d", &nb)
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+// 比较 TM、RM、TC 的版本（包括客户端注册时得知的 TC 版本和 TC 记录的客户端版本），
+// 属于不同的版本系列时返回提示，否则返回 nil
+func mixedSeataVersions(fps []SeataFingerprint) *seataVersionWarning {
+	var refs []seataVersionRef
+	for _, fp := range fps {
+		for _, role := range sortedKeys(fp.Roles) {
+			refs = append(refs, seataVersionRef{ApplicationID: fp.ApplicationID, Role: role, Version: fp.Roles[role].Version})
+		}
+		if fp.ServerVersion != "" {
+			refs = append(refs, seataVersionRef{Role: seataRoleTC, Version: fp.ServerVersion, ReportedBy: fp.ApplicationID})
+		}
+		for _, client := range sortedKeys(fp.Clients) {
+			refs = append(refs, seataVersionRef{ApplicationID: client, Role: seataRoleClient, Version: fp.Clients[client], ReportedBy: fp.ApplicationID})
+		}
+	}
+	lines := seataReleaseLines(refs)
+	if len(lines) < 2 {
+		return nil
+	}
+	return &seataVersionWarning{
+		Message:  fmt.Sprintf("Seata versions from different release lines (%s) are mixed across TM/RM/TC", strings.Join(lines, ", ")),
+		Versions: refs,
+	}
+}
@@ -0,0 +1,411 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志文件滚动与压缩配置
+type RotationConfig struct {
+	MaxSegmentMB     int      `json:"max_segment_mb"`    // 当天的日志文件超过该大小时滚动到新分段，0 表示不按大小滚动
+	Compress         bool     `json:"compress"`          // 在后台压缩已关闭的分段
+	Codec            string   `json:"codec"`             // 压缩编码：gzip（默认）、zstd、lz4 或 none，存储类别可以单独指定
+	CompressInterval Duration `json:"compress_interval"` // 扫描待压缩分段的间隔，默认 1m
+}
+
+// 分段最后一次写入后至少经过该时长才会被压缩，避免与滚动前的写入竞争
+const compressGrace = time.Minute
+
+// 分段文件名：第 0 段沿用 2006-01-02.log，之后依次为 2006-01-02.1.log、2006-01-02.2.log
+func segmentFileName(day string, index int) string {
+	if index == 0 {
+		return day + ".log"
+	}
+	return day + "." + strconv.Itoa(index) + ".log"
+}
+
+// 解析分段文件名（不含压缩后缀），返回日期和分段序号
+func parseSegmentName(name string) (string, int, bool) {
+	base := strings.TrimSuffix(name, ".log")
+	if base == name || len(base) < len("2006-01-02") {
+		return "", 0, false
+	}
+	day, rest := base[:len("2006-01-02")], base[len("2006-01-02"):]
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		return "", 0, false
+	}
+	if rest == "" {
+		return day, 0, true
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(rest, "."))
+	if err != nil || rest[0] != '.' || index <= 0 {
+		return "", 0, false
+	}
+	return day, index, true
+}
+
+// 列出应用目录中的日志分段，按日期和分段序号排序。
+// 返回的是逻辑文件名（不含压缩和 .tiered 后缀），压缩和分层前后日志引用保持不变
+func listSegments(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(files))
+	var names []string
+	for _, file := range files {
+		if file.IsDir() || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		name := trimCompressedSuffix(strings.TrimSuffix(file.Name(), tieredSuffix))
+		// 压缩或上传过程中原文件、压缩文件和占位文件会短暂并存
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		di, ii, oki := parseSegmentName(names[i])
+		dj, ij, okj := parseSegmentName(names[j])
+		if !oki || !okj || di != dj {
+			return names[i] < names[j]
+		}
+		return ii < ij
+	})
+	return names, nil
+}
+
+// 打开分段，原文件不存在时按后缀透明地解压压缩文件，或从对象存储取回已分层的分段
+func (s *Service) openSegment(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return file, err
+	}
+
+	for _, p := range compressedPaths(path) {
+		rc, zErr := openCompressedFile(p)
+		if zErr == nil || !errors.Is(zErr, os.ErrNotExist) {
+			return rc, zErr
+		}
+	}
+	if s.tiering != nil {
+		if rc, ok, tierErr := s.tiering.open(path); ok {
+			return rc, tierErr
+		}
+	}
+	return nil, err
+}
+
+// 按偏移读取分段中的行。普通文件直接定位，压缩文件只能顺序解压，向后跳转时重新打开
+type segmentReader struct {
+	svc    *Service
+	path   string
+	rc     io.ReadCloser
+	reader *bufio.Reader
+	pos    int64
+}
+
+func (r *segmentReader) lineAt(offset int64) (string, error) {
+	if r.rc != nil && offset < r.pos {
+		if _, ok := r.rc.(*os.File); !ok {
+			r.Close()
+		}
+	}
+	if r.rc == nil {
+		rc, err := r.svc.openSegment(r.path)
+		if err != nil {
+			return "", err
+		}
+		r.rc, r.reader, r.pos = rc, bufio.NewReader(rc), 0
+	}
+	if file, ok := r.rc.(*os.File); ok && offset != r.pos {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		r.reader.Reset(file)
+		r.pos = offset
+	}
+
+	if err := r.skip(offset - r.pos); err != nil {
+		return "", err
+	}
+	line, err := r.reader.ReadString('\n')
+	r.pos += int64(len(line))
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return r.svc.encryption.Open(r.path, strings.TrimRight(line, "\r\n")), nil
+}
+
+// 跳过 n 个字节
+func (r *segmentReader) skip(n int64) error {
+	for n > 0 {
+		chunk := n
+		if chunk > 1<<20 {
+			chunk = 1 << 20
+		}
+		skipped, err := r.reader.Discard(int(chunk))
+		r.pos += int64(skipped)
+		n -= int64(skipped)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *segmentReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc, r.reader = nil, nil
+	return err
+}
+
+// 当前写入的分段，超过大小上限时滚动到下一个分段。class 不为空时为路由到该存储类别的日志单独使用的分段，
+// 分段文件位于类别的目录中，应用目录中的同名链接指向它；类别的分段不使用第 0 段
+func (s *fileStore) activeSegment(appFolder, day, class string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := filepath.Join(appFolder, day)
+	if class != "" {
+		key += "@" + class
+	}
+	index, ok := s.active[key]
+	if !ok {
+		// 重启后从目录中找回当天该类别的最后一个分段
+		names, err := listSegments(appFolder)
+		if err != nil {
+			return "", err
+		}
+		index = -1
+		for _, name := range names {
+			d, i, ok := parseSegmentName(name)
+			if !ok || d != day || i <= index {
+				continue
+			}
+			if c, linked := s.svc.storageRouting.ClassOf(filepath.Join(appFolder, name), s.svc.storageVolumes); c == class && (class != "" || !linked) {
+				index = i
+			}
+		}
+		if index < 0 && class == "" {
+			index = 0
+		} else if index < 0 {
+			if index, err = s.nextSegmentIndex(appFolder, day); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	path := filepath.Join(appFolder, segmentFileName(day, index))
+	info, err := os.Stat(path)
+	if (err == nil && s.rotation.MaxSegmentMB > 0 && info.Size() >= int64(s.rotation.MaxSegmentMB)<<20) || (err != nil && segmentSealed(path)) {
+		if index, err = s.nextSegmentIndex(appFolder, day); err != nil {
+			return "", err
+		}
+		path = filepath.Join(appFolder, segmentFileName(day, index))
+	}
+	if class != "" {
+		if err := s.linkClassSegment(path, class); err != nil {
+			return "", err
+		}
+	}
+	s.active[key] = index
+	return path, nil
+}
+
+// 当天下一个未使用的分段序号，各存储类别的分段共用同一序列
+func (s *fileStore) nextSegmentIndex(appFolder, day string) (int, error) {
+	names, err := listSegments(appFolder)
+	if err != nil {
+		return 0, err
+	}
+	top := 0
+	for _, name := range names {
+		if d, i, ok := parseSegmentName(name); ok && d == day && i > top {
+			top = i
+		}
+	}
+	prefix := filepath.Join(appFolder, day)
+	for key, i := range s.active {
+		if (key == prefix || strings.HasPrefix(key, prefix+"@")) && i > top {
+			top = i
+		}
+	}
+	return top + 1, nil
+}
+
+// 在应用目录中创建指向存储类别目录中分段文件的链接，分段文件在第一次写入时创建
+func (s *fileStore) linkClassSegment(path, class string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	dir := s.svc.storageRouting.classDir(class, s.backend, filepath.Base(filepath.Dir(path)))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	err := os.Symlink(filepath.Join(dir, filepath.Base(path)), path)
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 分段已被压缩或上传到对象存储，原文件不复存在
+func segmentSealed(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return false
+	}
+	if p, _ := compressedSegmentPath(path); p != "" {
+		return true
+	}
+	_, err := os.Stat(path + tieredSuffix)
+	return err == nil
+}
+
+// 压缩所有已关闭的分段：早于今天的分段，以及今天已滚动走的分段
+func (s *fileStore) compressClosedSegments(now time.Time) error {
+	apps, err := os.ReadDir(s.root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	today := now.Format("2006-01-02")
+	for _, app := range apps {
+		if !app.IsDir() || !s.svc.cluster.OwnsFolder(s.backend, app.Name()) {
+			continue
+		}
+		appFolder := filepath.Join(s.root, app.Name())
+		names, err := listSegments(appFolder)
+		if err != nil {
+			return err
+		}
+
+		// 每天每个存储类别的最后一个分段可能仍在写入
+		last := make(map[string]int)
+		classes := make(map[string]string, len(names))
+		for _, name := range names {
+			day, index, ok := parseSegmentName(name)
+			if !ok {
+				continue
+			}
+			class, _ := s.svc.storageRouting.ClassOf(filepath.Join(appFolder, name), s.svc.storageVolumes)
+			classes[name] = class
+			if key := day + "@" + class; index >= last[key] {
+				last[key] = index
+			}
+		}
+		for _, name := range names {
+			day, index, ok := parseSegmentName(name)
+			class := classes[name]
+			if !ok || (day >= today && index == last[day+"@"+class]) {
+				continue
+			}
+			codec := s.svc.storageRouting.codec(class, s.rotation)
+			if codec == nil {
+				continue
+			}
+			path := filepath.Join(appFolder, name)
+			info, err := os.Stat(path)
+			if err != nil || now.Sub(info.ModTime()) < compressGrace {
+				continue
+			}
+			if err := compressFile(path, codec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 压缩文件并删除原文件。路由到存储类别的分段压缩链接指向的文件，
+// 应用目录中的链接随之换成指向压缩文件的链接
+func compressFile(path string, codec *segmentCodec) error {
+	target, err := os.Readlink(path)
+	if err != nil {
+		if err := compressFileWith(path, codec); err != nil {
+			return err
+		}
+		return os.Remove(path)
+	}
+	if err := compressFileWith(target, codec); err != nil {
+		return err
+	}
+	if err := os.Symlink(target+codec.suffix, path+codec.suffix); err != nil && !os.IsExist(err) {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return os.Remove(target)
+}
+
+// 后台压缩已关闭分段的任务
+type segmentCompressor struct {
+	stores []*fileStore
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// 启动后台压缩，未开启压缩且没有需要压缩的存储类别时返回 nil
+func (s *Service) startSegmentCompressor(r *backendRegistry, c RotationConfig) *segmentCompressor {
+	if !c.Compress && !s.storageRouting.anyCompresses() {
+		return nil
+	}
+	interval := time.Duration(c.CompressInterval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	sc := &segmentCompressor{stop: make(chan struct{})}
+	for _, name := range r.Names() {
+		if store, _, _ := r.Store(name); store != nil {
+			if fs, ok := store.(*fileStore); ok {
+				sc.stores = append(sc.stores, fs)
+			}
+		}
+	}
+
+	sc.wg.Add(1)
+	go func() {
+		defer sc.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, fs := range sc.stores {
+				if err := fs.compressClosedSegments(time.Now()); err != nil {
+					log.Printf("segment compression in %s failed: %v", fs.root, err)
+				}
+			}
+			select {
+			case <-sc.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return sc
+}
+
+// 停止后台压缩，等待正在进行的压缩完成
+func (sc *segmentCompressor) Close() error {
+	close(sc.stop)
+	sc.wg.Wait()
+	return nil
+}
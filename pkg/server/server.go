@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+)
+
+// HTTP 服务的连接参数。默认值下慢速客户端可以无限期占用连接，采集代理长期保持大量连接时
+// 需要按部署环境调整。read_timeout 和 write_timeout 作用于整个请求，会中断 /tail 等长连接，
+// 默认不限制；只限制读取请求头的 read_header_timeout 对长连接没有影响
+type ServerConfig struct {
+	ReadTimeout       Duration `json:"read_timeout"`        // 读取整个请求（含请求体）的最长时间，默认不限制
+	ReadHeaderTimeout Duration `json:"read_header_timeout"` // 读取请求头的最长时间，默认 10s
+	WriteTimeout      Duration `json:"write_timeout"`       // 从读完请求头到写完响应的最长时间，默认不限制
+	IdleTimeout       Duration `json:"idle_timeout"`        // keep-alive 连接空闲多久后关闭，默认 2m
+	KeepAlive         *bool    `json:"keep_alive"`          // 是否复用 HTTP/1.1 连接，默认 true
+	TCPKeepAlive      Duration `json:"tcp_keep_alive"`      // TCP keep-alive 探测间隔，默认 15s，负值关闭
+	MaxHeaderBytes    int      `json:"max_header_bytes"`    // 请求头的大小上限，默认 1 MiB
+	MaxConnections    int      `json:"max_connections"`     // 同时打开的连接数上限，超出的连接等待已有连接关闭，默认不限制
+
+	HTTP2                string `json:"http2"`                  // auto（默认，仅 HTTPS）、h2c（明文也支持 HTTP/2）或 off
+	MaxConcurrentStreams int    `json:"max_concurrent_streams"` // 每个 HTTP/2 连接的并发流上限，默认 250
+}
+
+func (c ServerConfig) validate() error {
+	if c.ReadTimeout < 0 || c.ReadHeaderTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		return fmt.Errorf("server timeouts must not be negative")
+	}
+	if c.MaxHeaderBytes < 0 || c.MaxConnections < 0 || c.MaxConcurrentStreams < 0 {
+		return fmt.Errorf("max_header_bytes, max_connections and max_concurrent_streams must not be negative")
+	}
+	switch c.HTTP2 {
+	case "", "auto", "h2c", "off":
+	default:
+		return fmt.Errorf("unsupported http2 mode %q", c.HTTP2)
+	}
+	return nil
+}
+
+// 按配置创建 HTTP 服务，tlsConfig 为 nil 时提供明文 HTTP
+func newHTTPServer(c ServerConfig, addr string, handler http.Handler, tlsConfig *tls.Config) (*http.Server, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       time.Duration(c.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(c.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(c.WriteTimeout),
+		IdleTimeout:       time.Duration(c.IdleTimeout),
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+	if srv.ReadHeaderTimeout == 0 {
+		srv.ReadHeaderTimeout = 10 * time.Second
+	}
+	if srv.IdleTimeout == 0 {
+		srv.IdleTimeout = 2 * time.Minute
+	}
+	if c.KeepAlive != nil && !*c.KeepAlive {
+		srv.SetKeepAlivesEnabled(false)
+	}
+
+	h2 := &http2.Server{MaxConcurrentStreams: uint32(c.MaxConcurrentStreams), IdleTimeout: srv.IdleTimeout}
+	switch {
+	case c.HTTP2 == "off":
+		// 非 nil 的空表关闭 HTTPS 上的 HTTP/2 协商
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	case c.HTTP2 == "h2c" && tlsConfig == nil:
+		srv.Handler = h2c.NewHandler(handler, h2)
+	}
+	if tlsConfig != nil {
+		// ConfigureServer 会改写 NextProtos，复制一份，避免影响 forward 和 gRPC 输入共用的配置
+		srv.TLSConfig = tlsConfig.Clone()
+		if c.HTTP2 != "off" {
+			if err := http2.ConfigureServer(srv, h2); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return srv, nil
+}
+
+// 按配置监听服务地址
+func listenHTTP(c ServerConfig, addr string) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: time.Duration(c.TCPKeepAlive)}
+	ln, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxConnections > 0 {
+		ln = netutil.LimitListener(ln, c.MaxConnections)
+	}
+	return ln, nil
+}
@@ -0,0 +1,398 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/plugin"
+	"logAnalysis/pkg/storage"
+)
+
+// Service 是日志分析引擎：写入、查询、事务与诊断、分析器发现，与对应接口的行为一致。
+// 其他 Go 程序可以直接嵌入：
+//
+//	svc, err := server.OpenFile("config.json")
+//	if err != nil { ... }
+//	defer svc.Close()
+//	results, err := svc.Ingest(entries)
+//
+// 引擎的全部组件都属于 Service，一个进程中可以同时打开多个使用不同数据目录和存储根目录的 Service，
+// 只有 /metrics 的指标是进程级的，多个 Service 的计数合计在一起。租户、用户、审计、探针和上传签名只在 HTTP 服务中生效
+type Service struct {
+	cfg       Config
+	startedAt time.Time
+
+	// 存储
+	tenants         *tenantRegistry
+	encryption      *lineCipher
+	storageRouting  *storageRouter
+	storageVolumes  *volumeSet
+	fileHandles     *fileHandleCache
+	backends        *backendRegistry
+	durability      *fileSyncer
+	logIDs          *logIDAllocator
+	ingestSeq       ingestSequence
+	tiering         *segmentTierer
+	histogramCounts *countIndex
+	xidBlooms       *xidBloomIndex
+	queryCache      *segmentCache
+	diskQuotas      *diskQuotaManager
+	lifecycle       *lifecycleRegistry
+	retention       *retentionManager
+	cluster         *clusterState // 未启用集群时为 nil，此时所有应用都归属本节点
+
+	// 写入
+	deadLetters      *deadLetterStore
+	schemas          *schemaRegistry
+	groups           *groupRegistry
+	parsers          *parserRegistry
+	timestampFormats *timestampFormatRegistry
+	pipeline         ingestPipeline
+	escalations      escalationRules
+	jsonMessages     *jsonMessageParser
+	tcNodes          *tcNodeTagger
+	dedup            *dedupCache // 未启用去重时为 nil
+	uploadLimits     UploadLimitsConfig
+	ingestWorkers    *ingestPool
+	ingestPending    atomic.Int64 // 正在写入的日志条数，包括等待应用写锁的
+	ingestPauses     *ingestPauseRegistry
+	writeLatency     *writeLatencyTracker
+	ingestLag        *ingestLagTracker
+	imports          *importManager
+	migrations       *migrationManager
+	outputs          *outputSet
+	replication      *replicator
+	replica          *replicaReceiver
+	customStores     map[string]storage.QueryStore // WithStore 注入的后端，名称 → 后端
+
+	// 查询与分析
+	queryMaskRules []maskRule // 查询时的脱敏规则，用于启用写入脱敏之前已经落盘的日志
+	queryLimits    *queryLimiter
+	analyzers      map[string]func() analysis.Analyzer
+	seataVersions  *seataVersionRegistry
+	logMetrics     *logMetricRegistry
+	annotations    *annotationStore
+	viewStore      *ViewStore
+	exports        *exportManager
+	tailHub        *TailHub
+	systemEvents   *eventHub
+
+	// 告警与定期任务
+	alertEngine *AlertEngine
+	retryStorms *retryStormDetector
+	anomalies   *anomalyDetector
+	plugins     *pluginManager
+	reports     *reportScheduler
+	jobs        *jobScheduler
+
+	// 只在 HTTP 服务中使用
+	users          *userRegistry
+	netPolicy      *networkPolicy
+	uploadSessions *uploadSessionStore
+	uploadSigning  *uploadSigner
+	audit          *auditLog
+	probeRunner    *ProbeRunner
+
+	// 停机状态：draining 后不再接收新的上传，shuttingDown 关闭后长连接（如实时推送）主动结束
+	draining      atomic.Bool
+	shuttingDown  chan struct{}
+	shutdownMu    sync.Mutex
+	shutdownHooks []shutdownHook
+	drainOnce     sync.Once
+	closeOnce     sync.Once
+	closeErr      error // 清理函数的错误，closeOnce 之后可读
+}
+
+// 按配置创建尚未初始化组件的 Service，openEngine 之前只有配置和不依赖配置的组件可用
+func newService(c Config) *Service {
+	s := &Service{
+		cfg:          c,
+		startedAt:    time.Now(),
+		uploadLimits: UploadLimitsConfig{MaxBodyMB: 16, MaxMessageBytes: 1 << 20, MaxLevelLength: 32},
+		queryLimits:  &queryLimiter{},
+		analyzers:    builtinAnalyzers(c),
+		viewStore:    &ViewStore{views: make(map[string]*logView)},
+		tailHub:      &TailHub{subs: make(map[*tailSubscriber]struct{})},
+		systemEvents: &eventHub{subs: make(map[chan SystemEvent]struct{}), throttled: make(map[string]time.Time)},
+		users:        &userRegistry{},
+		netPolicy:    &networkPolicy{},
+		shuttingDown: make(chan struct{}),
+	}
+	s.tenants = newTenantRegistry(nil, s.systemEvents)
+	s.imports = &importManager{svc: s, jobs: make(map[string]*importJob)}
+	s.migrations = &migrationManager{svc: s, jobs: make(map[string]*migrationJob), active: make(map[string]string)}
+	return s
+}
+
+// 时间范围内没有该 XID 的日志
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// 写入结果中的错误，可用 errors.Is 判断
+var (
+	ErrIngestQueueFull     = errIngestQueueFull
+	ErrInvalidTimestamp    = errInvalidTimestamp
+	ErrSchemaViolation     = errSchemaViolation
+	ErrDiskQuotaExceeded   = errDiskQuotaExceeded
+	ErrApplicationReadOnly = errApplicationReadOnly
+	ErrIngestPaused        = errIngestPaused
+)
+
+// 默认配置，与不带配置文件启动服务时相同
+func DefaultConfig() Config {
+	return defaultConfig()
+}
+
+// 打开 Service 时的选项
+type Option func(*Service)
+
+// 登记只属于这个 Service 的分析器，与插件提供的分析器一样可以在 Findings 和 /analysis/findings 中按名称选用，
+// 与内置分析器同名时替换内置分析器
+func WithAnalyzer(name string, newAnalyzer func() plugin.Analyzer) Option {
+	return func(s *Service) {
+		s.analyzers[name] = func() analysis.Analyzer { return &pluginAnalyzer{inner: newAnalyzer()} }
+	}
+}
+
+// 登记直接实现 analysis.Analyzer 的分析器，发现原样输出，不经插件格式转换，其余与 WithAnalyzer 相同；
+// 与内置分析器同名时替换内置分析器
+func WithNativeAnalyzer(name string, newAnalyzer func() analysis.Analyzer) Option {
+	return func(s *Service) {
+		s.analyzers[name] = newAnalyzer
+	}
+}
+
+// 以名称注入存储后端，与 clickhouse 后端一样自行执行查询和遍历。backends 配置中同名的 custom 后端
+// 按其 applications 默认放置应用，没有配置时只能通过迁移接口放置；后端实现 io.Closer 时随 Service 关闭
+func WithStore(name string, store storage.QueryStore) Option {
+	return func(s *Service) {
+		if s.customStores == nil {
+			s.customStores = make(map[string]storage.QueryStore)
+		}
+		s.customStores[name] = store
+	}
+}
+
+// 读取配置文件并打开引擎，文件不存在时使用默认配置
+func OpenFile(path string, opts ...Option) (*Service, error) {
+	c, err := loadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load config: %w", err)
+	}
+	return Open(c, opts...)
+}
+
+// 按配置打开引擎，读取已有的数据目录和存储根目录。初始化失败时关闭已经打开的组件
+func Open(c Config, opts ...Option) (*Service, error) {
+	s := newService(c)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.openEngine(); err != nil {
+		s.runShutdownHooks()
+		return nil, err
+	}
+	return s, nil
+}
+
+// 与服务停机相同：拒绝新的上传，结束 /tail、/tail/ws 和 /events 等长连接，写完队列中的日志，刷新缓冲并关闭全部组件。
+// 返回各组件关闭时的错误，重复调用返回相同的结果
+func (s *Service) Close() error {
+	return s.shutdown()
+}
+
+// 写入一组日志，逐条校验，一条日志被拒绝不影响其他日志。结果与 entries 一一对应，与 /upload/batch?partial=true 的 results 相同；
+// 写入队列已满时等待
+func (s *Service) Ingest(entries []model.LogData) ([]EntryResult, error) {
+	now := time.Now()
+	results := make([]EntryResult, len(entries))
+	batch := make([]LogData, 0, len(entries))
+	positions := make([]int, 0, len(entries))
+	for i, entry := range entries {
+		if err := s.checkServiceEntry(&entry, now); err != nil {
+			results[i] = rejectedEntry(i, err)
+			continue
+		}
+		batch = append(batch, entry)
+		positions = append(positions, i)
+	}
+	if len(batch) > 0 {
+		written, err := s.submitEntries(batch, true, true)
+		if err != nil {
+			return nil, err
+		}
+		fillEntryResults(results, positions, written)
+	}
+	return results, nil
+}
+
+// 按应用的解析规则解析原始日志文本（多行日志合并为一条）后写入，与 /upload/raw 相同
+func (s *Service) IngestRaw(applicationID, text string) ([]EntryResult, error) {
+	if !validApplicationID(applicationID) {
+		return nil, fmt.Errorf("invalid application_id %q", applicationID)
+	}
+	return s.Ingest(s.parseRawLines(applicationID, text, time.Now()))
+}
+
+// 上传接口对一条日志的校验：必填字段、长度上限和时间戳
+func (s *Service) checkServiceEntry(entry *LogData, now time.Time) error {
+	if binding.Validator.ValidateStruct(entry) != nil {
+		return errInvalidUpload
+	}
+	if !validApplicationID(entry.ApplicationID) {
+		return &applicationIDError{reason: "invalid_application_id", message: "Invalid application_id"}
+	}
+	if err := s.uploadLimits.checkEntry(*entry); err != nil {
+		return err
+	}
+	return s.checkUploadTimestamp(entry, now)
+}
+
+// 日志查询条件，与 /query 的参数对应
+type Query struct {
+	ApplicationIDs []string            // 必填
+	LogLevel       string              // 为空时不限级别
+	Fields         map[string][]string // 结构化字段过滤条件
+	From, To       time.Time           // 零值表示不限
+	Search         *regexp.Regexp      // 日志消息须匹配的正则，nil 表示不限
+	Sort           string              // asc 或 desc，默认 desc
+	Limit          int                 // 默认 100，不超过 query.max_limit
+}
+
+// 执行查询，按时间排序返回脱敏后的日志
+func (s *Service) Query(ctx context.Context, q Query) ([]QueryHit, error) {
+	apps, err := s.serviceApplications(q.ApplicationIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(apps) == 0 {
+		return []QueryHit{}, nil
+	}
+	order := q.Sort
+	if order == "" {
+		order = sortDesc
+	}
+	if order != sortAsc && order != sortDesc {
+		return nil, errors.New("sort must be asc or desc")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if max := s.cfg.Query.maxLimit(); limit > max {
+		limit = max
+	}
+
+	lq := logQuery{LogLevel: q.LogLevel, Fields: q.Fields, From: q.From, To: q.To, Search: q.Search, ctx: ctx}
+	if len(apps) == 1 {
+		lq.ApplicationID = apps[0]
+	} else {
+		lq.ApplicationIDs = apps
+	}
+	hits, err := s.collectSorted(lq, order, limit, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		s.maskQueryEntry(&hits[i].Entry)
+	}
+	return hits, nil
+}
+
+// 时间范围内的全局事务及其状态，最近开始的在前；未指定 to 时以当前时间判断是否挂起，与 /transactions 相同
+func (s *Service) Transactions(ctx context.Context, applicationIDs []string, from, to time.Time) ([]analysis.TransactionSummary, error) {
+	apps, err := s.serviceApplications(applicationIDs)
+	if err != nil {
+		return nil, err
+	}
+	tracker := analysis.NewTransactionTracker()
+	if err := s.runAnalyzers(ctx, apps, from, to, []analysis.Analyzer{tracker}); err != nil {
+		return nil, err
+	}
+	reference := to
+	if reference.IsZero() {
+		reference = time.Now()
+	}
+	transactions := tracker.Summaries(reference, time.Duration(s.cfg.TransactionHangWindow))
+	sort.SliceStable(transactions, func(i, j int) bool { return transactions[i].FirstSeen.After(transactions[j].FirstSeen) })
+	return transactions, nil
+}
+
+// 一个 XID 在一组应用中的时间线，没有相关日志时 Events 为空
+func (s *Service) Timeline(ctx context.Context, xid string, applicationIDs []string) (TransactionTimeline, error) {
+	apps, err := s.serviceApplications(applicationIDs)
+	if err != nil {
+		return TransactionTimeline{}, err
+	}
+	return s.buildTimeline(ctx, xid, apps)
+}
+
+// 诊断一个全局事务，lang 为空时使用 localization.language，与 /transactions/:xid/diagnosis 相同。
+// 找不到事务时返回 ErrTransactionNotFound
+func (s *Service) Diagnose(ctx context.Context, xid string, applicationIDs []string, lang string) (TransactionDiagnosis, error) {
+	t, err := s.Timeline(ctx, xid, applicationIDs)
+	if err != nil {
+		return TransactionDiagnosis{}, err
+	}
+	if len(t.Events) == 0 {
+		return TransactionDiagnosis{}, ErrTransactionNotFound
+	}
+	if lang == "" {
+		lang = s.defaultLanguage()
+	}
+	return s.diagnoseTransaction(t, s.timelineSummary(t), lang), nil
+}
+
+// 已登记的分析器名称，包括插件提供的分析器
+func (s *Service) Analyzers() []string {
+	return s.analyzerNames()
+}
+
+// 在一组应用和时间范围上运行分析器，names 为空时运行全部分析器，与 /analysis/findings 相同
+func (s *Service) Findings(ctx context.Context, applicationIDs []string, from, to time.Time, names []string, lang string) ([]Finding, error) {
+	apps, err := s.serviceApplications(applicationIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		names = s.analyzerNames()
+	}
+	var list []analysis.Analyzer
+	for _, name := range names {
+		newAnalyzer, ok := s.analyzers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown analyzer %q", name)
+		}
+		list = append(list, newAnalyzer())
+	}
+	if lang == "" {
+		lang = s.defaultLanguage()
+	}
+	return s.collectFindings(ctx, apps, from, to, list, lang)
+}
+
+// 校验要读取的应用，跳过已软删除的应用
+func (s *Service) serviceApplications(applicationIDs []string) ([]string, error) {
+	if len(applicationIDs) == 0 {
+		return nil, errors.New("application_ids is required")
+	}
+	apps := make([]string, 0, len(applicationIDs))
+	for _, app := range applicationIDs {
+		if !validApplicationID(app) {
+			return nil, fmt.Errorf("invalid application_id %q", app)
+		}
+		if !s.lifecycle.Deleted(app) {
+			apps = append(apps, app)
+		}
+	}
+	return apps, nil
+}
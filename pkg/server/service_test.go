@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/analysis"
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/plugin"
+	"logAnalysis/pkg/storage"
+)
+
+// 在临时目录中打开 Service，测试结束时关闭
+func openTestService(t testing.TB, dir string, opts ...Option) *Service {
+	t.Helper()
+	return openTestServiceWith(t, dir, func(*Config) {}, opts...)
+}
+
+// 同 openTestService，打开前由 configure 修改默认配置
+func openTestServiceWith(t testing.TB, dir string, configure func(*Config), opts ...Option) *Service {
+	t.Helper()
+	c := DefaultConfig()
+	c.DataDir = filepath.Join(dir, "data")
+	c.StorageRoot = filepath.Join(dir, "logs")
+	configure(&c)
+	s, err := Open(c, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// 服务的 HTTP 路由，不输出访问日志
+func newTestRouter(t testing.TB, s *Service) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	router, err := s.newRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// 写入一条日志并确认被接受
+func ingestTestEntry(t testing.TB, s *Service, entry LogData) {
+	t.Helper()
+	results, err := s.Ingest([]LogData{entry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != EntryAccepted {
+		t.Fatalf("entry not accepted: %+v", results[0])
+	}
+}
+
+func testEntry(app, level, message string, at time.Time) LogData {
+	return LogData{ApplicationID: app, LogLevel: level, LogMessage: message, Timestamp: at.UTC().Format(time.RFC3339Nano)}
+}
+
+// 查询一个应用的全部日志消息，按时间顺序
+func queryMessages(t testing.TB, s *Service, q Query) []string {
+	t.Helper()
+	q.Sort = sortAsc
+	hits, err := s.Query(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		messages = append(messages, hit.Entry.LogMessage)
+	}
+	return messages
+}
+
+func TestTwoServicesInOneProcess(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	a := openTestService(t, dirA)
+	b := openTestService(t, dirB)
+
+	now := time.Now()
+	ingestTestEntry(t, a, testEntry("orders", "INFO", "written to a", now))
+	ingestTestEntry(t, b, testEntry("orders", "INFO", "written to b", now))
+	ingestTestEntry(t, b, testEntry("orders", "INFO", "also written to b", now.Add(time.Millisecond)))
+
+	if got := queryMessages(t, a, Query{ApplicationIDs: []string{"orders"}}); len(got) != 1 || got[0] != "written to a" {
+		t.Fatalf("service a returned %q", got)
+	}
+	if got := queryMessages(t, b, Query{ApplicationIDs: []string{"orders"}}); len(got) != 2 || got[0] != "written to b" {
+		t.Fatalf("service b returned %q", got)
+	}
+
+	// 同一目录关闭后可以再次打开，读取到已写入的日志
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := openTestService(t, dirA)
+	if got := queryMessages(t, reopened, Query{ApplicationIDs: []string{"orders"}}); len(got) != 1 || got[0] != "written to a" {
+		t.Fatalf("reopened service returned %q", got)
+	}
+}
+
+// 统计日志条数的分析器
+type countingAnalyzer struct{ count int }
+
+func (a *countingAnalyzer) Observe(entry plugin.Entry, at time.Time) { a.count++ }
+
+func (a *countingAnalyzer) Findings() []plugin.Finding {
+	return []plugin.Finding{{Code: "entries_seen", Severity: "info", Title: "Entries seen", Count: a.count}}
+}
+
+func TestWithAnalyzerIsPerService(t *testing.T) {
+	a := openTestService(t, t.TempDir(), WithAnalyzer("counting", func() plugin.Analyzer { return &countingAnalyzer{} }))
+	b := openTestService(t, t.TempDir())
+
+	now := time.Now()
+	ingestTestEntry(t, a, testEntry("orders", "INFO", "first", now))
+	ingestTestEntry(t, a, testEntry("orders", "INFO", "second", now.Add(time.Millisecond)))
+	findings, err := a.Findings(context.Background(), []string{"orders"}, time.Time{}, time.Time{}, []string{"counting"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Count != 2 {
+		t.Fatalf("findings = %+v, want one finding counting 2 entries", findings)
+	}
+
+	ingestTestEntry(t, b, testEntry("orders", "INFO", "first", now))
+	if _, err := b.Findings(context.Background(), []string{"orders"}, time.Time{}, time.Time{}, []string{"counting"}, ""); err == nil {
+		t.Fatal("analyzer registered on another service is available")
+	}
+}
+
+// 直接实现 analysis.Analyzer 的计数分析器
+type nativeCountingAnalyzer struct{ count int }
+
+func (a *nativeCountingAnalyzer) Observe(model.LogData, model.Ref, time.Time) { a.count++ }
+
+func (a *nativeCountingAnalyzer) Findings() []analysis.Finding {
+	return []analysis.Finding{{Code: "TEST-COUNT-001", Severity: analysis.SeverityInfo, Title: "Entries seen", Count: a.count}}
+}
+
+func TestHandlerServesInjectedAnalyzer(t *testing.T) {
+	s := openTestService(t, t.TempDir(), WithNativeAnalyzer("counting", func() analysis.Analyzer { return &nativeCountingAnalyzer{} }))
+	now := time.Now()
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "first", now))
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "second", now.Add(time.Millisecond)))
+
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	handler, err := s.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/analysis/findings?application_id=orders&analyzers=counting", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Findings []analysis.Finding `json:"findings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Findings) != 1 || resp.Findings[0].Code != "TEST-COUNT-001" || resp.Findings[0].Count != 2 {
+		t.Fatalf("findings = %+v, want one finding counting 2 entries", resp.Findings)
+	}
+}
+
+// 内存中的存储后端，行引用的 Offset 为写入序号
+type memoryStore struct {
+	mu    sync.Mutex
+	lines map[string][]string // 应用 → 日志行
+}
+
+func (m *memoryStore) AppendEntry(applicationID, fileName string, entry model.LogData) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lines == nil {
+		m.lines = make(map[string][]string)
+	}
+	m.lines[applicationID] = append(m.lines[applicationID], string(data))
+	return nil
+}
+
+func (m *memoryStore) ScanFrom(applicationID string, cursor storage.Cursor, fn func(entry model.LogData, ref model.Ref) bool) (storage.Cursor, error) {
+	next := cursor["seq"]
+	err := m.ScanLines(storage.Filter{ApplicationID: applicationID}, func(line string, ref model.Ref) bool {
+		if ref.Offset <= cursor["seq"] {
+			return true
+		}
+		var entry model.LogData
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && !fn(entry, ref) {
+			return false
+		}
+		next = ref.Offset
+		return true
+	})
+	return storage.Cursor{"seq": next}, err
+}
+
+func (m *memoryStore) RemoveApplication(applicationID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.lines, applicationID)
+	return nil
+}
+
+func (m *memoryStore) ScanLines(f storage.Filter, fn func(line string, ref model.Ref) bool) error {
+	m.mu.Lock()
+	lines := append([]string(nil), m.lines[f.ApplicationID]...)
+	m.mu.Unlock()
+	for i, line := range lines {
+		if !fn(line, model.Ref{ApplicationID: f.ApplicationID, File: "memory", Offset: int64(i + 1)}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Count(f storage.Filter) (int, error) {
+	n := 0
+	err := m.ScanLines(f, func(string, model.Ref) bool { n++; return true })
+	return n, err
+}
+
+func (m *memoryStore) Lines(applicationID string, refs []model.Ref) (map[int64]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lines := make(map[int64]string, len(refs))
+	for _, ref := range refs {
+		if i := int(ref.Offset) - 1; i >= 0 && i < len(m.lines[applicationID]) {
+			lines[ref.Offset] = m.lines[applicationID][i]
+		}
+	}
+	return lines, nil
+}
+
+func (m *memoryStore) Applications() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	apps := make([]string, 0, len(m.lines))
+	for app := range m.lines {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	return apps, nil
+}
+
+func (m *memoryStore) LastID(applicationID string) (int64, error) {
+	var last int64
+	err := m.ScanLines(storage.Filter{ApplicationID: applicationID}, func(line string, _ model.Ref) bool {
+		var entry model.LogData
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.ID > last {
+			last = entry.ID
+		}
+		return true
+	})
+	return last, err
+}
+
+func TestWithStorePlacesApplicationsOnInjectedBackend(t *testing.T) {
+	dir := t.TempDir()
+	c := DefaultConfig()
+	c.DataDir = filepath.Join(dir, "data")
+	c.StorageRoot = filepath.Join(dir, "logs")
+	c.Backends = map[string]BackendConfig{"memory": {Type: "custom", Applications: []string{"audit-*"}}}
+	store := &memoryStore{}
+	s, err := Open(c, WithStore("memory", store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	ingestTestEntry(t, s, testEntry("audit-orders", "INFO", "kept in memory", now))
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "kept on disk", now))
+
+	if apps, _ := store.Applications(); len(apps) != 1 || apps[0] != "audit-orders" {
+		t.Fatalf("injected store holds %q, want only audit-orders", apps)
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{"audit-orders"}}); len(got) != 1 || got[0] != "kept in memory" {
+		t.Fatalf("query on the injected backend returned %q", got)
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}}); len(got) != 1 || got[0] != "kept on disk" {
+		t.Fatalf("query on the local backend returned %q", got)
+	}
+
+	// 配置了 custom 后端却没有注入时无法打开
+	c.DataDir = filepath.Join(dir, "data2")
+	if s, err := Open(c); err == nil {
+		s.Close()
+		t.Fatal("custom backend without WithStore was accepted")
+	}
+}
+
+// Close 与服务停机相同：结束进行中的 /tail 长连接、拒绝新的上传，并返回清理函数的错误
+func TestCloseEndsStreamsAndReturnsHookErrors(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	router := newTestRouter(t, s)
+	ingestTestEntry(t, s, testEntry("orders", "INFO", "order placed", time.Now()))
+	failed := errors.New("flush failed")
+	s.registerShutdownHook("failing", func() error { return failed })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/tail?application_id=orders", nil))
+	}()
+
+	err := s.Close()
+	if !errors.Is(err, failed) {
+		t.Fatalf("Close returned %v, want the hook error", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("/tail still streaming after Close")
+	}
+	if err2 := s.Close(); !errors.Is(err2, failed) {
+		t.Fatalf("second Close returned %v, want the same error", err2)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{"application_id":"orders","log_level":"INFO","log_message":"late"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("upload after Close: status %d, want 503", w.Code)
+	}
+}
+
+// HTTP 服务异常退出时同样执行清理函数，之后的 Close 不再重复执行
+func TestServeErrorRunsShutdownHooksOnce(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	runs := 0
+	s.registerShutdownHook("counting", func() error { runs++; return nil })
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+
+	if err := s.serveWithGracefulShutdown(&http.Server{}, ln, time.Second); err == nil {
+		t.Fatal("serving on a closed listener succeeded")
+	}
+	if runs != 1 || !s.draining.Load() {
+		t.Fatalf("after the serve error: hook ran %d times, draining %v; want 1 and true", runs, s.draining.Load())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Fatalf("Close after the serve error ran the hook again (%d runs)", runs)
+	}
+}
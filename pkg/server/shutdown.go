@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type shutdownHook struct {
+	name string
+	fn   func() error
+}
+
+// 注册停机清理函数
+func (s *Service) registerShutdownHook(name string, fn func() error) {
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	s.shutdownHooks = append(s.shutdownHooks, shutdownHook{name: name, fn: fn})
+}
+
+// 按注册的相反顺序执行全部停机清理函数，返回各函数的错误
+func (s *Service) runShutdownHooks() error {
+	s.shutdownMu.Lock()
+	hooks := s.shutdownHooks
+	s.shutdownMu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(); err != nil {
+			log.Printf("shutdown hook %s failed: %v", hooks[i].name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", hooks[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 开始停机：不再接收新的上传，结束长连接。可重复调用
+func (s *Service) drain() {
+	s.drainOnce.Do(func() {
+		s.draining.Store(true)
+		close(s.shuttingDown)
+	})
+}
+
+// 停机并执行清理函数，只执行一次，之后的调用返回第一次的结果
+func (s *Service) shutdown() error {
+	s.drain()
+	s.closeOnce.Do(func() { s.closeErr = s.runShutdownHooks() })
+	return s.closeErr
+}
+
+// 启动失败时写完已接收的日志并关闭已打开的组件，然后退出
+func (s *Service) fatalf(format string, args ...any) {
+	s.shutdown()
+	log.Fatalf(format, args...)
+}
+
+// 停机期间拒绝新的写入请求，已在处理中的请求不受影响
+func (s *Service) rejectWhenDraining() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.draining.Load() {
+			c.Header("Connection", "close")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// 启动 HTTP 服务，收到 SIGTERM/SIGINT 后等待进行中的请求完成并执行清理
+func (s *Service) serveWithGracefulShutdown(srv *http.Server, ln net.Listener, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errCh <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		// 服务异常退出（如监听失败）时同样写完队列并关闭组件
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return errors.Join(err, s.shutdown())
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", timeout)
+	s.drain()
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+
+	err = errors.Join(err, s.shutdown())
+	log.Printf("Shutdown complete")
+	return err
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传请求的 HMAC 签名：按应用配置共享密钥，客户端用密钥对请求体签名，服务端据此校验请求体未被篡改且来自持有密钥的一方，
+// 适用于 TLS 在不受信任的代理处终止的部署。作用于 HTTP 上传接口和 gRPC 的 Upload、UploadStream
+type UploadSigningConfig struct {
+	Secrets  map[string]string `json:"secrets"`  // 应用 ID → 共享密钥，租户应用为 租户/应用；env:NAME 表示从环境变量读取
+	Required bool              `json:"required"` // 只接受签名的上传：未配置密钥的应用、导入、分片上传和 gRPC UploadStream 也被拒绝
+	MaxSkew  Duration          `json:"max_skew"` // 签名时间与服务端时间允许的偏差，超出视为重放，默认 5m
+}
+
+// 签名请求头。签名为 hex(HMAC-SHA256(密钥, 时间戳 + "." + 请求体))，时间戳为 Unix 秒
+const (
+	signatureHeader          = "X-Signature"
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	signaturePrefix          = "sha256="
+)
+
+var uploadSignatureRejected = metrics.counter("upload_signature_rejected_total", "Upload requests rejected by HMAC signature verification, by reason.")
+
+// 按应用校验上传签名，nil 表示未配置
+type uploadSigner struct {
+	secrets  map[string][]byte
+	required bool
+	maxSkew  time.Duration
+}
+
+// 没有配置任何密钥且不要求签名时返回 nil
+func newUploadSigner(c UploadSigningConfig) (*uploadSigner, error) {
+	if len(c.Secrets) == 0 && !c.Required {
+		return nil, nil
+	}
+	if c.MaxSkew < 0 {
+		return nil, fmt.Errorf("max_skew must not be negative")
+	}
+	if c.MaxSkew == 0 {
+		c.MaxSkew = Duration(5 * time.Minute)
+	}
+	s := &uploadSigner{secrets: make(map[string][]byte, len(c.Secrets)), required: c.Required, maxSkew: time.Duration(c.MaxSkew)}
+	for app, secret := range c.Secrets {
+		if name, ok := strings.CutPrefix(secret, "env:"); ok {
+			secret = os.Getenv(name)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("application %s: empty secret", app)
+		}
+		s.secrets[app] = []byte(secret)
+	}
+	return s, nil
+}
+
+// 计算请求体的签名
+func uploadSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 上传接口的签名方式，决定按哪些应用的密钥校验
+type uploadSigning int
+
+const (
+	unsignedUpload uploadSigning = iota // 不支持签名（导入和分片上传），只在要求签名时拒绝
+	signedByQuery                       // 写入 application_id 参数指定的应用（/upload/raw、/upload/logstash）
+	signedByBody                        // 写入请求体中每条日志的 application_id（/upload、/upload/batch），忽略 application_id 参数
+)
+
+// 上传请求写入的应用：按 signing 取 application_id 参数，或请求体中单条日志或批量日志的 application_id。
+// 须与处理函数实际写入的应用一致，否则可以用未配置密钥的参数绕过请求体中应用的签名校验
+func uploadApplications(c *gin.Context, signing uploadSigning, body []byte) []string {
+	if signing == signedByQuery {
+		return splitList(c.Query("application_id"))
+	}
+	type owned struct {
+		ApplicationID string `json:"application_id"`
+	}
+	var entries []owned
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		json.Unmarshal(body, &entries)
+	} else {
+		var entry owned
+		json.Unmarshal(body, &entry)
+		entries = append(entries, entry)
+	}
+	seen := make(map[string]bool)
+	var apps []string
+	for _, e := range entries {
+		if e.ApplicationID != "" && !seen[e.ApplicationID] {
+			seen[e.ApplicationID] = true
+			apps = append(apps, e.ApplicationID)
+		}
+	}
+	return apps
+}
+
+func rejectUploadSignature(c *gin.Context, reason, message string) {
+	uploadSignatureRejected.Add(1, "reason", reason)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// 上传签名中间件：请求写入的应用中配置了密钥的都须通过签名校验，签名的请求对每个这样的应用的密钥都须有效。
+// 其他节点转发的请求已在收到的节点校验过
+func (s *Service) verifyUploadSignature(signing uploadSigning) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.uploadSigning == nil || c.GetBool("cluster.forwarded") {
+			c.Next()
+			return
+		}
+		if signing == unsignedUpload {
+			if s.uploadSigning.required {
+				uploadSignatureRejected.Add(1, "reason", "unsupported")
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Signed uploads are required; use /upload, /upload/batch, /upload/raw or /upload/logstash"})
+				return
+			}
+			c.Next()
+			return
+		}
+		// 签名针对客户端发送的原始字节，转码交给之后的处理
+		body, ok := s.readRawUploadBody(c)
+		if !ok {
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var secrets [][]byte
+		for _, app := range uploadApplications(c, signing, body) {
+			secret, ok := s.uploadSigning.secrets[clusterKey(c, app)]
+			if !ok && s.uploadSigning.required {
+				uploadSignatureRejected.Add(1, "reason", "no_secret")
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Signed uploads are required and no secret is configured for " + app})
+				return
+			}
+			if ok {
+				secrets = append(secrets, secret)
+			}
+		}
+		if len(secrets) == 0 && !s.uploadSigning.required {
+			c.Next()
+			return
+		}
+
+		if reason, message := s.uploadSigning.check(c.GetHeader(signatureHeader), c.GetHeader(signatureTimestampHeader), body, secrets); reason != "" {
+			rejectUploadSignature(c, reason, message)
+			return
+		}
+		c.Next()
+	}
+}
+
+// 校验签名和签名时间：签名须对每个密钥都有效。通过时 reason 为空，否则为指标中的拒绝原因和错误消息
+func (u *uploadSigner) check(signature, timestamp string, body []byte, secrets [][]byte) (reason, message string) {
+	if signature == "" || timestamp == "" {
+		return "missing", "Missing upload signature"
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if skew := time.Since(time.Unix(unix, 0)); err != nil || skew > u.maxSkew || skew < -u.maxSkew {
+		return "expired", "Upload signature timestamp is outside the allowed skew"
+	}
+	got := strings.TrimPrefix(signature, signaturePrefix)
+	for _, secret := range secrets {
+		if !hmac.Equal([]byte(got), []byte(uploadSignature(secret, timestamp, body))) {
+			return "invalid", "Invalid upload signature"
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// /upload 和 /upload/batch 写入请求体中的应用，application_id 参数不能让请求绕过这些应用的签名校验
+func TestUploadSignatureIgnoresQueryApplicationForBodyRoutedUploads(t *testing.T) {
+	s := openTestService(t, t.TempDir())
+	signer, err := newUploadSigner(UploadSigningConfig{Secrets: map[string]string{"orders": "s3cret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.uploadSigning = signer
+	router := newTestRouter(t, s)
+
+	entry := testEntry("orders", "INFO", "order placed", time.Now())
+	single, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := json.Marshal([]LogData{entry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(path string, body []byte, header http.Header) int {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header = header.Clone()
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, tc := range []struct {
+		path string
+		body []byte
+	}{
+		{"/upload", single},
+		{"/upload/batch", batch},
+	} {
+		if code := upload(tc.path+"?application_id=payments", tc.body, http.Header{}); code != http.StatusUnauthorized {
+			t.Errorf("unsigned %s for orders with application_id=payments: status %d, want 401", tc.path, code)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		forged := http.Header{signatureHeader: {signaturePrefix + uploadSignature([]byte("wrong"), timestamp, tc.body)}, signatureTimestampHeader: {timestamp}}
+		if code := upload(tc.path+"?application_id=payments", tc.body, forged); code != http.StatusUnauthorized {
+			t.Errorf("%s signed with the wrong secret and application_id=payments: status %d, want 401", tc.path, code)
+		}
+	}
+	if _, err := s.Query(context.Background(), Query{ApplicationIDs: []string{"orders"}}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("rejected uploads created the application: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signed := http.Header{signatureHeader: {signaturePrefix + uploadSignature([]byte("s3cret"), timestamp, single)}, signatureTimestampHeader: {timestamp}}
+	if code := upload("/upload?application_id=payments", single, signed); code != http.StatusOK {
+		t.Fatalf("signed /upload: status %d, want 200", code)
+	}
+	if got := queryMessages(t, s, Query{ApplicationIDs: []string{"orders"}}); len(got) != 1 {
+		t.Fatalf("signed /upload stored %q in orders, want one entry", got)
+	}
+}
@@ -0,0 +1,402 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 日志库的快照，用于在主机之间迁移：tar.gz 中第一项为 manifest.json，随后是 file 后端的全部文件
+// （storage/<后端>/<应用>/<分段>）和数据目录中的索引与服务状态（data/...），如日志 ID、后端映射、
+// schema、解析规则和用户。加密的行和已分层分段的占位文件原样保存，恢复的实例需要相同的密钥和对象存储。
+// 进行中的断点续传会话不包含在快照中
+const snapshotVersion = 1
+
+// 快照清单
+type snapshotManifest struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Backends  map[string]string `json:"backends"`          // file 后端名称 → 源实例上的根目录
+	Skipped   []string          `json:"skipped,omitempty"` // 未包含的非 file 后端，其日志需要单独迁移
+	DataDir   string            `json:"data_dir"`
+	Files     int               `json:"files"`
+	Bytes     int64             `json:"bytes"`
+}
+
+// 快照中的一个文件，打开时记录的大小之后追加的内容不写入快照
+type snapshotFile struct {
+	name string // 归档中的路径
+	file *os.File
+	size int64
+	mod  time.Time
+}
+
+// 配置中的 file 后端及其根目录，与 newBackendRegistry 的规则一致；skipped 为其他类型的后端
+func fileBackendRoots(c Config) (roots map[string]string, skipped []string) {
+	configs := map[string]BackendConfig{defaultBackend: {Type: "file", Root: c.StorageRoot}}
+	for name, b := range c.Backends {
+		configs[name] = b
+	}
+	t := newTenantRegistry(c.Tenants, nil)
+	for _, tenant := range t.Names() {
+		configs[tenantBackend(tenant)] = BackendConfig{Type: "file", Root: t.configs[tenant].StorageRoot}
+	}
+	roots = make(map[string]string)
+	for name, b := range configs {
+		if b.Type == "file" {
+			roots[name] = b.Root
+		} else {
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(skipped)
+	return roots, skipped
+}
+
+// 打开要写入快照的全部文件。调用方暂停写入期间打开，之后的压缩、分层和删除不影响已打开的文件
+func (s *Service) openSnapshotFiles(roots map[string]string, dataDir string) ([]snapshotFile, error) {
+	var files []snapshotFile
+	add := func(prefix, root string, skip func(path string) bool) error {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && skip(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// 路由到存储类别的分段是指向类别目录的链接，按链接指向的文件写入快照
+			if (!d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0) || strings.HasSuffix(path, ".tmp") {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(path)
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				file.Close()
+				return nil
+			}
+			files = append(files, snapshotFile{name: prefix + filepath.ToSlash(rel), file: file, size: info.Size(), mod: info.ModTime()})
+			return nil
+		})
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	names := sortedKeys(roots)
+	storage := make(map[string]bool)
+	for _, name := range names {
+		storage[filepath.Clean(roots[name])] = true
+	}
+	for _, root := range append(s.storageRouting.roots(), s.storageVolumes.roots()...) {
+		storage[filepath.Clean(root)] = true
+	}
+	for _, name := range names {
+		if err := add("storage/"+name+"/", roots[name], func(string) bool { return false }); err != nil {
+			closeSnapshotFiles(files)
+			return nil, err
+		}
+	}
+	uploads := filepath.Join(dataDir, "uploads")
+	// 数据目录中的存储根目录已作为后端写入
+	err := add("data/", dataDir, func(path string) bool { return path == uploads || storage[filepath.Clean(path)] })
+	if err != nil {
+		closeSnapshotFiles(files)
+		return nil, err
+	}
+	return files, nil
+}
+
+func closeSnapshotFiles(files []snapshotFile) {
+	for _, f := range files {
+		f.file.Close()
+	}
+}
+
+// 打开快照的全部文件并生成清单。pause 不为 nil 时在暂停写入期间打开，使各分段和索引处于同一时刻，
+// 打开后立即恢复写入，之后写出归档时写入照常进行
+func (s *Service) prepareSnapshot(c Config, pause func() func()) (snapshotManifest, []snapshotFile, error) {
+	roots, skipped := fileBackendRoots(c)
+	resume := func() {}
+	if pause != nil {
+		resume = pause()
+	}
+	files, err := s.openSnapshotFiles(roots, c.DataDir)
+	resume()
+	if err != nil {
+		return snapshotManifest{}, nil, err
+	}
+	manifest := snapshotManifest{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Backends:  roots,
+		Skipped:   skipped,
+		DataDir:   c.DataDir,
+		Files:     len(files),
+	}
+	for _, f := range files {
+		manifest.Bytes += f.size
+	}
+	return manifest, files, nil
+}
+
+// 写出 tar.gz 归档并关闭文件
+func writeSnapshot(w io.Writer, manifest snapshotManifest, files []snapshotFile) error {
+	defer closeSnapshotFiles(files)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: f.size, ModTime: f.mod}); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tw, f.file, f.size); err != nil {
+			return fmt.Errorf("%s: %v", f.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// 快照下载接口，以 tar.gz 流式返回。集群中每个节点只包含本节点的存储
+func (s *Service) snapshotHandler(c *gin.Context) {
+	manifest, files, err := s.prepareSnapshot(s.cfg, s.backends.PauseWrites)
+	if err != nil {
+		log.Printf("snapshot failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read the log store"})
+		return
+	}
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="snapshot-%s.tar.gz"`, manifest.CreatedAt.Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+	// 响应已开始，失败时只能中断，客户端得到的是不完整的归档
+	if err := writeSnapshot(c.Writer, manifest, files); err != nil {
+		log.Printf("snapshot failed: %v", err)
+		c.Abort()
+		return
+	}
+	auditCount(c, manifest.Files)
+}
+
+// snapshot 子命令：服务停止时直接按配置写出快照，运行中的实例请使用 GET /admin/snapshot
+func runSnapshot(args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to the JSON config file")
+	out := fs.String("out", "snapshot.tar.gz", "path of the snapshot archive to write")
+	fs.Parse(args)
+
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Unable to load config: %v", err)
+	}
+	tmp := *out + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		log.Fatalf("Unable to create snapshot: %v", err)
+	}
+	// 服务未运行，只读取配置中的存储根目录
+	manifest, files, err := newService(c).prepareSnapshot(c, nil)
+	if err == nil {
+		err = writeSnapshot(file, manifest, files)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, *out)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Fatalf("Unable to write snapshot: %v", err)
+	}
+	log.Printf("Wrote snapshot %s: %d files, %d bytes", *out, manifest.Files, manifest.Bytes)
+}
+
+// restore 子命令：在新实例上、服务启动前把快照恢复到配置的存储根目录和数据目录。
+// 服务启动时才加载索引和注册表，所以恢复不提供在线接口。目标不为空时拒绝恢复，除非指定 -force
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to the JSON config file")
+	in := fs.String("in", "snapshot.tar.gz", "path of the snapshot archive to restore")
+	force := fs.Bool("force", false, "restore into non-empty storage roots and data directory, overwriting files")
+	fs.Parse(args)
+
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Unable to load config: %v", err)
+	}
+	file, err := os.Open(*in)
+	if err != nil {
+		log.Fatalf("Unable to open snapshot: %v", err)
+	}
+	defer file.Close()
+	manifest, err := restoreSnapshot(file, c, *force)
+	if err != nil {
+		log.Fatalf("Unable to restore snapshot: %v", err)
+	}
+	if len(manifest.Skipped) > 0 {
+		log.Printf("Backends not included in the snapshot: %s", strings.Join(manifest.Skipped, ", "))
+	}
+	log.Printf("Restored snapshot taken at %s: %d files, %d bytes", manifest.CreatedAt.Format(time.RFC3339), manifest.Files, manifest.Bytes)
+}
+
+// 解包快照，存储文件写入目标配置中同名后端的根目录，数据文件写入数据目录
+func restoreSnapshot(r io.Reader, c Config, force bool) (snapshotManifest, error) {
+	var manifest snapshotManifest
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, err
+	}
+	tr := tar.NewReader(zr)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != "manifest.json" {
+		return manifest, errors.New("not a snapshot: manifest.json is missing")
+	}
+	if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Version != snapshotVersion {
+		return manifest, fmt.Errorf("unsupported snapshot version %d", manifest.Version)
+	}
+
+	roots, _ := fileBackendRoots(c)
+	targets := []string{c.DataDir}
+	for _, name := range sortedKeys(manifest.Backends) {
+		root, ok := roots[name]
+		if !ok {
+			return manifest, fmt.Errorf("backend %s in the snapshot is not a file backend in this config", name)
+		}
+		targets = append(targets, root)
+	}
+	if !force {
+		for _, dir := range targets {
+			entries, err := os.ReadDir(dir)
+			if err != nil && !os.IsNotExist(err) {
+				return manifest, err
+			}
+			if len(entries) > 0 {
+				return manifest, fmt.Errorf("%s is not empty, use -force to overwrite", dir)
+			}
+		}
+	}
+
+	restored := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		path, err := snapshotTarget(hdr.Name, roots, manifest.Backends, c.DataDir)
+		if err != nil {
+			return manifest, err
+		}
+		if err := restoreFile(path, tr, hdr.ModTime); err != nil {
+			return manifest, fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+		restored++
+	}
+	if restored != manifest.Files {
+		return manifest, fmt.Errorf("snapshot is incomplete: %d of %d files", restored, manifest.Files)
+	}
+	return manifest, nil
+}
+
+// 归档路径对应的本地路径，拒绝越出目标目录的路径
+func snapshotTarget(name string, roots, backends map[string]string, dataDir string) (string, error) {
+	var base, rel string
+	if rest, ok := strings.CutPrefix(name, "data/"); ok {
+		base, rel = dataDir, rest
+	} else if rest, ok := strings.CutPrefix(name, "storage/"); ok {
+		backend, file, _ := strings.Cut(rest, "/")
+		if _, ok := backends[backend]; !ok {
+			return "", fmt.Errorf("unexpected entry %s", name)
+		}
+		base, rel = roots[backend], file
+	} else {
+		return "", fmt.Errorf("unexpected entry %s", name)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf("unsafe entry %s", name)
+	}
+	return filepath.Join(base, filepath.FromSlash(rel)), nil
+}
+
+// 先写入临时文件再改名，保留原来的修改时间（压缩和分层按修改时间判断分段是否已关闭）
+func restoreFile(path string, r io.Reader, mod time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, mod, mod)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
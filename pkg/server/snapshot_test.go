@@ -0,0 +1,97 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试实例的配置，与 openTestService 的目录一致
+func snapshotTestConfig(dir string) Config {
+	c := DefaultConfig()
+	c.DataDir = filepath.Join(dir, "data")
+	c.StorageRoot = filepath.Join(dir, "logs")
+	return c
+}
+
+// 运行中的实例下载的快照恢复到新目录后，新实例能查询到同样的日志并继续写入
+func TestSnapshotRestoresIntoNewInstance(t *testing.T) {
+	src := openTestService(t, t.TempDir())
+	now := time.Now()
+	for i, message := range []string{"order placed", "order paid"} {
+		ingestTestEntry(t, src, testEntry("orders", "INFO", message, now.Add(time.Duration(i)*time.Millisecond)))
+	}
+	ingestTestEntry(t, src, testEntry("stock", "WARN", "stock low", now))
+
+	w := httptest.NewRecorder()
+	newTestRouter(t, src).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/snapshot", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("snapshot: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	archive := w.Body.Bytes()
+
+	dir := t.TempDir()
+	c := snapshotTestConfig(dir)
+	manifest, err := restoreSnapshot(bytes.NewReader(archive), c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Files == 0 || manifest.Backends[defaultBackend] == "" {
+		t.Fatalf("manifest %+v", manifest)
+	}
+	if _, err := restoreSnapshot(bytes.NewReader(archive), c, false); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Fatalf("restore into a non-empty directory: %v", err)
+	}
+	if _, err := restoreSnapshot(bytes.NewReader(archive), c, true); err != nil {
+		t.Fatalf("forced restore: %v", err)
+	}
+
+	dst := openTestService(t, dir)
+	if got, want := queryMessages(t, dst, Query{ApplicationIDs: []string{"orders"}}), []string{"order placed", "order paid"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("orders after restore %q, want %q", got, want)
+	}
+	if got := queryMessages(t, dst, Query{ApplicationIDs: []string{"stock"}}); !reflect.DeepEqual(got, []string{"stock low"}) {
+		t.Fatalf("stock after restore %q", got)
+	}
+	ingestTestEntry(t, dst, testEntry("orders", "INFO", "order shipped", now.Add(time.Second)))
+	if got := queryMessages(t, dst, Query{ApplicationIDs: []string{"orders"}}); len(got) != 3 {
+		t.Fatalf("orders after writing to the restored instance %q", got)
+	}
+}
+
+// 越出目标目录或指向未知后端的归档项被拒绝
+func TestSnapshotRestoreRejectsUnsafeEntries(t *testing.T) {
+	archive := func(name string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		for _, f := range []struct{ name, data string }{
+			{"manifest.json", `{"version":1,"backends":{"default":"/srv/logs"},"files":1}`},
+			{name, "x"},
+		} {
+			if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}); err != nil {
+				t.Fatal(err)
+			}
+			tw.Write([]byte(f.data))
+		}
+		tw.Close()
+		zw.Close()
+		return buf.Bytes()
+	}
+	for _, name := range []string{"data/../escaped", "storage/default/../../escaped", "storage/s3/orders/2024-05-01.log", "other/file"} {
+		dir := t.TempDir()
+		if _, err := restoreSnapshot(bytes.NewReader(archive(name)), snapshotTestConfig(dir), false); err == nil {
+			t.Errorf("restored %s", name)
+		}
+	}
+	if _, err := restoreSnapshot(strings.NewReader("not a snapshot"), snapshotTestConfig(t.TempDir()), false); err == nil {
+		t.Error("restored an invalid archive")
+	}
+}
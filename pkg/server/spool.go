@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"logAnalysis/pkg/client"
+)
+
+// 代理的磁盘缓冲：服务端不可达（网络错误、5xx、429、认证失败）时，读取的日志按批追加到 spool 目录下的缓冲文件，
+// 同时推进文件的读取进度；服务端恢复后按写入顺序重放，缓冲未清空前新读取的日志排在其后，保证顺序。
+// 每批带有固定的 Idempotency-Key，上传结果未知（如超时）的批次重放时服务端按 dedup 去重，不会重复写入。
+// 缓冲已满时暂停读取，文件中的日志留到缓冲腾出空间后再读
+type AgentSpoolConfig struct {
+	Dir   string `json:"dir"`    // 缓冲目录，默认 agent-spool
+	MaxMB int    `json:"max_mb"` // 缓冲文件的上限，默认 1024
+}
+
+// 缓冲中的一批日志
+type spoolBatch struct {
+	Key     string            `json:"key"`
+	Entries []client.LogEntry `json:"entries"`
+}
+
+// 缓冲已满
+var errSpoolFull = errors.New("spool is full")
+
+// 缓冲文件，offset 之前的批次已上传
+type agentSpool struct {
+	path       string
+	offsetPath string
+	maxBytes   int64
+
+	file   *os.File
+	size   int64
+	offset int64
+}
+
+// 已上传的位置
+type spoolOffset struct {
+	Offset int64 `json:"offset"`
+}
+
+func openAgentSpool(c AgentSpoolConfig) (*agentSpool, error) {
+	if c.Dir == "" {
+		c.Dir = "agent-spool"
+	}
+	if c.MaxMB <= 0 {
+		c.MaxMB = 1024
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &agentSpool{path: filepath.Join(c.Dir, "spool.ndjson"), offsetPath: filepath.Join(c.Dir, "offset.json"), maxBytes: int64(c.MaxMB) << 20}
+	var off spoolOffset
+	if err := loadJSONFile(s.offsetPath, &off); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.file, s.size, s.offset = file, info.Size(), min(off.Offset, info.Size())
+	// 清空缓冲时在截断后崩溃，保存的位置已失效
+	if off.Offset > s.size {
+		if err := saveJSONFile(s.offsetPath, spoolOffset{Offset: s.offset}); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	// 追加时中断留下的半行单独成行，重放时跳过，不与后面的批次连在一起
+	if s.size > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, s.size-1); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if last[0] != '\n' {
+			n, err := file.Write([]byte{'\n'})
+			s.size += int64(n)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// 没有未上传的批次
+func (s *agentSpool) Empty() bool {
+	return s.offset >= s.size
+}
+
+// 未上传的字节数
+func (s *agentSpool) Pending() int64 {
+	return s.size - s.offset
+}
+
+// 追加一批日志并落盘，超过上限时返回 errSpoolFull
+func (s *agentSpool) Append(b spoolBatch) error {
+	line, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if s.Pending()+int64(len(line)) > s.maxBytes {
+		return errSpoolFull
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// 按顺序上传缓冲中的批次，每批成功后保存位置；send 失败时停止并返回错误，下次从该批次重试。
+// send 期间追加的批次留到下次上传，全部上传后清空缓冲文件
+func (s *agentSpool) Drain(ctx context.Context, send func(spoolBatch) error) (int, error) {
+	if s.Empty() {
+		return 0, nil
+	}
+	end := s.size
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.offset, end-s.offset))
+	sent := 0
+	for s.offset < end {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return sent, err
+		}
+		var b spoolBatch
+		if err := json.Unmarshal(line, &b); err != nil {
+			log.Printf("Skipping corrupt spool record at offset %d", s.offset)
+		} else {
+			if err := send(b); err != nil {
+				return sent, err
+			}
+			sent++
+		}
+		s.offset += int64(len(line))
+		if err := saveJSONFile(s.offsetPath, spoolOffset{Offset: s.offset}); err != nil {
+			return sent, err
+		}
+	}
+	if !s.Empty() {
+		return sent, nil
+	}
+	// 先截断再记下位置 0，其间崩溃时保存的位置超过文件大小，打开时按文件大小修正
+	if err := s.file.Truncate(0); err != nil {
+		return sent, err
+	}
+	s.size, s.offset = 0, 0
+	return sent, saveJSONFile(s.offsetPath, spoolOffset{})
+}
+
+func (s *agentSpool) Close() error {
+	return s.file.Close()
+}
+
+// 服务端拒绝了这批日志（请求无效或过大），重试也不会成功
+func spoolRejected(err error) bool {
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/storage"
+)
+
+// 列出全部非租户应用：各非租户后端根目录下的应用目录，以及迁移到其他后端的应用
+func (s *Service) listApplications() ([]string, error) {
+	apps := make(map[string]bool)
+	for _, name := range s.backends.Names() {
+		store, bc, _ := s.backends.Store(name)
+		if isTenantBackend(name) {
+			continue
+		}
+		if qs, ok := store.(storage.QueryStore); ok {
+			ids, err := qs.Applications()
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if !strings.Contains(id, "/") && s.backends.BackendOf(id) == name {
+					apps[id] = true
+				}
+			}
+			continue
+		}
+		if bc.Type != "file" {
+			continue
+		}
+		dirs, err := os.ReadDir(bc.Root)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			// 只统计当前放置在该后端上的应用，迁移后残留的源目录不重复计入
+			if dir.IsDir() && s.backends.BackendOf(dir.Name()) == name {
+				apps[dir.Name()] = true
+			}
+		}
+	}
+	return s.lifecycle.Visible(sortedKeys(apps)), nil
+}
+
+// 单个应用的统计
+type applicationStats struct {
+	ApplicationID string         `json:"application_id"`
+	Backend       string         `json:"backend"`
+	Total         int            `json:"total"`
+	Levels        map[string]int `json:"levels"`
+	// 按采样比例还原的原始条数，有经过采样的日志时才返回
+	EstimatedTotal  int            `json:"estimated_total,omitempty"`
+	EstimatedLevels map[string]int `json:"estimated_levels,omitempty"`
+	Files           int            `json:"files"`
+	Bytes           int64          `json:"bytes"` // 日志文件占用的磁盘空间（压缩后）
+	FirstSeen       *time.Time     `json:"first_seen,omitempty"`
+	LastSeen        *time.Time     `json:"last_seen,omitempty"`
+}
+
+// 统计应用的日志条数、级别分布、时间范围和文件占用
+func (s *Service) collectApplicationStats(applicationID string) (applicationStats, error) {
+	st := applicationStats{ApplicationID: applicationID, Backend: s.backends.BackendOf(applicationID), Levels: make(map[string]int)}
+
+	// 不以本地目录存放日志的后端没有文件占用
+	if _, ok := s.queryStoreOf(applicationID); !ok {
+		files, err := os.ReadDir(s.applicationDir(applicationID))
+		if err != nil {
+			return st, err
+		}
+		for _, file := range files {
+			// 路由到存储类别的分段按链接指向的文件计算
+			if info, err := os.Stat(filepath.Join(s.applicationDir(applicationID), file.Name())); err == nil && !info.IsDir() {
+				st.Files++
+				st.Bytes += info.Size()
+			}
+		}
+	}
+
+	var first, last time.Time
+	sampled := false
+	estimated := make(map[string]float64)
+	var err error
+	if _, ok := s.queryStoreOf(applicationID); ok {
+		err = s.forEachStoredLog(applicationID, func(entry LogData, ref logRef) bool {
+			st.Total++
+			st.Levels[entry.LogLevel]++
+			estimated[entry.LogLevel] += entryWeight(entry)
+			sampled = sampled || entry.SampleRate > 0
+			at := entryTime(entry, ref)
+			if first.IsZero() || at.Before(first) {
+				first = at
+			}
+			if at.After(last) {
+				last = at
+			}
+			return true
+		})
+	} else {
+		// file 后端直接读取写入时维护的计数索引
+		err = s.histogramCounts.View(applicationID, time.Now(), func(segments map[string]*segmentCounts) {
+			for _, seg := range segments {
+				for _, byLevel := range seg.Minutes {
+					for level, n := range byLevel {
+						st.Total += n
+						st.Levels[level] += n
+					}
+				}
+				for level, n := range seg.Estimated {
+					estimated[level] += n
+				}
+				sampled = sampled || seg.Sampled
+				if !seg.First.IsZero() && (first.IsZero() || seg.First.Before(first)) {
+					first = seg.First
+				}
+				if seg.Last.After(last) {
+					last = seg.Last
+				}
+			}
+		})
+	}
+	if err != nil {
+		return st, err
+	}
+	if st.Total > 0 {
+		st.FirstSeen, st.LastSeen = &first, &last
+	}
+	if sampled {
+		st.EstimatedLevels = make(map[string]int, len(estimated))
+		for level, n := range estimated {
+			st.EstimatedLevels[level] = int(math.Round(n))
+			st.EstimatedTotal += st.EstimatedLevels[level]
+		}
+	}
+	return st, nil
+}
+
+// 应用列表接口
+func (s *Service) applicationListHandler(c *gin.Context) {
+	apps, err := s.listApplications()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list applications"})
+		return
+	}
+	// 磁盘占用和 Seata 版本只包含本节点上的应用
+	apps = permittedApplications(c, apps)
+	versions := s.seataVersions.Fingerprints(apps)
+	warnings := make([]seataVersionWarning, 0)
+	if w := mixedSeataVersions(versions); w != nil {
+		warnings = append(warnings, *w)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"applications":           permittedApplications(c, s.clusterApplications(c, apps)),
+		"usage":                  s.applicationUsages(apps),
+		"seata_versions":         versions,
+		"seata_version_warnings": warnings,
+	})
+}
+
+// 应用统计接口，application_id 为空时返回全部应用，可以引用分组
+func (s *Service) applicationStatsHandler(c *gin.Context) {
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+
+	stats := make([]applicationStats, 0, len(apps))
+	for _, app := range apps {
+		st, err := s.collectApplicationStats(app)
+		if errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Application not found: " + app})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read application logs"})
+			return
+		}
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ApplicationID < stats[j].ApplicationID })
+	resp := gin.H{"applications": stats}
+	// 引用了分组时按环境汇总
+	if gs := s.collectGroupStats(c.Query("application_id"), stats); gs != nil {
+		resp["groups"] = gs
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 按标签把日志路由到不同的存储目录，如 ERROR 写到 SSD 上的热存储，DEBUG 直接写到压缩的冷存储。
+// 匹配规则的日志写入该存储类别的独立分段，分段文件放在类别的根目录下，应用目录中以同名符号链接指向它，
+// 查询、计数索引、配额和分层都照常通过应用目录访问。未匹配任何规则的日志仍写入应用所在后端的目录。只作用于 file 后端
+type StorageRoutingConfig struct {
+	Classes map[string]StorageClassConfig `json:"classes"` // 存储类别名称 → 配置
+	Rules   []StorageRouteRule            `json:"rules"`   // 按顺序匹配，第一条匹配的规则生效
+}
+
+// 存储类别
+type StorageClassConfig struct {
+	Root     string `json:"root"`     // 分段文件的根目录，其下按 后端/应用 分目录
+	Compress bool   `json:"compress"` // 即使 rotation.compress 未开启，也在分段关闭后压缩
+	Codec    string `json:"codec"`    // 压缩编码，未指定时使用 rotation.codec；none 表示该类别的分段不压缩
+}
+
+// 路由规则，各条件同时满足时匹配，未指定的条件不限制
+type StorageRouteRule struct {
+	Application string            `json:"application"` // 应用 ID，支持 * 通配；租户应用为 租户/应用
+	Levels      []string          `json:"levels"`      // 日志级别，不区分大小写
+	Fields      map[string]string `json:"fields"`      // 字段取值，可以是 log_message、log_level 等内置字段或自定义字段
+	Class       string            `json:"class"`       // 存储类别
+}
+
+// 按规则选择日志的存储类别，nil 表示未配置路由
+type storageRouter struct {
+	classes map[string]StorageClassConfig
+	rules   []StorageRouteRule
+}
+
+// 按配置创建路由，没有配置任何规则时返回 nil
+func newStorageRouter(c StorageRoutingConfig) (*storageRouter, error) {
+	if len(c.Rules) == 0 {
+		return nil, nil
+	}
+	r := &storageRouter{classes: make(map[string]StorageClassConfig), rules: c.Rules}
+	for name, class := range c.Classes {
+		if name == "" || strings.ContainsAny(name, `@/\`) {
+			return nil, fmt.Errorf("invalid storage class name %q", name)
+		}
+		if class.Root == "" {
+			return nil, fmt.Errorf("storage class %s: root is required", name)
+		}
+		// 链接使用绝对路径，不受应用目录位置的影响
+		root, err := filepath.Abs(class.Root)
+		if err != nil {
+			return nil, fmt.Errorf("storage class %s: %v", name, err)
+		}
+		class.Root = root
+		if _, err := lookupSegmentCodec(class.Codec); err != nil {
+			return nil, fmt.Errorf("storage class %s: %v", name, err)
+		}
+		r.classes[name] = class
+	}
+	for i, rule := range c.Rules {
+		if _, ok := r.classes[rule.Class]; !ok {
+			return nil, fmt.Errorf("rule %d: unknown storage class %q", i+1, rule.Class)
+		}
+		if _, err := path.Match(rule.Application, ""); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid application pattern %q", i+1, rule.Application)
+		}
+	}
+	return r, nil
+}
+
+func (rule *StorageRouteRule) matches(applicationID string, entry *LogData) bool {
+	if rule.Application != "" {
+		if ok, _ := path.Match(rule.Application, applicationID); !ok {
+			return false
+		}
+	}
+	if len(rule.Levels) > 0 {
+		matched := false
+		for _, level := range rule.Levels {
+			if strings.EqualFold(level, entry.LogLevel) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for field, value := range rule.Fields {
+		if entryFieldValue(entry, field) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// 日志的存储类别，为空表示写入应用目录
+func (r *storageRouter) Class(applicationID string, entry *LogData) string {
+	if r == nil {
+		return ""
+	}
+	for i := range r.rules {
+		if r.rules[i].matches(applicationID, entry) {
+			return r.rules[i].Class
+		}
+	}
+	return ""
+}
+
+// 存储类别中存放应用分段的目录，租户后端名称中的冒号不便用作目录名，替换为下划线
+func (r *storageRouter) classDir(class, backend, app string) string {
+	return filepath.Join(r.classes[class].Root, strings.ReplaceAll(backend, ":", "_"), app)
+}
+
+// 各存储类别中存放应用分段的目录
+func (r *storageRouter) applicationDirs(backend, app string) []string {
+	if r == nil {
+		return nil
+	}
+	dirs := make([]string, 0, len(r.classes))
+	for _, class := range sortedKeys(r.classes) {
+		dirs = append(dirs, r.classDir(class, backend, app))
+	}
+	return dirs
+}
+
+// 分段所属的存储类别：跟随应用目录中的链接（未压缩或已压缩的）判断指向哪个类别的根目录。
+// linked 表示分段是指向其他目录的链接，指向的目录不属于任何已配置的类别时 class 为空；
+// 指向存储卷 volumes 的链接与应用目录中的分段相同，linked 为 false
+func (r *storageRouter) ClassOf(segmentPath string, volumes *volumeSet) (class string, linked bool) {
+	for _, p := range append([]string{segmentPath}, compressedPaths(segmentPath)...) {
+		target, err := os.Readlink(p)
+		if err != nil {
+			continue
+		}
+		if r != nil {
+			for name, c := range r.classes {
+				if rel, err := filepath.Rel(c.Root, target); err == nil && !strings.HasPrefix(rel, "..") {
+					return name, true
+				}
+			}
+		}
+		return "", !volumes.contains(target)
+	}
+	return "", false
+}
+
+// 类别的分段关闭后使用的压缩编码，不压缩时返回 nil。未路由到类别的分段（class 为空）按 rotation 配置
+func (r *storageRouter) codec(class string, rotation RotationConfig) *segmentCodec {
+	name, compress := rotation.Codec, rotation.Compress
+	if r != nil && class != "" {
+		c := r.classes[class]
+		compress = compress || c.Compress
+		if c.Codec != "" {
+			name = c.Codec
+		}
+	}
+	if !compress {
+		return nil
+	}
+	codec, _ := lookupSegmentCodec(name)
+	return codec
+}
+
+// 是否有类别需要在后台压缩
+func (r *storageRouter) anyCompresses() bool {
+	if r == nil {
+		return false
+	}
+	for _, c := range r.classes {
+		if c.Compress && c.Codec != codecNone {
+			return true
+		}
+	}
+	return false
+}
+
+// 存储类别的根目录
+func (r *storageRouter) roots() []string {
+	if r == nil {
+		return nil
+	}
+	roots := make([]string, 0, len(r.classes))
+	for _, class := range sortedKeys(r.classes) {
+		roots = append(roots, r.classes[class].Root)
+	}
+	return roots
+}
+
+// 删除分段文件，路由到存储类别的分段同时删除链接指向的文件
+func removeSegmentFile(segmentPath string) error {
+	if target, err := os.Readlink(segmentPath); err == nil {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Remove(segmentPath)
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/storage"
+)
+
+// 日志条目在存储中的位置，见 model.Ref
+type logRef = model.Ref
+
+// 按日期顺序遍历应用的全部日志，fn 返回 false 时停止遍历
+func (s *Service) forEachStoredLog(applicationID string, fn func(entry LogData, ref logRef) bool) error {
+	return s.forEachStoredLine(applicationID, parsedLineVisitor(fn))
+}
+
+// 按日期顺序遍历应用的全部原始日志行
+func (s *Service) forEachStoredLine(applicationID string, fn func(line string, ref logRef) bool) error {
+	return s.forEachStoredLineBetween(context.Background(), applicationID, time.Time{}, time.Time{}, fn)
+}
+
+// 只遍历可能包含 [from, to] 内日志的分段，零值表示不限。分段内的日志仍需调用方按时间过滤
+func (s *Service) forEachStoredLogBetween(ctx context.Context, applicationID string, from, to time.Time, fn func(entry LogData, ref logRef) bool) error {
+	return s.forEachStoredLineBetween(ctx, applicationID, from, to, parsedLineVisitor(fn))
+}
+
+// 按 segmentInRange 跳过不可能包含时间范围内日志的分段，避免从对象存储取回已分层的旧分段。
+// ctx 取消或超时后停止遍历并返回其错误
+func (s *Service) forEachStoredLineBetween(ctx context.Context, applicationID string, from, to time.Time, fn func(line string, ref logRef) bool) error {
+	if qs, ok := s.queryStoreOf(applicationID); ok {
+		return qs.ScanLines(storage.Filter{Context: ctx, ApplicationID: applicationID, From: from, To: to}, fn)
+	}
+	appFolder := s.applicationDir(applicationID)
+	return s.forEachStoredSegmentLine(ctx, applicationID, func(name string) bool {
+		return segmentInRange(name, s.histogramCounts.ClosedSegment(appFolder, name), from, to)
+	}, fn)
+}
+
+// 依次遍历 keep 返回 true 的本地分段中的日志行
+func (s *Service) forEachStoredSegmentLine(ctx context.Context, applicationID string, keep func(name string) bool, fn func(line string, ref logRef) bool) error {
+	appFolder := s.applicationDir(applicationID)
+	names, err := listSegments(appFolder)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !keep(name) {
+			continue
+		}
+		ref := logRef{ApplicationID: applicationID, File: name}
+		stop, err := s.scanFileLines(ctx, filepath.Join(appFolder, name), 0, func(line string, offset, next int64) bool {
+			ref.Offset = offset
+			return fn(line, ref)
+		})
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 将原始行回调转换为解析后的日志回调，无法解析的行（如文件头）被跳过
+func parsedLineVisitor(fn func(entry LogData, ref logRef) bool) func(line string, ref logRef) bool {
+	return func(line string, ref logRef) bool {
+		entry, err := parseLogLine(line)
+		if err != nil {
+			return true
+		}
+		// 版本 1 的日志行不包含应用 ID
+		if entry.ApplicationID == "" {
+			entry.ApplicationID = ref.ApplicationID
+		}
+		return fn(entry, ref)
+	}
+}
+
+// 遍历中每隔多少行检查一次查询是否已取消或超时
+const cancelCheckLines = 1024
+
+// 逐行读取分段的缓冲，大查询会依次打开成百上千个分段，复用缓冲避免每个分段重新分配
+var lineReaders = sync.Pool{New: func() any { return bufio.NewReaderSize(nil, 64<<10) }}
+
+// 从 start 偏移开始逐行读取分段，回调参数带有行首偏移和下一行的偏移，返回是否被 fn 中止。
+// 分段已被压缩时偏移按解压后的内容计算；ctx 取消或超时后停止读取并返回其错误
+func (s *Service) scanFileLines(ctx context.Context, filePath string, start int64, fn func(line string, offset, next int64) bool) (bool, error) {
+	rc, err := s.openSegment(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	reader := lineReaders.Get().(*bufio.Reader)
+	reader.Reset(rc)
+	defer func() {
+		reader.Reset(nil)
+		lineReaders.Put(reader)
+	}()
+	if start > 0 {
+		if file, ok := rc.(*os.File); ok {
+			if _, err := file.Seek(start, io.SeekStart); err != nil {
+				return false, err
+			}
+			reader.Reset(file)
+		} else if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+			return false, err
+		}
+	}
+
+	offset := start
+	for n := 1; ; n++ {
+		if n%cancelCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+		}
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			lineOffset := offset
+			offset += int64(len(line))
+			if !fn(s.encryption.Open(filePath, strings.TrimRight(line, "\r\n")), lineOffset, offset) {
+				return true, nil
+			}
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// 依次读取一组引用指向的原始行，相邻的同文件引用复用同一个文件句柄
+func (s *Service) forEachRefLine(refs []logRef, fn func(line string, ref logRef) bool) error {
+	var reader *segmentReader
+	defer func() {
+		if reader != nil {
+			reader.Close()
+		}
+	}()
+
+	for i := 0; i < len(refs); i++ {
+		ref := refs[i]
+		// 其他后端的日志按连续的同一应用引用成批读取
+		if qs, ok := s.queryStoreOf(ref.ApplicationID); ok {
+			j := i + 1
+			for j < len(refs) && refs[j].ApplicationID == ref.ApplicationID {
+				j++
+			}
+			lines, err := qs.Lines(ref.ApplicationID, refs[i:j])
+			if err != nil {
+				return err
+			}
+			for _, ref := range refs[i:j] {
+				line, ok := lines[ref.Offset]
+				if !ok {
+					return fmt.Errorf("log %s/%s@%d: %w", ref.ApplicationID, ref.File, ref.Offset, os.ErrNotExist)
+				}
+				if !fn(line, ref) {
+					return nil
+				}
+			}
+			i = j - 1
+			continue
+		}
+
+		path := filepath.Join(s.applicationDir(ref.ApplicationID), ref.File)
+		if reader == nil || reader.path != path {
+			if reader != nil {
+				reader.Close()
+			}
+			reader = &segmentReader{svc: s, path: path}
+		}
+
+		line, err := reader.lineAt(ref.Offset)
+		if err != nil {
+			return err
+		}
+		if !fn(line, ref) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 查询结果的大小限制
+type QueryConfig struct {
+	MaxLimit         int   `json:"max_limit"`          // limit 参数的上限，默认 10000
+	MaxResponseBytes int64 `json:"max_response_bytes"` // 单次响应中日志的总字节数上限，默认 64MB
+	CacheMB          int   `json:"cache_mb"`           // 分段查询结果缓存的大小，默认 64MB，负数关闭缓存
+	MaxMessageBytes  int   `json:"max_message_bytes"`  // 查询结果中单条 log_message 的最大字节数，超过时截断并标记，默认 16KB，负数不截断
+
+	// 需要扫描日志的查询和分析接口的并发与耗时限制
+	MaxConcurrent int      `json:"max_concurrent"` // 同时执行的查询数，0 表示不限
+	MaxQueued     int      `json:"max_queued"`     // 排队等待的查询数，队列已满时直接返回 503；默认与 max_concurrent 相同
+	QueueTimeout  Duration `json:"queue_timeout"`  // 排队的最长时间，超过后返回 503，默认 10s
+	Timeout       Duration `json:"timeout"`        // 单次查询的截止时间，超过后停止扫描并返回 504；0 表示不限
+}
+
+func (q QueryConfig) maxLimit() int {
+	if q.MaxLimit <= 0 {
+		return 10000
+	}
+	return q.MaxLimit
+}
+
+func (q QueryConfig) maxResponseBytes() int64 {
+	if q.MaxResponseBytes <= 0 {
+		return 64 << 20
+	}
+	return q.MaxResponseBytes
+}
+
+func (q QueryConfig) maxMessageBytes() int {
+	if q.MaxMessageBytes == 0 {
+		return 16 << 10
+	}
+	return q.MaxMessageBytes
+}
+
+func (q QueryConfig) cacheBytes() int64 {
+	if q.CacheMB == 0 {
+		return 64 << 20
+	}
+	return int64(q.CacheMB) << 20
+}
+
+// 每写入这么多条日志刷新一次，让客户端尽早收到数据
+const streamFlushEvery = 100
+
+var queryTruncated = metrics.counter("query_truncated_total", "Query responses cut short by max_response_bytes.")
+
+// 客户端要求 NDJSON 格式：format=ndjson 或 Accept: application/x-ndjson
+func wantsNDJSON(c *gin.Context) bool {
+	return c.Query("format") == "ndjson" || strings.Contains(c.GetHeader("Accept"), "application/x-ndjson")
+}
+
+// 逐条编码并写出查询结果，超过字节上限时停止，返回写出的条数和是否被截断。
+// NDJSON 格式每行一条日志，截断时通过 X-Truncated 尾部头告知；
+// JSON 格式与之前的响应结构相同，并附带 truncated 字段。project 不为空时每条日志只输出选择的字段，
+// highlight 不为空时每条日志附带 highlight 字段。超过 max_message_bytes 的消息截断，附带 message_truncated 和原始的
+// message_bytes，完整的日志通过 GET /logs/{id} 获取；full_message=true 时不截断
+func (s *Service) writeQueryResults(c *gin.Context, meta map[string]interface{}, hits []QueryHit, project *fieldProjection, highlight *searchHighlighter) (int, bool) {
+	ndjson := wantsNDJSON(c)
+	if ndjson {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Trailer", "X-Truncated")
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if !ndjson {
+		w.WriteString("{")
+		for _, k := range sortedKeys(meta) {
+			key, _ := json.Marshal(k)
+			value, err := json.Marshal(meta[k])
+			if err != nil {
+				continue
+			}
+			w.Write(key)
+			w.WriteString(":")
+			w.Write(value)
+			w.WriteString(",")
+		}
+		w.WriteString(`"logs":[`)
+	}
+
+	limit := s.cfg.Query.maxResponseBytes()
+	maxMessage := s.cfg.Query.maxMessageBytes()
+	if c.Query("full_message") == "true" {
+		maxMessage = -1
+	}
+	var written int64
+	count, truncated := 0, false
+	for i := range hits {
+		s.maskQueryEntry(&hits[i].Entry)
+		size := len(hits[i].Entry.LogMessage)
+		cut := maxMessage >= 0 && size > maxMessage
+		if cut {
+			hits[i].Entry.LogMessage = truncateUTF8(hits[i].Entry.LogMessage, maxMessage)
+		}
+		data, err := project.Marshal(s.linkTrace(hits[i].Entry))
+		if err != nil {
+			continue
+		}
+		data = highlight.Append(data, hits[i].Entry.LogMessage)
+		if cut && project.Selects("log_message") {
+			data = appendJSONMember(data, "message_truncated", true)
+			data = appendJSONMember(data, "message_bytes", size)
+		}
+		if written+int64(len(data)) > limit {
+			truncated = true
+			break
+		}
+		written += int64(len(data))
+		// 写出后释放，避免整份结果在编码期间一直占用内存
+		hits[i] = QueryHit{}
+
+		if ndjson {
+			w.Write(append(data, '\n'))
+		} else {
+			if count > 0 {
+				w.WriteString(",")
+			}
+			w.Write(data)
+		}
+		count++
+		if count%streamFlushEvery == 0 {
+			w.Flush()
+		}
+	}
+
+	if ndjson {
+		if truncated {
+			w.Header().Set("X-Truncated", "true")
+		}
+	} else {
+		truncatedJSON, _ := json.Marshal(truncated)
+		w.WriteString(`],"truncated":`)
+		w.Write(truncatedJSON)
+		w.WriteString("}")
+	}
+	if truncated {
+		queryTruncated.Add(1)
+	}
+	return count, truncated
+}
+
+// 在编码好的 JSON 对象末尾追加一个成员
+func appendJSONMember(data []byte, key string, value interface{}) []byte {
+	v, err := json.Marshal(value)
+	if err != nil || len(data) < 2 || data[len(data)-1] != '}' {
+		return data
+	}
+	out := append([]byte(nil), data[:len(data)-1]...)
+	if len(data) > 2 {
+		out = append(out, ',')
+	}
+	k, _ := json.Marshal(key)
+	out = append(append(append(out, k...), ':'), v...)
+	return append(out, '}')
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"logAnalysis/pkg/model"
+)
+
+// WebSocket 查询订阅：客户端连接后发送过滤条件，服务端先按时间顺序回放最近的匹配日志，再持续推送新写入的匹配日志。
+// 连接期间再次发送过滤条件会替换之前的订阅并重新回放，供交互式排查使用
+type subscriptionFilter struct {
+	ApplicationIDs []string            `json:"application_ids"` // 为空时为全部有权访问的应用
+	Levels         []string            `json:"levels"`          // 满足其一即可，为空时不限
+	Regex          string              `json:"regex"`           // 日志消息须匹配的正则
+	XID            string              `json:"xid"`             // XID 字段或消息中包含该 XID
+	Fields         map[string][]string `json:"fields"`          // 结构化字段过滤条件，同 field.<key>=<value>
+	Backfill       *int                `json:"backfill"`        // 回放的最近匹配条数，默认 100，0 表示不回放
+}
+
+// 推送的消息，type 为 backfill、backfill_end、entry、heartbeat 或 error
+type subscriptionMessage struct {
+	Type  string   `json:"type"`
+	Entry *LogData `json:"entry,omitempty"`
+	Count int      `json:"count,omitempty"` // backfill_end 时为回放的条数
+	Error string   `json:"error,omitempty"`
+}
+
+const defaultSubscriptionBackfill = 100
+
+// 编译后的订阅条件
+type subscription struct {
+	svc      *Service
+	apps     []string        // 存储使用的应用 ID，all 为 true 时只用于回放
+	all      bool            // 未指定应用，实时推送时按权限匹配任意应用
+	visible  map[string]bool // apps 的集合
+	match    func(entry LogData) bool
+	backfill int
+}
+
+// 校验过滤条件和访问权限。连接已升级为 WebSocket，错误以消息的形式返回而不是 HTTP 响应
+func (s *Service) compileSubscription(c *gin.Context, f subscriptionFilter) (*subscription, error) {
+	compiled := &subscription{svc: s, backfill: defaultSubscriptionBackfill, visible: make(map[string]bool)}
+	if f.Backfill != nil {
+		compiled.backfill = *f.Backfill
+	}
+	if compiled.backfill < 0 {
+		return nil, errors.New("Backfill must not be negative")
+	}
+	if max := s.cfg.Query.maxLimit(); compiled.backfill > max {
+		compiled.backfill = max
+	}
+
+	user, permission, tenant := currentUser(c), c.GetString("permission"), c.GetString("tenant")
+	for _, app := range f.ApplicationIDs {
+		if !validApplicationID(app) {
+			return nil, errors.New("Invalid application_id: " + app)
+		}
+		if tenant != "" {
+			app = tenant + model.TenantSeparator + app
+		}
+		if user != nil && !user.Allowed(permission, app) {
+			rbacDenied.Add(1, "reason", "application")
+			return nil, errors.New("Permission denied for application " + model.BareApplicationID(app))
+		}
+		if s.lifecycle.Deleted(app) {
+			return nil, errors.New("Application not found: " + model.BareApplicationID(app))
+		}
+		compiled.apps = append(compiled.apps, app)
+	}
+	if len(compiled.apps) == 0 {
+		compiled.all = true
+		var err error
+		if tenant != "" {
+			compiled.apps, err = s.tenantApplications(tenant)
+		} else {
+			compiled.apps, err = s.listApplications()
+		}
+		if err != nil {
+			return nil, errors.New("Unable to list applications")
+		}
+		compiled.apps = permittedApplications(c, compiled.apps)
+	}
+	for _, app := range compiled.apps {
+		compiled.visible[app] = true
+	}
+
+	var re *regexp.Regexp
+	if f.Regex != "" {
+		var err error
+		if re, err = regexp.Compile(f.Regex); err != nil {
+			return nil, errors.New("Invalid regex: " + err.Error())
+		}
+	}
+	levels := make(map[string]bool, len(f.Levels))
+	for _, level := range f.Levels {
+		levels[strings.ToUpper(level)] = true
+	}
+	compiled.match = func(entry LogData) bool {
+		if len(levels) > 0 && !levels[entry.LogLevel] {
+			return false
+		}
+		if f.XID != "" && entry.XID != f.XID && !strings.Contains(entry.LogMessage, f.XID) {
+			return false
+		}
+		return (re == nil || re.MatchString(entry.LogMessage)) && matchesFields(entry, f.Fields)
+	}
+
+	// 未指定应用时实时推送新出现的应用，按租户和权限过滤
+	if compiled.all {
+		match := compiled.match
+		compiled.match = func(entry LogData) bool {
+			owner, _ := model.SplitApplicationID(entry.ApplicationID)
+			return owner == tenant && (user == nil || user.Allowed(permission, entry.ApplicationID)) &&
+				!s.lifecycle.Deleted(entry.ApplicationID) && match(entry)
+		}
+	}
+	return compiled, nil
+}
+
+// 实时推送是否包含该日志
+func (s *subscription) live(entry LogData) bool {
+	return (s.all || s.visible[entry.ApplicationID]) && s.match(entry)
+}
+
+// 最近的匹配日志，按时间顺序。同时返回各应用回放到的最大日志 ID，实时推送跳过已回放的日志
+func (s *subscription) recent(c *gin.Context) ([]LogData, map[string]int64, error) {
+	seen := make(map[string]int64)
+	if s.backfill == 0 || len(s.apps) == 0 {
+		return nil, seen, nil
+	}
+	hits, err := s.svc.collectSorted(logQuery{ApplicationIDs: s.apps, Match: s.match, ctx: c.Request.Context()}, sortDesc, s.backfill, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := make([]LogData, 0, len(hits))
+	for i := len(hits) - 1; i >= 0; i-- {
+		entry := hits[i].Entry
+		app := hits[i].Ref.ApplicationID
+		if entry.ID > seen[app] {
+			seen[app] = entry.ID
+		}
+		entries = append(entries, entry)
+	}
+	return entries, seen, nil
+}
+
+func (s *Service) sendSubscriptionEntry(ws *websocket.Conn, kind string, entry LogData) error {
+	entry.ApplicationID = model.BareApplicationID(entry.ApplicationID)
+	s.maskQueryEntry(&entry)
+	return websocket.JSON.Send(ws, subscriptionMessage{Type: kind, Entry: &entry})
+}
+
+// 来源不被允许的 WebSocket 握手
+var (
+	errWebSocketOrigin      = errors.New("websocket origin not allowed")
+	subscribeOriginRejected = metrics.counter("subscribe_origin_rejected_total", "WebSocket subscriptions rejected because the Origin is not allowed.")
+)
+
+// WebSocket 订阅接口：客户端发送 JSON 过滤条件，服务端推送 JSON 消息
+func (s *Service) logSubscribeHandler(c *gin.Context) {
+	server := websocket.Server{
+		// CORS 不限制 WebSocket，握手时按 allowed_origins 校验来源，拒绝时返回 403
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if !s.cfg.CORS.allowsWebSocketOrigin(r) {
+				subscribeOriginRejected.Add(1)
+				return errWebSocketOrigin
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			s.serveSubscription(c, ws)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (s *Service) serveSubscription(c *gin.Context, ws *websocket.Conn) {
+	// 读取客户端发送的过滤条件，连接断开时关闭 requests；无法解析的消息回复错误，连接保持
+	type request struct {
+		filter subscriptionFilter
+		err    error
+	}
+	requests := make(chan request)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(requests)
+		for {
+			var r request
+			if err := websocket.JSON.Receive(ws, &r.filter); err != nil {
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+					return
+				}
+				r.err = errors.New("Invalid JSON format")
+			}
+			select {
+			case requests <- r:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+
+	var sub *tailSubscriber
+	var compiled *subscription
+	var seen map[string]int64
+	defer func() {
+		if sub != nil {
+			s.tailHub.Unsubscribe(sub)
+		}
+	}()
+	var live <-chan LogData
+	for {
+		select {
+		case r, ok := <-requests:
+			if !ok {
+				return
+			}
+			if sub != nil {
+				s.tailHub.Unsubscribe(sub)
+				sub, live = nil, nil
+			}
+			err := r.err
+			if err == nil {
+				compiled, err = s.compileSubscription(c, r.filter)
+			}
+			if err != nil {
+				if websocket.JSON.Send(ws, subscriptionMessage{Type: "error", Error: err.Error()}) != nil {
+					return
+				}
+				continue
+			}
+			// 先订阅再回放，回放期间写入的日志缓冲在订阅中，按日志 ID 去掉与回放重复的部分
+			sub = s.tailHub.Subscribe(compiled.live)
+			live = sub.ch
+			var entries []LogData
+			entries, seen, err = compiled.recent(c)
+			if err != nil {
+				websocket.JSON.Send(ws, subscriptionMessage{Type: "error", Error: "Failed to read logs: " + err.Error()})
+				return
+			}
+			for _, entry := range entries {
+				if s.sendSubscriptionEntry(ws, "backfill", entry) != nil {
+					return
+				}
+			}
+			if websocket.JSON.Send(ws, subscriptionMessage{Type: "backfill_end", Count: len(entries)}) != nil {
+				return
+			}
+		case entry := <-live:
+			if entry.ID != 0 && entry.ID <= seen[entry.ApplicationID] {
+				continue
+			}
+			if s.sendSubscriptionEntry(ws, "entry", entry) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if websocket.JSON.Send(ws, subscriptionMessage{Type: "heartbeat"}) != nil {
+				return
+			}
+		case <-s.shuttingDown:
+			return
+		}
+	}
+}
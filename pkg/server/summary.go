@@ -0,0 +1,68 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"logAnalysis/pkg/model"
+)
+
+// 查询结果中单个日志文件的概览，统计的是全部匹配的日志而不只是返回的前 limit 条
+type fileSummary struct {
+	ApplicationID string         `json:"application_id"`
+	File          string         `json:"file"`
+	Day           string         `json:"day"` // 文件所属的日期
+	Count         int            `json:"count"`
+	Levels        map[string]int `json:"levels"`
+	Earliest      string         `json:"earliest"`
+	Latest        string         `json:"latest"`
+
+	earliest, latest time.Time
+}
+
+// 按文件汇总查询匹配的日志，客户端不必再单独调用 /stats
+type querySummary struct {
+	files map[logRef]*fileSummary
+}
+
+func newQuerySummary() *querySummary {
+	return &querySummary{files: make(map[logRef]*fileSummary)}
+}
+
+// 计入一条匹配的日志
+func (s *querySummary) Add(hit QueryHit) {
+	key := logRef{ApplicationID: hit.Ref.ApplicationID, File: hit.Ref.File}
+	f, ok := s.files[key]
+	if !ok {
+		f = &fileSummary{ApplicationID: model.BareApplicationID(key.ApplicationID), File: key.File, Levels: make(map[string]int)}
+		if day := logFileDate(key.File); !day.IsZero() {
+			f.Day = day.Format("2006-01-02")
+		}
+		s.files[key] = f
+	}
+	f.Count++
+	f.Levels[hit.Entry.LogLevel]++
+	if f.earliest.IsZero() || hit.At.Before(f.earliest) {
+		f.earliest = hit.At
+	}
+	if hit.At.After(f.latest) {
+		f.latest = hit.At
+	}
+}
+
+// 按日期排序的文件概览，时间戳按 loc 显示
+func (s *querySummary) Files(loc *time.Location) []fileSummary {
+	list := make([]fileSummary, 0, len(s.files))
+	for _, f := range s.files {
+		f.Earliest = f.earliest.In(loc).Format(time.RFC3339Nano)
+		f.Latest = f.latest.In(loc).Format(time.RFC3339Nano)
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].File != list[j].File {
+			return list[i].File < list[j].File
+		}
+		return list[i].ApplicationID < list[j].ApplicationID
+	})
+	return list
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"logAnalysis/pkg/parser"
+)
+
+// syslog（RFC 5424）输入，UDP 和 TCP 可分别启用
+type SyslogConfig struct {
+	UDP string `json:"udp"` // UDP 监听地址，如 :5514
+	TCP string `json:"tcp"` // TCP 监听地址，支持换行分隔和 RFC 6587 八位组计数两种分帧
+}
+
+// 单条 syslog 消息的最大长度
+const maxSyslogMessage = 1 << 20
+
+var (
+	syslogRecords  = metrics.counter("syslog_records_total", "Log entries received over syslog.")
+	syslogRejected = metrics.counter("syslog_rejected_total", "Syslog messages that could not be parsed or ingested.")
+)
+
+// syslog 严重级别到日志级别的映射，emerg、alert、crit 都视为 FATAL
+var syslogSeverityLevels = [8]string{"FATAL", "FATAL", "FATAL", "ERROR", "WARN", "INFO", "INFO", "DEBUG"}
+
+// 解析一条 RFC 5424 消息：<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]。
+// APP-NAME 作为 application_id，主机名、进程号、消息 ID 和结构化数据作为自定义字段
+func parseSyslog5424(line string, now time.Time) (LogData, error) {
+	var entry LogData
+	if !strings.HasPrefix(line, "<") {
+		return entry, errors.New("missing PRI")
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return entry, errors.New("invalid PRI")
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri > 191 {
+		return entry, errors.New("invalid PRI")
+	}
+	rest := line[end+1:]
+
+	header := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		field, tail, _ := strings.Cut(rest, " ")
+		header = append(header, field)
+		rest = tail
+	}
+	if header[0] != "1" {
+		return entry, fmt.Errorf("unsupported syslog version %q", header[0])
+	}
+	timestamp, hostname, app, procID, msgID := header[1], header[2], header[3], header[4], header[5]
+	if app == "-" || !validApplicationID(app) {
+		return entry, errors.New("missing or invalid APP-NAME")
+	}
+
+	fields := map[string]string{"facility": strconv.Itoa(pri / 8)}
+	for k, v := range map[string]string{"host": hostname, "procid": procID, "msgid": msgID} {
+		if v != "-" && v != "" {
+			fields[k] = v
+		}
+	}
+	msg, err := parseStructuredData(rest, fields)
+	if err != nil {
+		return entry, err
+	}
+	msg = strings.TrimPrefix(msg, "\ufeff") // MSG 可以以 UTF-8 BOM 开头
+
+	at := now
+	if timestamp != "-" {
+		if at, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return entry, fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+	}
+
+	// 消息本身是 Seata TC 布局时保留其中的级别、logger 和线程
+	if seata, ok := parser.ParseSeataLine(app, msg, at); ok {
+		entry = seata
+	} else {
+		entry = LogData{ApplicationID: app, LogLevel: syslogSeverityLevels[pri%8], Timestamp: at.Format(time.RFC3339Nano), LogMessage: msg}
+	}
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]string)
+	}
+	for k, v := range fields {
+		if len(entry.Fields) >= 64 {
+			break
+		}
+		entry.Fields[k] = v
+	}
+	return entry, nil
+}
+
+// 解析 STRUCTURED-DATA，参数以 "SD-ID.参数名" 写入 fields，返回结构化数据之后的消息
+func parseStructuredData(s string, fields map[string]string) (string, error) {
+	if strings.HasPrefix(s, "-") {
+		return strings.TrimPrefix(s[1:], " "), nil
+	}
+	if !strings.HasPrefix(s, "[") {
+		return "", errors.New("invalid structured data")
+	}
+	for strings.HasPrefix(s, "[") {
+		i := 1
+		for i < len(s) && s[i] != ' ' && s[i] != ']' {
+			i++
+		}
+		id := s[1:i]
+		for i < len(s) && s[i] == ' ' {
+			// PARAM-NAME="PARAM-VALUE"，值中的 \" \\ \] 为转义
+			j := i + 1
+			for j < len(s) && s[j] != '=' {
+				j++
+			}
+			if j+1 >= len(s) || s[j+1] != '"' {
+				return "", errors.New("invalid structured data")
+			}
+			name := s[i+1 : j]
+			var value strings.Builder
+			k := j + 2
+			for ; k < len(s) && s[k] != '"'; k++ {
+				if s[k] == '\\' && k+1 < len(s) {
+					k++
+				}
+				value.WriteByte(s[k])
+			}
+			if k >= len(s) {
+				return "", errors.New("unterminated structured data value")
+			}
+			fields[id+"."+name] = value.String()
+			i = k + 1
+		}
+		if i >= len(s) || s[i] != ']' {
+			return "", errors.New("unterminated structured data")
+		}
+		s = s[i+1:]
+	}
+	return strings.TrimPrefix(s, " "), nil
+}
+
+// syslog 监听器
+type syslogServer struct {
+	svc      *Service
+	udp      net.PacketConn
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+
+	wg sync.WaitGroup
+}
+
+// 启动 syslog 监听，UDP 和 TCP 都未配置时返回 nil
+func (s *Service) startSyslogServer(c SyslogConfig) (*syslogServer, error) {
+	if c.UDP == "" && c.TCP == "" {
+		return nil, nil
+	}
+	srv := &syslogServer{svc: s, conns: make(map[net.Conn]bool)}
+	if c.UDP != "" {
+		conn, err := net.ListenPacket("udp", c.UDP)
+		if err != nil {
+			return nil, err
+		}
+		srv.udp = conn
+		srv.wg.Add(1)
+		go srv.serveUDP()
+		log.Printf("Syslog input listening on udp %s", c.UDP)
+	}
+	if c.TCP != "" {
+		ln, err := net.Listen("tcp", c.TCP)
+		if err != nil {
+			srv.Close()
+			return nil, err
+		}
+		srv.listener = ln
+		srv.wg.Add(1)
+		go srv.acceptLoop()
+		log.Printf("Syslog input listening on tcp %s", c.TCP)
+	}
+	return srv, nil
+}
+
+func (s *syslogServer) Close() error {
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// 解析并写入一条消息
+func (s *syslogServer) handle(line, source string) {
+	line = strings.TrimRight(line, "\r\n\x00")
+	if line == "" {
+		return
+	}
+	entry, err := parseSyslog5424(line, time.Now())
+	if err == nil {
+		entry.Source = source
+		_, err = s.svc.ingestEntry(entry)
+	}
+	if errors.Is(err, errDroppedEntry) {
+		return
+	}
+	if err != nil && !errors.Is(err, errDuplicateEntry) {
+		syslogRejected.Add(1)
+		return
+	}
+	syslogRecords.Add(1)
+}
+
+func (s *syslogServer) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog udp read failed: %v", err)
+			}
+			return
+		}
+		if !s.svc.netPolicy.AllowsAddr(permWrite, addr.String()) {
+			networkDenied.Add(1, "class", networkClasses[permWrite])
+			continue
+		}
+		s.handle(string(buf[:n]), addrHost(addr.String()))
+	}
+}
+
+func (s *syslogServer) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog accept failed: %v", err)
+			}
+			return
+		}
+		if !s.svc.netPolicy.AllowsAddr(permWrite, conn.RemoteAddr().String()) {
+			networkDenied.Add(1, "class", networkClasses[permWrite])
+			conn.Close()
+			continue
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveTCP(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// TCP 分帧：以数字开头时为八位组计数（"长度 空格 消息"），否则按换行分隔
+func (s *syslogServer) serveTCP(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+		if first[0] >= '0' && first[0] <= '9' {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+			if err != nil || n <= 0 || n > maxSyslogMessage {
+				log.Printf("syslog connection %s: invalid frame length %q", conn.RemoteAddr(), size)
+				return
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			s.handle(string(msg), addrHost(conn.RemoteAddr().String()))
+			continue
+		}
+
+		line, err := readSyslogLine(r)
+		if errors.Is(err, errSyslogTooLong) {
+			log.Printf("syslog connection %s: message exceeds %d bytes", conn.RemoteAddr(), maxSyslogMessage)
+			return
+		}
+		s.handle(line, addrHost(conn.RemoteAddr().String()))
+		if err != nil {
+			return
+		}
+	}
+}
+
+var errSyslogTooLong = errors.New("syslog message too long")
+
+// 读取一行，超过最大长度时返回 errSyslogTooLong
+func readSyslogLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxSyslogMessage {
+			return "", errSyslogTooLong
+		}
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 每个订阅者的缓冲长度，消费过慢时丢弃新日志而不阻塞写入
+const tailBufferSize = 256
+
+// 实时推送的心跳间隔
+const tailHeartbeat = 15 * time.Second
+
+// 实时日志订阅者
+type tailSubscriber struct {
+	ch     chan LogData
+	filter func(entry LogData) bool
+}
+
+// 实时日志分发中心
+type TailHub struct {
+	mu   sync.RWMutex
+	subs map[*tailSubscriber]struct{}
+}
+
+var tailDropped = metrics.counter("tail_dropped_total", "Log entries dropped for slow tail subscribers.")
+
+// 订阅满足 filter 的新日志
+func (h *TailHub) Subscribe(filter func(entry LogData) bool) *tailSubscriber {
+	sub := &tailSubscriber{ch: make(chan LogData, tailBufferSize), filter: filter}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// 取消订阅
+func (h *TailHub) Unsubscribe(sub *tailSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+}
+
+// 订阅者数量和各订阅者缓冲中等待推送的日志总数
+func (h *TailHub) Buffered() (int, int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for sub := range h.subs {
+		n += len(sub.ch)
+	}
+	return len(h.subs), n
+}
+
+// 分发一条新日志
+func (h *TailHub) Publish(entry LogData) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		if !sub.filter(entry) {
+			continue
+		}
+		select {
+		case sub.ch <- entry:
+		default:
+			tailDropped.Add(1)
+		}
+	}
+}
+
+// 实时日志接口：以 NDJSON 流的形式持续返回新写入的日志，空行为心跳
+func (s *Service) logTailHandler(c *gin.Context) {
+	applicationID := c.Query("application_id")
+	logLevel := c.Query("log_level")
+	if applicationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id is required"})
+		return
+	}
+	applicationID, ok := s.queriedApplicationID(c, applicationID)
+	if !ok {
+		return
+	}
+
+	fields := parseFieldFilters(c)
+	sub := s.tailHub.Subscribe(func(entry LogData) bool {
+		return entry.ApplicationID == applicationID && (logLevel == "" || entry.LogLevel == logLevel) && matchesFields(entry, fields)
+	})
+	defer s.tailHub.Unsubscribe(sub)
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case entry := <-sub.ch:
+			entry.ApplicationID = model.BareApplicationID(entry.ApplicationID)
+			s.maskQueryEntry(&entry)
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return true
+			}
+			w.Write(append(data, '\n'))
+			return true
+		case <-heartbeat.C:
+			w.Write([]byte("\n"))
+			return true
+		case <-s.shuttingDown:
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+	"logAnalysis/pkg/parser"
+)
+
+// TC 节点标识：TC 集群中每台 TC 都写同一个应用，排查脑裂和选主问题时需要知道每行日志来自哪个节点。
+// 写入时为 TC 应用的日志打上 tc_node 字段，依次取上传时提供的 tc_node、配置的自定义字段（如 pod）、
+// raft 日志中的本节点地址（Node <default/10.0.0.1:9091>），最后是上传方的 IP。
+// 查询时可按 tc_node=seata-0 过滤，/aggregate 可按 tc_node 分组
+type TCNodeConfig struct {
+	Applications []string `json:"applications"` // TC 的应用 ID（支持通配符），默认 seata-server*、seata-tc*
+	Fields       []string `json:"fields"`       // 依次作为节点标识的自定义字段，默认 node_id、pod、hostname、host
+}
+
+// 写入时标记 TC 节点的自定义字段
+const tcNodeField = "tc_node"
+
+var tcNodesTagged = metrics.counter("tc_nodes_tagged_total", "TC log entries tagged with the node that produced them, by source of the identity.")
+
+// raft 日志中的本节点，如 Node <default/10.0.0.1:9091> term 3 start preVote
+var raftNodePattern = regexp.MustCompile(`\bNode <[^/>]*/([\w.\-]+:\d+)>`)
+
+// 编译后的配置
+type tcNodeTagger struct {
+	applications []string
+	fields       []string
+}
+
+func newTCNodeTagger(c TCNodeConfig) (*tcNodeTagger, error) {
+	if len(c.Applications) == 0 {
+		c.Applications = []string{"seata-server*", "seata-tc*"}
+	}
+	if len(c.Fields) == 0 {
+		c.Fields = []string{"node_id", "pod", "hostname", "host"}
+	}
+	for _, pattern := range c.Applications {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid application pattern %q", pattern)
+		}
+	}
+	return &tcNodeTagger{applications: c.Applications, fields: c.Fields}, nil
+}
+
+// 是否为 TC 的应用
+func (t *tcNodeTagger) Matches(applicationID string) bool {
+	return matchApplicationPatterns(t.applications, applicationID)
+}
+
+// 日志消息中 raft 输出的本节点地址
+func raftNode(message string) string {
+	if m := raftNodePattern.FindStringSubmatch(message); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// 写入前标记 TC 节点，上传时提供的 tc_node 保持不变，不是 TC 应用或无法确定节点时不标记
+func (t *tcNodeTagger) Tag(entry *LogData) {
+	if v := strings.TrimSpace(entry.Fields[tcNodeField]); v != "" {
+		entry.Fields[tcNodeField] = v
+		return
+	}
+	if !t.Matches(entry.ApplicationID) {
+		return
+	}
+	node, source := "", ""
+	for _, key := range t.fields {
+		if v := strings.TrimSpace(entry.Fields[key]); v != "" {
+			node, source = v, "field"
+			break
+		}
+	}
+	if node == "" {
+		if node = raftNode(entry.LogMessage); node != "" {
+			source = "raft"
+		}
+	}
+	if node == "" {
+		if ip := net.ParseIP(entry.Source); ip != nil {
+			node, source = ip.String(), "source_ip"
+		}
+	}
+	if node == "" {
+		return
+	}
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]string)
+	}
+	entry.Fields[tcNodeField] = node
+	tcNodesTagged.Add(1, "source", source)
+}
+
+// 单个 TC 节点在时间范围内的日志
+type tcNodeStats struct {
+	ApplicationID string         `json:"application_id"`
+	Node          string         `json:"node"`
+	Total         int            `json:"total"`
+	Levels        map[string]int `json:"levels"`
+	FirstSeen     time.Time      `json:"first_seen"`
+	LastSeen      time.Time      `json:"last_seen"`
+	LeaderTerms   []int64        `json:"leader_terms"` // 该节点成为 leader 的任期
+}
+
+// 一次成为 leader
+type tcLeaderChange struct {
+	ApplicationID string    `json:"application_id"`
+	Node          string    `json:"node"`
+	Term          int64     `json:"term"`
+	At            time.Time `json:"at"`
+}
+
+// 同一任期内有多个节点成为 leader，说明集群出现了脑裂
+type tcLeaderConflict struct {
+	ApplicationID string   `json:"application_id"`
+	Term          int64    `json:"term"`
+	Nodes         []string `json:"nodes"`
+}
+
+// 同一任期有多个 leader 的冲突，按应用和任期排序
+func leaderConflicts(changes []tcLeaderChange) []tcLeaderConflict {
+	type key struct {
+		app  string
+		term int64
+	}
+	leaders := make(map[key]map[string]bool)
+	for _, ch := range changes {
+		k := key{ch.ApplicationID, ch.Term}
+		if leaders[k] == nil {
+			leaders[k] = make(map[string]bool)
+		}
+		leaders[k][ch.Node] = true
+	}
+	conflicts := make([]tcLeaderConflict, 0)
+	for k, nodes := range leaders {
+		if len(nodes) > 1 {
+			conflicts = append(conflicts, tcLeaderConflict{ApplicationID: k.app, Term: k.term, Nodes: sortedKeys(nodes)})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].ApplicationID != conflicts[j].ApplicationID {
+			return conflicts[i].ApplicationID < conflicts[j].ApplicationID
+		}
+		return conflicts[i].Term < conflicts[j].Term
+	})
+	return conflicts
+}
+
+// TC 节点接口：按节点统计 TC 应用在时间范围内的日志，列出 raft 选主记录和同一任期的多个 leader。
+// application_id 为空时为配置中的全部 TC 应用
+func (s *Service) tcNodesHandler(c *gin.Context) {
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+	if c.Query("application_id") == "" {
+		tc := apps[:0:0]
+		for _, app := range apps {
+			if s.tcNodes.Matches(app) {
+				tc = append(tc, app)
+			}
+		}
+		apps = tc
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+
+	nodes := make(map[string]*tcNodeStats)
+	changes := make([]tcLeaderChange, 0)
+	for _, app := range apps {
+		err := s.forEachStoredLogBetween(c.Request.Context(), app, from, to, func(entry LogData, ref logRef) bool {
+			at := entryTime(entry, ref)
+			if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+				return true
+			}
+			// 没有节点标识的日志归入空节点
+			node, _ := logFieldValue(entry, tcNodeField)
+			key := app + "\x00" + node
+			st, ok := nodes[key]
+			if !ok {
+				st = &tcNodeStats{ApplicationID: model.BareApplicationID(app), Node: node, Levels: make(map[string]int), FirstSeen: at, LastSeen: at, LeaderTerms: []int64{}}
+				nodes[key] = st
+			}
+			// 选主记录使用 raft 地址，任期同时记在产生日志的节点上（节点标识可能是 pod 名）
+			if m := parser.RaftLeaderPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+				term, _ := strconv.ParseInt(m[2], 10, 64)
+				changes = append(changes, tcLeaderChange{ApplicationID: st.ApplicationID, Node: m[1], Term: term, At: at})
+				st.LeaderTerms = append(st.LeaderTerms, term)
+			}
+			st.Total++
+			st.Levels[entry.LogLevel]++
+			if at.Before(st.FirstSeen) {
+				st.FirstSeen = at
+			}
+			if at.After(st.LastSeen) {
+				st.LastSeen = at
+			}
+			return true
+		})
+		if err != nil {
+			readFailed(c, err)
+			return
+		}
+	}
+
+	list := make([]tcNodeStats, 0, len(nodes))
+	for _, key := range sortedKeys(nodes) {
+		list = append(list, *nodes[key])
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].At.Before(changes[j].At) })
+	c.JSON(http.StatusOK, gin.H{"nodes": list, "leader_changes": changes, "conflicts": leaderConflicts(changes)})
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 租户配置
+type TenantConfig struct {
+	StorageRoot string      `json:"storage_root"` // 租户独立的日志根目录，默认 tenants/<租户名>
+	APIKeys     []string    `json:"api_keys"`     // 访问租户接口所需的 API Key，为空时不校验（如开发环境）
+	Quota       TenantQuota `json:"quota"`
+}
+
+// 租户配额，按自然日统计，0 表示不限制
+type TenantQuota struct {
+	MaxEntriesPerDay int   `json:"max_entries_per_day"` // 每天最多写入的日志条数
+	MaxBytesPerDay   int64 `json:"max_bytes_per_day"`   // 每天最多写入的日志消息字节数
+}
+
+// 超出租户当天的写入配额
+var errTenantQuotaExceeded = errors.New("tenant quota exceeded")
+
+var tenantQuotaRejected = metrics.counter("tenant_quota_rejected_total", "Log entries rejected because the tenant daily quota was exhausted.")
+
+// 租户当天的写入量
+type tenantUsage struct {
+	Day     string `json:"day"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// 租户注册表
+type tenantRegistry struct {
+	configs map[string]TenantConfig
+	events  *eventHub // 超出配额时推送系统事件
+
+	mu    sync.Mutex
+	usage map[string]*tenantUsage // 仅在内存中统计，重启后重新计数
+}
+
+// 根据配置创建租户注册表，补全默认的存储根目录
+func newTenantRegistry(configs map[string]TenantConfig, events *eventHub) *tenantRegistry {
+	r := &tenantRegistry{configs: make(map[string]TenantConfig), events: events, usage: make(map[string]*tenantUsage)}
+	for name, c := range configs {
+		if c.StorageRoot == "" {
+			c.StorageRoot = filepath.Join("tenants", name)
+		}
+		r.configs[name] = c
+	}
+	return r
+}
+
+// 校验租户配置，租户名同样不能包含路径分隔符
+func (r *tenantRegistry) validate() error {
+	for name := range r.configs {
+		if !validApplicationID(name) {
+			return fmt.Errorf("invalid tenant name %q", name)
+		}
+	}
+	return nil
+}
+
+// 租户名称列表
+func (r *tenantRegistry) Names() []string {
+	names := make([]string, 0, len(r.configs))
+	for name := range r.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 按配额登记一条日志的写入，超出配额时返回 errTenantQuotaExceeded
+func (r *tenantRegistry) Reserve(tenant string, bytes int64, now time.Time) error {
+	c, ok := r.configs[tenant]
+	if !ok {
+		return fmt.Errorf("unknown tenant %s", tenant)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	day := now.Format("2006-01-02")
+	u, ok := r.usage[tenant]
+	if !ok || u.Day != day {
+		u = &tenantUsage{Day: day}
+		r.usage[tenant] = u
+	}
+	if (c.Quota.MaxEntriesPerDay > 0 && u.Entries+1 > c.Quota.MaxEntriesPerDay) ||
+		(c.Quota.MaxBytesPerDay > 0 && u.Bytes+bytes > c.Quota.MaxBytesPerDay) {
+		tenantQuotaRejected.Add(1, "tenant", tenant)
+		r.events.PublishThrottled("tenant/"+tenant, eventQuotaExceeded, "", "Tenant quota exceeded",
+			gin.H{"quota": "tenant", "tenant": tenant, "day": day, "entries": u.Entries, "bytes": u.Bytes})
+		return errTenantQuotaExceeded
+	}
+	u.Entries++
+	u.Bytes += bytes
+	return nil
+}
+
+// 租户当天的写入量
+func (r *tenantRegistry) Usage(tenant string, now time.Time) tenantUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	day := now.Format("2006-01-02")
+	if u, ok := r.usage[tenant]; ok && u.Day == day {
+		return *u
+	}
+	return tenantUsage{Day: day}
+}
+
+// 请求携带的 API Key：X-API-Key 请求头或 Authorization: Bearer，gRPC 元数据使用同名的键
+func requestAPIKey(header http.Header) string {
+	key := header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+	}
+	return key
+}
+
+// 校验请求携带的 API Key
+func (r *tenantRegistry) Authorized(tenant string, header http.Header) bool {
+	keys := r.configs[tenant].APIKeys
+	if len(keys) == 0 {
+		return true
+	}
+	key := requestAPIKey(header)
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// 租户接口的中间件：校验租户存在和 API Key，并把租户记录到请求上下文
+func (s *Service) tenantAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.Param("tenant")
+		if _, ok := s.tenants.configs[tenant]; !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		// 访问控制识别出的用户由其角色决定能否访问租户的应用，否则校验租户的 API Key；
+		// 启用访问控制后未配置 API Key 的租户只能由用户访问
+		if currentUser(c) == nil {
+			if !s.tenants.Authorized(tenant, c.Request.Header) || (s.users.enabled && len(s.tenants.configs[tenant].APIKeys) == 0) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+		}
+		c.Set("tenant", tenant)
+		c.Next()
+	}
+}
+
+// 应用 ID 不能为空，也不能包含路径分隔符，否则可能越过租户的存储隔离
+func validApplicationID(applicationID string) bool {
+	return applicationID != "" && applicationID != "." && applicationID != ".." &&
+		!strings.ContainsAny(applicationID, `/\`)
+}
+
+// 请求中的应用 ID 转换为存储使用的 ID：租户接口下加上租户前缀。ID 非法时返回 400，无权访问时返回 403
+func scopedApplicationID(c *gin.Context, applicationID string) (string, bool) {
+	applicationID, err := resolveApplicationID(c, applicationID)
+	if err != nil {
+		c.JSON(err.status, gin.H{"error": err.message})
+		return "", false
+	}
+	return applicationID, true
+}
+
+// 应用 ID 非法或无权访问，reason 用于批量上传中逐条日志的结果
+type applicationIDError struct {
+	status  int
+	reason  string
+	message string
+}
+
+func (e *applicationIDError) Error() string { return e.message }
+
+// 同 scopedApplicationID，但不写出响应
+func resolveApplicationID(c *gin.Context, applicationID string) (string, *applicationIDError) {
+	if !validApplicationID(applicationID) {
+		return "", &applicationIDError{http.StatusBadRequest, "invalid_application_id", "Invalid application_id"}
+	}
+	if tenant := c.GetString("tenant"); tenant != "" {
+		applicationID = tenant + model.TenantSeparator + applicationID
+	}
+	if !applicationAllowed(c, applicationID) {
+		return "", &applicationIDError{http.StatusForbidden, "permission_denied", "Permission denied for application " + model.BareApplicationID(applicationID)}
+	}
+	return applicationID, nil
+}
+
+// 租户接口下和只能访问部分应用的用户不支持临时视图，视图不区分租户
+func rejectTenantView(c *gin.Context, view string) bool {
+	if view != "" && c.GetString("tenant") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "view is not available on tenant routes"})
+		return true
+	}
+	return rejectRestrictedView(c, view)
+}
+
+// 租户后端名称的前缀
+const tenantBackendPrefix = "tenant:"
+
+// 租户后端的名称
+func tenantBackend(tenant string) string {
+	return tenantBackendPrefix + tenant
+}
+
+// 是否为租户后端
+func isTenantBackend(name string) bool {
+	return strings.HasPrefix(name, tenantBackendPrefix)
+}
+
+// 租户的全部应用，返回存储使用的 ID
+func (s *Service) tenantApplications(tenant string) ([]string, error) {
+	dirs, err := os.ReadDir(s.backends.RootOf(tenant + model.TenantSeparator))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var apps []string
+	for _, dir := range dirs {
+		if dir.IsDir() {
+			apps = append(apps, tenant+model.TenantSeparator+dir.Name())
+		}
+	}
+	return s.lifecycle.Visible(apps), nil
+}
+
+// 租户用量接口
+func (s *Service) tenantUsageHandler(c *gin.Context) {
+	tenant := c.GetString("tenant")
+	c.JSON(http.StatusOK, gin.H{
+		"tenant": tenant,
+		"quota":  s.tenants.configs[tenant].Quota,
+		"usage":  s.tenants.Usage(tenant, time.Now()),
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 租户的日志存放在各自的根目录下，只能用租户的 API Key 访问，超出当天配额的写入返回 429
+func TestTenantIsolationAndQuota(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestServiceWith(t, dir, func(c *Config) {
+		c.Tenants = map[string]TenantConfig{
+			"acme":   {StorageRoot: filepath.Join(dir, "tenants", "acme"), APIKeys: []string{"acme-key"}, Quota: TenantQuota{MaxEntriesPerDay: 2}},
+			"globex": {StorageRoot: filepath.Join(dir, "tenants", "globex"), APIKeys: []string{"globex-key"}},
+		}
+	})
+	router := newTestRouter(t, s)
+	do := func(method, path, key string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var data []byte
+		if body != nil {
+			var err error
+			if data, err = json.Marshal(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	now := time.Now()
+	upload := func(tenant, key, message string) *httptest.ResponseRecorder {
+		now = now.Add(time.Millisecond)
+		return do(http.MethodPost, "/tenants/"+tenant+"/upload", key, testEntry("orders", "INFO", message, now))
+	}
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"no key":         upload("acme", "", "order placed"),
+		"other tenant":   upload("acme", "globex-key", "order placed"),
+		"unknown tenant": upload("initech", "acme-key", "order placed"),
+	} {
+		want := http.StatusUnauthorized
+		if name == "unknown tenant" {
+			want = http.StatusNotFound
+		}
+		if w.Code != want {
+			t.Errorf("%s: status %d %s, want %d", name, w.Code, w.Body, want)
+		}
+	}
+
+	for _, message := range []string{"acme placed", "acme paid"} {
+		if w := upload("acme", "acme-key", message); w.Code != http.StatusOK {
+			t.Fatalf("upload %q: %d %s", message, w.Code, w.Body)
+		}
+	}
+	if w := upload("acme", "acme-key", "acme shipped"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("upload over the quota: %d %s, want 429", w.Code, w.Body)
+	}
+	if w := upload("globex", "globex-key", "globex placed"); w.Code != http.StatusOK {
+		t.Fatalf("globex upload: %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/tenants/acme/upload", "acme-key", testEntry("../globex/orders", "INFO", "escape", now)); w.Code != http.StatusBadRequest {
+		t.Fatalf("nested application ID: %d %s, want 400", w.Code, w.Body)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "tenants", "acme", "orders")); err != nil {
+		t.Fatalf("acme logs not under its storage root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logs", "orders")); !os.IsNotExist(err) {
+		t.Fatalf("tenant logs written to the default storage root: %v", err)
+	}
+	query := func(tenant, key string) []string {
+		t.Helper()
+		w := do(http.MethodGet, "/tenants/"+tenant+"/query?application_id=orders&log_level=INFO&sort=asc", key, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("query %s: %d %s", tenant, w.Code, w.Body)
+		}
+		var resp struct {
+			Logs []struct {
+				LogMessage string `json:"log_message"`
+			} `json:"logs"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var messages []string
+		for _, l := range resp.Logs {
+			messages = append(messages, l.LogMessage)
+		}
+		return messages
+	}
+	if got := query("acme", "acme-key"); !reflect.DeepEqual(got, []string{"acme placed", "acme paid"}) {
+		t.Fatalf("acme logs %q", got)
+	}
+	if got := query("globex", "globex-key"); !reflect.DeepEqual(got, []string{"globex placed"}) {
+		t.Fatalf("globex logs %q", got)
+	}
+
+	w := do(http.MethodGet, "/tenants/acme/usage", "acme-key", nil)
+	var usage struct {
+		Usage tenantUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage.Usage.Entries != 2 {
+		t.Fatalf("usage %+v, want 2 entries", usage.Usage)
+	}
+}
@@ -0,0 +1,517 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 冷存储分层配置：所属日期足够久的已关闭分段上传到 S3 兼容的对象存储（AWS S3、阿里云 OSS、MinIO），
+// 本地只保留指向对象的占位文件，读取时下载到有大小上限的本地缓存
+type TieringConfig struct {
+	Endpoint  string          `json:"endpoint"`   // 如 https://s3.us-east-1.amazonaws.com、https://oss-cn-hangzhou.aliyuncs.com、http://minio:9000
+	Region    string          `json:"region"`     // 签名使用的区域，默认 us-east-1
+	Bucket    string          `json:"bucket"`     // 为空时不启用分层
+	Prefix    string          `json:"prefix"`     // 对象键前缀
+	PathStyle bool            `json:"path_style"` // 使用 endpoint/bucket/key 形式的地址，MinIO 通常需要开启
+	AccessKey string          `json:"access_key"` // 为空时读取 AWS_ACCESS_KEY_ID
+	SecretKey string          `json:"secret_key"` // 为空时读取 AWS_SECRET_ACCESS_KEY
+	TLS       ClientTLSConfig `json:"tls"`        // 访问 endpoint 使用的 CA 及客户端证书
+
+	After    Duration `json:"after"`     // 分段所属日期结束超过该时长后上传，默认 168h
+	Interval Duration `json:"interval"`  // 扫描待上传分段的间隔，默认 1h
+	CacheDir string   `json:"cache_dir"` // 取回分段的本地缓存目录，默认 data_dir/tier-cache
+	CacheMB  int      `json:"cache_mb"`  // 缓存大小上限，默认 1024
+}
+
+// 已上传分段的占位文件后缀，如 2024-10-25.log.gz.tiered
+const tieredSuffix = ".tiered"
+
+// 占位文件的内容
+type tieredSegment struct {
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	UploadedAt time.Time `json:"uploaded_at"`
+
+	// 上传时记录的分段元数据，旧版本上传的分段没有
+	From   *time.Time    `json:"from,omitempty"`   // 分段中日志的最早时间
+	To     *time.Time    `json:"to,omitempty"`     // 分段中日志的最晚时间
+	Blocks []tieredBlock `json:"blocks,omitempty"` // 未压缩对象的块索引，查询时只以范围请求读取时间范围内的块
+}
+
+// 对象中在行边界处切分的一块
+type tieredBlock struct {
+	Offset int64     `json:"offset"`
+	Size   int64     `json:"size"`
+	First  time.Time `json:"first"` // 块中日志的最早时间，没有可解析的日志时为零值
+	Last   time.Time `json:"last"`
+}
+
+// 块索引中每块的目标大小
+const tieredBlockBytes = 4 << 20
+
+var (
+	tierUploaded = metrics.counter("tier_uploaded_total", "Log segments uploaded to object storage.")
+	tierFetched  = metrics.counter("tier_fetched_total", "Tiered segments read back, by cache result (hit, miss, or range for ranged reads of a block).")
+	tierErrors   = metrics.counter("tier_errors_total", "Object storage operations that failed.")
+)
+
+// 分层任务：后台上传分段，并负责读取时取回
+type segmentTierer struct {
+	svc        *Service
+	client     *s3Client
+	prefix     string
+	after      time.Duration
+	rotation   RotationConfig // 分段需要压缩时等待压缩后再上传
+	stores     map[string]*fileStore
+	cacheDir   string
+	cacheLimit int64
+
+	fetchMu sync.Mutex
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// 启动分层任务，未配置 bucket 时返回 nil
+func (s *Service) startSegmentTierer(r *backendRegistry, c TieringConfig, dataDir string, rotation RotationConfig) (*segmentTierer, error) {
+	if c.Bucket == "" {
+		return nil, nil
+	}
+	client, err := newS3Client(c)
+	if err != nil {
+		return nil, err
+	}
+	t := &segmentTierer{
+		svc:        s,
+		client:     client,
+		after:      time.Duration(c.After),
+		rotation:   rotation,
+		stores:     make(map[string]*fileStore),
+		cacheDir:   c.CacheDir,
+		cacheLimit: int64(c.CacheMB) << 20,
+		stop:       make(chan struct{}),
+	}
+	if prefix := strings.Trim(c.Prefix, "/"); prefix != "" {
+		t.prefix = prefix + "/"
+	}
+	if t.after <= 0 {
+		t.after = 7 * 24 * time.Hour
+	}
+	if t.cacheDir == "" {
+		t.cacheDir = filepath.Join(dataDir, "tier-cache")
+	}
+	if t.cacheLimit <= 0 {
+		t.cacheLimit = 1024 << 20
+	}
+	if err := os.MkdirAll(t.cacheDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	for _, name := range r.Names() {
+		if store, _, _ := r.Store(name); store != nil {
+			if fs, ok := store.(*fileStore); ok {
+				t.stores[name] = fs
+			}
+		}
+	}
+
+	interval := time.Duration(c.Interval)
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, name := range sortedKeys(t.stores) {
+				if err := t.tierStore(name, t.stores[name], time.Now()); err != nil {
+					log.Printf("segment tiering in %s failed: %v", t.stores[name].root, err)
+				}
+			}
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return t, nil
+}
+
+// 停止后台上传，等待正在进行的上传完成
+func (t *segmentTierer) Close() error {
+	close(t.stop)
+	t.wg.Wait()
+	return nil
+}
+
+func (t *segmentTierer) stopping() bool {
+	select {
+	case <-t.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// 上传一个后端中所有足够旧的分段
+func (t *segmentTierer) tierStore(backend string, fs *fileStore, now time.Time) error {
+	apps, err := os.ReadDir(fs.root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, app := range apps {
+		if !app.IsDir() || !t.svc.cluster.OwnsFolder(backend, app.Name()) {
+			continue
+		}
+		appFolder := filepath.Join(fs.root, app.Name())
+		files, err := os.ReadDir(appFolder)
+		if err != nil {
+			return err
+		}
+		present := make(map[string]bool, len(files))
+		for _, file := range files {
+			present[file.Name()] = true
+		}
+
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, tieredSuffix) {
+				continue
+			}
+			day, _, ok := parseSegmentName(trimCompressedSuffix(name))
+			if !ok {
+				continue
+			}
+			// 尚未压缩的分段交给压缩任务（包括需要压缩的存储类别的分段），压缩过程中原文件和 .gz 并存时也跳过原文件
+			if codecOfFile(name) == nil {
+				class, _ := t.svc.storageRouting.ClassOf(filepath.Join(appFolder, name), t.svc.storageVolumes)
+				if t.svc.storageRouting.codec(class, t.rotation) != nil || compressedPresent(present, name) {
+					continue
+				}
+			}
+			if now.Sub(logFileDate(day).AddDate(0, 0, 1)) < t.after {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(appFolder, name)); err != nil || now.Sub(info.ModTime()) < compressGrace {
+				continue
+			}
+			if t.stopping() {
+				return nil
+			}
+			if err := t.upload(backend, app.Name(), appFolder, name); err != nil {
+				tierErrors.Add(1, "op", "upload")
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 目录中是否已有分段的压缩文件
+func compressedPresent(present map[string]bool, name string) bool {
+	for _, p := range compressedPaths(name) {
+		if present[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// 上传分段，写入占位文件后删除本地文件
+func (t *segmentTierer) upload(backend, app, appFolder, name string) error {
+	path := filepath.Join(appFolder, name)
+	sum, size, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stub, err := t.svc.tieredMetadata(path, name)
+	if err != nil {
+		return err
+	}
+	stub.Key, stub.Size, stub.SHA256 = t.prefix+backend+"/"+app+"/"+name, size, sum
+	if err := t.client.Put(stub.Key, file, size, sum); err != nil {
+		return err
+	}
+
+	stub.UploadedAt = time.Now().UTC()
+	data, err := json.Marshal(stub)
+	if err != nil {
+		return err
+	}
+	tmp := path + tieredSuffix + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path+tieredSuffix); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	tierUploaded.Add(1)
+	return removeSegmentFile(path)
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// 上传前读取分段，记录其中日志的时间范围；未压缩的分段同时记录块索引，压缩的对象无法按范围解压
+func (s *Service) tieredMetadata(path, name string) (tieredSegment, error) {
+	var stub tieredSegment
+	plain := codecOfFile(name) == nil
+	var rc io.ReadCloser
+	var err error
+	if plain {
+		rc, err = os.Open(path)
+	} else {
+		rc, err = openCompressedFile(path)
+	}
+	if err != nil {
+		return stub, err
+	}
+	defer rc.Close()
+
+	ref := logRef{File: trimCompressedSuffix(name)}
+	var from, to time.Time
+	var block *tieredBlock
+	var offset int64
+	reader := bufio.NewReaderSize(rc, 64<<10)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if plain && (block == nil || block.Size >= tieredBlockBytes) {
+				stub.Blocks = append(stub.Blocks, tieredBlock{Offset: offset})
+				block = &stub.Blocks[len(stub.Blocks)-1]
+			}
+			offset += int64(len(line))
+			if block != nil {
+				block.Size += int64(len(line))
+			}
+			if entry, parseErr := parseLogLine(s.encryption.Open(path, strings.TrimRight(line, "\r\n"))); parseErr == nil {
+				at := entryTime(entry, ref)
+				widenTimeRange(&from, &to, at)
+				if block != nil {
+					widenTimeRange(&block.First, &block.Last, at)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stub, err
+		}
+	}
+	if !from.IsZero() {
+		stub.From, stub.To = &from, &to
+	}
+	return stub, nil
+}
+
+func widenTimeRange(first, last *time.Time, at time.Time) {
+	if first.IsZero() || at.Before(*first) {
+		*first = at
+	}
+	if last.IsZero() || at.After(*last) {
+		*last = at
+	}
+}
+
+func readTieredSegment(stubPath string) (tieredSegment, error) {
+	var stub tieredSegment
+	data, err := os.ReadFile(stubPath)
+	if err != nil {
+		return stub, err
+	}
+	if err := json.Unmarshal(data, &stub); err != nil || stub.Key == "" {
+		return stub, fmt.Errorf("invalid tiered segment %s", stubPath)
+	}
+	return stub, nil
+}
+
+// 打开已分层的分段，本地没有占位文件时返回 false
+func (t *segmentTierer) open(path string) (io.ReadCloser, bool, error) {
+	stubs := []string{path + tieredSuffix}
+	for _, p := range compressedPaths(path) {
+		stubs = append(stubs, p+tieredSuffix)
+	}
+	for _, name := range stubs {
+		stub, err := readTieredSegment(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, true, err
+		}
+		cached, err := t.fetch(stub)
+		if err != nil {
+			tierErrors.Add(1, "op", "fetch")
+			return nil, true, fmt.Errorf("fetch %s: %w", stub.Key, err)
+		}
+		if codecOfFile(stub.Key) != nil {
+			rc, err := openCompressedFile(cached)
+			return rc, true, err
+		}
+		file, err := os.Open(cached)
+		return file, true, err
+	}
+	return nil, false, nil
+}
+
+// 将对象取回到本地缓存，返回缓存文件路径。已在缓存中的对象直接使用
+func (t *segmentTierer) fetch(stub tieredSegment) (string, error) {
+	cached := t.cachePath(stub)
+
+	t.fetchMu.Lock()
+	defer t.fetchMu.Unlock()
+	if info, err := os.Stat(cached); err == nil && info.Size() == stub.Size {
+		// 更新修改时间，淘汰时按最近使用的顺序保留
+		now := time.Now()
+		os.Chtimes(cached, now, now)
+		tierFetched.Add(1, "result", "hit")
+		return cached, nil
+	}
+
+	body, err := t.client.Get(stub.Key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	tmp := cached + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, h), body)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != stub.SHA256 {
+		err = errors.New("checksum mismatch")
+	}
+	if err == nil {
+		err = os.Rename(tmp, cached)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	tierFetched.Add(1, "result", "miss")
+	t.evict(cached)
+	return cached, nil
+}
+
+// 对象在本地缓存中的路径
+func (t *segmentTierer) cachePath(stub tieredSegment) string {
+	keyHash := sha256.Sum256([]byte(stub.Key))
+	cached := filepath.Join(t.cacheDir, hex.EncodeToString(keyHash[:16]))
+	if codec := codecOfFile(stub.Key); codec != nil {
+		cached += codec.suffix
+	}
+	return cached
+}
+
+// 读取未压缩对象中 [offset, offset+length) 的字节：已整段取回到缓存时读缓存，否则以范围请求读取，不写入缓存
+func (t *segmentTierer) openRange(stub tieredSegment, offset, length int64) (io.ReadCloser, error) {
+	if file, err := os.Open(t.cachePath(stub)); err == nil {
+		if info, err := file.Stat(); err == nil && info.Size() == stub.Size {
+			tierFetched.Add(1, "result", "hit")
+			return struct {
+				io.Reader
+				io.Closer
+			}{io.NewSectionReader(file, offset, length), file}, nil
+		}
+		file.Close()
+	}
+	body, err := t.client.GetRange(stub.Key, offset, length)
+	if err != nil {
+		tierErrors.Add(1, "op", "range")
+		return nil, fmt.Errorf("fetch %s: %w", stub.Key, err)
+	}
+	tierFetched.Add(1, "result", "range")
+	return body, nil
+}
+
+// 缓存超过上限时按最近使用时间从旧到新删除，keep 为刚取回的文件
+func (t *segmentTierer) evict(keep string) {
+	files, err := os.ReadDir(t.cacheDir)
+	if err != nil {
+		return
+	}
+	var infos []os.FileInfo
+	var total int64
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || file.IsDir() || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		infos = append(infos, info)
+		total += info.Size()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos {
+		if total <= t.cacheLimit {
+			return
+		}
+		path := filepath.Join(t.cacheDir, info.Name())
+		if path == keep {
+			continue
+		}
+		// 正在读取的文件删除后仍可读完
+		if os.Remove(path) == nil {
+			total -= info.Size()
+		}
+	}
+}
+
+// 删除应用目录中占位文件指向的对象
+func (t *segmentTierer) removeObjects(appFolder string) {
+	files, _ := os.ReadDir(appFolder)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), tieredSuffix) {
+			continue
+		}
+		stub, err := readTieredSegment(filepath.Join(appFolder, file.Name()))
+		if err != nil {
+			continue
+		}
+		if err := t.client.Delete(stub.Key); err != nil {
+			tierErrors.Add(1, "op", "delete")
+			log.Printf("delete tiered segment %s failed: %v", stub.Key, err)
+		}
+	}
+}
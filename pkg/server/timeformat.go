@@ -0,0 +1,254 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/model"
+)
+
+// 应用登记的时间戳格式：结构化上传（单条、批量、gRPC 和断点续传）的时间戳只按该格式解析，
+// 不匹配时拒绝并说明原因，而不是按常见格式猜测，避免同一应用存下含义不一致的时间。
+// 没有登记格式的应用仍按 normalizeTimestamp 支持的常见格式识别
+type AppTimestampFormat struct {
+	ApplicationID string    `json:"application_id" binding:"required"` // 租户应用为 租户/应用
+	Layout        string    `json:"layout" binding:"required"`         // Go 时间布局，或 rfc3339、unix、unix_ms
+	Timezone      string    `json:"timezone"`                          // 布局不带时区时使用的 IANA 时区，默认服务端本地时区
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	loc *time.Location
+}
+
+// 时间戳不符合应用登记的格式
+type timestampLayoutError struct {
+	applicationID string
+	value         string
+	layout        string
+	reason        string
+}
+
+func (e *timestampLayoutError) Error() string {
+	return fmt.Sprintf("%q does not match the layout %q registered for %s: %s", e.value, e.layout, e.applicationID, e.reason)
+}
+
+func (e *timestampLayoutError) Unwrap() error { return errInvalidTimestamp }
+
+// 时间戳无效的具体原因，作为响应消息的后缀；不是因为不符合登记的格式时为空
+func timestampMismatch(err error) string {
+	var le *timestampLayoutError
+	if errors.As(err, &le) {
+		return ": " + le.Error()
+	}
+	return ""
+}
+
+// 已登记的时间戳格式
+type timestampFormatRegistry struct {
+	mu      sync.RWMutex
+	formats map[string]*AppTimestampFormat
+	path    string
+}
+
+func newTimestampFormatRegistry(dataDir string) (*timestampFormatRegistry, error) {
+	r := &timestampFormatRegistry{formats: make(map[string]*AppTimestampFormat), path: filepath.Join(dataDir, "timestamp_formats.json")}
+	if err := loadJSONFile(r.path, &r.formats); err != nil {
+		return nil, err
+	}
+	for app, f := range r.formats {
+		if err := f.compile(); err != nil {
+			return nil, fmt.Errorf("timestamp format for %s: %v", app, err)
+		}
+	}
+	return r, nil
+}
+
+func (f *AppTimestampFormat) compile() error {
+	f.loc = time.Local
+	if f.Timezone != "" {
+		loc, err := time.LoadLocation(f.Timezone)
+		if err != nil {
+			return fmt.Errorf("unknown timezone %q", f.Timezone)
+		}
+		f.loc = loc
+	}
+	switch f.Layout {
+	case "rfc3339", "unix", "unix_ms":
+		return nil
+	}
+	// 布局必须能还原出完整的日期，否则任何字符串都可能「匹配」
+	ref := time.Date(2021, 11, 23, 13, 45, 56, 789000000, f.loc)
+	t, err := time.ParseInLocation(f.Layout, ref.Format(f.Layout), f.loc)
+	if err != nil || t.Year() != ref.Year() || t.YearDay() != ref.YearDay() {
+		return fmt.Errorf("layout %q must contain the year, month and day", f.Layout)
+	}
+	return nil
+}
+
+// 按登记的格式解析时间戳
+func (f *AppTimestampFormat) parse(ts string) (time.Time, error) {
+	switch f.Layout {
+	case "rfc3339":
+		return time.Parse(time.RFC3339Nano, ts)
+	case "unix", "unix_ms":
+		n, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.New("not an integer")
+		}
+		if f.Layout == "unix_ms" {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.ParseInLocation(f.Layout, ts, f.loc)
+}
+
+// 应用登记的时间戳格式，没有登记时返回 nil
+func (r *timestampFormatRegistry) Get(applicationID string) *AppTimestampFormat {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.formats[applicationID]
+}
+
+// 登记或替换应用的时间戳格式
+func (r *timestampFormatRegistry) Put(f *AppTimestampFormat) error {
+	if err := f.compile(); err != nil {
+		return err
+	}
+	f.UpdatedAt = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.formats[f.ApplicationID] = f
+	return saveJSONFile(r.path, r.formats)
+}
+
+// 删除应用的时间戳格式
+func (r *timestampFormatRegistry) Delete(applicationID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.formats[applicationID]; !ok {
+		return false, nil
+	}
+	delete(r.formats, applicationID)
+	return true, saveJSONFile(r.path, r.formats)
+}
+
+func (r *timestampFormatRegistry) List() []AppTimestampFormat {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]AppTimestampFormat, 0, len(r.formats))
+	for _, f := range r.formats {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ApplicationID < list[j].ApplicationID })
+	return list
+}
+
+// 按应用登记的格式解析时间戳并转换为存储格式，不匹配时返回 timestampLayoutError。
+// 与 normalizeTimestamp 一样拒绝早于 1970 年或比 now 晚一天以上的时间戳
+func (f *AppTimestampFormat) normalize(ts string, now time.Time) (string, error) {
+	at, err := f.parse(ts)
+	if err != nil {
+		reason := err.Error()
+		var pe *time.ParseError
+		if errors.As(err, &pe) {
+			reason = strings.TrimPrefix(pe.Message, ": ")
+			if reason == "" {
+				reason = fmt.Sprintf("cannot parse %q as %q", pe.ValueElem, pe.LayoutElem)
+			}
+		}
+		return "", &timestampLayoutError{applicationID: f.ApplicationID, value: ts, layout: f.Layout, reason: reason}
+	}
+	if at.Year() < 1970 || at.After(now.Add(maxTimestampSkew)) {
+		return "", fmt.Errorf("%w %q", errInvalidTimestamp, ts)
+	}
+	return at.UTC().Format(storedTimestampLayout), nil
+}
+
+// 校验结构化上传的时间戳。应用登记了格式时按格式解析并转换为存储格式，之后的写入不再猜测格式；
+// 否则只校验时间戳能否按常见格式识别
+func (s *Service) checkUploadTimestamp(entry *LogData, now time.Time) error {
+	if f := s.timestampFormats.Get(entry.ApplicationID); f != nil {
+		ts, err := f.normalize(entry.Timestamp, now)
+		if err != nil {
+			return err
+		}
+		entry.Timestamp = ts
+		return nil
+	}
+	_, err := normalizeTimestamp(entry.Timestamp, now, now)
+	return err
+}
+
+// 时间戳格式列表接口
+func (s *Service) timestampFormatListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"timestamp_formats": s.timestampFormats.List()})
+}
+
+// 登记或替换时间戳格式请求，samples 中的示例时间戳按新格式解析后随响应返回，便于确认格式
+type putTimestampFormatRequest struct {
+	AppTimestampFormat
+	Samples []string `json:"samples"`
+}
+
+// 示例时间戳的解析结果
+type timestampSample struct {
+	Value     string `json:"value"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// 登记或替换应用时间戳格式接口
+func (s *Service) timestampFormatPutHandler(c *gin.Context) {
+	var req putTimestampFormatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	f := req.AppTimestampFormat
+	if tenant, app := model.SplitApplicationID(f.ApplicationID); !validApplicationID(app) || (tenant != "" && !validApplicationID(tenant)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+	if err := s.timestampFormats.Put(&f); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	samples := make([]timestampSample, 0, len(req.Samples))
+	now := time.Now()
+	for _, value := range req.Samples {
+		s := timestampSample{Value: value}
+		if ts, err := f.normalize(value, now); err != nil {
+			s.Error = err.Error()
+		} else {
+			s.Timestamp = ts
+		}
+		samples = append(samples, s)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Timestamp format saved", "timestamp_format": f, "samples": samples})
+}
+
+// 删除应用时间戳格式接口，路径中的应用 ID 可以带租户前缀
+func (s *Service) timestampFormatDeleteHandler(c *gin.Context) {
+	ok, err := s.timestampFormats.Delete(strings.TrimPrefix(c.Param("application_id"), "/"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save timestamp formats"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Timestamp format not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Timestamp format deleted"})
+}
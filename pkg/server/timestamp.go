@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 写入时统一保存为 UTC 的 RFC3339 时间戳
+const storedTimestampLayout = time.RFC3339Nano
+
+// 上传的时间戳最多允许比服务端时间晚这么多，更晚的视为无效
+const maxTimestampSkew = 24 * time.Hour
+
+var errInvalidTimestamp = errors.New("invalid timestamp")
+
+// 校验上传日志的时间戳并转换为存储格式。支持 RFC3339、Seata 默认的 2006-01-02 15:04:05.000
+// （毫秒也可以用逗号分隔）、只有时分秒（日期取 day）和 Unix 毫秒或秒，未带时区的按服务端本地时区解释。
+// 无法解析、早于 1970 年或比 now 晚一天以上的时间戳返回 errInvalidTimestamp
+func normalizeTimestamp(ts string, day, now time.Time) (string, error) {
+	at, ok := parser.ParseTime(strings.TrimSpace(ts), day)
+	if !ok || at.Year() < 1970 || at.After(now.Add(maxTimestampSkew)) {
+		return "", fmt.Errorf("%w %q", errInvalidTimestamp, ts)
+	}
+	return at.UTC().Format(storedTimestampLayout), nil
+}
+
+// 上传校验：时间戳能否被接受
+func validTimestamp(ts string) bool {
+	now := time.Now()
+	_, err := normalizeTimestamp(ts, now, now)
+	return err == nil
+}
+
+// 按 loc 显示查询结果中日志的时间戳，无法解析的保持原样
+func localizeTimestamps(hits []QueryHit, loc *time.Location) {
+	for i := range hits {
+		if at, ok := parser.ParseTime(hits[i].Entry.Timestamp, logFileDate(hits[i].Ref.File)); ok {
+			hits[i].Entry.Timestamp = at.In(loc).Format(time.RFC3339Nano)
+		}
+	}
+}
+
+// 分段可能包含 [from, to] 内的日志（零值表示不限）。分段按服务端本地时区的收到日期命名，
+// from、to 是带时区的时刻，按分段当天的本地零点到次日零点比较，与客户端的时区无关：
+// 分段中日志的时间最多比收到时间晚 maxTimestampSkew，早于 from 的分段可以跳过；
+// 迟到或补传的日志会写入较晚的分段，因此只有计数索引中已关闭的分段（seg 不为 nil）才按其中日志的实际时间范围跳过晚于 to 的分段
+func segmentInRange(name string, seg *segmentCounts, from, to time.Time) bool {
+	if day := logFileDate(name); !from.IsZero() && !day.IsZero() && day.AddDate(0, 0, 1).Add(maxTimestampSkew).Before(from) {
+		return false
+	}
+	if seg == nil || !seg.Closed || seg.First.IsZero() {
+		return true
+	}
+	return (from.IsZero() || !seg.Last.Before(from)) && (to.IsZero() || !seg.First.After(to))
+}
+
+// 从日志文件名（2006-01-02.log）中解析日期
+func logFileDate(fileName string) time.Time {
+	if len(fileName) < len("2006-01-02") {
+		return time.Time{}
+	}
+	day, err := time.ParseInLocation("2006-01-02", fileName[:len("2006-01-02")], time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return day
+}
+
+// 查询参数中允许的时间格式
+var queryTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// 解析查询参数中的时间，未带时区的时间按 loc 解释
+func parseTimeParam(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range queryTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
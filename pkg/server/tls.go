@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// HTTPS 监听配置，cert_file 和 key_file 都配置时启用
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`      // 服务端证书，PEM 格式，可包含中间证书
+	KeyFile      string `json:"key_file"`       // 服务端私钥
+	ClientCAFile string `json:"client_ca_file"` // 校验客户端证书的 CA，配置后启用双向 TLS
+	ClientAuth   string `json:"client_auth"`    // require（默认，配置了 client_ca_file 时）、optional 或 none
+	MinVersion   string `json:"min_version"`    // 1.2（默认）或 1.3
+}
+
+// 连接服务端的 TLS 配置，供采集代理和探针使用
+type ClientTLSConfig struct {
+	CAFile     string `json:"ca_file"`     // 校验服务端证书的 CA，默认使用系统根证书
+	CertFile   string `json:"cert_file"`   // 双向 TLS 的客户端证书
+	KeyFile    string `json:"key_file"`    // 客户端私钥
+	ServerName string `json:"server_name"` // 校验服务端证书时使用的主机名，默认取自服务地址
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS min_version %q", v)
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// 根据配置生成服务端的 tls.Config
+func buildServerTLSConfig(t TLSConfig) (*tls.Config, error) {
+	if t.CertFile == "" || t.KeyFile == "" {
+		return nil, fmt.Errorf("tls requires both cert_file and key_file")
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+	minVersion, err := parseTLSVersion(t.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: minVersion}
+
+	clientAuth := t.ClientAuth
+	if clientAuth == "" && t.ClientCAFile != "" {
+		clientAuth = "require"
+	}
+	switch clientAuth {
+	case "", "none":
+		config.ClientAuth = tls.NoClientCert
+	case "optional":
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unsupported TLS client_auth %q", t.ClientAuth)
+	}
+	if config.ClientAuth != tls.NoClientCert {
+		if t.ClientCAFile == "" {
+			return nil, fmt.Errorf("tls client_auth %q requires client_ca_file", clientAuth)
+		}
+		if config.ClientCAs, err = loadCertPool(t.ClientCAFile); err != nil {
+			return nil, fmt.Errorf("load client CA: %w", err)
+		}
+	}
+	return config, nil
+}
+
+// 根据配置生成客户端的 tls.Config
+func buildClientTLSConfig(t ClientTLSConfig) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: t.ServerName}
+	if t.CAFile != "" {
+		pool, err := loadCertPool(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("load CA: %w", err)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// 根据配置生成客户端的 http.Client，未配置时使用默认的 TLS 设置
+func newTLSHTTPClient(t ClientTLSConfig, timeout time.Duration) (*http.Client, error) {
+	config, err := buildClientTLSConfig(t)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// 已校验的客户端证书的主体名称，没有客户端证书时返回空串
+func clientCertSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
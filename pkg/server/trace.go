@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 分布式追踪的关联配置
+type TracingConfig struct {
+	// 追踪系统中查看 trace 的地址模板，{trace_id} 和 {span_id} 会被替换，
+	// 如 Jaeger 的 http://jaeger:16686/trace/{trace_id}，为空时不生成链接
+	URLTemplate string `json:"url_template"`
+}
+
+// 从日志消息中提取追踪上下文，依次尝试 W3C traceparent、key=value 写法和 Spring Sleuth 的 [应用,traceId,spanId]
+var (
+	traceparentPattern = parser.MustCompilePattern(`\b00-([0-9a-fA-F]{32})-([0-9a-fA-F]{16})-[0-9a-fA-F]{2}\b`)
+	traceIDPattern     = parser.MustCompilePattern(`(?i)\btrace[_\-.]?id\s*[=:]\s*\[?"?([0-9a-f]{16,32})\b`)
+	spanIDPattern      = parser.MustCompilePattern(`(?i)\bspan[_\-.]?id\s*[=:]\s*\[?"?([0-9a-f]{16})\b`)
+	sleuthPattern      = parser.MustCompilePattern(`\[[\w\-.]*,([0-9a-fA-F]{16,32}),([0-9a-fA-F]{16})(?:,\w*)?\]`)
+)
+
+// 补全日志的追踪上下文：上传时放在自定义字段 trace_id、span_id 中的移到内置字段，
+// 仍为空时从消息中提取。ID 统一为小写，与 W3C Trace Context 一致
+func extractTraceContext(entry *LogData) {
+	for key, id := range map[string]*string{"trace_id": &entry.TraceID, "span_id": &entry.SpanID} {
+		if v, ok := entry.Fields[key]; ok {
+			if *id == "" {
+				*id = v
+			}
+			delete(entry.Fields, key)
+		}
+	}
+
+	if entry.TraceID == "" {
+		if m := traceparentPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+			entry.TraceID = m[1]
+			if entry.SpanID == "" {
+				entry.SpanID = m[2]
+			}
+		} else if m := traceIDPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+			entry.TraceID = m[1]
+		} else if m := sleuthPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+			entry.TraceID = m[1]
+			if entry.SpanID == "" {
+				entry.SpanID = m[2]
+			}
+		}
+	}
+	if entry.TraceID != "" && entry.SpanID == "" {
+		if m := spanIDPattern.FindStringSubmatch(entry.LogMessage); m != nil {
+			entry.SpanID = m[1]
+		}
+	}
+	entry.TraceID = strings.ToLower(entry.TraceID)
+	entry.SpanID = strings.ToLower(entry.SpanID)
+}
+
+// 日志在追踪系统中的链接，未配置模板或日志没有 trace_id 时为空
+func (s *Service) traceURL(traceID, spanID string) string {
+	if s.cfg.Tracing.URLTemplate == "" || traceID == "" {
+		return ""
+	}
+	return strings.NewReplacer("{trace_id}", url.PathEscape(traceID), "{span_id}", url.PathEscape(spanID)).Replace(s.cfg.Tracing.URLTemplate)
+}
+
+// 查询结果中的日志，附带追踪系统的链接
+type linkedLogData struct {
+	LogData
+	TraceURL string `json:"trace_url,omitempty"`
+}
+
+func (s *Service) linkTrace(entry LogData) interface{} {
+	if link := s.traceURL(entry.TraceID, entry.SpanID); link != "" {
+		return linkedLogData{LogData: entry, TraceURL: link}
+	}
+	return entry
+}
+
+// 一个 trace 在各应用中的日志
+type traceLogs struct {
+	TraceID        string          `json:"trace_id"`
+	TraceURL       string          `json:"trace_url,omitempty"`
+	ApplicationIDs []string        `json:"application_ids"` // 出现过该 trace 的应用
+	SpanIDs        []string        `json:"span_ids"`
+	FirstSeen      time.Time       `json:"first_seen"`
+	LastSeen       time.Time       `json:"last_seen"`
+	DurationMs     int64           `json:"duration_ms"`
+	Logs           []TimelineEvent `json:"logs"`
+}
+
+// 在一组应用中收集 trace 的日志，按时间升序排列
+func (s *Service) collectTraceLogs(ctx context.Context, traceID string, applicationIDs []string, from, to time.Time) (traceLogs, error) {
+	t := traceLogs{TraceID: traceID, TraceURL: s.traceURL(traceID, ""), ApplicationIDs: []string{}, SpanIDs: []string{}, Logs: []TimelineEvent{}}
+	apps := make(map[string]bool)
+	spans := make(map[string]bool)
+
+	visit := parsedLineVisitor(func(entry LogData, ref logRef) bool {
+		if entry.TraceID != traceID {
+			return true
+		}
+		at := entryTime(entry, ref)
+		if (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+			return true
+		}
+		s.maskQueryEntry(&entry)
+		t.Logs = append(t.Logs, TimelineEvent{At: at, Entry: entry, Ref: ref})
+		apps[entry.ApplicationID] = true
+		if entry.SpanID != "" {
+			spans[entry.SpanID] = true
+		}
+		return true
+	})
+	for _, appID := range applicationIDs {
+		// 先按原始行过滤，只解析包含 trace_id 的行
+		err := s.forEachStoredLineBetween(ctx, appID, from, to, func(line string, ref logRef) bool {
+			if !strings.Contains(line, traceID) {
+				return true
+			}
+			return visit(line, ref)
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return t, err
+		}
+	}
+
+	sort.SliceStable(t.Logs, func(i, j int) bool {
+		return timeOrderBefore(t.Logs[i].At, t.Logs[i].Entry, t.Logs[j].At, t.Logs[j].Entry)
+	})
+	t.ApplicationIDs = append(t.ApplicationIDs, sortedKeys(apps)...)
+	t.SpanIDs = append(t.SpanIDs, sortedKeys(spans)...)
+	if len(t.Logs) > 0 {
+		t.FirstSeen = t.Logs[0].At
+		t.LastSeen = t.Logs[len(t.Logs)-1].At
+		t.DurationMs = t.LastSeen.Sub(t.FirstSeen).Milliseconds()
+	}
+	return t, nil
+}
+
+// trace 日志接口：按时间顺序返回某个 trace 在各应用中的全部日志，application_id 为空时搜索全部应用，
+// 指定 from 时只读取之后的分段
+func (s *Service) traceLogsHandler(c *gin.Context) {
+	traceID := strings.ToLower(c.Param("trace_id"))
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+
+	t, err := s.collectTraceLogs(c.Request.Context(), traceID, apps, from, to)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	if len(t.Logs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trace not found"})
+		return
+	}
+	auditCount(c, len(t.Logs))
+	c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"logAnalysis/pkg/parser"
+)
+
+// 事务时间线上的一条日志
+type TimelineEvent struct {
+	At    time.Time `json:"at"`
+	Entry LogData   `json:"entry"`
+	Ref   logRef    `json:"ref"`
+}
+
+// 一个全局事务（XID）的时间线
+type TransactionTimeline struct {
+	XID            string          `json:"xid"`
+	ApplicationIDs []string        `json:"application_ids"` // 出现过该 XID 的应用
+	BranchIDs      []string        `json:"branch_ids"`
+	FirstSeen      time.Time       `json:"first_seen"`
+	LastSeen       time.Time       `json:"last_seen"`
+	DurationMs     int64           `json:"duration_ms"`
+	Events         []TimelineEvent `json:"events"`
+	Annotations    []Annotation    `json:"annotations,omitempty"` // 时间线接口附带的排障注记
+}
+
+// 日志是否属于该 XID：结构化字段或消息中出现该 XID
+func entryHasXID(entry LogData, xid string) bool {
+	if entry.XID != "" {
+		return entry.XID == xid
+	}
+	return strings.Contains(entry.LogMessage, xid)
+}
+
+// 在一组应用中收集 XID 相关的日志，按时间升序排列
+func (s *Service) buildTimeline(ctx context.Context, xid string, applicationIDs []string) (TransactionTimeline, error) {
+	timelines, err := s.buildTimelines(ctx, []string{xid}, applicationIDs)
+	if err != nil {
+		return TransactionTimeline{}, err
+	}
+	return timelines[0], nil
+}
+
+// 一次遍历同时收集多个 XID 的时间线，结果与 xids 顺序一致
+func (s *Service) buildTimelines(ctx context.Context, xids []string, applicationIDs []string) ([]TransactionTimeline, error) {
+	timelines := make([]TransactionTimeline, len(xids))
+	apps := make([]map[string]bool, len(xids))
+	branches := make([]map[string]bool, len(xids))
+	for i, xid := range xids {
+		timelines[i] = TransactionTimeline{XID: xid, ApplicationIDs: []string{}, BranchIDs: []string{}, Events: []TimelineEvent{}}
+		apps[i], branches[i] = make(map[string]bool), make(map[string]bool)
+	}
+
+	var matched []int
+	visit := parsedLineVisitor(func(entry LogData, ref logRef) bool {
+		hits := matched[:0]
+		for _, i := range matched {
+			if entryHasXID(entry, xids[i]) {
+				hits = append(hits, i)
+			}
+		}
+		if len(hits) == 0 {
+			return true
+		}
+		s.maskQueryEntry(&entry)
+		for _, i := range hits {
+			t := &timelines[i]
+			t.Events = append(t.Events, TimelineEvent{At: entryTime(entry, ref), Entry: entry, Ref: ref})
+			apps[i][entry.ApplicationID] = true
+			branchID := entry.BranchID
+			if branchID == "" {
+				branchID = parser.SeataFields(entry.LogMessage)["branch_id"]
+			}
+			if branchID != "" {
+				branches[i][branchID] = true
+			}
+		}
+		return true
+	})
+	for _, appID := range applicationIDs {
+		// 跳过布隆过滤器排除的分段，再按原始行过滤，只解析包含 XID 的行
+		err := s.forEachStoredLineWithXIDs(ctx, appID, xids, func(line string, ref logRef) bool {
+			matched = matched[:0]
+			for i, xid := range xids {
+				if strings.Contains(line, xid) {
+					matched = append(matched, i)
+				}
+			}
+			if len(matched) == 0 {
+				return true
+			}
+			return visit(line, ref)
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return timelines, err
+		}
+	}
+
+	for i := range timelines {
+		t := &timelines[i]
+		sort.SliceStable(t.Events, func(a, b int) bool {
+			return timeOrderBefore(t.Events[a].At, t.Events[a].Entry, t.Events[b].At, t.Events[b].Entry)
+		})
+		t.ApplicationIDs = append(t.ApplicationIDs, sortedKeys(apps[i])...)
+		t.BranchIDs = append(t.BranchIDs, sortedKeys(branches[i])...)
+		if len(t.Events) > 0 {
+			t.FirstSeen = t.Events[0].At
+			t.LastSeen = t.Events[len(t.Events)-1].At
+			t.DurationMs = t.LastSeen.Sub(t.FirstSeen).Milliseconds()
+		}
+	}
+	return timelines, nil
+}
+
+// 事务时间线接口：按时间顺序返回某个 XID 在各应用中的全部日志，application_id 为空时搜索全部应用
+func (s *Service) transactionTimelineHandler(c *gin.Context) {
+	xid := c.Param("xid")
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+
+	t, err := s.buildTimeline(c.Request.Context(), xid, apps)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	if len(t.Events) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return
+	}
+	t.Annotations = s.annotations.ForTimeline(t)
+	auditCount(c, len(t.Events))
+	c.JSON(http.StatusOK, t)
+}
+
+// 单次批量查询最多包含的 XID 数
+const maxBatchXIDs = 100
+
+// 批量 XID 查询请求
+type transactionLogsRequest struct {
+	XIDs []string `json:"xids" binding:"required"`
+}
+
+// 批量事务日志接口：一次返回一组 XID（如从工单中整理出的失败订单）各自的时间线，
+// 只遍历一次日志；没有任何日志的 XID 列在 not_found 中
+func (s *Service) transactionLogsHandler(c *gin.Context) {
+	var req transactionLogsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	seen := make(map[string]bool, len(req.XIDs))
+	xids := make([]string, 0, len(req.XIDs))
+	for _, xid := range req.XIDs {
+		if xid = strings.TrimSpace(xid); xid != "" && !seen[xid] {
+			seen[xid] = true
+			xids = append(xids, xid)
+		}
+	}
+	if len(xids) == 0 || len(xids) > maxBatchXIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("xids must contain 1 to %d XIDs", maxBatchXIDs)})
+		return
+	}
+	apps, ok := s.requestApplications(c)
+	if !ok {
+		return
+	}
+
+	timelines, err := s.buildTimelines(c.Request.Context(), xids, apps)
+	if err != nil {
+		readFailed(c, err)
+		return
+	}
+	found := make([]TransactionTimeline, 0, len(timelines))
+	notFound := []string{}
+	events := 0
+	for _, t := range timelines {
+		if len(t.Events) == 0 {
+			notFound = append(notFound, t.XID)
+			continue
+		}
+		t.Annotations = s.annotations.ForTimeline(t)
+		found = append(found, t)
+		events += len(t.Events)
+	}
+	auditCount(c, events)
+	c.JSON(http.StatusOK, gin.H{"transactions": found, "not_found": notFound})
+}
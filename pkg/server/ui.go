@@ -0,0 +1,26 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 内置的网页面板
+//
+//go:embed web
+var webAssets embed.FS
+
+// 注册网页面板：/ 为首页，/ui 下为静态资源
+func registerUI(router *gin.Engine) {
+	assets, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		panic(err)
+	}
+	router.GET("/", func(c *gin.Context) {
+		c.FileFromFS("/", http.FS(assets))
+	})
+	router.StaticFS("/ui", http.FS(assets))
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传接口的请求体大小和字段长度限制，防止单个异常的采集端提交超大的请求或日志
+type UploadLimitsConfig struct {
+	MaxBodyMB       int `json:"max_body_mb"`       // /upload、/upload/batch、/upload/raw、/upload/logstash 请求体的最大大小，默认 16
+	MaxMessageBytes int `json:"max_message_bytes"` // log_message（纯文本行上传为 raw_line）的最大字节数，默认 1048576
+	MaxLevelLength  int `json:"max_level_length"`  // log_level 的最大长度，默认 32
+}
+
+var uploadLimitRejected = metrics.counter("upload_limit_rejected_total", "Uploads rejected by the body size or field length limits, by limit.")
+
+// 检查配置并补全默认值
+func (c UploadLimitsConfig) resolve() (UploadLimitsConfig, error) {
+	if c.MaxBodyMB < 0 || c.MaxMessageBytes < 0 || c.MaxLevelLength < 0 {
+		return c, fmt.Errorf("limits must not be negative")
+	}
+	if c.MaxBodyMB == 0 {
+		c.MaxBodyMB = 16
+	}
+	if c.MaxMessageBytes == 0 {
+		c.MaxMessageBytes = 1 << 20
+	}
+	if c.MaxLevelLength == 0 {
+		c.MaxLevelLength = 32
+	}
+	if c.MaxMessageBytes > c.MaxBodyMB<<20 {
+		return c, fmt.Errorf("max_message_bytes cannot exceed max_body_mb")
+	}
+	return c, nil
+}
+
+func (c UploadLimitsConfig) maxBodyBytes() int64 {
+	return int64(c.MaxBodyMB) << 20
+}
+
+// 读取上传的请求体，超过上限时返回 413，请求说明了其他字符集时转为 UTF-8。ok 为 false 时已写出错误响应并中止请求
+func (s *Service) readUploadBody(c *gin.Context) ([]byte, bool) {
+	body, ok := s.readRawUploadBody(c)
+	if !ok {
+		return nil, false
+	}
+	return transcodeUploadBody(c, body)
+}
+
+// 读取未转码的请求体，超过大小限制时返回 413
+func (s *Service) readRawUploadBody(c *gin.Context) ([]byte, bool) {
+	limit := s.uploadLimits.maxBodyBytes()
+	if c.Request.ContentLength > limit {
+		uploadBodyTooLarge(c, limit)
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unable to read request body"})
+		return nil, false
+	}
+	if int64(len(body)) > limit {
+		uploadBodyTooLarge(c, limit)
+		return nil, false
+	}
+	return body, true
+}
+
+func uploadBodyTooLarge(c *gin.Context, limit int64) {
+	uploadLimitRejected.Add(1, "limit", "body")
+	// 不再读取剩余的请求体，响应后关闭连接
+	c.Header("Connection", "close")
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body exceeds %d bytes", limit), "max_bytes": limit})
+}
+
+// 日志的字段超过长度限制
+type fieldTooLongError struct {
+	Field string
+	Max   int
+}
+
+func (e *fieldTooLongError) Error() string {
+	return fmt.Sprintf("%s exceeds %d bytes", e.Field, e.Max)
+}
+
+// 检查上传日志的字段长度
+func (c UploadLimitsConfig) checkEntry(entry LogData) error {
+	if len(entry.LogLevel) > c.MaxLevelLength {
+		return &fieldTooLongError{Field: "log_level", Max: c.MaxLevelLength}
+	}
+	return c.checkMessage("log_message", entry.LogMessage)
+}
+
+func (c UploadLimitsConfig) checkMessage(field, message string) error {
+	if len(message) > c.MaxMessageBytes {
+		return &fieldTooLongError{Field: field, Max: c.MaxMessageBytes}
+	}
+	return nil
+}
+
+// 字段超长时返回 422，prefix 为批量上传中的日志序号等说明。返回 false 表示没有超长
+func fieldTooLong(c *gin.Context, err error, prefix string) bool {
+	var tooLong *fieldTooLongError
+	if !errors.As(err, &tooLong) {
+		return false
+	}
+	uploadLimitRejected.Add(1, "limit", tooLong.Field)
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": prefix + tooLong.Error(), "field": tooLong.Field, "max_bytes": tooLong.Max})
+	return true
+}
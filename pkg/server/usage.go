@@ -0,0 +1,258 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 一天的分段占用
+type dayUsage struct {
+	Day        string `json:"day"`
+	Bytes      int64  `json:"bytes"`
+	Segments   int    `json:"segments"`
+	Compressed int    `json:"compressed"` // 其中已压缩的分段数
+	Tiered     int    `json:"tiered"`     // 其中已上传到对象存储的分段数
+}
+
+// 单个应用的磁盘占用
+type applicationStorage struct {
+	ApplicationID string     `json:"application_id"`
+	Backend       string     `json:"backend"`
+	Bytes         int64      `json:"bytes"` // 应用目录中全部文件的大小，与磁盘配额的统计一致
+	QuotaBytes    int64      `json:"quota_bytes,omitempty"`
+	Segments      int        `json:"segments"`
+	Days          []dayUsage `json:"days"`
+}
+
+// 存储后端所在文件系统的空间
+type backendStorage struct {
+	Backend    string `json:"backend"`
+	Root       string `json:"root"`
+	Bytes      int64  `json:"bytes"` // 本节点上该后端中应用的占用
+	TotalBytes uint64 `json:"total_bytes,omitempty"`
+	FreeBytes  uint64 `json:"free_bytes,omitempty"`
+}
+
+// 存储卷所在磁盘的空间
+type volumeStorage struct {
+	Root       string `json:"root"`
+	TotalBytes uint64 `json:"total_bytes,omitempty"`
+	FreeBytes  uint64 `json:"free_bytes,omitempty"`
+}
+
+// 管理接口涉及的应用：未指定 application_id 时为全部应用，包括各租户的应用
+func (s *Service) storageApplications(c *gin.Context) ([]string, bool) {
+	if c.Query("application_id") != "" {
+		return s.requestApplications(c)
+	}
+	apps, err := s.listApplications()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list applications"})
+		return nil, false
+	}
+	for _, tenant := range sortedKeys(s.tenants.configs) {
+		tenantApps, err := s.tenantApplications(tenant)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list applications"})
+			return nil, false
+		}
+		apps = append(apps, tenantApps...)
+	}
+	return apps, true
+}
+
+// 统计应用目录的占用，按天汇总分段
+func (s *Service) collectApplicationStorage(applicationID string) (applicationStorage, error) {
+	st := applicationStorage{ApplicationID: applicationID, Backend: s.backends.BackendOf(applicationID), QuotaBytes: s.diskQuotas.Limit(applicationID), Days: []dayUsage{}}
+	bytes, err := folderBytes(s.applicationDir(applicationID))
+	if err != nil {
+		return st, err
+	}
+	st.Bytes = bytes
+	files, err := s.listLogFiles(applicationID)
+	if err != nil {
+		return st, err
+	}
+	days := make(map[string]*dayUsage)
+	for _, f := range files {
+		d := days[f.Day]
+		if d == nil {
+			d = &dayUsage{Day: f.Day}
+			days[f.Day] = d
+		}
+		d.Bytes += f.Size
+		d.Segments++
+		if f.Compressed {
+			d.Compressed++
+		}
+		if f.Tiered {
+			d.Tiered++
+		}
+		st.Segments++
+	}
+	for _, day := range sortedKeys(days) {
+		st.Days = append(st.Days, *days[day])
+	}
+	return st, nil
+}
+
+// 存储占用接口：各应用按天的磁盘占用，以及各 file 后端所在文件系统的剩余空间，只包含本节点
+func (s *Service) storageUsageHandler(c *gin.Context) {
+	apps, ok := s.storageApplications(c)
+	if !ok {
+		return
+	}
+	result := make([]applicationStorage, 0, len(apps))
+	perBackend := make(map[string]int64)
+	var total int64
+	for _, app := range apps {
+		// 不以本地目录存放日志的后端没有文件占用
+		if _, ok := s.queryStoreOf(app); ok {
+			continue
+		}
+		st, err := s.collectApplicationStorage(app)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read application directory: " + app})
+			return
+		}
+		result = append(result, st)
+		perBackend[st.Backend] += st.Bytes
+		total += st.Bytes
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ApplicationID < result[j].ApplicationID })
+
+	roots := make([]backendStorage, 0)
+	for _, name := range s.backends.Names() {
+		_, bc, _ := s.backends.Store(name)
+		if bc.Type != "file" {
+			continue
+		}
+		b := backendStorage{Backend: name, Root: bc.Root, Bytes: perBackend[name]}
+		if total, free, err := diskSpace(bc.Root); err == nil {
+			b.TotalBytes, b.FreeBytes = total, free
+		}
+		roots = append(roots, b)
+	}
+	volumes := make([]volumeStorage, 0)
+	for _, root := range s.storageVolumes.roots() {
+		v := volumeStorage{Root: root}
+		if total, free, err := diskSpace(root); err == nil {
+			v.TotalBytes, v.FreeBytes = total, free
+		}
+		volumes = append(volumes, v)
+	}
+	c.JSON(http.StatusOK, gin.H{"applications": result, "backends": roots, "volumes": volumes, "total_bytes": total})
+}
+
+// 预览中会被删除的一个分段
+type pruneCandidate struct {
+	File   string `json:"file"`
+	Day    string `json:"day"`
+	Bytes  int64  `json:"bytes"`
+	Reason string `json:"reason"` // age：早于保留天数；size：超出大小上限
+}
+
+// 单个应用的清理预览
+type prunePreview struct {
+	ApplicationID  string           `json:"application_id"`
+	Bytes          int64            `json:"bytes"`
+	LimitBytes     int64            `json:"limit_bytes,omitempty"` // 预览使用的大小上限
+	FreedBytes     int64            `json:"freed_bytes"`
+	RemainingBytes int64            `json:"remaining_bytes"`
+	Segments       []pruneCandidate `json:"segments"`
+}
+
+// 按保留天数和大小上限模拟清理：先删除整天早于保留期的分段，再像磁盘配额的 delete_oldest 策略一样
+// 按日期顺序删除，直到占用不超过上限。正在写入的分段不会被删除
+func (s *Service) previewPrune(applicationID string, maxAgeDays int, limit int64, now time.Time) (prunePreview, error) {
+	p := prunePreview{ApplicationID: applicationID, LimitBytes: limit, Segments: []pruneCandidate{}}
+	appFolder := s.applicationDir(applicationID)
+	bytes, err := folderBytes(appFolder)
+	if err != nil {
+		return p, err
+	}
+	segments, err := prunableSegments(appFolder)
+	if err != nil {
+		return p, err
+	}
+	p.Bytes, p.RemainingBytes = bytes, bytes
+
+	cutoff := time.Time{}
+	if maxAgeDays > 0 {
+		cutoff = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -maxAgeDays+1)
+	}
+	for _, seg := range segments {
+		reason := ""
+		if !cutoff.IsZero() && logFileDate(seg.Day).Before(cutoff) {
+			reason = "age"
+		} else if limit > 0 && p.RemainingBytes > limit {
+			reason = "size"
+		}
+		if reason == "" {
+			continue
+		}
+		p.Segments = append(p.Segments, pruneCandidate{File: seg.Name, Day: seg.Day, Bytes: seg.Bytes, Reason: reason})
+		p.FreedBytes += seg.Bytes
+		p.RemainingBytes -= seg.Bytes
+	}
+	return p, nil
+}
+
+// 清理预览接口（只读，不删除任何文件）：按 max_age_days 和 max_mb 列出会被删除的分段及腾出的空间，
+// 未指定 max_mb 时使用应用的磁盘配额，便于在开启自动清理前评估容量
+func (s *Service) prunePreviewHandler(c *gin.Context) {
+	maxAgeDays, maxMB := 0, -1
+	if raw := c.Query("max_age_days"); raw != "" {
+		var err error
+		if maxAgeDays, err = strconv.Atoi(raw); err != nil || maxAgeDays <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_age_days must be a positive integer"})
+			return
+		}
+	}
+	if raw := c.Query("max_mb"); raw != "" {
+		var err error
+		if maxMB, err = strconv.Atoi(raw); err != nil || maxMB <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_mb must be a positive integer"})
+			return
+		}
+	}
+	apps, ok := s.storageApplications(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	previews := make([]prunePreview, 0, len(apps))
+	var freed int64
+	for _, app := range apps {
+		// 归档和法律保留的应用不参与清理
+		if _, ok := s.queryStoreOf(app); ok || s.lifecycle.Retained(app) {
+			continue
+		}
+		limit := s.diskQuotas.Limit(app)
+		if maxMB > 0 {
+			limit = int64(maxMB) << 20
+		}
+		p, err := s.previewPrune(app, maxAgeDays, limit, now)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read application directory: " + app})
+			return
+		}
+		previews = append(previews, p)
+		freed += p.FreedBytes
+	}
+	sort.Slice(previews, func(i, j int) bool { return previews[i].ApplicationID < previews[j].ApplicationID })
+	c.JSON(http.StatusOK, gin.H{"applications": previews, "freed_bytes": freed, "dry_run": true})
+}
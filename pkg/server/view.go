@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单个视图最多保存的日志引用数
+const maxViewRefs = 100000
+
+// 视图默认存活时间
+const defaultViewTTL = time.Hour
+
+var errViewNotFound = errors.New("view not found")
+
+// 临时视图：保存一次查询命中的日志引用，后续查询可直接在该结果集上进行
+type logView struct {
+	Name          string    `json:"name"`
+	ApplicationID string    `json:"application_id"`
+	LogLevel      string    `json:"log_level"`
+	BaseView      string    `json:"base_view,omitempty"`
+	Count         int       `json:"count"`
+	Truncated     bool      `json:"truncated"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+
+	refs []logRef
+}
+
+// 视图存储，仅保存在内存中
+type ViewStore struct {
+	mu    sync.Mutex
+	views map[string]*logView
+}
+
+// 清理过期视图，调用方需持有锁
+func (s *ViewStore) expireLocked(now time.Time) {
+	for name, v := range s.views {
+		if now.After(v.ExpiresAt) {
+			delete(s.views, name)
+		}
+	}
+}
+
+// 保存视图
+func (s *ViewStore) Put(v *logView) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	s.views[v.Name] = v
+}
+
+// 获取视图中的日志引用
+func (s *ViewStore) Refs(name string) ([]logRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	v, ok := s.views[name]
+	if !ok {
+		return nil, errViewNotFound
+	}
+	return v.refs, nil
+}
+
+// 列出未过期的视图
+func (s *ViewStore) List() []*logView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	views := make([]*logView, 0, len(s.views))
+	for _, v := range s.views {
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// 删除视图
+func (s *ViewStore) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.views[name]
+	delete(s.views, name)
+	return ok
+}
+
+// 创建视图请求
+type createViewRequest struct {
+	Name          string `json:"name" binding:"required"`
+	ApplicationID string `json:"application_id"`
+	LogLevel      string `json:"log_level"`
+	View          string `json:"view"` // 在已有视图的基础上继续筛选
+	TTL           string `json:"ttl"`
+}
+
+// 创建临时视图接口：执行查询并保存命中的日志引用
+func (s *Service) viewCreateHandler(c *gin.Context) {
+	var req createViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format or missing required fields"})
+		return
+	}
+	if req.ApplicationID == "" && req.View == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "application_id or view is required"})
+		return
+	}
+	if req.ApplicationID != "" && !validApplicationID(req.ApplicationID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid application_id"})
+		return
+	}
+
+	ttl := defaultViewTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl"})
+			return
+		}
+		ttl = d
+	}
+
+	v := &logView{
+		Name:          req.Name,
+		ApplicationID: req.ApplicationID,
+		LogLevel:      req.LogLevel,
+		BaseView:      req.View,
+	}
+	q := logQuery{ApplicationID: req.ApplicationID, LogLevel: req.LogLevel, View: req.View}
+	err := s.runLogQuery(q, func(entry LogData, ref logRef) bool {
+		if len(v.refs) >= maxViewRefs {
+			v.Truncated = true
+			return false
+		}
+		v.refs = append(v.refs, ref)
+		return true
+	})
+	if errors.Is(err, errViewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read application logs"})
+		return
+	}
+
+	v.Count = len(v.refs)
+	v.CreatedAt = time.Now()
+	v.ExpiresAt = v.CreatedAt.Add(ttl)
+	s.viewStore.Put(v)
+
+	c.JSON(http.StatusOK, v)
+}
+
+// 列出临时视图接口
+func (s *Service) viewListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"views": s.viewStore.List()})
+}
+
+// 删除临时视图接口
+func (s *Service) viewDeleteHandler(c *gin.Context) {
+	if !s.viewStore.Delete(c.Param("name")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "View deleted"})
+}
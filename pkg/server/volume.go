@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 多磁盘部署：新分段按放置策略分布到多个根目录（各磁盘的挂载点），分段文件位于 根目录/后端/应用 下，
+// 应用目录中以同名符号链接指向它，与存储类别相同，查询、计数索引、配额、压缩和分层都照常通过应用目录访问，
+// 因此查询时自动汇总各根目录中的分段。根目录与后端的根目录相同时分段直接写在应用目录中。
+// 只作用于未路由到存储类别的分段，已有的分段不移动
+type StorageVolumesConfig struct {
+	Roots     []string `json:"roots"`       // 分段文件分布的根目录
+	Placement string   `json:"placement"`   // round_robin（默认，轮流放置）或 free_space（放在可用空间最多的根目录）
+	MinFreeMB int      `json:"min_free_mb"` // 可用空间低于该值的根目录不再放置新分段，默认 1024
+}
+
+// 放置策略
+const (
+	placementRoundRobin = "round_robin"
+	placementFreeSpace  = "free_space"
+)
+
+var (
+	volumePlacements = metrics.counter("storage_volume_segments_total", "New log segments placed on each storage volume.")
+
+	errNoStorageVolume = errors.New("no storage volume has enough free space")
+)
+
+// 分段的存储卷，nil 表示未配置
+type volumeSet struct {
+	paths     []string // 根目录的绝对路径
+	placement string
+	minFree   uint64
+
+	mu   sync.Mutex
+	next int
+}
+
+// 按配置创建存储卷，没有配置根目录时返回 nil
+func newVolumeSet(c StorageVolumesConfig) (*volumeSet, error) {
+	if len(c.Roots) == 0 {
+		return nil, nil
+	}
+	switch c.Placement {
+	case "":
+		c.Placement = placementRoundRobin
+	case placementRoundRobin, placementFreeSpace:
+	default:
+		return nil, fmt.Errorf("placement must be round_robin or free_space")
+	}
+	if c.MinFreeMB < 0 {
+		return nil, fmt.Errorf("min_free_mb must not be negative")
+	}
+	if c.MinFreeMB == 0 {
+		c.MinFreeMB = 1024
+	}
+	v := &volumeSet{placement: c.Placement, minFree: uint64(c.MinFreeMB) << 20}
+	seen := make(map[string]bool)
+	for _, root := range c.Roots {
+		// 链接使用绝对路径，不受应用目录位置的影响
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("root %s: %v", root, err)
+		}
+		if seen[abs] {
+			return nil, fmt.Errorf("duplicate root %s", root)
+		}
+		if err := os.MkdirAll(abs, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("root %s: %v", root, err)
+		}
+		seen[abs] = true
+		v.paths = append(v.paths, abs)
+	}
+	return v, nil
+}
+
+// 存储卷中存放应用分段的目录，backendRoot 为后端的根目录。租户后端名称中的冒号不便用作目录名，替换为下划线
+func (v *volumeSet) applicationDir(root, backend, backendRoot, app string) string {
+	if abs, err := filepath.Abs(backendRoot); err == nil && abs == root {
+		return filepath.Join(backendRoot, app)
+	}
+	return filepath.Join(root, strings.ReplaceAll(backend, ":", "_"), app)
+}
+
+// 各存储卷中存放应用分段的目录，不包括应用目录本身
+func (v *volumeSet) applicationDirs(backend, backendRoot, app string) []string {
+	if v == nil {
+		return nil
+	}
+	appFolder := filepath.Join(backendRoot, app)
+	var dirs []string
+	for _, root := range v.paths {
+		if dir := v.applicationDir(root, backend, backendRoot, app); dir != appFolder {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// 按放置策略选择新分段的根目录，跳过可用空间不足的根目录
+func (v *volumeSet) pick() (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	best, bestFree := "", uint64(0)
+	for i := range v.paths {
+		root := v.paths[(v.next+i)%len(v.paths)]
+		_, free, err := diskSpace(root)
+		if err != nil || free < v.minFree {
+			continue
+		}
+		if v.placement == placementRoundRobin {
+			v.next = (v.next + i + 1) % len(v.paths)
+			return root, nil
+		}
+		if free > bestFree {
+			best, bestFree = root, free
+		}
+	}
+	if best == "" {
+		return "", errNoStorageVolume
+	}
+	return best, nil
+}
+
+// 链接是否指向某个存储卷
+func (v *volumeSet) contains(target string) bool {
+	if v == nil {
+		return false
+	}
+	for _, root := range v.paths {
+		if rel, err := filepath.Rel(root, target); err == nil && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// 分段第一次写入前选择存储卷，放在其他根目录时在应用目录中创建指向它的链接。分段已存在时不做任何事
+func (s *fileStore) placeSegment(path string) error {
+	if s.svc.storageVolumes == nil {
+		return nil
+	}
+	if _, err := os.Lstat(path); err == nil || segmentSealed(path) {
+		return nil
+	}
+	root, err := s.svc.storageVolumes.pick()
+	if err != nil {
+		return err
+	}
+	volumePlacements.Add(1, "root", root)
+	appFolder := filepath.Dir(path)
+	dir := s.svc.storageVolumes.applicationDir(root, s.backend, s.root, filepath.Base(appFolder))
+	if dir == appFolder {
+		return nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	err = os.Symlink(filepath.Join(dir, filepath.Base(path)), path)
+	if os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 存储卷的根目录
+func (v *volumeSet) roots() []string {
+	if v == nil {
+		return nil
+	}
+	return v.paths
+}
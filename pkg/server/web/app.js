@@ -0,0 +1,210 @@
+// 简单的单页面板：日志搜索、应用统计、事务时间线
+
+const $ = (sel) => document.querySelector(sel);
+
+// 服务端启用访问控制时使用的 API Key，保存在浏览器本地
+const apiKeyInput = $("#api-key");
+apiKeyInput.value = localStorage.getItem("apiKey") || "";
+apiKeyInput.addEventListener("change", () => {
+  localStorage.setItem("apiKey", apiKeyInput.value.trim());
+  loadApplications().catch((err) => setStatus("#search-status", err.message, true));
+});
+
+// 请求接口，错误时抛出服务端返回的 error 信息
+async function api(path, params) {
+  const query = params ? "?" + new URLSearchParams(params) : "";
+  const key = localStorage.getItem("apiKey");
+  const resp = await fetch(path + query, { headers: key ? { "X-API-Key": key } : {} });
+  const body = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  Object.entries(attrs || {}).forEach(([k, v]) => (k === "class" ? (node.className = v) : node.setAttribute(k, v)));
+  children.forEach((c) => node.append(c === undefined || c === null ? "" : c));
+  return node;
+}
+
+function setStatus(id, text, isError) {
+  const node = $(id);
+  node.textContent = text;
+  node.classList.toggle("error", !!isError);
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+function formatBytes(n) {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return n.toFixed(i ? 1 : 0) + " " + units[i];
+}
+
+// 页面切换
+function showPage() {
+  const page = location.hash.slice(1) || "search";
+  document.querySelectorAll(".page").forEach((p) => p.classList.toggle("active", p.id === "page-" + page));
+  document.querySelectorAll("nav a[data-page]").forEach((a) => a.classList.toggle("active", a.dataset.page === page));
+  if (page === "stats") {
+    loadStats();
+  }
+}
+
+// 填充应用下拉框
+async function loadApplications() {
+  const { applications } = await api("/applications");
+  document.querySelectorAll(".app-select").forEach((select) => {
+    select.replaceChildren(...applications.map((app) => el("option", { value: app }, app)));
+  });
+}
+
+// 日志搜索
+$("#search-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  const params = new URLSearchParams();
+  ["application_id", "log_level", "sort", "limit"].forEach((k) => params.set(k, form.get(k)));
+  if (form.get("q")) {
+    params.set("q", form.get("q"));
+    params.set("highlight", "offsets");
+  }
+  form
+    .get("fields")
+    .split(",")
+    .map((s) => s.trim())
+    .filter((s) => s.includes("="))
+    .forEach((s) => {
+      const [k, ...v] = s.split("=");
+      params.append("field." + k.trim(), v.join("=").trim());
+    });
+
+  setStatus("#search-status", "查询中…");
+  try {
+    const { logs, truncated } = await api("/query", params);
+    $("#search-results").replaceChildren(
+      ...logs.map((log) =>
+        el(
+          "tr",
+          {},
+          el("td", {}, log.timestamp),
+          el("td", { class: "level-" + log.log_level }, log.log_level),
+          el("td", {}, log.logger),
+          el("td", { class: "msg" }, ...highlightMessage(log))
+        )
+      )
+    );
+    setStatus("#search-status", `共 ${logs.length} 条` + (truncated ? "（超出响应大小上限，已截断）" : ""));
+  } catch (err) {
+    setStatus("#search-status", err.message, true);
+  }
+});
+
+// 按命中位置（字符位置）把消息拆成普通文本和 <mark> 节点
+function highlightMessage(log) {
+  const chars = Array.from(log.log_message || "");
+  const matches = (log.highlight && log.highlight.matches) || [];
+  const parts = [];
+  let i = 0;
+  matches.forEach(([start, end]) => {
+    parts.push(chars.slice(i, start).join(""), el("mark", {}, chars.slice(start, end).join("")));
+    i = end;
+  });
+  parts.push(chars.slice(i).join(""));
+  return parts;
+}
+
+// 应用统计
+async function loadStats() {
+  setStatus("#stats-status", "统计中…");
+  try {
+    const { applications } = await api("/stats");
+    $("#stats-results").replaceChildren(
+      ...applications.map((s) =>
+        el(
+          "tr",
+          {},
+          el("td", {}, s.application_id),
+          el("td", {}, s.backend),
+          el("td", {}, s.total),
+          el("td", { class: "level-ERROR" }, s.levels.ERROR || 0),
+          el("td", { class: "level-WARN" }, s.levels.WARN || 0),
+          el("td", {}, s.levels.INFO || 0),
+          el("td", {}, s.files),
+          el("td", {}, formatBytes(s.bytes)),
+          el("td", {}, formatTime(s.first_seen)),
+          el("td", {}, formatTime(s.last_seen))
+        )
+      )
+    );
+    setStatus("#stats-status", "");
+    loadTopErrors();
+  } catch (err) {
+    setStatus("#stats-status", err.message, true);
+  }
+}
+
+async function loadTopErrors() {
+  const app = $("#top-app").value;
+  if (!app) {
+    return;
+  }
+  try {
+    const { applications } = await api("/errors/top", { application_id: app });
+    $("#top-results").replaceChildren(
+      ...applications[0].top.map((p) =>
+        el("tr", {}, el("td", {}, p.count), el("td", { class: "msg" }, p.template), el("td", {}, p.logger), el("td", {}, formatTime(p.last_seen)))
+      )
+    );
+  } catch (err) {
+    setStatus("#stats-status", err.message, true);
+  }
+}
+
+$("#top-app").addEventListener("change", loadTopErrors);
+
+// 事务时间线
+$("#xid-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const xid = new FormData(e.target).get("xid").trim();
+  location.hash = "xid";
+  setStatus("#xid-status", "查询中…");
+  $("#xid-summary").replaceChildren();
+  $("#xid-results").replaceChildren();
+  try {
+    const t = await api("/transactions/" + encodeURIComponent(xid));
+    $("#xid-summary").replaceChildren(
+      el("dt", {}, "应用"), el("dd", {}, t.application_ids.join(", ")),
+      el("dt", {}, "分支"), el("dd", {}, t.branch_ids.join(", ") || "-"),
+      el("dt", {}, "开始"), el("dd", {}, formatTime(t.first_seen)),
+      el("dt", {}, "结束"), el("dd", {}, formatTime(t.last_seen)),
+      el("dt", {}, "耗时"), el("dd", {}, t.duration_ms + " ms")
+    );
+    $("#xid-results").replaceChildren(
+      ...t.events.map((ev) =>
+        el(
+          "li",
+          {},
+          el("div", { class: "meta" }, `${formatTime(ev.at)} · ${ev.entry.application_id} · `, el("span", { class: "level-" + ev.entry.log_level }, ev.entry.log_level), ev.entry.logger ? " · " + ev.entry.logger : ""),
+          el("div", { class: "msg" }, ev.entry.log_message)
+        )
+      )
+    );
+    setStatus("#xid-status", `共 ${t.events.length} 条日志`);
+  } catch (err) {
+    setStatus("#xid-status", err.message, true);
+  }
+});
+
+window.addEventListener("hashchange", showPage);
+loadApplications()
+  .catch((err) => setStatus("#search-status", err.message, true))
+  .finally(showPage);
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 写入延迟监控：按应用统计单次追加写入分段的耗时，在 /metrics 中以 summary 输出最近若干次写入的分位数，
+// 单次写入超过阈值时记录一条告警日志，便于发现慢盘或 NFS 抖动
+type WriteLatencyConfig struct {
+	SlowThreshold Duration `json:"slow_threshold"` // 单次写入超过该时长时记录告警日志，默认 500ms
+	Window        int      `json:"window"`         // 每个应用计算分位数的最近写入次数，默认 1024
+}
+
+// 输出的分位数
+var writeLatencyQuantiles = []float64{0.5, 0.9, 0.99}
+
+var slowWrites = metrics.counter("ingest_slow_writes_total", "Appends to a log segment slower than write_latency.slow_threshold, by application.")
+
+// 一个应用最近的写入耗时，samples 为环形缓冲
+type latencySamples struct {
+	samples []float64
+	next    int
+	count   uint64
+	sum     float64
+}
+
+// 按应用记录写入耗时
+type writeLatencyTracker struct {
+	threshold time.Duration
+	window    int
+
+	mu   sync.Mutex
+	apps map[string]*latencySamples
+}
+
+func newWriteLatencyTracker(c WriteLatencyConfig) (*writeLatencyTracker, error) {
+	if c.SlowThreshold < 0 || c.Window < 0 {
+		return nil, fmt.Errorf("slow_threshold and window must not be negative")
+	}
+	if c.SlowThreshold == 0 {
+		c.SlowThreshold = Duration(500 * time.Millisecond)
+	}
+	if c.Window == 0 {
+		c.Window = 1024
+	}
+	return &writeLatencyTracker{threshold: time.Duration(c.SlowThreshold), window: c.Window, apps: make(map[string]*latencySamples)}, nil
+}
+
+// 记录一次写入的耗时，超过阈值时记录告警日志
+func (t *writeLatencyTracker) Observe(applicationID, backend, file string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	seconds := d.Seconds()
+	t.mu.Lock()
+	s, ok := t.apps[applicationID]
+	if !ok {
+		s = &latencySamples{samples: make([]float64, 0, t.window)}
+		t.apps[applicationID] = s
+	}
+	if len(s.samples) < t.window {
+		s.samples = append(s.samples, seconds)
+	} else {
+		s.samples[s.next] = seconds
+		s.next = (s.next + 1) % t.window
+	}
+	s.count++
+	s.sum += seconds
+	t.mu.Unlock()
+
+	if d >= t.threshold {
+		slowWrites.Add(1, "application_id", applicationID)
+		log.Printf("slow write: app=%s backend=%s file=%s duration_ms=%.1f threshold_ms=%.1f",
+			applicationID, backend, file, durationMS(d), durationMS(t.threshold))
+	}
+}
+
+// 最近写入的分位数
+func (t *writeLatencyTracker) Quantiles(applicationID string) map[float64]float64 {
+	t.mu.Lock()
+	s, ok := t.apps[applicationID]
+	var sorted []float64
+	if ok {
+		sorted = append(sorted, s.samples...)
+	}
+	t.mu.Unlock()
+	if len(sorted) == 0 {
+		return nil
+	}
+	sort.Float64s(sorted)
+	result := make(map[float64]float64, len(writeLatencyQuantiles))
+	for _, q := range writeLatencyQuantiles {
+		i := int(math.Ceil(q*float64(len(sorted)))) - 1
+		result[q] = sorted[max(i, 0)]
+	}
+	return result
+}
+
+// 按 Prometheus 文本格式写出 summary：分位数基于最近 window 次写入，_sum 和 _count 为启动以来的累计值
+func (t *writeLatencyTracker) WriteText(w io.Writer) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	apps := sortedKeys(t.apps)
+	totals := make(map[string][2]float64, len(apps))
+	for _, app := range apps {
+		totals[app] = [2]float64{t.apps[app].sum, float64(t.apps[app].count)}
+	}
+	t.mu.Unlock()
+
+	const name = "ingest_write_latency_seconds"
+	fmt.Fprintf(w, "# HELP %s Time to append one entry to a log segment, by application.\n# TYPE %s summary\n", name, name)
+	for _, app := range apps {
+		quantiles := t.Quantiles(app)
+		for _, q := range writeLatencyQuantiles {
+			fmt.Fprintf(w, "%s%s %g\n", name, labelKey([]string{"application_id", app, "quantile", fmt.Sprint(q)}), quantiles[q])
+		}
+		label := labelKey([]string{"application_id", app})
+		fmt.Fprintf(w, "%s_sum%s %g\n%s_count%s %g\n", name, label, totals[app][0], name, label, totals[app][1])
+	}
+}
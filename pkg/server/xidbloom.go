@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 日志行中形如 XID 的片段（ip:port:事务号），不要求前面带有 xid 字段名
+var xidTokenPattern = regexp.MustCompile(`[\w.\-]+:\d+:\d+`)
+
+// 完整的 XID，只有这种形式的查询才能使用布隆过滤器
+var xidExactPattern = regexp.MustCompile(`^[\w.\-]+:\d+:\d+$`)
+
+// 调用 fn 处理行中的每个 XID 片段。片段前面可能连着其他字符（如 tx_192.168.1.1:8091:1），
+// 分隔符之后的每个后缀也一并处理
+func xidTokens(line string, fn func(token string)) {
+	for _, token := range xidTokenPattern.FindAllString(line, -1) {
+		fn(token)
+		for i := 0; i < len(token); i++ {
+			if c := token[i]; c == '.' || c == '-' || c == '_' {
+				if xidExactPattern.MatchString(token[i+1:]) {
+					fn(token[i+1:])
+				}
+			}
+		}
+	}
+}
+
+const (
+	xidBloomVersion  = 1
+	xidBloomCapacity = 1024 // 新分段过滤器的初始容量，超出后加倍重建
+	xidBloomBits     = 10   // 每个 XID 占用的位数，配合 7 个哈希约 1% 误判
+	xidBloomHashes   = 7
+)
+
+var xidBloomSkipped = metrics.counter("xid_bloom_segments_skipped_total", "Segments skipped by XID lookups because their bloom filter rules out every requested XID.")
+
+// 一个已关闭分段的 XID 布隆过滤器
+type xidBloom struct {
+	Offset   int64  `json:"offset"`   // 已加入的字节偏移，导入追加后从这里继续
+	Count    int    `json:"count"`    // 已加入的不同 XID 数，按过滤器判断，略有低估
+	Capacity int    `json:"capacity"` // Count 超过容量时加倍重建
+	Bits     []byte `json:"bits"`
+}
+
+func newXIDBloom(capacity int) *xidBloom {
+	return &xidBloom{Capacity: capacity, Bits: make([]byte, (capacity*xidBloomBits+7)/8)}
+}
+
+// 双重哈希得到的各个位置
+func (b *xidBloom) positions(token string, fn func(bit uint64) bool) bool {
+	h := fnv.New64a()
+	h.Write([]byte(token))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	m := uint64(len(b.Bits)) * 8
+	for i := uint64(0); i < xidBloomHashes; i++ {
+		if !fn((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *xidBloom) add(token string) {
+	added := false
+	b.positions(token, func(bit uint64) bool {
+		if b.Bits[bit/8]&(1<<(bit%8)) == 0 {
+			b.Bits[bit/8] |= 1 << (bit % 8)
+			added = true
+		}
+		return true
+	})
+	if added {
+		b.Count++
+	}
+}
+
+func (b *xidBloom) mayContain(token string) bool {
+	return b.positions(token, func(bit uint64) bool { return b.Bits[bit/8]&(1<<(bit%8)) != 0 })
+}
+
+// 一个应用目录的布隆过滤器
+type appXIDBlooms struct {
+	mu       sync.Mutex
+	path     string
+	Version  int                  `json:"version"`
+	Dir      string               `json:"dir"`
+	Segments map[string]*xidBloom `json:"segments"` // 逻辑文件名 → 过滤器
+}
+
+// 按分段记录 XID 的布隆过滤器，持久化在 data_dir/xidbloom。只为已关闭的分段建立，
+// 查询时补读新关闭或被导入追加的分段，仍在写入的分段总是读取
+type xidBloomIndex struct {
+	svc  *Service
+	mu   sync.Mutex
+	dir  string
+	apps map[string]*appXIDBlooms
+}
+
+func (s *Service) newXIDBloomIndex(dataDir string) (*xidBloomIndex, error) {
+	dir := filepath.Join(dataDir, "xidbloom")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &xidBloomIndex{svc: s, dir: dir, apps: make(map[string]*appXIDBlooms)}, nil
+}
+
+// 应用的过滤器，首次访问时从磁盘加载
+func (x *xidBloomIndex) app(appFolder string) (*appXIDBlooms, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if a, ok := x.apps[appFolder]; ok {
+		return a, nil
+	}
+	sum := sha256.Sum256([]byte(appFolder))
+	a := &appXIDBlooms{path: filepath.Join(x.dir, hex.EncodeToString(sum[:8])+".json")}
+	if err := loadJSONFile(a.path, a); err != nil {
+		return nil, err
+	}
+	if a.Dir != appFolder || a.Version != xidBloomVersion {
+		a.Version, a.Dir, a.Segments = xidBloomVersion, appFolder, nil
+	}
+	if a.Segments == nil {
+		a.Segments = make(map[string]*xidBloom)
+	}
+	x.apps[appFolder] = a
+	return a, nil
+}
+
+// 补读各分段后返回可以跳过的分段：已关闭、全部计入过滤器，且过滤器排除了所有 xids
+func (x *xidBloomIndex) Skippable(ctx context.Context, applicationID string, xids []string, now time.Time) (map[string]bool, error) {
+	appFolder := x.svc.applicationDir(applicationID)
+	a, err := x.app(appFolder)
+	if err != nil {
+		return nil, err
+	}
+	names, err := listSegments(appFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	last := make(map[string]int)
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+		if day, index, ok := parseSegmentName(name); ok && index >= last[day] {
+			last[day] = index
+		}
+	}
+	changed := false
+	for name := range a.Segments {
+		if !present[name] {
+			delete(a.Segments, name)
+			changed = true
+		}
+	}
+
+	skip := make(map[string]bool)
+	for _, name := range names {
+		day, index, ok := parseSegmentName(name)
+		if !ok || !(index < last[day] || now.Sub(logFileDate(day).AddDate(0, 0, 1)) > compressGrace) {
+			continue
+		}
+		b := a.Segments[name]
+		size := int64(-1) // 已压缩的分段不会再变化
+		if info, err := os.Stat(filepath.Join(appFolder, name)); err == nil {
+			size = info.Size()
+		}
+		if b == nil || size >= 0 && size < b.Offset {
+			// 新关闭的分段，或分段被重写变短
+			b = newXIDBloom(xidBloomCapacity)
+			a.Segments[name] = b
+		}
+		if b.Offset == 0 || size > b.Offset {
+			if err := b.catchUp(ctx, x.svc, filepath.Join(appFolder, name)); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+		// 末尾还有未计入的半行
+		if size > b.Offset {
+			continue
+		}
+		excluded := true
+		for _, xid := range xids {
+			if b.mayContain(xid) {
+				excluded = false
+				break
+			}
+		}
+		skip[name] = excluded
+	}
+
+	if changed {
+		if err := saveJSONFile(a.path, a); err != nil {
+			return nil, err
+		}
+	}
+	return skip, nil
+}
+
+// 从 Offset 开始把分段中的 XID 加入过滤器，只计入完整的行；超出容量时加倍后从头重建
+func (b *xidBloom) catchUp(ctx context.Context, s *Service, path string) error {
+	for {
+		_, err := s.scanFileLines(ctx, path, b.Offset, func(line string, offset, next int64) bool {
+			if next-offset == int64(len(line)) {
+				return false
+			}
+			xidTokens(line, b.add)
+			b.Offset = next
+			return b.Count <= b.Capacity
+		})
+		if err != nil {
+			return err
+		}
+		if b.Count <= b.Capacity {
+			return nil
+		}
+		*b = *newXIDBloom(b.Capacity * 2)
+	}
+}
+
+// 丢弃分段的过滤器，下次查询时重新建立
+func (x *xidBloomIndex) Forget(applicationID, name string) error {
+	a, err := x.app(x.svc.applicationDir(applicationID))
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.Segments[name]; !ok {
+		return nil
+	}
+	delete(a.Segments, name)
+	return saveJSONFile(a.path, a)
+}
+
+// 丢弃应用全部分段的过滤器，下次查询时重新建立
+func (x *xidBloomIndex) Reset(applicationID string) error {
+	a, err := x.app(x.svc.applicationDir(applicationID))
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Segments = make(map[string]*xidBloom)
+	return saveJSONFile(a.path, a)
+}
+
+// 遍历可能包含 xids 中任一 XID 的日志行。本地存储的应用按分段的布隆过滤器跳过不包含这些 XID 的分段；
+// 查询后端、不是完整 XID 的查询或过滤器无法建立时读取全部分段
+func (s *Service) forEachStoredLineWithXIDs(ctx context.Context, applicationID string, xids []string, fn func(line string, ref logRef) bool) error {
+	exact := len(xids) > 0
+	for _, xid := range xids {
+		exact = exact && xidExactPattern.MatchString(xid)
+	}
+	if _, ok := s.queryStoreOf(applicationID); ok || !exact || s.xidBlooms == nil {
+		return s.forEachStoredLineBetween(ctx, applicationID, time.Time{}, time.Time{}, fn)
+	}
+	skip, err := s.xidBlooms.Skippable(ctx, applicationID, xids, time.Now())
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !os.IsNotExist(err) {
+			log.Printf("xid bloom unavailable: app=%s err=%v", applicationID, err)
+		}
+		return s.forEachStoredLineBetween(ctx, applicationID, time.Time{}, time.Time{}, fn)
+	}
+	return s.forEachStoredSegmentLine(ctx, applicationID, func(name string) bool {
+		if skip[name] {
+			xidBloomSkipped.Add(1)
+			return false
+		}
+		return true
+	}, fn)
+}
@@ -0,0 +1,50 @@
+// Package storage 定义日志存储后端的接口。服务内置的本地目录和 ClickHouse 后端实现这些接口，
+// 嵌入服务的程序也可以实现 QueryStore，通过 server.WithStore 以后端名称注入，按 backends 配置或迁移接口放置应用
+package storage
+
+import (
+	"context"
+	"time"
+
+	"logAnalysis/pkg/model"
+)
+
+// 遍历游标，由后端自行定义：本地目录后端为 文件名 → 已读取到的字节偏移
+type Cursor map[string]int64
+
+// 日志存储后端
+type LogStore interface {
+	// 将日志追加到应用的指定日志文件（按日期命名）
+	AppendEntry(applicationID, fileName string, entry model.LogData) error
+	// 从游标位置开始遍历应用的日志，返回遍历结束时的游标，可用于增量续传
+	ScanFrom(applicationID string, cursor Cursor, fn func(entry model.LogData, ref model.Ref) bool) (Cursor, error)
+	// 删除应用的全部日志
+	RemoveApplication(applicationID string) error
+}
+
+// 后端可以在存储中执行的过滤条件，其余条件由服务在解析日志后判断
+type Filter struct {
+	Context       context.Context // 查询取消或超时后应停止读取，为 nil 时不限
+	ApplicationID string
+	LogLevel      string    // 级别，为空时不限。ScanLines 可只按原始行包含该字符串预过滤，服务解析后再精确比较级别字段；Count 须精确比较
+	From, To      time.Time // 零值表示不限
+	SinceID       int64     // 只返回 ID 大于该值的日志，0 表示不限
+	MaxID         int64     // 只返回 ID 不大于该值的日志，0 表示不限
+}
+
+// 不以本地目录存放日志的后端（如 clickhouse）自行执行查询和遍历，
+// 依赖应用目录的功能（计数索引、完整性检查、分段压缩和分层）不作用于这些后端。
+// 日志行为 JSON 编码的 model.LogData，行引用的 Offset 由后端定义，Lines 以它定位日志行
+type QueryStore interface {
+	LogStore
+	// 按过滤条件遍历应用的原始日志行，按写入顺序
+	ScanLines(f Filter, fn func(line string, ref model.Ref) bool) error
+	// 统计满足过滤条件的条数
+	Count(f Filter) (int, error)
+	// 按行引用读取日志行，refs 须为同一应用，返回 Offset → 日志行
+	Lines(applicationID string, refs []model.Ref) (map[int64]string, error)
+	// 后端中有日志的应用
+	Applications() ([]string, error)
+	// 应用已写入的最大日志 ID
+	LastID(applicationID string) (int64, error)
+}